@@ -51,10 +51,23 @@ If no context is available, state "No historical precedent found" in Step 1.
    - Example: Usage is 0.18 cores (180m) -> multiply by 1.2 -> 0.216 cores -> output "216m"
    - Example: Usage is 120Mi → multiply by 1.2 -> 144Mi -> output "144Mi"
 
+4. IF Trigger is "No Requests Set":
+   - The deployment has no CPU or memory request, a current request of 0 means unset
+   - SET initial requests from observed usage
+   - Formula: New request = Current Usage × 1.3
+   - Apply minimum floor: Never go below 10m CPU or 32Mi Memory
+   - Example: Usage is 0.2 cores (200m) -> multiply by 1.3 -> 260m
+
+5. IF Trigger is "Limits Without Requests" or "No Memory Limit":
+   - SET requests and limits together
+   - A limit set without a request is KEPT, the request comes from usage × 1.3
+   - A missing memory limit is 2x the memory request
+   - A missing CPU limit stays missing
+
 ### CRITICAL RULES
 - For Waste triggers: New request MUST be LESS than current request
 - For Risk triggers: New request MUST be MORE than current request but LESS than 2x current request
-- **LIMITS CALCULATION: Limits are ALWAYS exactly 2x the requests**
+- **LIMITS CALCULATION: Limits are ALWAYS exactly 2x the requests** (except rule 5)
   - Example: If CPU request is 250m, CPU limit MUST be 500m (250 × 2)
   - Example: If Memory request is 256Mi, Memory limit MUST be 512Mi (256 × 2)
   - **Never use 1Gi or 2Gi for limits unless the request calculation results in exactly that value**
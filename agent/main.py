@@ -1,4 +1,5 @@
 # agent entry point - polls queue
+import os
 import sys
 import uuid
 from utils.redis_client import get_redis_client
@@ -10,7 +11,8 @@ def main():
     
     # Setup Connection
     redis_conn = get_redis_client()
-    queue: QueuePoller = RedisQueueClient(redis_conn)
+    # queue:agent:jobs:<cluster> or queue:agent:jobs:<cluster>:<namespace> when the hub routes jobs
+    queue: QueuePoller = RedisQueueClient(redis_conn, os.getenv("AGENT_QUEUE", "queue:agent:jobs"))
 
     print(f"Polling queue: {queue.queue_name}")
 
@@ -20,6 +22,13 @@ def main():
             job_data = queue.poll()
             
             if job_data:
+                # only deployment jobs are handled by this agent
+                # older hubs do not send target_type
+                target_type = job_data.get('target_type', 'deployment')
+                if target_type != 'deployment':
+                    print(f"\nSkipping {target_type} job: {job_data.get('reason')}")
+                    continue
+
                 dep_info = job_data.get('deployments', {})
                 dep_name = dep_info.get('name', 'Unknown')
 
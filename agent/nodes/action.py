@@ -23,13 +23,51 @@ def execute_pr(state: AgentState) -> Dict[str, Any]:
     patch = state["suggested_patch"]
     reasoning = state["thought_process"]
 
+    # the hub marks jobs notify only when a rolling restart is not safe or a routing rule asks for it
+    if state.get("action") == "notify_only":
+        print(f"Notify only for {dep_name}, skipping PR...")
+        return({"pr_url": None})
+
+    # name the owning team so reviewers know who to ask
+    ownership = state.get("ownership")
+    if ownership:
+        contacts = [ownership[k] for k in ("slack_channel", "oncall") if ownership.get(k)]
+        reasoning += f"\n\nOwner: {ownership.get('team', 'unknown team')}"
+        if contacts:
+            reasoning += f" ({', '.join(contacts)})"
+
+    # a routing rule can require a reviewer before the change is merged
+    routing = state.get("routing")
+    if routing and routing.get("approval") == "manual":
+        reasoning += f"\n\nApproval: manual review required (routing rule {routing.get('rule')})"
+
+    # so can the hub's automation tier, for changes too large or too uncertain to apply unreviewed
+    automation = state.get("automation")
+    if automation and automation.get("tier") == "manual":
+        reasoning += (f"\n\nApproval: manual review required (impact {automation.get('impact', 0):.0%}, "
+                      f"confidence {automation.get('confidence', 0):.2f})")
+
+    # Terraform owns the namespace, the hub's rendered override goes in the PR instead of a manifest patch
+    output = state.get("output")
+    if output and output.get("format") == "tfvars":
+        pr_url = scm_client.create_tfvars_pr(job_id, dep_name, output, reasoning)
+        if pr_url:
+            print(f"PR created: {pr_url}")
+        return {"pr_url": pr_url}
+
     # if empty patch, skip PR
     if not patch:
         print("No patch generated, skipping PR...")
         return({"pr_url": None})
 
-    # create PR
-    pr_url = scm_client.create_pr(job_id, dep_name, patch, reasoning)
+    # GitOps applies the merged patch at once, so the hub's staged plan goes in the PR for reviewers
+    plan = state.get("apply_plan")
+    if plan:
+        stages = ", ".join(f"{s['percent']}% then wait {s['wait_seconds']}s" for s in plan["stages"])
+        reasoning += f"\n\nRollout plan: {stages}; roll back if pods restart more than {plan['max_restarts']} times."
+
+    # create PR against the Argo CD Application or Helm release the deployment is synced from
+    pr_url = scm_client.create_pr(job_id, dep_name, patch, reasoning, state["deployments"].get("owner"))
 
     if pr_url:
         print(f"PR created: {pr_url}")
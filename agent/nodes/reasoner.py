@@ -109,6 +109,17 @@ def validate_patch(patch: dict, job_data: dict) -> bool:
         if 'Waste' in reason and cpu_req_m > current_cpu_m:
             print(f"[ERROR] High Waste trigger but CPU increased!")
             return False
+
+        # Rule 4: Reductions may not go past the hub's step, larger gaps close over several jobs
+        step = (job_data.get('recommendation') or {}).get('recommended_requests')
+        if step:
+            current_mem_mb = job_data['deployments']['current_requests']['memory_mb']
+            if cpu_req_m < current_cpu_m and cpu_req_m < step['cpu_cores'] * 1000:
+                print(f"[ERROR] Proposed CPU {cpu_req_m}m is below the allowed step {step['cpu_cores'] * 1000}m!")
+                return False
+            if mem_req_mb < current_mem_mb and mem_req_mb < step['memory_mb']:
+                print(f"[ERROR] Proposed memory {mem_req_mb}MB is below the allowed step {step['memory_mb']}MB!")
+                return False
         
         return True
         
@@ -3,25 +3,40 @@ from abc import ABC, abstractmethod
 from typing import Optional, Dict, Any
 from redis import Redis
 
+# newest envelope version this agent understands
+ENVELOPE_VERSION = 1
+
 class QueuePoller(ABC):
     @abstractmethod
     def poll(self, timeout: int=0) -> Optional[Dict[str, Any]]:
         pass
 
+def unwrap(message: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+    # hub messages wrap the job in a versioned envelope
+    # older hubs push the job itself, which has no version
+    if "version" not in message:
+        return message
+    if message["version"] > ENVELOPE_VERSION:
+        print(f"Skipping message with envelope version {message['version']} (routing key {message.get('routing_key')})")
+        return None
+    return message.get("payload")
+
 class RedisQueueClient(QueuePoller):
+    # queue_name may list several comma separated queues, e.g. the lists of a few namespaces
     def __init__(self, client: Redis, queue_name: str = "queue:agent:jobs"):
         self.client = client
         self.queue_name = queue_name
+        self.queue_names = [q.strip() for q in queue_name.split(",") if q.strip()]
 
     def poll(self, timeout: int=0) -> Optional[Dict[str, Any]]:
         # blocking poll for a job from queue
         # returns parsed dictionary or none if timeout/error
         try:
-            result = self.client.brpop(self.queue_name, timeout=timeout)
+            result = self.client.brpop(self.queue_names, timeout=timeout)
             if result:
                 _, row_data = result
-                return json.loads(row_data)
+                return unwrap(json.loads(row_data))
             return None
         except Exception as e:
             print(f"Queue poll error {e}")
-            return None
\ No newline at end of file
+            return None
@@ -1,11 +1,13 @@
 # this file defines AgentState
-from typing import TypedDict, Optional, Dict, List
+from typing import Any, TypedDict, Optional, Dict, List
 
 class DeploymentInfo(TypedDict):
     name: str
     current_requests: Dict[str, float]
     current_usage: Dict[str, float]
     predicted_peak_24h: Optional[Dict[str, float]]
+    # Argo CD Application or Helm release: {"kind", "name", "repo_url", "path", "target_revision", "values_file"}
+    owner: Optional[Dict[str, str]]
 
 class ClusterInfo(TypedDict): 
     vm_count: float
@@ -15,8 +17,23 @@ class ClusterInfo(TypedDict):
 class AgentState(TypedDict):
     job_id: str
     reason: str
+    # "apply" or "notify_only", older hubs do not send it
+    action: Optional[str]
     namespace: str
     deployments: DeploymentInfo
+    # hub recommendation, recommended_requests is the largest step allowed per action
+    # recommended_limits is only sent for deployments that report their limits
+    recommendation: Optional[Dict[str, Dict[str, float]]]
+    # staged apply from the hub policy: {"stages": [{"percent", "wait_seconds"}], "max_restarts"}
+    apply_plan: Optional[Dict[str, Any]]
+    # set when the namespace is managed by Terraform: {"format": "tfvars", "file", "variable", "content"}
+    output: Optional[Dict[str, str]]
+    # team owning the deployment: {"team", "slack_channel", "oncall"}, each optional
+    ownership: Optional[Dict[str, str]]
+    # routing rule matching the job: {"rule", "channels", "approval"}, approval is "auto", "manual" or "notify_only"
+    routing: Optional[Dict[str, Any]]
+    # automation tier from the hub policy: {"tier", "impact", "confidence"}, tier is "auto", "manual" or "notify_only"
+    automation: Optional[Dict[str, Any]]
     cluster_info: ClusterInfo
 
     # memory
@@ -6,13 +6,30 @@ from abc import ABC, abstractmethod
 
 class SCMClient(ABC):
     @abstractmethod
-    def create_pr(self, job_id: str, deployment_name: str, patch: Dict[str, Any], reasoning: str) -> Optional[str]:
+    def create_pr(self, job_id: str, deployment_name: str, patch: Dict[str, Any], reasoning: str, owner: Optional[Dict[str, Any]] = None) -> Optional[str]:
         """
         Create a branch, applies the patch, and opens a PR.
+        owner is the Argo CD Application or Helm release the hub reported for the deployment
         Returns the PR URL if successful, none otherwise"
         """
         pass
 
+    @abstractmethod
+    def create_tfvars_pr(self, job_id: str, deployment_name: str, output: Dict[str, str], reasoning: str) -> Optional[str]:
+        """
+        Create a branch, writes the hub's tfvars override, and opens a PR.
+        Returns the PR URL if successful, none otherwise
+        """
+        pass
+
+# "https://github.com/org/repo.git" or "git@github.com:org/repo" -> "org/repo", None for other hosts
+def github_repo_name(repo_url: str) -> Optional[str]:
+    for prefix in ("https://github.com/", "http://github.com/", "git@github.com:"):
+        if repo_url.startswith(prefix):
+            name = repo_url[len(prefix):].rstrip("/")
+            return name[:-len(".git")] if name.endswith(".git") else name
+    return None
+
 # Reference: https://pygithub.readthedocs.io/en/latest/apis.html
 class GitHubClient(SCMClient):
     def __init__(self):
@@ -26,22 +43,37 @@ class GitHubClient(SCMClient):
         self.repo = self.g.get_repo(repo_name)
 
     # the idea is to create a branch, get file content, apply patch, commit, and create a PR
-    def create_pr(self, job_id: str, deployment_name: str, patch: Dict[str, Any], reasoning: str) -> Optional[str]:
+    def create_pr(self, job_id: str, deployment_name: str, patch: Dict[str, Any], reasoning: str, owner: Optional[Dict[str, Any]] = None) -> Optional[str]:
         base_branch = "main"
         new_branch = f"optimise-{deployment_name}--{job_id[:8]}"
+        file_path = f"deployments/google-online-boutique/base/{deployment_name}.yaml"
+        repo_name = self.repo.full_name
+
+        # change the source the owner syncs from, anything else is reverted on the next sync
+        if owner:
+            repo_name = github_repo_name(owner.get("repo_url", "")) or repo_name
+            revision = owner.get("target_revision")
+            if revision and revision != "HEAD":
+                base_branch = revision
+            path = owner.get("path", "").strip("/")
+            if owner.get("kind") == "helm" and owner.get("values_file"):
+                file_path = "/".join(p for p in (path, owner["values_file"]) if p)
+            elif path:
+                file_path = f"{path}/{deployment_name}.yaml"
+            reasoning += f"\n\nOwner: {owner.get('kind')} {owner.get('name')} ({repo_name}:{file_path} on {base_branch})"
 
         # create a new branch from the latest commit sha of main
         try:
+            repo = self.repo if repo_name == self.repo.full_name else self.g.get_repo(repo_name)
             try:
-                gb = self.repo.get_branch(base_branch)
-                self.repo.create_git_ref(ref=f"refs/heads/{new_branch}", sha=gb.commit.sha)
+                gb = repo.get_branch(base_branch)
+                repo.create_git_ref(ref=f"refs/heads/{new_branch}", sha=gb.commit.sha)
             except Exception:
                 print(f"Branch {new_branch} already exist")
 
             # get the file content
-            file_path=f"deployments/google-online-boutique/base/{deployment_name}.yaml"
             try:
-                contents = self.repo.get_contents(file_path, ref=new_branch)
+                contents = repo.get_contents(file_path, ref=new_branch)
             except Exception:
                 print(f"File not found at path: {file_path}")
             # decode from bytes 
@@ -49,7 +81,10 @@ class GitHubClient(SCMClient):
 
             # apply patch
             yaml_content = yaml.safe_load(decoded_content)
-            success = self._apply_patch(yaml_content, patch)
+            if owner and owner.get("kind") == "helm" and owner.get("values_file"):
+                success = self._apply_values_patch(yaml_content, deployment_name, patch)
+            else:
+                success = self._apply_patch(yaml_content, patch)
             if not success:
                 print("Failed to apply patch, could not find container")
                 return None
@@ -58,16 +93,58 @@ class GitHubClient(SCMClient):
             new_content = yaml.dump(yaml_content, default_flow_style=False, sort_keys=False, width=1000)
 
             # commit the change
-            self.repo.update_file(path=contents.path, message=f"optimise {deployment_name} resource", content=new_content, sha=contents.sha, branch=new_branch)
+            repo.update_file(path=contents.path, message=f"optimise {deployment_name} resource", content=new_content, sha=contents.sha, branch=new_branch)
 
             # open pr
-            pr = self.repo.create_pull(title=f"Optimise {deployment_name} resource", body=f"##Reasoning\n{reasoning}\n\n -Changes based on metrics analysis (Qwen 2.5:7b) ", head=new_branch, base=base_branch)
+            pr = repo.create_pull(title=f"Optimise {deployment_name} resource", body=f"##Reasoning\n{reasoning}\n\n -Changes based on metrics analysis (Qwen 2.5:7b) ", head=new_branch, base=base_branch)
+            return pr.html_url
+
+        except Exception as e:
+            print(f"SCM failed: {e}")
+            return None
+
+
+    # live manifests of Terraform workloads are never touched, terraform apply picks the override up after merge
+    def create_tfvars_pr(self, job_id: str, deployment_name: str, output: Dict[str, str], reasoning: str) -> Optional[str]:
+        base_branch = "main"
+        new_branch = f"optimise-{deployment_name}--{job_id[:8]}"
+        file_path = output["file"]
+
+        try:
+            try:
+                gb = self.repo.get_branch(base_branch)
+                self.repo.create_git_ref(ref=f"refs/heads/{new_branch}", sha=gb.commit.sha)
+            except Exception:
+                print(f"Branch {new_branch} already exist")
+
+            message = f"optimise {deployment_name} resource (tfvars)"
+            try:
+                contents = self.repo.get_contents(file_path, ref=new_branch)
+                new_content = self._apply_tfvars(contents.decoded_content.decode("utf-8"), output)
+                self.repo.update_file(path=contents.path, message=message, content=new_content, sha=contents.sha, branch=new_branch)
+            except Exception:
+                # first override for the namespace
+                self.repo.create_file(path=file_path, message=message, content=output["content"], branch=new_branch)
+
+            pr = self.repo.create_pull(title=f"Optimise {deployment_name} resource", body=f"##Reasoning\n{reasoning}\n\nTerraform override in `{file_path}`, apply with `terraform plan` after merge", head=new_branch, base=base_branch)
             return pr.html_url
 
         except Exception as e:
             print(f"SCM failed: {e}")
             return None
 
+    # replace the variable's block, with the comment above it, or append it when the file doesn't set it yet
+    def _apply_tfvars(self, existing: str, output: Dict[str, str]) -> str:
+        lines = existing.splitlines(keepends=True)
+        start = next((i for i, l in enumerate(lines) if l.split("=")[0].strip() == output["variable"]), None)
+        if start is None:
+            sep = "" if not existing or existing.endswith("\n") else "\n"
+            return existing + sep + output["content"]
+        if start > 0 and lines[start - 1].startswith("#"):
+            start -= 1
+        # the rendered block closes with the first unindented brace
+        end = next((i for i in range(start + 1, len(lines)) if lines[i].rstrip() == "}"), len(lines) - 1)
+        return "".join(lines[:start]) + output["content"] + "".join(lines[end + 1:])
 
     # if pr is accepted, apply the patch
     def _apply_patch(self, manifests: Dict, patch: Dict):
@@ -88,4 +165,14 @@ class GitHubClient(SCMClient):
 
         except KeyError:
             print("Coudld not find container spec in manifest' to apply patch")
-            return False
\ No newline at end of file
+            return False
+
+    # charts conventionally take resources under a key named after the component
+    def _apply_values_patch(self, values: Dict, deployment_name: str, patch: Dict):
+        if 'resources' not in patch:
+            return False
+        section = values.setdefault(deployment_name, {})
+        if not isinstance(section, dict):
+            return False
+        section['resources'] = patch['resources']
+        return True
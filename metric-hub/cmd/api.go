@@ -1,85 +1,796 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/analytics"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/chaos"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/config"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/gate"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/guardrail"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/history"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/ingest"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/kube"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/leader"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/producer"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/savings"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/scoring"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/tenant"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/wal"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 )
 
 type APIServer struct {
+	Config     *config.Config
 	Validator  internal.ValidatorInterface
 	Aggregator internal.AggregatorInterface
+	Guardrail  *guardrail.Guardrail
+	Producers  *producer.Tracker
+	History    *history.Store
+	Savings    *savings.Tracker
+	// per-tenant quotas, nil unless MULTI_TENANT is set
+	Tenants  *tenant.Limiter
+	Notifier notify.Notifier
+	// injected faults, nil unless fault injection is enabled
+	Faults *chaos.Injector
+	// shared redis client for admin operations
+	Client *redis.Client
+	// local log replayed after redis loses its state, nil unless a path is configured
+	WAL *wal.Log
+	// leader lease fencing job publishes, nil unless leader election is on
+	Lease *leader.Lease
+	// input adapters producing cost payloads without a push
+	Ingest *ingest.Registry
+	// series pushed by Datadog agents, polled through Ingest
+	DatadogIntake *internal.DatadogIntake
 }
 
 // cosntructor
-func NewAPIServer() *APIServer {
-	redisAddr := os.Getenv("REDIS_SERVICE_ADDR")
-	redisPass := os.Getenv("REDIS_SERVICE_PASS")
-	return &APIServer{
+func NewAPIServer(cfg *config.Config) *APIServer {
+	aggregator := internal.NewAggregator(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.ReplicaAddr)
+	aggregator.ClusterID = cfg.Server.ClusterID
+	aggregator.ClusterLabels = cfg.Server.ClusterLabels
+	if ttl := cfg.Redis.CacheTTL.Std(); ttl > 0 {
+		aggregator.Cache.TTL = ttl
+	} else {
+		aggregator.Cache = nil
+	}
+	aggregator.EvaluationTimeout = cfg.Server.EvaluationTimeout.Std()
+	aggregator.EvaluationInterval = cfg.Server.EvaluationInterval.Std()
+	aggregator.KubeEventTimeout = cfg.Server.KubeEventTimeout.Std()
+	aggregator.ShardSize = cfg.Server.ShardSize
+	aggregator.ShardWorkers = cfg.Server.ShardWorkers
+	aggregator.ShardClaims = cfg.Server.ShardClaims
+	aggregator.Quality = cfg.Server.DataQuality
+	if host, err := os.Hostname(); err == nil {
+		aggregator.ReplicaID = host
+	}
+	if cfg.Scoring.URL != "" {
+		aggregator.Scorer = scoring.NewHTTPScorer(cfg.Scoring.URL, cfg.Scoring.Timeout.Std(), cfg.Scoring.Threshold)
+	}
+	if cfg.Queue.Gate.URL != "" {
+		aggregator.Gate = gate.NewOPAGate(cfg.Queue.Gate.URL, cfg.Queue.Gate.Timeout.Std())
+		aggregator.GateFailOpen = cfg.Queue.Gate.FailOpen
+	}
+	aggregator.Provisioner = cfg.Queue.NodeProvisioner
+	aggregator.Queue = &queue.RedisQueue{Client: aggregator.Client, Routing: cfg.Queue.Routing}
+	aggregator.QueueRoutes = cfg.Queue.Routes
+	notifier := newNotifier(cfg.Notifications)
+	aggregator.Notifier = notifier
+	aggregator.Channels = notificationChannels(cfg.Notifications)
+	aggregator.AlertReasons = cfg.Server.AlertReasons
+	if cfg.Server.KubeEvents {
+		if client, err := kube.InClusterClient(); err != nil {
+			fmt.Printf("Kubernetes events disabled: %v\n", err)
+		} else {
+			aggregator.KubeEvents = kube.NewEventRecorder(client)
+		}
+	}
+	if cfg.Server.MultiTenant {
+		aggregator.Tenants = tenant.NewLimiter(aggregator.Client)
+	}
+	var writeAhead *wal.Log
+	if cfg.Redis.WAL.Path != "" {
+		log, err := wal.Open(cfg.Redis.WAL.Path, int64(cfg.Redis.WAL.MaxSizeMB)<<20)
+		if err != nil {
+			fmt.Printf("Write-ahead log disabled: %v\n", err)
+		} else {
+			writeAhead = log
+			aggregator.WAL = log
+		}
+	}
+	var lease *leader.Lease
+	if cfg.Server.LeaderElection {
+		lease = leader.NewLease(aggregator.Client, instanceIdentity(aggregator.ReplicaID), cfg.Server.LeaseDuration.Std(), notifier)
+		lease.Routing = cfg.Queue.Routing
+		aggregator.Queue = lease
+	}
+	if extra := queueSinks(cfg.Queue.Sinks); len(extra) > 0 {
+		sinks := []queue.Sink{{Name: "redis", Client: aggregator.Queue, Required: true}}
+		for _, s := range extra {
+			s.Client = queue.NewDedup(aggregator.Client, s.Name, s.Client)
+			if lease != nil {
+				s.Client = lease.Guard(s.Client)
+			}
+			sinks = append(sinks, s)
+		}
+		aggregator.Queue = queue.NewFanout(sinks...)
+	}
+	var faults *chaos.Injector
+	if cfg.Server.FaultInjection {
+		fmt.Println("Fault injection enabled")
+		faults = chaos.NewInjector()
+		aggregator.Client.AddHook(faults)
+		aggregator.Queue = chaos.NewQueue(faults, aggregator.Queue)
+	}
+
+	server := &APIServer{
+		Config:     cfg,
 		Validator:  internal.NewValidator(),
-		Aggregator: internal.NewAggregator(redisAddr, redisPass),
+		Aggregator: aggregator,
+		Guardrail:  guardrail.NewGuardrail(aggregator.Client, notifier),
+		Producers:  producer.NewTracker(aggregator.Client, notifier),
+		History:    aggregator.History,
+		Savings:    savings.NewTracker(aggregator.Client, notifier),
+		Tenants:    aggregator.Tenants,
+		Notifier:   notifier,
+		Faults:     faults,
+		Client:     aggregator.Client,
+		WAL:        writeAhead,
+		Lease:      lease,
 	}
+	server.DatadogIntake = internal.NewDatadogIntake(aggregator.Client, cfg.Datadog.Mapping)
+	server.Ingest = ingest.NewRegistry(aggregator.Client, server.ingestCostPayload, instanceIdentity(aggregator.ReplicaID))
+	adapters := append(ingestAdapters(cfg), ingestAdapter{server.DatadogIntake, cfg.Datadog.Interval.Std()})
+	for _, a := range adapters {
+		if err := server.Ingest.Register(a.adapter, a.interval); err != nil {
+			fmt.Printf("Input adapter disabled: %v\n", err)
+		}
+	}
+	return server
+}
+
+// replica id with a random suffix, unique even when two pods share a hostname
+func instanceIdentity(replica string) string {
+	if replica == "" {
+		replica = "local"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return replica + "-" + hex.EncodeToString(suffix)
+}
+
+// cluster this hub reports on, as the aggregator names it
+func (s *APIServer) clusterID() string {
+	if s.Config.Server.ClusterID == "" {
+		return internal.DefaultClusterID
+	}
+	return s.Config.Server.ClusterID
 }
 
 // start http server
 func (s *APIServer) Start() error {
+	if s.Lease != nil {
+		go s.Lease.Run(context.Background())
+	}
+	if s.WAL != nil {
+		go s.WAL.Run(context.Background(), s.Client, internal.LatestCostKey, s.Config.Redis.WAL.CheckInterval.Std())
+	}
+	go s.Guardrail.Run(context.Background(), time.Minute)
+	go s.Producers.Run(context.Background(), time.Minute)
+	go s.History.Run(context.Background(), 10*time.Minute)
+	go s.Savings.Run(context.Background(), s.Config.Server.SavingsDigestInterval.Std())
+	go s.startWebhooks()
+	go s.startStatusPage()
+	go s.Aggregator.RunScheduleCheck(context.Background(), 6*time.Hour)
+	s.Ingest.Run(context.Background())
+	for _, sink := range analyticsSinks(s.Config.Analytics) {
+		go analytics.NewStreamer(s.Client, sink, s.Config.Analytics.BatchSize).Run(context.Background(), s.Config.Analytics.Interval.Std())
+	}
+	if s.Config.Server.ShardClaims {
+		go s.Aggregator.RunShardWorker(context.Background(), time.Second)
+	}
+	if s.Config.Server.EvaluationInterval > 0 {
+		go s.Aggregator.RunEvaluations(context.Background())
+	}
+	if d := s.Config.Server.Discovery; d.Enabled {
+		if client, err := kube.InClusterClient(); err != nil {
+			fmt.Printf("Discovery disabled: %v\n", err)
+		} else {
+			go s.Aggregator.RunDiscovery(context.Background(), kube.NewDiscoverer(client, d.Exclude), d.Interval.Std())
+		}
+	}
+	if s.Config.Thresholds != nil {
+		if err := s.Aggregator.ApplyPolicy(context.Background(), s.Config.Thresholds); err != nil {
+			fmt.Printf("Failed to apply configured thresholds %v\n", err)
+		}
+	}
+	if watcher := policyWatcher(s.Config.Server.PolicySource); watcher != nil {
+		go watcher.Run(context.Background(), s.Aggregator.ApplyPolicyDocument)
+	}
+
+	if s.Config.Server.CostMetrics {
+		prometheus.MustRegister(internal.NewCostCollector(s.Aggregator, s.clusterID()))
+	}
+
 	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.Handle("GET /{$}", http.RedirectHandler("/ui/", http.StatusFound))
+	mux.Handle("GET /ui/", uiHandler())
+	mux.HandleFunc("GET /ui/config.json", s.handleUIConfig)
+	if sp := s.Config.Server.StatusPage; sp.Enabled && sp.Port == 0 {
+		s.statusRoutes(mux)
+	}
 	mux.HandleFunc("POST /api/v1/metrics/cost", s.handleCostEngine)
+	mux.HandleFunc("POST /api/v1/metrics/cost/delta", s.handleCostDelta)
+	mux.HandleFunc("POST /api/v1/metrics/cost/backfill", s.handleCostBackfill)
+	mux.HandleFunc("GET /api/v1/metrics/cost/latest", s.handleLatestCost)
 	mux.HandleFunc("POST /api/v1/metrics/forecast", s.handleForecast)
+	mux.HandleFunc("POST /api/v1/metrics/combined", s.handleCombined)
+	mux.HandleFunc("POST /api/v1/alerts/alertmanager", s.handleAlertmanager)
+	mux.HandleFunc("POST /api/v1/intake/datadog/api/v1/series", s.handleDatadogSeries)
+	mux.HandleFunc("POST /api/v1/intake/datadog/api/v2/series", s.handleDatadogSeries)
+	mux.HandleFunc("GET /api/v1/ingest/adapters", s.handleListAdapters)
+	mux.HandleFunc("POST /api/v1/ingest/adapters/{name}/poll", s.handlePollAdapter)
+	mux.HandleFunc("GET /api/v1/metrics/query", s.handleQuery)
+	mux.HandleFunc("GET /api/v1/deployments/{name}/recommendation/patch", s.handleRecommendationPatch)
+	mux.HandleFunc("GET /api/v1/deployments/{name}/explain", s.handleExplain)
+	mux.HandleFunc("GET /api/v1/deployments/{name}/recommendations", s.handleRecommendationHistory)
+	mux.HandleFunc("GET /api/v1/deployments/{name}/archive", s.handleExportDeployment)
+	mux.HandleFunc("POST /api/v1/deployments/{name}/archive", s.handleImportDeployment)
+	mux.HandleFunc("GET /model/allocation", s.handleAllocation)
+	mux.HandleFunc("GET /allocation/compute", s.handleAllocation)
+	mux.HandleFunc("GET /api/v1/reports/efficiency", s.handleEfficiency)
+	mux.HandleFunc("GET /api/v1/reports/quota", s.handleQuota)
+	mux.HandleFunc("GET /api/v1/reports/namespaces", s.handleCompareNamespaces)
+	mux.HandleFunc("GET /api/v1/reports/org", s.handleOrgRollup)
+	mux.HandleFunc("GET /api/v1/reports/clusters", s.handleCompareClusters)
+	mux.HandleFunc("GET /api/v1/reports/inventory", s.handleInventory)
+	mux.HandleFunc("GET /api/v1/reports/focus", s.handleFocusExport)
+	mux.HandleFunc("GET /api/v1/reports/savings", s.handleSavingsReport)
+	mux.HandleFunc("GET /api/v1/reports/savings/event-driven", s.handleEventDrivenSavings)
+	mux.HandleFunc("POST /api/v1/feedback/savings", s.handleSavingsFeedback)
+	mux.HandleFunc("POST /api/v1/feedback/outcome", s.handleOutcome)
+	mux.HandleFunc("GET /api/v1/reviews", s.handleListReviews)
+	mux.HandleFunc("GET /api/v1/tenants/quotas", s.handleListQuotas)
+	mux.HandleFunc("PUT /api/v1/tenants/{tenant}/quota", s.handleSaveQuota)
+	mux.HandleFunc("DELETE /api/v1/tenants/{tenant}/quota", s.handleDeleteQuota)
+	mux.HandleFunc("DELETE /api/v1/reviews/{namespace}/{name}", s.handleResolveReview)
+	mux.HandleFunc("PUT /api/v1/savings/goals/{scope}/{name}", s.handleSaveSavingsGoal)
+	mux.HandleFunc("DELETE /api/v1/savings/goals/{scope}/{name}", s.handleDeleteSavingsGoal)
+	mux.HandleFunc("POST /api/v1/billing/import", s.handleImportBill)
+	mux.HandleFunc("GET /api/v1/billing/correction", s.handleGetBillingCorrection)
+	mux.HandleFunc("DELETE /api/v1/billing/correction", s.handleDeleteBillingCorrection)
+	mux.HandleFunc("GET /api/v1/clusters/{id}/summary", s.handleClusterSummary)
+	mux.HandleFunc("GET /api/v1/clusters/{id}/profile", s.handleClusterProfile)
+	mux.HandleFunc("PUT /api/v1/clusters/{id}/profile", s.handleSaveClusterProfile)
+	mux.HandleFunc("DELETE /api/v1/clusters/{id}/profile", s.handleDeleteClusterProfile)
+	mux.HandleFunc("GET /api/v1/budgets", s.handleListBudgets)
+	mux.HandleFunc("PUT /api/v1/budgets/{id}", s.handleSaveBudget)
+	mux.HandleFunc("DELETE /api/v1/budgets/{id}", s.handleDeleteBudget)
+	mux.HandleFunc("GET /api/v1/budgets/{id}/forecast", s.handleBudgetForecast)
+	mux.HandleFunc("POST /api/v1/producers/heartbeat", s.handleHeartbeat)
+	mux.HandleFunc("GET /api/v1/producers", s.handleListProducers)
+	mux.HandleFunc("GET /api/v1/producers/registry", s.handleListRegistrations)
+	mux.HandleFunc("GET /api/v1/producers/coverage", s.handleCoverage)
+	mux.HandleFunc("GET /api/v1/producers/quality", s.handleQualityReports)
+	mux.HandleFunc("PUT /api/v1/producers/{name}", s.handleRegisterProducer)
+	mux.HandleFunc("DELETE /api/v1/producers/{name}", s.handleUnregisterProducer)
+	mux.HandleFunc("GET /api/v1/admin/snapshot", s.handleSnapshot)
+	mux.HandleFunc("POST /api/v1/admin/restore", s.handleRestore)
+	mux.HandleFunc("POST /api/v1/admin/replay", s.handleReplay)
+	mux.HandleFunc("POST /api/v1/admin/evaluate", s.handleDryRun)
+	mux.HandleFunc("GET /api/v1/admin/events", s.handleEvents)
+	mux.HandleFunc("DELETE /api/v1/data", s.handlePurge)
+	mux.HandleFunc("GET /api/v1/admin/leader", s.handleLeader)
+	mux.HandleFunc("GET /api/v1/admin/evaluations", s.handleListEvaluations)
+	mux.HandleFunc("GET /api/v1/admin/evaluations/{id}", s.handleGetEvaluation)
+	mux.HandleFunc("GET /api/v1/admin/faults", s.handleGetFaults)
+	mux.HandleFunc("PUT /api/v1/admin/faults", s.handleSetFaults)
+	mux.HandleFunc("DELETE /api/v1/admin/faults", s.handleClearFaults)
+	mux.HandleFunc("GET /api/v1/policy", s.handleGetPolicy)
+	mux.HandleFunc("PUT /api/v1/policy", s.handleSavePolicy)
+	mux.HandleFunc("PUT /api/v1/policy/candidate", s.handleSaveCandidatePolicy)
+	mux.HandleFunc("DELETE /api/v1/policy/candidate", s.handleDeleteCandidatePolicy)
+	mux.HandleFunc("GET /api/v1/policy/candidate/report", s.handleShadowReport)
+	mux.HandleFunc("GET /api/v1/schemas", s.handleListSchemas)
+	mux.HandleFunc("PUT /api/v1/schemas/{name}", s.handleSaveSchema)
+	mux.HandleFunc("DELETE /api/v1/schemas/{name}", s.handleDeleteSchema)
+	mux.HandleFunc("GET /api/v1/rules", s.handleListRules)
+	mux.HandleFunc("PUT /api/v1/rules/{name}", s.handleSaveRule)
+	mux.HandleFunc("DELETE /api/v1/rules/{name}", s.handleDeleteRule)
+	mux.HandleFunc("GET /api/v1/scripts", s.handleListScripts)
+	mux.HandleFunc("PUT /api/v1/scripts/{name}", s.handleSaveScript)
+	mux.HandleFunc("DELETE /api/v1/scripts/{name}", s.handleDeleteScript)
+	mux.HandleFunc("GET /api/v1/flags", s.handleListFlags)
+	mux.HandleFunc("PUT /api/v1/flags/{namespace}", s.handleSaveFlags)
+	mux.HandleFunc("DELETE /api/v1/flags/{namespace}", s.handleDeleteFlags)
+	mux.HandleFunc("GET /api/v1/defaults", s.handleListDefaults)
+	mux.HandleFunc("PUT /api/v1/defaults/{namespace}", s.handleSaveDefaults)
+	mux.HandleFunc("DELETE /api/v1/defaults/{namespace}", s.handleDeleteDefaults)
+	mux.HandleFunc("GET /api/v1/owners", s.handleListOwners)
+	mux.HandleFunc("PUT /api/v1/owners/{namespace}", s.handleSaveOwner)
+	mux.HandleFunc("PUT /api/v1/owners/{namespace}/{name}", s.handleSaveOwner)
+	mux.HandleFunc("DELETE /api/v1/owners/{namespace}", s.handleDeleteOwner)
+	mux.HandleFunc("DELETE /api/v1/owners/{namespace}/{name}", s.handleDeleteOwner)
+	mux.HandleFunc("GET /api/v1/org/teams", s.handleListOrgTeams)
+	mux.HandleFunc("PUT /api/v1/org/teams/{team}", s.handleSaveOrgTeam)
+	mux.HandleFunc("DELETE /api/v1/org/teams/{team}", s.handleDeleteOrgTeam)
+	mux.HandleFunc("GET /api/v1/routing/rules", s.handleListRoutingRules)
+	mux.HandleFunc("PUT /api/v1/routing/rules/{name}", s.handleSaveRoutingRule)
+	mux.HandleFunc("DELETE /api/v1/routing/rules/{name}", s.handleDeleteRoutingRule)
 
-	return http.ListenAndServe(":8008", mux)
+	return http.ListenAndServe(fmt.Sprintf(":%d", s.Config.Server.Port), mux)
 }
 
 // handler function for POST /metrics/cost request
 func (s *APIServer) handleCostEngine(w http.ResponseWriter, r *http.Request) {
 	var payload internal.CostPayload
 
-	dec := json.NewDecoder(r.Body)
-	if err := dec.Decode(&payload); err != nil {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	if json.Unmarshal(body, &payload) != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
+	// rewritten before validation, a renamed namespace is validated as the hub will store it
+	source := producerName(payload.Source, producer.CostEngine)
+	if err := s.Config.Pipeline.Cost(source, &payload); err != nil {
+		http.Error(w, fmt.Sprintf("Payload rejected by pipeline: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	if err := s.Validator.Validate(&payload); err != nil {
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
 
-	if err := s.Aggregator.SaveCostPayload(&payload); err != nil {
+	if err := s.Aggregator.ValidateCustomMetrics(r.Context(), &payload); errors.Is(err, internal.ErrInvalidCustomMetrics) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to validate custom metrics", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.Producers.ValidatePayload(r.Context(), source, producer.KindCost, payload.Namespace); err != nil {
+		http.Error(w, fmt.Sprintf("Payload does not match producer registration: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	hash, duplicate := s.claimPayload(w, r, "cost", &payload)
+	if duplicate {
+		return
+	}
+	// counted once claimed, so retries of a payload already processed don't use the tenant's quota
+	if s.overQuota(w, r, payload.Namespace, int64(len(body))) {
+		s.Aggregator.ReleasePayload(r.Context(), "cost", hash)
+		return
+	}
+
+	if err := s.Aggregator.SaveCostPayload(r.Context(), &payload); err != nil {
+		s.Aggregator.ReleasePayload(r.Context(), "cost", hash)
 		http.Error(w, "Failed to save", http.StatusInternalServerError)
 		return
 	}
 
+	s.recordPush(r, source)
+
 	fmt.Println("Received post request for api/v1/metrics/cost")
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte("Cost payload accepted"))
 
 }
 
+// handler function for POST /metrics/combined
+// a cost payload whose deployments also carry predicted_peak_24h, evaluated as a cost and a forecast push in one pass
+func (s *APIServer) handleCombined(w http.ResponseWriter, r *http.Request) {
+	var payload internal.CostPayload
+
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	source := producerName(payload.Source, producer.CostEngine)
+	if err := s.Config.Pipeline.Cost(source, &payload); err != nil {
+		http.Error(w, fmt.Sprintf("Payload rejected by pipeline: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Validator.Validate(&payload); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Aggregator.ValidateCustomMetrics(r.Context(), &payload); errors.Is(err, internal.ErrInvalidCustomMetrics) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to validate custom metrics", http.StatusInternalServerError)
+		return
+	}
+
+	// a combined producer registers as a cost producer
+	if err := s.Producers.ValidatePayload(r.Context(), source, producer.KindCost, payload.Namespace); err != nil {
+		http.Error(w, fmt.Sprintf("Payload does not match producer registration: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	hash, duplicate := s.claimPayload(w, r, "combined", &payload)
+	if duplicate {
+		return
+	}
+	if s.overQuota(w, r, payload.Namespace, int64(len(body))) {
+		s.Aggregator.ReleasePayload(r.Context(), "combined", hash)
+		return
+	}
+
+	if err := s.Aggregator.SaveCombinedPayload(r.Context(), &payload); err != nil {
+		s.Aggregator.ReleasePayload(r.Context(), "combined", hash)
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+
+	s.recordPush(r, source)
+
+	fmt.Println("Received post request for api/v1/metrics/combined")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Combined payload accepted"))
+}
+
+// handler function for POST /alerts/alertmanager
+// the body is an Alertmanager webhook, firing alerts become deployment jobs
+func (s *APIServer) handleAlertmanager(w http.ResponseWriter, r *http.Request) {
+	var webhook internal.AlertmanagerWebhook
+	if !s.decodeBody(w, r, &webhook) {
+		return
+	}
+
+	if err := s.Validator.Validate(&webhook); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	outcomes, err := s.Aggregator.ReceiveAlerts(r.Context(), &webhook)
+	if errors.Is(err, internal.ErrNoCostData) {
+		http.Error(w, "No cost payload stored", http.StatusNotFound)
+		return
+	} else if errors.Is(err, leader.ErrNotLeader) {
+		// Alertmanager retries on 5xx, the retry may reach the leader
+		http.Error(w, "Not the leader", http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to process alerts", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, outcomes)
+}
+
+// handler function for POST /metrics/cost/backfill
+// payloads only go into history, they are never evaluated
+func (s *APIServer) handleCostBackfill(w http.ResponseWriter, r *http.Request) {
+	var backfill internal.CostBackfill
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	if json.Unmarshal(body, &backfill) != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	for i := range backfill.Payloads {
+		p := &backfill.Payloads[i]
+		if err := s.Config.Pipeline.Cost(producerName(p.Source, producer.CostEngine), p); err != nil {
+			http.Error(w, fmt.Sprintf("Payload %d rejected by pipeline: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.Validator.Validate(&backfill); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	checked := map[string]bool{}
+	for i := range backfill.Payloads {
+		p := &backfill.Payloads[i]
+		if !checked[p.Namespace] {
+			checked[p.Namespace] = true
+			if s.overQuota(w, r, p.Namespace, int64(len(body))) {
+				return
+			}
+		}
+		if err := s.Aggregator.ValidateCustomMetrics(r.Context(), p); errors.Is(err, internal.ErrInvalidCustomMetrics) {
+			http.Error(w, fmt.Sprintf("Payload %d: %v", i, err), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			fmt.Printf("Aggregator error %v\n", err)
+			http.Error(w, "Failed to validate custom metrics", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	res, err := s.Aggregator.BackfillCost(r.Context(), &backfill)
+	if errors.Is(err, internal.ErrBackfillFuture) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to backfill", http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("Backfilled %d cost payloads\n", res.Payloads)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handler function for POST /metrics/cost/delta
+// 409 asks the producer to push a full payload and restart its sequence
+func (s *APIServer) handleCostDelta(w http.ResponseWriter, r *http.Request) {
+	var delta internal.CostDelta
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	if json.Unmarshal(body, &delta) != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	source := producerName(delta.Source, producer.CostEngine)
+	if err := s.Config.Pipeline.Delta(source, &delta); err != nil {
+		http.Error(w, fmt.Sprintf("Payload rejected by pipeline: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Validator.Validate(&delta); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if s.overQuota(w, r, delta.Namespace, int64(len(body))) {
+		return
+	}
+
+	changed := &internal.CostPayload{Namespace: delta.Namespace, Deployments: delta.Deployments}
+	if err := s.Aggregator.ValidateCustomMetrics(r.Context(), changed); errors.Is(err, internal.ErrInvalidCustomMetrics) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to validate custom metrics", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.Producers.ValidatePayload(r.Context(), source, producer.KindCost, delta.Namespace); err != nil {
+		http.Error(w, fmt.Sprintf("Payload does not match producer registration: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	err := s.Aggregator.ApplyCostDelta(r.Context(), &delta)
+	if errors.Is(err, internal.ErrDuplicateDelta) {
+		// duplicates are only found by sequence, after the quota check
+		if s.Tenants != nil {
+			s.Tenants.RefundPush(r.Context(), delta.Namespace)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Payload already processed"))
+		return
+	} else if errors.Is(err, internal.ErrSequenceGap) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+
+	s.recordPush(r, source)
+
+	fmt.Println("Received post request for api/v1/metrics/cost/delta")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Cost delta accepted"))
+}
+
+// handler function for GET /metrics/cost/latest?deployment=<name>&fields=<list>
+// deployment may be repeated or comma separated to return only those deployments
+func (s *APIServer) handleLatestCost(w http.ResponseWriter, r *http.Request) {
+	payload, err := s.Aggregator.LatestCost(r.Context())
+	if errors.Is(err, internal.ErrNoCostData) {
+		http.Error(w, "No cost payload stored", http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to read cost payload", http.StatusInternalServerError)
+		return
+	}
+
+	if names := r.URL.Query()["deployment"]; len(names) > 0 {
+		wanted := make(map[string]bool)
+		for _, name := range names {
+			for _, n := range strings.Split(name, ",") {
+				wanted[strings.TrimSpace(n)] = true
+			}
+		}
+		// the payload is shared with other readers, filter a copy
+		filtered := *payload
+		filtered.Deployments = make([]internal.CostDeployment, 0, len(wanted))
+		for _, dep := range payload.Deployments {
+			if wanted[dep.Name] {
+				filtered.Deployments = append(filtered.Deployments, dep)
+			}
+		}
+		payload = &filtered
+	}
+	writeConditionalJSON(w, r, payload)
+}
+
 // handler function for POST /metrics/forecast
 func (s *APIServer) handleForecast(w http.ResponseWriter, r *http.Request) {
 	var payload internal.ForecastPayload
-	dec := json.NewDecoder(r.Body)
-	if err := dec.Decode(&payload); err != nil {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	if json.Unmarshal(body, &payload) != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
+	source := producerName(payload.Source, producer.Forecaster)
+	if err := s.Config.Pipeline.Forecast(source, &payload); err != nil {
+		http.Error(w, fmt.Sprintf("Payload rejected by pipeline: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	if err := s.Validator.Validate(&payload); err != nil {
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
 
-	if err := s.Aggregator.FetchPayload(&payload); err != nil {
+	if err := s.Producers.ValidatePayload(r.Context(), source, producer.KindForecast, payload.Namespace); err != nil {
+		http.Error(w, fmt.Sprintf("Payload does not match producer registration: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	hash, duplicate := s.claimPayload(w, r, "forecast", &payload)
+	if duplicate {
+		return
+	}
+	if s.overQuota(w, r, payload.Namespace, int64(len(body))) {
+		s.Aggregator.ReleasePayload(r.Context(), "forecast", hash)
+		return
+	}
+
+	if err := s.Aggregator.FetchPayload(r.Context(), &payload); err != nil {
+		s.Aggregator.ReleasePayload(r.Context(), "forecast", hash)
 		fmt.Printf("Aggregator error %v\n", err)
 		http.Error(w, "Failed to process forecast", http.StatusBadRequest)
+		return
 	}
 
+	s.recordPush(r, source)
+
 	fmt.Println("Received post request for api/v1/metrics/forecast")
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte("Forecast payload accepted"))
 
 }
+
+// Dedup identical payloads within the dedup window
+// writes 200 and returns duplicate=true when the payload was already processed
+// a redis failure lets the payload through rather than dropping data
+func (s *APIServer) claimPayload(w http.ResponseWriter, r *http.Request, kind string, payload interface{}) (string, bool) {
+	hash, err := internal.PayloadHash(payload)
+	if err != nil {
+		fmt.Printf("Dedup error %v\n", err)
+		return "", false
+	}
+
+	claimed, err := s.Aggregator.ClaimPayload(r.Context(), kind, hash)
+	if err != nil {
+		fmt.Printf("Dedup error %v\n", err)
+		return hash, false
+	}
+	if !claimed {
+		fmt.Printf("Duplicate %s payload %s, already processed\n", kind, hash[:12])
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Payload already processed"))
+		return hash, true
+	}
+	return hash, false
+}
+
+// handler function for GET /reports/efficiency
+func (s *APIServer) handleEfficiency(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.Aggregator.EfficiencyLeaderboard(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to build efficiency report", http.StatusInternalServerError)
+		return
+	}
+
+	writeConditionalJSON(w, r, entries)
+}
+
+// handler function for GET /reports/quota
+func (s *APIServer) handleQuota(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Aggregator.Quota(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to build quota report", http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		http.Error(w, "No resource quota reported", http.StatusNotFound)
+		return
+	}
+
+	writeConditionalJSON(w, r, report)
+}
+
+// encode v as the json response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("Failed to encode response %v\n", err)
+	}
+}
+
+// read a push body, capped at server.max_body_bytes so an oversized body is never held in memory
+// writes 413 or 400 and returns false when the body can't be read
+func (s *APIServer) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if limit := s.Config.Server.MaxBodyBytes; limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(limit))
+	}
+	body, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Request body over %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// read the body as readBody does and decode it into v, 400 when it isn't valid JSON
+func (s *APIServer) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return false
+	}
+	if json.Unmarshal(body, v) != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
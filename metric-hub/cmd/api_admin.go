@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/chaos"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/producer"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/snapshot"
+)
+
+// handler function for GET /admin/snapshot
+// the archive is built in memory first, so a failed export still answers 500
+func (s *APIServer) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := snapshot.Export(r.Context(), s.Client, &buf); err != nil {
+		fmt.Printf("Snapshot error %v\n", err)
+		http.Error(w, "Failed to export snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("metric-hub-%s.json.gz", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if _, err := buf.WriteTo(w); err != nil {
+		fmt.Printf("Snapshot write error %v\n", err)
+		return
+	}
+	fmt.Println("Exported hub snapshot")
+}
+
+// handler function for POST /admin/restore?flush=true
+// only served with server.allow_restore, a restore overwrites hub state and can't be undone
+func (s *APIServer) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if !s.Config.Server.AllowRestore {
+		http.Error(w, "Restore disabled", http.StatusForbidden)
+		return
+	}
+	flush := r.URL.Query().Get("flush") == "true"
+
+	res, err := snapshot.Import(r.Context(), s.Client, r.Body, flush)
+	if errors.Is(err, snapshot.ErrInvalidArchive) {
+		http.Error(w, fmt.Sprintf("Failed to restore snapshot: %v", err), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Restore error %v\n", err)
+		http.Error(w, "Failed to restore snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	s.Aggregator.PurgeCache()
+	fmt.Printf("Restored %d keys from snapshot\n", res.Restored)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handler function for POST /admin/replay
+func (s *APIServer) handleReplay(w http.ResponseWriter, r *http.Request) {
+	var req internal.ReplayRequest
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+
+	if err := s.Validator.Validate(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.Aggregator.Replay(r.Context(), &req)
+	if err != nil {
+		fmt.Printf("Replay error %v\n", err)
+		http.Error(w, "Failed to replay events", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handler function for POST /admin/evaluate
+// the payload goes through the pipeline and validation like a pushed one, but is never saved
+func (s *APIServer) handleDryRun(w http.ResponseWriter, r *http.Request) {
+	var req internal.DryRunRequest
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if req.Payload != nil {
+		if err := s.Config.Pipeline.Cost(producerName(req.Payload.Source, producer.CostEngine), req.Payload); err != nil {
+			http.Error(w, fmt.Sprintf("Payload rejected by pipeline: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := s.Validator.Validate(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.Aggregator.DryRun(r.Context(), &req)
+	if errors.Is(err, internal.ErrInvalidRule) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Dry run error %v\n", err)
+		http.Error(w, "Failed to evaluate payload", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handler function for GET /admin/events?type=job_denied&from=<RFC3339>&to=<RFC3339>&limit=100
+// returns the newest matching events, oldest first
+func (s *APIServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var from, to time.Time
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := s.Aggregator.ReadEvents(r.Context(), from, to)
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to read events", http.StatusInternalServerError)
+		return
+	}
+
+	if eventType := q.Get("type"); eventType != "" {
+		filtered := events[:0]
+		for _, ev := range events {
+			if ev.Type == eventType {
+				filtered = append(filtered, ev)
+			}
+		}
+		events = filtered
+	}
+	if len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// handler function for DELETE /data?namespace=shop&before=<RFC3339>&dry_run=true
+func (s *APIServer) handlePurge(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := internal.PurgeFilter{Namespace: q.Get("namespace")}
+	if v := q.Get("before"); v != "" {
+		before, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		f.Before = before.UTC()
+	}
+	dryRun := q.Get("dry_run") == "true"
+
+	res, err := s.Aggregator.Purge(r.Context(), f, dryRun)
+	if errors.Is(err, internal.ErrEmptyPurgeFilter) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Purge error %v\n", err)
+		http.Error(w, "Failed to purge data", http.StatusInternalServerError)
+		return
+	}
+
+	if !dryRun {
+		fmt.Printf("Purged %d history entries, %d jobs and %d events\n", res.History, res.Jobs, res.Events)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handler function for GET /admin/leader
+func (s *APIServer) handleLeader(w http.ResponseWriter, r *http.Request) {
+	if s.Lease == nil {
+		http.Error(w, "Leader election disabled", http.StatusNotFound)
+		return
+	}
+	status, err := s.Lease.Status(r.Context())
+	if err != nil {
+		fmt.Printf("Leader error %v\n", err)
+		http.Error(w, "Failed to read lease", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handler function for GET /admin/faults
+func (s *APIServer) handleGetFaults(w http.ResponseWriter, r *http.Request) {
+	if s.Faults == nil {
+		http.Error(w, "Fault injection disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Faults.Get())
+}
+
+// handler function for PUT /admin/faults
+// the body replaces the active faults on this replica only
+func (s *APIServer) handleSetFaults(w http.ResponseWriter, r *http.Request) {
+	if s.Faults == nil {
+		http.Error(w, "Fault injection disabled", http.StatusNotFound)
+		return
+	}
+
+	var faults chaos.Faults
+	if !s.decodeBody(w, r, &faults) {
+		return
+	}
+	if err := s.Validator.Validate(&faults); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.Faults.Set(faults))
+}
+
+// handler function for DELETE /admin/faults
+func (s *APIServer) handleClearFaults(w http.ResponseWriter, r *http.Request) {
+	if s.Faults == nil {
+		http.Error(w, "Fault injection disabled", http.StatusNotFound)
+		return
+	}
+	s.Faults.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+// Kubecost and OpenCost wrap allocation responses and errors in the same envelope
+type allocationResponse struct {
+	Code    int                               `json:"code"`
+	Status  string                            `json:"status"`
+	Data    []map[string]*internal.Allocation `json:"data,omitempty"`
+	Message string                            `json:"message,omitempty"`
+}
+
+func writeAllocationError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(allocationResponse{Code: code, Status: "error", Message: message})
+}
+
+// handler function for GET /model/allocation and GET /allocation/compute
+// ?window=7d&aggregate=namespace&step=1d&accumulate=false, read-only facade over the decision log
+func (s *APIServer) handleAllocation(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	window := params.Get("window")
+	if window == "" {
+		writeAllocationError(w, http.StatusBadRequest, "window is required")
+		return
+	}
+	var q internal.AllocationQuery
+	var err error
+	if q.Window, err = internal.ParseAllocationWindow(window, time.Now()); err != nil {
+		writeAllocationError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if v := params.Get("step"); v != "" {
+		if q.Step, err = internal.ParseWindowDuration(v); err != nil {
+			writeAllocationError(w, http.StatusBadRequest, fmt.Sprintf("invalid step: %v", err))
+			return
+		}
+	}
+	if v := params.Get("accumulate"); v != "" {
+		if q.Accumulate, err = strconv.ParseBool(v); err != nil {
+			writeAllocationError(w, http.StatusBadRequest, "accumulate must be true or false")
+			return
+		}
+	}
+	q.Aggregate = params.Get("aggregate")
+
+	sets, err := s.Aggregator.Allocation(r.Context(), q)
+	if err != nil {
+		if errors.Is(err, internal.ErrInvalidWindow) || errors.Is(err, internal.ErrUnsupportedAggregate) {
+			writeAllocationError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		fmt.Printf("Aggregator error %v\n", err)
+		writeAllocationError(w, http.StatusInternalServerError, "failed to compute allocation")
+		return
+	}
+	writeConditionalJSON(w, r, allocationResponse{Code: http.StatusOK, Status: "success", Data: sets})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+// handler function for GET /budgets
+func (s *APIServer) handleListBudgets(w http.ResponseWriter, r *http.Request) {
+	budgets, err := s.Aggregator.ListBudgets(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to list budgets", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, budgets)
+}
+
+// handler function for PUT /budgets/{id}
+// body is the budget, e.g. {"monthly_limit": 5000}
+func (s *APIServer) handleSaveBudget(w http.ResponseWriter, r *http.Request) {
+	var b internal.Budget
+	if !s.decodeBody(w, r, &b) {
+		return
+	}
+	b.ID = r.PathValue("id")
+
+	if err := s.Validator.Validate(&b); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Aggregator.SaveBudget(r.Context(), &b); err != nil {
+		http.Error(w, "Failed to save budget", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Budget updated"))
+}
+
+// handler function for DELETE /budgets/{id}
+func (s *APIServer) handleDeleteBudget(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteBudget(r.Context(), r.PathValue("id")); err != nil {
+		http.Error(w, "Failed to delete budget", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /budgets/{id}/forecast
+func (s *APIServer) handleBudgetForecast(w http.ResponseWriter, r *http.Request) {
+	forecast, err := s.Aggregator.BudgetForecast(r.Context(), r.PathValue("id"))
+	if errors.Is(err, internal.ErrUnknownBudget) || errors.Is(err, internal.ErrNoCostData) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to forecast budget", http.StatusInternalServerError)
+		return
+	}
+	writeConditionalJSON(w, r, forecast)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+// handler function for GET /clusters/{id}/profile?window=168h&to=<RFC3339>
+// the window only applies to this hub's own cluster, stored profiles keep theirs
+func (s *APIServer) handleClusterProfile(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := reportWindow(r.URL.Query())
+	if !ok {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := s.Aggregator.ClusterProfile(r.Context(), r.PathValue("id"), from, to)
+	if errors.Is(err, internal.ErrUnknownCluster) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to build cluster profile", http.StatusInternalServerError)
+		return
+	}
+	writeConditionalJSON(w, r, profile)
+}
+
+// handler function for PUT /clusters/{id}/profile
+// body is the profile another hub served on GET /clusters/{id}/profile
+func (s *APIServer) handleSaveClusterProfile(w http.ResponseWriter, r *http.Request) {
+	var p internal.ClusterProfile
+	if !s.decodeBody(w, r, &p) {
+		return
+	}
+	p.Cluster = r.PathValue("id")
+
+	if err := s.Validator.Validate(&p); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	err := s.Aggregator.SaveClusterProfile(r.Context(), &p)
+	if errors.Is(err, internal.ErrOwnCluster) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to save cluster profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Cluster profile updated"))
+}
+
+// handler function for DELETE /clusters/{id}/profile
+func (s *APIServer) handleDeleteClusterProfile(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteClusterProfile(r.Context(), r.PathValue("id")); err != nil {
+		http.Error(w, "Failed to delete cluster profile", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /reports/clusters?window=168h&to=<RFC3339>&group_by=provider
+// group_by is provider, region or environment, clusters are only listed without it
+func (s *APIServer) handleCompareClusters(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to, ok := reportWindow(q)
+	if !ok {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.Aggregator.CompareClusters(r.Context(), from, to, q.Get("group_by"))
+	if errors.Is(err, internal.ErrInvalidGroup) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to compare clusters", http.StatusInternalServerError)
+		return
+	}
+	writeConditionalJSON(w, r, report)
+}
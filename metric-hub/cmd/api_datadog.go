@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/datadog"
+)
+
+// handler function for POST /intake/datadog/api/v1/series and /api/v2/series
+// the path is a Datadog agent's dd_url plus the series endpoint, the agent's API key is not checked
+// every decodable batch is accepted, an agent would retry a rejected one forever
+// the series are kept and the payload is built from all agents' series every datadog interval
+func (s *APIServer) handleDatadogSeries(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	submission, err := datadog.DecodeSubmission(bytes.NewReader(body), r.Header.Get("Content-Encoding"), int64(s.Config.Server.MaxBodyBytes))
+	if errors.Is(err, datadog.ErrTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.overQuota(w, r, s.DatadogIntake.Mapping.Namespace, int64(len(body))) {
+		return
+	}
+
+	if err := s.DatadogIntake.Record(r.Context(), submission.Series); err != nil {
+		fmt.Printf("Datadog intake error %v\n", err)
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Println("Received post request for api/v1/intake/datadog")
+	writeJSON(w, http.StatusAccepted, map[string][]string{"errors": {}})
+}
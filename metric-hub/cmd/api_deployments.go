@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+// handler function for GET /deployments/{name}/recommendation/patch?namespace=<ns>&format=json|strategic
+// json (the default) is an RFC 6902 patch for the container at ?index= (default 0),
+// strategic is a strategic merge patch for the container named ?container= (default the deployment name)
+// namespace defaults to "default"
+func (s *APIServer) handleRecommendationPatch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := r.PathValue("name")
+	ns := q.Get("namespace")
+	if ns == "" {
+		ns = "default"
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "strategic" {
+		http.Error(w, fmt.Sprintf("Unknown format %q, expected json or strategic", format), http.StatusBadRequest)
+		return
+	}
+	index := 0
+	if v := q.Get("index"); v != "" {
+		var err error
+		if index, err = strconv.Atoi(v); err != nil || index < 0 {
+			http.Error(w, "index must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rec, err := s.Aggregator.Recommendation(r.Context(), ns, name)
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to build recommendation", http.StatusInternalServerError)
+		return
+	}
+	if rec == nil {
+		http.Error(w, "No recommendation for deployment", http.StatusNotFound)
+		return
+	}
+
+	contentType := "application/json-patch+json"
+	var patch interface{} = rec.JSONPatch(index)
+	if format == "strategic" {
+		container := q.Get("container")
+		if container == "" {
+			container = name
+		}
+		contentType = "application/strategic-merge-patch+json"
+		patch = rec.StrategicMergePatch(container)
+	}
+	body, err := json.Marshal(patch)
+	if err != nil {
+		fmt.Printf("Failed to encode response %v\n", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	writeConditional(w, r, contentType, append(body, '\n'))
+}
+
+// handler function for GET /deployments/{name}/explain?namespace=<ns>
+// namespace defaults to "default"
+func (s *APIServer) handleExplain(w http.ResponseWriter, r *http.Request) {
+	ns := r.URL.Query().Get("namespace")
+	if ns == "" {
+		ns = "default"
+	}
+	explanation, err := s.Aggregator.Explain(r.Context(), ns, r.PathValue("name"))
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to explain evaluation", http.StatusInternalServerError)
+		return
+	}
+	if explanation == nil {
+		http.Error(w, "No data for deployment", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, explanation)
+}
+
+// handler function for GET /deployments/{name}/recommendations?namespace=<ns>
+// namespace defaults to "default"
+func (s *APIServer) handleRecommendationHistory(w http.ResponseWriter, r *http.Request) {
+	ns := r.URL.Query().Get("namespace")
+	if ns == "" {
+		ns = "default"
+	}
+	records, err := s.Aggregator.RecommendationHistory(r.Context(), ns, r.PathValue("name"))
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to get recommendations", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// handler function for GET /deployments/{name}/archive?namespace=<ns>
+// namespace defaults to "default"
+func (s *APIServer) handleExportDeployment(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	ns := r.URL.Query().Get("namespace")
+	if ns == "" {
+		ns = "default"
+	}
+
+	archive, err := s.Aggregator.ExportDeployment(r.Context(), ns, name)
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to export deployment", http.StatusInternalServerError)
+		return
+	}
+	if archive == nil {
+		http.Error(w, "No history for deployment", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", ns+"-"+name+".json"))
+	writeJSON(w, http.StatusOK, archive)
+}
+
+// handler function for POST /deployments/{name}/archive?namespace=<ns>
+// the body is an archive from GET, imported as the history of namespace/name
+func (s *APIServer) handleImportDeployment(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	ns := r.URL.Query().Get("namespace")
+	if ns == "" {
+		ns = "default"
+	}
+
+	var archive internal.DeploymentArchive
+	if !s.decodeBody(w, r, &archive) {
+		return
+	}
+
+	res, err := s.Aggregator.ImportDeployment(r.Context(), &archive, ns, name)
+	if errors.Is(err, internal.ErrArchiveVersion) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to import deployment", http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("Imported %s/%s history into %s/%s\n", archive.Namespace, archive.Name, ns, name)
+	writeJSON(w, http.StatusOK, res)
+}
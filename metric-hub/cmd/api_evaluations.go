@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+// handler function for GET /admin/evaluations
+func (s *APIServer) handleListEvaluations(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.Aggregator.EvaluationRuns(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to list evaluations", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// handler function for GET /admin/evaluations/{id}
+func (s *APIServer) handleGetEvaluation(w http.ResponseWriter, r *http.Request) {
+	run, err := s.Aggregator.EvaluationRun(r.Context(), r.PathValue("id"))
+	if errors.Is(err, internal.ErrUnknownRun) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to read evaluation", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
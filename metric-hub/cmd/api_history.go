@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/history"
+)
+
+// handler function for GET /metrics/query?deployment=<name>&metric=cpu_usage&step=1h&from=<RFC3339>&to=<RFC3339>&agg=avg
+// deployment may be <namespace>/<name>, otherwise namespace defaults to "default"
+// the last 24h at 1h steps are returned when from, to and step are left out
+func (s *APIServer) handleQuery(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	deployment := q.Get("deployment")
+	if deployment == "" {
+		http.Error(w, "deployment is required", http.StatusBadRequest)
+		return
+	}
+	if !strings.Contains(deployment, "/") {
+		ns := q.Get("namespace")
+		if ns == "" {
+			ns = "default"
+		}
+		deployment = history.Deployment(ns, deployment)
+	}
+
+	query := history.Query{
+		Deployment: deployment,
+		Metric:     q.Get("metric"),
+		Step:       time.Hour,
+		To:         time.Now(),
+		Agg:        history.AggAvg,
+	}
+	var err error
+	if v := q.Get("step"); v != "" {
+		if query.Step, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if query.To, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	query.From = query.To.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		if query.From, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("agg"); v != "" {
+		query.Agg = v
+	}
+
+	if err := query.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	series, err := s.History.Query(r.Context(), query)
+	if err != nil {
+		fmt.Printf("History error %v\n", err)
+		http.Error(w, "Failed to query history", http.StatusInternalServerError)
+		return
+	}
+	writeConditionalJSON(w, r, series)
+}
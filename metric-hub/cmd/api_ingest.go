@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/ingest"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/producer"
+)
+
+// sink of every input adapter, a payload is checked and saved like a pushed one
+// a payload already saved through another replica's subscription is skipped
+func (s *APIServer) ingestCostPayload(ctx context.Context, p *internal.CostPayload) error {
+	if err := s.Config.Pipeline.Cost(p.Source, p); err != nil {
+		return fmt.Errorf("rejected by pipeline: %w", err)
+	}
+	if err := s.Validator.Validate(p); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if err := s.Aggregator.ValidateCustomMetrics(ctx, p); err != nil {
+		return err
+	}
+	if err := s.Producers.ValidatePayload(ctx, p.Source, producer.KindCost, p.Namespace); err != nil {
+		return fmt.Errorf("payload does not match producer registration: %w", err)
+	}
+
+	hash, err := internal.PayloadHash(p)
+	if err != nil {
+		return err
+	}
+	claimed, err := s.Aggregator.ClaimPayload(ctx, "cost", hash)
+	if err != nil {
+		fmt.Printf("Dedup error %v\n", err)
+	} else if !claimed {
+		return nil
+	}
+
+	if err := s.Aggregator.SaveCostPayload(ctx, p); err != nil {
+		s.Aggregator.ReleasePayload(ctx, "cost", hash)
+		return err
+	}
+	if err := s.Producers.Seen(ctx, p.Source); err != nil {
+		fmt.Printf("Producer tracker error %v\n", err)
+	}
+	return nil
+}
+
+// handler function for GET /ingest/adapters
+func (s *APIServer) handleListAdapters(w http.ResponseWriter, r *http.Request) {
+	statuses, err := s.Ingest.Statuses(r.Context())
+	if err != nil {
+		fmt.Printf("Ingest error %v\n", err)
+		http.Error(w, "Failed to get adapter status", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// handler function for POST /ingest/adapters/{name}/poll
+// polls outside the adapter's schedule, e.g. right after fixing its credentials
+func (s *APIServer) handlePollAdapter(w http.ResponseWriter, r *http.Request) {
+	err := s.Ingest.Poll(r.Context(), r.PathValue("name"))
+	if errors.Is(err, ingest.ErrUnknownAdapter) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Poll failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
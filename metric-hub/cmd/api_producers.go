@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/producer"
+)
+
+// handler function for POST /producers/heartbeat
+func (s *APIServer) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	var hb producer.Heartbeat
+	if !s.decodeBody(w, r, &hb) {
+		return
+	}
+
+	if err := s.Validator.Validate(&hb); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Producers.Seen(r.Context(), hb.Producer); err != nil {
+		fmt.Printf("Producer tracker error %v\n", err)
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /producers
+func (s *APIServer) handleListProducers(w http.ResponseWriter, r *http.Request) {
+	statuses, err := s.Producers.Statuses(r.Context())
+	if err != nil {
+		fmt.Printf("Producer tracker error %v\n", err)
+		http.Error(w, "Failed to get producer status", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// a successful payload push counts as a heartbeat
+func (s *APIServer) recordPush(r *http.Request, name string) {
+	if err := s.Producers.Seen(r.Context(), name); err != nil {
+		fmt.Printf("Producer tracker error %v\n", err)
+	}
+}
+
+// handler function for PUT /producers/{name}
+func (s *APIServer) handleRegisterProducer(w http.ResponseWriter, r *http.Request) {
+	var reg producer.Registration
+	if !s.decodeBody(w, r, &reg) {
+		return
+	}
+	reg.Name = r.PathValue("name")
+
+	if err := s.Validator.Validate(&reg); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Producers.Register(r.Context(), &reg); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid registration: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Producer registered"))
+}
+
+// handler function for DELETE /producers/{name}
+func (s *APIServer) handleUnregisterProducer(w http.ResponseWriter, r *http.Request) {
+	if err := s.Producers.Unregister(r.Context(), r.PathValue("name")); err != nil {
+		http.Error(w, "Failed to delete registration", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /producers/registry
+func (s *APIServer) handleListRegistrations(w http.ResponseWriter, r *http.Request) {
+	regs, err := s.Producers.Registrations(r.Context())
+	if err != nil {
+		fmt.Printf("Producer tracker error %v\n", err)
+		http.Error(w, "Failed to get producer registry", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, regs)
+}
+
+// handler function for GET /producers/coverage
+func (s *APIServer) handleCoverage(w http.ResponseWriter, r *http.Request) {
+	cov, err := s.Producers.Coverage(r.Context())
+	if err != nil {
+		fmt.Printf("Producer tracker error %v\n", err)
+		http.Error(w, "Failed to compute coverage", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, cov)
+}
+
+// handler function for GET /producers/quality
+func (s *APIServer) handleQualityReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := s.Aggregator.QualityReports(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to get quality reports", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// payload source, or the default producer for the endpoint
+func producerName(source string, fallback string) string {
+	if source != "" {
+		return source
+	}
+	return fallback
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+// handler function for GET /clusters/{id}/summary
+func (s *APIServer) handleClusterSummary(w http.ResponseWriter, r *http.Request) {
+	summary, err := s.Aggregator.ClusterSummary(r.Context(), r.PathValue("id"))
+	if errors.Is(err, internal.ErrUnknownCluster) || errors.Is(err, internal.ErrNoCostData) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to build cluster summary", http.StatusInternalServerError)
+		return
+	}
+	writeConditionalJSON(w, r, summary)
+}
+
+// handler function for GET /reports/inventory
+func (s *APIServer) handleInventory(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Aggregator.Inventory(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to read inventory", http.StatusInternalServerError)
+		return
+	}
+	writeConditionalJSON(w, r, report)
+}
+
+// window=168h&to=<RFC3339>, from may replace window, the last 7 days by default
+func reportWindow(q url.Values) (from time.Time, to time.Time, ok bool) {
+	to = time.Now()
+	window := 7 * 24 * time.Hour
+	var err error
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, false
+		}
+	}
+	if v := q.Get("window"); v != "" {
+		if window, err = time.ParseDuration(v); err != nil || window <= 0 {
+			return from, to, false
+		}
+	}
+	from = to.Add(-window)
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil || !from.Before(to) {
+			return from, to, false
+		}
+	}
+	return from, to, true
+}
+
+// handler function for GET /reports/namespaces?window=168h&to=<RFC3339>&format=csv
+// from may replace window, the last 7 days are compared by default
+func (s *APIServer) handleCompareNamespaces(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to, ok := reportWindow(q)
+	if !ok {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	reports, err := s.Aggregator.CompareNamespaces(r.Context(), from, to)
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to build namespace report", http.StatusInternalServerError)
+		return
+	}
+
+	if q.Get("format") != "csv" {
+		writeConditionalJSON(w, r, reports)
+		return
+	}
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(internal.NamespaceReportHeader)
+	for _, report := range reports {
+		cw.Write(report.Record())
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		fmt.Printf("Failed to write csv %v\n", err)
+		http.Error(w, "Failed to build namespace report", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="namespaces.csv"`)
+	writeConditional(w, r, "text/csv", buf.Bytes())
+}
+
+// handler function for GET /reports/org?window=168h&to=<RFC3339>
+// from may replace window, the last 7 days are rolled up by default
+func (s *APIServer) handleOrgRollup(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := reportWindow(r.URL.Query())
+	if !ok {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	realised, err := s.Savings.DeploymentSavings(r.Context())
+	if err != nil {
+		fmt.Printf("Savings tracker error %v\n", err)
+		http.Error(w, "Failed to build org report", http.StatusInternalServerError)
+		return
+	}
+	report, err := s.Aggregator.OrgRollup(r.Context(), from, to, realised)
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to build org report", http.StatusInternalServerError)
+		return
+	}
+	writeConditionalJSON(w, r, report)
+}
+
+// handler function for GET /reports/focus?window=month&format=csv
+// window takes the allocation API's windows, hourly charges of the current month by default
+func (s *APIServer) handleFocusExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if format := q.Get("format"); format != "" && format != "csv" {
+		http.Error(w, fmt.Sprintf("Unsupported format %q, only csv is available", format), http.StatusBadRequest)
+		return
+	}
+	window := q.Get("window")
+	if window == "" {
+		window = "month"
+	}
+	win, err := internal.ParseAllocationWindow(window, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := s.Aggregator.FocusExport(r.Context(), win, s.Config.Server.Currency)
+	if errors.Is(err, internal.ErrInvalidWindow) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to build FOCUS export", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(internal.FocusHeader)
+	for _, row := range rows {
+		cw.Write(row.Record())
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		fmt.Printf("Failed to write csv %v\n", err)
+		http.Error(w, "Failed to build FOCUS export", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="focus.csv"`)
+	writeConditional(w, r, "text/csv", buf.Bytes())
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+// scripts larger than this are rejected
+const maxScriptSize = 64 << 10
+
+// handler function for GET /schemas
+func (s *APIServer) handleListSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas, err := s.Aggregator.ListSchemas(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to list schemas", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, schemas)
+}
+
+// handler function for PUT /schemas/{name}
+func (s *APIServer) handleSaveSchema(w http.ResponseWriter, r *http.Request) {
+	var schema internal.JSONSchema
+	if !s.decodeBody(w, r, &schema) {
+		return
+	}
+
+	if err := s.Aggregator.SaveSchema(r.Context(), r.PathValue("name"), &schema); errors.Is(err, internal.ErrInvalidSchema) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to save schema", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Schema registered"))
+}
+
+// handler function for DELETE /schemas/{name}
+func (s *APIServer) handleDeleteSchema(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteSchema(r.Context(), r.PathValue("name")); err != nil {
+		http.Error(w, "Failed to delete schema", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /rules
+func (s *APIServer) handleListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.Aggregator.ListRules(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to list rules", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// handler function for PUT /rules/{name}
+func (s *APIServer) handleSaveRule(w http.ResponseWriter, r *http.Request) {
+	var rule internal.CustomRule
+	if !s.decodeBody(w, r, &rule) {
+		return
+	}
+	rule.Name = r.PathValue("name")
+
+	if err := s.Validator.Validate(&rule); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Aggregator.SaveRule(r.Context(), &rule); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid rule: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Rule registered"))
+}
+
+// handler function for DELETE /rules/{name}
+func (s *APIServer) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteRule(r.Context(), r.PathValue("name")); err != nil {
+		http.Error(w, "Failed to delete rule", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /scripts
+func (s *APIServer) handleListScripts(w http.ResponseWriter, r *http.Request) {
+	scripts, err := s.Aggregator.ListScripts(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to list scripts", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, scripts)
+}
+
+// handler function for PUT /scripts/{name}
+// body is the raw Starlark source
+func (s *APIServer) handleSaveScript(w http.ResponseWriter, r *http.Request) {
+	src, err := io.ReadAll(io.LimitReader(r.Body, maxScriptSize))
+	if err != nil || len(src) == 0 {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Aggregator.SaveScript(r.Context(), r.PathValue("name"), string(src)); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid script: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Script registered"))
+}
+
+// handler function for DELETE /scripts/{name}
+func (s *APIServer) handleDeleteScript(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteScript(r.Context(), r.PathValue("name")); err != nil {
+		http.Error(w, "Failed to delete script", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /policy
+func (s *APIServer) handleGetPolicy(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Aggregator.ActivePolicy(r.Context()))
+}
+
+// handler function for PUT /policy
+// fields left out of the body keep their default values
+func (s *APIServer) handleSavePolicy(w http.ResponseWriter, r *http.Request) {
+	policy := internal.DefaultPolicy()
+	if !s.decodeBody(w, r, &policy) {
+		return
+	}
+
+	if err := s.Validator.Validate(&policy); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Aggregator.SavePolicy(r.Context(), &policy); err != nil {
+		http.Error(w, "Failed to save policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Policy updated"))
+}
+
+// handler function for PUT /policy/candidate
+func (s *APIServer) handleSaveCandidatePolicy(w http.ResponseWriter, r *http.Request) {
+	policy := internal.DefaultPolicy()
+	if !s.decodeBody(w, r, &policy) {
+		return
+	}
+
+	if err := s.Validator.Validate(&policy); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Aggregator.SaveCandidatePolicy(r.Context(), &policy); err != nil {
+		http.Error(w, "Failed to save candidate policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Candidate policy loaded in shadow mode"))
+}
+
+// handler function for DELETE /policy/candidate
+func (s *APIServer) handleDeleteCandidatePolicy(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteCandidatePolicy(r.Context()); err != nil {
+		http.Error(w, "Failed to delete candidate policy", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /policy/candidate/report
+func (s *APIServer) handleShadowReport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Aggregator.ShadowReport(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build shadow report: %v", err), http.StatusNotFound)
+		return
+	}
+	writeConditionalJSON(w, r, report)
+}
+
+// handler function for GET /flags
+func (s *APIServer) handleListFlags(w http.ResponseWriter, r *http.Request) {
+	flags, err := s.Aggregator.ListFlags(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to list flags", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, flags)
+}
+
+// handler function for PUT /flags/{namespace}
+// use * as the namespace to set the defaults for every namespace
+func (s *APIServer) handleSaveFlags(w http.ResponseWriter, r *http.Request) {
+	var flags internal.Flags
+	if !s.decodeBody(w, r, &flags) {
+		return
+	}
+
+	if err := s.Aggregator.SaveFlags(r.Context(), r.PathValue("namespace"), flags); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid flags: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Flags updated"))
+}
+
+// handler function for DELETE /flags/{namespace}
+func (s *APIServer) handleDeleteFlags(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteFlags(r.Context(), r.PathValue("namespace")); err != nil {
+		http.Error(w, "Failed to delete flags", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /defaults
+func (s *APIServer) handleListDefaults(w http.ResponseWriter, r *http.Request) {
+	defaults, err := s.Aggregator.ListNamespaceDefaults(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to list namespace defaults", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, defaults)
+}
+
+// handler function for PUT /defaults/{namespace}
+// body is the per-container requests, e.g. {"cpu_cores": 0.1, "memory_mb": 128}
+func (s *APIServer) handleSaveDefaults(w http.ResponseWriter, r *http.Request) {
+	var res internal.Resources
+	if !s.decodeBody(w, r, &res) {
+		return
+	}
+
+	if err := s.Validator.Validate(&res); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Aggregator.SaveNamespaceDefaults(r.Context(), r.PathValue("namespace"), &res); err != nil {
+		http.Error(w, "Failed to save namespace defaults", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Namespace defaults updated"))
+}
+
+// handler function for DELETE /defaults/{namespace}
+func (s *APIServer) handleDeleteDefaults(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteNamespaceDefaults(r.Context(), r.PathValue("namespace")); err != nil {
+		http.Error(w, "Failed to delete namespace defaults", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /owners
+func (s *APIServer) handleListOwners(w http.ResponseWriter, r *http.Request) {
+	owners, err := s.Aggregator.ListOwners(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to list owners", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, owners)
+}
+
+// handler function for PUT /owners/{namespace} and PUT /owners/{namespace}/{name}
+// body is the owner, e.g. {"team": "payments", "slack_channel": "#payments-alerts", "oncall": "payments-primary", "department": "commerce"}
+func (s *APIServer) handleSaveOwner(w http.ResponseWriter, r *http.Request) {
+	var owner internal.Ownership
+	if !s.decodeBody(w, r, &owner) {
+		return
+	}
+	if owner == (internal.Ownership{}) {
+		http.Error(w, "Owner needs a team, slack_channel, oncall or department", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Aggregator.SaveOwner(r.Context(), r.PathValue("namespace"), r.PathValue("name"), &owner); err != nil {
+		http.Error(w, "Failed to save owner", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Owner updated"))
+}
+
+// handler function for DELETE /owners/{namespace} and DELETE /owners/{namespace}/{name}
+func (s *APIServer) handleDeleteOwner(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteOwner(r.Context(), r.PathValue("namespace"), r.PathValue("name")); err != nil {
+		http.Error(w, "Failed to delete owner", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /org/teams
+func (s *APIServer) handleListOrgTeams(w http.ResponseWriter, r *http.Request) {
+	teams, err := s.Aggregator.ListOrgTeams(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to list teams", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, teams)
+}
+
+// handler function for PUT /org/teams/{team}
+// body is the team's place, e.g. {"department": "commerce"}
+func (s *APIServer) handleSaveOrgTeam(w http.ResponseWriter, r *http.Request) {
+	var team internal.OrgTeam
+	if !s.decodeBody(w, r, &team) {
+		return
+	}
+	if err := s.Validator.Validate(&team); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Aggregator.SaveOrgTeam(r.Context(), r.PathValue("team"), &team); err != nil {
+		http.Error(w, "Failed to save team", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Team updated"))
+}
+
+// handler function for DELETE /org/teams/{team}
+func (s *APIServer) handleDeleteOrgTeam(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteOrgTeam(r.Context(), r.PathValue("team")); err != nil {
+		http.Error(w, "Failed to delete team", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for GET /routing/rules
+func (s *APIServer) handleListRoutingRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.Aggregator.ListRoutingRules(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to list routing rules", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// handler function for PUT /routing/rules/{name}
+// body is the rule, e.g. {"labels": {"team": "payments"}, "min_severity": "critical", "channels": ["pagerduty"], "approval": "manual"}
+func (s *APIServer) handleSaveRoutingRule(w http.ResponseWriter, r *http.Request) {
+	var rule internal.RoutingRule
+	if !s.decodeBody(w, r, &rule) {
+		return
+	}
+	rule.Name = r.PathValue("name")
+
+	if err := s.Validator.Validate(&rule); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Aggregator.SaveRoutingRule(r.Context(), &rule); err != nil {
+		if errors.Is(err, internal.ErrUnknownChannel) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to save routing rule", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Routing rule registered"))
+}
+
+// handler function for DELETE /routing/rules/{name}
+func (s *APIServer) handleDeleteRoutingRule(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteRoutingRule(r.Context(), r.PathValue("name")); err != nil {
+		http.Error(w, "Failed to delete routing rule", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/billing"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/savings"
+)
+
+// handler function for POST /feedback/savings
+func (s *APIServer) handleSavingsFeedback(w http.ResponseWriter, r *http.Request) {
+	var f savings.Feedback
+	if !s.decodeBody(w, r, &f) {
+		return
+	}
+
+	if err := s.Validator.Validate(&f); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Savings.Record(r.Context(), &f); err != nil {
+		fmt.Printf("Savings tracker error %v\n", err)
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Savings feedback recorded"))
+}
+
+// handler function for GET /reports/savings
+func (s *APIServer) handleSavingsReport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Savings.Report(r.Context())
+	if err != nil {
+		fmt.Printf("Savings tracker error %v\n", err)
+		http.Error(w, "Failed to build savings report", http.StatusInternalServerError)
+		return
+	}
+	writeConditionalJSON(w, r, report)
+}
+
+// handler function for GET /reports/savings/event-driven
+func (s *APIServer) handleEventDrivenSavings(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Aggregator.EventDrivenSavings(r.Context())
+	if errors.Is(err, internal.ErrNoCostData) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to build event-driven savings report", http.StatusInternalServerError)
+		return
+	}
+	writeConditionalJSON(w, r, report)
+}
+
+// handler function for PUT /savings/goals/{scope}/{name}
+func (s *APIServer) handleSaveSavingsGoal(w http.ResponseWriter, r *http.Request) {
+	var g savings.Goal
+	if !s.decodeBody(w, r, &g) {
+		return
+	}
+	g.Scope = r.PathValue("scope")
+	g.Name = r.PathValue("name")
+
+	if err := s.Validator.Validate(&g); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Savings.SaveGoal(r.Context(), &g); err != nil {
+		fmt.Printf("Savings tracker error %v\n", err)
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Savings goal saved"))
+}
+
+// handler function for DELETE /savings/goals/{scope}/{name}
+func (s *APIServer) handleDeleteSavingsGoal(w http.ResponseWriter, r *http.Request) {
+	if err := s.Savings.DeleteGoal(r.Context(), r.PathValue("scope"), r.PathValue("name")); err != nil {
+		http.Error(w, "Failed to delete goal", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for POST /feedback/outcome
+func (s *APIServer) handleOutcome(w http.ResponseWriter, r *http.Request) {
+	var o internal.Outcome
+	if !s.decodeBody(w, r, &o) {
+		return
+	}
+
+	if err := s.Validator.Validate(&o); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	review, err := s.Aggregator.RecordOutcome(r.Context(), &o)
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+	if review == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusCreated, review)
+}
+
+// handler function for GET /reviews
+func (s *APIServer) handleListReviews(w http.ResponseWriter, r *http.Request) {
+	reviews, err := s.Aggregator.ListReviews(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to get reviews", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, reviews)
+}
+
+// handler function for DELETE /reviews/{namespace}/{name}
+func (s *APIServer) handleResolveReview(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.ResolveReview(r.Context(), r.PathValue("namespace"), r.PathValue("name")); err != nil {
+		http.Error(w, "Failed to resolve review", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler function for POST /billing/import?provider=aws|gcp&filter=<column>=<value>
+// the body is the billing export CSV, gzipped or not, filters narrow it to the cluster's charges
+func (s *APIServer) handleImportBill(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var filters []billing.Filter
+	for _, v := range q["filter"] {
+		f, err := billing.ParseFilter(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filters = append(filters, f)
+	}
+
+	bill, err := billing.Parse(q.Get("provider"), r.Body, filters)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid billing export: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	correction, err := s.Aggregator.ReconcileBill(r.Context(), bill)
+	if errors.Is(err, internal.ErrNoBillingOverlap) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to reconcile billing export", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, correction)
+}
+
+// handler function for GET /billing/correction
+func (s *APIServer) handleGetBillingCorrection(w http.ResponseWriter, r *http.Request) {
+	correction, err := s.Aggregator.BillingCorrection(r.Context())
+	if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to get billing correction", http.StatusInternalServerError)
+		return
+	}
+	if correction == nil {
+		http.Error(w, "No billing export imported", http.StatusNotFound)
+		return
+	}
+	writeConditionalJSON(w, r, correction)
+}
+
+// handler function for DELETE /billing/correction
+func (s *APIServer) handleDeleteBillingCorrection(w http.ResponseWriter, r *http.Request) {
+	if err := s.Aggregator.DeleteBillingCorrection(r.Context()); err != nil {
+		http.Error(w, "Failed to delete billing correction", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/tenant"
+)
+
+// writes 413 for a payload over the tenant's size quota, 429 over its push rate, and returns true when rejected
+func (s *APIServer) overQuota(w http.ResponseWriter, r *http.Request, ns string, size int64) bool {
+	if s.Tenants == nil {
+		return false
+	}
+	err := s.Tenants.CheckPush(r.Context(), ns, size)
+	var quotaErr *tenant.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	if quotaErr.Quota == tenant.QuotaPayloadSize {
+		http.Error(w, quotaErr.Error(), http.StatusRequestEntityTooLarge)
+		return true
+	}
+	if quotaErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quotaErr.RetryAfter.Seconds()))))
+	}
+	http.Error(w, quotaErr.Error(), http.StatusTooManyRequests)
+	return true
+}
+
+// handler function for GET /tenants/quotas
+func (s *APIServer) handleListQuotas(w http.ResponseWriter, r *http.Request) {
+	if s.Tenants == nil {
+		http.Error(w, "Multi-tenant mode is off", http.StatusNotFound)
+		return
+	}
+	quotas, err := s.Tenants.ListQuotas(r.Context())
+	if err != nil {
+		fmt.Printf("Tenant limiter error %v\n", err)
+		http.Error(w, "Failed to get quotas", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, quotas)
+}
+
+// handler function for PUT /tenants/{tenant}/quota
+func (s *APIServer) handleSaveQuota(w http.ResponseWriter, r *http.Request) {
+	if s.Tenants == nil {
+		http.Error(w, "Multi-tenant mode is off", http.StatusNotFound)
+		return
+	}
+	var q tenant.Quota
+	if !s.decodeBody(w, r, &q) {
+		return
+	}
+
+	if err := s.Validator.Validate(&q); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Tenants.SaveQuota(r.Context(), r.PathValue("tenant"), &q); err != nil {
+		fmt.Printf("Tenant limiter error %v\n", err)
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Quota saved"))
+}
+
+// handler function for DELETE /tenants/{tenant}/quota
+func (s *APIServer) handleDeleteQuota(w http.ResponseWriter, r *http.Request) {
+	if s.Tenants == nil {
+		http.Error(w, "Multi-tenant mode is off", http.StatusNotFound)
+		return
+	}
+	if err := s.Tenants.DeleteQuota(r.Context(), r.PathValue("tenant")); err != nil {
+		http.Error(w, "Failed to delete quota", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,14 +2,40 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/config"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/history"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/hubtest"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/producer"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/savings"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/tenant"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/transform"
 )
 
-func TestCostEngineSuccess(t *testing.T) {
-	var jsonStr = []byte(`{
+// server backed by an in-memory redis, pushes are evaluated by hub
+func newTestServer(t *testing.T) (*APIServer, *hubtest.Hub) {
+	hub := hubtest.New(t)
+	cfg := config.Default()
+	cfg.Redis.Addr = hub.Redis.Addr()
+	server := NewAPIServer(cfg)
+	server.Aggregator = hub.Aggregator
+	return server, hub
+}
+
+// loadgenerator uses 5% of its memory request
+var costPayload = []byte(`{
   "timestamp": "2025-12-22T14:04:43.684548Z",
   "namespace": "default",
   "cluster_info": {
@@ -31,9 +57,10 @@ func TestCostEngineSuccess(t *testing.T) {
   ]
 }`)
 
-	server := NewAPIServer()
+func TestCostEngineSuccess(t *testing.T) {
+	server, hub := newTestServer(t)
 
-	req, err := http.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(jsonStr))
+	req, err := http.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,13 +79,26 @@ func TestCostEngineSuccess(t *testing.T) {
 		t.Errorf("Handler returned unexpected body: got %q, want %q", rr.Body.String(), expected)
 	}
 
-	// Sleep to allow background threshold check to run and print logs
-	time.Sleep(1 * time.Second)
+	hub.Wait()
+	if job := hub.RequireJob("default", "loadgenerator"); job.Reason != "High Memory Waste" {
+		t.Errorf("Unexpected job reason: got %q, want %q", job.Reason, "High Memory Waste")
+	}
+	hub.AssertKey("trigger:cooldown:loadgenerator")
 }
 
 func TestForecastSuccess(t *testing.T) {
-	// 2. Create Forecast Payload (Relies on Cost Data existing in Redis)
-	// adservice: Prediction 3.0 vs Request 1.0 (from Cost above) -> Should Trigger Risk
+	server, hub := newTestServer(t)
+
+	// forecasts are merged with the latest cost payload
+	rr := httptest.NewRecorder()
+	server.handleCostEngine(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Cost push failed: got %v", rr.Code)
+	}
+	hub.Wait()
+	hub.ClearJobs()
+
+	// neither deployment is in the cost payload, so both are kept as orphan forecasts
 	var jsonStr = []byte(`{
   "timestamp": "2024-01-01T12:00:00Z",
   "namespace": "default",
@@ -80,15 +120,13 @@ func TestForecastSuccess(t *testing.T) {
   ]
 }`)
 
-	server := NewAPIServer()
-
 	req, err := http.NewRequest(http.MethodPost, "/api/v1/metrics/forecast", bytes.NewBuffer(jsonStr))
 	if err != nil {
 		t.Fatal(err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	rr := httptest.NewRecorder()
+	rr = httptest.NewRecorder()
 	server.handleForecast(rr, req)
 
 	if status := rr.Code; status != http.StatusCreated {
@@ -101,6 +139,1028 @@ func TestForecastSuccess(t *testing.T) {
 		t.Errorf("Handler returned unexpected body: got %q, want %q", rr.Body.String(), expected)
 	}
 
-	// Sleep to allow background merge and check to run
-	time.Sleep(1 * time.Second)
+	hub.Wait()
+	hub.AssertJobCount(0)
+	hub.AssertKey("forecast:orphan:default:paymentservice")
+	hub.AssertKey("forecast:orphan:default:recommendationservice")
+}
+
+func TestCombinedEvaluatesUsageAndPredictions(t *testing.T) {
+	server, hub := newTestServer(t)
+
+	// cartservice is healthy now but predicted to outgrow its memory request
+	combined := []byte(`{
+  "timestamp": "2025-12-22T14:04:43.684548Z",
+  "namespace": "default",
+  "cluster_info": {"vm_count": 6, "current_hourly_cost": 0.24},
+  "deployments": [
+    {
+      "name": "loadgenerator",
+      "current_requests": {"cpu_cores": 0.3, "memory_mb": 750},
+      "current_usage": {"cpu_cores": 0.06, "memory_mb": 38}
+    },
+    {
+      "name": "cartservice",
+      "current_requests": {"cpu_cores": 0.5, "memory_mb": 512},
+      "current_usage": {"cpu_cores": 0.3, "memory_mb": 300},
+      "predicted_peak_24h": {"cpu_cores": 0.3, "memory_mb": 600}
+    }
+  ]
+}`)
+	rr := httptest.NewRecorder()
+	server.handleCombined(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/combined", bytes.NewBuffer(combined)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	hub.Wait()
+	if job := hub.RequireJob("default", "loadgenerator"); job.Reason != "High Memory Waste" {
+		t.Errorf("expected memory waste from usage, got %q", job.Reason)
+	}
+	if job := hub.RequireJob("default", "cartservice"); job.Reason != "Predicted Capacity Risk (Memory)" {
+		t.Errorf("expected a capacity risk from the prediction, got %q", job.Reason)
+	}
+	hub.AssertJobCount(2)
+	hub.AssertKey(internal.LatestCostKey)
+}
+
+func TestCostDeltaSequence(t *testing.T) {
+	server, hub := newTestServer(t)
+	post := func(path string, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		if path == "/api/v1/metrics/cost" {
+			server.handleCostEngine(rr, req)
+		} else {
+			server.handleCostDelta(rr, req)
+		}
+		hub.Wait()
+		return rr
+	}
+	delta := func(seq int) string {
+		return fmt.Sprintf(`{"timestamp": "2025-12-22T14:0%d:00Z", "namespace": "default", "sequence": %d,
+			"deployments": [{"name": "cartservice", "current_requests": {"cpu_cores": 0.5, "memory_mb": 512}, "current_usage": {"cpu_cores": 0.3, "memory_mb": 300}}]}`, seq+4, seq)
+	}
+
+	if rr := post("/api/v1/metrics/cost/delta", delta(2)); rr.Code != http.StatusConflict {
+		t.Errorf("expected a conflict without a full payload, got %d", rr.Code)
+	}
+
+	full := bytes.Replace(costPayload, []byte(`"namespace": "default",`), []byte(`"namespace": "default", "sequence": 1,`), 1)
+	if rr := post("/api/v1/metrics/cost", string(full)); rr.Code != http.StatusCreated {
+		t.Fatalf("expected the full payload to be accepted, got %d", rr.Code)
+	}
+	if rr := post("/api/v1/metrics/cost/delta", delta(2)); rr.Code != http.StatusCreated {
+		t.Fatalf("expected the delta to be accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := post("/api/v1/metrics/cost/delta", delta(2)); rr.Code != http.StatusOK {
+		t.Errorf("expected a retried delta to be acknowledged, got %d", rr.Code)
+	}
+	if rr := post("/api/v1/metrics/cost/delta", delta(4)); rr.Code != http.StatusConflict {
+		t.Errorf("expected a conflict for a sequence gap, got %d", rr.Code)
+	}
+
+	summary, err := hub.Aggregator.ClusterSummary(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Deployments != 2 {
+		t.Errorf("expected the delta merged into the stored payload, got %d deployments", summary.Deployments)
+	}
+}
+
+func TestLatestCostConditionalGet(t *testing.T) {
+	server, hub := newTestServer(t)
+	get := func(etag string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/metrics/cost/latest", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		server.handleLatestCost(rr, req)
+		return rr
+	}
+	push := func(body []byte) {
+		rr := httptest.NewRecorder()
+		server.handleCostEngine(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(body)))
+		hub.Wait()
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected the payload to be accepted, got %d", rr.Code)
+		}
+	}
+
+	if rr := get(""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before any push, got %d", rr.Code)
+	}
+
+	push(costPayload)
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d %q", first.Code, etag)
+	}
+
+	if rr := get(etag); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("expected 304 without a body, got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+	if rr := get(`"other", W/` + etag); rr.Code != http.StatusNotModified {
+		t.Errorf("expected a weak match in a list to give 304, got %d", rr.Code)
+	}
+
+	push(bytes.Replace(costPayload, []byte("14:04:43"), []byte("14:09:43"), 1))
+	rr := get(etag)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 once the payload changed, got %d", rr.Code)
+	}
+	if rr.Header().Get("ETag") == etag {
+		t.Errorf("expected a new ETag once the payload changed")
+	}
+}
+
+func TestLatestCostFieldsAndDeployments(t *testing.T) {
+	server, hub := newTestServer(t)
+	push := httptest.NewRecorder()
+	server.handleCostEngine(push, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+	hub.Wait()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.handleLatestCost(rr, httptest.NewRequest(http.MethodGet, "/api/v1/metrics/cost/latest?"+query, nil))
+		return rr
+	}
+
+	rr := get("fields=timestamp,deployments.name,deployments.current_usage.cpu_cores")
+	expected := `{"deployments":[{"current_usage":{"cpu_cores":0.06},"name":"loadgenerator"}],"timestamp":"2025-12-22T14:04:43.684548Z"}` + "\n"
+	if rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Errorf("expected the projected payload, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = get("deployment=cartservice&fields=deployments")
+	if rr.Body.String() != `{"deployments":[]}`+"\n" {
+		t.Errorf("expected no deployments for an unknown name, got %s", rr.Body.String())
+	}
+
+	if rr := get("fields=deployments..name"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an empty field name, got %d", rr.Code)
+	}
+}
+
+func TestRecommendationPatchFormats(t *testing.T) {
+	server, hub := newTestServer(t)
+	get := func(name string, query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/deployments/"+name+"/recommendation/patch?"+query, nil)
+		req.SetPathValue("name", name)
+		server.handleRecommendationPatch(rr, req)
+		return rr
+	}
+
+	if rr := get("loadgenerator", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before any push, got %d", rr.Code)
+	}
+	push := httptest.NewRecorder()
+	server.handleCostEngine(push, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+	hub.Wait()
+
+	rr := get("loadgenerator", "")
+	expected := `[{"op":"add","path":"/spec/template/spec/containers/0/resources/requests/cpu","value":"250m"},` +
+		`{"op":"add","path":"/spec/template/spec/containers/0/resources/requests/memory","value":"576Mi"}]` + "\n"
+	if rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Errorf("expected a JSON patch for the first container, got %d %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json-patch+json" {
+		t.Errorf("expected the JSON patch content type, got %s", ct)
+	}
+
+	rr = get("loadgenerator", "format=strategic&container=main")
+	expected = `{"spec":{"template":{"spec":{"containers":[{"name":"main","resources":{"requests":{"cpu":"250m","memory":"576Mi"}}}]}}}}` + "\n"
+	if rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Errorf("expected a strategic merge patch for the named container, got %d %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/strategic-merge-patch+json" {
+		t.Errorf("expected the strategic merge patch content type, got %s", ct)
+	}
+
+	if rr := get("loadgenerator", "format=yaml"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", rr.Code)
+	}
+	if rr := get("loadgenerator", "namespace=payments"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another namespace, got %d", rr.Code)
+	}
+}
+
+func TestPurgeNamespaceData(t *testing.T) {
+	server, hub := newTestServer(t)
+	purge := func(query string) (*httptest.ResponseRecorder, internal.PurgeResult) {
+		rr := httptest.NewRecorder()
+		server.handlePurge(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/data?"+query, nil))
+		var res internal.PurgeResult
+		json.Unmarshal(rr.Body.Bytes(), &res)
+		return rr, res
+	}
+
+	if rr, _ := purge(""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a filter, got %d", rr.Code)
+	}
+	push := httptest.NewRecorder()
+	server.handleCostEngine(push, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+	hub.Wait()
+
+	if _, res := purge("namespace=payments"); res.History != 0 || res.Jobs != 0 || res.Events != 0 {
+		t.Errorf("expected nothing to purge in another namespace, got %+v", res)
+	}
+	rr, res := purge("namespace=default&dry_run=true")
+	if rr.Code != http.StatusOK || !res.DryRun || res.History != 1 || res.Jobs != 1 || res.Events != 2 {
+		t.Errorf("expected the sample, job and 2 events counted, got %d %+v", rr.Code, res)
+	}
+	hub.AssertJobCount(1)
+
+	if _, res = purge("namespace=default"); res.DryRun || res.Jobs != 1 || res.Events != 2 || res.QualityReports != 1 {
+		t.Errorf("expected the job, events and quality report removed, got %+v", res)
+	}
+	hub.AssertJobCount(0)
+	events, _ := hub.Aggregator.ReadEvents(context.Background(), time.Time{}, time.Time{})
+	if len(events) != 2 || events[0].Type != internal.EventDataPurged || events[1].Type != internal.EventDataPurged {
+		t.Errorf("expected only both purges recorded, got %+v", events)
+	}
+}
+
+func TestDeploymentArchiveRoundTrip(t *testing.T) {
+	server, hub := newTestServer(t)
+	export := func(ns string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/deployments/loadgenerator/archive?namespace="+ns, nil)
+		req.SetPathValue("name", "loadgenerator")
+		server.handleExportDeployment(rr, req)
+		return rr
+	}
+
+	if rr := export("default"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before any push, got %d", rr.Code)
+	}
+	push := httptest.NewRecorder()
+	server.handleCostEngine(push, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+	hub.Wait()
+
+	rr := export("default")
+	var archive internal.DeploymentArchive
+	if err := json.Unmarshal(rr.Body.Bytes(), &archive); err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.Samples) != 1 || len(archive.Events) != 2 || archive.Events[1].Type != internal.EventJobPublished {
+		t.Errorf("expected the sample, payload and job, got %+v", archive)
+	}
+
+	body, _ := json.Marshal(archive)
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/deployments/loadgenerator/archive?namespace=payments", bytes.NewReader(body))
+	req.SetPathValue("name", "loadgenerator")
+	server.handleImportDeployment(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the import accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	var migrated internal.DeploymentArchive
+	json.Unmarshal(export("payments").Body.Bytes(), &migrated)
+	if migrated.Namespace != "payments" || len(migrated.Samples) != 1 || len(migrated.Events) != 2 {
+		t.Errorf("expected the history under payments, got %+v", migrated)
+	}
+}
+
+func TestCostBackfillWritesHistoryOnly(t *testing.T) {
+	server, hub := newTestServer(t)
+	var p internal.CostPayload
+	json.Unmarshal(costPayload, &p)
+	now := hub.Clock.Now()
+	backfill := func(times ...time.Time) *httptest.ResponseRecorder {
+		var b internal.CostBackfill
+		for _, ts := range times {
+			p.Timestamp = ts
+			b.Payloads = append(b.Payloads, p)
+		}
+		body, _ := json.Marshal(b)
+		rr := httptest.NewRecorder()
+		server.handleCostBackfill(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost/backfill", bytes.NewReader(body)))
+		return rr
+	}
+
+	if rr := backfill(now.Add(time.Hour)); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a future payload rejected, got %d", rr.Code)
+	}
+
+	old := now.Add(-10 * 24 * time.Hour).Truncate(time.Hour)
+	rr := backfill(old, old.Add(time.Minute), now.Add(-time.Hour))
+	var res internal.BackfillResult
+	json.Unmarshal(rr.Body.Bytes(), &res)
+	// two old samples make one hourly and one daily bucket, the recent one is stored raw
+	if rr.Code != http.StatusOK || res.Samples != 1 || res.Rollups != 2 {
+		t.Fatalf("expected 1 raw sample and 2 rollups, got %d %+v", rr.Code, res)
+	}
+	hourly, _ := hub.Redis.ZMembers(history.Hourly.Key("default/loadgenerator"))
+	if len(hourly) != 1 {
+		t.Errorf("expected one hourly bucket, got %v", hourly)
+	}
+
+	// backfilling the same range again keeps what is there
+	rr = backfill(old)
+	json.Unmarshal(rr.Body.Bytes(), &res)
+	if res.Rollups != 0 || res.Skipped != 2 {
+		t.Errorf("expected existing buckets kept, got %+v", res)
+	}
+
+	hub.Wait()
+	hub.AssertJobCount(0)
+	if hub.Redis.Exists(internal.LatestCostKey) {
+		t.Errorf("expected cost:latest untouched")
+	}
+}
+
+func TestConsoleServedWithClusterID(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.Config.Server.ClusterID = "prod-eu"
+
+	rr := httptest.NewRecorder()
+	uiHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "app.js") {
+		t.Errorf("expected the console page, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	server.handleUIConfig(rr, httptest.NewRequest(http.MethodGet, "/ui/config.json", nil))
+	var cfg uiConfig
+	if err := json.NewDecoder(rr.Body).Decode(&cfg); err != nil || cfg.ClusterID != "prod-eu" {
+		t.Errorf("expected cluster prod-eu, got %+v %v", cfg, err)
+	}
+}
+
+func TestPublicStatusHasOnlyAggregates(t *testing.T) {
+	server, hub := newTestServer(t)
+	ctx := context.Background()
+
+	rr := httptest.NewRecorder()
+	server.handlePublicStatus(rr, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before any cost data, got %d", rr.Code)
+	}
+
+	server.handleCostEngine(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+	hub.Wait()
+	feedback := &savings.Feedback{JobID: "job-1", Namespace: "default", Deployment: "loadgenerator", HourlySavings: 0.01, AppliedAt: time.Now()}
+	if err := server.Savings.Record(ctx, feedback); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	server.handlePublicStatus(rr, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+	if strings.Contains(rr.Body.String(), "loadgenerator") {
+		t.Errorf("expected no workload names, got %s", rr.Body.String())
+	}
+	var status internal.PublicStatus
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	// cpu 20% and memory 5% used
+	if status.EfficiencyScore != 12.5 {
+		t.Errorf("expected efficiency score 12.5, got %v", status.EfficiencyScore)
+	}
+	if status.MonthlySavings != 7.3 {
+		t.Errorf("expected monthly savings 7.3, got %v", status.MonthlySavings)
+	}
+	if status.JobsLast24h != 1 {
+		t.Errorf("expected 1 job in the last 24h, got %d", status.JobsLast24h)
+	}
+}
+
+// two loadgenerator pods as a Datadog agent reports them, usage in nanocores and bytes
+var datadogSeries = []byte(`{"series": [
+  {"metric": "kubernetes.cpu.requests", "points": [[1766412283, 0.15]], "tags": ["kube_namespace:default", "kube_deployment:loadgenerator", "pod_name:lg-1"]},
+  {"metric": "kubernetes.cpu.requests", "points": [[1766412283, 0.15]], "tags": ["kube_namespace:default", "kube_deployment:loadgenerator", "pod_name:lg-2"]},
+  {"metric": "kubernetes.cpu.usage.total", "points": [[1766412223, 10000000], [1766412283, 30000000]], "tags": ["kube_namespace:default", "kube_deployment:loadgenerator", "pod_name:lg-1"]},
+  {"metric": "kubernetes.cpu.usage.total", "points": [[1766412283, 30000000]], "tags": ["kube_namespace:default", "kube_deployment:loadgenerator", "pod_name:lg-2"]},
+  {"metric": "kubernetes.memory.requests", "points": [[1766412283, 786432000]], "tags": ["kube_namespace:default", "kube_deployment:loadgenerator"]},
+  {"metric": "kubernetes.memory.usage", "points": [{"timestamp": 1766412283, "value": 39845888}], "tags": ["kube_namespace:default", "kube_deployment:loadgenerator"]},
+  {"metric": "kubernetes.memory.usage", "points": [[1766412283, 1048576]], "tags": ["kube_namespace:kube-system", "kube_deployment:coredns"]},
+  {"metric": "kubernetes_state.node.count", "points": [[1766412283, 6]]},
+  {"metric": "system.load.1", "points": [[1766412283, 0.4]]}
+]}`)
+
+func postDatadogSeries(t *testing.T, server *APIServer, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(body)
+	zw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/intake/datadog/api/v1/series", &gz)
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	server.handleDatadogSeries(rr, req)
+	return rr
+}
+
+func TestDatadogSeriesBecomeCostPayload(t *testing.T) {
+	server, hub := newTestServer(t)
+	server.DatadogIntake.Mapping.HourlyCostPerNode = 0.04
+	ctx := context.Background()
+
+	if err := server.Ingest.Poll(ctx, server.DatadogIntake.Name()); err != nil {
+		t.Fatalf("expected nothing to poll before any series, got %v", err)
+	}
+	if rr := postDatadogSeries(t, server, datadogSeries); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d %s", rr.Code, rr.Body.String())
+	}
+	if err := server.Ingest.Poll(ctx, server.DatadogIntake.Name()); err != nil {
+		t.Fatal(err)
+	}
+	hub.Wait()
+
+	p, err := hub.Aggregator.LatestCost(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Source != internal.DatadogSource || len(p.Deployments) != 1 {
+		t.Fatalf("expected one deployment from datadog, got %+v", p)
+	}
+	if p.ClusterInfo.VmCount != 6 || math.Abs(p.ClusterInfo.Cost-0.24) > 1e-9 {
+		t.Errorf("expected 6 nodes costing 0.24, got %+v", p.ClusterInfo)
+	}
+	d := p.Deployments[0]
+	if d.CurrentRequests.CPUCores != 0.3 || d.CurrentRequests.MemoryMB != 750 {
+		t.Errorf("expected requests 0.3 cores and 750MB, got %+v", d.CurrentRequests)
+	}
+	// only the latest point of each pod counts
+	if math.Abs(d.CurrentUsage.CPUCores-0.06) > 1e-9 || d.CurrentUsage.MemoryMB != 38 {
+		t.Errorf("expected usage 0.06 cores and 38MB, got %+v", d.CurrentUsage)
+	}
+
+	rr := httptest.NewRecorder()
+	server.handleDatadogSeries(rr, httptest.NewRequest(http.MethodPost, "/api/v1/intake/datadog/api/v2/series",
+		strings.NewReader(`{"series": [{"metric": "system.load.1", "points": [{"timestamp": 1766412283, "value": 0.4}]}]}`)))
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("expected unmapped series to be accepted, got %d", rr.Code)
+	}
+}
+
+// a node agent's flush carries its own pods and no node count, the cluster agent's only the node count
+func TestDatadogPartialFlushesAccumulate(t *testing.T) {
+	server, hub := newTestServer(t)
+	server.DatadogIntake.Mapping.HourlyCostPerNode = 0.04
+	ctx := context.Background()
+
+	nodeAgent := []byte(`{"series": [
+  {"metric": "kubernetes.cpu.requests", "points": [[1766412283, 0.15]], "tags": ["kube_namespace:default", "kube_deployment:loadgenerator", "pod_name:lg-1"]},
+  {"metric": "kubernetes.cpu.usage.total", "points": [[1766412283, 30000000]], "tags": ["kube_namespace:default", "kube_deployment:loadgenerator", "pod_name:lg-1"]},
+  {"metric": "kubernetes.memory.requests", "points": [[1766412283, 393216000]], "tags": ["kube_namespace:default", "kube_deployment:loadgenerator", "pod_name:lg-1"]},
+  {"metric": "kubernetes.memory.usage", "points": [[1766412283, 19922944]], "tags": ["kube_namespace:default", "kube_deployment:loadgenerator", "pod_name:lg-1"]}
+]}`)
+	if rr := postDatadogSeries(t, server, nodeAgent); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected an incomplete batch accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+	if err := server.Ingest.Poll(ctx, server.DatadogIntake.Name()); err == nil {
+		t.Fatal("expected no valid payload without a node count")
+	}
+	if hub.Redis.Exists(internal.LatestCostKey) {
+		t.Fatal("expected nothing saved from a partial flush")
+	}
+
+	second := bytes.ReplaceAll(nodeAgent, []byte("lg-1"), []byte("lg-2"))
+	postDatadogSeries(t, server, second)
+	postDatadogSeries(t, server, []byte(`{"series": [{"metric": "kubernetes_state.node.count", "points": [[1766412283, 6]]}]}`))
+	if err := server.Ingest.Poll(ctx, server.DatadogIntake.Name()); err != nil {
+		t.Fatal(err)
+	}
+	hub.Wait()
+
+	p, err := hub.Aggregator.LatestCost(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ClusterInfo.VmCount != 6 || len(p.Deployments) != 1 {
+		t.Fatalf("expected one deployment on 6 nodes, got %+v", p)
+	}
+	if d := p.Deployments[0]; math.Abs(d.CurrentRequests.CPUCores-0.3) > 1e-9 || d.CurrentRequests.MemoryMB != 750 {
+		t.Errorf("expected both pods' requests summed, got %+v", d.CurrentRequests)
+	}
+}
+
+func TestDatadogDecompressionBombGets413(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.Config.Server.MaxBodyBytes = 1 << 10
+
+	// compresses to well under the limit
+	body := append([]byte(`{"series": [], "padding": "`), bytes.Repeat([]byte("a"), 1<<20)...)
+	body = append(body, `"}`...)
+	if rr := postDatadogSeries(t, server, body); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPipelineRewritesPushedPayload(t *testing.T) {
+	server, hub := newTestServer(t)
+	server.Config.Pipeline = transform.Pipeline{
+		{Type: transform.RenameNamespace, From: "online-boutique", To: "default"},
+		{Type: transform.InjectLabels, Labels: map[string]string{"team": "shop"}},
+	}
+
+	body := bytes.Replace(costPayload, []byte(`"namespace": "default"`), []byte(`"namespace": "online-boutique"`), 1)
+	rr := httptest.NewRecorder()
+	server.handleCostEngine(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", rr.Code, rr.Body.String())
+	}
+	hub.Wait()
+
+	p, err := hub.Aggregator.LatestCost(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Namespace != "default" || p.Deployments[0].Labels["team"] != "shop" {
+		t.Errorf("expected the renamed and labelled payload to be saved, got %+v", p)
+	}
+
+	server.Config.Pipeline = transform.Pipeline{{Type: transform.DropDeployments, Deployments: []string{"loadgenerator"}}}
+	rr = httptest.NewRecorder()
+	server.handleCostEngine(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewReader(costPayload)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a payload with every deployment dropped to be rejected, got %d", rr.Code)
+	}
+
+	delta := []byte(`{"timestamp": "2025-12-22T14:05:43Z", "namespace": "default", "sequence": 2,
+  "deployments": [{"name": "loadgenerator", "current_requests": {"cpu_cores": 0.3, "memory_mb": 750}, "current_usage": {"cpu_cores": 0.05, "memory_mb": 40}}]}`)
+	rr = httptest.NewRecorder()
+	server.handleCostDelta(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost/delta", bytes.NewReader(delta)))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "rejected by pipeline") {
+		t.Errorf("expected a delta with every deployment dropped to be rejected, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestExplainDeployment(t *testing.T) {
+	server, hub := newTestServer(t)
+	get := func(name string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/deployments/"+name+"/explain", nil)
+		req.SetPathValue("name", name)
+		server.handleExplain(rr, req)
+		return rr
+	}
+
+	if rr := get("loadgenerator"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before any push, got %d", rr.Code)
+	}
+	push := httptest.NewRecorder()
+	server.handleCostEngine(push, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+	hub.Wait()
+
+	rr := get("loadgenerator")
+	var e internal.Explanation
+	if err := json.Unmarshal(rr.Body.Bytes(), &e); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected an explanation, got %d %s", rr.Code, rr.Body.String())
+	}
+	if e.Reason != "High Memory Waste" || len(e.Checks) == 0 || !e.Checks[0].Fired || e.Checks[0].Check != internal.FamilyMemoryWaste {
+		t.Errorf("expected memory waste to fire first, got %+v", e)
+	}
+	// the job pushed for the payload started the cooldown
+	for _, g := range e.Gates {
+		if g.Check == "cooldown" && !g.Matched {
+			t.Errorf("expected the cooldown to hold the trigger, got %+v", g)
+		}
+	}
+	if e.WouldTrigger {
+		t.Errorf("expected no trigger within the cooldown")
+	}
+}
+
+func TestDryRunEvaluatesWithoutSaving(t *testing.T) {
+	server, hub := newTestServer(t)
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.handleDryRun(rr, httptest.NewRequest(http.MethodPost, "/api/v1/admin/evaluate", bytes.NewBufferString(body)))
+		return rr
+	}
+
+	rr := post(`{"payload": ` + string(costPayload) + `, "rules": [{"name": "idle", "expression": "cpu_usage < 0.1", "reason": "Idle"}],
+		"flags": {"memory": false, "cpu_waste": false}}`)
+	hub.Wait()
+	var report internal.DryRunReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected a report, got %d %s", rr.Code, rr.Body.String())
+	}
+	if len(report.Decisions) != 1 || report.Decisions[0].Reason != "Idle" || report.Decisions[0].Recommendation == nil {
+		t.Errorf("expected the crafted rule to fire with memory and cpu waste off, got %+v", report.Decisions)
+	}
+	if _, err := server.Aggregator.LatestCost(context.Background()); !errors.Is(err, internal.ErrNoCostData) {
+		t.Errorf("expected nothing saved, got %v", err)
+	}
+
+	if rr := post(`{"payload": ` + string(costPayload) + `, "rules": [{"expression": "cpu_usage <", "reason": "Idle"}]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a rule that doesn't compile, got %d", rr.Code)
+	}
+	if rr := post(`{"rules": []}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a payload, got %d", rr.Code)
+	}
+}
+
+func TestDryRunMatchesPushedPayload(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.Config.Pipeline = transform.Pipeline{
+		{Type: transform.RenameNamespace, From: "online-boutique", To: "default", Sources: []string{producer.CostEngine}},
+	}
+
+	// only cpu_waste is set, memory_waste keeps its default and the memory waste still fires
+	rr := httptest.NewRecorder()
+	payload := bytes.Replace(costPayload, []byte(`"namespace": "default"`), []byte(`"namespace": "online-boutique"`), 1)
+	body := `{"payload": ` + string(payload) + `, "policy": {"cpu_waste": 0.5}}`
+	server.handleDryRun(rr, httptest.NewRequest(http.MethodPost, "/api/v1/admin/evaluate", bytes.NewBufferString(body)))
+	var report internal.DryRunReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected a report, got %d %s", rr.Code, rr.Body.String())
+	}
+	if report.Namespace != "default" {
+		t.Errorf("expected the pipeline to treat the payload as the cost engine's, got namespace %q", report.Namespace)
+	}
+	if len(report.Decisions) != 1 || report.Decisions[0].Reason != "High Memory Waste" {
+		t.Errorf("expected the default memory waste threshold applied, got %+v", report.Decisions)
+	}
+}
+
+func TestOrgRollupReport(t *testing.T) {
+	server, hub := newTestServer(t)
+	ctx := context.Background()
+	if err := hub.Aggregator.SaveOwner(ctx, "default", "", &internal.Ownership{Team: "storefront"}); err != nil {
+		t.Fatal(err)
+	}
+
+	save := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/org/teams/storefront", strings.NewReader(`{"department": "commerce"}`))
+	req.SetPathValue("team", "storefront")
+	server.handleSaveOrgTeam(save, req)
+	if save.Code != http.StatusCreated {
+		t.Fatalf("expected 201 saving the team, got %d", save.Code)
+	}
+	push := httptest.NewRecorder()
+	server.handleCostEngine(push, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+	hub.Wait()
+
+	rr := httptest.NewRecorder()
+	server.handleOrgRollup(rr, httptest.NewRequest(http.MethodGet, "/api/v1/reports/org?window=1h", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report internal.OrgReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Departments) != 1 || report.Departments[0].Name != "commerce" || report.Departments[0].Triggers != 1 {
+		t.Fatalf("expected the trigger rolled up to commerce, got %+v", report.Departments)
+	}
+	if teams := report.Departments[0].Teams; len(teams) != 1 || teams[0].Name != "storefront" || teams[0].Deployments == 0 {
+		t.Errorf("unexpected teams %+v", teams)
+	}
+
+	bad := httptest.NewRecorder()
+	server.handleOrgRollup(bad, httptest.NewRequest(http.MethodGet, "/api/v1/reports/org?window=-1h", nil))
+	if bad.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a negative window, got %d", bad.Code)
+	}
+}
+
+func TestBudgetForecastEndpoint(t *testing.T) {
+	server, hub := newTestServer(t)
+	forecast := func(id string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/budgets/"+id+"/forecast", nil)
+		req.SetPathValue("id", id)
+		server.handleBudgetForecast(rr, req)
+		return rr
+	}
+
+	if rr := forecast("cloud"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown budget, got %d", rr.Code)
+	}
+	save := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/budgets/cloud", strings.NewReader(`{"monthly_limit": 0}`))
+	req.SetPathValue("id", "cloud")
+	server.handleSaveBudget(save, req)
+	if save.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a limit, got %d", save.Code)
+	}
+	save = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/budgets/cloud", strings.NewReader(`{"monthly_limit": 500}`))
+	req.SetPathValue("id", "cloud")
+	server.handleSaveBudget(save, req)
+	if save.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", save.Code)
+	}
+	if rr := forecast("cloud"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before any cost data, got %d", rr.Code)
+	}
+
+	push := httptest.NewRecorder()
+	server.handleCostEngine(push, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+	hub.Wait()
+	rr := forecast("cloud")
+	var f internal.BudgetForecast
+	if err := json.Unmarshal(rr.Body.Bytes(), &f); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected a forecast, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if f.ID != "cloud" || f.MonthlyLimit != 500 || f.HourlyCost != 0.24 {
+		t.Errorf("expected the payload's hourly cost projected, got %+v", f)
+	}
+}
+
+func TestCompareClustersReport(t *testing.T) {
+	server, hub := newTestServer(t)
+	hub.Aggregator.ClusterID = "prod-eu"
+	hub.Aggregator.ClusterLabels = internal.ClusterLabels{Provider: "aws", Region: "eu-west-1"}
+	push := httptest.NewRecorder()
+	server.handleCostEngine(push, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+	hub.Wait()
+
+	saveProfile := func(id string, body string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/clusters/"+id+"/profile", strings.NewReader(body))
+		req.SetPathValue("id", id)
+		server.handleSaveClusterProfile(rr, req)
+		return rr.Code
+	}
+	if code := saveProfile("prod-eu", `{"spend": 1}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 storing this hub's own cluster, got %d", code)
+	}
+	peer := `{"labels": {"provider": "gcp"}, "spend": 10, "vcpu_hours": 100, "cost_per_vcpu_hour": 0.1}`
+	if code := saveProfile("gke-us", peer); code != http.StatusCreated {
+		t.Fatalf("expected 201 storing a peer profile, got %d", code)
+	}
+
+	profile := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/clusters/gke-us/profile", nil)
+	req.SetPathValue("id", "gke-us")
+	server.handleClusterProfile(profile, req)
+	var p internal.ClusterProfile
+	if err := json.Unmarshal(profile.Body.Bytes(), &p); err != nil || profile.Code != http.StatusOK {
+		t.Fatalf("expected the stored profile, got %d: %s", profile.Code, profile.Body.String())
+	}
+	if p.Cluster != "gke-us" || p.ReceivedAt == nil {
+		t.Errorf("expected the profile stamped when received, got %+v", p)
+	}
+
+	rr := httptest.NewRecorder()
+	server.handleCompareClusters(rr, httptest.NewRequest(http.MethodGet, "/api/v1/reports/clusters?window=1h&group_by=provider", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report internal.ClusterComparison
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	// the payload reports no node groups, so this hub's cluster has no vCPU-hour price and sorts last
+	if len(report.Clusters) != 2 || report.Clusters[0].Cluster != "gke-us" || report.Clusters[1].Cluster != "prod-eu" {
+		t.Fatalf("expected the priced peer first, got %+v", report.Clusters)
+	}
+	if own := report.Clusters[1]; own.Payloads != 1 || own.Labels.Region != "eu-west-1" || own.Spend <= 0 {
+		t.Errorf("expected this hub's spend profiled, got %+v", own)
+	}
+	if len(report.Groups) != 2 || report.Groups[0].Value != "gcp" || report.Groups[1].Value != "aws" {
+		t.Errorf("expected gcp and aws groups, got %+v", report.Groups)
+	}
+
+	bad := httptest.NewRecorder()
+	server.handleCompareClusters(bad, httptest.NewRequest(http.MethodGet, "/api/v1/reports/clusters?group_by=zone", nil))
+	if bad.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown label, got %d", bad.Code)
+	}
+}
+
+func TestRestoreRequiresSwitch(t *testing.T) {
+	server, hub := newTestServer(t)
+	hub.Redis.Set("cost:latest", "current")
+	server.Client = hub.Aggregator.Client
+
+	snap := httptest.NewRecorder()
+	server.handleSnapshot(snap, httptest.NewRequest(http.MethodGet, "/api/v1/admin/snapshot", nil))
+	if snap.Code != http.StatusOK || snap.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("expected a gzipped snapshot, got %d", snap.Code)
+	}
+	archive := snap.Body.Bytes()
+
+	restore := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.handleRestore(rr, httptest.NewRequest(http.MethodPost, "/api/v1/admin/restore?flush=true", bytes.NewReader(archive)))
+		return rr
+	}
+	if rr := restore(); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without allow_restore, got %d", rr.Code)
+	}
+
+	server.Config.Server.AllowRestore = true
+	if rr := restore(); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	bad := httptest.NewRecorder()
+	server.handleRestore(bad, httptest.NewRequest(http.MethodPost, "/api/v1/admin/restore", strings.NewReader("not gzip")))
+	if bad.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid archive, got %d", bad.Code)
+	}
+	if v, _ := hub.Redis.Get("cost:latest"); v != "current" {
+		t.Errorf("expected cost:latest restored, got %q", v)
+	}
+}
+
+func TestSchemaErrorsMapToStatus(t *testing.T) {
+	server, hub := newTestServer(t)
+	saveSchema := func(body string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/schemas/queue", strings.NewReader(body))
+		req.SetPathValue("name", "queue")
+		server.handleSaveSchema(rr, req)
+		return rr.Code
+	}
+	if code := saveSchema(`{"properties": {"queue_lag": null}}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a null property, got %d", code)
+	}
+	if code := saveSchema(`{"required": ["queue_lag"]}`); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+
+	push := func() int {
+		rr := httptest.NewRecorder()
+		server.handleCostEngine(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewBuffer(costPayload)))
+		return rr.Code
+	}
+	if code := push(); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a schema violation, got %d", code)
+	}
+	hub.Redis.SetError("unavailable")
+	defer hub.Redis.SetError("")
+	if code := push(); code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when schemas can't be read, got %d", code)
+	}
+}
+
+func pushCost(server *APIServer, body []byte) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	server.handleCostEngine(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewReader(body)))
+	return rr
+}
+
+func TestOversizedPushesGet413(t *testing.T) {
+	server, hub := newTestServer(t)
+
+	server.Config.Server.MaxBodyBytes = len(costPayload) - 1
+	if rr := pushCost(server, costPayload); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 over max_body_bytes, got %d", rr.Code)
+	}
+	server.Config.Server.MaxBodyBytes = len(costPayload)
+
+	server.Tenants = tenant.NewLimiter(hub.Aggregator.Client)
+	ctx := context.Background()
+	if err := server.Tenants.SaveQuota(ctx, "default", &tenant.Quota{MaxPayloadBytes: int64(len(costPayload)) - 1}); err != nil {
+		t.Fatal(err)
+	}
+	if rr := pushCost(server, costPayload); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 over the tenant's payload size, got %d", rr.Code)
+	}
+
+	if err := server.Tenants.SaveQuota(ctx, "default", &tenant.Quota{MaxPushesPerMinute: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if rr := pushCost(server, costPayload); rr.Code != http.StatusCreated {
+		t.Fatalf("expected the first push accepted, got %d", rr.Code)
+	}
+	hub.Wait()
+	// a retry is acknowledged without using the quota
+	if rr := pushCost(server, costPayload); rr.Code != http.StatusOK {
+		t.Errorf("expected the retry acknowledged, got %d", rr.Code)
+	}
+	changed := bytes.Replace(costPayload, []byte(`"cpu_cores": 0.06`), []byte(`"cpu_cores": 0.07`), 1)
+	if rr := pushCost(server, changed); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After over the push rate, got %d", rr.Code)
+	}
+	// released when rejected, so it is processed once the window resets
+	if claimed, _ := hub.Aggregator.Client.Keys(ctx, "dedup:cost:*").Result(); len(claimed) != 1 {
+		t.Errorf("expected only the accepted payload claimed, got %v", claimed)
+	}
+
+	// every JSON body is capped, not only pushes
+	server.Config.Server.MaxBodyBytes = 16
+	rr := httptest.NewRecorder()
+	server.handleAlertmanager(rr, httptest.NewRequest(http.MethodPost, "/api/v1/alerts/alertmanager", strings.NewReader(`{"version": "4", "alerts": []}`)))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for an oversized webhook, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/tenants/shop/quota", strings.NewReader(`{"max_pushes_per_minute": 100}`))
+	req.SetPathValue("tenant", "shop")
+	server.handleSaveQuota(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for an oversized quota, got %d", rr.Code)
+	}
+}
+
+func TestTenantsHaveTheirOwnPushRate(t *testing.T) {
+	server, hub := newTestServer(t)
+	server.Tenants = tenant.NewLimiter(hub.Aggregator.Client)
+	ctx := context.Background()
+	if err := server.Tenants.SaveQuota(ctx, "shop", &tenant.Quota{MaxPushesPerMinute: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	shop := bytes.Replace(costPayload, []byte(`"namespace": "default"`), []byte(`"namespace": "shop"`), 1)
+	if rr := pushCost(server, shop); rr.Code != http.StatusCreated {
+		t.Fatalf("expected shop's first push accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+	hub.Wait()
+	shop = bytes.Replace(shop, []byte(`"cpu_cores": 0.06`), []byte(`"cpu_cores": 0.07`), 1)
+	if rr := pushCost(server, shop); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected shop throttled, got %d", rr.Code)
+	}
+	if rr := pushCost(server, costPayload); rr.Code != http.StatusCreated {
+		t.Errorf("expected default, without a quota, accepted, got %d", rr.Code)
+	}
+	hub.Wait()
+}
+
+func TestDuplicateDeltaRefundsPush(t *testing.T) {
+	server, hub := newTestServer(t)
+	server.Tenants = tenant.NewLimiter(hub.Aggregator.Client)
+	ctx := context.Background()
+	if rr := pushCost(server, costPayload); rr.Code != http.StatusCreated {
+		t.Fatalf("expected the full payload accepted, got %d", rr.Code)
+	}
+	hub.Wait()
+	if err := server.Tenants.SaveQuota(ctx, "default", &tenant.Quota{MaxPushesPerMinute: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	delta := []byte(`{"timestamp": "2025-12-22T14:05:43Z", "namespace": "default", "sequence": 1,
+  "deployments": [{"name": "loadgenerator", "current_requests": {"cpu_cores": 0.3, "memory_mb": 750}, "current_usage": {"cpu_cores": 0.05, "memory_mb": 40}}]}`)
+	next := bytes.Replace(delta, []byte(`"sequence": 1`), []byte(`"sequence": 2`), 1)
+	// the retry of the first delta gives its push back, so the next one fits
+	for i, body := range [][]byte{delta, delta, next} {
+		want := http.StatusCreated
+		if i == 1 {
+			want = http.StatusOK
+		}
+		rr := httptest.NewRecorder()
+		server.handleCostDelta(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost/delta", bytes.NewReader(body)))
+		if rr.Code != want {
+			t.Errorf("delta push %d: expected %d, got %d %s", i+1, want, rr.Code, rr.Body.String())
+		}
+		hub.Wait()
+	}
+}
+
+// saves always fail, everything else goes to the real aggregator
+type failingSaveAggregator struct {
+	*internal.Aggregator
+}
+
+func (failingSaveAggregator) SaveCostPayload(ctx context.Context, p *internal.CostPayload) error {
+	return errors.New("unavailable")
+}
+
+func TestDuplicatePushesAreAcknowledged(t *testing.T) {
+	server, hub := newTestServer(t)
+	push := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.handleCostEngine(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewReader(costPayload)))
+		hub.Wait()
+		return rr
+	}
+
+	if rr := push(); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rr.Code)
+	}
+	hub.ClearJobs()
+	hub.FastForward(time.Minute)
+	if rr := push(); rr.Code != http.StatusOK || rr.Body.String() != "Payload already processed" {
+		t.Errorf("expected the retry inside the window acknowledged, got %d %q", rr.Code, rr.Body.String())
+	}
+	if events := hub.Events(internal.EventCostPayload); len(events) != 1 {
+		t.Errorf("expected the payload saved once, got %d", len(events))
+	}
+	hub.AssertJobCount(0)
+
+	// past the window the same payload is a new push
+	hub.FastForward(internal.DedupWindow)
+	if rr := push(); rr.Code != http.StatusCreated {
+		t.Errorf("expected 201 once the window has passed, got %d", rr.Code)
+	}
+}
+
+func TestFailedSaveReleasesDedupClaim(t *testing.T) {
+	server, hub := newTestServer(t)
+	server.Aggregator = failingSaveAggregator{hub.Aggregator}
+	push := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.handleCostEngine(rr, httptest.NewRequest(http.MethodPost, "/api/v1/metrics/cost", bytes.NewReader(costPayload)))
+		hub.Wait()
+		return rr
+	}
+
+	if rr := push(); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+	server.Aggregator = hub.Aggregator
+	if rr := push(); rr.Code != http.StatusCreated {
+		t.Errorf("expected the producer's retry accepted, got %d %q", rr.Code, rr.Body.String())
+	}
 }
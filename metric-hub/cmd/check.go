@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/config"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/gate"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/ingest"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/redis/go-redis/v9"
+)
+
+// every check shares one deadline
+const checkTimeout = 30 * time.Second
+
+type checkResult struct {
+	Name   string
+	OK     bool
+	Skip   bool
+	Detail string
+}
+
+func pass(name string, detail string) checkResult {
+	return checkResult{Name: name, OK: true, Detail: detail}
+}
+
+func fail(name string, err error) checkResult {
+	return checkResult{Name: name, Detail: err.Error()}
+}
+
+func skip(name string, detail string) checkResult {
+	return checkResult{Name: name, OK: true, Skip: true, Detail: detail}
+}
+
+// metric-hub check [-config file] [-notify=false]
+// exits non-zero when any check fails, so it can run as an init container or CI step
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file, environment variables are used when empty")
+	sendTest := fs.Bool("notify", true, "send a test message to every notification sink")
+	fs.Parse(args)
+
+	source := "environment"
+	if *path != "" {
+		source = *path
+	}
+	cfg, err := loadConfig(*path)
+	if err != nil {
+		printReport(os.Stdout, []checkResult{fail("config", err)})
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	results := []checkResult{pass("config", "loaded from "+source)}
+	results = append(results, runChecks(ctx, cfg, *sendTest)...)
+	if !printReport(os.Stdout, results) {
+		return 1
+	}
+	return 0
+}
+
+func runChecks(ctx context.Context, cfg *config.Config, sendTest bool) []checkResult {
+	client := redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password})
+	defer client.Close()
+
+	results := []checkResult{checkRedis(ctx, "redis", client, cfg.Redis.Addr)}
+	if results[0].OK {
+		results = append(results, checkQueue(ctx, client))
+	} else {
+		results = append(results, skip("queue", "redis unreachable"))
+	}
+	if cfg.Redis.ReplicaAddr != "" {
+		replica := redis.NewClient(&redis.Options{Addr: cfg.Redis.ReplicaAddr, Password: cfg.Redis.Password})
+		defer replica.Close()
+		results = append(results, checkRedis(ctx, "redis replica", replica, cfg.Redis.ReplicaAddr))
+	}
+	if cfg.Queue.Gate.URL != "" {
+		results = append(results, checkGate(ctx, gate.NewOPAGate(cfg.Queue.Gate.URL, cfg.Queue.Gate.Timeout.Std())))
+	}
+	for _, a := range ingestAdapters(cfg) {
+		if p, ok := a.adapter.(ingest.Poller); ok {
+			results = append(results, checkPoll(ctx, p))
+		}
+	}
+	for _, s := range notificationSinks(cfg.Notifications) {
+		results = append(results, checkSink(ctx, s, sendTest))
+	}
+	return results
+}
+
+func checkRedis(ctx context.Context, name string, client *redis.Client, addr string) checkResult {
+	if err := client.Ping(ctx).Err(); err != nil {
+		return fail(name, fmt.Errorf("PING %s: %w", addr, err))
+	}
+	detail := addr + " PONG"
+	// INFO may be blocked by ACLs, the version is informational only
+	if info, err := client.Info(ctx, "server").Result(); err == nil {
+		for _, line := range strings.Split(info, "\n") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(line), "redis_version:"); ok {
+				detail += ", redis " + v
+			}
+		}
+	}
+	return pass(name, detail)
+}
+
+// push and pop a probe in one transaction, consumers never see it
+// fails with NOPERM when the hub's user may not write the queue
+func checkQueue(ctx context.Context, client *redis.Client) checkResult {
+	probe := fmt.Sprintf("metric-hub-check-%d", time.Now().UnixNano())
+	var popped *redis.StringCmd
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, internal.AgentQueueKey, probe)
+		popped = pipe.LPop(ctx, internal.AgentQueueKey)
+		return nil
+	})
+	if err != nil {
+		return fail("queue", fmt.Errorf("LPUSH/LPOP %s: %w", internal.AgentQueueKey, err))
+	}
+	if popped.Val() != probe {
+		return fail("queue", fmt.Errorf("probe not returned from %s", internal.AgentQueueKey))
+	}
+
+	depth, err := client.LLen(ctx, internal.AgentQueueKey).Result()
+	if err != nil {
+		return fail("queue", fmt.Errorf("LLEN %s: %w", internal.AgentQueueKey, err))
+	}
+	return pass("queue", fmt.Sprintf("%s writable, %d jobs waiting", internal.AgentQueueKey, depth))
+}
+
+// only reachability is checked, a deny for the probe job is fine
+func checkGate(ctx context.Context, g gate.Gate) checkResult {
+	probe := internal.AgentJob{TargetType: internal.TargetCluster, Reason: "metric-hub check"}
+	if _, err := g.Check(ctx, probe); err != nil {
+		return fail("gate", err)
+	}
+	return pass("gate", "policy answered")
+}
+
+// the polled payload is discarded, a source without complete deployments yet still answered
+// subscriptions are not opened
+func checkPoll(ctx context.Context, p ingest.Poller) checkResult {
+	name := "pull/" + p.Name()
+	payload, err := p.Poll(ctx)
+	if errors.Is(err, internal.ErrNoDeploymentSeries) {
+		return pass(name, "reachable, no deployment reports its usage yet")
+	} else if err != nil {
+		return fail(name, err)
+	}
+	return pass(name, fmt.Sprintf("%d deployments", len(payload.Deployments)))
+}
+
+// routes are bypassed so every sink gets the test message
+func checkSink(ctx context.Context, s sink, sendTest bool) checkResult {
+	name := "notify/" + s.name
+	if !sendTest {
+		return skip(name, "test message disabled")
+	}
+	if s.name == "pagerduty" {
+		// only critical notifications open incidents, a test would page on-call
+		return skip(name, "not tested, a test incident would page on-call")
+	}
+
+	err := s.notifier.Notify(ctx, notify.Notification{
+		Severity:  notify.SeverityInfo,
+		Title:     "metric-hub check",
+		Message:   "Test notification from metric-hub check, no action needed.",
+		Timestamp: time.Now().UTC(),
+	})
+	if err != nil {
+		return fail(name, err)
+	}
+	return pass(name, "test message sent")
+}
+
+// print one line per check, false when any check failed
+func printReport(w io.Writer, results []checkResult) bool {
+	ok := true
+	for _, r := range results {
+		status := "ok"
+		switch {
+		case !r.OK:
+			status = "FAIL"
+			ok = false
+		case r.Skip:
+			status = "skip"
+		}
+		fmt.Fprintf(w, "[%-4s] %-16s %s\n", status, r.Name, r.Detail)
+	}
+	if ok {
+		fmt.Fprintln(w, "all checks passed")
+	} else {
+		fmt.Fprintln(w, "some checks failed")
+	}
+	return ok
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+)
+
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	return errors.New("webhook returned 403 Forbidden")
+}
+
+type countingNotifier struct{ sent int }
+
+func (c *countingNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	c.sent++
+	return nil
+}
+
+func TestCheckSinkBypassesRoute(t *testing.T) {
+	n := &countingNotifier{}
+	route := &notify.Route{MinSeverity: notify.SeverityCritical}
+
+	if r := checkSink(context.Background(), sink{"slack", n, route}, true); !r.OK || n.sent != 1 {
+		t.Errorf("expected the test message to be sent, got %+v and %d sent", r, n.sent)
+	}
+	if r := checkSink(context.Background(), sink{"teams", failingNotifier{}, nil}, true); r.OK || !strings.Contains(r.Detail, "403") {
+		t.Errorf("expected a failed check, got %+v", r)
+	}
+	if r := checkSink(context.Background(), sink{"discord", n, nil}, false); !r.Skip || n.sent != 1 {
+		t.Errorf("expected the check to be skipped, got %+v", r)
+	}
+}
+
+func TestPrintReport(t *testing.T) {
+	var buf bytes.Buffer
+	ok := printReport(&buf, []checkResult{
+		pass("redis", "redis:6379 PONG"),
+		skip("notify/pagerduty", "not tested"),
+	})
+	if !ok || !strings.Contains(buf.String(), "[ok  ] redis") || !strings.Contains(buf.String(), "all checks passed") {
+		t.Errorf("expected a passing report, got %q", buf.String())
+	}
+
+	buf.Reset()
+	if printReport(&buf, []checkResult{fail("queue", errors.New("NOPERM"))}) {
+		t.Errorf("expected a failing report")
+	}
+	if !strings.Contains(buf.String(), "[FAIL] queue") {
+		t.Errorf("expected the failure in the report, got %q", buf.String())
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/analytics"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/azuremonitor"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/cloudwatch"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/config"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/datadog"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/ingest"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/kube"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+)
+
+// a configured notification sink, route is nil for sinks that receive everything
+type sink struct {
+	name     string
+	notifier notify.Notifier
+	route    *notify.Route
+}
+
+func notificationSinks(cfg config.Notifications) []sink {
+	timeout := cfg.Timeout.Std()
+	var sinks []sink
+	if cfg.Slack.WebhookURL != "" {
+		n := notify.NewSlackNotifier(cfg.Slack.WebhookURL)
+		n.Client.Timeout = timeout
+		sinks = append(sinks, sink{"slack", n, cfg.Slack.Route})
+	}
+	if cfg.Teams.WebhookURL != "" {
+		n := notify.NewTeamsNotifier(cfg.Teams.WebhookURL)
+		n.Client.Timeout = timeout
+		sinks = append(sinks, sink{"teams", n, cfg.Teams.Route})
+	}
+	if cfg.Discord.WebhookURL != "" {
+		n := notify.NewDiscordNotifier(cfg.Discord.WebhookURL)
+		n.Client.Timeout = timeout
+		sinks = append(sinks, sink{"discord", n, cfg.Discord.Route})
+	}
+	if cfg.PagerDuty.RoutingKey != "" {
+		n := notify.NewPagerDutyNotifier(cfg.PagerDuty.RoutingKey)
+		n.Client.Timeout = timeout
+		sinks = append(sinks, sink{"pagerduty", n, nil})
+	}
+	if cfg.SMTP.Addr != "" {
+		n := notify.NewSMTPNotifier(cfg.SMTP.Addr, cfg.SMTP.From, cfg.SMTP.To)
+		n.Timeout = timeout
+		n.Username = cfg.SMTP.Username
+		n.Password = cfg.SMTP.Password
+		n.Routes = cfg.SMTP.Routes
+		sinks = append(sinks, sink{"smtp", n, nil})
+	}
+	return sinks
+}
+
+// warehouses with a url or project, none by default
+func analyticsSinks(cfg config.Analytics) []analytics.Sink {
+	timeout := cfg.Timeout.Std()
+	var sinks []analytics.Sink
+	if cfg.ClickHouse.URL != "" {
+		c := analytics.NewClickHouse(cfg.ClickHouse.URL, cfg.ClickHouse.Database, timeout)
+		c.Username = cfg.ClickHouse.Username
+		c.Password = cfg.ClickHouse.Password
+		sinks = append(sinks, c)
+	}
+	if cfg.BigQuery.Project != "" {
+		sinks = append(sinks, analytics.NewBigQuery(cfg.BigQuery.Project, cfg.BigQuery.Dataset, timeout))
+	}
+	return sinks
+}
+
+// an input adapter and how often it is polled, subscriptions ignore the interval
+type ingestAdapter struct {
+	adapter  ingest.Adapter
+	interval time.Duration
+}
+
+// input adapters enabled in the config, none by default
+func ingestAdapters(cfg *config.Config) []ingestAdapter {
+	var adapters []ingestAdapter
+	if dd := cfg.Datadog; dd.APIKey != "" && dd.AppKey != "" {
+		client := datadog.NewClient(dd.Site, dd.APIKey, dd.AppKey, dd.Timeout.Std())
+		adapters = append(adapters, ingestAdapter{internal.NewDatadogPuller(client, dd.Mapping, dd.Interval.Std()), dd.Interval.Std()})
+	}
+	if cw := cfg.CloudWatch; cw.Cluster != "" {
+		client := cloudwatch.NewClient(cw.Region, cw.Timeout.Std())
+		adapters = append(adapters, ingestAdapter{internal.NewCloudWatchPuller(client, cw.Cluster, cw.Namespace, cw.HourlyCostPerNode), cw.Interval.Std()})
+	}
+	if az := cfg.AzureMonitor; az.WorkspaceID != "" {
+		client := azuremonitor.NewClient(az.WorkspaceID, az.TenantID, az.ClientID, az.ClientSecret, az.Timeout.Std())
+		adapters = append(adapters, ingestAdapter{internal.NewAzureMonitorPuller(client, az.Cluster, az.Namespace, az.HourlyCostPerNode), az.Interval.Std()})
+	}
+	return adapters
+}
+
+// queues jobs are published to besides the Redis agent queue, none by default
+func queueSinks(cfg config.QueueSinks) []queue.Sink {
+	var sinks []queue.Sink
+	if cfg.Kafka.URL != "" {
+		k := queue.NewKafkaQueue(cfg.Kafka.URL, cfg.Kafka.Topic, cfg.Kafka.Timeout.Std())
+		sinks = append(sinks, queue.Sink{Name: "kafka", Client: k, Required: cfg.Kafka.Required})
+	}
+	return sinks
+}
+
+// stdout plus every configured sink
+func newNotifier(cfg config.Notifications) notify.Multi {
+	notifier := notify.Multi{notify.NewLogNotifier()}
+	for _, s := range notificationSinks(cfg) {
+		if s.route != nil {
+			notifier = append(notifier, notify.Routed{Route: *s.route, Notifier: s.notifier})
+		} else {
+			notifier = append(notifier, s.notifier)
+		}
+	}
+	return notifier
+}
+
+// configured sinks by name for routing rules, without their own routes
+func notificationChannels(cfg config.Notifications) map[string]notify.Notifier {
+	channels := map[string]notify.Notifier{}
+	for _, s := range notificationSinks(cfg) {
+		channels[s.name] = s.notifier
+	}
+	return channels
+}
+
+// nil when no ConfigMap or Secret is configured or the hub is outside a cluster
+func policyWatcher(src config.PolicySource) *kube.ConfigWatcher {
+	kind, ref := kube.KindConfigMap, src.ConfigMap
+	if ref == "" {
+		kind, ref = kube.KindSecret, src.Secret
+	}
+	if ref == "" {
+		return nil
+	}
+
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		fmt.Printf("Invalid policy %s %q, expected <namespace>/<name>\n", kind, ref)
+		return nil
+	}
+
+	client, err := kube.InClusterClient()
+	if err != nil {
+		fmt.Printf("Policy %s watch disabled: %v\n", kind, err)
+		return nil
+	}
+	return kube.NewConfigWatcher(client, kind, namespace, name, src.Key)
+}
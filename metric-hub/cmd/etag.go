@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Write v as JSON tagged with a hash of the body, projected to ?fields= when given
+// a client sending the same tag in If-None-Match gets 304 and no body
+func writeConditionalJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		tree, err := parseFields(raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid fields: %v", err), http.StatusBadRequest)
+			return
+		}
+		if v, err = projectFields(v, tree); err != nil {
+			fmt.Printf("Failed to encode response %v\n", err)
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		fmt.Printf("Failed to encode response %v\n", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	writeConditional(w, r, "application/json", append(body, '\n'))
+}
+
+func writeConditional(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	// caches may keep the document but must revalidate before using it
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// If-None-Match is a list of tags or *, compared weakly as RFC 9110 requires for GET
+func etagMatches(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
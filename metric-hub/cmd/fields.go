@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Fields kept by ?fields=, nested fields are dotted e.g. deployments.name
+// a nil subtree keeps the whole value
+type fieldTree map[string]fieldTree
+
+func parseFields(raw string) (fieldTree, error) {
+	tree := fieldTree{}
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		node := tree
+		parts := strings.Split(field, ".")
+		for i, part := range parts {
+			if part == "" {
+				return nil, fmt.Errorf("invalid field %q", field)
+			}
+			sub, seen := node[part]
+			if i == len(parts)-1 {
+				node[part] = nil
+				break
+			}
+			if seen && sub == nil {
+				// the parent was already selected as a whole
+				break
+			}
+			if !seen {
+				sub = fieldTree{}
+				node[part] = sub
+			}
+			node = sub
+		}
+	}
+	if len(tree) == 0 {
+		return nil, fmt.Errorf("no fields selected")
+	}
+	return tree, nil
+}
+
+// Keep only the selected fields of v's JSON form, lists are projected element by element
+// unknown fields are left out rather than rejected, documents differ in which fields they carry
+func projectFields(v interface{}, tree fieldTree) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return project(doc, tree), nil
+}
+
+func project(doc interface{}, tree fieldTree) interface{} {
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(tree))
+		for name, sub := range tree {
+			value, ok := d[name]
+			if !ok {
+				continue
+			}
+			if sub == nil {
+				out[name] = value
+			} else {
+				out[name] = project(value, sub)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(d))
+		for i, item := range d {
+			out[i] = project(item, tree)
+		}
+		return out
+	default:
+		return doc
+	}
+}
@@ -0,0 +1,203 @@
+// loadgen pushes synthetic cost payloads at a running hub and reports latency and status codes
+//
+//	go run ./metric-hub/cmd/loadgen -url http://localhost:8008 -deployments 200 -rate 5 -duration 1m
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+// usage profile of a synthetic deployment
+type profile struct {
+	name     string
+	requests internal.Resources
+	// fraction of the request used at the daily peak
+	peak float64
+	// hour of the daily peak
+	peakHour float64
+}
+
+// a quarter of deployments waste most of their request, a tenth run close to it
+func newProfiles(rng *rand.Rand, ns string, n int) []profile {
+	profiles := make([]profile, n)
+	for i := range profiles {
+		peak := 0.4 + rng.Float64()*0.4
+		switch r := rng.Float64(); {
+		case r < 0.25:
+			peak = 0.1 + rng.Float64()*0.2
+		case r < 0.35:
+			peak = 0.85 + rng.Float64()*0.2
+		}
+		profiles[i] = profile{
+			name: fmt.Sprintf("%s-svc-%03d", ns, i),
+			requests: internal.Resources{
+				CPUCores: float64(1+rng.Intn(40)) * 0.05,
+				MemoryMB: float64(int(1) << (7 + rng.Intn(6))),
+			},
+			peak:     peak,
+			peakHour: float64(rng.Intn(24)),
+		}
+	}
+	return profiles
+}
+
+// usage at t, a daily sine around the peak plus noise
+func (p profile) usage(rng *rand.Rand, t time.Time) internal.Resources {
+	hour := float64(t.Hour()) + float64(t.Minute())/60
+	daily := 0.6 + 0.4*math.Cos((hour-p.peakHour)/24*2*math.Pi)
+	noise := 1 + (rng.Float64()-0.5)*0.1
+	return internal.Resources{
+		CPUCores: p.requests.CPUCores * p.peak * daily * noise,
+		MemoryMB: p.requests.MemoryMB * p.peak * (0.8 + 0.2*daily) * noise,
+	}
+}
+
+func payload(rng *rand.Rand, ns string, profiles []profile, t time.Time) *internal.CostPayload {
+	p := &internal.CostPayload{
+		Source:      "loadgen",
+		Timestamp:   t.UTC(),
+		Namespace:   ns,
+		ClusterInfo: internal.ClusterInfo{VmCount: 3, Cost: 0.12 * 3},
+	}
+	for _, prof := range profiles {
+		p.Deployments = append(p.Deployments, internal.CostDeployment{
+			Name:            prof.name,
+			CurrentRequests: prof.requests,
+			CurrentUsage:    prof.usage(rng, t),
+		})
+	}
+	return p
+}
+
+type result struct {
+	status  int
+	latency time.Duration
+	err     error
+}
+
+func main() {
+	url := flag.String("url", "http://localhost:8008", "hub base url")
+	namespaces := flag.Int("namespaces", 1, "namespaces, the first is default and the rest loadgen-<n>")
+	deployments := flag.Int("deployments", 50, "deployments per namespace")
+	rate := flag.Float64("rate", 1, "payloads per second across all namespaces")
+	duration := flag.Duration("duration", 30*time.Second, "how long to push for")
+	seed := flag.Int64("seed", 1, "random seed, the same seed produces the same deployments")
+	flag.Parse()
+
+	if *namespaces < 1 || *deployments < 1 || *rate <= 0 {
+		log.Fatal("namespaces, deployments and rate must be positive")
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	names := make([]string, *namespaces)
+	profiles := make([][]profile, *namespaces)
+	for i := range names {
+		names[i] = "default"
+		if i > 0 {
+			names[i] = fmt.Sprintf("loadgen-%d", i)
+		}
+		profiles[i] = newProfiles(rng, names[i], *deployments)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	endpoint := *url + "/api/v1/metrics/cost"
+	results := make(chan result, 1024)
+	var wg sync.WaitGroup
+
+	fmt.Printf("Pushing %d deployments in %d namespaces at %.2f/s for %v\n", *deployments, *namespaces, *rate, *duration)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+	deadline := time.After(*duration)
+	var collected []result
+	done := make(chan struct{})
+	go func() {
+		for r := range results {
+			collected = append(collected, r)
+		}
+		close(done)
+	}()
+
+	start := time.Now()
+	sent := 0
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+		case now := <-ticker.C:
+			i := sent % len(names)
+			body, err := json.Marshal(payload(rng, names[i], profiles[i], now))
+			if err != nil {
+				log.Fatal(err)
+			}
+			sent++
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				t := time.Now()
+				resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+				r := result{latency: time.Since(t), err: err}
+				if err == nil {
+					r.status = resp.StatusCode
+					resp.Body.Close()
+				}
+				results <- r
+			}()
+		}
+	}
+	ticker.Stop()
+	wg.Wait()
+	close(results)
+	<-done
+
+	report(collected, time.Since(start))
+}
+
+func report(results []result, elapsed time.Duration) {
+	statuses := map[int]int{}
+	errors := 0
+	latencies := make([]time.Duration, 0, len(results))
+	for _, r := range results {
+		if r.err != nil {
+			errors++
+			continue
+		}
+		statuses[r.status]++
+		latencies = append(latencies, r.latency)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Printf("\n%d requests in %v (%.2f/s), %d errors\n", len(results), elapsed.Round(time.Millisecond), float64(len(results))/elapsed.Seconds(), errors)
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Printf("  %d: %d\n", code, statuses[code])
+	}
+	if len(latencies) > 0 {
+		fmt.Printf("latency p50 %v  p95 %v  p99 %v  max %v\n",
+			percentile(latencies, 0.5), percentile(latencies, 0.95), percentile(latencies, 0.99), latencies[len(latencies)-1])
+	}
+}
+
+// nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank].Round(time.Microsecond)
+}
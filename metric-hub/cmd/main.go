@@ -1,14 +1,45 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/config"
 )
 
 func main() {
-	server := NewAPIServer()
-	log.Println("Starting server on port 8008")
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:]))
+	}
+
+	path := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML config file, environment variables are used when empty")
+	flag.Parse()
+
+	cfg, err := loadConfig(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := NewAPIServer(cfg)
+	log.Printf("Starting server on port %d", cfg.Server.Port)
 
 	if err := server.Start(); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// validated configuration from the file, or from the environment without one
+func loadConfig(path string) (*config.Config, error) {
+	cfg := config.FromEnv()
+	if path != "" {
+		var err error
+		if cfg, err = config.Load(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
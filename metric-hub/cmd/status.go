@@ -0,0 +1,65 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+// read-only page for team dashboards, it only calls /status.json
+//
+//go:embed status.html
+var statusPage []byte
+
+// status routes, on the API mux or a mux of their own
+func (s *APIServer) statusRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /status", s.handleStatusPage)
+	mux.HandleFunc("GET /status.json", s.handlePublicStatus)
+}
+
+// serve the status page alone when it has a port of its own, the API stays unreachable from it
+func (s *APIServer) startStatusPage() {
+	cfg := s.Config.Server.StatusPage
+	if !cfg.Enabled || cfg.Port == 0 {
+		return
+	}
+
+	mux := http.NewServeMux()
+	s.statusRoutes(mux)
+
+	fmt.Printf("Starting status page on port %d\n", cfg.Port)
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), mux); err != nil {
+		fmt.Printf("Status page server stopped %v\n", err)
+	}
+}
+
+// handler function for GET /status
+func (s *APIServer) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(statusPage)
+}
+
+// handler function for GET /status.json
+func (s *APIServer) handlePublicStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := s.Aggregator.PublicStatus(r.Context())
+	if errors.Is(err, internal.ErrNoCostData) {
+		http.Error(w, "No cost data yet", http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Aggregator error %v\n", err)
+		http.Error(w, "Failed to build status", http.StatusInternalServerError)
+		return
+	}
+
+	report, err := s.Savings.Report(r.Context())
+	if err != nil {
+		fmt.Printf("Savings tracker error %v\n", err)
+		http.Error(w, "Failed to build status", http.StatusInternalServerError)
+		return
+	}
+	status.MonthlySavings = report.MonthlyRunRate()
+	writeConditionalJSON(w, r, status)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// single page console, every panel is read from and saved through the JSON API
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// serves the console under /ui/
+func uiHandler() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(files)))
+}
+
+// what the console needs to know before calling the API
+type uiConfig struct {
+	ClusterID string `json:"cluster_id"`
+}
+
+// handler function for GET /ui/config.json
+func (s *APIServer) handleUIConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, uiConfig{ClusterID: s.clusterID()})
+}
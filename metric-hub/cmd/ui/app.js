@@ -0,0 +1,196 @@
+// Metric Hub console, every panel is read from the hub's JSON API
+// paths are relative so the console works behind a path prefix
+const api = "../api/v1";
+const refreshMs = 30000;
+const feedTypes = ["job_published", "job_denied"];
+
+let clusterID = "default";
+
+function el(tag, text, className) {
+  const node = document.createElement(tag);
+  if (text !== undefined) node.textContent = text;
+  if (className) node.className = className;
+  return node;
+}
+
+function row(cells) {
+  const tr = el("tr");
+  for (const cell of cells) {
+    const td = el("td");
+    if (cell instanceof Node) td.appendChild(cell);
+    else td.textContent = cell;
+    tr.appendChild(td);
+  }
+  return tr;
+}
+
+function fill(id, rows, columns, emptyText) {
+  const body = document.getElementById(id);
+  body.replaceChildren();
+  if (rows.length === 0) {
+    const td = el("td", emptyText, "empty");
+    td.colSpan = columns;
+    body.appendChild(el("tr")).appendChild(td);
+    return;
+  }
+  rows.forEach((r) => body.appendChild(r));
+}
+
+const money = (v) => "$" + (v || 0).toFixed(3);
+const percent = (v) => Math.round((v || 0) * 100) + "%";
+const time = (v) => new Date(v).toLocaleString();
+
+async function getJSON(path) {
+  const res = await fetch(path);
+  if (res.status === 404) return null;
+  if (!res.ok) throw new Error(`${path}: ${res.status} ${await res.text()}`);
+  return res.json();
+}
+
+function jobTarget(job) {
+  if (job.deployments) return `${job.namespace}/${job.deployments.name}`;
+  if (job.node_group) return `node group ${job.node_group.name}`;
+  return job.namespace || job.target_type;
+}
+
+async function loadSummary() {
+  const summary = await getJSON(`${api}/clusters/${encodeURIComponent(clusterID)}/summary`);
+  const cards = document.getElementById("summary-cards");
+  cards.replaceChildren();
+  document.querySelector("#summary .empty").hidden = summary !== null;
+  if (!summary) {
+    fill("waste-rows", [], 5, "No deployments reported.");
+    return;
+  }
+
+  const values = [
+    ["Hourly cost", money(summary.cluster_info.current_hourly_cost)],
+    ["Wasted / hour", money(summary.wasted_hourly_cost)],
+    ["Nodes", summary.cluster_info.vm_count],
+    ["Deployments", summary.deployments],
+    ["Active triggers", summary.active_triggers],
+    ["CPU used", percent(summary.utilisation.cpu_cores)],
+    ["Memory used", percent(summary.utilisation.memory_mb)],
+  ];
+  for (const [label, value] of values) {
+    const card = el("div", undefined, "card");
+    card.appendChild(el("div", String(value), "value"));
+    card.appendChild(el("div", label, "label"));
+    cards.appendChild(card);
+  }
+
+  const offenders = summary.top_offenders || [];
+  fill("waste-rows", offenders.map((o) => row([
+    o.name,
+    money(o.hourly_cost),
+    money(o.wasted_hourly_cost),
+    percent(o.utilisation.cpu_cores),
+    percent(o.utilisation.memory_mb),
+  ])), 5, "No waste found.");
+}
+
+async function loadBudgets() {
+  const budgets = (await getJSON(`${api}/budgets`)) || [];
+  const forecasts = await Promise.all(budgets.map((b) => getJSON(`${api}/budgets/${encodeURIComponent(b.id)}/forecast`)));
+  fill("budget-rows", budgets.map((b, i) => {
+    const f = forecasts[i];
+    if (!f) return row([b.id, money(b.monthly_limit), "", "", "no cost data"]);
+    const tr = row([
+      b.id,
+      money(b.monthly_limit),
+      money(f.month_to_date),
+      `${money(f.projected_month_end)} (${percent(f.projected_fraction)})`,
+      f.breach_at ? time(f.breach_at) : "not this month",
+    ]);
+    if (f.breach_at) tr.className = "denied";
+    return tr;
+  }), 5, "No budgets set.");
+}
+
+async function loadTriggers() {
+  const since = new Date(Date.now() - 24 * 3600 * 1000).toISOString();
+  const events = (await getJSON(`${api}/admin/events?from=${encodeURIComponent(since)}&limit=500`)) || [];
+  const jobs = events.filter((e) => feedTypes.includes(e.type)).reverse();
+
+  fill("trigger-rows", jobs.slice(0, 50).map((e) => {
+    const denied = e.type === "job_denied";
+    const job = denied ? e.data.job : e.data;
+    const tr = row([
+      time(e.time),
+      denied ? "denied" : "published",
+      jobTarget(job),
+      job.reason,
+      denied ? e.data.reasons.join("; ") : job.action,
+    ]);
+    if (denied) tr.className = "denied";
+    return tr;
+  }), 5, "No jobs in the last 24 hours.");
+
+  // routed jobs needing a reviewer, the agent's PR carries the approval note
+  const pending = jobs.filter((e) => e.type === "job_published" && e.data.routing && e.data.routing.approval === "manual");
+  fill("approval-rows", pending.map((e) => row([
+    time(e.time),
+    jobTarget(e.data),
+    e.data.reason,
+    e.data.routing.rule,
+    (e.data.ownership && e.data.ownership.team) || "",
+  ])), 5, "Nothing awaiting approval.");
+}
+
+async function loadReviews() {
+  const reviews = (await getJSON(`${api}/reviews`)) || [];
+  fill("review-rows", reviews.map((r) => {
+    const resolve = el("button", "Resolve", "secondary");
+    resolve.onclick = async () => {
+      const path = `${api}/reviews/${encodeURIComponent(r.namespace)}/${encodeURIComponent(r.deployment)}`;
+      await fetch(path, { method: "DELETE" });
+      loadReviews();
+    };
+    return row([`${r.namespace}/${r.deployment}`, r.last_outcome, r.reports, time(r.hold_until), resolve]);
+  }), 5, "No rolled back changes.");
+}
+
+async function loadPolicy() {
+  const policy = await getJSON(`${api}/policy`);
+  document.getElementById("policy-doc").value = JSON.stringify(policy, null, 2);
+  document.getElementById("policy-status").textContent = "";
+}
+
+async function savePolicy() {
+  const status = document.getElementById("policy-status");
+  let body;
+  try {
+    body = JSON.stringify(JSON.parse(document.getElementById("policy-doc").value));
+  } catch (e) {
+    status.textContent = `Invalid JSON: ${e.message}`;
+    return;
+  }
+  const res = await fetch(`${api}/policy`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body,
+  });
+  status.textContent = res.ok ? "Saved" : `Not saved: ${await res.text()}`;
+}
+
+async function refresh() {
+  const results = await Promise.allSettled([loadSummary(), loadBudgets(), loadTriggers(), loadReviews()]);
+  for (const r of results) {
+    if (r.status === "rejected") console.error(r.reason);
+  }
+  document.getElementById("updated").textContent = `Updated ${new Date().toLocaleTimeString()}`;
+}
+
+async function start() {
+  const config = await getJSON("config.json");
+  if (config) clusterID = config.cluster_id;
+  document.getElementById("cluster").textContent = clusterID;
+  document.getElementById("policy-save").onclick = savePolicy;
+  document.getElementById("policy-reload").onclick = loadPolicy;
+
+  // the policy is only loaded on demand so a refresh never overwrites an edit
+  await Promise.all([refresh(), loadPolicy()]);
+  setInterval(refresh, refreshMs);
+}
+
+start();
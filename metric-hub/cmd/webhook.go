@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/admission"
+)
+
+// Serve admission webhooks over TLS when a certificate is configured
+// the API server only calls webhooks over https
+func (s *APIServer) startWebhooks() {
+	cert := s.Config.Server.WebhookTLSCert
+	key := s.Config.Server.WebhookTLSKey
+	if cert == "" || key == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /admission/validate", admission.NewValidator(s.Aggregator))
+	mux.Handle("POST /admission/mutate", admission.NewMutator(s.Aggregator))
+
+	port := s.Config.Server.WebhookPort
+	fmt.Printf("Starting admission webhooks on port %d\n", port)
+	if err := http.ListenAndServeTLS(fmt.Sprintf(":%d", port), cert, key, mux); err != nil {
+		fmt.Printf("Admission webhook server stopped %v\n", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Package admission serves Kubernetes admission webhooks for Deployments
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Requests summed over every container in the pod template
+type Requests struct {
+	CPUCores float64 `json:"cpu_cores"`
+	MemoryMB float64 `json:"memory_mb"`
+}
+
+// Decides whether a deployment's requests are acceptable
+// returns the rejection reason, "" to allow
+type Checker interface {
+	CheckRequests(ctx context.Context, namespace string, name string, req Requests) (string, error)
+}
+
+// Sum container requests in a pod template, init containers are ignored
+func PodRequests(spec corev1.PodSpec) Requests {
+	var r Requests
+	for _, c := range spec.Containers {
+		if cpu, ok := c.Resources.Requests[corev1.ResourceCPU]; ok {
+			r.CPUCores += cpu.AsApproximateFloat64()
+		}
+		if mem, ok := c.Resources.Requests[corev1.ResourceMemory]; ok {
+			r.MemoryMB += mem.AsApproximateFloat64() / (1024 * 1024)
+		}
+	}
+	return r
+}
+
+// Serves a ValidatingAdmissionWebhook for apps/v1 Deployments
+type Validator struct {
+	Checker Checker
+}
+
+func NewValidator(checker Checker) *Validator {
+	return &Validator{Checker: checker}
+}
+
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveReview(w, r, v.review)
+}
+
+// decode an AdmissionReview, answer it with handle and echo the request uid
+func serveReview(w http.ResponseWriter, r *http.Request, handle func(context.Context, *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) {
+	var review admissionv1.AdmissionReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = handle(r.Context(), review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		fmt.Printf("Failed to encode admission response %v\n", err)
+	}
+}
+
+// anything the hub can't judge is allowed, the webhook must never block deploys on its own failure
+func (v *Validator) review(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if req.Kind.Kind != "Deployment" || (req.Operation != admissionv1.Create && req.Operation != admissionv1.Update) {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+
+	var d appsv1.Deployment
+	if err := json.Unmarshal(req.Object.Raw, &d); err != nil {
+		return &admissionv1.AdmissionResponse{Allowed: true, Warnings: []string{"metric-hub: could not decode deployment"}}
+	}
+
+	name := d.Name
+	if name == "" {
+		name = req.Name
+	}
+	reason, err := v.Checker.CheckRequests(ctx, req.Namespace, name, PodRequests(d.Spec.Template.Spec))
+	if err != nil {
+		fmt.Printf("Admission check failed for %s/%s, allowing: %v\n", req.Namespace, name, err)
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	if reason == "" {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+
+	fmt.Printf("Rejected deployment %s/%s: %s\n", req.Namespace, name, reason)
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusForbidden,
+			Reason:  metav1.StatusReasonForbidden,
+			Message: reason,
+		},
+	}
+}
+
+// Resources injected into a container that sets none
+// a zero limit is left unset
+type Defaults struct {
+	Requests Requests `json:"requests"`
+	Limits   Requests `json:"limits"`
+}
+
+// Supplies per-container defaults for a deployment, nil when there is nothing to inject
+type Recommender interface {
+	DefaultResources(ctx context.Context, namespace string, name string, containers int) (*Defaults, error)
+}
+
+// Serves a MutatingAdmissionWebhook that fills in missing requests and limits
+type Mutator struct {
+	Recommender Recommender
+}
+
+func NewMutator(recommender Recommender) *Mutator {
+	return &Mutator{Recommender: recommender}
+}
+
+type patchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func (m *Mutator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveReview(w, r, m.mutate)
+}
+
+// only containers with neither requests nor limits are touched
+func (m *Mutator) mutate(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	allowed := &admissionv1.AdmissionResponse{Allowed: true}
+	if req.Kind.Kind != "Deployment" || (req.Operation != admissionv1.Create && req.Operation != admissionv1.Update) {
+		return allowed
+	}
+
+	var d appsv1.Deployment
+	if err := json.Unmarshal(req.Object.Raw, &d); err != nil {
+		return allowed
+	}
+
+	containers := d.Spec.Template.Spec.Containers
+	var empty []int
+	for i, c := range containers {
+		if len(c.Resources.Requests) == 0 && len(c.Resources.Limits) == 0 {
+			empty = append(empty, i)
+		}
+	}
+	if len(empty) == 0 {
+		return allowed
+	}
+
+	name := d.Name
+	if name == "" {
+		name = req.Name
+	}
+	defaults, err := m.Recommender.DefaultResources(ctx, req.Namespace, name, len(containers))
+	if err != nil {
+		fmt.Printf("Failed to get default resources for %s/%s, leaving unchanged: %v\n", req.Namespace, name, err)
+		return allowed
+	}
+	if defaults == nil {
+		return allowed
+	}
+
+	resources := map[string]corev1.ResourceList{"requests": defaults.Requests.resourceList()}
+	if limits := defaults.Limits.resourceList(); len(limits) > 0 {
+		resources["limits"] = limits
+	}
+	ops := make([]patchOp, 0, len(empty))
+	for _, i := range empty {
+		ops = append(ops, patchOp{Op: "add", Path: fmt.Sprintf("/spec/template/spec/containers/%d/resources", i), Value: resources})
+	}
+
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		fmt.Printf("Failed to marshal admission patch %v\n", err)
+		return allowed
+	}
+	fmt.Printf("Injecting resources into %d containers of %s/%s\n", len(empty), req.Namespace, name)
+
+	patchType := admissionv1.PatchTypeJSONPatch
+	allowed.Patch = patch
+	allowed.PatchType = &patchType
+	return allowed
+}
+
+// cpu rounded up to the millicore, memory to the MiB
+func (r Requests) resourceList() corev1.ResourceList {
+	list := corev1.ResourceList{}
+	if r.CPUCores > 0 {
+		list[corev1.ResourceCPU] = resource.MustParse(fmt.Sprintf("%dm", int64(math.Ceil(r.CPUCores*1000))))
+	}
+	if r.MemoryMB > 0 {
+		list[corev1.ResourceMemory] = resource.MustParse(fmt.Sprintf("%dMi", int64(math.Ceil(r.MemoryMB))))
+	}
+	return list
+}
@@ -0,0 +1,110 @@
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeChecker struct {
+	got Requests
+}
+
+func (f *fakeChecker) CheckRequests(ctx context.Context, ns string, name string, req Requests) (string, error) {
+	f.got = req
+	if req.CPUCores > 2 {
+		return "cpu request too high", nil
+	}
+	return "", nil
+}
+
+const review = `{
+  "apiVersion": "admission.k8s.io/v1",
+  "kind": "AdmissionReview",
+  "request": {
+    "uid": "abc",
+    "kind": {"group": "apps", "version": "v1", "kind": "Deployment"},
+    "operation": "CREATE",
+    "namespace": "default",
+    "object": {
+      "metadata": {"name": "api"},
+      "spec": {"template": {"spec": {"containers": [
+        {"name": "app", "resources": {"requests": {"cpu": "%s", "memory": "512Mi"}}},
+        {"name": "sidecar", "resources": {"requests": {"cpu": "100m", "memory": "64Mi"}}}
+      ]}}}
+    }
+  }
+}`
+
+func send(t *testing.T, v *Validator, cpu string) map[string]interface{} {
+	body := bytes.Replace([]byte(review), []byte("%s"), []byte(cpu), 1)
+	rr := httptest.NewRecorder()
+	v.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admission/validate", bytes.NewReader(body)))
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out["response"].(map[string]interface{})
+}
+
+func TestValidatorSumsContainerRequests(t *testing.T) {
+	checker := &fakeChecker{}
+	resp := send(t, NewValidator(checker), "400m")
+
+	if resp["allowed"] != true || resp["uid"] != "abc" {
+		t.Errorf("expected allowed response for uid abc, got %v", resp)
+	}
+	if checker.got.CPUCores < 0.499 || checker.got.CPUCores > 0.501 || checker.got.MemoryMB != 576 {
+		t.Errorf("expected 0.5 cores and 576MB, got %+v", checker.got)
+	}
+}
+
+func TestValidatorRejects(t *testing.T) {
+	resp := send(t, NewValidator(&fakeChecker{}), "4")
+
+	if resp["allowed"] != false {
+		t.Fatalf("expected rejection, got %v", resp)
+	}
+	status := resp["status"].(map[string]interface{})
+	if status["message"] != "cpu request too high" {
+		t.Errorf("unexpected message %v", status["message"])
+	}
+}
+
+type fakeRecommender struct{}
+
+func (fakeRecommender) DefaultResources(ctx context.Context, ns string, name string, containers int) (*Defaults, error) {
+	return &Defaults{Requests: Requests{CPUCores: 0.25, MemoryMB: 100.2}, Limits: Requests{MemoryMB: 150}}, nil
+}
+
+func TestMutatorPatchesOnlyEmptyContainers(t *testing.T) {
+	body := []byte(`{"request": {"uid": "abc", "kind": {"kind": "Deployment"}, "operation": "CREATE", "namespace": "default",
+  "object": {"metadata": {"name": "api"}, "spec": {"template": {"spec": {"containers": [
+    {"name": "app"},
+    {"name": "sidecar", "resources": {"requests": {"cpu": "100m"}}}
+  ]}}}}}}`)
+	rr := httptest.NewRecorder()
+	NewMutator(fakeRecommender{}).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admission/mutate", bytes.NewReader(body)))
+
+	var out struct {
+		Response struct {
+			Allowed bool   `json:"allowed"`
+			Patch   []byte `json:"patch"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Response.Allowed {
+		t.Fatal("expected mutated deployment to be allowed")
+	}
+
+	want := `[{"op":"add","path":"/spec/template/spec/containers/0/resources","value":{"limits":{"memory":"150Mi"},"requests":{"cpu":"250m","memory":"101Mi"}}}]`
+	if string(out.Response.Patch) != want {
+		t.Errorf("unexpected patch\n got %s\nwant %s", out.Response.Patch, want)
+	}
+}
@@ -2,23 +2,183 @@ package internal
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/admission"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/billing"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/cache"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/gate"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/history"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/kube"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/leader"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/migrate"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
 	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/savings"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/scoring"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/script"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/tenant"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/wal"
 	"github.com/redis/go-redis/v9"
 )
 
 type AggregatorInterface interface {
-	SaveCostPayload(p *CostPayload) error
-	FetchPayload(p *ForecastPayload) error
+	SaveCostPayload(ctx context.Context, p *CostPayload) error
+	SaveCombinedPayload(ctx context.Context, p *CostPayload) error
+	ApplyCostDelta(ctx context.Context, d *CostDelta) error
+	LatestCost(ctx context.Context) (*CostPayload, error)
+	Recommendation(ctx context.Context, ns string, name string) (*Recommendation, error)
+	Explain(ctx context.Context, ns string, name string) (*Explanation, error)
+	RecommendationHistory(ctx context.Context, ns string, name string) ([]RecommendationRecord, error)
+	DryRun(ctx context.Context, req *DryRunRequest) (*DryRunReport, error)
+	FetchPayload(ctx context.Context, p *ForecastPayload) error
+	EfficiencyLeaderboard(ctx context.Context) ([]EfficiencyEntry, error)
+	EventDrivenSavings(ctx context.Context) (*EventDrivenReport, error)
+	Allocation(ctx context.Context, q AllocationQuery) ([]map[string]*Allocation, error)
+	FocusExport(ctx context.Context, window AllocationWindow, currency string) ([]FocusRow, error)
+	ReconcileBill(ctx context.Context, bill *billing.Bill) (*billing.Correction, error)
+	BillingCorrection(ctx context.Context) (*billing.Correction, error)
+	DeleteBillingCorrection(ctx context.Context) error
+	ValidateCustomMetrics(ctx context.Context, p *CostPayload) error
+	SaveSchema(ctx context.Context, name string, s *JSONSchema) error
+	DeleteSchema(ctx context.Context, name string) error
+	ListSchemas(ctx context.Context) (map[string]*JSONSchema, error)
+	SaveRule(ctx context.Context, r *CustomRule) error
+	DeleteRule(ctx context.Context, name string) error
+	ListRules(ctx context.Context) ([]CustomRule, error)
+	SaveScript(ctx context.Context, name string, src string) error
+	DeleteScript(ctx context.Context, name string) error
+	ListScripts(ctx context.Context) (map[string]string, error)
+	SaveFlags(ctx context.Context, ns string, f Flags) error
+	DeleteFlags(ctx context.Context, ns string) error
+	ListFlags(ctx context.Context) (TriggerFlags, error)
+	CheckRequests(ctx context.Context, ns string, name string, req admission.Requests) (string, error)
+	DefaultResources(ctx context.Context, ns string, name string, containers int) (*admission.Defaults, error)
+	SaveNamespaceDefaults(ctx context.Context, ns string, r *Resources) error
+	DeleteNamespaceDefaults(ctx context.Context, ns string) error
+	ListNamespaceDefaults(ctx context.Context) (map[string]Resources, error)
+	SaveOwner(ctx context.Context, ns string, name string, o *Ownership) error
+	DeleteOwner(ctx context.Context, ns string, name string) error
+	ListOwners(ctx context.Context) (map[string]Ownership, error)
+	SaveOrgTeam(ctx context.Context, team string, t *OrgTeam) error
+	DeleteOrgTeam(ctx context.Context, team string) error
+	ListOrgTeams(ctx context.Context) (map[string]OrgTeam, error)
+	SaveRoutingRule(ctx context.Context, r *RoutingRule) error
+	DeleteRoutingRule(ctx context.Context, name string) error
+	ListRoutingRules(ctx context.Context) ([]RoutingRule, error)
+	Quota(ctx context.Context) (*QuotaReport, error)
+	ClusterSummary(ctx context.Context, cluster string) (*ClusterSummary, error)
+	SaveBudget(ctx context.Context, b *Budget) error
+	DeleteBudget(ctx context.Context, id string) error
+	ListBudgets(ctx context.Context) ([]Budget, error)
+	BudgetForecast(ctx context.Context, id string) (*BudgetForecast, error)
+	ClusterProfile(ctx context.Context, cluster string, from time.Time, to time.Time) (*ClusterProfile, error)
+	SaveClusterProfile(ctx context.Context, p *ClusterProfile) error
+	DeleteClusterProfile(ctx context.Context, cluster string) error
+	CompareClusters(ctx context.Context, from time.Time, to time.Time, groupBy string) (*ClusterComparison, error)
+	PublicStatus(ctx context.Context) (*PublicStatus, error)
+	ReceiveAlerts(ctx context.Context, w *AlertmanagerWebhook) ([]AlertOutcome, error)
+	CompareNamespaces(ctx context.Context, from time.Time, to time.Time) ([]NamespaceReport, error)
+	OrgRollup(ctx context.Context, from time.Time, to time.Time, deploymentSavings map[string]savings.Entry) (*OrgReport, error)
+	Inventory(ctx context.Context) (*InventoryReport, error)
+	RunDiscovery(ctx context.Context, d *kube.Discoverer, interval time.Duration)
+	RecordOutcome(ctx context.Context, o *Outcome) (*Review, error)
+	ListReviews(ctx context.Context) ([]Review, error)
+	ResolveReview(ctx context.Context, ns string, name string) error
+	ActivePolicy(ctx context.Context) Policy
+	SavePolicy(ctx context.Context, p *Policy) error
+	ApplyPolicy(ctx context.Context, p *Policy) error
+	ApplyPolicyDocument(ctx context.Context, data []byte) error
+	Replay(ctx context.Context, req *ReplayRequest) (*ReplayReport, error)
+	ReadEvents(ctx context.Context, from time.Time, to time.Time) ([]Event, error)
+	Purge(ctx context.Context, f PurgeFilter, dryRun bool) (*PurgeResult, error)
+	ExportDeployment(ctx context.Context, ns string, name string) (*DeploymentArchive, error)
+	ImportDeployment(ctx context.Context, archive *DeploymentArchive, ns string, name string) (*ArchiveImport, error)
+	BackfillCost(ctx context.Context, b *CostBackfill) (*BackfillResult, error)
+	CandidatePolicy(ctx context.Context) *Policy
+	SaveCandidatePolicy(ctx context.Context, p *Policy) error
+	DeleteCandidatePolicy(ctx context.Context) error
+	ShadowReport(ctx context.Context) (*ShadowReport, error)
+	QualityReports(ctx context.Context) ([]QualityReport, error)
+	ClaimPayload(ctx context.Context, kind string, hash string) (bool, error)
+	ReleasePayload(ctx context.Context, kind string, hash string)
+	PurgeCache()
+	EvaluationRuns(ctx context.Context) ([]EvaluationRun, error)
+	EvaluationRun(ctx context.Context, id string) (*EvaluationRun, error)
+	RunShardWorker(ctx context.Context, interval time.Duration)
+	RunEvaluations(ctx context.Context)
+	RunScheduleCheck(ctx context.Context, interval time.Duration)
 }
 
 type Aggregator struct {
 	Client *redis.Client
-	Queue  queue.QueueClient
+	// read-only replica for query endpoints, reads go to Client when nil
+	Replica    *redis.Client
+	Queue      queue.QueueClient
+	NodeGroups *NodeGroupRecommender
+	// per-deployment evaluation locks
+	Locks *KeyedMutex
+	// usage samples and rollups per deployment
+	History *history.Store
+	// versions of documents stored in redis
+	Migrations *migrate.Registry
+	// optional external scoring service, replaces the built-in thresholds when it answers
+	Scorer scoring.Scorer
+	// optional policy gate every job must pass before it is published
+	Gate gate.Gate
+	// publish when the gate can't be reached instead of denying
+	GateFailOpen bool
+	// karpenter or cluster-autoscaler, node group findings become provisioner hints
+	Provisioner string
+	// jobs matching a route go to its queue instead of AgentQueueKey, the first match wins
+	QueueRoutes []QueueRoute
+	// cluster this hub reports on, DefaultClusterID when empty
+	ClusterID string
+	// provider, region and environment of ClusterID, for comparing clusters
+	ClusterLabels ClusterLabels
+	// asks operators to review rolled back changes
+	Notifier notify.Notifier
+	// sinks by name, routing rules send published jobs to them
+	Channels map[string]notify.Notifier
+	// trigger reason per Alertmanager alert name, DefaultAlertReasons when nil
+	AlertReasons map[string]string
+	// per-tenant quotas, nil when the hub isn't shared
+	Tenants *tenant.Limiter
+	// writes published deployment jobs as Kubernetes Events, nil outside a cluster
+	KubeEvents kube.Recorder
+	// how long a push's evaluation may run, DefaultEvaluationTimeout when zero
+	EvaluationTimeout time.Duration
+	// how long writing a Kubernetes Event may take, DefaultKubeEventTimeout when zero
+	KubeEventTimeout time.Duration
+	// deployments per evaluation shard, larger payloads are split, 0 never splits
+	ShardSize int
+	// goroutines evaluating the shards of one payload
+	ShardWorkers int
+	// claim shards through redis so replicas running RunShardWorker can help
+	ShardClaims bool
+	// this replica in shard progress, "local" when empty
+	ReplicaID string
+	// recently read cost payloads and policies, nil reads Redis every time
+	Cache *cache.LRU[any]
+	// time source for cooldowns and timestamps, the system clock when nil
+	Clock clock.Clock
+	// local copy of cost:latest and cooldowns, replayed when redis loses them, nil when disabled
+	WAL *wal.Log
+	// evaluations started by pushes and still running
+	background sync.WaitGroup
+	// evaluate the latest cost and forecast on this interval instead of on every push, 0 evaluates each push
+	EvaluationInterval time.Duration
+	// data-quality thresholds, triggers from deployments with implausible figures are suppressed
+	Quality QualityChecks
+	// cost evaluations since this replica started, for the startup warm-up
+	evaluations atomic.Int64
 }
 
 const (
@@ -26,7 +186,33 @@ const (
 	AgentQueueKey = "queue:agent:jobs"
 )
 
-func NewAggregator(redisAddr string, redisPass string) *Aggregator {
+// evaluations started by a push keep running after its response
+const DefaultEvaluationTimeout = 10 * time.Second
+
+// writes on other replicas are seen within the TTL, writes on this one immediately
+const (
+	DefaultCacheSize = 16
+	DefaultCacheTTL  = 2 * time.Second
+)
+
+// returned when no cost payload has been stored yet
+var ErrNoCostData = errors.New("latest cost data not found in cache")
+
+// Kinds of document versioned by the migration registry
+// queued jobs are not among them, their envelope carries its own version for the agents
+const (
+	CostPayloadKind    = "cost_payload"
+	OrphanForecastKind = "orphan_forecast"
+)
+
+// Register migration steps for stored documents here, in version order
+// e.g. Migrations.Register(CostPayloadKind, func(doc map[string]interface{}) error {...})
+func NewMigrations() *migrate.Registry {
+	return migrate.NewRegistry()
+}
+
+// replicaAddr is optional, when set reports and latest-cost reads use the replica
+func NewAggregator(redisAddr string, redisPass string, replicaAddr string) *Aggregator {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     redisAddr,
 		Password: redisPass,
@@ -35,175 +221,497 @@ func NewAggregator(redisAddr string, redisPass string) *Aggregator {
 
 	queueTool := queue.NewRedisQueue(rdb)
 
-	return &Aggregator{
-		Client: rdb,
-		Queue:  queueTool,
+	a := &Aggregator{
+		Client:     rdb,
+		Queue:      queueTool,
+		NodeGroups: NewNodeGroupRecommender(),
+		Locks:      NewKeyedMutex(),
+		History:    history.NewStore(rdb),
+		Migrations: NewMigrations(),
+		Cache:      cache.New[any]("redis", DefaultCacheSize, DefaultCacheTTL),
+		Quality:    DefaultQualityChecks(),
+
+		ShardSize:    DefaultShardSize,
+		ShardWorkers: DefaultShardWorkers,
 	}
+	if replicaAddr != "" {
+		a.Replica = redis.NewClient(&redis.Options{
+			Addr:     replicaAddr,
+			Password: redisPass,
+			DB:       0,
+		})
+		a.History.Replica = a.Replica
+	}
+	return a
+}
+
+// client for reads that may lag writes by the replication delay
+func (a *Aggregator) reader() *redis.Client {
+	if a.Replica != nil {
+		return a.Replica
+	}
+	return a.Client
 }
 
 // Marshal payload and save to redis
 // Key - cost:latest
 // Value - <payload>
-func (a *Aggregator) SaveCostPayload(p *CostPayload) error {
-	bg := context.Background()
-	jsonData, err := json.Marshal(p)
+func (a *Aggregator) SaveCostPayload(ctx context.Context, p *CostPayload) error {
+	if err := a.storeCost(ctx, p); err != nil {
+		return err
+	}
+	a.costSaved(ctx, p, nil)
+	return nil
+}
+
+func (a *Aggregator) storeCost(ctx context.Context, p *CostPayload) error {
+	jsonData, err := a.Migrations.Encode(CostPayloadKind, p)
 	if err != nil {
 		return fmt.Errorf("[Failed] to marshal payload: %w", err)
 	}
 
-	err = a.Client.Set(context.Background(), LatestCostKey, jsonData, 0).Err()
+	err = a.Client.Set(ctx, LatestCostKey, jsonData, 0).Err()
 	if err != nil {
 		return fmt.Errorf("[Failed] SET redis: %w", err)
 	}
+	a.logWrite(LatestCostKey, string(jsonData), 0)
+	return nil
+}
 
-	ctx, cancel := context.WithTimeout(bg, 10*time.Second)
+// log, record and evaluate a payload just stored as cost:latest
+// forecast is evaluated against it in the same pass when the payload carried predictions
+func (a *Aggregator) costSaved(ctx context.Context, p *CostPayload, forecast *ForecastPayload) {
+	a.Cache.Delete(LatestCostKey)
+	a.recordEvent(ctx, EventCostPayload, p)
+	a.recordHistory(ctx, p)
+	a.recordIdleCost(ctx, p)
+	a.recordClusterCost(ctx, p)
+	a.recordQuality(ctx, p)
+
+	if a.EvaluationInterval > 0 {
+		if forecast != nil {
+			if err := a.saveForecast(ctx, forecast); err != nil {
+				fmt.Printf("Failed to save forecast %v\n", err)
+			}
+		}
+		return
+	}
+	if forecast != nil {
+		a.recordEvent(ctx, EventForecastPayload, forecast)
+	}
+	ctx, cancel := a.evaluationContext(ctx)
 
+	a.background.Add(1)
 	go func() {
+		defer a.background.Done()
 		defer cancel()
-		a.CheckCostThreshold(ctx, p)
+		a.evaluateCost(ctx, p)
+		if forecast != nil {
+			a.CheckForecastThreshold(ctx, forecast, p)
+		}
 	}()
+}
 
-	return nil
+// every check a cost payload drives
+func (a *Aggregator) evaluateCost(ctx context.Context, p *CostPayload) {
+	a.CheckCostThreshold(ctx, p)
+	a.CheckNodeGroups(ctx, p)
+	a.CheckClusterAnomalies(ctx, p)
+	a.CheckOrphanForecasts(ctx, p)
+	a.CheckBudgets(ctx)
+}
+
+// drop samples for new deployments once the tenant tracks its quota of them
+func (a *Aggregator) limitHistory(ctx context.Context, ns string, samples map[string]history.Sample) map[string]history.Sample {
+	tracked, err := a.History.TrackedIn(ctx, ns)
+	if err != nil {
+		fmt.Printf("Failed to check history quota %v\n", err)
+		return samples
+	}
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	allowed := make(map[string]history.Sample, len(samples))
+	for _, name := range a.Tenants.HistoryAllowed(ctx, ns, tracked, names) {
+		allowed[name] = samples[name]
+	}
+	return allowed
+}
+
+// one sample per deployment, keyed by <namespace>/<name>
+func historySamples(p *CostPayload) map[string]history.Sample {
+	samples := make(map[string]history.Sample, len(p.Deployments))
+	for _, d := range p.Deployments {
+		samples[history.Deployment(p.Namespace, d.Name)] = history.Sample{
+			Time:       p.Timestamp,
+			CPUUsage:   d.CurrentUsage.CPUCores,
+			CPURequest: d.CurrentRequests.CPUCores,
+			MemUsage:   d.CurrentUsage.MemoryMB,
+			MemRequest: d.CurrentRequests.MemoryMB,
+		}
+	}
+	return samples
+}
+
+// history is best effort, a failed write never rejects the payload
+func (a *Aggregator) recordHistory(ctx context.Context, p *CostPayload) {
+	samples := historySamples(p)
+	if a.Tenants != nil {
+		samples = a.limitHistory(ctx, p.Namespace, samples)
+	}
+	if err := a.History.Record(ctx, samples); err != nil {
+		fmt.Printf("Failed to record history %v\n", err)
+	}
 }
 
 func (a *Aggregator) CheckCostThreshold(ctx context.Context, p *CostPayload) {
 	fmt.Printf("[Background] Starting threshold check for %d deployments\n", len(p.Deployments))
 
+	shards := shardDeployments(p.Deployments, a.ShardSize)
+	if len(shards) > 1 {
+		a.evaluateShards(ctx, p, shards)
+		return
+	}
+	a.newCostEvaluation(ctx, p).run(ctx, p.Deployments)
+}
+
+// everything a cost evaluation reads once per payload
+type costEvaluation struct {
+	a       *Aggregator
+	payload *CostPayload
+	// this replica is still in its startup warm-up
+	warming     bool
+	rules       Ruleset
+	policy      Policy
+	candidate   *Policy
+	flags       Flags
+	sensitivity Sensitivity
+	quality     *QualityReport
+}
+
+func (a *Aggregator) newCostEvaluation(ctx context.Context, p *CostPayload) *costEvaluation {
+	policy := a.ActivePolicy(ctx)
+	return &costEvaluation{
+		a:           a,
+		payload:     p,
+		warming:     a.evaluations.Add(1) <= int64(policy.WarmupSamples),
+		rules:       a.loadRuleset(ctx),
+		policy:      policy,
+		candidate:   a.CandidatePolicy(ctx),
+		flags:       a.flagsFor(ctx, p.Namespace),
+		sensitivity: a.loadSensitivity(ctx),
+		quality:     a.Quality.Assess(p),
+	}
+}
+
+// evaluate some of the payload's deployments, false when ctx ended first
+func (e *costEvaluation) run(ctx context.Context, deployments []CostDeployment) bool {
+	a, p := e.a, e.payload
 	ns := p.Namespace
-	clusterInfo := p.ClusterInfo
+	cooldown := time.Duration(e.policy.CooldownSeconds) * time.Second
 
-	for _, deployment := range p.Deployments {
+	for _, deployment := range deployments {
 		select {
 		case <-ctx.Done():
 			fmt.Printf("Threshold check cancelled")
-			return
+			return false
 		default:
 		}
 
-		reqCpu := deployment.CurrentRequests.CPUCores
-		useCpu := deployment.CurrentUsage.CPUCores
-		reqMem := deployment.CurrentRequests.MemoryMB
-		useMem := deployment.CurrentUsage.MemoryMB
-
-		if reqCpu == 0 || reqMem == 0 {
-			continue
+		// serialise per deployment so overlapping payloads can't race the cooldown,
+		// and skip snapshots older than one already evaluated
+		ran := a.Locks.Sequence(deploymentLockKey(ns, deployment.Name), "cost", p.Timestamp, func() {
+			reason, scored := a.externalDecision(ctx, ns, "cost", deployment)
+			if !scored {
+				reason = costTriggerReason(ctx, deployment, e.sensitivity.Apply(ns, deployment.Name, e.policy), e.rules, e.flags)
+			}
+			warm := a.warmedUp(ctx, ns, deployment.Name, e.policy.WarmupSamples)
+			rolling := a.rollingOut(ctx, ns, deployment, time.Duration(e.policy.RolloutGraceSeconds)*time.Second)
+			if reason != "" && (e.warming || !warm) {
+				fmt.Printf("%s is warming up. Skipping %s.\n", deployment.Name, reason)
+			} else if reason != "" && rolling {
+				fmt.Printf("%s is rolling out. Skipping %s.\n", deployment.Name, reason)
+			} else if reason != "" && e.quality.Suppresses(deployment.Name) {
+				fmt.Printf("%s has low quality data. Skipping %s.\n", deployment.Name, reason)
+			} else if reason != "" {
+				a.handleTrigger(ctx, deployment, reason, ns, p.ClusterInfo, cooldown)
+			}
+			a.syncIncidents(ctx, IncidentSourceCost, ns, deployment, costCriticalReasons(deployment, e.policy, e.flags))
+			a.shadowCost(ctx, e.candidate, deployment, e.policy, e.rules, e.flags)
+		})
+		if !ran {
+			fmt.Printf("Skipping stale cost snapshot for %s\n", deployment.Name)
 		}
+	}
+	return true
+}
 
-		var wasteCpu, utilCpu, wasteMem, utilMem float64
+// a deployment without a cpu or memory request, its job recommends initial requests from observed usage
+const ReasonNoRequests = "No Requests Set"
 
-		if reqCpu > 0 {
-			wasteCpu = (reqCpu - useCpu) / reqCpu
-			utilCpu = useCpu / reqCpu
-		}
+func deploymentLockKey(ns string, name string) string {
+	return ns + "/" + name
+}
 
-		if reqMem > 0 {
-			wasteMem = (reqMem - useMem) / reqMem
-			utilMem = useMem / reqMem
+// reason the deployment should trigger, or "" when it shouldn't
+func costTriggerReason(ctx context.Context, deployment CostDeployment, policy Policy, rules Ruleset, flags Flags) string {
+	reqCpu := deployment.CurrentRequests.CPUCores
+	reqMem := deployment.CurrentRequests.MemoryMB
+	// waste from typical usage, risk from the peak
+	typical, peak := deployment.WasteUsage(), deployment.RiskUsage()
+
+	// no waste or risk without a request to compare usage with
+	// a resource that is switched off doesn't need one
+	if (reqCpu == 0 && flags.ResourceEnabled(ResourceCPU)) || (reqMem == 0 && flags.ResourceEnabled(ResourceMemory)) {
+		if reason := limitsReason(deployment, flags); reason != "" {
+			return reason
 		}
-
-		// Prioritise memory
-		// one reason is sufficient for triggering agent
-		if wasteMem > 0.5 {
-			a.handleTrigger(ctx, deployment, "High Memory Waste", ns, clusterInfo)
-		} else if utilMem > 0.85 {
-			a.handleTrigger(ctx, deployment, "High Memory Risk", ns, clusterInfo)
-		} else if wasteCpu > 0.5 {
-			a.handleTrigger(ctx, deployment, "High CPU Waste", ns, clusterInfo)
-		} else if utilCpu > 0.85 {
-			a.handleTrigger(ctx, deployment, "High CPU Risk", ns, clusterInfo)
+		if flags.Enabled(FamilyNoRequests) {
+			return ReasonNoRequests
 		}
+		return ""
+	}
+
+	var wasteCpu, utilCpu, wasteMem, utilMem float64
+
+	if reqCpu > 0 {
+		wasteCpu = (reqCpu - typical.CPUCores) / reqCpu
+		utilCpu = peak.CPUCores / reqCpu
+	}
+
+	if reqMem > 0 {
+		wasteMem = (reqMem - typical.MemoryMB) / reqMem
+		utilMem = peak.MemoryMB / reqMem
 	}
+
+	// never downscale a service that is already close to its latency SLO,
+	// or one KEDA scales to zero, where idle replicas are expected between events
+	skipWaste := NearLatencySLO(deployment) || deployment.Keda.ScalesToZero()
+
+	// Prioritise memory
+	// one reason is sufficient for triggering agent
+	// disabled families are skipped, the next one in priority order still applies
+	if wasteMem > policy.MemoryWaste && !skipWaste && flags.Enabled(FamilyMemoryWaste) {
+		return "High Memory Waste"
+	} else if utilMem > policy.MemoryRisk && flags.Enabled(FamilyMemoryRisk) {
+		return "High Memory Risk"
+	} else if wasteCpu > policy.CPUWaste && !skipWaste && flags.Enabled(FamilyCPUWaste) {
+		return "High CPU Waste"
+	} else if utilCpu > policy.CPURisk && flags.Enabled(FamilyCPURisk) {
+		return "High CPU Risk"
+	} else if reason := limitsReason(deployment, flags); reason != "" {
+		return reason
+	}
+	return rules.match(ctx, deployment, flags)
 }
 
 // Handle trigger cooldown
 // Key: trigger:cooldown:<deployment name>
 // Value: timestamp
-func (a *Aggregator) handleTrigger(ctx context.Context, c CostDeployment, reason string, ns string, info ClusterInfo) {
+func (a *Aggregator) handleTrigger(ctx context.Context, c CostDeployment, reason string, ns string, info ClusterInfo, cooldown time.Duration) {
 	// define key
 	key := fmt.Sprintf("trigger:cooldown:%s", c.Name)
 
-	// check redis for the last timestamp
+	// held after a rollback until reviewed or the hold expires
+	if a.onHold(ctx, ns, c.Name) {
+		fmt.Printf("%s is held after a rollback. Skipping.\n", c.Name)
+		return
+	}
+
+	// if last trigger within the cooldown (30 mins by default), drop, stop, dont push to queue
+	if a.cooldownActive(ctx, key, cooldown) {
+		fmt.Printf("Cooldown active for %s. Skipping.\n", c.Name)
+		return
+	}
+
+	// Proceed to push if cooldown expired
+	a.executePush(ctx, key, cooldown, c, reason, ns, info)
+}
+
+// check redis for the last trigger timestamp stored under key
+// errors are treated as active so a broken cache never floods the queue
+func (a *Aggregator) cooldownActive(ctx context.Context, key string, cooldown time.Duration) bool {
 	// return a string and convert to int64
 	lastTriggerStr, err := a.Client.Get(ctx, key).Result()
 
 	// handle case if first time triggering
 	if err == redis.Nil {
-		a.executePush(ctx, key, c, reason, ns, info)
-		return
+		return false
 	} else if err != nil {
 		fmt.Printf("Redis error %v\n", err)
-		return
+		return true
 	}
 
 	// conver string to int64
 	lastTrigger, err := strconv.ParseInt(lastTriggerStr, 10, 64)
 	if err != nil {
 		fmt.Printf("Failed to parse timstamp %v\n", err)
-		return
+		return true
 	}
 
-	currentTime := time.Now().Unix()
-
-	// if last trigger <30 mins ago, drop, stop, dont push to queue
-	if currentTime-lastTrigger < 1800 {
-		fmt.Printf("Cooldown active for %s. Skipping.\n", c.Name)
-		return
-	}
-
-	// Proceed to push if cooldown expired
-	a.executePush(ctx, key, c, reason, ns, info)
+	currentTime := a.now().Unix()
+	return currentTime-lastTrigger < int64(cooldown.Seconds())
 }
 
 // push to queue and update timestamp
-func (a *Aggregator) executePush(ctx context.Context, cooldownKey string, c CostDeployment, reason string, ns string, info ClusterInfo) {
+// nil when the job was published or denied, both start the cooldown
+func (a *Aggregator) executePush(ctx context.Context, cooldownKey string, cooldown time.Duration, c CostDeployment, reason string, ns string, info ClusterInfo) error {
 	fmt.Printf("Pushing to queue for %s because: %s\n", c.Name, reason)
 
 	// Push to queue
-	job := AgentJob{
-		Reason:      reason,
-		Namespace:   ns,
-		Deployment:  c,
-		ClusterInfo: info,
+	job := NewDeploymentJob(reason, ns, c, info)
+	job.Constraints = a.namespaceConstraints(ctx, ns)
+	policy := a.ActivePolicy(ctx)
+	job.Recommendation = newRecommendation(ns, c, policy, job.Constraints)
+	job.ApplyPlan = policy.Canary.Plan(job.Action)
+	job.Output = policy.Output.Render(job)
+
+	err := a.publishJob(ctx, job)
+	if errors.Is(err, ErrJobDenied) {
+		// a denied job still starts the cooldown so it isn't re-checked on every payload
+		fmt.Printf("Job for %s not published: %v\n", c.Name, err)
+	} else if errors.Is(err, leader.ErrNotLeader) {
+		// no cooldown, so the leader publishes it when a payload reaches it
+		fmt.Printf("Job for %s left to the leader\n", c.Name)
+		return err
+	} else if err != nil {
+		fmt.Printf("Failed to push job: %v\n", err)
+		return err
 	}
+	// Update time
+	a.startCooldown(ctx, cooldownKey, cooldown)
+	return nil
+}
 
-	err := a.Queue.PublishJob(ctx, AgentQueueKey, job)
-	if err != nil {
-		fmt.Printf("Failed to push job: %v\n", err)
+// store the trigger time read by cooldownActive, the key expires with the cooldown
+func (a *Aggregator) startCooldown(ctx context.Context, key string, cooldown time.Duration) {
+	now := strconv.FormatInt(a.now().Unix(), 10)
+	if err := a.Client.Set(ctx, key, now, cooldown).Err(); err != nil {
+		fmt.Printf("Failed to start cooldown %v\n", err)
 		return
 	}
-	// Update time
-	a.Client.Set(ctx, cooldownKey, time.Now().Unix(), 0)
+	a.logWrite(key, now, cooldown)
 }
 
-// prepare cost key for merging
-func (a *Aggregator) FetchPayload(p *ForecastPayload) error {
-	bg := context.Background()
+// mirror a write redis accepted to the write-ahead log, ttl as it was set in redis
+// failures are only logged, redis already holds the value
+func (a *Aggregator) logWrite(key string, value string, ttl time.Duration) {
+	if a.WAL == nil {
+		return
+	}
+	if err := a.WAL.Append(key, value, ttl); err != nil {
+		fmt.Printf("Failed to log %s %v\n", key, err)
+	}
+}
 
-	latestCostJSON, err := a.Client.Get(bg, LatestCostKey).Result()
+// the request's values without its cancellation, so the evaluation outlives the response
+// but is still bounded by the evaluation timeout
+func (a *Aggregator) evaluationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), orDefault(a.EvaluationTimeout, DefaultEvaluationTimeout))
+}
 
-	if err == redis.Nil {
-		return fmt.Errorf("cannot process forecast: latest cost data (%s) not found in cache", LatestCostKey)
-	} else if err != nil {
-		return fmt.Errorf("failed to get redis cost data %w", err)
+func orDefault(d time.Duration, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
 
+func (a *Aggregator) now() time.Time {
+	return clock.Now(a.Clock)
+}
+
+// Drop cached documents, e.g. after a restore rewrote them
+func (a *Aggregator) PurgeCache() {
+	a.Cache.Purge()
+}
+
+// Wait blocks until the evaluations started by earlier pushes have finished
+func (a *Aggregator) Wait() {
+	a.background.Wait()
+}
+
+// prepare cost key for merging
+// with an evaluation interval the forecast is only stored, the next tick merges it with the latest cost
+func (a *Aggregator) FetchPayload(ctx context.Context, p *ForecastPayload) error {
+	if a.EvaluationInterval > 0 {
+		return a.saveForecast(ctx, p)
 	}
+	// ingestion reads the primary so a cost push just before is never missed
+	costPayload, err := a.readCost(ctx, a.Client)
+	if err != nil {
+		return fmt.Errorf("cannot process forecast: %w", err)
+	}
+	a.recordEvent(ctx, EventForecastPayload, p)
 
-	ctx, cancel := context.WithTimeout(bg, 10*time.Second)
+	ctx, cancel := a.evaluationContext(ctx)
 
+	a.background.Add(1)
 	go func() {
+		defer a.background.Done()
 		defer cancel()
-		a.CheckForecastThreshold(ctx, p, latestCostJSON)
+		a.CheckForecastThreshold(ctx, p, costPayload)
 	}()
 	return nil
 
 }
 
-// check forecast
-func (a *Aggregator) CheckForecastThreshold(ctx context.Context, p *ForecastPayload, latestCostJSON string) {
+// only replace the value if no one wrote a newer one since it was read
+var compareAndSet = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+end
+return nil
+`)
+
+// Latest stored cost payload, shared with other readers and must not be modified
+func (a *Aggregator) LatestCost(ctx context.Context) (*CostPayload, error) {
+	return a.latestCost(ctx)
+}
+
+// read and unmarshal cost:latest from the cache, or the replica when there is one
+// the payload is shared with other readers and must not be modified
+func (a *Aggregator) latestCost(ctx context.Context) (*CostPayload, error) {
+	if p, ok := a.Cache.Get(LatestCostKey); ok {
+		return p.(*CostPayload), nil
+	}
+	p, err := a.readCost(ctx, a.reader())
+	if err != nil {
+		return nil, err
+	}
+	a.Cache.Set(LatestCostKey, p)
+	return p, nil
+}
+
+// upgraded layouts are always written back to the primary
+func (a *Aggregator) readCost(ctx context.Context, client *redis.Client) (*CostPayload, error) {
+	latestCostJSON, err := client.Get(ctx, LatestCostKey).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("%w (%s)", ErrNoCostData, LatestCostKey)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get redis cost data %w", err)
+	}
+
 	var costPayload CostPayload
-	// unmarshal cost key value back to struct
-	if err := json.Unmarshal([]byte(latestCostJSON), &costPayload); err != nil {
-		fmt.Printf("failed to unmarshal cost json in background %v", err)
+	upgraded, err := a.Migrations.Decode(CostPayloadKind, []byte(latestCostJSON), &costPayload)
+	if err != nil {
+		return nil, err
+	}
+	if upgraded != nil {
+		if err := compareAndSet.Run(ctx, a.Client, []string{LatestCostKey}, latestCostJSON, upgraded).Err(); err != nil && err != redis.Nil {
+			fmt.Printf("Failed to write back migrated cost data %v\n", err)
+		}
+	}
+	return &costPayload, nil
+}
+
+// check forecast
+func (a *Aggregator) CheckForecastThreshold(ctx context.Context, p *ForecastPayload, costPayload *CostPayload) {
+	if p.Namespace != costPayload.Namespace {
+		fmt.Printf("Forecast namespace %s does not match cost namespace %s\n", p.Namespace, costPayload.Namespace)
 		return
 	}
 
@@ -214,6 +722,12 @@ func (a *Aggregator) CheckForecastThreshold(ctx context.Context, p *ForecastPayl
 	}
 
 	fmt.Printf("Starting forecast merge for %d deployments\n", len(p.Deployments))
+	policy := a.ActivePolicy(ctx)
+	candidate := a.CandidatePolicy(ctx)
+	sensitivity := a.loadSensitivity(ctx)
+	quality := a.Quality.Assess(costPayload)
+	// compiled once per payload, not per deployment
+	scripts := a.loadScripts(ctx)
 
 	// Merge forecast fields to the correct deployment
 	for _, forecastDep := range p.Deployments {
@@ -224,66 +738,70 @@ func (a *Aggregator) CheckForecastThreshold(ctx context.Context, p *ForecastPayl
 		default:
 		}
 
-		if costDep, exists := costMap[forecastDep.Name]; exists {
-			a.evaluateForecastLogic(ctx, forecastDep, costDep, costPayload.Namespace, costPayload.ClusterInfo)
+		if costDep, exists := costMap[forecastDep.Name]; exists && quality.Suppresses(costDep.Name) {
+			fmt.Printf("%s has low quality cost data. Skipping forecast.\n", costDep.Name)
+		} else if exists {
+			forecastDep := forecastDep
+			ran := a.Locks.Sequence(deploymentLockKey(costPayload.Namespace, costDep.Name), "forecast", p.Timestamp, func() {
+				a.evaluateForecastLogic(ctx, forecastDep, costDep, costPayload.Namespace, costPayload.ClusterInfo, sensitivity.Apply(costPayload.Namespace, costDep.Name, policy), scripts)
+				a.shadowForecast(ctx, candidate, forecastDep, costDep, policy)
+			})
+			if !ran {
+				fmt.Printf("Skipping stale forecast snapshot for %s\n", costDep.Name)
+			}
 		} else {
 			fmt.Printf("No cost data found for forecast deployment %v\n", forecastDep.Name)
+			a.saveOrphanForecast(ctx, p.Namespace, forecastDep)
 		}
 	}
 }
 
-func (a *Aggregator) evaluateForecastLogic(ctx context.Context, f ForecastDeployment, c CostDeployment, ns string, info ClusterInfo) {
-	reqCpu := c.CurrentRequests.CPUCores
-	usageCpu := c.CurrentUsage.CPUCores
-	predCpu := f.PredictPeak24h.CPUCores
+// scripts are loaded by the caller, once for the whole payload
+func (a *Aggregator) evaluateForecastLogic(ctx context.Context, f ForecastDeployment, c CostDeployment, ns string, info ClusterInfo, policy Policy, scripts []*script.Script) {
+	// the scoring service and scripts see the merged cost and forecast record
+	merged := c
+	merged.PredictPeak24h = &f.PredictPeak24h
 
-	reqMem := c.CurrentRequests.MemoryMB
-	usageMem := c.CurrentRequests.MemoryMB
-	predMem := f.PredictPeak24h.MemoryMB
-
-	// cpu logic
-	if reqCpu > 0 {
-		capacityRiskCpu := predCpu > (reqCpu * 0.9)
-		currentWasteCpu := (reqCpu - usageCpu) / reqCpu
-		safeDownscaleCpu := currentWasteCpu > 0.4 && predCpu < (reqCpu*0.6)
-
-		if capacityRiskCpu {
-			a.executeForecastPush(ctx, c, "Predicted Capacity Risk (CPU)", ns, info, f.PredictPeak24h)
-			return
-		} else if safeDownscaleCpu {
-			a.executeForecastPush(ctx, c, "Predicted Safe Downscale (CPU)", ns, info, f.PredictPeak24h)
-			return
+	if reason, scored := a.externalDecision(ctx, ns, "forecast", merged); scored {
+		if reason != "" {
+			a.executeForecastPush(ctx, c, []Condition{{Reason: reason, Resource: "External"}}, ns, info, f.PredictPeak24h)
 		}
+		return
 	}
 
-	// 2. Memory Logic (If CPU didn't trigger)
-	if reqMem > 0 {
-		capacityRiskMem := predMem > (reqMem * 0.9)
-		currentWasteMem := (reqMem - usageMem) / reqMem
-		safeDownscaleMem := currentWasteMem > 0.4 && predMem < (reqMem*0.6)
-
-		if capacityRiskMem {
-			a.executeForecastPush(ctx, c, "Predicted Capacity Risk (Memory)", ns, info, f.PredictPeak24h)
-			return
-		} else if safeDownscaleMem {
-			a.executeForecastPush(ctx, c, "Predicted Safe Downscale (Memory)", ns, info, f.PredictPeak24h)
-			return
+	flags := a.flagsFor(ctx, ns)
+	conditions := filterConditions(EvaluateForecast(f, c, policy), flags)
+	a.syncIncidents(ctx, IncidentSourceForecast, ns, c, forecastCriticalReasons(conditions))
+	if flags.Enabled(FamilyScripts) {
+		if reason := matchScripts(ctx, scripts, merged); reason != "" {
+			conditions = append(conditions, Condition{Reason: reason, Resource: "Script", Family: FamilyScripts, Priority: len(conditions)})
 		}
 	}
+	if len(conditions) == 0 {
+		return
+	}
+	a.executeForecastPush(ctx, c, conditions, ns, info, f.PredictPeak24h)
 }
 
-func (a *Aggregator) executeForecastPush(ctx context.Context, c CostDeployment, reason string, ns string, info ClusterInfo, prediction Resources) {
-	fmt.Printf("Pushing forecast job for %s\n", c.Name)
+// one job per deployment carrying every violated condition
+// reason is taken from the highest priority condition
+func (a *Aggregator) executeForecastPush(ctx context.Context, c CostDeployment, conditions []Condition, ns string, info ClusterInfo, prediction Resources) {
+	if a.onHold(ctx, ns, c.Name) {
+		fmt.Printf("%s is held after a rollback. Skipping forecast job.\n", c.Name)
+		return
+	}
+	fmt.Printf("Pushing forecast job for %s with %d conditions\n", c.Name, len(conditions))
 
 	c.PredictPeak24h = &prediction
 
-	job := AgentJob{
-		Reason:      reason,
-		Namespace:   ns,
-		Deployment:  c,
-		ClusterInfo: info,
-	}
-	err := a.Queue.PublishJob(ctx, AgentQueueKey, job)
+	job := NewDeploymentJob(conditions[0].Reason, ns, c, info)
+	job.Conditions = conditions
+	job.Constraints = a.namespaceConstraints(ctx, ns)
+	policy := a.ActivePolicy(ctx)
+	job.Recommendation = newRecommendation(ns, c, policy, job.Constraints)
+	job.ApplyPlan = policy.Canary.Plan(job.Action)
+	job.Output = policy.Output.Render(job)
+	err := a.publishJob(ctx, job)
 	if err != nil {
 		fmt.Printf("Failed to push forecast job: %v\n", err)
 	}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/leader"
+)
+
+// Alertmanager webhook body, version 4
+// https://prometheus.io/docs/alerting/latest/configuration/#webhook_config
+type AlertmanagerWebhook struct {
+	Version  string  `json:"version"`
+	GroupKey string  `json:"groupKey"`
+	Status   string  `json:"status"`
+	Receiver string  `json:"receiver"`
+	Alerts   []Alert `json:"alerts" validate:"required,dive"`
+}
+
+type Alert struct {
+	Status      string            `json:"status" validate:"oneof=firing resolved"`
+	Labels      map[string]string `json:"labels" validate:"required"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+}
+
+// What became of each alert in a webhook
+const (
+	AlertPublished         = "published"
+	AlertResolved          = "resolved"
+	AlertNoDeployment      = "no_deployment"
+	AlertUnknownDeployment = "unknown_deployment"
+	AlertDisabled          = "disabled"
+	AlertHeld              = "held"
+	AlertRollingOut        = "rolling_out"
+	AlertCooldown          = "cooldown"
+	AlertFailed            = "failed"
+)
+
+type AlertOutcome struct {
+	Alert      string `json:"alert"`
+	Namespace  string `json:"namespace,omitempty"`
+	Deployment string `json:"deployment,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Outcome    string `json:"outcome"`
+}
+
+// Trigger reasons for alert names, unmapped alerts trigger with "Alert: <alertname>"
+// the mapped reasons are the built-in ones, so routing rules and job severity treat them alike
+func DefaultAlertReasons() map[string]string {
+	return map[string]string{
+		"HighMemoryUsage": "High Memory Risk",
+		"HighCPUUsage":    "High CPU Risk",
+	}
+}
+
+func (a *Aggregator) alertReason(alert Alert) string {
+	name := alert.Labels["alertname"]
+	reasons := a.AlertReasons
+	if reasons == nil {
+		reasons = DefaultAlertReasons()
+	}
+	if reason, ok := reasons[name]; ok {
+		return reason
+	}
+	return "Alert: " + name
+}
+
+// Deployment an alert is about, from its deployment label or the name of its pod
+// pods are named <deployment>-<replicaset hash>-<pod hash>
+func alertDeployment(alert Alert) (string, string) {
+	ns := alert.Labels["namespace"]
+	if name := alert.Labels["deployment"]; name != "" {
+		return ns, name
+	}
+	parts := strings.Split(alert.Labels["pod"], "-")
+	if len(parts) < 3 {
+		return ns, ""
+	}
+	return ns, strings.Join(parts[:len(parts)-2], "-")
+}
+
+// Turn firing alerts into deployment jobs for deployments in the latest cost payload
+// alerts share the cost triggers' cooldown, rollback holds and rollout grace
+// returns leader.ErrNotLeader when a job was left to the leader, so Alertmanager retries
+func (a *Aggregator) ReceiveAlerts(ctx context.Context, w *AlertmanagerWebhook) ([]AlertOutcome, error) {
+	p, err := a.latestCost(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy := a.ActivePolicy(ctx)
+	cooldown := time.Duration(policy.CooldownSeconds) * time.Second
+
+	outcomes := make([]AlertOutcome, 0, len(w.Alerts))
+	var notLeader error
+	for _, alert := range w.Alerts {
+		ns, name := alertDeployment(alert)
+		if ns == "" {
+			ns = p.Namespace
+		}
+		o := AlertOutcome{Alert: alert.Labels["alertname"], Namespace: ns, Deployment: name, Reason: a.alertReason(alert)}
+		var err error
+		o.Outcome, err = a.triggerFromAlert(ctx, p, alert, o, policy, cooldown)
+		if errors.Is(err, leader.ErrNotLeader) {
+			notLeader = err
+		}
+		outcomes = append(outcomes, o)
+	}
+	return outcomes, notLeader
+}
+
+func (a *Aggregator) triggerFromAlert(ctx context.Context, p *CostPayload, alert Alert, o AlertOutcome, policy Policy, cooldown time.Duration) (string, error) {
+	if alert.Status != "firing" {
+		return AlertResolved, nil
+	}
+	if o.Deployment == "" {
+		return AlertNoDeployment, nil
+	}
+	deployment, ok := findDeployment(p, o.Namespace, o.Deployment)
+	if !ok {
+		return AlertUnknownDeployment, nil
+	}
+	if !a.flagsFor(ctx, o.Namespace).Enabled(FamilyAlerts) {
+		return AlertDisabled, nil
+	}
+
+	// serialised with cost evaluations so the two can't race the cooldown
+	unlock := a.Locks.Lock(deploymentLockKey(o.Namespace, o.Deployment))
+	defer unlock()
+
+	key := fmt.Sprintf("trigger:cooldown:%s", o.Deployment)
+	switch {
+	case a.onHold(ctx, o.Namespace, o.Deployment):
+		return AlertHeld, nil
+	case a.rollingOut(ctx, o.Namespace, deployment, time.Duration(policy.RolloutGraceSeconds)*time.Second):
+		return AlertRollingOut, nil
+	case a.cooldownActive(ctx, key, cooldown):
+		return AlertCooldown, nil
+	}
+	if err := a.executePush(ctx, key, cooldown, deployment, o.Reason, o.Namespace, p.ClusterInfo); err != nil {
+		return AlertFailed, err
+	}
+	return AlertPublished, nil
+}
+
+// deployment in the payload, the payload covers one namespace
+func findDeployment(p *CostPayload, ns string, name string) (CostDeployment, bool) {
+	if ns != p.Namespace {
+		return CostDeployment{}, false
+	}
+	for _, d := range p.Deployments {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return CostDeployment{}, false
+}
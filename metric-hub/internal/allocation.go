@@ -0,0 +1,316 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Aggregations of the allocation API, keys follow Kubecost
+const (
+	// <namespace>/<name>
+	AggregateNone           = ""
+	AggregateCluster        = "cluster"
+	AggregateNamespace      = "namespace"
+	AggregateController     = "controller"
+	AggregateControllerKind = "controllerKind"
+	AggregateDeployment     = "deployment"
+)
+
+var (
+	ErrInvalidWindow        = errors.New("invalid window")
+	ErrUnsupportedAggregate = errors.New("unsupported aggregate")
+)
+
+// allocation sets a single query may return
+const maxAllocationSets = 1000
+
+type AllocationProperties struct {
+	Cluster        string `json:"cluster,omitempty"`
+	Namespace      string `json:"namespace,omitempty"`
+	Controller     string `json:"controller,omitempty"`
+	ControllerKind string `json:"controllerKind,omitempty"`
+}
+
+type AllocationWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Subset of the Kubecost/OpenCost allocation, memory in bytes
+// costs split the requests' price between cpu and memory as wasted cost does
+// gpu, storage and network are not tracked by the hub and are always 0
+type Allocation struct {
+	Name                  string               `json:"name"`
+	Properties            AllocationProperties `json:"properties"`
+	Window                AllocationWindow     `json:"window"`
+	Start                 time.Time            `json:"start"`
+	End                   time.Time            `json:"end"`
+	Minutes               float64              `json:"minutes"`
+	CPUCores              float64              `json:"cpuCores"`
+	CPUCoreRequestAverage float64              `json:"cpuCoreRequestAverage"`
+	CPUCoreUsageAverage   float64              `json:"cpuCoreUsageAverage"`
+	CPUCoreHours          float64              `json:"cpuCoreHours"`
+	CPUCost               float64              `json:"cpuCost"`
+	CPUEfficiency         float64              `json:"cpuEfficiency"`
+	GPUCount              float64              `json:"gpuCount"`
+	GPUHours              float64              `json:"gpuHours"`
+	GPUCost               float64              `json:"gpuCost"`
+	NetworkCost           float64              `json:"networkCost"`
+	LoadBalancerCost      float64              `json:"loadBalancerCost"`
+	PVBytes               float64              `json:"pvBytes"`
+	PVByteHours           float64              `json:"pvByteHours"`
+	PVCost                float64              `json:"pvCost"`
+	RAMBytes              float64              `json:"ramBytes"`
+	RAMByteRequestAverage float64              `json:"ramByteRequestAverage"`
+	RAMByteUsageAverage   float64              `json:"ramByteUsageAverage"`
+	RAMByteHours          float64              `json:"ramByteHours"`
+	RAMCost               float64              `json:"ramCost"`
+	RAMEfficiency         float64              `json:"ramEfficiency"`
+	SharedCost            float64              `json:"sharedCost"`
+	ExternalCost          float64              `json:"externalCost"`
+	TotalCost             float64              `json:"totalCost"`
+	TotalEfficiency       float64              `json:"totalEfficiency"`
+
+	// usage integrated over time, turned into averages once the set is complete
+	cpuUsageHours   float64
+	ramUsageMBHours float64
+}
+
+type AllocationQuery struct {
+	Window AllocationWindow
+	// length of each set, the whole window when 0
+	Step       time.Duration
+	Aggregate  string
+	Accumulate bool
+}
+
+// Parse a Kubecost window relative to now: today, yesterday, week, month,
+// a duration such as 30m, 24h, 7d or 2w ending now, or start,end as RFC 3339 or unix seconds
+// calendar windows are in UTC
+func ParseAllocationWindow(s string, now time.Time) (AllocationWindow, error) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch s {
+	case "today":
+		return AllocationWindow{Start: day, End: now}, nil
+	case "yesterday":
+		return AllocationWindow{Start: day.AddDate(0, 0, -1), End: day}, nil
+	case "week":
+		// weeks start on Monday
+		return AllocationWindow{Start: day.AddDate(0, 0, -(int(now.Weekday())+6)%7), End: now}, nil
+	case "month":
+		return AllocationWindow{Start: day.AddDate(0, 0, 1-now.Day()), End: now}, nil
+	}
+
+	if start, end, ok := strings.Cut(s, ","); ok {
+		from, err := parseWindowTime(start)
+		if err != nil {
+			return AllocationWindow{}, err
+		}
+		to, err := parseWindowTime(end)
+		if err != nil {
+			return AllocationWindow{}, err
+		}
+		if !to.After(from) {
+			return AllocationWindow{}, fmt.Errorf("%w: end must be after start", ErrInvalidWindow)
+		}
+		return AllocationWindow{Start: from, End: to}, nil
+	}
+
+	d, err := ParseWindowDuration(s)
+	if err != nil {
+		return AllocationWindow{}, err
+	}
+	return AllocationWindow{Start: now.Add(-d), End: now}, nil
+}
+
+// Kubecost durations: a positive count of m, h, d or w
+func ParseWindowDuration(s string) (time.Duration, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("%w %q", ErrInvalidWindow, s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%w %q", ErrInvalidWindow, s)
+	}
+	unit := map[byte]time.Duration{'m': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}[s[len(s)-1]]
+	if unit == 0 {
+		return 0, fmt.Errorf("%w %q", ErrInvalidWindow, s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func parseWindowTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("%w time %q", ErrInvalidWindow, s)
+}
+
+// Allocation sets over the decision log, one per step of the window
+func (a *Aggregator) Allocation(ctx context.Context, q AllocationQuery) ([]map[string]*Allocation, error) {
+	events, err := a.ReadEvents(ctx, q.Window.Start, q.Window.End)
+	if err != nil {
+		return nil, err
+	}
+	return BuildAllocations(events, q, a.clusterID())
+}
+
+// each payload counts until the next one for its namespace, the last one until the end of the window
+func BuildAllocations(events []Event, q AllocationQuery, cluster string) ([]map[string]*Allocation, error) {
+	switch q.Aggregate {
+	case AggregateNone, AggregateCluster, AggregateNamespace, AggregateController, AggregateControllerKind, AggregateDeployment:
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedAggregate, q.Aggregate)
+	}
+	windows, err := allocationWindows(q)
+	if err != nil {
+		return nil, err
+	}
+
+	type observation struct {
+		at      time.Time
+		payload CostPayload
+	}
+	payloads := map[string][]observation{}
+	for _, ev := range events {
+		if ev.Type != EventCostPayload {
+			continue
+		}
+		var p CostPayload
+		if err := json.Unmarshal(ev.Data, &p); err != nil {
+			continue
+		}
+		payloads[p.Namespace] = append(payloads[p.Namespace], observation{ev.Time, p})
+	}
+
+	sets := make([]map[string]*Allocation, 0, len(windows))
+	for _, w := range windows {
+		set := map[string]*Allocation{}
+		for _, obs := range payloads {
+			for i, o := range obs {
+				end := q.Window.End
+				if i+1 < len(obs) {
+					end = obs[i+1].at
+				}
+				start := o.at
+				if start.Before(w.Start) {
+					start = w.Start
+				}
+				if end.After(w.End) {
+					end = w.End
+				}
+				if !end.After(start) {
+					continue
+				}
+				for _, d := range o.payload.Deployments {
+					key, props := allocationKey(q.Aggregate, cluster, o.payload.Namespace, d.Name)
+					alloc, ok := set[key]
+					if !ok {
+						alloc = &Allocation{Name: key, Properties: props, Window: w, Start: start, End: end}
+						set[key] = alloc
+					}
+					alloc.add(&o.payload, d, start, end)
+				}
+			}
+		}
+		for _, alloc := range set {
+			alloc.finish()
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// sets the query asks for, a single set for the whole window when accumulating
+func allocationWindows(q AllocationQuery) ([]AllocationWindow, error) {
+	if !q.Window.End.After(q.Window.Start) {
+		return nil, fmt.Errorf("%w: end must be after start", ErrInvalidWindow)
+	}
+	if q.Step <= 0 || q.Accumulate {
+		return []AllocationWindow{q.Window}, nil
+	}
+	if n := q.Window.End.Sub(q.Window.Start) / q.Step; n > maxAllocationSets {
+		return nil, fmt.Errorf("%w: step gives more than %d sets", ErrInvalidWindow, maxAllocationSets)
+	}
+	var windows []AllocationWindow
+	for start := q.Window.Start; start.Before(q.Window.End); start = start.Add(q.Step) {
+		end := start.Add(q.Step)
+		if end.After(q.Window.End) {
+			end = q.Window.End
+		}
+		windows = append(windows, AllocationWindow{Start: start, End: end})
+	}
+	return windows, nil
+}
+
+func allocationKey(aggregate string, cluster string, ns string, name string) (string, AllocationProperties) {
+	controller := AllocationProperties{Cluster: cluster, Controller: name, ControllerKind: "deployment"}
+	switch aggregate {
+	case AggregateCluster:
+		return cluster, AllocationProperties{Cluster: cluster}
+	case AggregateNamespace:
+		return ns, AllocationProperties{Cluster: cluster, Namespace: ns}
+	case AggregateControllerKind:
+		return "deployment", AllocationProperties{Cluster: cluster, ControllerKind: "deployment"}
+	case AggregateController:
+		return "deployment:" + name, controller
+	case AggregateDeployment:
+		return name, controller
+	}
+	controller.Namespace = ns
+	return ns + "/" + name, controller
+}
+
+// add a deployment's requests and usage between start and end
+func (alloc *Allocation) add(p *CostPayload, d CostDeployment, start time.Time, end time.Time) {
+	if start.Before(alloc.Start) {
+		alloc.Start = start
+	}
+	if end.After(alloc.End) {
+		alloc.End = end
+	}
+	h := end.Sub(start).Hours()
+
+	var totalCpu, totalMem float64
+	for _, other := range p.Deployments {
+		totalCpu += other.CurrentRequests.CPUCores
+		totalMem += other.CurrentRequests.MemoryMB
+	}
+	// requestsHourlyCost weighs the cpu and memory shares equally
+	if totalCpu > 0 && totalMem > 0 {
+		alloc.CPUCost += d.CurrentRequests.CPUCores / totalCpu / 2 * p.ClusterInfo.Cost * h
+		alloc.RAMCost += d.CurrentRequests.MemoryMB / totalMem / 2 * p.ClusterInfo.Cost * h
+	}
+	alloc.CPUCoreHours += d.CurrentRequests.CPUCores * h
+	alloc.RAMByteHours += d.CurrentRequests.MemoryMB * bytesPerMB * h
+	alloc.cpuUsageHours += d.CurrentUsage.CPUCores * h
+	alloc.ramUsageMBHours += d.CurrentUsage.MemoryMB * h
+}
+
+const bytesPerMB = 1024 * 1024
+
+func (alloc *Allocation) finish() {
+	hours := alloc.End.Sub(alloc.Start).Hours()
+	alloc.Minutes = hours * 60
+	if hours > 0 {
+		alloc.CPUCoreRequestAverage = alloc.CPUCoreHours / hours
+		alloc.CPUCores = alloc.CPUCoreRequestAverage
+		alloc.CPUCoreUsageAverage = alloc.cpuUsageHours / hours
+		alloc.RAMByteRequestAverage = alloc.RAMByteHours / hours
+		alloc.RAMBytes = alloc.RAMByteRequestAverage
+		alloc.RAMByteUsageAverage = alloc.ramUsageMBHours * bytesPerMB / hours
+	}
+	alloc.CPUEfficiency = ratio(alloc.cpuUsageHours, alloc.CPUCoreHours)
+	alloc.RAMEfficiency = ratio(alloc.ramUsageMBHours*bytesPerMB, alloc.RAMByteHours)
+	alloc.TotalCost = alloc.CPUCost + alloc.RAMCost
+	alloc.TotalEfficiency = ratio(alloc.CPUCost*alloc.CPUEfficiency+alloc.RAMCost*alloc.RAMEfficiency, alloc.TotalCost)
+}
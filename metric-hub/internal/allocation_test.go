@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseAllocationWindow(t *testing.T) {
+	now := time.Date(2025, 1, 8, 15, 30, 0, 0, time.UTC) // a Wednesday
+	for _, tc := range []struct {
+		window     string
+		start, end time.Time
+	}{
+		{"24h", now.Add(-24 * time.Hour), now},
+		{"7d", now.AddDate(0, 0, -7), now},
+		{"today", time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC), now},
+		{"yesterday", time.Date(2025, 1, 7, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)},
+		{"week", time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC), now},
+		{"month", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), now},
+		{"2025-01-01T00:00:00Z,2025-01-02T00:00:00Z", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"1735689600,1735776000", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+	} {
+		w, err := ParseAllocationWindow(tc.window, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.window, err)
+			continue
+		}
+		if !w.Start.Equal(tc.start) || !w.End.Equal(tc.end) {
+			t.Errorf("%s: expected %v to %v, got %v to %v", tc.window, tc.start, tc.end, w.Start, w.End)
+		}
+	}
+
+	for _, window := range []string{"", "0h", "3y", "lastyear", "2025-01-02T00:00:00Z,2025-01-01T00:00:00Z"} {
+		if _, err := ParseAllocationWindow(window, now); !errors.Is(err, ErrInvalidWindow) {
+			t.Errorf("%q: expected an invalid window, got %v", window, err)
+		}
+	}
+}
+
+func costEvent(t *testing.T, at time.Time, p CostPayload) Event {
+	t.Helper()
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Event{Type: EventCostPayload, Time: at, Data: data}
+}
+
+func TestBuildAllocationsSplitsCostBySteps(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := CostPayload{
+		Namespace:   "shop",
+		ClusterInfo: ClusterInfo{Cost: 1},
+		Deployments: []CostDeployment{
+			{Name: "cart", CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1024}, CurrentUsage: Resources{CPUCores: 0.5, MemoryMB: 256}},
+			{Name: "web", CurrentRequests: Resources{CPUCores: 3, MemoryMB: 1024}, CurrentUsage: Resources{CPUCores: 3, MemoryMB: 1024}},
+		},
+	}
+	events := []Event{costEvent(t, start, p)}
+	q := AllocationQuery{Window: AllocationWindow{Start: start, End: start.Add(2 * time.Hour)}, Step: time.Hour}
+
+	sets, err := BuildAllocations(events, q, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 2 {
+		t.Fatalf("expected a set per hour, got %d", len(sets))
+	}
+	cart := sets[1]["shop/cart"]
+	if cart == nil {
+		t.Fatalf("expected shop/cart in the second set, got %v", sets[1])
+	}
+	// a quarter of the cpu and half the memory of a cluster costing 1 an hour
+	if math.Abs(cart.CPUCost-0.125) > 1e-9 || math.Abs(cart.RAMCost-0.25) > 1e-9 || math.Abs(cart.TotalCost-0.375) > 1e-9 {
+		t.Errorf("unexpected costs cpu %f ram %f total %f", cart.CPUCost, cart.RAMCost, cart.TotalCost)
+	}
+	if cart.Minutes != 60 || cart.CPUEfficiency != 0.5 || cart.RAMEfficiency != 0.25 {
+		t.Errorf("unexpected minutes %f or efficiency %f %f", cart.Minutes, cart.CPUEfficiency, cart.RAMEfficiency)
+	}
+	if cart.RAMBytes != 1024*1024*1024 || cart.Properties.Controller != "cart" || cart.Properties.Namespace != "shop" {
+		t.Errorf("unexpected allocation %+v", cart)
+	}
+
+	q.Aggregate, q.Accumulate = AggregateNamespace, true
+	sets, err = BuildAllocations(events, q, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shop := sets[0]["shop"]
+	if len(sets) != 1 || shop == nil || math.Abs(shop.TotalCost-2) > 1e-9 {
+		t.Fatalf("expected one accumulated set costing 2, got %v", sets)
+	}
+
+	q.Aggregate = "pod"
+	if _, err := BuildAllocations(events, q, "prod"); !errors.Is(err, ErrUnsupportedAggregate) {
+		t.Errorf("expected an unsupported aggregate, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+// Package analytics streams the decision log into SQL warehouses for analysis over months of data
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+// Tables written by every sink
+const (
+	EventsTable  = "events"
+	SamplesTable = "deployment_samples"
+)
+
+// One entry of the decision log, data is the event's JSON
+type EventRow struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Data      string    `json:"data"`
+}
+
+// One deployment of an accepted cost payload, flattened for SQL
+type SampleRow struct {
+	EventID         string    `json:"event_id"`
+	Time            time.Time `json:"time"`
+	Namespace       string    `json:"namespace"`
+	Deployment      string    `json:"deployment"`
+	CPURequest      float64   `json:"cpu_request"`
+	CPUUsage        float64   `json:"cpu_usage"`
+	MemoryRequestMB float64   `json:"memory_request_mb"`
+	MemoryUsageMB   float64   `json:"memory_usage_mb"`
+	HourlyCost      float64   `json:"hourly_cost"`
+}
+
+type Batch struct {
+	Events  []EventRow
+	Samples []SampleRow
+}
+
+// A warehouse the decision log is copied into
+// rows may be delivered more than once, sinks dedupe on the event id where they can
+type Sink interface {
+	Name() string
+	// create missing tables, existing ones are left as they are
+	EnsureSchema(ctx context.Context) error
+	Insert(ctx context.Context, b Batch) error
+}
+
+// Rows for a page of the decision log
+func BuildBatch(events []internal.Event) Batch {
+	var b Batch
+	for _, ev := range events {
+		b.Events = append(b.Events, EventRow{ID: ev.ID, Type: ev.Type, Time: ev.Time, Namespace: internal.EventNamespace(ev), Data: string(ev.Data)})
+
+		if ev.Type != internal.EventCostPayload {
+			continue
+		}
+		var p internal.CostPayload
+		if err := json.Unmarshal(ev.Data, &p); err != nil {
+			continue
+		}
+		for _, d := range p.Deployments {
+			b.Samples = append(b.Samples, SampleRow{
+				EventID:         ev.ID,
+				Time:            ev.Time,
+				Namespace:       p.Namespace,
+				Deployment:      d.Name,
+				CPURequest:      d.CurrentRequests.CPUCores,
+				CPUUsage:        d.CurrentUsage.CPUCores,
+				MemoryRequestMB: d.CurrentRequests.MemoryMB,
+				MemoryUsageMB:   d.CurrentUsage.MemoryMB,
+				HourlyCost:      internal.DeploymentHourlyCost(&p, d),
+			})
+		}
+	}
+	return b
+}
+
+// Copies events:log into a sink in batches, resuming from the last delivered entry
+type Streamer struct {
+	Client    *redis.Client
+	Sink      Sink
+	BatchSize int64
+	// time source, the system clock when nil
+	Clock clock.Clock
+
+	schemaReady bool
+}
+
+func NewStreamer(client *redis.Client, sink Sink, batchSize int) *Streamer {
+	return &Streamer{Client: client, Sink: sink, BatchSize: int64(batchSize)}
+}
+
+// Key - analytics:<sink>:cursor, stream ID of the last delivered entry
+func (s *Streamer) cursorKey() string {
+	return "analytics:" + s.Sink.Name() + ":cursor"
+}
+
+// only one replica streams at a time
+func (s *Streamer) lockKey() string {
+	return "analytics:" + s.Sink.Name() + ":lock"
+}
+
+// Run streams new entries every interval until ctx is cancelled
+func (s *Streamer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// held for most of the interval so other replicas skip this period
+		locked, err := s.Client.SetNX(ctx, s.lockKey(), clock.Now(s.Clock).Unix(), interval*9/10).Result()
+		if err != nil {
+			fmt.Printf("[Analytics] %s lock failed %v\n", s.Sink.Name(), err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+		if n, err := s.Flush(ctx); err != nil {
+			fmt.Printf("[Analytics] %s failed after %d events: %v\n", s.Sink.Name(), n, err)
+		}
+	}
+}
+
+// Deliver every entry after the cursor, returns the number delivered
+// the cursor only moves past a batch once the sink accepted it
+func (s *Streamer) Flush(ctx context.Context) (int, error) {
+	if !s.schemaReady {
+		if err := s.Sink.EnsureSchema(ctx); err != nil {
+			return 0, fmt.Errorf("failed to create tables %w", err)
+		}
+		s.schemaReady = true
+	}
+
+	cursor, err := s.Client.Get(ctx, s.cursorKey()).Result()
+	if errors.Is(err, redis.Nil) {
+		cursor = "-"
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to get analytics cursor %w", err)
+	} else {
+		cursor = "(" + cursor
+	}
+
+	delivered := 0
+	for {
+		msgs, err := s.Client.XRangeN(ctx, internal.EventLogKey, cursor, "+", s.BatchSize).Result()
+		if err != nil {
+			return delivered, fmt.Errorf("failed to read event log %w", err)
+		}
+		if len(msgs) == 0 {
+			return delivered, nil
+		}
+		events := make([]internal.Event, 0, len(msgs))
+		for _, m := range msgs {
+			events = append(events, internal.EventFromMessage(m))
+		}
+		if err := s.Sink.Insert(ctx, BuildBatch(events)); err != nil {
+			return delivered, err
+		}
+		last := msgs[len(msgs)-1].ID
+		if err := s.Client.Set(ctx, s.cursorKey(), last, 0).Err(); err != nil {
+			return delivered, fmt.Errorf("[Failed] SET redis: %w", err)
+		}
+		delivered += len(msgs)
+		cursor = "(" + last
+		if int64(len(msgs)) < s.BatchSize {
+			return delivered, nil
+		}
+	}
+}
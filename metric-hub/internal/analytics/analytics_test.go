@@ -0,0 +1,120 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/redis/go-redis/v9"
+)
+
+type memorySink struct {
+	schemas int
+	batches []Batch
+}
+
+func (m *memorySink) Name() string { return "memory" }
+
+func (m *memorySink) EnsureSchema(ctx context.Context) error {
+	m.schemas++
+	return nil
+}
+
+func (m *memorySink) Insert(ctx context.Context, b Batch) error {
+	m.batches = append(m.batches, b)
+	return nil
+}
+
+func TestBuildBatchFlattensCostPayloads(t *testing.T) {
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	payload, _ := json.Marshal(internal.CostPayload{
+		Namespace:   "shop",
+		ClusterInfo: internal.ClusterInfo{Cost: 1},
+		Deployments: []internal.CostDeployment{
+			{Name: "cart", CurrentRequests: internal.Resources{CPUCores: 1, MemoryMB: 512}, CurrentUsage: internal.Resources{CPUCores: 0.25, MemoryMB: 128}},
+		},
+	})
+	job, _ := json.Marshal(map[string]interface{}{"job": map[string]string{"namespace": "batch"}})
+
+	b := BuildBatch([]internal.Event{
+		{ID: "1-0", Type: internal.EventCostPayload, Time: at, Data: payload},
+		{ID: "2-0", Type: internal.EventJobPublished, Time: at, Data: job},
+	})
+
+	if len(b.Events) != 2 || b.Events[0].Namespace != "shop" || b.Events[1].Namespace != "batch" {
+		t.Errorf("unexpected events %+v", b.Events)
+	}
+	if len(b.Samples) != 1 {
+		t.Fatalf("expected 1 sample, got %d", len(b.Samples))
+	}
+	s := b.Samples[0]
+	if s.EventID != "1-0" || s.Deployment != "cart" || s.CPURequest != 1 || s.MemoryUsageMB != 128 {
+		t.Errorf("unexpected sample %+v", s)
+	}
+}
+
+func TestFlushResumesFromCursor(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		client.XAdd(ctx, &redis.XAddArgs{Stream: internal.EventLogKey, Values: map[string]interface{}{"type": internal.EventRuleSaved, "data": "{}"}})
+	}
+
+	sink := &memorySink{}
+	s := NewStreamer(client, sink, 2)
+	n, err := s.Flush(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || len(sink.batches) != 2 || len(sink.batches[1].Events) != 1 {
+		t.Errorf("expected 3 events in 2 batches, got %d in %d", n, len(sink.batches))
+	}
+
+	client.XAdd(ctx, &redis.XAddArgs{Stream: internal.EventLogKey, Values: map[string]interface{}{"type": internal.EventRuleDeleted, "data": "{}"}})
+	n, err = s.Flush(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || sink.batches[2].Events[0].Type != internal.EventRuleDeleted {
+		t.Errorf("expected only the new event, got %d", n)
+	}
+	if sink.schemas != 1 {
+		t.Errorf("expected schema created once, got %d", sink.schemas)
+	}
+}
+
+func TestClickHouseInsertsJSONEachRow(t *testing.T) {
+	var queries, bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		queries = append(queries, r.URL.Query().Get("query"))
+		bodies = append(bodies, string(body))
+		if r.Header.Get("X-ClickHouse-User") != "hub" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClickHouse(srv.URL, "metric_hub", time.Second)
+	c.Username = "hub"
+	err := c.Insert(context.Background(), Batch{Events: []EventRow{{ID: "1-0", Type: "rule_saved"}, {ID: "2-0", Type: "rule_deleted"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queries) != 1 || queries[0] != "INSERT INTO `metric_hub`.events FORMAT JSONEachRow" {
+		t.Errorf("expected one events insert, got %v", queries)
+	}
+	if lines := strings.Split(strings.TrimSpace(bodies[0]), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"id":"2-0"`) {
+		t.Errorf("expected a row per line, got %q", bodies[0])
+	}
+}
@@ -0,0 +1,222 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bigQueryEndpoint = "https://bigquery.googleapis.com/bigquery/v2"
+	// GKE workload identity and GCE service accounts hand out tokens here
+	metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+type bigQueryField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Mode string `json:"mode"`
+}
+
+var bigQuerySchemas = map[string][]bigQueryField{
+	EventsTable: {
+		{"id", "STRING", "REQUIRED"},
+		{"type", "STRING", "REQUIRED"},
+		{"time", "TIMESTAMP", "REQUIRED"},
+		{"namespace", "STRING", "NULLABLE"},
+		{"data", "JSON", "NULLABLE"},
+	},
+	SamplesTable: {
+		{"event_id", "STRING", "REQUIRED"},
+		{"time", "TIMESTAMP", "REQUIRED"},
+		{"namespace", "STRING", "REQUIRED"},
+		{"deployment", "STRING", "REQUIRED"},
+		{"cpu_request", "FLOAT64", "NULLABLE"},
+		{"cpu_usage", "FLOAT64", "NULLABLE"},
+		{"memory_request_mb", "FLOAT64", "NULLABLE"},
+		{"memory_usage_mb", "FLOAT64", "NULLABLE"},
+		{"hourly_cost", "FLOAT64", "NULLABLE"},
+	},
+}
+
+// Streams rows with the BigQuery REST API, authenticated as the pod's service account
+// insert ids let BigQuery drop rows delivered twice within its dedupe window
+type BigQuery struct {
+	Project  string
+	Dataset  string
+	Endpoint string
+	TokenURL string
+	Client   *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func NewBigQuery(project string, dataset string, timeout time.Duration) *BigQuery {
+	return &BigQuery{
+		Project:  project,
+		Dataset:  dataset,
+		Endpoint: bigQueryEndpoint,
+		TokenURL: metadataTokenURL,
+		Client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (b *BigQuery) Name() string {
+	return "bigquery"
+}
+
+// tables are partitioned by day on time
+func (b *BigQuery) EnsureSchema(ctx context.Context) error {
+	dataset := map[string]interface{}{
+		"datasetReference": map[string]string{"projectId": b.Project, "datasetId": b.Dataset},
+	}
+	if err := b.create(ctx, fmt.Sprintf("/projects/%s/datasets", b.Project), dataset); err != nil {
+		return err
+	}
+	for _, table := range []string{EventsTable, SamplesTable} {
+		def := map[string]interface{}{
+			"tableReference":   map[string]string{"projectId": b.Project, "datasetId": b.Dataset, "tableId": table},
+			"schema":           map[string]interface{}{"fields": bigQuerySchemas[table]},
+			"timePartitioning": map[string]string{"type": "DAY", "field": "time"},
+		}
+		if err := b.create(ctx, fmt.Sprintf("/projects/%s/datasets/%s/tables", b.Project, b.Dataset), def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 409 means it already exists
+func (b *BigQuery) create(ctx context.Context, path string, body interface{}) error {
+	resp, err := b.call(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusConflict {
+		return bigQueryError(resp)
+	}
+	return nil
+}
+
+func (b *BigQuery) Insert(ctx context.Context, batch Batch) error {
+	events := make([]bigQueryRow, 0, len(batch.Events))
+	for _, e := range batch.Events {
+		events = append(events, bigQueryRow{InsertID: e.ID, JSON: e})
+	}
+	if err := b.insertAll(ctx, EventsTable, events); err != nil {
+		return err
+	}
+	samples := make([]bigQueryRow, 0, len(batch.Samples))
+	for _, s := range batch.Samples {
+		samples = append(samples, bigQueryRow{InsertID: s.EventID + "/" + s.Namespace + "/" + s.Deployment, JSON: s})
+	}
+	return b.insertAll(ctx, SamplesTable, samples)
+}
+
+type bigQueryRow struct {
+	InsertID string      `json:"insertId"`
+	JSON     interface{} `json:"json"`
+}
+
+func (b *BigQuery) insertAll(ctx context.Context, table string, rows []bigQueryRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	resp, err := b.call(ctx, fmt.Sprintf("/projects/%s/datasets/%s/tables/%s/insertAll", b.Project, b.Dataset, table), map[string]interface{}{"rows": rows})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return bigQueryError(resp)
+	}
+	var result struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode bigquery response: %w", err)
+	}
+	if len(result.InsertErrors) > 0 {
+		first := result.InsertErrors[0]
+		var msg string
+		if len(first.Errors) > 0 {
+			msg = first.Errors[0].Message
+		}
+		return fmt.Errorf("bigquery rejected %d %s rows, row %d: %s", len(result.InsertErrors), table, first.Index, msg)
+	}
+	return nil
+}
+
+func (b *BigQuery) call(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bigquery request: %w", err)
+	}
+	token, err := b.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.Endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build bigquery request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call bigquery: %w", err)
+	}
+	return resp, nil
+}
+
+// cached until a minute before it expires
+func (b *BigQuery) accessToken(ctx context.Context) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.token != "" && time.Now().Before(b.expires) {
+		return b.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.TokenURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("metadata server returned %s", resp.Status)
+	}
+	var t struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("failed to decode access token: %w", err)
+	}
+	b.token = t.AccessToken
+	b.expires = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+	return b.token, nil
+}
+
+func bigQueryError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("bigquery returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
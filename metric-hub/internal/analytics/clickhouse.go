@@ -0,0 +1,118 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Writes through the ClickHouse HTTP interface
+// ReplacingMergeTree drops rows delivered twice when parts merge
+type ClickHouse struct {
+	URL      string
+	Database string
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+func NewClickHouse(url string, database string, timeout time.Duration) *ClickHouse {
+	return &ClickHouse{
+		URL:      url,
+		Database: database,
+		Client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *ClickHouse) Name() string {
+	return "clickhouse"
+}
+
+func (c *ClickHouse) EnsureSchema(ctx context.Context) error {
+	statements := []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteIdent(c.Database)),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+	id String,
+	type LowCardinality(String),
+	time DateTime64(3, 'UTC'),
+	namespace String,
+	data String
+) ENGINE = ReplacingMergeTree PARTITION BY toYYYYMM(time) ORDER BY (type, time, id)`, quoteIdent(c.Database), EventsTable),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+	event_id String,
+	time DateTime64(3, 'UTC'),
+	namespace LowCardinality(String),
+	deployment String,
+	cpu_request Float64,
+	cpu_usage Float64,
+	memory_request_mb Float64,
+	memory_usage_mb Float64,
+	hourly_cost Float64
+) ENGINE = ReplacingMergeTree PARTITION BY toYYYYMM(time) ORDER BY (namespace, deployment, time, event_id)`, quoteIdent(c.Database), SamplesTable),
+	}
+	for _, stmt := range statements {
+		if err := c.exec(ctx, stmt, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ClickHouse) Insert(ctx context.Context, b Batch) error {
+	if err := insertEachRow(ctx, c, EventsTable, b.Events); err != nil {
+		return err
+	}
+	return insertEachRow(ctx, c, SamplesTable, b.Samples)
+}
+
+// one JSON object per line, times are RFC 3339 so best effort parsing is enabled
+func insertEachRow[T any](ctx context.Context, c *ClickHouse, table string, rows []T) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("failed to marshal %s row: %w", table, err)
+		}
+	}
+	return c.exec(ctx, fmt.Sprintf("INSERT INTO %s.%s FORMAT JSONEachRow", quoteIdent(c.Database), table), &body)
+}
+
+var identEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+
+// backquoted so any database name is safe in a statement
+func quoteIdent(name string) string {
+	return "`" + identEscaper.Replace(name) + "`"
+}
+
+// the statement goes in the query string so the body can carry the rows
+func (c *ClickHouse) exec(ctx context.Context, stmt string, body io.Reader) error {
+	params := url.Values{"query": {stmt}, "date_time_input_format": {"best_effort"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.URL, "/")+"/?"+params.Encode(), body)
+	if err != nil {
+		return fmt.Errorf("failed to build clickhouse request: %w", err)
+	}
+	if c.Username != "" {
+		req.Header.Set("X-ClickHouse-User", c.Username)
+		req.Header.Set("X-ClickHouse-Key", c.Password)
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call clickhouse: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("clickhouse returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
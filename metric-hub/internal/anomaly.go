@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+)
+
+// Key - cluster:samples, recent ClusterInfo as JSON, newest first
+const ClusterSamplesKey = "cluster:samples"
+
+// payloads averaged into the cost baseline
+const clusterSamples = 12
+
+const (
+	ReasonClusterCostSpike  = "Cluster Cost Spike"
+	ReasonClusterNodeChange = "Cluster Node Count Change"
+)
+
+// When cluster wide cost or size changes are worth raising
+// the per-deployment thresholds don't see scaling incidents such as a runaway autoscaler
+type AnomalyPolicy struct {
+	// hourly cost rising more than this fraction above the recent average, 0 disables
+	CostSpike float64 `json:"cost_spike" validate:"gte=0"`
+	// node count moving by more than this many nodes since the previous payload, 0 disables
+	NodeChange float64 `json:"node_change" validate:"gte=0"`
+}
+
+func DefaultAnomalyPolicy() AnomalyPolicy {
+	return AnomalyPolicy{CostSpike: 0.5, NodeChange: 3}
+}
+
+// Reasons info is anomalous against samples, newest first
+func clusterAnomalies(samples []ClusterInfo, info ClusterInfo, policy AnomalyPolicy) []string {
+	if len(samples) == 0 {
+		return nil
+	}
+	var reasons []string
+	var total float64
+	for _, s := range samples {
+		total += s.Cost
+	}
+	baseline := total / float64(len(samples))
+	if policy.CostSpike > 0 && baseline > 0 && (info.Cost-baseline)/baseline > policy.CostSpike {
+		reasons = append(reasons, ReasonClusterCostSpike)
+	}
+	if policy.NodeChange > 0 && math.Abs(info.VmCount-samples[0].VmCount) > policy.NodeChange {
+		reasons = append(reasons, ReasonClusterNodeChange)
+	}
+	return reasons
+}
+
+// Compare the payload's cluster info with recent payloads, then record it
+// anomalies are notified and published as notify-only cluster jobs, once per cooldown
+func (a *Aggregator) CheckClusterAnomalies(ctx context.Context, p *CostPayload) {
+	raw, err := a.Client.LRange(ctx, ClusterSamplesKey, 0, clusterSamples-1).Result()
+	if err != nil {
+		fmt.Printf("Failed to load cluster samples %v\n", err)
+		return
+	}
+	samples := make([]ClusterInfo, 0, len(raw))
+	for _, r := range raw {
+		var s ClusterInfo
+		if err := json.Unmarshal([]byte(r), &s); err == nil {
+			samples = append(samples, s)
+		}
+	}
+
+	jsonData, _ := json.Marshal(p.ClusterInfo)
+	pipe := a.Client.TxPipeline()
+	pipe.LPush(ctx, ClusterSamplesKey, jsonData)
+	pipe.LTrim(ctx, ClusterSamplesKey, 0, clusterSamples-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Failed to record cluster sample %v\n", err)
+	}
+
+	if !a.flagsFor(ctx, p.Namespace).Enabled(FamilyClusterAnomaly) {
+		return
+	}
+	policy := a.ActivePolicy(ctx)
+	cooldown := time.Duration(policy.CooldownSeconds) * time.Second
+
+	for _, reason := range clusterAnomalies(samples, p.ClusterInfo, policy.Anomaly) {
+		key := "trigger:cooldown:cluster:" + strings.ToLower(strings.ReplaceAll(reason, " ", "-"))
+		unlock := a.Locks.Lock("cluster")
+		if a.cooldownActive(ctx, key, cooldown) {
+			unlock()
+			fmt.Printf("Cooldown active for %s. Skipping.\n", reason)
+			continue
+		}
+
+		fmt.Printf("Pushing cluster job: %s (%.0f nodes, %.2f/h)\n", reason, p.ClusterInfo.VmCount, p.ClusterInfo.Cost)
+		a.notifyClusterAnomaly(ctx, reason, samples, p.ClusterInfo)
+
+		// nothing for an agent to apply, the job lets queue consumers react
+		job := NewClusterJob(reason, p.ClusterInfo)
+		job.Action = ActionNotifyOnly
+		if err := a.publishJob(ctx, job); errors.Is(err, ErrJobDenied) {
+			fmt.Printf("Cluster job not published: %v\n", err)
+		} else if err != nil {
+			unlock()
+			fmt.Printf("Failed to push cluster job: %v\n", err)
+			continue
+		}
+		a.startCooldown(ctx, key, cooldown)
+		unlock()
+	}
+}
+
+func (a *Aggregator) notifyClusterAnomaly(ctx context.Context, reason string, samples []ClusterInfo, info ClusterInfo) {
+	if a.Notifier == nil {
+		return
+	}
+	cluster := a.clusterID()
+	previous := samples[0]
+	err := a.Notifier.Notify(ctx, notify.Notification{
+		Severity: notify.SeverityWarning,
+		Title:    fmt.Sprintf("%s on %s", reason, cluster),
+		Message: fmt.Sprintf("%s: hourly cost %.2f -> %.2f, nodes %.0f -> %.0f",
+			cluster, previous.Cost, info.Cost, previous.VmCount, info.VmCount),
+		Labels:    map[string]string{"cluster": cluster, "reason": reason},
+		Timestamp: a.now().UTC(),
+		DedupKey:  "cluster:" + cluster + ":" + reason,
+	})
+	if err != nil {
+		fmt.Printf("Failed to send cluster notification %v\n", err)
+	}
+}
@@ -0,0 +1,25 @@
+package internal
+
+import "testing"
+
+func TestClusterAnomalies(t *testing.T) {
+	policy := DefaultAnomalyPolicy()
+	samples := []ClusterInfo{{VmCount: 4, Cost: 0.4}, {VmCount: 4, Cost: 0.5}, {VmCount: 4, Cost: 0.3}}
+
+	if reasons := clusterAnomalies(nil, ClusterInfo{VmCount: 20, Cost: 5}, policy); len(reasons) != 0 {
+		t.Errorf("expected no anomalies without a baseline, got %v", reasons)
+	}
+	if reasons := clusterAnomalies(samples, ClusterInfo{VmCount: 6, Cost: 0.55}, policy); len(reasons) != 0 {
+		t.Errorf("expected no anomalies within the limits, got %v", reasons)
+	}
+
+	reasons := clusterAnomalies(samples, ClusterInfo{VmCount: 10, Cost: 0.9}, policy)
+	if len(reasons) != 2 || reasons[0] != ReasonClusterCostSpike || reasons[1] != ReasonClusterNodeChange {
+		t.Errorf("expected a cost spike and a node change, got %v", reasons)
+	}
+
+	policy.CostSpike = 0
+	if reasons := clusterAnomalies(samples, ClusterInfo{VmCount: 4, Cost: 10}, policy); len(reasons) != 0 {
+		t.Errorf("expected a cost spike of 0 to disable the check, got %v", reasons)
+	}
+}
@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/history"
+	"github.com/redis/go-redis/v9"
+)
+
+const DeploymentArchiveVersion = 1
+
+var ErrArchiveVersion = errors.New("unsupported archive version")
+
+// One deployment's usage history and decision log, portable between namespaces and clusters
+type DeploymentArchive struct {
+	Version    int                         `json:"version"`
+	Cluster    string                      `json:"cluster"`
+	Namespace  string                      `json:"namespace"`
+	Name       string                      `json:"name"`
+	ExportedAt time.Time                   `json:"exported_at"`
+	Samples    []history.Sample            `json:"samples"`
+	Rollups    map[string][]history.Rollup `json:"rollups"`
+	// oldest first, payloads only hold this deployment
+	Events []Event `json:"events"`
+}
+
+// Entries written by an import
+type ArchiveImport struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Samples   int    `json:"samples"`
+	Rollups   int    `json:"rollups"`
+	Events    int    `json:"events"`
+}
+
+// Key - history:events:<namespace>/<name>, imported decision log entries scored by unix millis
+// the stream only takes entries newer than its last one, so imports are kept apart
+func importedEventsKey(deployment string) string {
+	return "history:events:" + deployment
+}
+
+// Bundle a deployment's history and its entries in the decision log, including imported ones
+// nil when the hub holds nothing for the deployment
+func (a *Aggregator) ExportDeployment(ctx context.Context, ns string, name string) (*DeploymentArchive, error) {
+	deployment := history.Deployment(ns, name)
+	samples, rollups, err := a.History.Export(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := a.Client.XRange(ctx, EventLogKey, "-", "+").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log %w", err)
+	}
+	var events []Event
+	for _, m := range msgs {
+		if ev, ok := deploymentEvent(EventFromMessage(m), ns, name); ok {
+			events = append(events, ev)
+		}
+	}
+	imported, err := a.Client.ZRange(ctx, importedEventsKey(deployment), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read imported events %w", err)
+	}
+	for _, raw := range imported {
+		var ev Event
+		if err := json.Unmarshal([]byte(raw), &ev); err == nil {
+			events = append(events, ev)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+
+	if len(samples) == 0 && len(rollups) == 0 && len(events) == 0 {
+		return nil, nil
+	}
+	return &DeploymentArchive{
+		Version:    DeploymentArchiveVersion,
+		Cluster:    a.clusterID(),
+		Namespace:  ns,
+		Name:       name,
+		ExportedAt: a.now(),
+		Samples:    samples,
+		Rollups:    rollups,
+		Events:     events,
+	}, nil
+}
+
+// The event as far as it concerns ns/name
+// payloads are cut down to the deployment, jobs must target it
+func deploymentEvent(ev Event, ns string, name string) (Event, bool) {
+	switch ev.Type {
+	case EventCostPayload, EventForecastPayload:
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(ev.Data, &doc); err != nil {
+			return ev, false
+		}
+		var payloadNs string
+		var deployments []json.RawMessage
+		json.Unmarshal(doc["namespace"], &payloadNs)
+		json.Unmarshal(doc["deployments"], &deployments)
+		if payloadNs != ns {
+			return ev, false
+		}
+		var kept []json.RawMessage
+		for _, d := range deployments {
+			var named struct {
+				Name string `json:"name"`
+			}
+			if json.Unmarshal(d, &named) == nil && named.Name == name {
+				kept = append(kept, d)
+			}
+		}
+		if len(kept) == 0 {
+			return ev, false
+		}
+		doc["deployments"], _ = json.Marshal(kept)
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return ev, false
+		}
+		ev.Data = data
+		return ev, true
+	case EventJobPublished:
+		var job AgentJob
+		err := json.Unmarshal(ev.Data, &job)
+		return ev, err == nil && job.targets(ns, name)
+	case EventJobDenied:
+		var d JobDenial
+		err := json.Unmarshal(ev.Data, &d)
+		return ev, err == nil && d.Job.targets(ns, name)
+	}
+	return ev, false
+}
+
+func (job AgentJob) targets(ns string, name string) bool {
+	return job.Namespace == ns && job.Deployment != nil && job.Deployment.Name == name
+}
+
+// Load an archive as the history of ns/name, which need not be where it was exported from
+// imported entries are merged with what the deployment already has
+func (a *Aggregator) ImportDeployment(ctx context.Context, archive *DeploymentArchive, ns string, name string) (*ArchiveImport, error) {
+	if archive.Version != DeploymentArchiveVersion {
+		return nil, fmt.Errorf("%w %d", ErrArchiveVersion, archive.Version)
+	}
+	deployment := history.Deployment(ns, name)
+	if err := a.History.Import(ctx, deployment, archive.Samples, archive.Rollups); err != nil {
+		return nil, err
+	}
+
+	res := &ArchiveImport{Namespace: ns, Name: name, Samples: len(archive.Samples)}
+	for _, r := range archive.Rollups {
+		res.Rollups += len(r)
+	}
+	if len(archive.Events) == 0 {
+		return res, nil
+	}
+	members := make([]redis.Z, 0, len(archive.Events))
+	for _, ev := range archive.Events {
+		jsonData, err := json.Marshal(ev)
+		if err != nil {
+			return nil, fmt.Errorf("[Failed] to marshal event: %w", err)
+		}
+		members = append(members, redis.Z{Score: float64(ev.Time.UnixMilli()), Member: jsonData})
+	}
+	if err := a.Client.ZAdd(ctx, importedEventsKey(deployment), members...).Err(); err != nil {
+		return nil, fmt.Errorf("[Failed] ZADD redis: %w", err)
+	}
+	res.Events = len(members)
+	return res, nil
+}
+
+// imported entries of deployments in f's namespace before f's time
+func (a *Aggregator) purgeImportedEvents(ctx context.Context, f PurgeFilter, dryRun bool) (int64, error) {
+	if a.History == nil {
+		return 0, nil
+	}
+	deployments, err := a.History.Deployments(ctx)
+	if err != nil {
+		return 0, err
+	}
+	maxScore := "+inf"
+	if !f.Before.IsZero() {
+		maxScore = "(" + strconv.FormatInt(f.Before.UnixMilli(), 10)
+	}
+
+	var removed int64
+	for _, d := range deployments {
+		if f.Namespace != "" && !strings.HasPrefix(d, f.Namespace+"/") {
+			continue
+		}
+		var n int64
+		if dryRun {
+			n, err = a.Client.ZCount(ctx, importedEventsKey(d), "-inf", maxScore).Result()
+		} else {
+			n, err = a.Client.ZRemRangeByScore(ctx, importedEventsKey(d), "-inf", maxScore).Result()
+		}
+		if err != nil {
+			return removed, fmt.Errorf("failed to purge imported events %w", err)
+		}
+		removed += n
+	}
+	return removed, nil
+}
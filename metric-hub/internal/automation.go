@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// confidence in a recommendation judged on instant usage, without usage statistics over a window
+const instantUsageConfidence = 0.8
+
+// How much of a deployment change agents may apply on their own
+// impact is the largest change of the recommended step as a fraction of the current requests
+// confidence is how far the recommendation can be trusted, from 0 to 1
+type AutomationPolicy struct {
+	// tiers are only assigned when enabled, jobs keep their routing's approval otherwise
+	Enabled bool `json:"enabled"`
+	// at most this impact and at least this confidence is applied without review
+	AutoMaxImpact     float64 `json:"auto_max_impact" validate:"gte=0"`
+	AutoMinConfidence float64 `json:"auto_min_confidence" validate:"gte=0,lte=1"`
+	// more than this impact, or less than this confidence, is only reported
+	NotifyMinImpact       float64 `json:"notify_min_impact" validate:"gtefield=AutoMaxImpact"`
+	ApprovalMinConfidence float64 `json:"approval_min_confidence" validate:"gte=0,ltefield=AutoMinConfidence"`
+}
+
+func DefaultAutomationPolicy() AutomationPolicy {
+	return AutomationPolicy{AutoMaxImpact: 0.2, AutoMinConfidence: 0.8, NotifyMinImpact: 0.5, ApprovalMinConfidence: 0.5}
+}
+
+// Tier a deployment job was assigned, Tier is one of the routing approvals
+type AutomationDecision struct {
+	Tier       string  `json:"tier"`
+	Impact     float64 `json:"impact"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Tier for a recommendation's impact and confidence
+func (p AutomationPolicy) Tier(impact float64, confidence float64) string {
+	switch {
+	case impact > p.NotifyMinImpact || confidence < p.ApprovalMinConfidence:
+		return ApprovalNotifyOnly
+	case impact <= p.AutoMaxImpact && confidence >= p.AutoMinConfidence:
+		return ApprovalAuto
+	default:
+		return ApprovalManual
+	}
+}
+
+// largest change of the step against the current requests, a request set for the first time counts as 1
+func recommendationImpact(r *Recommendation) float64 {
+	change := func(current float64, next float64) float64 {
+		if current <= 0 {
+			if next > 0 {
+				return 1
+			}
+			return 0
+		}
+		return math.Abs(next-current) / current
+	}
+	return math.Max(change(r.Current.CPUCores, r.Requests.CPUCores), change(r.Current.MemoryMB, r.Requests.MemoryMB))
+}
+
+// usage statistics over a window are trusted over instant usage
+// the deployment's earlier recommendations count by the share that were applied rather than rolled back or degraded
+func recommendationConfidence(d CostDeployment, history []RecommendationRecord) float64 {
+	confidence := 1.0
+	if d.UsageStats == nil || d.UsageStats.P95 == nil || d.UsageStats.Max == nil {
+		confidence = instantUsageConfidence
+	}
+	// one reported outcome shouldn't decide the tier on its own
+	applied, resolved := 1, 1
+	for _, r := range history {
+		if r.Status == RecommendationPublished {
+			continue
+		}
+		resolved++
+		if r.Status == OutcomeApplied {
+			applied++
+		}
+	}
+	return confidence * float64(applied) / float64(resolved)
+}
+
+// Assign the job its tier, nil when automation is disabled or the job carries no recommendation
+// a tier never loosens the job's action or its routing's approval
+func (a *Aggregator) automationTier(ctx context.Context, job *AgentJob) *AutomationDecision {
+	policy := a.ActivePolicy(ctx).Automation
+	if !policy.Enabled || job.TargetType != TargetDeployment || job.Deployment == nil || job.Recommendation == nil {
+		return nil
+	}
+	history, err := a.RecommendationHistory(ctx, job.Namespace, job.Deployment.Name)
+	if err != nil {
+		fmt.Printf("Failed to load recommendations %v\n", err)
+	}
+	impact := recommendationImpact(job.Recommendation)
+	confidence := recommendationConfidence(*job.Deployment, history)
+	decision := &AutomationDecision{Tier: policy.Tier(impact, confidence), Impact: impact, Confidence: confidence}
+	if decision.Tier == ApprovalNotifyOnly {
+		job.Action = ActionNotifyOnly
+		job.ApplyPlan = nil
+	}
+	return decision
+}
@@ -0,0 +1,53 @@
+package internal
+
+import "testing"
+
+func TestAutomationTiers(t *testing.T) {
+	p := DefaultAutomationPolicy()
+	cases := []struct {
+		impact, confidence float64
+		tier               string
+	}{
+		{0.1, 0.9, ApprovalAuto},
+		{0.2, 0.8, ApprovalAuto},
+		{0.3, 0.9, ApprovalManual},
+		{0.1, 0.6, ApprovalManual},
+		{0.6, 1, ApprovalNotifyOnly},
+		{0.1, 0.4, ApprovalNotifyOnly},
+	}
+	for _, c := range cases {
+		if tier := p.Tier(c.impact, c.confidence); tier != c.tier {
+			t.Errorf("impact %.1f confidence %.1f: expected %s, got %s", c.impact, c.confidence, c.tier, tier)
+		}
+	}
+}
+
+func TestRecommendationImpactAndConfidence(t *testing.T) {
+	r := &Recommendation{
+		Current:  Resources{CPUCores: 0.5, MemoryMB: 0},
+		Requests: Resources{CPUCores: 0.4, MemoryMB: 256},
+	}
+	if impact := recommendationImpact(r); impact != 1 {
+		t.Errorf("expected a first memory request to count as 1, got %.2f", impact)
+	}
+	r.Current.MemoryMB = 512
+	r.Requests.MemoryMB = 448
+	if impact := recommendationImpact(r); impact < 0.19 || impact > 0.21 {
+		t.Errorf("expected the cpu change of 0.2, got %.2f", impact)
+	}
+
+	d := CostDeployment{Name: "cartservice"}
+	if c := recommendationConfidence(d, nil); c != instantUsageConfidence {
+		t.Errorf("expected %.1f for instant usage, got %.2f", instantUsageConfidence, c)
+	}
+	d.UsageStats = &UsageStats{P95: &Resources{}, Max: &Resources{}}
+	history := []RecommendationRecord{
+		{Status: RecommendationPublished},
+		{Status: OutcomeApplied},
+		{Status: OutcomeRolledBack},
+	}
+	// (1 applied + 1) / (2 resolved + 1)
+	if c := recommendationConfidence(d, history); c < 0.66 || c > 0.67 {
+		t.Errorf("expected 2/3 from the track record, got %.2f", c)
+	}
+}
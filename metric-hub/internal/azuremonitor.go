@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/azuremonitor"
+)
+
+const (
+	AzureMonitorSource = "azure-monitor"
+	// Container Insights collects every minute and ingestion lags a few more
+	AzureMonitorLookback = 15 * time.Minute
+)
+
+// Latest value of each container's Perf counters, summed per deployment
+// Perf names a container <cluster resource id>/<pod uid>/<container>, KubePodInventory names it <pod uid>/<container>
+// the deployment is the pod's ReplicaSet without its hash
+const azureDeploymentQuery = `let pods = KubePodInventory
+| where ClusterName == %s and Namespace == %s and ControllerKind == 'ReplicaSet'
+| extend Deployment = replace_regex(ControllerName, @'-[a-z0-9]+$', '')
+| distinct ContainerName, Deployment;
+Perf
+| where ObjectName == 'K8SContainer' and CounterName in ('cpuUsageNanoCores', 'cpuRequestNanoCores', 'memoryWorkingSetBytes', 'memoryRequestBytes')
+| extend parts = split(InstanceName, '/')
+| extend ContainerName = strcat(parts[-2], '/', parts[-1])
+| summarize arg_max(TimeGenerated, CounterValue) by ContainerName, CounterName
+| join kind=inner pods on ContainerName
+| summarize Value = sum(CounterValue), TimeGenerated = max(TimeGenerated) by Deployment, CounterName`
+
+const azureNodeQuery = `KubeNodeInventory
+| where ClusterName == %s
+| summarize Nodes = dcount(Computer)`
+
+// Perf counter to the payload field and its scale, cpu is in nanocores and memory in bytes
+var azureCounters = map[string]struct {
+	scale float64
+	field func(t *pulledTotals) *float64
+}{
+	"cpuUsageNanoCores":     {1e-9, func(t *pulledTotals) *float64 { return &t.CPUUsed }},
+	"cpuRequestNanoCores":   {1e-9, func(t *pulledTotals) *float64 { return &t.CPURequested }},
+	"memoryWorkingSetBytes": {1.0 / (1 << 20), func(t *pulledTotals) *float64 { return &t.MemoryUsed }},
+	"memoryRequestBytes":    {1.0 / (1 << 20), func(t *pulledTotals) *float64 { return &t.MemoryRequested }},
+}
+
+// Pulls the namespace's deployments from the Log Analytics workspace of Azure Monitor for Containers
+type AzureMonitorPuller struct {
+	Client *azuremonitor.Client
+	// cluster name as Container Insights records it
+	Cluster           string
+	Namespace         string
+	HourlyCostPerNode float64
+}
+
+func NewAzureMonitorPuller(c *azuremonitor.Client, cluster string, namespace string, hourlyCostPerNode float64) *AzureMonitorPuller {
+	return &AzureMonitorPuller{Client: c, Cluster: cluster, Namespace: namespace, HourlyCostPerNode: hourlyCostPerNode}
+}
+
+func (p *AzureMonitorPuller) Name() string {
+	return AzureMonitorSource
+}
+
+func (p *AzureMonitorPuller) Poll(ctx context.Context) (*CostPayload, error) {
+	rows, err := p.Client.Query(ctx, fmt.Sprintf(azureDeploymentQuery, kqlString(p.Cluster), kqlString(p.Namespace)), AzureMonitorLookback)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := p.Client.Query(ctx, fmt.Sprintf(azureNodeQuery, kqlString(p.Cluster)), AzureMonitorLookback)
+	if err != nil {
+		return nil, err
+	}
+	return p.Payload(rows, nodes)
+}
+
+// Build the cost payload from the deployment and node query results
+func (p *AzureMonitorPuller) Payload(rows *azuremonitor.Table, nodes *azuremonitor.Table) (*CostPayload, error) {
+	deployments := map[string]*pulledTotals{}
+	var newest time.Time
+
+	for _, rec := range rows.Records() {
+		name, _ := rec["Deployment"].(string)
+		counter, _ := rec["CounterName"].(string)
+		value, _ := rec["Value"].(float64)
+		c, ok := azureCounters[counter]
+		if name == "" || !ok {
+			continue
+		}
+		t := deployments[name]
+		if t == nil {
+			t = &pulledTotals{}
+			deployments[name] = t
+		}
+		*c.field(t) = value * c.scale
+		if raw, ok := rec["TimeGenerated"].(string); ok {
+			if ts, err := time.Parse(time.RFC3339, raw); err == nil && ts.After(newest) {
+				newest = ts
+			}
+		}
+	}
+
+	var nodeCount float64
+	if records := nodes.Records(); len(records) > 0 {
+		nodeCount, _ = records[0]["Nodes"].(float64)
+	}
+	return pulledPayload(AzureMonitorSource, p.Namespace, newest, nodeCount, p.HourlyCostPerNode, deployments)
+}
+
+// KQL string literal
+func kqlString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
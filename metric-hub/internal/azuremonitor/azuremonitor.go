@@ -0,0 +1,199 @@
+// Package azuremonitor runs KQL queries against the Log Analytics workspace Container Insights writes to
+package azuremonitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logAnalyticsEndpoint = "https://api.loganalytics.io"
+	loginEndpoint        = "https://login.microsoftonline.com"
+	// managed identities hand out tokens here
+	imdsTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type Table struct {
+	Name    string          `json:"name"`
+	Columns []Column        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// Rows keyed by column name
+func (t Table) Records() []map[string]interface{} {
+	records := make([]map[string]interface{}, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		rec := make(map[string]interface{}, len(t.Columns))
+		for i, col := range t.Columns {
+			if i < len(row) {
+				rec[col.Name] = row[i]
+			}
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+// Queries a workspace as an Entra ID application, authenticated in this order:
+// a client secret, a federated token file (AKS workload identity), the node's managed identity
+type Client struct {
+	WorkspaceID  string
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	TokenFile    string
+	Endpoint     string
+	LoginURL     string
+	IMDSURL      string
+	Client       *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func NewClient(workspaceID string, tenantID string, clientID string, clientSecret string, timeout time.Duration) *Client {
+	return &Client{
+		WorkspaceID:  workspaceID,
+		TenantID:     tenantID,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenFile:    os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+		Endpoint:     logAnalyticsEndpoint,
+		LoginURL:     loginEndpoint,
+		IMDSURL:      imdsTokenURL,
+		Client:       &http.Client{Timeout: timeout},
+	}
+}
+
+// Run the query over the last timespan, the first table holds the result
+func (c *Client) Query(ctx context.Context, query string, timespan time.Duration) (*Table, error) {
+	data, err := json.Marshal(map[string]string{"query": query, "timespan": isoDuration(timespan)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal log analytics query: %w", err)
+	}
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/v1/workspaces/%s/query", c.Endpoint, url.PathEscape(c.WorkspaceID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build log analytics query: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call log analytics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, azureError("log analytics", resp)
+	}
+
+	var result struct {
+		Tables []Table `json:"tables"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode log analytics response: %w", err)
+	}
+	if len(result.Tables) == 0 {
+		return &Table{}, nil
+	}
+	return &result.Tables[0], nil
+}
+
+// cached until a minute before it expires
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	switch {
+	case c.ClientSecret != "" || c.TokenFile != "":
+		form := url.Values{}
+		form.Set("grant_type", "client_credentials")
+		form.Set("client_id", c.ClientID)
+		form.Set("scope", c.Endpoint+"/.default")
+		if c.ClientSecret != "" {
+			form.Set("client_secret", c.ClientSecret)
+		} else {
+			assertion, err := os.ReadFile(c.TokenFile)
+			if err != nil {
+				return "", fmt.Errorf("failed to read federated token %w", err)
+			}
+			form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+			form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+		}
+		tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", c.LoginURL, url.PathEscape(c.TenantID))
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	default:
+		params := url.Values{}
+		params.Set("api-version", "2018-02-01")
+		params.Set("resource", c.Endpoint)
+		if c.ClientID != "" {
+			params.Set("client_id", c.ClientID)
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, c.IMDSURL+"?"+params.Encode(), nil)
+		if err == nil {
+			req.Header.Set("Metadata", "true")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", azureError("token endpoint", resp)
+	}
+	// the managed identity endpoint returns expires_in as a string
+	var t struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("failed to decode access token: %w", err)
+	}
+	seconds, _ := t.ExpiresIn.Int64()
+	c.token = t.AccessToken
+	c.expires = time.Now().Add(time.Duration(seconds)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+// ISO 8601 duration in whole seconds, e.g. PT600S
+func isoDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%dS", int64(d.Seconds()))
+}
+
+func azureError(service string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s returned %s: %s", service, resp.Status, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,55 @@
+package azuremonitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueryWithManagedIdentity(t *testing.T) {
+	tokens := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/imds":
+			tokens++
+			if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") == "" {
+				t.Errorf("expected a managed identity token request, got %s", r.URL)
+			}
+			// expires_in is a string on this endpoint
+			w.Write([]byte(`{"access_token": "tok", "expires_in": "3599"}`))
+		case "/v1/workspaces/ws-1/query":
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				t.Errorf("expected the bearer token, got %q", r.Header.Get("Authorization"))
+			}
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["timespan"] != "PT900S" {
+				t.Errorf("expected timespan PT900S, got %q", body["timespan"])
+			}
+			w.Write([]byte(`{"tables": [{"name": "PrimaryResult", "columns": [{"name": "Nodes", "type": "long"}], "rows": [[3]]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient("ws-1", "", "", "", time.Second)
+	c.TokenFile = ""
+	c.Endpoint = srv.URL
+	c.IMDSURL = srv.URL + "/imds"
+	for range 2 {
+		table, err := c.Query(context.Background(), "KubeNodeInventory | count", 15*time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if records := table.Records(); len(records) != 1 || records[0]["Nodes"] != 3.0 {
+			t.Errorf("expected 3 nodes, got %v", records)
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("expected the token to be cached, got %d token requests", tokens)
+	}
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/history"
+)
+
+var ErrBackfillFuture = errors.New("backfilled payloads must be in the past")
+
+// Historical cost payloads, oldest first or in any order
+type CostBackfill struct {
+	Payloads []CostPayload `json:"payloads" validate:"required,min=1,max=10000,dive"`
+}
+
+type BackfillResult struct {
+	Payloads    int `json:"payloads"`
+	Deployments int `json:"deployments"`
+	// samples stored raw, rolled up by the compactor as usual
+	Samples int `json:"samples"`
+	// buckets rolled up from samples older than the raw retention
+	Rollups int `json:"rollups"`
+	// buckets the deployments already had, which are kept
+	Skipped int `json:"skipped"`
+}
+
+// Write historical payloads into history without evaluating them
+// nothing is published, cost:latest and cooldowns are untouched and the payloads stay out of the decision log
+func (a *Aggregator) BackfillCost(ctx context.Context, b *CostBackfill) (*BackfillResult, error) {
+	now := a.now()
+	samples := map[string][]history.Sample{}
+	for i := range b.Payloads {
+		p := &b.Payloads[i]
+		if p.Timestamp.After(now) {
+			return nil, fmt.Errorf("%w, payload %d is at %s", ErrBackfillFuture, i, p.Timestamp.Format(time.RFC3339))
+		}
+		batch := historySamples(p)
+		if a.Tenants != nil {
+			batch = a.limitHistory(ctx, p.Namespace, batch)
+		}
+		for d, sample := range batch {
+			samples[d] = append(samples[d], sample)
+		}
+	}
+
+	deployments := make([]string, 0, len(samples))
+	for d := range samples {
+		deployments = append(deployments, d)
+	}
+	sort.Strings(deployments)
+
+	res := &BackfillResult{Payloads: len(b.Payloads), Deployments: len(deployments)}
+	for _, d := range deployments {
+		count, err := a.History.Backfill(ctx, d, samples[d], now)
+		if err != nil {
+			return nil, err
+		}
+		res.Samples += count.Raw
+		res.Rollups += count.Rollups
+		res.Skipped += count.Skipped
+	}
+	// idle and cluster cost are kept by payload time, so old payloads land in their past
+	for i := range b.Payloads {
+		a.recordIdleCost(ctx, &b.Payloads[i])
+		a.recordClusterCost(ctx, &b.Payloads[i])
+	}
+	a.recordEvent(ctx, EventHistoryBackfilled, res)
+	return res, nil
+}
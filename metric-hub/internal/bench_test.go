@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// synthetic payload, every third deployment wastes most of its request and every fifth is at risk
+func benchPayload(n int, ts time.Time) *CostPayload {
+	p := &CostPayload{
+		Timestamp:   ts,
+		Namespace:   "default",
+		ClusterInfo: ClusterInfo{VmCount: 3, Cost: 0.36},
+	}
+	for i := 0; i < n; i++ {
+		usage := 0.6
+		switch {
+		case i%3 == 0:
+			usage = 0.2
+		case i%5 == 0:
+			usage = 0.95
+		}
+		p.Deployments = append(p.Deployments, CostDeployment{
+			Name:            fmt.Sprintf("bench-svc-%03d", i),
+			CurrentRequests: Resources{CPUCores: 0.5, MemoryMB: 512},
+			CurrentUsage:    Resources{CPUCores: 0.5 * usage, MemoryMB: 512 * usage},
+		})
+	}
+	return p
+}
+
+// the pipeline benchmarks need a scratch redis, they overwrite the policy and push to the agent queue
+// BENCH_REDIS_ADDR=localhost:6379 go test -run '^$' -bench . ./metric-hub/internal/
+func benchAggregator(b *testing.B) *Aggregator {
+	addr := os.Getenv("BENCH_REDIS_ADDR")
+	if addr == "" {
+		b.Skip("BENCH_REDIS_ADDR not set")
+	}
+	a := NewAggregator(addr, os.Getenv("BENCH_REDIS_PASS"), "")
+	ctx := context.Background()
+	if err := a.Client.Ping(ctx).Err(); err != nil {
+		b.Skipf("redis unreachable %v", err)
+	}
+
+	// no cooldown, so every iteration takes the full trigger path
+	policy := DefaultPolicy()
+	policy.CooldownSeconds = 0
+	if err := a.SavePolicy(ctx, &policy); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		a.Client.Del(ctx, ActivePolicyKey, AgentQueueKey)
+		a.Client.Close()
+	})
+
+	// the pipeline logs every decision
+	stdout := os.Stdout
+	if devNull, err := os.Open(os.DevNull); err == nil {
+		os.Stdout = devNull
+		b.Cleanup(func() {
+			os.Stdout = stdout
+			devNull.Close()
+		})
+	}
+	return a
+}
+
+func BenchmarkCheckCostThreshold(b *testing.B) {
+	for _, n := range []int{10, 100} {
+		b.Run(fmt.Sprintf("deployments=%d", n), func(b *testing.B) {
+			a := benchAggregator(b)
+			ctx := context.Background()
+			base := time.Now()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// newer snapshots each time, older ones are skipped as stale
+				a.CheckCostThreshold(ctx, benchPayload(n, base.Add(time.Duration(i)*time.Millisecond)))
+				if i%100 == 99 {
+					a.Client.Del(ctx, AgentQueueKey)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPublishJob(b *testing.B) {
+	a := benchAggregator(b)
+	ctx := context.Background()
+	p := benchPayload(1, time.Now())
+	job := NewDeploymentJob("High Memory Waste", p.Namespace, p.Deployments[0], p.ClusterInfo)
+	job.Recommendation = newRecommendation(p.Namespace, p.Deployments[0], DefaultPolicy(), nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := a.publishJob(ctx, job); err != nil {
+			b.Fatal(err)
+		}
+		if i%1000 == 999 {
+			a.Client.Del(ctx, AgentQueueKey)
+		}
+	}
+}
+
+// evaluation without redis, the cpu cost of deciding on one payload
+func BenchmarkCostTriggerReason(b *testing.B) {
+	p := benchPayload(100, time.Now())
+	policy := DefaultPolicy()
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, d := range p.Deployments {
+			costTriggerReason(ctx, d, policy, Ruleset{}, Flags{})
+		}
+	}
+}
+
+func BenchmarkNewRecommendation(b *testing.B) {
+	p := benchPayload(100, time.Now())
+	policy := DefaultPolicy()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, d := range p.Deployments {
+			newRecommendation(p.Namespace, d, policy, nil)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Package billing reads cloud billing exports so the hub's cost estimates can be reconciled with billed cost
+package billing
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Key - billing:correction, the latest reconciliation
+const CorrectionKey = "billing:correction"
+
+// Billing export formats
+const (
+	// AWS Cost and Usage Report, legacy CUR or CUR 2.0 columns
+	ProviderAWS = "aws"
+	// GCP billing export, BigQuery or file export columns
+	ProviderGCP = "gcp"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown billing provider")
+	ErrNoCharges       = errors.New("no charges in billing export")
+)
+
+// columns that may hold each field, the first present is used
+var columns = map[string]struct{ start, end, cost []string }{
+	ProviderAWS: {
+		start: []string{"lineItem/UsageStartDate", "line_item_usage_start_date"},
+		end:   []string{"lineItem/UsageEndDate", "line_item_usage_end_date"},
+		cost:  []string{"lineItem/UnblendedCost", "line_item_unblended_cost"},
+	},
+	ProviderGCP: {
+		start: []string{"usage_start_time", "Start Time"},
+		end:   []string{"usage_end_time", "End Time"},
+		cost:  []string{"cost", "Cost"},
+	},
+}
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05 MST", "2006-01-02 15:04:05", "2006-01-02T15:04Z"}
+
+// Row filter, only rows whose column equals value are counted
+type Filter struct {
+	Column string
+	Value  string
+}
+
+// <column>=<value>, split at the last = since tag columns may contain one
+func ParseFilter(s string) (Filter, error) {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 {
+		return Filter{}, fmt.Errorf("invalid filter %q, expected <column>=<value>", s)
+	}
+	return Filter{Column: s[:i], Value: s[i+1:]}, nil
+}
+
+// Billed cost by hour, in UTC
+type Bill struct {
+	Provider string
+	Hours    map[time.Time]float64
+}
+
+// Parse a billing export CSV, gzipped or not
+// a charge spanning several hours is spread evenly across them
+func Parse(provider string, r io.Reader, filters []Filter) (*Bill, error) {
+	cols, ok := columns[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, provider)
+	}
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read billing header %w", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		// exports saved from spreadsheets start with a byte order mark
+		index[strings.TrimPrefix(name, "\ufeff")] = i
+	}
+	find := func(names []string) int {
+		for _, name := range names {
+			if i, ok := index[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	start, end, cost := find(cols.start), find(cols.end), find(cols.cost)
+	if start < 0 || cost < 0 {
+		return nil, fmt.Errorf("billing export has no %s or %s column", cols.start[0], cols.cost[0])
+	}
+	filterIdx := make([]int, len(filters))
+	for i, f := range filters {
+		if filterIdx[i] = find([]string{f.Column}); filterIdx[i] < 0 {
+			return nil, fmt.Errorf("billing export has no %s column", f.Column)
+		}
+	}
+
+	bill := &Bill{Provider: provider, Hours: map[time.Time]float64{}}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !matches(record, filters, filterIdx) || record[cost] == "" {
+			continue
+		}
+		amount, err := strconv.ParseFloat(record[cost], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid cost %q", line, record[cost])
+		}
+		from, err := parseTime(record[start])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		to := from.Add(time.Hour)
+		if end >= 0 && record[end] != "" {
+			if to, err = parseTime(record[end]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		bill.add(from, to, amount)
+	}
+	if len(bill.Hours) == 0 {
+		return nil, ErrNoCharges
+	}
+	return bill, nil
+}
+
+func matches(record []string, filters []Filter, index []int) bool {
+	for i, f := range filters {
+		if record[index[i]] != f.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+func (b *Bill) add(from time.Time, to time.Time, amount float64) {
+	first := from.Truncate(time.Hour)
+	hours := int(to.Sub(first).Hours())
+	if to.Sub(first) > time.Duration(hours)*time.Hour {
+		hours++
+	}
+	hours = max(hours, 1)
+	for h := 0; h < hours; h++ {
+		b.Hours[first.Add(time.Duration(h)*time.Hour)] += amount / float64(hours)
+	}
+}
+
+// Billed against estimated cost over the hours both cover
+type Correction struct {
+	Provider   string    `json:"provider"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Hours      int       `json:"hours"`
+	Billed     float64   `json:"billed_cost"`
+	Estimated  float64   `json:"estimated_cost"`
+	Factor     float64   `json:"factor"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+func SaveCorrection(ctx context.Context, client *redis.Client, c *Correction) error {
+	jsonData, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal correction: %w", err)
+	}
+	if err := client.Set(ctx, CorrectionKey, jsonData, 0).Err(); err != nil {
+		return fmt.Errorf("[Failed] SET redis: %w", err)
+	}
+	return nil
+}
+
+// nil when no bill has been imported
+func LoadCorrection(ctx context.Context, client *redis.Client) (*Correction, error) {
+	raw, err := client.Get(ctx, CorrectionKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get billing correction %w", err)
+	}
+	var c Correction
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("invalid billing correction %w", err)
+	}
+	return &c, nil
+}
+
+func DeleteCorrection(ctx context.Context, client *redis.Client) error {
+	if err := client.Del(ctx, CorrectionKey).Err(); err != nil {
+		return fmt.Errorf("[Failed] DEL redis: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package billing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cur = `identity/LineItemId,lineItem/UsageStartDate,lineItem/UsageEndDate,lineItem/UnblendedCost,resourceTags/user:eks:cluster-name
+a,2025-01-01T00:00:00Z,2025-01-01T01:00:00Z,0.50,prod
+b,2025-01-01T00:00:00Z,2025-01-01T01:00:00Z,0.25,prod
+c,2025-01-01T00:00:00Z,2025-01-01T01:00:00Z,9.00,staging
+d,2025-01-01T01:00:00Z,2025-01-01T02:00:00Z,0.75,prod
+`
+
+func TestParseCURWithFilter(t *testing.T) {
+	f, err := ParseFilter("resourceTags/user:eks:cluster-name=prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(cur))
+	w.Close()
+
+	for name, body := range map[string][]byte{"csv": []byte(cur), "gzip": gz.Bytes()} {
+		bill, err := Parse(ProviderAWS, bytes.NewReader(body), []Filter{f})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		first := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		if len(bill.Hours) != 2 || bill.Hours[first] != 0.75 || bill.Hours[first.Add(time.Hour)] != 0.75 {
+			t.Errorf("%s: expected 0.75 in each hour of the prod cluster, got %v", name, bill.Hours)
+		}
+	}
+
+	if _, err := Parse(ProviderAWS, strings.NewReader(cur), []Filter{{Column: "missing", Value: "x"}}); err == nil {
+		t.Errorf("expected an error for a filter on a missing column")
+	}
+}
+
+func TestParseGCPSpreadsDailyCharges(t *testing.T) {
+	export := "usage_start_time,usage_end_time,cost\n2025-01-01 00:00:00 UTC,2025-01-02 00:00:00 UTC,4.8\n"
+	bill, err := Parse(ProviderGCP, strings.NewReader(export), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bill.Hours) != 24 {
+		t.Fatalf("expected the charge spread over 24 hours, got %d", len(bill.Hours))
+	}
+	if h := bill.Hours[time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)]; math.Abs(h-0.2) > 1e-9 {
+		t.Errorf("expected 0.2 an hour, got %f", h)
+	}
+
+	if _, err := Parse("azure", strings.NewReader(export), nil); err == nil {
+		t.Errorf("expected an error for an unknown provider")
+	}
+}
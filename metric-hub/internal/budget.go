@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/redis/go-redis/v9"
+)
+
+// Key - budgets
+// Field - <id>, Value - the budget
+const BudgetsKey = "budgets"
+
+// Key - cluster:cost, cluster hourly cost samples scored by payload time in ms
+const ClusterCostKey = "cluster:cost"
+
+// samples are kept long enough for a whole month to date
+const clusterCostRetention = 32 * 24 * time.Hour
+
+// hourly cost samples the spend trend is fitted to
+const budgetTrendWindow = 7 * 24 * time.Hour
+
+var ErrUnknownBudget = errors.New("unknown budget")
+
+// Monthly cap on the cluster's spend, in the currency of its reported cost
+type Budget struct {
+	ID           string  `json:"id"`
+	MonthlyLimit float64 `json:"monthly_limit" validate:"gt=0"`
+}
+
+// Spend projected to the end of the calendar month (UTC)
+type BudgetForecast struct {
+	Budget
+	Month string `json:"month"`
+	// spent since the start of the month, each sample counting until the next one
+	MonthToDate       float64 `json:"month_to_date"`
+	ProjectedMonthEnd float64 `json:"projected_month_end"`
+	// projected month-end spend as a fraction of the limit
+	ProjectedFraction float64 `json:"projected_fraction"`
+	// hourly cost from the trend now, and how much it moves per day
+	HourlyCost   float64 `json:"hourly_cost"`
+	TrendPerDay  float64 `json:"trend_per_day"`
+	TrendSamples int     `json:"trend_samples"`
+	Breached     bool    `json:"breached"`
+	// when the limit was or is projected to be reached this month, nil when it isn't
+	BreachAt    *time.Time `json:"breach_at,omitempty"`
+	GeneratedAt time.Time  `json:"generated_at"`
+}
+
+func (a *Aggregator) SaveBudget(ctx context.Context, b *Budget) error {
+	jsonData, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal budget: %w", err)
+	}
+	if err := a.Client.HSet(ctx, BudgetsKey, b.ID, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) DeleteBudget(ctx context.Context, id string) error {
+	return a.Client.HDel(ctx, BudgetsKey, id).Err()
+}
+
+// Budgets sorted by id
+func (a *Aggregator) ListBudgets(ctx context.Context) ([]Budget, error) {
+	raw, err := a.reader().HGetAll(ctx, BudgetsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budgets %w", err)
+	}
+	budgets := make([]Budget, 0, len(raw))
+	for id, data := range raw {
+		var b Budget
+		if err := json.Unmarshal([]byte(data), &b); err != nil {
+			fmt.Printf("Skipping invalid budget %s: %v\n", id, err)
+			continue
+		}
+		budgets = append(budgets, b)
+	}
+	sort.Slice(budgets, func(i, j int) bool { return budgets[i].ID < budgets[j].ID })
+	return budgets, nil
+}
+
+// best effort like idle cost, a failed write never rejects the payload
+func (a *Aggregator) recordClusterCost(ctx context.Context, p *CostPayload) {
+	jsonData, err := json.Marshal(costSample{Time: p.Timestamp, HourlyCost: p.ClusterInfo.Cost})
+	if err != nil {
+		return
+	}
+	score := strconv.FormatInt(p.Timestamp.UnixMilli(), 10)
+	cutoff := strconv.FormatInt(p.Timestamp.Add(-clusterCostRetention).UnixMilli(), 10)
+
+	pipe := a.Client.TxPipeline()
+	// one sample per payload time, a replayed payload replaces its own sample
+	pipe.ZRemRangeByScore(ctx, ClusterCostKey, score, score)
+	pipe.ZAdd(ctx, ClusterCostKey, redis.Z{Score: float64(p.Timestamp.UnixMilli()), Member: jsonData})
+	pipe.ZRemRangeByScore(ctx, ClusterCostKey, "-inf", "("+cutoff)
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Failed to record cluster cost %v\n", err)
+	}
+}
+
+// samples oldest first
+func (a *Aggregator) clusterCostSamples(ctx context.Context) ([]costSample, error) {
+	raw, err := a.reader().ZRange(ctx, ClusterCostKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster cost %w", err)
+	}
+	samples := make([]costSample, 0, len(raw))
+	for _, r := range raw {
+		var s costSample
+		if err := json.Unmarshal([]byte(r), &s); err == nil {
+			samples = append(samples, s)
+		}
+	}
+	return samples, nil
+}
+
+// Forecast of a budget from the stored cluster cost, ErrNoCostData before the first sample
+func (a *Aggregator) BudgetForecast(ctx context.Context, id string) (*BudgetForecast, error) {
+	raw, err := a.reader().HGet(ctx, BudgetsKey, id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownBudget, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("[Failed] HGET redis: %w", err)
+	}
+	var b Budget
+	if err := json.Unmarshal([]byte(raw), &b); err != nil {
+		return nil, err
+	}
+	samples, err := a.clusterCostSamples(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, ErrNoCostData
+	}
+	return BuildBudgetForecast(b, samples, a.now()), nil
+}
+
+// Month to date from samples oldest first, the rest of the month from a straight line fitted
+// to the last week of hourly cost, never below zero
+func BuildBudgetForecast(b Budget, samples []costSample, now time.Time) *BudgetForecast {
+	now = now.UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	f := &BudgetForecast{Budget: b, Month: monthStart.Format("2006-01"), GeneratedAt: now}
+
+	// spend is a step function, each sample's hourly cost holds until the next one
+	spend := func(from time.Time, to time.Time, rate float64) {
+		if !to.After(from) {
+			return
+		}
+		hours := to.Sub(from).Hours()
+		if f.BreachAt == nil && rate > 0 && f.MonthToDate+rate*hours >= b.MonthlyLimit {
+			at := from.Add(time.Duration((b.MonthlyLimit - f.MonthToDate) / rate * float64(time.Hour)))
+			f.BreachAt = &at
+		}
+		f.MonthToDate += rate * hours
+	}
+	for i, s := range samples {
+		if !s.Time.Before(now) {
+			break
+		}
+		end := now
+		if i+1 < len(samples) && samples[i+1].Time.Before(now) {
+			end = samples[i+1].Time
+		}
+		start := s.Time
+		if start.Before(monthStart) {
+			start = monthStart
+		}
+		spend(start, end, s.HourlyCost)
+	}
+	f.Breached = f.BreachAt != nil
+
+	level, slope, n := costTrend(samples, now)
+	f.HourlyCost, f.TrendPerDay, f.TrendSamples = level, slope*24, n
+	rate := func(t time.Time) float64 {
+		return max(level+slope*t.Sub(now).Hours(), 0)
+	}
+	f.ProjectedMonthEnd = f.MonthToDate
+	for t := now; t.Before(monthEnd); t = t.Add(time.Hour) {
+		end := t.Add(time.Hour)
+		if end.After(monthEnd) {
+			end = monthEnd
+		}
+		r := rate(t.Add(end.Sub(t) / 2))
+		hours := end.Sub(t).Hours()
+		if f.BreachAt == nil && r > 0 && f.ProjectedMonthEnd+r*hours >= b.MonthlyLimit {
+			at := t.Add(time.Duration((b.MonthlyLimit - f.ProjectedMonthEnd) / r * float64(time.Hour)))
+			f.BreachAt = &at
+		}
+		f.ProjectedMonthEnd += r * hours
+	}
+	f.ProjectedFraction = f.ProjectedMonthEnd / b.MonthlyLimit
+	return f
+}
+
+// least squares line through the samples of the trend window, as its value now and its slope per hour
+// fewer than two samples, or samples all at one time, give a flat line at the latest cost
+func costTrend(samples []costSample, now time.Time) (level float64, slope float64, n int) {
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		if s.Time.After(now) {
+			continue
+		}
+		level = s.HourlyCost
+		if s.Time.Before(now.Add(-budgetTrendWindow)) {
+			continue
+		}
+		x := s.Time.Sub(now).Hours()
+		sumX += x
+		sumY += s.HourlyCost
+		sumXY += x * s.HourlyCost
+		sumXX += x * x
+		n++
+	}
+	if n < 2 {
+		return level, 0, n
+	}
+	count := float64(n)
+	denominator := count*sumXX - sumX*sumX
+	if denominator == 0 {
+		return level, 0, n
+	}
+	slope = (count*sumXY - sumX*sumY) / denominator
+	// x is 0 now, so the intercept is the line's value now
+	return (sumY - slope*sumX) / count, slope, n
+}
+
+// warn once a month when a budget is projected to be breached, and again when it is
+func (a *Aggregator) CheckBudgets(ctx context.Context) {
+	budgets, err := a.ListBudgets(ctx)
+	if err != nil || len(budgets) == 0 {
+		return
+	}
+	samples, err := a.clusterCostSamples(ctx)
+	if err != nil {
+		fmt.Printf("Failed to load cluster cost %v\n", err)
+		return
+	}
+	now := a.now()
+	for _, b := range budgets {
+		f := BuildBudgetForecast(b, samples, now)
+		if f.BreachAt == nil {
+			continue
+		}
+		level := "projected"
+		if f.Breached {
+			level = "breached"
+		}
+		// Key - budget:alerted:<id>:<month>:<level>, set once the alert is sent
+		key := fmt.Sprintf("budget:alerted:%s:%s:%s", b.ID, f.Month, level)
+		sent, err := a.Client.SetNX(ctx, key, now.Unix(), clusterCostRetention).Result()
+		if err != nil || !sent {
+			continue
+		}
+		fmt.Printf("Budget %s %s: %.2f of %.2f projected for %s\n", b.ID, level, f.ProjectedMonthEnd, b.MonthlyLimit, f.Month)
+		a.notifyBudget(ctx, f)
+	}
+}
+
+func (a *Aggregator) notifyBudget(ctx context.Context, f *BudgetForecast) {
+	if a.Notifier == nil {
+		return
+	}
+	cluster := a.clusterID()
+	n := notify.Notification{
+		Severity: notify.SeverityWarning,
+		Title:    fmt.Sprintf("Budget %s projected to be exceeded on %s", f.ID, cluster),
+		Message: fmt.Sprintf("%.2f spent of %.2f for %s, %.2f projected by month end, limit reached around %s",
+			f.MonthToDate, f.MonthlyLimit, f.Month, f.ProjectedMonthEnd, f.BreachAt.Format(time.RFC3339)),
+		Labels:    map[string]string{"cluster": cluster, "budget": f.ID},
+		Timestamp: a.now().UTC(),
+		DedupKey:  "budget:" + f.ID + ":" + f.Month,
+	}
+	if f.Breached {
+		n.Severity = notify.SeverityCritical
+		n.Title = fmt.Sprintf("Budget %s exceeded on %s", f.ID, cluster)
+		n.Message = fmt.Sprintf("%.2f spent of %.2f for %s since %s, %.2f projected by month end",
+			f.MonthToDate, f.MonthlyLimit, f.Month, f.BreachAt.Format(time.RFC3339), f.ProjectedMonthEnd)
+	}
+	if err := a.Notifier.Notify(ctx, n); err != nil {
+		fmt.Printf("Failed to send budget notification %v\n", err)
+	}
+}
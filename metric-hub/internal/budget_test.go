@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBudgetForecastProjectsMonthEnd(t *testing.T) {
+	now := time.Date(2025, 1, 11, 0, 0, 0, 0, time.UTC)
+	samples := []costSample{
+		// still the rate when the month starts
+		{Time: time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC), HourlyCost: 1},
+		{Time: time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC), HourlyCost: 2},
+	}
+
+	f := BuildBudgetForecast(Budget{ID: "cloud", MonthlyLimit: 1000}, samples, now)
+	if f.Month != "2025-01" || f.MonthToDate != 96+288 {
+		t.Errorf("expected 384 spent in 2025-01, got %s %v", f.Month, f.MonthToDate)
+	}
+	if f.HourlyCost != 2 || f.TrendPerDay != 0 || f.ProjectedMonthEnd != 384+504*2 {
+		t.Errorf("expected a flat projection at 2/h, got %+v", f)
+	}
+	if f.Breached || f.BreachAt == nil || !f.BreachAt.Equal(time.Date(2025, 1, 23, 20, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the limit reached on 2025-01-23 20:00, got %v", f.BreachAt)
+	}
+
+	f = BuildBudgetForecast(Budget{ID: "cloud", MonthlyLimit: 300}, samples, now)
+	if !f.Breached || !f.BreachAt.Equal(time.Date(2025, 1, 9, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the limit passed on 2025-01-09 06:00, got %v", f.BreachAt)
+	}
+
+	f = BuildBudgetForecast(Budget{ID: "cloud", MonthlyLimit: 1e6}, samples, time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC))
+	if f.BreachAt != nil {
+		t.Errorf("expected no breach, got %v", f.BreachAt)
+	}
+}
+
+func TestCostTrendFitsTheLastWeek(t *testing.T) {
+	now := time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)
+	samples := []costSample{{Time: now.Add(-30 * 24 * time.Hour), HourlyCost: 50}}
+	for i := 0; i < 7; i++ {
+		samples = append(samples, costSample{Time: now.Add(-time.Duration(6-i) * 24 * time.Hour), HourlyCost: float64(1 + i)})
+	}
+
+	level, slope, n := costTrend(samples, now)
+	if n != 7 || math.Abs(level-7) > 1e-9 || math.Abs(slope*24-1) > 1e-9 {
+		t.Errorf("expected 7/h rising 1 a day from 7 samples, got %v %v %d", level, slope*24, n)
+	}
+
+	f := BuildBudgetForecast(Budget{ID: "cloud", MonthlyLimit: 1e6}, samples, now)
+	// the rest of January at 7/h rising 1 a day: 12 days averaging 13/h
+	if math.Abs(f.ProjectedMonthEnd-f.MonthToDate-12*24*13) > 1e-6 {
+		t.Errorf("expected the trend projected, got %v", f.ProjectedMonthEnd-f.MonthToDate)
+	}
+}
@@ -0,0 +1,126 @@
+// Package cache keeps recently read Redis documents in process for a short time
+// so repeated reads of large values under dashboard load don't each go to Redis
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+)
+
+// Least recently used entries are dropped once Size is reached, any entry older than TTL is a miss
+// a nil LRU caches nothing, so callers don't need to check whether caching is enabled
+type LRU[V any] struct {
+	// label on the cache metrics
+	Name string
+	Size int
+	TTL  time.Duration
+	// time source for expiry, the system clock when nil
+	Clock clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// most recently used at the front
+	order *list.List
+}
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+func New[V any](name string, size int, ttl time.Duration) *LRU[V] {
+	return &LRU[V]{
+		Name:    name,
+		Size:    size,
+		TTL:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Cached value for key, false when missing or expired
+func (c *LRU[V]) Get(key string) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		metrics.CacheRequests.WithLabelValues(c.Name, "miss").Inc()
+		return zero, false
+	}
+	e := el.Value.(*entry[V])
+	if !clock.Now(c.Clock).Before(e.expires) {
+		c.remove(el)
+		metrics.CacheRequests.WithLabelValues(c.Name, "miss").Inc()
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	metrics.CacheRequests.WithLabelValues(c.Name, "hit").Inc()
+	return e.value, true
+}
+
+func (c *LRU[V]) Set(key string, value V) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := clock.Now(c.Clock).Add(c.TTL)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry[V])
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry[V]{key: key, value: value, expires: expires})
+	for c.Size > 0 && c.order.Len() > c.Size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Drop key after a local write so the next read goes to Redis
+func (c *LRU[V]) Delete(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Drop everything, e.g. after a snapshot restore rewrote the keyspace
+func (c *LRU[V]) Purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+func (c *LRU[V]) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU[V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry[V]).key)
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+)
+
+func TestGetExpiresAfterTTL(t *testing.T) {
+	c := New[string]("test", 10, 2*time.Second)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	c.Clock = fake
+
+	c.Set("cost:latest", "a")
+	fake.Advance(time.Second)
+	if v, ok := c.Get("cost:latest"); !ok || v != "a" {
+		t.Errorf("expected a hit inside the ttl, got %q %v", v, ok)
+	}
+	fake.Advance(time.Second)
+	if _, ok := c.Get("cost:latest"); ok {
+		t.Errorf("expected a miss once the ttl passed")
+	}
+	if c.Len() != 0 {
+		t.Errorf("expected the expired entry to be dropped, got %d entries", c.Len())
+	}
+}
+
+func TestSetEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[int]("test", 2, time.Minute)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("expected a to be kept after it was read")
+	}
+
+	c.Delete("a")
+	c.Purge()
+	if c.Len() != 0 {
+		t.Errorf("expected an empty cache, got %d entries", c.Len())
+	}
+}
+
+func TestNilCachesNothing(t *testing.T) {
+	var c *LRU[int]
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("expected a nil cache to miss")
+	}
+}
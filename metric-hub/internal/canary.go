@@ -0,0 +1,45 @@
+package internal
+
+// One stage of a staged apply
+type CanaryStage struct {
+	// share of replicas resized by the end of the stage
+	Percent int `json:"percent" validate:"gt=0,lte=100"`
+	// time to watch the resized replicas before the next stage
+	WaitSeconds int64 `json:"wait_seconds" validate:"gte=0"`
+}
+
+// Staged apply agents follow instead of resizing every replica at once
+// no stages keeps the single step apply
+type CanaryPolicy struct {
+	Stages []CanaryStage `json:"stages,omitempty" validate:"omitempty,dive"`
+	// stop and roll back when resized pods restart more than this during a wait
+	MaxRestarts int `json:"max_restarts" validate:"gte=0"`
+}
+
+// Plan carried by a deployment job
+type ApplyPlan struct {
+	Stages      []CanaryStage `json:"stages"`
+	MaxRestarts int           `json:"max_restarts"`
+}
+
+// Plan for a job under the policy, nil when the job isn't applied or no stages are set
+// stages are kept in increasing order and always end at 100%
+func (c CanaryPolicy) Plan(action JobAction) *ApplyPlan {
+	if action != ActionApply || len(c.Stages) == 0 {
+		return nil
+	}
+
+	plan := &ApplyPlan{MaxRestarts: c.MaxRestarts}
+	last := 0
+	for _, s := range c.Stages {
+		if s.Percent <= last {
+			continue
+		}
+		plan.Stages = append(plan.Stages, s)
+		last = s.Percent
+	}
+	if last < 100 {
+		plan.Stages = append(plan.Stages, CanaryStage{Percent: 100})
+	}
+	return plan
+}
@@ -0,0 +1,25 @@
+package internal
+
+import "testing"
+
+func TestCanaryPlanEndsAtFullRollout(t *testing.T) {
+	c := CanaryPolicy{
+		Stages:      []CanaryStage{{Percent: 10, WaitSeconds: 600}, {Percent: 5}, {Percent: 50, WaitSeconds: 900}},
+		MaxRestarts: 2,
+	}
+
+	plan := c.Plan(ActionApply)
+	if plan == nil || len(plan.Stages) != 3 {
+		t.Fatalf("expected 3 stages, got %+v", plan)
+	}
+	if plan.Stages[1].Percent != 50 || plan.Stages[2].Percent != 100 || plan.MaxRestarts != 2 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+
+	if plan := c.Plan(ActionNotifyOnly); plan != nil {
+		t.Errorf("expected no plan for notify only jobs, got %+v", plan)
+	}
+	if plan := (CanaryPolicy{}).Plan(ActionApply); plan != nil {
+		t.Errorf("expected no plan without stages, got %+v", plan)
+	}
+}
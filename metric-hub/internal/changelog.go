@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// records kept per deployment, the oldest are dropped beyond this
+const maxRecommendationRecords = 100
+
+// status of a recommendation no outcome has been reported for, otherwise the reported outcome
+const RecommendationPublished = "published"
+
+// Key - recommendations:<namespace>/<name>
+// Field - <record id>, Value - a published recommendation and what became of it
+func recommendationsKey(ns string, name string) string {
+	return "recommendations:" + deploymentLockKey(ns, name)
+}
+
+// A recommendation sent to agents for a deployment
+type RecommendationRecord struct {
+	ID string `json:"id"`
+	Recommendation
+	Reason string    `json:"reason"`
+	Action JobAction `json:"action"`
+	// published, or the outcome reported for it: applied, rolled_back or degraded
+	Status        string     `json:"status"`
+	Detail        string     `json:"detail,omitempty"`
+	RecommendedAt time.Time  `json:"recommended_at"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+}
+
+// store a published deployment job's recommendation, a job published again keeps one record
+// id is the job's dedup id, or the publish time when it has none
+func (a *Aggregator) recordRecommendation(ctx context.Context, job AgentJob, id string) {
+	if job.Deployment == nil || job.Recommendation == nil {
+		return
+	}
+	now := a.now().UTC()
+	if id == "" {
+		id = strconv.FormatInt(now.UnixNano(), 10)
+	}
+	record := RecommendationRecord{
+		ID:             id,
+		Recommendation: *job.Recommendation,
+		Reason:         job.Reason,
+		Action:         job.Action,
+		Status:         RecommendationPublished,
+		RecommendedAt:  now,
+	}
+	jsonData, err := json.Marshal(record)
+	if err != nil {
+		fmt.Printf("Failed to marshal recommendation %v\n", err)
+		return
+	}
+	// a retried publish must not reset an outcome already reported
+	key := recommendationsKey(job.Namespace, job.Deployment.Name)
+	if err := a.Client.HSetNX(ctx, key, id, jsonData).Err(); err != nil {
+		fmt.Printf("[Failed] HSETNX redis: %v\n", err)
+		return
+	}
+	if n, err := a.Client.HLen(ctx, key).Result(); err == nil && n > maxRecommendationRecords {
+		a.trimRecommendations(ctx, key)
+	}
+}
+
+func (a *Aggregator) saveRecommendationRecord(ctx context.Context, key string, r RecommendationRecord) error {
+	jsonData, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal recommendation: %w", err)
+	}
+	if err := a.Client.HSet(ctx, key, r.ID, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) trimRecommendations(ctx context.Context, key string) {
+	records, err := a.recommendationRecords(ctx, a.Client, key)
+	if err != nil || len(records) <= maxRecommendationRecords {
+		return
+	}
+	stale := make([]string, 0, len(records)-maxRecommendationRecords)
+	for _, r := range records[maxRecommendationRecords:] {
+		stale = append(stale, r.ID)
+	}
+	if err := a.Client.HDel(ctx, key, stale...).Err(); err != nil {
+		fmt.Printf("Failed to trim recommendations %v\n", err)
+	}
+}
+
+// mark the recommendation an outcome is reported for, by job id or else the newest one still published
+func (a *Aggregator) resolveRecommendation(ctx context.Context, o *Outcome) {
+	key := recommendationsKey(o.Namespace, o.Deployment)
+	records, err := a.recommendationRecords(ctx, a.Client, key)
+	if err != nil {
+		fmt.Printf("Failed to load recommendations %v\n", err)
+		return
+	}
+	var match *RecommendationRecord
+	for i := range records {
+		if o.JobID != "" && records[i].ID == o.JobID {
+			match = &records[i]
+			break
+		}
+		if match == nil && records[i].Status == RecommendationPublished {
+			match = &records[i]
+		}
+	}
+	if match == nil {
+		return
+	}
+	now := a.now().UTC()
+	match.Status = o.Outcome
+	match.Detail = o.Detail
+	match.ResolvedAt = &now
+	if err := a.saveRecommendationRecord(ctx, key, *match); err != nil {
+		fmt.Printf("Failed to resolve recommendation %v\n", err)
+	}
+}
+
+// Key - recommendations:<namespace>/<name>, records published before f.Before
+func (a *Aggregator) purgeRecommendations(ctx context.Context, f PurgeFilter, dryRun bool) (int64, error) {
+	pattern := recommendationsKey("*", "*")
+	if f.Namespace != "" {
+		pattern = recommendationsKey(f.Namespace, "*")
+	}
+	var removed int64
+	iter := a.Client.Scan(ctx, 0, pattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		records, err := a.recommendationRecords(ctx, a.Client, key)
+		if err != nil {
+			return removed, err
+		}
+		var ids []string
+		for _, r := range records {
+			if f.Before.IsZero() || r.RecommendedAt.Before(f.Before) {
+				ids = append(ids, r.ID)
+			}
+		}
+		if dryRun || len(ids) == 0 {
+			removed += int64(len(ids))
+			continue
+		}
+		n, err := a.Client.HDel(ctx, key, ids...).Result()
+		if err != nil {
+			return removed, fmt.Errorf("[Failed] HDEL redis: %w", err)
+		}
+		removed += n
+	}
+	if err := iter.Err(); err != nil {
+		return removed, fmt.Errorf("failed to scan recommendations %w", err)
+	}
+	return removed, nil
+}
+
+// newest first
+func (a *Aggregator) recommendationRecords(ctx context.Context, client *redis.Client, key string) ([]RecommendationRecord, error) {
+	raw, err := client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recommendations %w", err)
+	}
+	records := make([]RecommendationRecord, 0, len(raw))
+	for id, v := range raw {
+		var r RecommendationRecord
+		if err := json.Unmarshal([]byte(v), &r); err != nil {
+			fmt.Printf("Skipping invalid recommendation %s: %v\n", id, err)
+			continue
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].RecommendedAt.After(records[j].RecommendedAt) })
+	return records, nil
+}
+
+// Recommendations published for a deployment and their outcomes, newest first
+func (a *Aggregator) RecommendationHistory(ctx context.Context, ns string, name string) ([]RecommendationRecord, error) {
+	return a.recommendationRecords(ctx, a.reader(), recommendationsKey(ns, name))
+}
@@ -0,0 +1,191 @@
+// Package chaos injects faults into the hub's redis client and agent queue for soak and resilience testing
+// faults are held in memory per replica, so a faulty redis can't stop them from being cleared
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+// returned by every injected failure
+var ErrInjected = errors.New("injected fault")
+
+// Faults to inject, the zero value injects nothing
+type Faults struct {
+	// added before every affected redis command
+	RedisLatencyMs int64 `json:"redis_latency_ms" validate:"gte=0"`
+	// fraction of affected redis commands that fail, 1 is an outage
+	RedisErrorRate float64 `json:"redis_error_rate" validate:"gte=0,lte=1"`
+	// lower case command names, e.g. ["get", "set"], every command when empty
+	RedisCommands []string `json:"redis_commands,omitempty"`
+	// fraction of agent queue publishes that fail
+	QueueErrorRate float64 `json:"queue_error_rate" validate:"gte=0,lte=1"`
+	// faults are cleared after this long, 0 keeps them until cleared
+	DurationSeconds int64 `json:"duration_seconds" validate:"gte=0"`
+	// set when DurationSeconds is
+	Until time.Time `json:"until,omitempty"`
+}
+
+func (f Faults) affects(cmd string) bool {
+	if len(f.RedisCommands) == 0 {
+		return true
+	}
+	for _, c := range f.RedisCommands {
+		if strings.EqualFold(c, cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+type Injector struct {
+	mu     sync.Mutex
+	faults Faults
+	rng    *rand.Rand
+}
+
+func NewInjector() *Injector {
+	return &Injector{rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Replace the active faults
+func (i *Injector) Set(f Faults) Faults {
+	if f.DurationSeconds > 0 {
+		f.Until = time.Now().Add(time.Duration(f.DurationSeconds) * time.Second).UTC()
+	} else {
+		f.Until = time.Time{}
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.faults = f
+	fmt.Printf("[Chaos] injecting %+v\n", f)
+	return f
+}
+
+func (i *Injector) Clear() {
+	i.Set(Faults{})
+}
+
+// Active faults, the zero value once they have expired
+func (i *Injector) Get() Faults {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.active()
+}
+
+// caller holds mu
+func (i *Injector) active() Faults {
+	if !i.faults.Until.IsZero() && time.Now().After(i.faults.Until) {
+		i.faults = Faults{}
+	}
+	return i.faults
+}
+
+// latency and whether to fail for one redis command
+func (i *Injector) redisFault(cmd string) (time.Duration, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	f := i.active()
+	if !f.affects(cmd) {
+		return 0, false
+	}
+	return time.Duration(f.RedisLatencyMs) * time.Millisecond, f.RedisErrorRate > 0 && i.rng.Float64() < f.RedisErrorRate
+}
+
+func (i *Injector) queueFault() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	f := i.active()
+	return f.QueueErrorRate > 0 && i.rng.Float64() < f.QueueErrorRate
+}
+
+// wait for the injected latency, returning early when ctx is done
+// failed names the command chosen to fail, empty when none is
+func wait(ctx context.Context, delay time.Duration, failed string) error {
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if failed != "" {
+		metrics.FaultsInjected.WithLabelValues("redis").Inc()
+		return fmt.Errorf("%w: redis %s", ErrInjected, failed)
+	}
+	return nil
+}
+
+// Implements redis.Hook, added with client.AddHook
+func (i *Injector) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (i *Injector) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		delay, fail := i.redisFault(cmd.Name())
+		failed := ""
+		if fail {
+			failed = cmd.Name()
+		}
+		if err := wait(ctx, delay, failed); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+// a pipeline is delayed once and fails as a whole, like a dropped connection would
+func (i *Injector) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		var delay time.Duration
+		failed := ""
+		for _, cmd := range cmds {
+			d, fail := i.redisFault(cmd.Name())
+			if d > delay {
+				delay = d
+			}
+			if fail && failed == "" {
+				failed = cmd.Name()
+			}
+		}
+		if err := wait(ctx, delay, failed); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// Queue fails publishes at the injector's queue error rate
+type Queue struct {
+	Injector *Injector
+	Next     queue.QueueClient
+}
+
+func NewQueue(injector *Injector, next queue.QueueClient) *Queue {
+	return &Queue{Injector: injector, Next: next}
+}
+
+func (q *Queue) PublishJob(ctx context.Context, queueName string, msg *queue.Envelope) error {
+	if q.Injector.queueFault() {
+		metrics.FaultsInjected.WithLabelValues("queue").Inc()
+		return fmt.Errorf("%w: publish to %s", ErrInjected, queueName)
+	}
+	return q.Next.PublishJob(ctx, queueName, msg)
+}
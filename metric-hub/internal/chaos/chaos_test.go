@@ -0,0 +1,68 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+type okQueue struct{ published int }
+
+func (q *okQueue) PublishJob(ctx context.Context, queueName string, msg *queue.Envelope) error {
+	q.published++
+	return nil
+}
+
+func TestRedisOutageOnSelectedCommands(t *testing.T) {
+	inj := NewInjector()
+	inj.Set(Faults{RedisErrorRate: 1, RedisCommands: []string{"get"}})
+	hook := inj.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error { return nil })
+
+	get := redis.NewStringCmd(context.Background(), "get", "cost:latest")
+	if err := hook(context.Background(), get); !errors.Is(err, ErrInjected) || !errors.Is(get.Err(), ErrInjected) {
+		t.Errorf("expected an injected GET failure, got %v", err)
+	}
+	set := redis.NewStatusCmd(context.Background(), "set", "k", "v")
+	if err := hook(context.Background(), set); err != nil {
+		t.Errorf("expected SET to pass, got %v", err)
+	}
+}
+
+func TestRedisLatencyHonoursContext(t *testing.T) {
+	inj := NewInjector()
+	inj.Set(Faults{RedisLatencyMs: 1000})
+	hook := inj.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := hook(ctx, redis.NewStringCmd(ctx, "get", "k"))
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected the deadline to cut the latency short, got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestQueueFailuresAndExpiry(t *testing.T) {
+	inj := NewInjector()
+	next := &okQueue{}
+	q := NewQueue(inj, next)
+
+	inj.Set(Faults{QueueErrorRate: 1})
+	if err := q.PublishJob(context.Background(), "queue:agent:jobs", &queue.Envelope{}); !errors.Is(err, ErrInjected) || next.published != 0 {
+		t.Errorf("expected an injected publish failure, got %v", err)
+	}
+
+	// an expired experiment stops injecting
+	inj.Set(Faults{QueueErrorRate: 1, DurationSeconds: 1})
+	inj.faults.Until = time.Now().Add(-time.Second)
+	if err := q.PublishJob(context.Background(), "queue:agent:jobs", &queue.Envelope{}); err != nil || next.published != 1 {
+		t.Errorf("expected expired faults to be cleared, got %v", err)
+	}
+	if f := inj.Get(); f.QueueErrorRate != 0 {
+		t.Errorf("expected no active faults, got %+v", f)
+	}
+}
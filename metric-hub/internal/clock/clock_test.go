@@ -0,0 +1,30 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeOnlyMovesWhenAdvanced(t *testing.T) {
+	start := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	if !f.Now().Equal(start) {
+		t.Errorf("expected %v, got %v", start, f.Now())
+	}
+
+	f.Advance(30 * time.Minute)
+	if want := start.Add(30 * time.Minute); !f.Now().Equal(want) {
+		t.Errorf("expected %v, got %v", want, f.Now())
+	}
+}
+
+func TestNowFallsBackToSystemClock(t *testing.T) {
+	before := time.Now()
+	if got := Now(nil); got.Before(before) {
+		t.Errorf("expected the system time, got %v", got)
+	}
+	fixed := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := Now(NewFake(fixed)); !got.Equal(fixed) {
+		t.Errorf("expected %v, got %v", fixed, got)
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/cloudwatch"
+)
+
+const (
+	CloudWatchSource = "cloudwatch"
+	// Container Insights publishes every minute, later points may still be missing
+	CloudWatchLookback = 10 * time.Minute
+)
+
+// Container Insights metrics with enhanced observability, PodName is the pod's owning workload
+var cloudWatchMetrics = []struct {
+	id     string
+	metric string
+	// cpu is in millicores and memory in bytes
+	scale float64
+	field func(t *pulledTotals) *float64
+}{
+	{"cpu_used", "pod_cpu_usage_total", 1e-3, func(t *pulledTotals) *float64 { return &t.CPUUsed }},
+	{"cpu_requested", "pod_cpu_request", 1e-3, func(t *pulledTotals) *float64 { return &t.CPURequested }},
+	{"memory_used", "pod_memory_working_set", 1.0 / (1 << 20), func(t *pulledTotals) *float64 { return &t.MemoryUsed }},
+	{"memory_requested", "pod_memory_request", 1.0 / (1 << 20), func(t *pulledTotals) *float64 { return &t.MemoryRequested }},
+}
+
+// Pulls the namespace's deployments from CloudWatch Container Insights
+type CloudWatchPuller struct {
+	Client            *cloudwatch.Client
+	Cluster           string
+	Namespace         string
+	HourlyCostPerNode float64
+	// end of the queried range, the system clock when nil
+	Clock clock.Clock
+}
+
+func NewCloudWatchPuller(c *cloudwatch.Client, cluster string, namespace string, hourlyCostPerNode float64) *CloudWatchPuller {
+	return &CloudWatchPuller{Client: c, Cluster: cluster, Namespace: namespace, HourlyCostPerNode: hourlyCostPerNode}
+}
+
+func (p *CloudWatchPuller) Name() string {
+	return CloudWatchSource
+}
+
+// One Metrics Insights query per metric, summed over the pods of each workload
+func (p *CloudWatchPuller) Queries() []cloudwatch.Query {
+	queries := []cloudwatch.Query{}
+	for _, m := range cloudWatchMetrics {
+		queries = append(queries, cloudwatch.Query{
+			ID: m.id,
+			Expression: fmt.Sprintf(`SELECT SUM(%s) FROM SCHEMA("ContainerInsights", ClusterName, Namespace, PodName) WHERE ClusterName = '%s' AND Namespace = '%s' GROUP BY PodName`,
+				m.metric, p.Cluster, p.Namespace),
+			Period: 60,
+		})
+	}
+	return append(queries, cloudwatch.Query{
+		ID:         "nodes",
+		Expression: fmt.Sprintf(`SELECT MAX(cluster_node_count) FROM SCHEMA("ContainerInsights", ClusterName) WHERE ClusterName = '%s'`, p.Cluster),
+		Period:     60,
+	})
+}
+
+func (p *CloudWatchPuller) Poll(ctx context.Context) (*CostPayload, error) {
+	now := clock.Now(p.Clock)
+	results, err := p.Client.GetMetricData(ctx, p.Queries(), now.Add(-CloudWatchLookback), now)
+	if err != nil {
+		return nil, err
+	}
+	return p.Payload(results)
+}
+
+// Build the cost payload from the latest point of each result
+func (p *CloudWatchPuller) Payload(results []cloudwatch.Result) (*CostPayload, error) {
+	deployments := map[string]*pulledTotals{}
+	var nodes float64
+	var newest time.Time
+
+	for _, r := range results {
+		point, ok := r.Latest()
+		if !ok {
+			continue
+		}
+		if point.Timestamp.After(newest) {
+			newest = point.Timestamp
+		}
+		if r.ID == "nodes" {
+			nodes = point.Value
+			continue
+		}
+
+		t := deployments[r.Label]
+		if t == nil {
+			t = &pulledTotals{}
+			deployments[r.Label] = t
+		}
+		for _, m := range cloudWatchMetrics {
+			if m.id == r.ID {
+				*m.field(t) = point.Value * m.scale
+			}
+		}
+	}
+	return pulledPayload(CloudWatchSource, p.Namespace, newest, nodes, p.HourlyCostPerNode, deployments)
+}
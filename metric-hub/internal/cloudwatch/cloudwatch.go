@@ -0,0 +1,153 @@
+// Package cloudwatch reads CloudWatch metrics over the JSON protocol, signed with SigV4
+package cloudwatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const getMetricDataTarget = "GraniteServiceVersion20100801.GetMetricData"
+
+// A Metrics Insights query, Label of each result is its GROUP BY value
+type Query struct {
+	ID         string `json:"Id"`
+	Expression string `json:"Expression"`
+	// seconds
+	Period int `json:"Period"`
+}
+
+type Result struct {
+	ID     string
+	Label  string
+	Points []Point
+}
+
+type Point struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// Newest point, false when the result has none
+func (r Result) Latest() (Point, bool) {
+	if len(r.Points) == 0 {
+		return Point{}, false
+	}
+	latest := r.Points[0]
+	for _, p := range r.Points[1:] {
+		if p.Timestamp.After(latest.Timestamp) {
+			latest = p
+		}
+	}
+	return latest, true
+}
+
+type Client struct {
+	Region string
+	// monitoring.<region>.amazonaws.com by default
+	Endpoint    string
+	Credentials *CredentialsChain
+	Client      *http.Client
+}
+
+func NewClient(region string, timeout time.Duration) *Client {
+	httpClient := &http.Client{Timeout: timeout}
+	return &Client{
+		Region:      region,
+		Endpoint:    fmt.Sprintf("https://monitoring.%s.amazonaws.com", region),
+		Credentials: &CredentialsChain{Region: region, Client: httpClient},
+		Client:      httpClient,
+	}
+}
+
+type getMetricDataRequest struct {
+	MetricDataQueries []Query `json:"MetricDataQueries"`
+	StartTime         int64   `json:"StartTime"`
+	EndTime           int64   `json:"EndTime"`
+	NextToken         string  `json:"NextToken,omitempty"`
+}
+
+type getMetricDataResponse struct {
+	MetricDataResults []struct {
+		ID         string    `json:"Id"`
+		Label      string    `json:"Label"`
+		Timestamps []float64 `json:"Timestamps"`
+		Values     []float64 `json:"Values"`
+	} `json:"MetricDataResults"`
+	NextToken string `json:"NextToken"`
+}
+
+// GetMetricData for the queries between start and end, following every page
+func (c *Client) GetMetricData(ctx context.Context, queries []Query, start time.Time, end time.Time) ([]Result, error) {
+	byKey := map[string]*Result{}
+	var order []string
+	body := getMetricDataRequest{MetricDataQueries: queries, StartTime: start.Unix(), EndTime: end.Unix()}
+
+	for {
+		var page getMetricDataResponse
+		if err := c.call(ctx, body, &page); err != nil {
+			return nil, err
+		}
+		for _, r := range page.MetricDataResults {
+			key := r.ID + "/" + r.Label
+			result := byKey[key]
+			if result == nil {
+				result = &Result{ID: r.ID, Label: r.Label}
+				byKey[key] = result
+				order = append(order, key)
+			}
+			for i := range min(len(r.Timestamps), len(r.Values)) {
+				sec, frac := math.Modf(r.Timestamps[i])
+				result.Points = append(result.Points, Point{Timestamp: time.Unix(int64(sec), int64(frac*1e9)).UTC(), Value: r.Values[i]})
+			}
+		}
+		if page.NextToken == "" {
+			break
+		}
+		body.NextToken = page.NextToken
+	}
+
+	results := make([]Result, 0, len(order))
+	for _, key := range order {
+		results = append(results, *byKey[key])
+	}
+	return results, nil
+}
+
+func (c *Client) call(ctx context.Context, body interface{}, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cloudwatch request: %w", err)
+	}
+	creds, err := c.Credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint+"/", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build cloudwatch request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", getMetricDataTarget)
+	Sign(req, data, creds, c.Region, "monitoring", time.Now())
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call cloudwatch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("cloudwatch returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode cloudwatch response: %w", err)
+	}
+	return nil
+}
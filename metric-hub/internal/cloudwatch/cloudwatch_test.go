@@ -0,0 +1,60 @@
+package cloudwatch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the IAM ListUsers example from the AWS Signature Version 4 documentation
+func TestSignMatchesAWSExample(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+	Sign(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestGetMetricDataFollowsPages(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("X-Amz-Target") != getMetricDataTarget || !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/monitoring/") {
+			t.Errorf("expected a signed GetMetricData call, got %v", r.Header)
+		}
+		var body getMetricDataRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.NextToken == "" {
+			w.Write([]byte(`{"MetricDataResults": [{"Id": "cpu", "Label": "cartservice", "Timestamps": [1766412240], "Values": [50]}], "NextToken": "2"}`))
+			return
+		}
+		w.Write([]byte(`{"MetricDataResults": [{"Id": "cpu", "Label": "cartservice", "Timestamps": [1766412300], "Values": [70]}]}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient("eu-west-1", time.Second)
+	c.Endpoint = srv.URL
+	results, err := c.GetMetricData(context.Background(), []Query{{ID: "cpu", Expression: "SELECT 1", Period: 60}}, time.Now().Add(-5*time.Minute), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || len(results) != 1 {
+		t.Fatalf("expected one result over 2 pages, got %d results in %d calls", len(results), calls)
+	}
+	if p, _ := results[0].Latest(); p.Value != 70 {
+		t.Errorf("expected latest value 70, got %v", p.Value)
+	}
+}
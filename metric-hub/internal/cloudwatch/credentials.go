@@ -0,0 +1,145 @@
+package cloudwatch
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// zero for static keys
+	Expires time.Time
+}
+
+// Finds credentials the way the AWS SDKs do for a pod, in this order:
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY,
+// IRSA through AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE,
+// EKS Pod Identity through AWS_CONTAINER_CREDENTIALS_FULL_URI
+// temporary credentials are cached until a minute before they expire
+type CredentialsChain struct {
+	Region string
+	// STS endpoint, regional by default
+	STSEndpoint string
+	Client      *http.Client
+
+	mu     sync.Mutex
+	cached Credentials
+}
+
+func (c *CredentialsChain) Retrieve(ctx context.Context) (Credentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return Credentials{AccessKeyID: id, SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached.AccessKeyID != "" && time.Now().Add(time.Minute).Before(c.cached.Expires) {
+		return c.cached, nil
+	}
+
+	var creds Credentials
+	var err error
+	switch {
+	case os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "":
+		creds, err = c.webIdentity(ctx, os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"))
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		creds, err = c.container(ctx, os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"), os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"))
+	default:
+		return Credentials{}, fmt.Errorf("no AWS credentials, set AWS_ACCESS_KEY_ID or use IRSA or EKS Pod Identity")
+	}
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.cached = creds
+	return creds, nil
+}
+
+// AssumeRoleWithWebIdentity, the call is unsigned and authenticated by the projected token
+func (c *CredentialsChain) webIdentity(ctx context.Context, roleARN string, tokenFile string) (Credentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read web identity token %w", err)
+	}
+	endpoint := c.STSEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com", c.Region)
+	}
+	params := url.Values{}
+	params.Set("Action", "AssumeRoleWithWebIdentity")
+	params.Set("Version", "2011-06-15")
+	params.Set("RoleArn", roleARN)
+	params.Set("RoleSessionName", "metric-hub")
+	params.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to build sts request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to call sts: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return Credentials{}, fmt.Errorf("sts returned %s", resp.Status)
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode sts response: %w", err)
+	}
+	r := result.Credentials
+	return Credentials{AccessKeyID: r.AccessKeyID, SecretAccessKey: r.SecretAccessKey, SessionToken: r.SessionToken, Expires: r.Expiration}, nil
+}
+
+// EKS Pod Identity agent, or the ECS task role endpoint
+func (c *CredentialsChain) container(ctx context.Context, uri string, tokenFile string) (Credentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to build credentials request: %w", err)
+	}
+	if tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed to read authorization token %w", err)
+		}
+		req.Header.Set("Authorization", strings.TrimSpace(string(token)))
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get container credentials: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return Credentials{}, fmt.Errorf("credentials endpoint returned %s", resp.Status)
+	}
+
+	var r struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode container credentials: %w", err)
+	}
+	return Credentials{AccessKeyID: r.AccessKeyID, SecretAccessKey: r.SecretAccessKey, SessionToken: r.Token, Expires: r.Expiration}, nil
+}
@@ -0,0 +1,322 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Key - clusters:profiles
+// Field - <cluster>, Value - profile another hub reported for its cluster
+const ClusterProfilesKey = "clusters:profiles"
+
+// Labels clusters are grouped by
+const (
+	ClusterLabelProvider    = "provider"
+	ClusterLabelRegion      = "region"
+	ClusterLabelEnvironment = "environment"
+)
+
+// group of clusters without the label
+const ClusterUnlabelled = "unlabelled"
+
+var (
+	ErrInvalidGroup = errors.New("invalid group")
+	// a profile can't be stored for the cluster this hub computes its own profile for
+	ErrOwnCluster = errors.New("own cluster")
+)
+
+// Where a cluster runs, e.g. aws, eu-west-1 and prod
+type ClusterLabels struct {
+	Provider    string `json:"provider,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Environment string `json:"environment,omitempty"`
+}
+
+func (l ClusterLabels) value(label string) (string, bool) {
+	var v string
+	switch label {
+	case ClusterLabelProvider:
+		v = l.Provider
+	case ClusterLabelRegion:
+		v = l.Region
+	case ClusterLabelEnvironment:
+		v = l.Environment
+	default:
+		return "", false
+	}
+	if v == "" {
+		v = ClusterUnlabelled
+	}
+	return v, true
+}
+
+// Cost and efficiency of a cluster over a window of its decision log
+type ClusterProfile struct {
+	Cluster  string        `json:"cluster" validate:"required"`
+	Labels   ClusterLabels `json:"labels"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Payloads int           `json:"payloads"`
+	// cluster cost over the window, each payload counting until the next one
+	Spend         float64 `json:"spend" validate:"gte=0"`
+	AvgHourlyCost float64 `json:"avg_hourly_cost"`
+	// node vCPU-hours and what each cost, only when node groups are reported
+	VCPUHours       float64  `json:"vcpu_hours" validate:"gte=0"`
+	CostPerVCPUHour *float64 `json:"cost_per_vcpu_hour,omitempty"`
+	// vCPU-hours and GB-hours requested by deployments, and the spend per requested vCPU-hour
+	RequestedVCPUHours       float64 `json:"requested_vcpu_hours" validate:"gte=0"`
+	RequestedMemoryGBHours   float64 `json:"requested_memory_gb_hours" validate:"gte=0"`
+	CostPerRequestedVCPUHour float64 `json:"cost_per_requested_vcpu_hour"`
+	// usage over requests, weighted by time
+	CPUEfficiency    float64 `json:"cpu_efficiency"`
+	MemoryEfficiency float64 `json:"memory_efficiency"`
+	// when another hub's profile was stored, nil for this hub's own cluster
+	ReceivedAt *time.Time `json:"received_at,omitempty"`
+}
+
+// Profile of the clusters sharing a label value
+type ClusterGroup struct {
+	Value                    string   `json:"value"`
+	Clusters                 []string `json:"clusters"`
+	Spend                    float64  `json:"spend"`
+	VCPUHours                float64  `json:"vcpu_hours"`
+	CostPerVCPUHour          *float64 `json:"cost_per_vcpu_hour,omitempty"`
+	RequestedVCPUHours       float64  `json:"requested_vcpu_hours"`
+	CostPerRequestedVCPUHour float64  `json:"cost_per_requested_vcpu_hour"`
+	CPUEfficiency            float64  `json:"cpu_efficiency"`
+	MemoryEfficiency         float64  `json:"memory_efficiency"`
+}
+
+type ClusterComparison struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// cheapest vCPU-hour first, clusters without node groups last
+	Clusters []ClusterProfile `json:"clusters"`
+	GroupBy  string           `json:"group_by,omitempty"`
+	Groups   []ClusterGroup   `json:"groups,omitempty"`
+}
+
+// Profile of this hub's cluster between from and to, or the profile stored for another cluster
+// ErrUnknownCluster when no profile was stored for it
+func (a *Aggregator) ClusterProfile(ctx context.Context, cluster string, from time.Time, to time.Time) (*ClusterProfile, error) {
+	if cluster != a.clusterID() {
+		raw, err := a.reader().HGet(ctx, ClusterProfilesKey, cluster).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w %q", ErrUnknownCluster, cluster)
+		} else if err != nil {
+			return nil, fmt.Errorf("[Failed] HGET redis: %w", err)
+		}
+		var p ClusterProfile
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			return nil, err
+		}
+		return &p, nil
+	}
+	events, err := a.ReadEvents(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	p := BuildClusterProfile(cluster, a.ClusterLabels, events, from, to)
+	return &p, nil
+}
+
+// store the profile another hub exported for its cluster
+func (a *Aggregator) SaveClusterProfile(ctx context.Context, p *ClusterProfile) error {
+	if p.Cluster == a.clusterID() {
+		return fmt.Errorf("%w %q", ErrOwnCluster, p.Cluster)
+	}
+	now := a.now().UTC()
+	p.ReceivedAt = &now
+	jsonData, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal cluster profile: %w", err)
+	}
+	if err := a.Client.HSet(ctx, ClusterProfilesKey, p.Cluster, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) DeleteClusterProfile(ctx context.Context, cluster string) error {
+	return a.Client.HDel(ctx, ClusterProfilesKey, cluster).Err()
+}
+
+func (a *Aggregator) clusterProfiles(ctx context.Context) ([]ClusterProfile, error) {
+	raw, err := a.reader().HGetAll(ctx, ClusterProfilesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster profiles %w", err)
+	}
+	profiles := make([]ClusterProfile, 0, len(raw))
+	for cluster, data := range raw {
+		var p ClusterProfile
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			fmt.Printf("Skipping invalid cluster profile %s: %v\n", cluster, err)
+			continue
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// Compare this hub's cluster between from and to with the stored profiles of other clusters
+// groupBy is empty or a cluster label, the stored profiles keep the windows they were exported with
+func (a *Aggregator) CompareClusters(ctx context.Context, from time.Time, to time.Time, groupBy string) (*ClusterComparison, error) {
+	if _, ok := (ClusterLabels{}).value(groupBy); groupBy != "" && !ok {
+		return nil, fmt.Errorf("%w %q, expected provider, region or environment", ErrInvalidGroup, groupBy)
+	}
+	own, err := a.ClusterProfile(ctx, a.clusterID(), from, to)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := a.clusterProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return BuildClusterComparison(append([]ClusterProfile{*own}, peers...), from, to, groupBy), nil
+}
+
+// Profile from the cost payloads of a decision log window
+// cluster cost and node capacity change with every payload, requests and usage with the next payload of their namespace
+func BuildClusterProfile(cluster string, labels ClusterLabels, events []Event, from time.Time, to time.Time) ClusterProfile {
+	profile := ClusterProfile{Cluster: cluster, Labels: labels, From: from.UTC(), To: to.UTC()}
+	type observation struct {
+		at      time.Time
+		payload CostPayload
+	}
+	var observations []observation
+	for _, ev := range events {
+		if ev.Type != EventCostPayload {
+			continue
+		}
+		var p CostPayload
+		if err := json.Unmarshal(ev.Data, &p); err != nil {
+			continue
+		}
+		observations = append(observations, observation{ev.Time, p})
+	}
+	profile.Payloads = len(observations)
+	if len(observations) == 0 {
+		return profile
+	}
+
+	var hours, vcpus, pricedSpend float64
+	for i, o := range observations {
+		end := to
+		if i+1 < len(observations) {
+			end = observations[i+1].at
+		}
+		if capacity, ok := clusterAllocatable(o.payload.NodeGroups); ok {
+			vcpus = capacity.CPUCores
+		}
+		h := end.Sub(o.at).Hours()
+		if h <= 0 {
+			continue
+		}
+		hours += h
+		profile.Spend += o.payload.ClusterInfo.Cost * h
+		// only the hours node groups were reported for are priced per vCPU
+		if vcpus > 0 {
+			profile.VCPUHours += vcpus * h
+			pricedSpend += o.payload.ClusterInfo.Cost * h
+		}
+	}
+	profile.AvgHourlyCost = hourlyOver(profile.Spend, hours)
+	if profile.VCPUHours > 0 {
+		cost := pricedSpend / profile.VCPUHours
+		profile.CostPerVCPUHour = &cost
+	}
+
+	var usedCPU, usedMemory float64
+	next := map[string]time.Time{}
+	for i := len(observations) - 1; i >= 0; i-- {
+		o := observations[i]
+		end, ok := next[o.payload.Namespace]
+		if !ok {
+			end = to
+		}
+		next[o.payload.Namespace] = o.at
+		h := end.Sub(o.at).Hours()
+		if h <= 0 {
+			continue
+		}
+		for _, d := range o.payload.Deployments {
+			profile.RequestedVCPUHours += d.CurrentRequests.CPUCores * h
+			profile.RequestedMemoryGBHours += d.CurrentRequests.MemoryMB / 1024 * h
+			usedCPU += d.CurrentUsage.CPUCores * h
+			usedMemory += d.CurrentUsage.MemoryMB / 1024 * h
+		}
+	}
+	profile.CostPerRequestedVCPUHour = ratio(profile.Spend, profile.RequestedVCPUHours)
+	profile.CPUEfficiency = ratio(usedCPU, profile.RequestedVCPUHours)
+	profile.MemoryEfficiency = ratio(usedMemory, profile.RequestedMemoryGBHours)
+	return profile
+}
+
+func BuildClusterComparison(profiles []ClusterProfile, from time.Time, to time.Time, groupBy string) *ClusterComparison {
+	sortClusterProfiles(profiles)
+	c := &ClusterComparison{From: from.UTC(), To: to.UTC(), Clusters: profiles, GroupBy: groupBy}
+	if groupBy == "" {
+		return c
+	}
+
+	groups := map[string]*ClusterGroup{}
+	// spend of the hours priced per vCPU, usage in requested hours
+	pricedSpend := map[string]float64{}
+	var usedCPU, usedMemory, requestedMemory = map[string]float64{}, map[string]float64{}, map[string]float64{}
+	for _, p := range profiles {
+		value, _ := p.Labels.value(groupBy)
+		g := groups[value]
+		if g == nil {
+			g = &ClusterGroup{Value: value}
+			groups[value] = g
+		}
+		g.Clusters = append(g.Clusters, p.Cluster)
+		g.Spend += p.Spend
+		g.VCPUHours += p.VCPUHours
+		g.RequestedVCPUHours += p.RequestedVCPUHours
+		if p.CostPerVCPUHour != nil {
+			pricedSpend[value] += *p.CostPerVCPUHour * p.VCPUHours
+		}
+		usedCPU[value] += p.CPUEfficiency * p.RequestedVCPUHours
+		usedMemory[value] += p.MemoryEfficiency * p.RequestedMemoryGBHours
+		requestedMemory[value] += p.RequestedMemoryGBHours
+	}
+	for value, g := range groups {
+		if g.VCPUHours > 0 {
+			cost := pricedSpend[value] / g.VCPUHours
+			g.CostPerVCPUHour = &cost
+		}
+		g.CostPerRequestedVCPUHour = ratio(g.Spend, g.RequestedVCPUHours)
+		g.CPUEfficiency = ratio(usedCPU[value], g.RequestedVCPUHours)
+		g.MemoryEfficiency = ratio(usedMemory[value], requestedMemory[value])
+		c.Groups = append(c.Groups, *g)
+	}
+	sort.Slice(c.Groups, func(i, j int) bool {
+		return cheaper(c.Groups[i].CostPerVCPUHour, c.Groups[j].CostPerVCPUHour, c.Groups[i].Value < c.Groups[j].Value)
+	})
+	return c
+}
+
+func sortClusterProfiles(profiles []ClusterProfile) {
+	sort.Slice(profiles, func(i, j int) bool {
+		return cheaper(profiles[i].CostPerVCPUHour, profiles[j].CostPerVCPUHour, profiles[i].Cluster < profiles[j].Cluster)
+	})
+}
+
+// a is cheaper than b, unknown costs last, tie when both are equal
+func cheaper(a *float64, b *float64, tie bool) bool {
+	switch {
+	case a != nil && b != nil && *a != *b:
+		return *a < *b
+	case (a == nil) != (b == nil):
+		return a != nil
+	default:
+		return tie
+	}
+}
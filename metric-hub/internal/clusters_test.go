@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestClusterProfilePricesVCPUHours(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(at time.Duration, p CostPayload) Event {
+		data, _ := json.Marshal(p)
+		return Event{Type: EventCostPayload, Time: base.Add(at), Data: data}
+	}
+	payload := func(ns string, cost float64, nodes int) CostPayload {
+		p := CostPayload{
+			Namespace:   ns,
+			ClusterInfo: ClusterInfo{Cost: cost},
+			Deployments: []CostDeployment{{
+				Name:            "app",
+				CurrentRequests: Resources{CPUCores: 2, MemoryMB: 2048},
+				CurrentUsage:    Resources{CPUCores: 1, MemoryMB: 512},
+			}},
+		}
+		if nodes > 0 {
+			p.NodeGroups = []NodeGroup{{Name: "general", NodeCount: nodes, NodeCapacity: Resources{CPUCores: 4, MemoryMB: 16384}}}
+		}
+		return p
+	}
+
+	// an hour without node groups, then two hours of 2 and 3 nodes
+	events := []Event{
+		event(0, payload("shop", 2, 0)),
+		event(time.Hour, payload("shop", 4, 2)),
+		event(2*time.Hour, payload("batch", 6, 3)),
+	}
+	labels := ClusterLabels{Provider: "aws", Region: "eu-west-1"}
+	p := BuildClusterProfile("prod-eu", labels, events, base, base.Add(3*time.Hour))
+	if p.Payloads != 3 || p.Spend != 12 || p.AvgHourlyCost != 4 || p.Labels != labels {
+		t.Errorf("expected 12 spent over 3 payloads, got %+v", p)
+	}
+	if p.VCPUHours != 20 || p.CostPerVCPUHour == nil || *p.CostPerVCPUHour != 0.5 {
+		t.Errorf("expected 10 spent over 20 vCPU-hours, got %v %v", p.VCPUHours, p.CostPerVCPUHour)
+	}
+	// shop requests 2 cores for 3 hours, batch for its last hour
+	if p.RequestedVCPUHours != 8 || p.RequestedMemoryGBHours != 8 || p.CostPerRequestedVCPUHour != 1.5 {
+		t.Errorf("expected 8 requested vCPU-hours, got %+v", p)
+	}
+	if p.CPUEfficiency != 0.5 || p.MemoryEfficiency != 0.25 {
+		t.Errorf("expected usage at half the cpu and a quarter of the memory, got %v %v", p.CPUEfficiency, p.MemoryEfficiency)
+	}
+
+	empty := BuildClusterProfile("prod-eu", labels, nil, base, base.Add(time.Hour))
+	if empty.Payloads != 0 || empty.Spend != 0 || empty.CostPerVCPUHour != nil {
+		t.Errorf("expected an empty profile, got %+v", empty)
+	}
+}
+
+func TestClusterComparisonGroupsByLabel(t *testing.T) {
+	cost := func(v float64) *float64 { return &v }
+	profiles := []ClusterProfile{
+		{Cluster: "gke-prod", Labels: ClusterLabels{Provider: "gcp"}, Spend: 25, VCPUHours: 100, CostPerVCPUHour: cost(0.25),
+			RequestedVCPUHours: 60, CPUEfficiency: 0.5},
+		{Cluster: "eks-prod", Labels: ClusterLabels{Provider: "aws"}, Spend: 40, VCPUHours: 100, CostPerVCPUHour: cost(0.4),
+			RequestedVCPUHours: 80, CPUEfficiency: 0.25},
+		{Cluster: "eks-dev", Labels: ClusterLabels{Provider: "aws"}, Spend: 20, VCPUHours: 100, CostPerVCPUHour: cost(0.2),
+			RequestedVCPUHours: 20, CPUEfficiency: 1},
+		{Cluster: "on-prem", Spend: 10, RequestedVCPUHours: 10},
+	}
+
+	c := BuildClusterComparison(profiles, time.Time{}, time.Time{}, ClusterLabelProvider)
+	order := []string{"eks-dev", "gke-prod", "eks-prod", "on-prem"}
+	for i, name := range order {
+		if c.Clusters[i].Cluster != name {
+			t.Fatalf("expected clusters cheapest vCPU-hour first %v, got %+v", order, c.Clusters)
+		}
+	}
+	if len(c.Groups) != 3 {
+		t.Fatalf("expected 3 providers, got %+v", c.Groups)
+	}
+	aws := c.Groups[1]
+	if aws.Value != "aws" || aws.Spend != 60 || aws.VCPUHours != 200 || math.Abs(*aws.CostPerVCPUHour-0.3) > 1e-9 {
+		t.Errorf("expected aws at 0.3 per vCPU-hour, got %+v", aws)
+	}
+	if aws.CostPerRequestedVCPUHour != 0.6 || math.Abs(aws.CPUEfficiency-0.4) > 1e-9 {
+		t.Errorf("expected aws efficiency weighted by requests, got %+v", aws)
+	}
+	if c.Groups[0].Value != "gcp" || c.Groups[2].Value != ClusterUnlabelled || c.Groups[2].CostPerVCPUHour != nil {
+		t.Errorf("expected gcp first and unlabelled clusters last, got %+v", c.Groups)
+	}
+
+	if c := BuildClusterComparison(profiles, time.Time{}, time.Time{}, ""); c.Groups != nil {
+		t.Errorf("expected no groups without group_by, got %+v", c.Groups)
+	}
+}
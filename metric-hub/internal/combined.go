@@ -0,0 +1,28 @@
+package internal
+
+import "context"
+
+// Store a cost payload whose deployments carry predicted_peak_24h and evaluate usage and predictions in one pass
+// for producers that have both, there is no separate forecast push to merge
+// deployments without a prediction are evaluated on usage alone
+func (a *Aggregator) SaveCombinedPayload(ctx context.Context, p *CostPayload) error {
+	if err := a.storeCost(ctx, p); err != nil {
+		return err
+	}
+	a.costSaved(ctx, p, combinedForecast(p))
+	return nil
+}
+
+// the predictions of a combined payload as a forecast push, nil when it has none
+func combinedForecast(p *CostPayload) *ForecastPayload {
+	var deployments []ForecastDeployment
+	for _, d := range p.Deployments {
+		if d.PredictPeak24h != nil {
+			deployments = append(deployments, ForecastDeployment{Name: d.Name, PredictPeak24h: *d.PredictPeak24h})
+		}
+	}
+	if len(deployments) == 0 {
+		return nil
+	}
+	return &ForecastPayload{Source: p.Source, Timestamp: p.Timestamp, Namespace: p.Namespace, Deployments: deployments}
+}
@@ -0,0 +1,404 @@
+// Package config is the hub's configuration as one typed document
+// it is loaded from a YAML file or, for deployments predating the file, from environment variables
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/datadog"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/kube"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/transform"
+	"sigs.k8s.io/yaml"
+)
+
+type Config struct {
+	Server Server `json:"server"`
+	Redis  Redis  `json:"redis"`
+	// saved as the active policy at startup, the stored policy is kept when left out
+	// fields left out keep their default values
+	Thresholds    *internal.Policy `json:"thresholds,omitempty"`
+	Scoring       Scoring          `json:"scoring"`
+	Queue         Queue            `json:"queue"`
+	Notifications Notifications    `json:"notifications"`
+	Analytics     Analytics        `json:"analytics"`
+	Datadog       Datadog          `json:"datadog"`
+	CloudWatch    CloudWatch       `json:"cloudwatch"`
+	AzureMonitor  AzureMonitor     `json:"azure_monitor"`
+	// rewrites every pushed or ingested payload before it is saved, steps run in order
+	Pipeline transform.Pipeline `json:"pipeline,omitempty" validate:"dive"`
+}
+
+type Server struct {
+	Port int `json:"port" validate:"gt=0,lte=65535"`
+	// cluster this hub reports on
+	ClusterID string `json:"cluster_id"`
+	// provider, region and environment of the cluster, clusters are compared by them
+	ClusterLabels internal.ClusterLabels `json:"cluster_labels"`
+	// ISO 4217 code of the costs in cost payloads, written to FOCUS exports
+	Currency string `json:"currency" validate:"len=3,uppercase"`
+	// enforce per-tenant quotas
+	MultiTenant bool `json:"multi_tenant"`
+	// write published jobs as Kubernetes Events, in-cluster only
+	KubeEvents bool `json:"kube_events"`
+	// export the latest cost payload per deployment on /metrics, one series per deployment and metric
+	CostMetrics bool `json:"cost_metrics"`
+	// serve /api/v1/admin/faults for soak and resilience testing, never in production
+	FaultInjection bool `json:"fault_injection"`
+	// serve POST /api/v1/admin/restore, which overwrites hub state
+	AllowRestore bool `json:"allow_restore"`
+	// largest push body read, larger bodies get 413 before they are read in full, 0 leaves it off
+	MaxBodyBytes int `json:"max_body_bytes" validate:"gte=0"`
+	// admission webhooks are served on WebhookPort when both are set
+	WebhookPort           int          `json:"webhook_port" validate:"gt=0,lte=65535"`
+	WebhookTLSCert        string       `json:"webhook_tls_cert" validate:"required_with=WebhookTLSKey"`
+	WebhookTLSKey         string       `json:"webhook_tls_key" validate:"required_with=WebhookTLSCert"`
+	SavingsDigestInterval Duration     `json:"savings_digest_interval" validate:"gt=0"`
+	PolicySource          PolicySource `json:"policy_source"`
+	// threshold checks after a push, they outlive the request that started them
+	EvaluationTimeout Duration `json:"evaluation_timeout" validate:"gt=0"`
+	// evaluate the latest payloads on this interval instead of after every push, 0 evaluates each push
+	EvaluationInterval Duration `json:"evaluation_interval" validate:"gte=0"`
+	// deployments per evaluation shard, larger payloads are split, 0 never splits
+	ShardSize    int `json:"shard_size" validate:"gte=0"`
+	ShardWorkers int `json:"shard_workers" validate:"gt=0"`
+	// shards are claimed through redis and replicas help with payloads they didn't receive
+	ShardClaims bool `json:"shard_claims"`
+	// writing the Kubernetes Event for a published job
+	KubeEventTimeout Duration `json:"kube_event_timeout" validate:"gt=0"`
+	// only the replica holding the leader lease publishes jobs
+	LeaderElection bool     `json:"leader_election"`
+	LeaseDuration  Duration `json:"lease_duration" validate:"gt=0"`
+	// list namespaces and deployments through the API server, in-cluster only
+	Discovery Discovery `json:"discovery"`
+	// trigger reason per Alertmanager alert name, unmapped alerts trigger with "Alert: <alertname>"
+	AlertReasons map[string]string `json:"alert_reasons"`
+	// aggregate numbers only, for dashboards and TVs, unauthenticated
+	StatusPage StatusPage `json:"status_page"`
+	// deployments with implausible figures don't trigger, nor do payloads scoring below min_score
+	DataQuality internal.QualityChecks `json:"data_quality"`
+}
+
+type Discovery struct {
+	Enabled  bool     `json:"enabled"`
+	Interval Duration `json:"interval" validate:"gt=0"`
+	// namespaces never listed
+	Exclude []string `json:"exclude"`
+}
+
+type StatusPage struct {
+	Enabled bool `json:"enabled"`
+	// serve the page alone on this port so the API can stay private, 0 serves it on Port
+	Port int `json:"port" validate:"gte=0,lte=65535"`
+}
+
+// ConfigMap or Secret holding the policy, <namespace>/<name>
+type PolicySource struct {
+	ConfigMap string `json:"configmap" validate:"omitempty,excluded_with=Secret,contains=/"`
+	Secret    string `json:"secret" validate:"omitempty,contains=/"`
+	Key       string `json:"key" validate:"required"`
+}
+
+type Redis struct {
+	Addr     string `json:"addr" validate:"required,hostname_port"`
+	Password string `json:"password"`
+	// read-only replica for reports and latest-cost reads, same password as the primary
+	ReplicaAddr string `json:"replica_addr" validate:"omitempty,hostname_port"`
+	// latest cost payload and policies are kept in process this long, 0 disables the cache
+	CacheTTL Duration `json:"cache_ttl" validate:"gte=0"`
+	WAL      WAL      `json:"wal"`
+}
+
+// optional local log of cost:latest and cooldowns, enabled by its path
+type WAL struct {
+	Path string `json:"path"`
+	// compacted to the last value of each key past this size
+	MaxSizeMB int `json:"max_size_mb" validate:"gt=0"`
+	// how often redis is checked for a lost cost:latest
+	CheckInterval Duration `json:"check_interval" validate:"gt=0"`
+}
+
+// optional external scoring service
+type Scoring struct {
+	URL       string   `json:"url" validate:"omitempty,url"`
+	Timeout   Duration `json:"timeout" validate:"gt=0"`
+	Threshold float64  `json:"threshold" validate:"gte=0,lte=1"`
+}
+
+// what happens to jobs before they reach the agent queue
+type Queue struct {
+	Gate Gate `json:"gate"`
+	// karpenter or cluster-autoscaler, node group findings become provisioner hints
+	NodeProvisioner string `json:"node_provisioner" validate:"omitempty,oneof=karpenter cluster-autoscaler"`
+	// cluster or namespace gives each its own list so agents pop only their jobs, one shared list when empty
+	Routing string `json:"routing" validate:"omitempty,oneof=cluster namespace"`
+	// jobs matching a route go to its queue instead of queue:agent:jobs, the first match wins
+	Routes []internal.QueueRoute `json:"routes" validate:"dive"`
+	// backends every job is also published to, besides the Redis agent queue
+	Sinks QueueSinks `json:"sinks"`
+}
+
+// each sink is enabled by its url
+type QueueSinks struct {
+	Kafka Kafka `json:"kafka"`
+}
+
+type Kafka struct {
+	// REST Proxy, e.g. http://kafka-rest:8082
+	URL string `json:"url" validate:"omitempty,url"`
+	// every job goes to this topic, the queue name with dots for colons when empty
+	Topic   string   `json:"topic"`
+	Timeout Duration `json:"timeout" validate:"gt=0"`
+	// a failed publish fails the job like a failed Redis push, otherwise it is only counted
+	Required bool `json:"required"`
+}
+
+// optional OPA policy gate
+type Gate struct {
+	URL      string   `json:"url" validate:"omitempty,url"`
+	Timeout  Duration `json:"timeout" validate:"gt=0"`
+	FailOpen bool     `json:"fail_open"`
+}
+
+// notifications always go to stdout, each sink is enabled by its url, key or address
+type Notifications struct {
+	// each request to a sink
+	Timeout   Duration  `json:"timeout" validate:"gt=0"`
+	Slack     Chat      `json:"slack"`
+	Teams     Chat      `json:"teams"`
+	Discord   Chat      `json:"discord"`
+	PagerDuty PagerDuty `json:"pagerduty"`
+	SMTP      SMTP      `json:"smtp"`
+}
+
+type Chat struct {
+	WebhookURL string `json:"webhook_url" validate:"omitempty,url"`
+	// only matching notifications are sent, everything when nil
+	Route *notify.Route `json:"route,omitempty"`
+}
+
+type PagerDuty struct {
+	RoutingKey string `json:"routing_key"`
+}
+
+type SMTP struct {
+	Addr     string         `json:"addr" validate:"omitempty,hostname_port"`
+	Username string         `json:"username"`
+	Password string         `json:"password"`
+	From     string         `json:"from" validate:"required_with=Addr"`
+	To       []string       `json:"to" validate:"dive,email"`
+	Routes   []notify.Route `json:"routes"`
+}
+
+// Datadog series intake, pushed series are always accepted and pulling is enabled by both keys
+type Datadog struct {
+	APIKey string `json:"api_key" validate:"required_with=AppKey"`
+	AppKey string `json:"app_key" validate:"required_with=APIKey"`
+	// e.g. datadoghq.eu or us5.datadoghq.com
+	Site string `json:"site" validate:"required"`
+	// between pulls, and between payloads built from pushed series
+	Interval Duration `json:"interval" validate:"gt=0"`
+	// each query to the Datadog API
+	Timeout Duration                `json:"timeout" validate:"gt=0"`
+	Mapping internal.DatadogMapping `json:"mapping"`
+}
+
+// CloudWatch Container Insights pull, enabled by the cluster name
+// credentials come from the environment, IRSA or EKS Pod Identity
+type CloudWatch struct {
+	Cluster string `json:"cluster" validate:"excludesall='"`
+	Region  string `json:"region" validate:"required_with=Cluster"`
+	// namespace the payload is built for
+	Namespace string `json:"namespace" validate:"required,excludesall='"`
+	// Container Insights has no cost metric, the cluster cost is nodes times this
+	HourlyCostPerNode float64  `json:"hourly_cost_per_node" validate:"gte=0"`
+	Interval          Duration `json:"interval" validate:"gt=0"`
+	// each call to CloudWatch or STS
+	Timeout Duration `json:"timeout" validate:"gt=0"`
+}
+
+// Azure Monitor for Containers pull, enabled by the workspace id
+// authenticated with the client secret, AKS workload identity or the node's managed identity
+type AzureMonitor struct {
+	WorkspaceID string `json:"workspace_id" validate:"required_with=Cluster"`
+	Cluster     string `json:"cluster" validate:"required_with=WorkspaceID"`
+	// namespace the payload is built for
+	Namespace         string   `json:"namespace" validate:"required"`
+	TenantID          string   `json:"tenant_id" validate:"required_with=ClientSecret"`
+	ClientID          string   `json:"client_id"`
+	ClientSecret      string   `json:"client_secret"`
+	HourlyCostPerNode float64  `json:"hourly_cost_per_node" validate:"gte=0"`
+	Interval          Duration `json:"interval" validate:"gt=0"`
+	// each query or token request
+	Timeout Duration `json:"timeout" validate:"gt=0"`
+}
+
+// optional warehouses the decision log is streamed into, each enabled by its url or project
+type Analytics struct {
+	// decision log entries per insert
+	BatchSize int      `json:"batch_size" validate:"gt=0"`
+	Interval  Duration `json:"interval" validate:"gt=0"`
+	// each request to a warehouse
+	Timeout    Duration   `json:"timeout" validate:"gt=0"`
+	ClickHouse ClickHouse `json:"clickhouse"`
+	BigQuery   BigQuery   `json:"bigquery"`
+}
+
+type ClickHouse struct {
+	// HTTP interface, e.g. http://clickhouse:8123
+	URL      string `json:"url" validate:"omitempty,url"`
+	Database string `json:"database" validate:"required"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type BigQuery struct {
+	Project string `json:"project"`
+	Dataset string `json:"dataset" validate:"required"`
+}
+
+// Duration written as a Go duration string, e.g. 500ms or 24h
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like 30s: %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// Values the hub uses when nothing is configured
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:                  8008,
+			Currency:              "USD",
+			MaxBodyBytes:          8 << 20,
+			WebhookPort:           8443,
+			SavingsDigestInterval: Duration(24 * time.Hour),
+			PolicySource:          PolicySource{Key: "policy.yaml"},
+			EvaluationTimeout:     Duration(internal.DefaultEvaluationTimeout),
+			ShardSize:             internal.DefaultShardSize,
+			ShardWorkers:          internal.DefaultShardWorkers,
+			KubeEventTimeout:      Duration(internal.DefaultKubeEventTimeout),
+			LeaseDuration:         Duration(15 * time.Second),
+			Discovery:             Discovery{Interval: Duration(10 * time.Minute), Exclude: kube.DefaultDiscoveryExclude},
+			AlertReasons:          internal.DefaultAlertReasons(),
+			DataQuality:           internal.DefaultQualityChecks(),
+		},
+		Redis: Redis{
+			// go-redis's own default
+			Addr:     "localhost:6379",
+			CacheTTL: Duration(internal.DefaultCacheTTL),
+			WAL:      WAL{MaxSizeMB: 64, CheckInterval: Duration(10 * time.Second)},
+		},
+		Scoring: Scoring{Timeout: Duration(500 * time.Millisecond), Threshold: 0.5},
+		Queue: Queue{
+			Gate:  Gate{Timeout: Duration(time.Second)},
+			Sinks: QueueSinks{Kafka: Kafka{Timeout: Duration(5 * time.Second)}},
+		},
+		Notifications: Notifications{Timeout: Duration(5 * time.Second)},
+		Analytics: Analytics{
+			BatchSize:  500,
+			Interval:   Duration(30 * time.Second),
+			Timeout:    Duration(10 * time.Second),
+			ClickHouse: ClickHouse{Database: "metric_hub"},
+			BigQuery:   BigQuery{Dataset: "metric_hub"},
+		},
+		Datadog: Datadog{
+			Site:     datadog.DefaultSite,
+			Interval: Duration(time.Minute),
+			Timeout:  Duration(10 * time.Second),
+			Mapping:  internal.DefaultDatadogMapping(),
+		},
+		CloudWatch:   CloudWatch{Namespace: "default", Interval: Duration(time.Minute), Timeout: Duration(10 * time.Second)},
+		AzureMonitor: AzureMonitor{Namespace: "default", Interval: Duration(time.Minute), Timeout: Duration(10 * time.Second)},
+	}
+}
+
+// ${NAME} or ${NAME:-default}
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// replace ${NAME} references with the environment, a lone $ is left alone
+func interpolate(data []byte) []byte {
+	return envRef.ReplaceAllFunc(data, func(ref []byte) []byte {
+		m := envRef.FindSubmatch(ref)
+		if v, ok := os.LookupEnv(string(m[1])); ok && (v != "" || len(m[2]) == 0) {
+			return []byte(v)
+		}
+		return m[3]
+	})
+}
+
+// Parse a YAML or JSON document over the defaults, after env interpolation
+// unknown fields are rejected so typos don't silently fall back to defaults
+func Parse(data []byte) (*Config, error) {
+	jsonData, err := yaml.YAMLToJSON(interpolate(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	cfg := Default()
+	var probe struct {
+		Thresholds json.RawMessage `json:"thresholds"`
+	}
+	if err := json.Unmarshal(jsonData, &probe); err == nil && len(probe.Thresholds) > 0 && string(probe.Thresholds) != "null" {
+		policy := internal.DefaultPolicy()
+		cfg.Thresholds = &policy
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(jsonData))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %w", err)
+	}
+	return Parse(data)
+}
+
+// Validate the whole document, every failing field is reported by its YAML path
+func (c *Config) Validate() error {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.Split(f.Tag.Get("json"), ",")[0]
+	})
+	err := v.Struct(c)
+	if errs, ok := err.(validator.ValidationErrors); ok {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = fmt.Sprintf("%s failed %s", e.Namespace(), e.Tag())
+		}
+		return fmt.Errorf("invalid config: %s", strings.Join(msgs, "; "))
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+func TestParseInterpolatesEnv(t *testing.T) {
+	t.Setenv("REDIS_PASS", "s3cret")
+	cfg, err := Parse([]byte(`
+server:
+  port: 9000
+redis:
+  addr: ${REDIS_ADDR:-redis:6379}
+  password: ${REDIS_PASS}
+scoring:
+  timeout: 250ms
+notifications:
+  slack:
+    webhook_url: https://hooks.slack.com/services/x
+    route: {min_severity: warning}
+`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.Redis.Addr != "redis:6379" || cfg.Redis.Password != "s3cret" {
+		t.Errorf("expected interpolated redis config, got %+v", cfg.Redis)
+	}
+	if cfg.Server.Port != 9000 || cfg.Server.WebhookPort != 8443 {
+		t.Errorf("expected port 9000 and the default webhook port, got %+v", cfg.Server)
+	}
+	if cfg.Scoring.Timeout.Std() != 250*time.Millisecond || cfg.Scoring.Threshold != 0.5 {
+		t.Errorf("expected the parsed timeout and default threshold, got %+v", cfg.Scoring)
+	}
+	if r := cfg.Notifications.Slack.Route; r == nil || r.MinSeverity != "warning" {
+		t.Errorf("expected a slack route, got %+v", r)
+	}
+	if cfg.Thresholds != nil {
+		t.Errorf("expected no thresholds when left out, got %+v", cfg.Thresholds)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected a valid config, got %v", err)
+	}
+}
+
+func TestParseThresholdsKeepDefaults(t *testing.T) {
+	cfg, err := Parse([]byte("thresholds:\n  cpu_waste: 0.3\n"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.Thresholds == nil || cfg.Thresholds.CPUWaste != 0.3 || cfg.Thresholds.MemoryWaste != 0.5 {
+		t.Errorf("expected cpu_waste 0.3 over the default policy, got %+v", cfg.Thresholds)
+	}
+}
+
+func TestParseRejectsUnknownFields(t *testing.T) {
+	if _, err := Parse([]byte("redis:\n  adress: redis:6379\n")); err == nil {
+		t.Errorf("expected an unknown field to be rejected")
+	}
+}
+
+func TestValidateReportsYAMLPaths(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 0
+	cfg.Queue.NodeProvisioner = "nodepools"
+	cfg.Queue.Routing = "tenant"
+	cfg.Queue.Routes = []internal.QueueRoute{{Namespaces: []string{"payments"}}}
+	cfg.Notifications.SMTP.Addr = "smtp:25"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected validation errors")
+	}
+	for _, field := range []string{"server.port", "queue.node_provisioner", "queue.routing", "queue.routes[0].queue", "smtp.from"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("expected %s in %q", field, err)
+		}
+	}
+}
+
+func TestFromEnvMatchesLegacyVariables(t *testing.T) {
+	t.Setenv("REDIS_SERVICE_ADDR", "redis:6379")
+	t.Setenv("OPA_URL", "http://localhost:8181/v1/data/metrichub/publish")
+	t.Setenv("OPA_TIMEOUT_MS", "200")
+	t.Setenv("NODE_PROVISIONER", "unknown")
+	t.Setenv("SMTP_TO", "a@example.com, b@example.com")
+	t.Setenv("TEAMS_ROUTE", "not json")
+	t.Setenv("EVALUATION_TIMEOUT_MS", "30000")
+
+	cfg := FromEnv()
+	if cfg.Redis.Addr != "redis:6379" || cfg.Queue.Gate.Timeout.Std() != 200*time.Millisecond {
+		t.Errorf("expected redis and gate from env, got %+v %+v", cfg.Redis, cfg.Queue.Gate)
+	}
+	if cfg.Server.EvaluationTimeout.Std() != 30*time.Second || cfg.Server.KubeEventTimeout.Std() != 2*time.Second {
+		t.Errorf("expected the env evaluation timeout and default kube event timeout, got %+v", cfg.Server)
+	}
+	if cfg.Queue.NodeProvisioner != "" {
+		t.Errorf("expected an unknown provisioner to be dropped, got %q", cfg.Queue.NodeProvisioner)
+	}
+	if len(cfg.Notifications.SMTP.To) != 2 || cfg.Notifications.Teams.Route != nil {
+		t.Errorf("expected two recipients and no teams route, got %+v", cfg.Notifications)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected a valid config, got %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+)
+
+// Configuration from the environment variables the hub has always read
+// invalid values are logged and replaced by their defaults
+func FromEnv() *Config {
+	cfg := Default()
+
+	cfg.Server.ClusterID = os.Getenv("CLUSTER_ID")
+	cfg.Server.ClusterLabels = internal.ClusterLabels{
+		Provider:    os.Getenv("CLUSTER_PROVIDER"),
+		Region:      os.Getenv("CLUSTER_REGION"),
+		Environment: os.Getenv("CLUSTER_ENVIRONMENT"),
+	}
+	if currency := os.Getenv("BILLING_CURRENCY"); currency != "" {
+		cfg.Server.Currency = currency
+	}
+	cfg.Server.MultiTenant = os.Getenv("MULTI_TENANT") == "true"
+	cfg.Server.KubeEvents = os.Getenv("KUBE_EVENTS") == "true"
+	cfg.Server.CostMetrics = os.Getenv("COST_METRICS") == "true"
+	cfg.Server.FaultInjection = os.Getenv("FAULT_INJECTION") == "true"
+	cfg.Server.AllowRestore = os.Getenv("ALLOW_RESTORE") == "true"
+	cfg.Server.MaxBodyBytes = envInt("MAX_BODY_BYTES", cfg.Server.MaxBodyBytes)
+	cfg.Server.WebhookTLSCert = os.Getenv("WEBHOOK_TLS_CERT")
+	cfg.Server.WebhookTLSKey = os.Getenv("WEBHOOK_TLS_KEY")
+	cfg.Server.SavingsDigestInterval = envDuration("SAVINGS_DIGEST_INTERVAL_MS", cfg.Server.SavingsDigestInterval)
+	cfg.Server.PolicySource.ConfigMap = os.Getenv("POLICY_CONFIGMAP")
+	cfg.Server.PolicySource.Secret = os.Getenv("POLICY_SECRET")
+	if key := os.Getenv("POLICY_CONFIG_KEY"); key != "" {
+		cfg.Server.PolicySource.Key = key
+	}
+	cfg.Server.EvaluationTimeout = envDuration("EVALUATION_TIMEOUT_MS", cfg.Server.EvaluationTimeout)
+	cfg.Server.EvaluationInterval = envDuration("EVALUATION_INTERVAL_MS", cfg.Server.EvaluationInterval)
+	cfg.Server.KubeEventTimeout = envDuration("KUBE_EVENT_TIMEOUT_MS", cfg.Server.KubeEventTimeout)
+	cfg.Server.ShardSize = envInt("SHARD_SIZE", cfg.Server.ShardSize)
+	cfg.Server.ShardWorkers = envInt("SHARD_WORKERS", cfg.Server.ShardWorkers)
+	cfg.Server.ShardClaims = os.Getenv("SHARD_CLAIMS") == "true"
+	cfg.Server.DataQuality.MinScore = envFloat("DATA_QUALITY_MIN_SCORE", cfg.Server.DataQuality.MinScore)
+	cfg.Server.LeaderElection = os.Getenv("LEADER_ELECTION") == "true"
+	cfg.Server.LeaseDuration = envDuration("LEADER_LEASE_MS", cfg.Server.LeaseDuration)
+	cfg.Server.Discovery.Enabled = os.Getenv("DISCOVERY") == "true"
+	cfg.Server.Discovery.Interval = envDuration("DISCOVERY_INTERVAL_MS", cfg.Server.Discovery.Interval)
+	if exclude := os.Getenv("DISCOVERY_EXCLUDE"); exclude != "" {
+		cfg.Server.Discovery.Exclude = strings.Split(exclude, ",")
+	}
+	if raw := os.Getenv("ALERT_REASONS"); raw != "" {
+		reasons := map[string]string{}
+		if err := json.Unmarshal([]byte(raw), &reasons); err != nil {
+			fmt.Printf("Invalid ALERT_REASONS, using the defaults: %v\n", err)
+		} else {
+			cfg.Server.AlertReasons = reasons
+		}
+	}
+	cfg.Server.StatusPage.Enabled = os.Getenv("STATUS_PAGE") == "true"
+	cfg.Server.StatusPage.Port = envInt("STATUS_PAGE_PORT", cfg.Server.StatusPage.Port)
+
+	if addr := os.Getenv("REDIS_SERVICE_ADDR"); addr != "" {
+		cfg.Redis.Addr = addr
+	}
+	cfg.Redis.Password = os.Getenv("REDIS_SERVICE_PASS")
+	cfg.Redis.ReplicaAddr = os.Getenv("REDIS_REPLICA_ADDR")
+	if os.Getenv("REDIS_CACHE_TTL_MS") == "0" {
+		cfg.Redis.CacheTTL = 0
+	} else {
+		cfg.Redis.CacheTTL = envDuration("REDIS_CACHE_TTL_MS", cfg.Redis.CacheTTL)
+	}
+	cfg.Redis.WAL.Path = os.Getenv("REDIS_WAL_PATH")
+	cfg.Redis.WAL.MaxSizeMB = envInt("REDIS_WAL_MAX_SIZE_MB", cfg.Redis.WAL.MaxSizeMB)
+	cfg.Redis.WAL.CheckInterval = envDuration("REDIS_WAL_CHECK_INTERVAL_MS", cfg.Redis.WAL.CheckInterval)
+
+	cfg.Scoring.URL = os.Getenv("SCORING_SERVICE_URL")
+	cfg.Scoring.Timeout = envDuration("SCORING_TIMEOUT_MS", cfg.Scoring.Timeout)
+	cfg.Scoring.Threshold = envFloat("SCORING_THRESHOLD", cfg.Scoring.Threshold)
+
+	cfg.Queue.Gate.URL = os.Getenv("OPA_URL")
+	cfg.Queue.Gate.Timeout = envDuration("OPA_TIMEOUT_MS", cfg.Queue.Gate.Timeout)
+	cfg.Queue.Gate.FailOpen = os.Getenv("OPA_FAIL_OPEN") == "true"
+	switch p := os.Getenv("NODE_PROVISIONER"); p {
+	case "", internal.ProvisionerKarpenter, internal.ProvisionerClusterAutoscaler:
+		cfg.Queue.NodeProvisioner = p
+	default:
+		fmt.Printf("Unknown NODE_PROVISIONER %q, sending node group jobs\n", p)
+	}
+	switch r := os.Getenv("QUEUE_ROUTING"); r {
+	case "", queue.RouteCluster, queue.RouteNamespace:
+		cfg.Queue.Routing = r
+	default:
+		fmt.Printf("Unknown QUEUE_ROUTING %q, using one agent queue\n", r)
+	}
+	if raw := os.Getenv("QUEUE_ROUTES"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfg.Queue.Routes); err != nil {
+			fmt.Printf("Invalid QUEUE_ROUTES, sending every job to %s: %v\n", internal.AgentQueueKey, err)
+			cfg.Queue.Routes = nil
+		}
+	}
+	kafka := &cfg.Queue.Sinks.Kafka
+	kafka.URL = os.Getenv("KAFKA_REST_URL")
+	kafka.Topic = os.Getenv("KAFKA_TOPIC")
+	kafka.Timeout = envDuration("KAFKA_TIMEOUT_MS", kafka.Timeout)
+	kafka.Required = os.Getenv("KAFKA_REQUIRED") == "true"
+
+	an := &cfg.Analytics
+	an.BatchSize = envInt("ANALYTICS_BATCH_SIZE", an.BatchSize)
+	an.Interval = envDuration("ANALYTICS_INTERVAL_MS", an.Interval)
+	an.Timeout = envDuration("ANALYTICS_TIMEOUT_MS", an.Timeout)
+	an.ClickHouse.URL = os.Getenv("CLICKHOUSE_URL")
+	an.ClickHouse.Username = os.Getenv("CLICKHOUSE_USERNAME")
+	an.ClickHouse.Password = os.Getenv("CLICKHOUSE_PASSWORD")
+	if db := os.Getenv("CLICKHOUSE_DATABASE"); db != "" {
+		an.ClickHouse.Database = db
+	}
+	an.BigQuery.Project = os.Getenv("BIGQUERY_PROJECT")
+	if dataset := os.Getenv("BIGQUERY_DATASET"); dataset != "" {
+		an.BigQuery.Dataset = dataset
+	}
+
+	dd := &cfg.Datadog
+	dd.APIKey = os.Getenv("DD_API_KEY")
+	dd.AppKey = os.Getenv("DD_APP_KEY")
+	if site := os.Getenv("DD_SITE"); site != "" {
+		dd.Site = site
+	}
+	dd.Interval = envDuration("DATADOG_PULL_INTERVAL_MS", dd.Interval)
+	dd.Timeout = envDuration("DATADOG_TIMEOUT_MS", dd.Timeout)
+	if raw := os.Getenv("DATADOG_MAPPING"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &dd.Mapping); err != nil {
+			fmt.Printf("Invalid DATADOG_MAPPING, using the default metrics: %v\n", err)
+			dd.Mapping = internal.DefaultDatadogMapping()
+		}
+	}
+	dd.Mapping.HourlyCostPerNode = envFloat("DATADOG_HOURLY_COST_PER_NODE", dd.Mapping.HourlyCostPerNode)
+
+	cw := &cfg.CloudWatch
+	cw.Cluster = os.Getenv("CLOUDWATCH_CLUSTER")
+	cw.Region = os.Getenv("AWS_REGION")
+	if ns := os.Getenv("CLOUDWATCH_NAMESPACE"); ns != "" {
+		cw.Namespace = ns
+	}
+	cw.HourlyCostPerNode = envFloat("CLOUDWATCH_HOURLY_COST_PER_NODE", cw.HourlyCostPerNode)
+	cw.Interval = envDuration("CLOUDWATCH_INTERVAL_MS", cw.Interval)
+	cw.Timeout = envDuration("CLOUDWATCH_TIMEOUT_MS", cw.Timeout)
+
+	az := &cfg.AzureMonitor
+	az.WorkspaceID = os.Getenv("AZURE_MONITOR_WORKSPACE_ID")
+	az.Cluster = os.Getenv("AZURE_MONITOR_CLUSTER")
+	if ns := os.Getenv("AZURE_MONITOR_NAMESPACE"); ns != "" {
+		az.Namespace = ns
+	}
+	az.TenantID = os.Getenv("AZURE_TENANT_ID")
+	az.ClientID = os.Getenv("AZURE_CLIENT_ID")
+	az.ClientSecret = os.Getenv("AZURE_CLIENT_SECRET")
+	az.HourlyCostPerNode = envFloat("AZURE_MONITOR_HOURLY_COST_PER_NODE", az.HourlyCostPerNode)
+	az.Interval = envDuration("AZURE_MONITOR_INTERVAL_MS", az.Interval)
+	az.Timeout = envDuration("AZURE_MONITOR_TIMEOUT_MS", az.Timeout)
+
+	if raw := os.Getenv("PAYLOAD_PIPELINE"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfg.Pipeline); err != nil {
+			fmt.Printf("Invalid PAYLOAD_PIPELINE, payloads are saved as pushed: %v\n", err)
+			cfg.Pipeline = nil
+		}
+	}
+
+	n := &cfg.Notifications
+	n.Timeout = envDuration("NOTIFICATION_TIMEOUT_MS", n.Timeout)
+	n.Slack = envChat("SLACK")
+	n.Teams = envChat("TEAMS")
+	n.Discord = envChat("DISCORD")
+	n.PagerDuty.RoutingKey = os.Getenv("PAGERDUTY_ROUTING_KEY")
+	n.SMTP = SMTP{
+		Addr:     os.Getenv("SMTP_ADDR"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		To:       envList("SMTP_TO"),
+	}
+	if raw := os.Getenv("SMTP_ROUTES"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &n.SMTP.Routes); err != nil {
+			fmt.Printf("Invalid SMTP_ROUTES, sending to SMTP_TO only: %v\n", err)
+			n.SMTP.Routes = nil
+		}
+	}
+	return cfg
+}
+
+// <SINK>_WEBHOOK_URL, limited by the JSON route in <SINK>_ROUTE
+func envChat(sink string) Chat {
+	chat := Chat{WebhookURL: os.Getenv(sink + "_WEBHOOK_URL")}
+	if raw := os.Getenv(sink + "_ROUTE"); raw != "" {
+		var route notify.Route
+		if err := json.Unmarshal([]byte(raw), &route); err != nil {
+			fmt.Printf("Invalid %s_ROUTE, sending everything: %v\n", sink, err)
+		} else {
+			chat.Route = &route
+		}
+	}
+	return chat
+}
+
+// milliseconds from an env var, or the fallback when unset or invalid
+func envDuration(name string, fallback Duration) Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	ms, err := strconv.Atoi(raw)
+	if err != nil || ms <= 0 {
+		fmt.Printf("Invalid %s %q, using %v\n", name, raw, fallback.Std())
+		return fallback
+	}
+	return Duration(time.Duration(ms) * time.Millisecond)
+}
+
+func envInt(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		fmt.Printf("Invalid %s %q, using %d\n", name, raw, fallback)
+		return fallback
+	}
+	return v
+}
+
+func envFloat(name string, fallback float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		fmt.Printf("Invalid %s %q, using %v\n", name, raw, fallback)
+		return fallback
+	}
+	return v
+}
+
+// comma separated list, empty entries dropped
+func envList(name string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
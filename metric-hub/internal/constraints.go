@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// LimitRange and ResourceQuota of the namespace a deployment runs in
+type NamespaceConstraints struct {
+	LimitRange    *LimitRange    `json:"limit_range,omitempty"`
+	ResourceQuota *ResourceQuota `json:"resource_quota,omitempty"`
+}
+
+func constraintsOf(p *CostPayload) *NamespaceConstraints {
+	if p.LimitRange == nil && p.ResourceQuota == nil {
+		return nil
+	}
+	return &NamespaceConstraints{LimitRange: p.LimitRange, ResourceQuota: p.ResourceQuota}
+}
+
+// Quota left for new requests, -1 where the quota sets no limit
+func (q *ResourceQuota) Headroom() Resources {
+	headroom := Resources{CPUCores: -1, MemoryMB: -1}
+	if q.Hard.CPUCores > 0 {
+		headroom.CPUCores = math.Max(q.Hard.CPUCores-q.Used.CPUCores, 0)
+	}
+	if q.Hard.MemoryMB > 0 {
+		headroom.MemoryMB = math.Max(q.Hard.MemoryMB-q.Used.MemoryMB, 0)
+	}
+	return headroom
+}
+
+// Fit a recommendation for a single container inside the namespace constraints
+// increases are capped by the quota headroom, then the LimitRange min and max apply
+func (n *NamespaceConstraints) Apply(rec Resources, current Resources) Resources {
+	if n == nil {
+		return rec
+	}
+	if n.ResourceQuota != nil {
+		headroom := n.ResourceQuota.Headroom()
+		rec.CPUCores = capIncrease(rec.CPUCores, current.CPUCores, headroom.CPUCores)
+		rec.MemoryMB = capIncrease(rec.MemoryMB, current.MemoryMB, headroom.MemoryMB)
+	}
+	if lr := n.LimitRange; lr != nil {
+		rec.CPUCores = clampBounds(rec.CPUCores, lr.Min.CPUCores, lr.Max.CPUCores)
+		rec.MemoryMB = clampBounds(rec.MemoryMB, lr.Min.MemoryMB, lr.Max.MemoryMB)
+	}
+	return rec
+}
+
+func capIncrease(rec float64, current float64, headroom float64) float64 {
+	if headroom < 0 || rec <= current {
+		return rec
+	}
+	return math.Min(rec, current+headroom)
+}
+
+// the LimitRange min wins over the max, the API server enforces it regardless
+func clampBounds(v float64, min float64, max float64) float64 {
+	if max > 0 && v > max {
+		v = max
+	}
+	if min > 0 && v < min {
+		v = min
+	}
+	return v
+}
+
+// Namespace constraints from the latest cost payload, nil when none were reported
+func (a *Aggregator) namespaceConstraints(ctx context.Context, ns string) *NamespaceConstraints {
+	p, err := a.latestCost(ctx)
+	if err != nil {
+		fmt.Printf("Failed to load namespace constraints %v\n", err)
+		return nil
+	}
+	if p.Namespace != ns {
+		return nil
+	}
+	return constraintsOf(p)
+}
+
+type QuotaReport struct {
+	Namespace string         `json:"namespace"`
+	Hard      ResourceBounds `json:"hard"`
+	Used      ResourceBounds `json:"used"`
+	// -1 where the quota sets no limit
+	Headroom Resources `json:"headroom"`
+}
+
+// Quota headroom for the namespace in the latest cost payload
+// nil when the cost engine reports no quota
+func (a *Aggregator) Quota(ctx context.Context) (*QuotaReport, error) {
+	p, err := a.latestCost(ctx)
+	if errors.Is(err, ErrNoCostData) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if p.ResourceQuota == nil {
+		return nil, nil
+	}
+	return &QuotaReport{
+		Namespace: p.Namespace,
+		Hard:      p.ResourceQuota.Hard,
+		Used:      p.ResourceQuota.Used,
+		Headroom:  p.ResourceQuota.Headroom(),
+	}, nil
+}
@@ -0,0 +1,40 @@
+package internal
+
+import "testing"
+
+func TestConstraintsCapIncreaseByQuotaHeadroom(t *testing.T) {
+	n := &NamespaceConstraints{
+		ResourceQuota: &ResourceQuota{
+			Hard: ResourceBounds{CPUCores: 4, MemoryMB: 4096},
+			Used: ResourceBounds{CPUCores: 3.8, MemoryMB: 1024},
+		},
+	}
+
+	got := n.Apply(Resources{CPUCores: 1.5, MemoryMB: 2048}, Resources{CPUCores: 1, MemoryMB: 1024})
+	if got.CPUCores < 1.199 || got.CPUCores > 1.201 {
+		t.Errorf("expected cpu capped at current plus 0.2 headroom, got %v", got.CPUCores)
+	}
+	if got.MemoryMB != 2048 {
+		t.Errorf("expected memory within headroom unchanged, got %v", got.MemoryMB)
+	}
+
+	// decreases never need quota
+	got = n.Apply(Resources{CPUCores: 0.5, MemoryMB: 512}, Resources{CPUCores: 1, MemoryMB: 1024})
+	if got.CPUCores != 0.5 || got.MemoryMB != 512 {
+		t.Errorf("expected decrease unchanged, got %+v", got)
+	}
+}
+
+func TestConstraintsClampToLimitRange(t *testing.T) {
+	n := &NamespaceConstraints{
+		LimitRange: &LimitRange{
+			Min: ResourceBounds{CPUCores: 0.1, MemoryMB: 64},
+			Max: ResourceBounds{MemoryMB: 1024},
+		},
+	}
+
+	got := n.Apply(Resources{CPUCores: 0.01, MemoryMB: 2000}, Resources{CPUCores: 1, MemoryMB: 1024})
+	if got.CPUCores != 0.1 || got.MemoryMB != 1024 {
+		t.Errorf("expected 0.1 cores and 1024MB, got %+v", got)
+	}
+}
@@ -0,0 +1,252 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/datadog"
+	"github.com/redis/go-redis/v9"
+)
+
+const DatadogSource = "datadog"
+
+// Key - datadog:intake
+// Field - <metric>|<sorted tags>, the series' latest pushed point
+const DatadogIntakeKey = "datadog:intake"
+
+// a pushed series without a newer point stops counting after this, e.g. its pod is gone
+const DatadogIntakeStaleness = 5 * time.Minute
+
+// A Datadog metric and the factor its values are multiplied by, e.g. bytes to MB
+type DatadogMetric struct {
+	Name  string  `json:"name" validate:"required"`
+	Scale float64 `json:"scale" validate:"gt=0"`
+}
+
+// Which Datadog metrics make up a cost payload and how they are tagged
+// the defaults are the metrics the Datadog agent's kubernetes and kubernetes_state checks report
+type DatadogMapping struct {
+	CPUUsage       DatadogMetric `json:"cpu_usage"`
+	CPURequests    DatadogMetric `json:"cpu_requests"`
+	MemoryUsage    DatadogMetric `json:"memory_usage"`
+	MemoryRequests DatadogMetric `json:"memory_requests"`
+	// node count of the cluster, summed over every series
+	Nodes DatadogMetric `json:"nodes"`
+	// Datadog has no cost metric, the cluster cost is nodes times this
+	HourlyCostPerNode float64 `json:"hourly_cost_per_node" validate:"gte=0"`
+	NamespaceTag      string  `json:"namespace_tag" validate:"required"`
+	DeploymentTag     string  `json:"deployment_tag" validate:"required"`
+	// namespace the payload is built for
+	Namespace string `json:"namespace" validate:"required"`
+}
+
+func DefaultDatadogMapping() DatadogMapping {
+	return DatadogMapping{
+		// nanocores
+		CPUUsage:       DatadogMetric{Name: "kubernetes.cpu.usage.total", Scale: 1e-9},
+		CPURequests:    DatadogMetric{Name: "kubernetes.cpu.requests", Scale: 1},
+		MemoryUsage:    DatadogMetric{Name: "kubernetes.memory.usage", Scale: 1.0 / (1 << 20)},
+		MemoryRequests: DatadogMetric{Name: "kubernetes.memory.requests", Scale: 1.0 / (1 << 20)},
+		Nodes:          DatadogMetric{Name: "kubernetes_state.node.count", Scale: 1},
+		NamespaceTag:   "kube_namespace",
+		DeploymentTag:  "kube_deployment",
+		Namespace:      "default",
+	}
+}
+
+// One metrics query per mapped metric, summed by namespace and deployment
+func (m DatadogMapping) Queries() []string {
+	by := fmt.Sprintf("{%s,%s}", m.NamespaceTag, m.DeploymentTag)
+	queries := []string{}
+	for _, metric := range []DatadogMetric{m.CPUUsage, m.CPURequests, m.MemoryUsage, m.MemoryRequests} {
+		queries = append(queries, fmt.Sprintf("sum:%s{%s:%s} by %s", metric.Name, m.NamespaceTag, m.Namespace, by))
+	}
+	return append(queries, fmt.Sprintf("sum:%s{*}", m.Nodes.Name))
+}
+
+// Build the namespace's cost payload from the latest point of each series
+// series of one deployment are summed, requests and usage are reported per pod or container
+// unmapped metrics and other namespaces are ignored, deployments without usage are left out
+func (m DatadogMapping) Payload(series []datadog.Series) (*CostPayload, error) {
+	deployments := map[string]*pulledTotals{}
+	var nodes float64
+	var newest int64
+
+	for _, s := range series {
+		p, ok := s.Latest()
+		if !ok {
+			continue
+		}
+		if s.Metric == m.Nodes.Name {
+			nodes += p.Value * m.Nodes.Scale
+			newest = max(newest, p.Timestamp)
+			continue
+		}
+		if s.Tag(m.NamespaceTag) != m.Namespace {
+			continue
+		}
+		name := s.Tag(m.DeploymentTag)
+		if name == "" {
+			continue
+		}
+
+		var field *float64
+		var scale float64
+		t := deployments[name]
+		if t == nil {
+			t = &pulledTotals{}
+		}
+		switch s.Metric {
+		case m.CPUUsage.Name:
+			field, scale = &t.CPUUsed, m.CPUUsage.Scale
+		case m.CPURequests.Name:
+			field, scale = &t.CPURequested, m.CPURequests.Scale
+		case m.MemoryUsage.Name:
+			field, scale = &t.MemoryUsed, m.MemoryUsage.Scale
+		case m.MemoryRequests.Name:
+			field, scale = &t.MemoryRequested, m.MemoryRequests.Scale
+		default:
+			continue
+		}
+		*field += p.Value * scale
+		deployments[name] = t
+		newest = max(newest, p.Timestamp)
+	}
+
+	return pulledPayload(DatadogSource, m.Namespace, time.Unix(newest, 0), nodes, m.HourlyCostPerNode, deployments)
+}
+
+// Pulls the mapped metrics from the Datadog API
+type DatadogPuller struct {
+	Client  *datadog.Client
+	Mapping DatadogMapping
+	// queried up to now, the latest point of each series is used
+	Window time.Duration
+	// time source for now, the system clock when nil
+	Clock clock.Clock
+}
+
+func NewDatadogPuller(c *datadog.Client, m DatadogMapping, window time.Duration) *DatadogPuller {
+	return &DatadogPuller{Client: c, Mapping: m, Window: window}
+}
+
+func (p *DatadogPuller) Name() string {
+	return DatadogSource
+}
+
+func (p *DatadogPuller) Poll(ctx context.Context) (*CostPayload, error) {
+	to := clock.Now(p.Clock)
+	var series []datadog.Series
+	for _, q := range p.Mapping.Queries() {
+		s, err := p.Client.Query(ctx, q, to.Add(-p.Window), to)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, s...)
+	}
+	return p.Mapping.Payload(series)
+}
+
+// Series pushed by Datadog agents, kept until a poll builds the namespace's payload from them
+// a node agent only sends its own node's pods and the node count comes from the cluster agent,
+// so one submission is never the whole cluster
+type DatadogIntake struct {
+	Client  *redis.Client
+	Mapping DatadogMapping
+	// time source for when series arrive, the system clock when nil
+	Clock clock.Clock
+}
+
+func NewDatadogIntake(client *redis.Client, m DatadogMapping) *DatadogIntake {
+	return &DatadogIntake{Client: client, Mapping: m}
+}
+
+type intakeSeries struct {
+	Series datadog.Series `json:"series"`
+	// unix seconds on the hub clock
+	Received int64 `json:"received"`
+}
+
+func (i *DatadogIntake) Name() string {
+	return DatadogSource + "-intake"
+}
+
+// Keep the latest point of every series the mapping uses, replacing what the same series sent before
+func (i *DatadogIntake) Record(ctx context.Context, series []datadog.Series) error {
+	now := clock.Now(i.Clock).Unix()
+	fields := map[string]any{}
+	for _, s := range series {
+		if !i.mapped(s) {
+			continue
+		}
+		p, ok := s.Latest()
+		if !ok {
+			continue
+		}
+		tags := slices.Clone(s.Tags)
+		slices.Sort(tags)
+		jsonData, err := json.Marshal(intakeSeries{Series: datadog.Series{Metric: s.Metric, Points: []datadog.Point{p}, Tags: tags}, Received: now})
+		if err != nil {
+			return err
+		}
+		fields[s.Metric+"|"+strings.Join(tags, ",")] = jsonData
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	pipe := i.Client.TxPipeline()
+	pipe.HSet(ctx, DatadogIntakeKey, fields)
+	pipe.Expire(ctx, DatadogIntakeKey, DatadogIntakeStaleness)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+// Build the payload from every series pushed within DatadogIntakeStaleness, stale ones are removed
+// nil without an error when nothing was pushed
+func (i *DatadogIntake) Poll(ctx context.Context) (*CostPayload, error) {
+	stored, err := i.Client.HGetAll(ctx, DatadogIntakeKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get datadog series %w", err)
+	}
+
+	cutoff := clock.Now(i.Clock).Add(-DatadogIntakeStaleness).Unix()
+	var series []datadog.Series
+	var stale []string
+	for field, raw := range stored {
+		var s intakeSeries
+		if err := json.Unmarshal([]byte(raw), &s); err != nil || s.Received < cutoff {
+			stale = append(stale, field)
+			continue
+		}
+		series = append(series, s.Series)
+	}
+	if len(stale) > 0 {
+		if err := i.Client.HDel(ctx, DatadogIntakeKey, stale...).Err(); err != nil {
+			fmt.Printf("[Datadog] failed to remove stale series %v\n", err)
+		}
+	}
+	if len(series) == 0 {
+		return nil, nil
+	}
+	return i.Mapping.Payload(series)
+}
+
+// the node count, or a deployment's series in the mapped namespace
+func (i *DatadogIntake) mapped(s datadog.Series) bool {
+	m := i.Mapping
+	switch s.Metric {
+	case m.Nodes.Name:
+		return true
+	case m.CPUUsage.Name, m.CPURequests.Name, m.MemoryUsage.Name, m.MemoryRequests.Name:
+		return s.Tag(m.NamespaceTag) == m.Namespace && s.Tag(m.DeploymentTag) != ""
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+// Package datadog reads metric series pushed in Datadog's format or pulled from its query API
+package datadog
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultSite = "datadoghq.com"
+
+var ErrTooLarge = errors.New("decompressed body too large")
+
+// One sample, Timestamp is unix seconds
+type Point struct {
+	Timestamp int64
+	Value     float64
+}
+
+// accepts v2 {"timestamp", "value"} objects and v1 [timestamp, value] pairs
+func (p *Point) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		var pair []float64
+		if err := json.Unmarshal(data, &pair); err != nil {
+			return err
+		}
+		if len(pair) != 2 {
+			return fmt.Errorf("point has %d values, expected [timestamp, value]", len(pair))
+		}
+		p.Timestamp, p.Value = int64(pair[0]), pair[1]
+		return nil
+	}
+	var v2 struct {
+		Timestamp int64   `json:"timestamp"`
+		Value     float64 `json:"value"`
+	}
+	if err := json.Unmarshal(data, &v2); err != nil {
+		return err
+	}
+	p.Timestamp, p.Value = v2.Timestamp, v2.Value
+	return nil
+}
+
+type Series struct {
+	Metric string   `json:"metric"`
+	Points []Point  `json:"points"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// Value of the tag key, e.g. kube_namespace for "kube_namespace:default"
+func (s Series) Tag(key string) string {
+	for _, t := range s.Tags {
+		if k, v, ok := strings.Cut(t, ":"); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// Newest point, false when the series has none
+func (s Series) Latest() (Point, bool) {
+	if len(s.Points) == 0 {
+		return Point{}, false
+	}
+	latest := s.Points[0]
+	for _, p := range s.Points[1:] {
+		if p.Timestamp > latest.Timestamp {
+			latest = p
+		}
+	}
+	return latest, true
+}
+
+// Body of a series submission, v1 and v2 share the shape
+type Submission struct {
+	Series []Series `json:"series"`
+}
+
+// Decode a submission, Datadog agents compress with gzip or deflate
+// more than limit bytes after decompression is ErrTooLarge, no limit when it isn't positive
+func DecodeSubmission(r io.Reader, contentEncoding string, limit int64) (*Submission, error) {
+	switch contentEncoding {
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	case "deflate":
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deflate body: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case "", "identity":
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", contentEncoding)
+	}
+
+	// one byte past the limit tells a body of exactly limit bytes from a longer one
+	lr := &io.LimitedReader{R: r, N: limit + 1}
+	if limit > 0 {
+		r = lr
+	}
+
+	var s Submission
+	err := json.NewDecoder(r).Decode(&s)
+	if limit > 0 && lr.N == 0 {
+		return nil, fmt.Errorf("%w: over %d bytes", ErrTooLarge, limit)
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid series body: %w", err)
+	}
+	return &s, nil
+}
+
+// Calls the v1 metrics query API
+type Client struct {
+	Site string
+	// api.<site> by default
+	Endpoint string
+	APIKey   string
+	AppKey   string
+	Client   *http.Client
+	Timeout  time.Duration
+}
+
+func NewClient(site string, apiKey string, appKey string, timeout time.Duration) *Client {
+	if site == "" {
+		site = DefaultSite
+	}
+	return &Client{
+		Site:     site,
+		Endpoint: fmt.Sprintf("https://api.%s", site),
+		APIKey:   apiKey,
+		AppKey:   appKey,
+		Client:   &http.Client{},
+		Timeout:  timeout,
+	}
+}
+
+type queryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Series []struct {
+		Metric string   `json:"metric"`
+		TagSet []string `json:"tag_set"`
+		// [unix millis, value], value is null for empty intervals
+		PointList [][2]*float64 `json:"pointlist"`
+	} `json:"series"`
+}
+
+// Series matching the query between from and to, empty intervals are dropped
+func (c *Client) Query(ctx context.Context, query string, from time.Time, to time.Time) ([]Series, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("from", strconv.FormatInt(from.Unix(), 10))
+	params.Set("to", strconv.FormatInt(to.Unix(), 10))
+	endpoint := fmt.Sprintf("%s/api/v1/query?%s", c.Endpoint, params.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build datadog query: %w", err)
+	}
+	req.Header.Set("DD-API-KEY", c.APIKey)
+	req.Header.Set("DD-APPLICATION-KEY", c.AppKey)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call datadog: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("datadog returned %s", resp.Status)
+	}
+
+	var qr queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&qr); err != nil {
+		return nil, fmt.Errorf("failed to decode datadog response: %w", err)
+	}
+	if qr.Status == "error" {
+		return nil, fmt.Errorf("datadog query %q failed: %s", query, qr.Error)
+	}
+
+	series := make([]Series, 0, len(qr.Series))
+	for _, s := range qr.Series {
+		out := Series{Metric: s.Metric, Tags: s.TagSet}
+		for _, p := range s.PointList {
+			if p[0] == nil || p[1] == nil {
+				continue
+			}
+			out.Points = append(out.Points, Point{Timestamp: int64(*p[0]) / 1000, Value: *p[1]})
+		}
+		series = append(series, out)
+	}
+	return series, nil
+}
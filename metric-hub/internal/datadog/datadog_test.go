@@ -0,0 +1,142 @@
+package datadog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const submission = `{"series": [
+  {"metric": "kubernetes.cpu.usage.total", "points": [[1766412283, 30000000], [1766412223, 10000000]], "tags": ["kube_namespace:default", "kube_deployment:cartservice"]},
+  {"metric": "kubernetes.memory.usage", "points": [{"timestamp": 1766412283, "value": 39845888}]}
+]}`
+
+func TestDecodeSubmissionPointFormats(t *testing.T) {
+	s, err := DecodeSubmission(strings.NewReader(submission), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Series) != 2 {
+		t.Fatalf("expected 2 series, got %+v", s.Series)
+	}
+	if p, ok := s.Series[0].Latest(); !ok || p.Timestamp != 1766412283 || p.Value != 30000000 {
+		t.Errorf("expected the newest v1 point, got %+v", p)
+	}
+	if p, ok := s.Series[1].Latest(); !ok || p.Value != 39845888 {
+		t.Errorf("expected the v2 point, got %+v", p)
+	}
+	if got := s.Series[0].Tag("kube_deployment"); got != "cartservice" {
+		t.Errorf("expected cartservice, got %q", got)
+	}
+	if got := s.Series[1].Tag("kube_deployment"); got != "" {
+		t.Errorf("expected no tag, got %q", got)
+	}
+	if _, ok := (Series{}).Latest(); ok {
+		t.Error("expected no latest point without points")
+	}
+
+	if _, err := DecodeSubmission(strings.NewReader(`{"series": [{"points": [[1, 2, 3]]}]}`), "", 0); err == nil {
+		t.Error("expected a three value point rejected")
+	}
+	if _, err := DecodeSubmission(strings.NewReader(submission), "br", 0); err == nil {
+		t.Error("expected an unsupported encoding rejected")
+	}
+}
+
+func TestDecodeSubmissionCompressed(t *testing.T) {
+	var gz, zl bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(submission))
+	gw.Close()
+	zw := zlib.NewWriter(&zl)
+	zw.Write([]byte(submission))
+	zw.Close()
+
+	for encoding, body := range map[string][]byte{"gzip": gz.Bytes(), "deflate": zl.Bytes()} {
+		s, err := DecodeSubmission(bytes.NewReader(body), encoding, int64(len(submission)))
+		if err != nil || len(s.Series) != 2 {
+			t.Errorf("%s: expected 2 series, got %v %v", encoding, s, err)
+		}
+	}
+	if _, err := DecodeSubmission(strings.NewReader(submission), "gzip", 0); err == nil {
+		t.Error("expected a plain body sent as gzip rejected")
+	}
+}
+
+func TestDecodeSubmissionLimitsDecompressedSize(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(`{"series": [{"metric": "`))
+	gw.Write(bytes.Repeat([]byte("a"), 10<<20))
+	gw.Write([]byte(`"}]}`))
+	gw.Close()
+
+	if gz.Len() > 64<<10 {
+		t.Fatalf("expected the body to compress, got %d bytes", gz.Len())
+	}
+	if _, err := DecodeSubmission(bytes.NewReader(gz.Bytes()), "gzip", 1<<20); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+	if _, err := DecodeSubmission(strings.NewReader(submission), "", int64(len(submission)-1)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge one byte over, got %v", err)
+	}
+}
+
+func TestQueryDropsEmptyIntervals(t *testing.T) {
+	from := time.Unix(1766412000, 0)
+	to := from.Add(5 * time.Minute)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.Header.Get("DD-API-KEY") != "api" || r.Header.Get("DD-APPLICATION-KEY") != "app" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if q.Get("query") != "sum:kubernetes_state.node.count{*}" || q.Get("from") != "1766412000" || q.Get("to") != "1766412300" {
+			t.Errorf("unexpected query %v", q)
+		}
+		w.Write([]byte(`{"status": "ok", "series": [{"metric": "kubernetes_state.node.count", "tag_set": ["env:prod"],
+			"pointlist": [[1766412000000, 5], [1766412060000, null], [1766412120000, 6]]}]}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient("", "api", "app", time.Second)
+	if c.Endpoint != "https://api.datadoghq.com" {
+		t.Errorf("expected the default site's endpoint, got %s", c.Endpoint)
+	}
+	c.Endpoint = srv.URL
+	series, err := c.Query(context.Background(), "sum:kubernetes_state.node.count{*}", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 2 || series[0].Tag("env") != "prod" {
+		t.Fatalf("expected one series with 2 points, got %+v", series)
+	}
+	if p, _ := series[0].Latest(); p.Timestamp != 1766412120 || p.Value != 6 {
+		t.Errorf("expected 6 nodes at 1766412120, got %+v", p)
+	}
+
+	c.APIKey = "wrong"
+	if _, err := c.Query(context.Background(), "sum:kubernetes_state.node.count{*}", from, to); err == nil {
+		t.Error("expected a rejected key to fail the query")
+	}
+}
+
+func TestQueryReportsQueryErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "error", "error": "Rule parse error"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient("datadoghq.eu", "api", "app", time.Second)
+	c.Endpoint = srv.URL
+	if _, err := c.Query(context.Background(), "sum:", time.Now().Add(-time.Minute), time.Now()); err == nil || !strings.Contains(err.Error(), "Rule parse error") {
+		t.Errorf("expected the query error, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retries and double-sends inside this window are treated as duplicates
+const DedupWindow = 2 * time.Minute
+
+// Content hash of the decoded payload, so formatting differences don't matter
+func PayloadHash(p interface{}) (string, error) {
+	jsonData, err := json.Marshal(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload for hashing: %w", err)
+	}
+	sum := sha256.Sum256(jsonData)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func dedupKey(kind string, hash string) string {
+	return fmt.Sprintf("dedup:%s:%s", kind, hash)
+}
+
+// Claim the payload hash for the dedup window
+// Key - dedup:<kind>:<hash>
+// returns false when the same payload was already accepted within the window
+func (a *Aggregator) ClaimPayload(ctx context.Context, kind string, hash string) (bool, error) {
+	ok, err := a.Client.SetNX(ctx, dedupKey(kind, hash), a.now().Unix(), DedupWindow).Result()
+	if err != nil {
+		return false, fmt.Errorf("[Failed] SETNX redis: %w", err)
+	}
+	return ok, nil
+}
+
+// Release a claim when processing failed so the producer's retry is accepted
+func (a *Aggregator) ReleasePayload(ctx context.Context, kind string, hash string) {
+	if err := a.Client.Del(ctx, dedupKey(kind, hash)).Err(); err != nil {
+		fmt.Printf("Failed to release dedup key %v\n", err)
+	}
+}
+
+// Id of a job, the same for every publish of one target and reason within a window
+// queues take each id once, so a retried publish can't reach the agent twice
+func JobID(cluster string, job AgentJob, window time.Time) string {
+	key := strings.Join([]string{cluster, string(job.TargetType), job.target(), job.Reason, strconv.FormatInt(window.Unix(), 10)}, "|")
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// what the job acts on, empty for cluster jobs
+func (job AgentJob) target() string {
+	switch {
+	case job.Deployment != nil:
+		return job.Namespace + "/" + job.Deployment.Name
+	case job.NodeGroup != nil:
+		return job.NodeGroup.NodeGroup
+	case job.Provisioner != nil:
+		return job.Provisioner.NodeGroup
+	}
+	return ""
+}
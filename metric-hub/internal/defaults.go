@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/admission"
+)
+
+const NamespaceDefaultsKey = "defaults:requests"
+
+// memory limits are injected at this multiple of the request, cpu is left unlimited
+const DefaultMemoryLimitRatio = 1.5
+
+// Replace the per-container requests injected for a namespace
+// Key - defaults:requests
+// Field - <namespace> or *
+func (a *Aggregator) SaveNamespaceDefaults(ctx context.Context, ns string, r *Resources) error {
+	jsonData, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal defaults: %w", err)
+	}
+	if err := a.Client.HSet(ctx, NamespaceDefaultsKey, ns, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) DeleteNamespaceDefaults(ctx context.Context, ns string) error {
+	return a.Client.HDel(ctx, NamespaceDefaultsKey, ns).Err()
+}
+
+func (a *Aggregator) ListNamespaceDefaults(ctx context.Context) (map[string]Resources, error) {
+	raw, err := a.Client.HGetAll(ctx, NamespaceDefaultsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace defaults %w", err)
+	}
+
+	defaults := make(map[string]Resources, len(raw))
+	for ns, data := range raw {
+		var r Resources
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			fmt.Printf("Skipping invalid defaults for %s: %v\n", ns, err)
+			continue
+		}
+		defaults[ns] = r
+	}
+	return defaults, nil
+}
+
+// Per-container resources for a deployment that sets none
+// the deployment's recommendation is split across its containers and rounded again,
+// otherwise the namespace defaults (or the * defaults) apply
+// either way each container is kept within the namespace LimitRange
+func (a *Aggregator) DefaultResources(ctx context.Context, ns string, name string, containers int) (*admission.Defaults, error) {
+	if containers <= 0 {
+		return nil, nil
+	}
+
+	rec, err := a.Recommendation(ctx, ns, name)
+	if err != nil {
+		return nil, err
+	}
+	constraints := a.namespaceConstraints(ctx, ns)
+
+	var perContainer Resources
+	if rec != nil {
+		perContainer = a.ActivePolicy(ctx).Rounding.Round(Resources{
+			CPUCores: rec.Requests.CPUCores / float64(containers),
+			MemoryMB: rec.Requests.MemoryMB / float64(containers),
+		})
+	} else {
+		defaults, err := a.ListNamespaceDefaults(ctx)
+		if err != nil {
+			return nil, err
+		}
+		d, ok := defaults[ns]
+		if !ok {
+			d, ok = defaults[AllNamespaces]
+		}
+		if !ok {
+			return nil, nil
+		}
+		perContainer = d
+	}
+	if constraints != nil && constraints.LimitRange != nil {
+		lr := constraints.LimitRange
+		perContainer.CPUCores = clampBounds(perContainer.CPUCores, lr.Min.CPUCores, lr.Max.CPUCores)
+		perContainer.MemoryMB = clampBounds(perContainer.MemoryMB, lr.Min.MemoryMB, lr.Max.MemoryMB)
+	}
+
+	return &admission.Defaults{
+		Requests: admission.Requests{CPUCores: perContainer.CPUCores, MemoryMB: perContainer.MemoryMB},
+		Limits:   admission.Requests{MemoryMB: perContainer.MemoryMB * DefaultMemoryLimitRatio},
+	}, nil
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Changes to the stored cost payload since the producer's previous push
+// fields left out keep their stored values
+type CostDelta struct {
+	Source    string    `json:"source,omitempty"`
+	Timestamp time.Time `json:"timestamp" validate:"required"`
+	Namespace string    `json:"namespace" validate:"required"`
+	// one more than the sequence of the last full payload or delta applied
+	Sequence    int64        `json:"sequence" validate:"gt=0"`
+	ClusterInfo *ClusterInfo `json:"cluster_info,omitempty"`
+	// added, or replacing the stored deployment of the same name
+	Deployments []CostDeployment `json:"deployments,omitempty" validate:"omitempty,dive"`
+	// names of deployments that no longer exist
+	Removed       []string       `json:"removed,omitempty"`
+	NodeGroups    []NodeGroup    `json:"node_groups,omitempty" validate:"omitempty,dive"`
+	LimitRange    *LimitRange    `json:"limit_range,omitempty"`
+	ResourceQuota *ResourceQuota `json:"resource_quota,omitempty"`
+}
+
+var (
+	// the delta skips a sequence or doesn't match the stored payload, the producer must push a full payload
+	ErrSequenceGap = errors.New("delta does not follow the stored payload")
+	// the delta's sequence was already applied, e.g. a retry
+	ErrDuplicateDelta = errors.New("delta already applied")
+)
+
+// deltas racing on the same payload are retried this often before giving up
+const deltaRetries = 3
+
+// Apply a delta to the stored payload
+// the merged payload is saved and evaluated as if it had been pushed in full
+func (a *Aggregator) ApplyCostDelta(ctx context.Context, d *CostDelta) error {
+	var merged *CostPayload
+	var saved []byte
+	apply := func(tx *redis.Tx) error {
+		stored, err := a.readCost(ctx, a.Client)
+		if err != nil {
+			return err
+		}
+		if d.Sequence <= stored.Sequence {
+			return fmt.Errorf("%w (sequence %d)", ErrDuplicateDelta, d.Sequence)
+		}
+		if d.Sequence != stored.Sequence+1 || d.Namespace != stored.Namespace {
+			return fmt.Errorf("%w, expected sequence %d for namespace %s", ErrSequenceGap, stored.Sequence+1, stored.Namespace)
+		}
+
+		merged = MergeCostDelta(stored, d)
+		if len(merged.Deployments) == 0 {
+			return fmt.Errorf("%w, every deployment would be removed", ErrSequenceGap)
+		}
+		jsonData, err := a.Migrations.Encode(CostPayloadKind, merged)
+		if err != nil {
+			return fmt.Errorf("[Failed] to marshal payload: %w", err)
+		}
+		saved = jsonData
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, LatestCostKey, jsonData, 0)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < deltaRetries; i++ {
+		if err = a.Client.Watch(ctx, apply, LatestCostKey); err != redis.TxFailedErr {
+			break
+		}
+	}
+	if errors.Is(err, ErrNoCostData) {
+		return fmt.Errorf("%w, no full payload stored", ErrSequenceGap)
+	} else if err == redis.TxFailedErr {
+		return fmt.Errorf("[Failed] SET redis: payload kept changing")
+	} else if err != nil {
+		return err
+	}
+
+	a.logWrite(LatestCostKey, string(saved), 0)
+	a.costSaved(ctx, merged, nil)
+	return nil
+}
+
+// Stored payload with a delta applied, stored is left unchanged
+// replaced deployments keep their position, new ones are appended
+func MergeCostDelta(stored *CostPayload, d *CostDelta) *CostPayload {
+	merged := *stored
+	merged.Source = d.Source
+	merged.Timestamp = d.Timestamp
+	merged.Sequence = d.Sequence
+	if d.ClusterInfo != nil {
+		merged.ClusterInfo = *d.ClusterInfo
+	}
+	if d.NodeGroups != nil {
+		merged.NodeGroups = d.NodeGroups
+	}
+	if d.LimitRange != nil {
+		merged.LimitRange = d.LimitRange
+	}
+	if d.ResourceQuota != nil {
+		merged.ResourceQuota = d.ResourceQuota
+	}
+
+	changed := make(map[string]CostDeployment, len(d.Deployments))
+	for _, dep := range d.Deployments {
+		changed[dep.Name] = dep
+	}
+	removed := make(map[string]bool, len(d.Removed))
+	for _, name := range d.Removed {
+		removed[name] = true
+	}
+
+	merged.Deployments = make([]CostDeployment, 0, len(stored.Deployments)+len(d.Deployments))
+	for _, dep := range stored.Deployments {
+		if removed[dep.Name] {
+			continue
+		}
+		if c, ok := changed[dep.Name]; ok {
+			dep = c
+			delete(changed, dep.Name)
+		}
+		merged.Deployments = append(merged.Deployments, dep)
+	}
+	for _, dep := range d.Deployments {
+		if _, ok := changed[dep.Name]; ok && !removed[dep.Name] {
+			merged.Deployments = append(merged.Deployments, dep)
+		}
+	}
+	return &merged
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeCostDeltaReplacesAppendsAndRemoves(t *testing.T) {
+	stored := &CostPayload{
+		Namespace:   "default",
+		Sequence:    4,
+		ClusterInfo: ClusterInfo{VmCount: 3, Cost: 0.36},
+		Deployments: []CostDeployment{
+			{Name: "cart", CurrentUsage: Resources{MemoryMB: 100}},
+			{Name: "checkout"},
+			{Name: "frontend"},
+		},
+	}
+	d := &CostDelta{
+		Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Namespace: "default",
+		Sequence:  5,
+		Deployments: []CostDeployment{
+			{Name: "payments"},
+			{Name: "cart", CurrentUsage: Resources{MemoryMB: 200}},
+		},
+		Removed: []string{"checkout"},
+	}
+
+	merged := MergeCostDelta(stored, d)
+	names := []string{}
+	for _, dep := range merged.Deployments {
+		names = append(names, dep.Name)
+	}
+	if len(names) != 3 || names[0] != "cart" || names[1] != "frontend" || names[2] != "payments" {
+		t.Errorf("expected cart, frontend and payments, got %v", names)
+	}
+	if merged.Deployments[0].CurrentUsage.MemoryMB != 200 || merged.Sequence != 5 || !merged.Timestamp.Equal(d.Timestamp) {
+		t.Errorf("expected the delta's values, got %+v", merged)
+	}
+	if merged.ClusterInfo.VmCount != 3 || len(stored.Deployments) != 3 || stored.Sequence != 4 {
+		t.Errorf("expected cluster info kept and the stored payload unchanged")
+	}
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/expr"
+)
+
+var ErrInvalidRule = errors.New("invalid rule")
+
+// Evaluate a crafted cost payload without saving or publishing anything
+// Policy, Rules and Flags replace the stored ones when set, stored scripts always run
+type DryRunRequest struct {
+	Payload *CostPayload `json:"payload" validate:"required"`
+	Policy  *Policy      `json:"policy,omitempty"`
+	Rules   []CustomRule `json:"rules,omitempty" validate:"dive"`
+	Flags   Flags        `json:"flags,omitempty"`
+}
+
+// Fields left out of the policy keep their default values, as for PUT /policy
+func (r *DryRunRequest) UnmarshalJSON(data []byte) error {
+	type request DryRunRequest
+	var raw struct {
+		request
+		Policy json.RawMessage `json:"policy"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*r = DryRunRequest(raw.request)
+	if len(raw.Policy) == 0 || string(raw.Policy) == "null" {
+		return nil
+	}
+	policy := DefaultPolicy()
+	if err := json.Unmarshal(raw.Policy, &policy); err != nil {
+		return err
+	}
+	r.Policy = &policy
+	return nil
+}
+
+type DryRunDecision struct {
+	Name string `json:"name"`
+	// reason the deployment would trigger with, empty when it wouldn't
+	Reason string `json:"reason"`
+	// the payload's data quality would hold the trigger back
+	Suppressed bool             `json:"suppressed"`
+	Checks     []ExplainedCheck `json:"checks"`
+	// conditions on the deployment's predicted_peak_24h, when it has one
+	Forecast []ExplainedCheck `json:"forecast,omitempty"`
+	// what the job would recommend, only for a deployment that triggers
+	Recommendation *Recommendation `json:"recommendation,omitempty"`
+}
+
+type DryRunReport struct {
+	Namespace string           `json:"namespace"`
+	Quality   *QualityReport   `json:"quality"`
+	Decisions []DryRunDecision `json:"decisions"`
+}
+
+// Decisions for every deployment of the request's payload
+// warm-up, rollouts, holds and cooldowns are state of live deployments and are not applied
+func (a *Aggregator) DryRun(ctx context.Context, req *DryRunRequest) (*DryRunReport, error) {
+	p := req.Payload
+	policy := a.ActivePolicy(ctx)
+	if req.Policy != nil {
+		policy = *req.Policy
+	}
+	ruleset := a.loadRuleset(ctx)
+	if req.Rules != nil {
+		rules := make(map[string]CustomRule, len(req.Rules))
+		for i, r := range req.Rules {
+			if _, err := expr.Compile(r.Expression); err != nil {
+				return nil, fmt.Errorf("%w %q: %v", ErrInvalidRule, r.Expression, err)
+			}
+			if r.Name == "" {
+				r.Name = fmt.Sprintf("rule-%d", i)
+			}
+			rules[r.Name] = r
+		}
+		ruleset.Rules = compileRules(rules)
+	}
+	flags := req.Flags
+	if flags == nil {
+		flags = a.flagsFor(ctx, p.Namespace)
+	}
+	sensitivity := a.loadSensitivity(ctx)
+
+	report := &DryRunReport{Namespace: p.Namespace, Quality: a.Quality.Assess(p), Decisions: []DryRunDecision{}}
+	for _, d := range p.Deployments {
+		deploymentPolicy := sensitivity.Apply(p.Namespace, d.Name, policy)
+		decision := DryRunDecision{Name: d.Name, Suppressed: report.Quality.Suppresses(d.Name)}
+		decision.Reason, decision.Checks = explainCost(ctx, d, deploymentPolicy, ruleset, flags)
+		if d.PredictPeak24h != nil {
+			f := ForecastDeployment{Name: d.Name, PredictPeak24h: *d.PredictPeak24h}
+			decision.Forecast = explainForecast(ctx, f, d, deploymentPolicy, flags, ruleset.Scripts, report.Quality)
+		}
+		if decision.Reason != "" {
+			decision.Recommendation = newRecommendation(p.Namespace, d, deploymentPolicy, constraintsOf(p))
+		}
+		report.Decisions = append(report.Decisions, decision)
+	}
+	return report, nil
+}
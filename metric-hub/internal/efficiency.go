@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"context"
+	"sort"
+)
+
+// latency within this fraction of the SLO blocks downscaling
+const SLOHeadroom = 0.9
+
+type EfficiencyEntry struct {
+	Name              string  `json:"name"`
+	RequestRate       float64 `json:"request_rate_rps"`
+	HourlyCost        float64 `json:"hourly_cost"`
+	CostPer1kRequests float64 `json:"cost_per_1k_requests"`
+	LatencyP95Ms      float64 `json:"latency_p95_ms,omitempty"`
+	LatencySLOMs      float64 `json:"latency_slo_ms,omitempty"`
+	NearLatencySLO    bool    `json:"near_latency_slo"`
+}
+
+// true when the deployment reports a latency SLO and p95 is close to it
+func NearLatencySLO(c CostDeployment) bool {
+	if c.LatencySLOMs <= 0 {
+		return false
+	}
+	return c.LatencyP95Ms >= c.LatencySLOMs*SLOHeadroom
+}
+
+// Share of cluster cost attributed to a deployment by its requests
+// cpu and memory shares are weighted equally
+func DeploymentHourlyCost(p *CostPayload, c CostDeployment) float64 {
+	return requestsHourlyCost(p, c.CurrentRequests)
+}
+
+// cluster cost of requests, priced by their share of all requests in the payload
+func requestsHourlyCost(p *CostPayload, r Resources) float64 {
+	var totalCpu, totalMem float64
+	for _, d := range p.Deployments {
+		totalCpu += d.CurrentRequests.CPUCores
+		totalMem += d.CurrentRequests.MemoryMB
+	}
+	if totalCpu == 0 || totalMem == 0 {
+		return 0
+	}
+
+	share := (r.CPUCores/totalCpu + r.MemoryMB/totalMem) / 2
+	return share * p.ClusterInfo.Cost
+}
+
+// hourly cost divided by the requests served in an hour
+func CostPer1kRequests(hourlyCost float64, rps float64) float64 {
+	if rps <= 0 {
+		return 0
+	}
+	return hourlyCost / (rps * 3600 / 1000)
+}
+
+// Rank deployments that report a request rate, cheapest per request first
+func BuildEfficiencyLeaderboard(p *CostPayload) []EfficiencyEntry {
+	entries := []EfficiencyEntry{}
+	for _, d := range p.Deployments {
+		if d.RequestRate <= 0 {
+			continue
+		}
+		cost := DeploymentHourlyCost(p, d)
+		entries = append(entries, EfficiencyEntry{
+			Name:              d.Name,
+			RequestRate:       d.RequestRate,
+			HourlyCost:        cost,
+			CostPer1kRequests: CostPer1kRequests(cost, d.RequestRate),
+			LatencyP95Ms:      d.LatencyP95Ms,
+			LatencySLOMs:      d.LatencySLOMs,
+			NearLatencySLO:    NearLatencySLO(d),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CostPer1kRequests < entries[j].CostPer1kRequests
+	})
+	return entries
+}
+
+func (a *Aggregator) EfficiencyLeaderboard(ctx context.Context) ([]EfficiencyEntry, error) {
+	p, err := a.latestCost(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return BuildEfficiencyLeaderboard(p), nil
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestNearLatencySLO(t *testing.T) {
+	cases := []struct {
+		p95, slo float64
+		near     bool
+	}{
+		{p95: 190, slo: 0, near: false},
+		{p95: 170, slo: 200, near: false},
+		{p95: 180, slo: 200, near: true},
+		{p95: 250, slo: 200, near: true},
+	}
+	for _, c := range cases {
+		if got := NearLatencySLO(CostDeployment{LatencyP95Ms: c.p95, LatencySLOMs: c.slo}); got != c.near {
+			t.Errorf("p95 %vms against a %vms SLO: expected %v, got %v", c.p95, c.slo, c.near, got)
+		}
+	}
+}
+
+func TestLatencySLOSuppressesWasteTriggers(t *testing.T) {
+	d := CostDeployment{
+		Name:            "checkout",
+		CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1024},
+		CurrentUsage:    Resources{CPUCores: 0.05, MemoryMB: 100},
+		LatencyP95Ms:    190,
+		LatencySLOMs:    200,
+	}
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != "" {
+		t.Errorf("expected no waste trigger close to the latency SLO, got %q", reason)
+	}
+
+	d.CurrentUsage.MemoryMB = 1000
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != "High Memory Risk" {
+		t.Errorf("expected risk triggers to still apply, got %q", reason)
+	}
+
+	d.CurrentUsage.MemoryMB = 100
+	d.LatencyP95Ms = 50
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != "High Memory Waste" {
+		t.Errorf("expected waste triggers with latency well inside the SLO, got %q", reason)
+	}
+}
+
+func TestDeploymentHourlyCostSplitsByRequests(t *testing.T) {
+	p := &CostPayload{
+		ClusterInfo: ClusterInfo{VmCount: 2, Cost: 1},
+		Deployments: []CostDeployment{
+			{Name: "web", CurrentRequests: Resources{CPUCores: 3, MemoryMB: 1024}},
+			{Name: "worker", CurrentRequests: Resources{CPUCores: 1, MemoryMB: 3072}},
+		},
+	}
+	// web has 3/4 of the cpu and 1/4 of the memory
+	if got := DeploymentHourlyCost(p, p.Deployments[0]); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("expected half the cluster cost, got %v", got)
+	}
+	if got := DeploymentHourlyCost(&CostPayload{ClusterInfo: p.ClusterInfo}, p.Deployments[0]); got != 0 {
+		t.Errorf("expected no cost without requests to share it, got %v", got)
+	}
+}
+
+func TestEfficiencyLeaderboardCheapestPerRequestFirst(t *testing.T) {
+	requests := Resources{CPUCores: 1, MemoryMB: 1024}
+	p := &CostPayload{
+		ClusterInfo: ClusterInfo{VmCount: 3, Cost: 0.36},
+		Deployments: []CostDeployment{
+			{Name: "search", CurrentRequests: requests, RequestRate: 10},
+			{Name: "frontend", CurrentRequests: requests, RequestRate: 100, LatencyP95Ms: 95, LatencySLOMs: 100},
+			// no request rate, left out
+			{Name: "batch", CurrentRequests: requests},
+			{Name: "checkout", CurrentRequests: requests, RequestRate: 40},
+		},
+	}
+
+	entries := BuildEfficiencyLeaderboard(p)
+	if len(entries) != 3 || entries[0].Name != "frontend" || entries[1].Name != "checkout" || entries[2].Name != "search" {
+		t.Fatalf("expected frontend, checkout, search, got %+v", entries)
+	}
+	// each deployment is a quarter of the 0.36/h cluster, 0.09/h
+	if math.Abs(entries[0].HourlyCost-0.09) > 1e-9 || math.Abs(entries[0].CostPer1kRequests-0.09/360) > 1e-12 {
+		t.Errorf("expected 0.09/h over 360k requests an hour, got %+v", entries[0])
+	}
+	if !entries[0].NearLatencySLO || entries[1].NearLatencySLO {
+		t.Errorf("expected only frontend near its latency SLO, got %+v", entries)
+	}
+}
@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/admission"
+)
+
+// Reject requests far above the hub's target for the deployment
+// deployments the hub has no data for are always allowed
+func (a *Aggregator) CheckRequests(ctx context.Context, ns string, name string, req admission.Requests) (string, error) {
+	maxRatio := a.ActivePolicy(ctx).AdmissionMaxRatio
+	if maxRatio <= 0 {
+		return "", nil
+	}
+
+	rec, err := a.Recommendation(ctx, ns, name)
+	if err != nil || rec == nil {
+		return "", err
+	}
+
+	if req.CPUCores > rec.Target.CPUCores*maxRatio {
+		return fmt.Sprintf("cpu request %.3f cores is more than %gx the recommended %.3f cores", req.CPUCores, maxRatio, rec.Target.CPUCores), nil
+	}
+	if req.MemoryMB > rec.Target.MemoryMB*maxRatio {
+		return fmt.Sprintf("memory request %.0fMB is more than %gx the recommended %.0fMB", req.MemoryMB, maxRatio, rec.Target.MemoryMB), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	EventLogKey = "events:log"
+	// approximate cap on the stream length
+	EventLogMaxLen = 100000
+)
+
+// Event types in the decision log
+const (
+	EventCostPayload       = "cost_payload"
+	EventForecastPayload   = "forecast_payload"
+	EventPolicyChanged     = "policy_changed"
+	EventRuleSaved         = "rule_saved"
+	EventRuleDeleted       = "rule_deleted"
+	EventJobDenied         = "job_denied"
+	EventJobPublished      = "job_published"
+	EventDataPurged        = "data_purged"
+	EventHistoryBackfilled = "history_backfilled"
+)
+
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Append an event to the stream
+// Key - events:log
+// failures are logged, the log never blocks ingestion
+func (a *Aggregator) recordEvent(ctx context.Context, eventType string, data interface{}) {
+	if err := a.appendEvent(ctx, eventType, data); err != nil {
+		fmt.Printf("Failed to record %s event %v\n", eventType, err)
+	}
+}
+
+// recordEvent for callers that fail without their event
+func (a *Aggregator) appendEvent(ctx context.Context, eventType string, data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal %s event: %w", eventType, err)
+	}
+
+	err = a.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: EventLogKey,
+		MaxLen: EventLogMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"type": eventType, "data": jsonData},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("[Failed] XADD redis: %w", err)
+	}
+	return nil
+}
+
+// stream IDs start with the millisecond timestamp
+func streamID(t time.Time, fallback string) string {
+	if t.IsZero() {
+		return fallback
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// Events between from and to, zero times leave that end open
+func (a *Aggregator) ReadEvents(ctx context.Context, from time.Time, to time.Time) ([]Event, error) {
+	msgs, err := a.reader().XRange(ctx, EventLogKey, streamID(from, "-"), streamID(to, "+")).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log %w", err)
+	}
+
+	events := make([]Event, 0, len(msgs))
+	for _, m := range msgs {
+		events = append(events, EventFromMessage(m))
+	}
+	return events, nil
+}
+
+// Event of an events:log entry, timed by its stream ID
+func EventFromMessage(m redis.XMessage) Event {
+	ev := Event{ID: m.ID}
+	ev.Type, _ = m.Values["type"].(string)
+	if data, ok := m.Values["data"].(string); ok {
+		ev.Data = json.RawMessage(data)
+	}
+	millis, _, _ := strings.Cut(m.ID, "-")
+	if ms, err := strconv.ParseInt(millis, 10, 64); err == nil {
+		ev.Time = time.UnixMilli(ms).UTC()
+	}
+	return ev
+}
+
+// Namespace an event is about, empty for cluster-wide events such as policy changes
+func EventNamespace(ev Event) string {
+	var scoped struct {
+		Namespace string `json:"namespace"`
+		Job       *struct {
+			Namespace string `json:"namespace"`
+		} `json:"job"`
+	}
+	json.Unmarshal(ev.Data, &scoped)
+	if scoped.Namespace == "" && scoped.Job != nil {
+		return scoped.Job.Namespace
+	}
+	return scoped.Namespace
+}
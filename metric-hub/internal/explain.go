@@ -0,0 +1,370 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/expr"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/script"
+	"github.com/redis/go-redis/v9"
+)
+
+// Outcome of one check in an explained evaluation
+type ExplainedCheck struct {
+	Check string `json:"check"`
+	// reason the check triggers with, empty for gates
+	Reason string             `json:"reason,omitempty"`
+	Inputs map[string]float64 `json:"inputs,omitempty"`
+	// the check's condition holds and nothing disables it, for a gate that it blocks the trigger
+	Matched bool `json:"matched"`
+	// the check whose reason is used, only the first match in priority order fires
+	Fired  bool   `json:"fired"`
+	Detail string `json:"detail"`
+}
+
+// Every check the hub would run for a deployment on the latest data, and why each did or didn't fire
+// explaining has no side effects, warm-up counts, rollout starts and cooldowns are only read
+type Explanation struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Timestamp time.Time `json:"timestamp"`
+	// variables the checks and custom rules read
+	Inputs expr.Env `json:"inputs"`
+	// reason of the check that fired, empty when none did
+	Reason string           `json:"reason"`
+	Checks []ExplainedCheck `json:"checks"`
+	// what holds back a fired reason, each is checked even when nothing fired
+	Gates []ExplainedCheck `json:"gates"`
+	// conditions on the latest forecast for the deployment, if any
+	Forecast []ExplainedCheck `json:"forecast,omitempty"`
+	// a job would be pushed for Reason
+	WouldTrigger bool `json:"would_trigger"`
+}
+
+// Explanation for a deployment in the latest cost payload, nil when the hub has no data for it
+func (a *Aggregator) Explain(ctx context.Context, ns string, name string) (*Explanation, error) {
+	p, err := a.latestCost(ctx)
+	if errors.Is(err, ErrNoCostData) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if p.Namespace != ns {
+		return nil, nil
+	}
+	var d *CostDeployment
+	for i := range p.Deployments {
+		if p.Deployments[i].Name == name {
+			d = &p.Deployments[i]
+			break
+		}
+	}
+	if d == nil {
+		return nil, nil
+	}
+
+	policy := a.loadSensitivity(ctx).Apply(ns, name, a.ActivePolicy(ctx))
+	flags := a.flagsFor(ctx, ns)
+	e := &Explanation{Namespace: ns, Name: name, Timestamp: p.Timestamp, Inputs: RuleEnv(*d)}
+	e.Reason, e.Checks = explainCost(ctx, *d, policy, a.loadRuleset(ctx), flags)
+
+	// the scoring service replaces the built-in checks, which are still listed for comparison
+	if reason, scored := a.externalDecision(ctx, ns, "cost", *d); scored {
+		for i := range e.Checks {
+			e.Checks[i].Fired = false
+		}
+		detail := "scoring service decided not to trigger, built-in checks are not used"
+		if reason != "" {
+			detail = "scoring service triggered, built-in checks are not used"
+		}
+		e.Checks = append([]ExplainedCheck{{Check: "external_score", Reason: reason, Matched: reason != "", Fired: reason != "", Detail: detail}}, e.Checks...)
+		e.Reason = reason
+	}
+
+	quality := a.Quality.Assess(p)
+	e.Gates = a.explainGates(ctx, ns, *d, policy, quality)
+	e.WouldTrigger = e.Reason != ""
+	for _, g := range e.Gates {
+		if g.Matched {
+			e.WouldTrigger = false
+		}
+	}
+
+	forecast, err := a.forecastFor(ctx, p, *d)
+	if err != nil {
+		fmt.Printf("Failed to load forecast for explanation %v\n", err)
+	} else if forecast != nil {
+		e.Forecast = explainForecast(ctx, *forecast, *d, policy, flags, a.loadScripts(ctx), quality)
+	}
+	return e, nil
+}
+
+// built-in checks in priority order, then custom rules and scripts, mirrors costTriggerReason
+func explainCost(ctx context.Context, d CostDeployment, policy Policy, rules Ruleset, flags Flags) (string, []ExplainedCheck) {
+	var checks []ExplainedCheck
+	reason := ""
+	add := func(c ExplainedCheck) {
+		if c.Matched && reason == "" {
+			c.Fired = true
+			reason = c.Reason
+		} else if c.Matched {
+			c.Detail += ", a higher priority check fired first"
+		}
+		checks = append(checks, c)
+	}
+
+	req := d.CurrentRequests
+	cpuOn, memOn := flags.ResourceEnabled(ResourceCPU), flags.ResourceEnabled(ResourceMemory)
+	if (req.CPUCores == 0 && cpuOn) || (req.MemoryMB == 0 && memOn) {
+		add(explainLimits(d, flags))
+		c := ExplainedCheck{Check: FamilyNoRequests, Reason: ReasonNoRequests,
+			Inputs: map[string]float64{"cpu_request": req.CPUCores, "memory_request": req.MemoryMB}}
+		if c.Matched = flags.Enabled(FamilyNoRequests); c.Matched {
+			c.Detail = "a cpu or memory request is not set"
+		} else {
+			c.Detail = "a request is not set, but family no_requests is disabled"
+		}
+		add(c)
+		// waste and risk need a request to compare usage with
+		return reason, checks
+	}
+
+	typical, peak := d.WasteUsage(), d.RiskUsage()
+	skipWaste := ""
+	if NearLatencySLO(d) {
+		skipWaste = "the deployment is close to its latency SLO"
+	} else if d.Keda.ScalesToZero() {
+		skipWaste = "KEDA scales the deployment to zero"
+	}
+	for _, r := range []struct {
+		family, reason, resource, measure string
+		request, usage, threshold         float64
+		waste                             bool
+	}{
+		{FamilyMemoryWaste, "High Memory Waste", ResourceMemory, "waste", req.MemoryMB, typical.MemoryMB, policy.MemoryWaste, true},
+		{FamilyMemoryRisk, "High Memory Risk", ResourceMemory, "utilisation", req.MemoryMB, peak.MemoryMB, policy.MemoryRisk, false},
+		{FamilyCPUWaste, "High CPU Waste", ResourceCPU, "waste", req.CPUCores, typical.CPUCores, policy.CPUWaste, true},
+		{FamilyCPURisk, "High CPU Risk", ResourceCPU, "utilisation", req.CPUCores, peak.CPUCores, policy.CPURisk, false},
+	} {
+		c := ExplainedCheck{Check: r.family, Reason: r.reason,
+			Inputs: map[string]float64{"request": r.request, "usage": r.usage, "threshold": r.threshold}}
+		if r.request <= 0 {
+			c.Detail = fmt.Sprintf("no %s request", r.resource)
+			add(c)
+			continue
+		}
+		value := r.usage / r.request
+		if r.waste {
+			value = (r.request - r.usage) / r.request
+		}
+		c.Inputs[r.measure] = value
+		above := value > r.threshold
+		switch {
+		case !flags.ResourceEnabled(r.resource):
+			c.Detail = fmt.Sprintf("resource %s is switched off", r.resource)
+		case !flags.Enabled(r.family):
+			c.Detail = fmt.Sprintf("family %s is disabled", r.family)
+		case above && r.waste && skipWaste != "":
+			c.Detail = fmt.Sprintf("%s %.2f is above %.2f, but %s", r.measure, value, r.threshold, skipWaste)
+		case above:
+			c.Matched = true
+			c.Detail = fmt.Sprintf("%s %.2f is above %.2f", r.measure, value, r.threshold)
+		default:
+			c.Detail = fmt.Sprintf("%s %.2f is not above %.2f", r.measure, value, r.threshold)
+		}
+		add(c)
+	}
+	add(explainLimits(d, flags))
+
+	env := RuleEnv(d)
+	for _, r := range rules.Rules {
+		c := ExplainedCheck{Check: "rule:" + r.Name, Reason: r.Reason}
+		ok, err := expr.EvalBool(r.expr, env)
+		switch {
+		case !flags.Enabled(FamilyCustomRules):
+			c.Detail = "family custom_rules is disabled"
+		case err != nil:
+			c.Detail = fmt.Sprintf("%s could not be evaluated: %v", r.Expression, err)
+		case ok:
+			c.Matched = true
+			c.Detail = r.Expression + " is true"
+		default:
+			c.Detail = r.Expression + " is false"
+		}
+		add(c)
+	}
+	for _, c := range explainScripts(ctx, rules.Scripts, d, flags) {
+		add(c)
+	}
+	return reason, checks
+}
+
+// runs ahead of No Requests Set when a request is missing, otherwise after waste and risk
+func explainLimits(d CostDeployment, flags Flags) ExplainedCheck {
+	c := ExplainedCheck{Check: FamilyLimits}
+	lim := d.CurrentLimits
+	switch {
+	case lim == nil:
+		c.Detail = "limits are not reported"
+		return c
+	case !flags.Enabled(FamilyLimits):
+		c.Detail = "family limits is disabled"
+	}
+	c.Inputs = map[string]float64{"cpu_limit": lim.CPUCores, "memory_limit": lim.MemoryMB}
+	if c.Detail != "" {
+		return c
+	}
+	c.Reason = limitsReason(d, flags)
+	c.Matched = c.Reason != ""
+	switch c.Reason {
+	case ReasonLimitsWithoutRequests:
+		c.Detail = "a limit is set without its request"
+	case ReasonNoMemoryLimit:
+		c.Detail = "memory is requested but not limited"
+	default:
+		c.Detail = "limits and requests are coherent"
+	}
+	return c
+}
+
+func explainScripts(ctx context.Context, scripts []*script.Script, d CostDeployment, flags Flags) []ExplainedCheck {
+	var checks []ExplainedCheck
+	for _, s := range scripts {
+		c := ExplainedCheck{Check: "script:" + s.Name}
+		if !flags.Enabled(FamilyScripts) {
+			c.Detail = "family scripts is disabled"
+			checks = append(checks, c)
+			continue
+		}
+		reason, err := s.Evaluate(ctx, d)
+		switch {
+		case err != nil:
+			c.Detail = err.Error()
+		case reason != "":
+			c.Reason, c.Matched = reason, true
+			c.Detail = "script returned a reason"
+		default:
+			c.Detail = "script returned None"
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// conditions that hold back a cost trigger, read without counting the payload or starting anything
+func (a *Aggregator) explainGates(ctx context.Context, ns string, d CostDeployment, policy Policy, quality *QualityReport) []ExplainedCheck {
+	gates := []ExplainedCheck{}
+	gate := func(check string, matched bool, held string, clear string) {
+		g := ExplainedCheck{Check: check, Matched: matched, Detail: clear}
+		if matched {
+			g.Detail = held
+		}
+		gates = append(gates, g)
+	}
+
+	samples := int64(policy.WarmupSamples)
+	gate("replica_warmup", a.evaluations.Load() < samples,
+		fmt.Sprintf("this replica has evaluated %d of %d warm-up payloads", a.evaluations.Load(), samples), "this replica is warmed up")
+	seen, err := a.Client.Get(ctx, warmupKey(ns, d.Name)).Int64()
+	if err != nil && err != redis.Nil {
+		fmt.Printf("Redis error %v\n", err)
+	}
+	gate("deployment_warmup", samples > 0 && seen <= samples,
+		fmt.Sprintf("the deployment appeared in %d payloads, more than %d are needed", seen, samples), "the deployment is warmed up")
+
+	grace := time.Duration(policy.RolloutGraceSeconds) * time.Second
+	gate("rollout", a.rolloutPending(ctx, ns, d, grace), "the deployment is rolling out or within its grace period", "no rollout in progress")
+	gate("data_quality", quality.Suppresses(d.Name),
+		fmt.Sprintf("the payload scored %.2f or the deployment's figures were flagged", quality.Score), "data quality is fine")
+	gate("rollback_hold", a.onHold(ctx, ns, d.Name), "the deployment is held after a rollback", "not held")
+	gate("cooldown", a.cooldownActive(ctx, fmt.Sprintf("trigger:cooldown:%s", d.Name), time.Duration(policy.CooldownSeconds)*time.Second),
+		"a job was pushed within the cooldown", "no recent job")
+	return gates
+}
+
+// rollingOut without recording a new generation's start
+func (a *Aggregator) rolloutPending(ctx context.Context, ns string, d CostDeployment, grace time.Duration) bool {
+	r := d.Rollout
+	if r == nil {
+		return false
+	}
+	if r.InProgress {
+		return true
+	}
+	var started time.Time
+	if r.StartedAt != nil {
+		started = *r.StartedAt
+	} else {
+		raw, err := a.Client.Get(ctx, rolloutKey(ns, d.Name)).Result()
+		if err != nil && err != redis.Nil {
+			fmt.Printf("Redis error %v\n", err)
+		}
+		// a generation the hub hasn't recorded yet starts now
+		gen, start := parseRollout(raw)
+		switch {
+		case gen == r.Generation && start > 0:
+			started = time.UnixMilli(start)
+		case gen > 0 && gen != r.Generation:
+			started = a.now()
+		}
+	}
+	return !started.IsZero() && a.now().Before(started.Add(grace))
+}
+
+// the deployment in the stored forecast, or the prediction carried by the cost payload, nil without either
+func (a *Aggregator) forecastFor(ctx context.Context, p *CostPayload, d CostDeployment) (*ForecastDeployment, error) {
+	f, err := a.readForecast(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if f != nil && f.Namespace == p.Namespace {
+		for _, fd := range f.Deployments {
+			if fd.Name == d.Name {
+				return &fd, nil
+			}
+		}
+	}
+	if d.PredictPeak24h != nil {
+		return &ForecastDeployment{Name: d.Name, PredictPeak24h: *d.PredictPeak24h}, nil
+	}
+	return nil, nil
+}
+
+// forecast conditions and scripts, mirrors evaluateForecastLogic
+func explainForecast(ctx context.Context, f ForecastDeployment, d CostDeployment, policy Policy, flags Flags, scripts []*script.Script, quality *QualityReport) []ExplainedCheck {
+	if quality.Suppresses(d.Name) {
+		return []ExplainedCheck{{Check: "forecast", Detail: "forecast is skipped for low quality cost data"}}
+	}
+	checks := []ExplainedCheck{}
+	fired := false
+	for _, cond := range EvaluateForecast(f, d, policy) {
+		c := ExplainedCheck{Check: cond.Family, Reason: cond.Reason,
+			Inputs: map[string]float64{"current_util": cond.CurrentUtil, "predicted_util": cond.PredUtil, "combined_score": cond.Combined, "trend": cond.Trend}}
+		switch {
+		case !flags.ResourceEnabled(strings.ToLower(cond.Resource)):
+			c.Detail = fmt.Sprintf("resource %s is switched off", strings.ToLower(cond.Resource))
+		case !flags.Enabled(cond.Family):
+			c.Detail = fmt.Sprintf("family %s is disabled", cond.Family)
+		default:
+			c.Matched, c.Fired = true, !fired
+			fired = true
+			c.Detail = "condition violated"
+		}
+		checks = append(checks, c)
+	}
+	merged := d
+	merged.PredictPeak24h = &f.PredictPeak24h
+	for _, c := range explainScripts(ctx, scripts, merged, flags) {
+		c.Fired = c.Matched && !fired
+		fired = fired || c.Matched
+		checks = append(checks, c)
+	}
+	if len(checks) == 0 {
+		checks = append(checks, ExplainedCheck{Check: "forecast",
+			Detail: fmt.Sprintf("no condition violated for a predicted peak of %.2f cores and %.0f MB", f.PredictPeak24h.CPUCores, f.PredictPeak24h.MemoryMB)})
+	}
+	return checks
+}
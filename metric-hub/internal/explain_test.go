@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExplainCostAgreesWithTriggerReason(t *testing.T) {
+	rules := Ruleset{Rules: compileRules(map[string]CustomRule{
+		"idle": {Name: "idle", Expression: "cpu_usage < 0.05", Reason: "Idle"},
+	})}
+	for _, tc := range []struct {
+		name  string
+		d     CostDeployment
+		flags Flags
+	}{
+		{"waste", CostDeployment{CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000}, CurrentUsage: Resources{CPUCores: 0.1, MemoryMB: 100}}, Flags{}},
+		{"cpu waste with memory off", CostDeployment{CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000}, CurrentUsage: Resources{CPUCores: 0.1, MemoryMB: 100}}, Flags{ResourceMemory: false}},
+		{"risk", CostDeployment{CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000}, CurrentUsage: Resources{CPUCores: 0.9, MemoryMB: 600}}, Flags{}},
+		{"no requests", CostDeployment{CurrentUsage: Resources{CPUCores: 0.1, MemoryMB: 100}}, Flags{}},
+		{"limits without requests", CostDeployment{CurrentUsage: Resources{CPUCores: 0.1, MemoryMB: 100}, CurrentLimits: &ResourceBounds{MemoryMB: 512}}, Flags{}},
+		{"custom rule", CostDeployment{CurrentRequests: Resources{CPUCores: 0.05, MemoryMB: 100}, CurrentUsage: Resources{CPUCores: 0.04, MemoryMB: 70}}, Flags{}},
+		{"nothing", CostDeployment{CurrentRequests: Resources{CPUCores: 0.2, MemoryMB: 100}, CurrentUsage: Resources{CPUCores: 0.15, MemoryMB: 70}}, Flags{}},
+	} {
+		want := costTriggerReason(context.Background(), tc.d, DefaultPolicy(), rules, tc.flags)
+		got, checks := explainCost(context.Background(), tc.d, DefaultPolicy(), rules, tc.flags)
+		if got != want {
+			t.Errorf("%s: expected %q, got %q from %+v", tc.name, want, got, checks)
+		}
+		fired := 0
+		for _, c := range checks {
+			if c.Fired {
+				fired++
+			}
+		}
+		if (want != "") != (fired == 1) || fired > 1 {
+			t.Errorf("%s: expected one check to fire for %q, got %d", tc.name, want, fired)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// how long a scrape may spend reading the latest cost payload
+const DefaultExportTimeout = 5 * time.Second
+
+// Reads the latest cost payload
+type CostSource interface {
+	LatestCost(ctx context.Context) (*CostPayload, error)
+}
+
+var (
+	deploymentLabels = []string{"cluster", "namespace", "deployment"}
+
+	descRequestedCPU = prometheus.NewDesc("metric_hub_deployment_requested_cpu_cores",
+		"CPU cores requested by the deployment in the latest cost payload", deploymentLabels, nil)
+	descUsedCPU = prometheus.NewDesc("metric_hub_deployment_used_cpu_cores",
+		"CPU cores used by the deployment in the latest cost payload", deploymentLabels, nil)
+	descRequestedMemory = prometheus.NewDesc("metric_hub_deployment_requested_memory_mb",
+		"Memory in MB requested by the deployment in the latest cost payload", deploymentLabels, nil)
+	descUsedMemory = prometheus.NewDesc("metric_hub_deployment_used_memory_mb",
+		"Memory in MB used by the deployment in the latest cost payload", deploymentLabels, nil)
+	descWasteRatio = prometheus.NewDesc("metric_hub_deployment_waste_ratio",
+		"Share of the deployment's requests it doesn't use per resource, 0 when it uses all of them",
+		append(deploymentLabels, "resource"), nil)
+	descHourlyCost = prometheus.NewDesc("metric_hub_deployment_hourly_cost",
+		"Estimated hourly cost of the deployment's requests", deploymentLabels, nil)
+	descWastedHourlyCost = prometheus.NewDesc("metric_hub_deployment_wasted_hourly_cost",
+		"Estimated hourly cost of the deployment's unused requests", deploymentLabels, nil)
+	descClusterHourlyCost = prometheus.NewDesc("metric_hub_cluster_hourly_cost",
+		"Hourly cost of the cluster in the latest cost payload", []string{"cluster"}, nil)
+	descClusterVMs = prometheus.NewDesc("metric_hub_cluster_vm_count",
+		"VMs in the cluster in the latest cost payload", []string{"cluster"}, nil)
+	descPayloadTime = prometheus.NewDesc("metric_hub_cost_payload_timestamp_seconds",
+		"Unix time of the latest cost payload, the other cost metrics are as old as it", []string{"cluster"}, nil)
+)
+
+// Exports the latest cost payload as Prometheus metrics, read from the source on every scrape
+// deployments dropped from the payload disappear with it, nothing is kept between scrapes
+type CostCollector struct {
+	Source  CostSource
+	Cluster string
+	// DefaultExportTimeout when zero
+	Timeout time.Duration
+}
+
+func NewCostCollector(source CostSource, cluster string) *CostCollector {
+	return &CostCollector{Source: source, Cluster: cluster}
+}
+
+func (c *CostCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		descRequestedCPU, descUsedCPU, descRequestedMemory, descUsedMemory, descWasteRatio,
+		descHourlyCost, descWastedHourlyCost, descClusterHourlyCost, descClusterVMs, descPayloadTime,
+	} {
+		ch <- d
+	}
+}
+
+// no payload yet exports nothing, a read error is reported to the scraper
+func (c *CostCollector) Collect(ch chan<- prometheus.Metric) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultExportTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	p, err := c.Source.LatestCost(ctx)
+	if errors.Is(err, ErrNoCostData) {
+		return
+	} else if err != nil {
+		ch <- prometheus.NewInvalidMetric(descPayloadTime, fmt.Errorf("failed to read latest cost %w", err))
+		return
+	}
+
+	gauge := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labels...)
+	}
+	gauge(descClusterHourlyCost, p.ClusterInfo.Cost, c.Cluster)
+	gauge(descClusterVMs, p.ClusterInfo.VmCount, c.Cluster)
+	gauge(descPayloadTime, float64(p.Timestamp.Unix()), c.Cluster)
+
+	for _, d := range p.Deployments {
+		labels := []string{c.Cluster, p.Namespace, d.Name}
+		gauge(descRequestedCPU, d.CurrentRequests.CPUCores, labels...)
+		gauge(descUsedCPU, d.CurrentUsage.CPUCores, labels...)
+		gauge(descRequestedMemory, d.CurrentRequests.MemoryMB, labels...)
+		gauge(descUsedMemory, d.CurrentUsage.MemoryMB, labels...)
+		if d.CurrentRequests.CPUCores > 0 {
+			gauge(descWasteRatio, wasteRatio(d.CurrentUsage.CPUCores, d.CurrentRequests.CPUCores), append(labels, "cpu")...)
+		}
+		if d.CurrentRequests.MemoryMB > 0 {
+			gauge(descWasteRatio, wasteRatio(d.CurrentUsage.MemoryMB, d.CurrentRequests.MemoryMB), append(labels, "memory")...)
+		}
+		gauge(descHourlyCost, DeploymentHourlyCost(p, d), labels...)
+		gauge(descWastedHourlyCost, WastedHourlyCost(p, d), labels...)
+	}
+}
+
+// unused share of the requests, usage over them is no waste
+func wasteRatio(used float64, requested float64) float64 {
+	return math.Max(1-ratio(used, requested), 0)
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type costSourceFunc func(ctx context.Context) (*CostPayload, error)
+
+func (f costSourceFunc) LatestCost(ctx context.Context) (*CostPayload, error) {
+	return f(ctx)
+}
+
+func TestCostCollectorExportsLatestPayload(t *testing.T) {
+	p := &CostPayload{
+		Timestamp:   time.Unix(1700000000, 0),
+		Namespace:   "default",
+		ClusterInfo: ClusterInfo{VmCount: 2, Cost: 1.0},
+		Deployments: []CostDeployment{
+			{Name: "busy", CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000}, CurrentUsage: Resources{CPUCores: 1, MemoryMB: 1200}},
+			{Name: "idle", CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000}, CurrentUsage: Resources{CPUCores: 0.25, MemoryMB: 0}},
+		},
+	}
+	c := NewCostCollector(costSourceFunc(func(ctx context.Context) (*CostPayload, error) { return p, nil }), "prod")
+
+	// usage over requests is no waste
+	expected := `
+# HELP metric_hub_deployment_waste_ratio Share of the deployment's requests it doesn't use per resource, 0 when it uses all of them
+# TYPE metric_hub_deployment_waste_ratio gauge
+metric_hub_deployment_waste_ratio{cluster="prod",deployment="busy",namespace="default",resource="cpu"} 0
+metric_hub_deployment_waste_ratio{cluster="prod",deployment="busy",namespace="default",resource="memory"} 0
+metric_hub_deployment_waste_ratio{cluster="prod",deployment="idle",namespace="default",resource="cpu"} 0.75
+metric_hub_deployment_waste_ratio{cluster="prod",deployment="idle",namespace="default",resource="memory"} 1
+# HELP metric_hub_deployment_wasted_hourly_cost Estimated hourly cost of the deployment's unused requests
+# TYPE metric_hub_deployment_wasted_hourly_cost gauge
+metric_hub_deployment_wasted_hourly_cost{cluster="prod",deployment="busy",namespace="default"} 0
+metric_hub_deployment_wasted_hourly_cost{cluster="prod",deployment="idle",namespace="default"} 0.4375
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"metric_hub_deployment_waste_ratio", "metric_hub_deployment_wasted_hourly_cost"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(c, "metric_hub_deployment_requested_cpu_cores"); n != 2 {
+		t.Errorf("expected 2 requested cpu series, got %d", n)
+	}
+
+	// the series go away with the payload
+	empty := NewCostCollector(costSourceFunc(func(ctx context.Context) (*CostPayload, error) { return nil, ErrNoCostData }), "prod")
+	if n := testutil.CollectAndCount(empty); n != 0 {
+		t.Errorf("expected no series without a payload, got %d", n)
+	}
+}
@@ -0,0 +1,314 @@
+// Package expr implements the small boolean/arithmetic expression language
+// used by custom trigger rules, e.g. `queue_lag > 1000 && cpu_util < 0.2`
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Variables available to an expression
+type Env map[string]float64
+
+type Expr interface {
+	Eval(env Env) (float64, error)
+}
+
+// Compile parses src into an expression tree
+func Compile(src string) (Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	e, err := p.parse(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	return e, nil
+}
+
+// EvalBool evaluates e and treats any non-zero result as true
+func EvalBool(e Expr, env Env) (bool, error) {
+	v, err := e.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	return v != 0, nil
+}
+
+// Identifiers referenced by the expression
+func Vars(e Expr) []string {
+	seen := map[string]bool{}
+	var out []string
+	var walk func(Expr)
+	walk = func(e Expr) {
+		switch n := e.(type) {
+		case ident:
+			if !seen[string(n)] {
+				seen[string(n)] = true
+				out = append(out, string(n))
+			}
+		case unary:
+			walk(n.x)
+		case binary:
+			walk(n.l)
+			walk(n.r)
+		}
+	}
+	walk(e)
+	return out
+}
+
+// tokens
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNum
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+var operators = []string{"&&", "||", "==", "!=", ">=", "<=", ">", "<", "+", "-", "*", "/", "!"}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			toks = append(toks, token{tokNum, src[start:i], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_' || src[i] == '.') {
+				i++
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, token{tokOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+// parser - precedence climbing
+
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	">": 4, ">=": 4, "<": 4, "<=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6,
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parse(minPrec int) (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if t.kind != tokOp || !ok || prec <= minPrec {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parse(prec)
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: t.text, l: left, r: right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return number(v), nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return number(1), nil
+		case "false":
+			return number(0), nil
+		}
+		return ident(t.text), nil
+	case tokLParen:
+		e, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing ) for ( at position %d", t.pos)
+		}
+		return e, nil
+	case tokOp:
+		if t.text == "!" || t.text == "-" {
+			x, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return unary{op: t.text, x: x}, nil
+		}
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+// nodes
+
+type number float64
+
+func (n number) Eval(Env) (float64, error) { return float64(n), nil }
+
+type ident string
+
+func (i ident) Eval(env Env) (float64, error) {
+	v, ok := env[string(i)]
+	if !ok {
+		return 0, fmt.Errorf("unknown variable %q", string(i))
+	}
+	return v, nil
+}
+
+type unary struct {
+	op string
+	x  Expr
+}
+
+func (u unary) Eval(env Env) (float64, error) {
+	v, err := u.x.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+	if u.op == "-" {
+		return -v, nil
+	}
+	return boolf(v == 0), nil
+}
+
+type binary struct {
+	op   string
+	l, r Expr
+}
+
+func (b binary) Eval(env Env) (float64, error) {
+	l, err := b.l.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	// short circuit so rules can guard optional metrics
+	switch b.op {
+	case "&&":
+		if l == 0 {
+			return 0, nil
+		}
+	case "||":
+		if l != 0 {
+			return 1, nil
+		}
+	}
+
+	r, err := b.r.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	switch b.op {
+	case "&&", "||":
+		return boolf(r != 0), nil
+	case "==":
+		return boolf(l == r), nil
+	case "!=":
+		return boolf(l != r), nil
+	case ">":
+		return boolf(l > r), nil
+	case ">=":
+		return boolf(l >= r), nil
+	case "<":
+		return boolf(l < r), nil
+	case "<=":
+		return boolf(l <= r), nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	}
+	return 0, fmt.Errorf("unknown operator %q", b.op)
+}
+
+func boolf(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package expr
+
+import "testing"
+
+func TestEval(t *testing.T) {
+	env := Env{"queue_lag": 1500, "cpu_util": 0.1, "gpu_memory_mb": 0}
+
+	cases := []struct {
+		src  string
+		want bool
+	}{
+		{"queue_lag > 1000", true},
+		{"queue_lag > 1000 && cpu_util < 0.2", true},
+		{"queue_lag > 1000 && cpu_util > 0.2", false},
+		{"cpu_util > 0.5 || queue_lag / 1000 >= 1.5", true},
+		{"!(queue_lag > 1000)", false},
+		{"gpu_memory_mb == 0 || gpu_memory_mb / 0 > 1", true},
+		{"-cpu_util < 0", true},
+	}
+
+	for _, c := range cases {
+		e, err := Compile(c.src)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", c.src, err)
+		}
+		got, err := EvalBool(e, env)
+		if err != nil {
+			t.Fatalf("Eval(%q): %v", c.src, err)
+		}
+		if got != c.want {
+			t.Errorf("Eval(%q) = %v, want %v", c.src, got, c.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, src := range []string{"", "queue_lag >", "(queue_lag > 1", "queue_lag $ 1", "1 2"} {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("Compile(%q) expected error", src)
+		}
+	}
+}
+
+func TestUnknownVariable(t *testing.T) {
+	e, _ := Compile("missing > 1")
+	if _, err := EvalBool(e, Env{}); err == nil {
+		t.Error("expected error for unknown variable")
+	}
+}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/scoring"
+)
+
+// default reason when the scoring service triggers without one
+const ExternalScoreReason = "External Score"
+
+// Ask the external scoring service about a deployment
+// ok is false when no service is configured or it failed, and the caller
+// falls back to the built-in thresholds
+func (a *Aggregator) externalDecision(ctx context.Context, ns string, stream string, c CostDeployment) (reason string, ok bool) {
+	if a.Scorer == nil {
+		return "", false
+	}
+
+	d, err := a.Scorer.Score(ctx, scoring.Request{Namespace: ns, Stream: stream, Deployment: c})
+	if err != nil {
+		fmt.Printf("Scoring service failed for %s, using built-in thresholds: %v\n", c.Name, err)
+		return "", false
+	}
+	if !*d.Trigger {
+		return "", true
+	}
+	if d.Reason == "" {
+		return ExternalScoreReason, true
+	}
+	return d.Reason, true
+}
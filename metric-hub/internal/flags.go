@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const TriggerFlagsKey = "flags:triggers"
+
+// flags under this field apply to every namespace without its own override
+const AllNamespaces = "*"
+
+// Trigger families that can be switched off at runtime
+const (
+	FamilyMemoryWaste       = "memory_waste"
+	FamilyMemoryRisk        = "memory_risk"
+	FamilyCPUWaste          = "cpu_waste"
+	FamilyCPURisk           = "cpu_risk"
+	FamilyNoRequests        = "no_requests"
+	FamilyLimits            = "limits"
+	FamilyForecastRisk      = "forecast_risk"
+	FamilyForecastDownscale = "forecast_downscale"
+	FamilyCustomRules       = "custom_rules"
+	FamilyScripts           = "scripts"
+	FamilyNodeGroup         = "node_group"
+	FamilyClusterAnomaly    = "cluster_anomaly"
+	FamilySchedule          = "schedule"
+	FamilyAlerts            = "alerts"
+)
+
+var triggerFamilies = map[string]bool{
+	FamilyMemoryWaste:       true,
+	FamilyMemoryRisk:        true,
+	FamilyCPUWaste:          true,
+	FamilyCPURisk:           true,
+	FamilyNoRequests:        true,
+	FamilyLimits:            true,
+	FamilyForecastRisk:      true,
+	FamilyForecastDownscale: true,
+	FamilyCustomRules:       true,
+	FamilyScripts:           true,
+	FamilyNodeGroup:         true,
+	FamilyClusterAnomaly:    true,
+	FamilySchedule:          true,
+	FamilyAlerts:            true,
+}
+
+// Resource switches, turning one off suppresses every built-in trigger on that resource
+// e.g. {"cpu": false} for platforms that overcommit cpu on purpose but never memory
+const (
+	ResourceCPU    = "cpu"
+	ResourceMemory = "memory"
+)
+
+var triggerResources = map[string]bool{
+	ResourceCPU:    true,
+	ResourceMemory: true,
+}
+
+// resource of the families that check a single one
+var familyResources = map[string]string{
+	FamilyMemoryWaste: ResourceMemory,
+	FamilyMemoryRisk:  ResourceMemory,
+	FamilyCPUWaste:    ResourceCPU,
+	FamilyCPURisk:     ResourceCPU,
+}
+
+// Family or resource -> enabled, those left out are enabled
+type Flags map[string]bool
+
+// false for a disabled family, or one whose resource is switched off
+func (f Flags) Enabled(family string) bool {
+	if resource, ok := familyResources[family]; ok && !f.ResourceEnabled(resource) {
+		return false
+	}
+	enabled, ok := f[family]
+	return !ok || enabled
+}
+
+func (f Flags) ResourceEnabled(resource string) bool {
+	enabled, ok := f[resource]
+	return !ok || enabled
+}
+
+// Flags by namespace, AllNamespaces holds the defaults
+type TriggerFlags map[string]Flags
+
+// resolve flags for a namespace, its own overrides win over the defaults
+func (t TriggerFlags) For(ns string) Flags {
+	resolved := Flags{}
+	for family, enabled := range t[AllNamespaces] {
+		resolved[family] = enabled
+	}
+	for family, enabled := range t[ns] {
+		resolved[family] = enabled
+	}
+	return resolved
+}
+
+// Replace the flags for a namespace
+// Key - flags:triggers
+// Field - <namespace> or *
+func (a *Aggregator) SaveFlags(ctx context.Context, ns string, f Flags) error {
+	for family := range f {
+		if !triggerFamilies[family] && !triggerResources[family] {
+			return fmt.Errorf("unknown trigger family or resource %q", family)
+		}
+	}
+	jsonData, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal flags: %w", err)
+	}
+	if err := a.Client.HSet(ctx, TriggerFlagsKey, ns, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) DeleteFlags(ctx context.Context, ns string) error {
+	return a.Client.HDel(ctx, TriggerFlagsKey, ns).Err()
+}
+
+func (a *Aggregator) ListFlags(ctx context.Context) (TriggerFlags, error) {
+	raw, err := a.Client.HGetAll(ctx, TriggerFlagsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flags %w", err)
+	}
+
+	flags := make(TriggerFlags, len(raw))
+	for ns, data := range raw {
+		var f Flags
+		if err := json.Unmarshal([]byte(data), &f); err != nil {
+			fmt.Printf("Skipping invalid flags for %s: %v\n", ns, err)
+			continue
+		}
+		flags[ns] = f
+	}
+	return flags, nil
+}
+
+// flags for a namespace, everything stays enabled if they can't be read
+func (a *Aggregator) flagsFor(ctx context.Context, ns string) Flags {
+	flags, err := a.ListFlags(ctx)
+	if err != nil {
+		fmt.Printf("Failed to load trigger flags %v\n", err)
+		return Flags{}
+	}
+	return flags.For(ns)
+}
+
+// drop forecast conditions whose family or resource is disabled
+func filterConditions(conditions []Condition, f Flags) []Condition {
+	kept := conditions[:0]
+	for _, cond := range conditions {
+		if f.Enabled(cond.Family) && f.ResourceEnabled(strings.ToLower(cond.Resource)) {
+			kept = append(kept, cond)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTriggerFlagsNamespaceOverridesDefaults(t *testing.T) {
+	flags := TriggerFlags{
+		AllNamespaces: {FamilyCPUWaste: false, FamilyMemoryWaste: false},
+		"payments":    {FamilyCPUWaste: true},
+	}
+
+	f := flags.For("payments")
+	if !f.Enabled(FamilyCPUWaste) {
+		t.Error("expected namespace override to enable cpu_waste")
+	}
+	if f.Enabled(FamilyMemoryWaste) {
+		t.Error("expected memory_waste disabled by default flags")
+	}
+	if !f.Enabled(FamilyCPURisk) {
+		t.Error("expected unlisted family to be enabled")
+	}
+	if flags.For("other").Enabled(FamilyCPUWaste) {
+		t.Error("expected cpu_waste disabled for namespace without override")
+	}
+}
+
+func TestCostTriggerReasonSkipsDisabledFamily(t *testing.T) {
+	d := CostDeployment{
+		Name:            "api",
+		CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000},
+		CurrentUsage:    Resources{CPUCores: 0.1, MemoryMB: 100},
+	}
+
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != "High Memory Waste" {
+		t.Errorf("expected memory waste, got %q", reason)
+	}
+	reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{FamilyMemoryWaste: false})
+	if reason != "High CPU Waste" {
+		t.Errorf("expected cpu waste once memory waste is disabled, got %q", reason)
+	}
+}
+
+func TestResourceSwitchSuppressesItsTriggers(t *testing.T) {
+	d := CostDeployment{
+		Name:            "api",
+		CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000},
+		CurrentUsage:    Resources{CPUCores: 0.1, MemoryMB: 950},
+	}
+	cpuOff := Flags{ResourceCPU: false}
+
+	// memory risk still fires with cpu switched off
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, cpuOff); reason != "High Memory Risk" {
+		t.Errorf("expected memory risk, got %q", reason)
+	}
+	d.CurrentUsage.MemoryMB = 500
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, cpuOff); reason != "" {
+		t.Errorf("expected cpu waste suppressed, got %q", reason)
+	}
+	// a missing cpu request doesn't matter once cpu is off
+	d.CurrentRequests.CPUCores = 0
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, cpuOff); reason != "" {
+		t.Errorf("expected no reason without a cpu request, got %q", reason)
+	}
+
+	conditions := []Condition{
+		{Reason: "Predicted Capacity Risk (Memory)", Resource: "Memory", Family: FamilyForecastRisk},
+		{Reason: "Predicted Capacity Risk (CPU)", Resource: "CPU", Family: FamilyForecastRisk},
+	}
+	kept := filterConditions(conditions, Flags{ResourceMemory: false})
+	if len(kept) != 1 || kept[0].Resource != "CPU" {
+		t.Errorf("expected only the cpu condition kept, got %+v", kept)
+	}
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// FOCUS 1.0 columns written by the export, in order
+var FocusHeader = []string{
+	"BilledCost", "BillingAccountId", "BillingAccountName", "BillingCurrency", "BillingPeriodEnd", "BillingPeriodStart",
+	"ChargeCategory", "ChargeClass", "ChargeDescription", "ChargeFrequency", "ChargePeriodEnd", "ChargePeriodStart",
+	"ConsumedQuantity", "ConsumedUnit", "ContractedCost", "ContractedUnitPrice", "EffectiveCost", "InvoiceIssuerName",
+	"ListCost", "ListUnitPrice", "PricingCategory", "PricingQuantity", "PricingUnit", "ProviderName", "PublisherName",
+	"RegionId", "RegionName", "ResourceId", "ResourceName", "ResourceType", "ServiceCategory", "ServiceName",
+	"SkuId", "SkuPriceId", "SubAccountId", "SubAccountName", "Tags",
+}
+
+// One charge of the FOCUS export: a deployment's cpu or memory requests for an hour
+// the hub allocates the cluster's cost rather than billing it, so billed, effective,
+// list and contracted cost are the same
+type FocusRow struct {
+	Cluster     string
+	Namespace   string
+	Deployment  string
+	Resource    string
+	Currency    string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	Quantity    float64
+	Unit        string
+	Cost        float64
+}
+
+func (r FocusRow) Record() []string {
+	billingStart := time.Date(r.PeriodStart.Year(), r.PeriodStart.Month(), 1, 0, 0, 0, 0, time.UTC)
+	cost := focusDecimal(r.Cost)
+	var unitPrice string
+	if r.Quantity > 0 {
+		unitPrice = focusDecimal(r.Cost / r.Quantity)
+	}
+	tags, _ := json.Marshal(map[string]string{"cluster": r.Cluster, "namespace": r.Namespace, "deployment": r.Deployment})
+
+	return []string{
+		cost, r.Cluster, r.Cluster, r.Currency, focusTime(billingStart.AddDate(0, 1, 0)), focusTime(billingStart),
+		"Usage", "", r.Resource + " requests of " + r.Namespace + "/" + r.Deployment, "Usage-Based", focusTime(r.PeriodEnd), focusTime(r.PeriodStart),
+		focusDecimal(r.Quantity), r.Unit, cost, unitPrice, cost, "metric-hub",
+		cost, unitPrice, "Standard", focusDecimal(r.Quantity), r.Unit, "Kubernetes", "Kubernetes",
+		"", "", r.Cluster + "/" + r.Namespace + "/" + r.Deployment, r.Deployment, "Deployment", "Compute", "Kubernetes",
+		"", "", r.Namespace, r.Namespace, string(tags),
+	}
+}
+
+func focusTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func focusDecimal(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Hourly cpu and memory charges of every deployment over window, oldest first
+func (a *Aggregator) FocusExport(ctx context.Context, window AllocationWindow, currency string) ([]FocusRow, error) {
+	sets, err := a.Allocation(ctx, AllocationQuery{Window: window, Step: time.Hour})
+	if err != nil {
+		return nil, err
+	}
+	return BuildFocusRows(sets, currency), nil
+}
+
+func BuildFocusRows(sets []map[string]*Allocation, currency string) []FocusRow {
+	var rows []FocusRow
+	for _, set := range sets {
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			alloc := set[name]
+			row := FocusRow{
+				Cluster:     alloc.Properties.Cluster,
+				Namespace:   alloc.Properties.Namespace,
+				Deployment:  alloc.Properties.Controller,
+				Currency:    currency,
+				PeriodStart: alloc.Window.Start,
+				PeriodEnd:   alloc.Window.End,
+			}
+			cpu, memory := row, row
+			cpu.Resource, cpu.Quantity, cpu.Unit, cpu.Cost = "CPU", alloc.CPUCoreHours, "vCPU-Hours", alloc.CPUCost
+			memory.Resource, memory.Quantity, memory.Unit, memory.Cost = "Memory", alloc.RAMByteHours/(1<<30), "GiB-Hours", alloc.RAMCost
+			rows = append(rows, cpu, memory)
+		}
+	}
+	return rows
+}
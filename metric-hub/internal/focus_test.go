@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFocusRowsSplitCPUAndMemory(t *testing.T) {
+	start := time.Date(2025, 1, 31, 23, 0, 0, 0, time.UTC)
+	sets := []map[string]*Allocation{{
+		"shop/cart": {
+			Properties:   AllocationProperties{Cluster: "prod", Namespace: "shop", Controller: "cart", ControllerKind: "deployment"},
+			Window:       AllocationWindow{Start: start, End: start.Add(time.Hour)},
+			CPUCoreHours: 0.5,
+			CPUCost:      0.02,
+			RAMByteHours: 2 << 30,
+			RAMCost:      0.01,
+		},
+	}}
+
+	rows := BuildFocusRows(sets, "EUR")
+	if len(rows) != 2 {
+		t.Fatalf("expected a cpu and a memory charge, got %d", len(rows))
+	}
+	column := func(record []string, name string) string {
+		for i, h := range FocusHeader {
+			if h == name {
+				return record[i]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+
+	cpu, memory := rows[0].Record(), rows[1].Record()
+	if len(cpu) != len(FocusHeader) {
+		t.Fatalf("expected %d columns, got %d", len(FocusHeader), len(cpu))
+	}
+	for name, expected := range map[string]string{
+		"BilledCost":         "0.02",
+		"BillingCurrency":    "EUR",
+		"BillingPeriodStart": "2025-01-01T00:00:00Z",
+		"BillingPeriodEnd":   "2025-02-01T00:00:00Z",
+		"ChargePeriodStart":  "2025-01-31T23:00:00Z",
+		"ChargePeriodEnd":    "2025-02-01T00:00:00Z",
+		"ConsumedQuantity":   "0.5",
+		"ConsumedUnit":       "vCPU-Hours",
+		"ListUnitPrice":      "0.04",
+		"ResourceId":         "prod/shop/cart",
+		"SubAccountId":       "shop",
+		"Tags":               `{"cluster":"prod","deployment":"cart","namespace":"shop"}`,
+	} {
+		if got := column(cpu, name); got != expected {
+			t.Errorf("expected %s %s, got %s", name, expected, got)
+		}
+	}
+	if column(memory, "ConsumedQuantity") != "2" || column(memory, "ConsumedUnit") != "GiB-Hours" || column(memory, "EffectiveCost") != "0.01" {
+		t.Errorf("unexpected memory charge %v", memory)
+	}
+}
@@ -0,0 +1,85 @@
+package internal
+
+import "sort"
+
+const (
+	// weight of the predicted peak against current usage in the combined score
+	ForecastWeight = 0.7
+
+	combinedRiskUtil = 0.8
+	// growth in utilisation that blocks a downscale
+	trendGrowthMax = 0.1
+)
+
+// A single violated threshold, attached to the job so the agent sees every signal
+type Condition struct {
+	Reason      string  `json:"reason"`
+	Resource    string  `json:"resource"`
+	Family      string  `json:"family,omitempty"`
+	CurrentUtil float64 `json:"current_util"`
+	PredUtil    float64 `json:"predicted_util"`
+	Combined    float64 `json:"combined_score"`
+	Trend       float64 `json:"trend"`
+	// lower runs first, risks before downscales
+	Priority int `json:"priority"`
+}
+
+type forecastSignal struct {
+	resource   string
+	request    float64
+	usage      float64
+	prediction float64
+}
+
+// Evaluate cpu and memory together, combining the forecast with current utilisation
+// returns all violated conditions ordered by priority
+func EvaluateForecast(f ForecastDeployment, c CostDeployment, policy Policy) []Condition {
+	signals := []forecastSignal{
+		// memory first, a memory shortfall kills pods rather than throttling them
+		{"Memory", c.CurrentRequests.MemoryMB, c.CurrentUsage.MemoryMB, f.PredictPeak24h.MemoryMB},
+		{"CPU", c.CurrentRequests.CPUCores, c.CurrentUsage.CPUCores, f.PredictPeak24h.CPUCores},
+	}
+	skipDownscale := NearLatencySLO(c) || c.Keda.ScalesToZero()
+
+	var conditions []Condition
+	for i, s := range signals {
+		if s.request <= 0 {
+			continue
+		}
+
+		curUtil := s.usage / s.request
+		predUtil := s.prediction / s.request
+		combined := ForecastWeight*predUtil + (1-ForecastWeight)*curUtil
+		trend := predUtil - curUtil
+
+		cond := Condition{
+			Resource:    s.resource,
+			CurrentUtil: curUtil,
+			PredUtil:    predUtil,
+			Combined:    combined,
+			Trend:       trend,
+		}
+
+		// capacity risk when the peak alone is close to the request,
+		// or the blended score is high and still growing
+		if predUtil > policy.ForecastRisk || (combined > combinedRiskUtil && trend > 0) {
+			cond.Reason = "Predicted Capacity Risk (" + s.resource + ")"
+			cond.Family = FamilyForecastRisk
+			cond.Priority = i
+			conditions = append(conditions, cond)
+			continue
+		}
+
+		if 1-curUtil > policy.ForecastWasteMin && predUtil < policy.ForecastDownscale && trend <= trendGrowthMax && !skipDownscale {
+			cond.Reason = "Predicted Safe Downscale (" + s.resource + ")"
+			cond.Family = FamilyForecastDownscale
+			cond.Priority = len(signals) + i
+			conditions = append(conditions, cond)
+		}
+	}
+
+	sort.SliceStable(conditions, func(i, j int) bool {
+		return conditions[i].Priority < conditions[j].Priority
+	})
+	return conditions
+}
@@ -0,0 +1,44 @@
+package internal
+
+import "testing"
+
+func TestEvaluateForecastReportsEveryCondition(t *testing.T) {
+	c := CostDeployment{
+		Name:            "paymentservice",
+		CurrentRequests: Resources{CPUCores: 1.0, MemoryMB: 1000},
+		CurrentUsage:    Resources{CPUCores: 0.5, MemoryMB: 200},
+	}
+	f := ForecastDeployment{
+		Name:           "paymentservice",
+		PredictPeak24h: Resources{CPUCores: 3.0, MemoryMB: 300},
+	}
+
+	conditions := EvaluateForecast(f, c, DefaultPolicy())
+	if len(conditions) != 2 {
+		t.Fatalf("got %d conditions, want 2: %+v", len(conditions), conditions)
+	}
+	if conditions[0].Reason != "Predicted Capacity Risk (CPU)" {
+		t.Errorf("first condition %q, want capacity risk first", conditions[0].Reason)
+	}
+	if conditions[1].Reason != "Predicted Safe Downscale (Memory)" {
+		t.Errorf("second condition %q, want memory downscale", conditions[1].Reason)
+	}
+}
+
+func TestEvaluateForecastGrowingTrendBlocksDownscale(t *testing.T) {
+	c := CostDeployment{
+		Name:            "cartservice",
+		CurrentRequests: Resources{CPUCores: 1.0, MemoryMB: 1000},
+		CurrentUsage:    Resources{CPUCores: 0.1, MemoryMB: 500},
+	}
+	f := ForecastDeployment{
+		Name:           "cartservice",
+		PredictPeak24h: Resources{CPUCores: 0.5, MemoryMB: 550},
+	}
+
+	for _, cond := range EvaluateForecast(f, c, DefaultPolicy()) {
+		if cond.Resource == "CPU" {
+			t.Errorf("unexpected CPU condition with growing trend: %+v", cond)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Package gate checks agent jobs against an OPA policy before they are published
+package gate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type Decision struct {
+	Allow   bool     `json:"allow"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+type Gate interface {
+	Check(ctx context.Context, job interface{}) (*Decision, error)
+}
+
+// Queries an OPA sidecar through its data API
+// e.g. http://localhost:8181/v1/data/metrichub/publish
+type OPAGate struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewOPAGate(url string, timeout time.Duration) *OPAGate {
+	return &OPAGate{
+		URL:    url,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+// document the policy is evaluated against
+type opaInput struct {
+	Job  interface{} `json:"job"`
+	Time time.Time   `json:"time"`
+}
+
+// the policy package is expected to define allow and/or deny
+// allow defaults to true when undefined, deny is a set of reasons
+type opaResponse struct {
+	Result *struct {
+		Allow *bool    `json:"allow"`
+		Deny  []string `json:"deny"`
+	} `json:"result"`
+}
+
+func (g *OPAGate) Check(ctx context.Context, job interface{}) (*Decision, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"input": opaInput{Job: job, Time: time.Now().UTC()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal opa input: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build opa request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query opa: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("opa returned %s", resp.Status)
+	}
+
+	var r opaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode opa response: %w", err)
+	}
+	return r.decision(), nil
+}
+
+func (r opaResponse) decision() *Decision {
+	// an undefined policy document allows everything
+	if r.Result == nil {
+		return &Decision{Allow: true}
+	}
+
+	d := &Decision{Allow: len(r.Result.Deny) == 0, Reasons: r.Result.Deny}
+	if r.Result.Allow != nil && !*r.Result.Allow {
+		d.Allow = false
+		if len(d.Reasons) == 0 {
+			d.Reasons = []string{"not allowed by policy"}
+		}
+	}
+	return d
+}
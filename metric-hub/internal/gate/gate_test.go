@@ -0,0 +1,31 @@
+package gate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecision(t *testing.T) {
+	cases := []struct {
+		body    string
+		allow   bool
+		reasons int
+	}{
+		{`{}`, true, 0},
+		{`{"result": {"allow": true}}`, true, 0},
+		{`{"result": {"allow": false}}`, false, 1},
+		{`{"result": {"deny": ["no downscale of payments on Fridays"]}}`, false, 1},
+		{`{"result": {"allow": true, "deny": ["a", "b"]}}`, false, 2},
+	}
+
+	for _, c := range cases {
+		var r opaResponse
+		if err := json.Unmarshal([]byte(c.body), &r); err != nil {
+			t.Fatal(err)
+		}
+		d := r.decision()
+		if d.Allow != c.allow || len(d.Reasons) != c.reasons {
+			t.Errorf("%s: got %+v", c.body, d)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package guardrail keeps the hub's own Redis footprint bounded
+package guardrail
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/redis/go-redis/v9"
+)
+
+// Maximum number of keys allowed under a prefix
+type PrefixCap struct {
+	Prefix  string
+	MaxKeys int
+}
+
+// Only prefixes listed here are ever evicted
+// latest payloads, policies and the job queue are never touched
+// cooldowns expire with their own TTL, evicting one would let its deployment trigger again at once
+var DefaultCaps = []PrefixCap{
+	{Prefix: "forecast:orphan:", MaxKeys: 5000},
+}
+
+type Guardrail struct {
+	Client   *redis.Client
+	Notifier notify.Notifier
+	Caps     []PrefixCap
+	// alert and evict harder when used memory passes this many bytes, 0 uses maxmemory
+	MemoryLimit int64
+	// fraction of the limit that raises an alert
+	AlertRatio float64
+
+	// only alert when pressure starts, not on every pass
+	underPressure bool
+}
+
+func NewGuardrail(client *redis.Client, notifier notify.Notifier) *Guardrail {
+	return &Guardrail{
+		Client:     client,
+		Notifier:   notifier,
+		Caps:       DefaultCaps,
+		AlertRatio: 0.8,
+	}
+}
+
+// Report from a single guardrail pass
+type Report struct {
+	UsedMemory  int64          `json:"used_memory_bytes"`
+	MemoryLimit int64          `json:"memory_limit_bytes"`
+	KeyCounts   map[string]int `json:"key_counts"`
+	Evicted     map[string]int `json:"evicted"`
+}
+
+// Run checks the footprint every interval until ctx is cancelled
+func (g *Guardrail) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := g.Check(ctx); err != nil {
+			fmt.Printf("[Guardrail] check failed %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check reads memory usage, counts keys per prefix and evicts over-cap prefixes
+func (g *Guardrail) Check(ctx context.Context) (*Report, error) {
+	used, maxMem, err := g.memoryInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return g.enforce(ctx, used, maxMem)
+}
+
+// alert on memory pressure and evict over-cap prefixes, for a datastore using used of maxMem bytes
+func (g *Guardrail) enforce(ctx context.Context, used int64, maxMem int64) (*Report, error) {
+	metrics.RedisUsedMemory.Set(float64(used))
+
+	limit := g.MemoryLimit
+	if limit == 0 {
+		limit = maxMem
+	}
+
+	report := &Report{
+		UsedMemory:  used,
+		MemoryLimit: limit,
+		KeyCounts:   map[string]int{},
+		Evicted:     map[string]int{},
+	}
+
+	// under memory pressure shrink every cap so the datastore recovers
+	pressure := limit > 0 && float64(used) > float64(limit)*g.AlertRatio
+	if pressure && !g.underPressure {
+		g.alert(ctx, used, limit)
+	}
+	g.underPressure = pressure
+
+	for _, c := range g.Caps {
+		keys, err := g.scanPrefix(ctx, c.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		report.KeyCounts[c.Prefix] = len(keys)
+
+		maxKeys := c.MaxKeys
+		if pressure {
+			maxKeys = maxKeys / 2
+		}
+
+		if len(keys) > maxKeys {
+			evicted, err := g.evictOldest(ctx, keys, len(keys)-maxKeys)
+			if err != nil {
+				return nil, err
+			}
+			report.Evicted[c.Prefix] = evicted
+			metrics.RedisEvictions.WithLabelValues(c.Prefix).Add(float64(evicted))
+			fmt.Printf("[Guardrail] evicted %d keys under %s\n", evicted, c.Prefix)
+		}
+		metrics.RedisKeys.WithLabelValues(c.Prefix).Set(float64(len(keys) - report.Evicted[c.Prefix]))
+	}
+
+	return report, nil
+}
+
+func (g *Guardrail) alert(ctx context.Context, used int64, limit int64) {
+	if g.Notifier == nil {
+		return
+	}
+	err := g.Notifier.Notify(ctx, notify.Notification{
+		Severity:  notify.SeverityWarning,
+		Title:     "Metric Hub Redis memory high",
+		Message:   fmt.Sprintf("Redis is using %d of %d bytes, guardrail caps halved until usage drops", used, limit),
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		fmt.Printf("[Guardrail] failed to send alert %v\n", err)
+	}
+}
+
+// used_memory and maxmemory from INFO memory
+func (g *Guardrail) memoryInfo(ctx context.Context) (int64, int64, error) {
+	info, err := g.Client.Info(ctx, "memory").Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read redis memory info %w", err)
+	}
+	fields := parseInfo(info)
+
+	used, _ := strconv.ParseInt(fields["used_memory"], 10, 64)
+	maxMem, _ := strconv.ParseInt(fields["maxmemory"], 10, 64)
+	return used, maxMem, nil
+}
+
+func parseInfo(info string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+func (g *Guardrail) scanPrefix(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	iter := g.Client.Scan(ctx, 0, prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan %s %w", prefix, err)
+	}
+	return keys, nil
+}
+
+// delete the n least recently used keys, using OBJECT IDLETIME as the LRU clock
+func (g *Guardrail) evictOldest(ctx context.Context, keys []string, n int) (int, error) {
+	pipe := g.Client.Pipeline()
+	idle := make([]*redis.DurationCmd, len(keys))
+	for i, k := range keys {
+		idle[i] = pipe.ObjectIdleTime(ctx, k)
+	}
+	// keys may disappear between scan and idle time lookup
+	pipe.Exec(ctx)
+
+	type keyIdle struct {
+		key  string
+		idle time.Duration
+	}
+	candidates := make([]keyIdle, 0, len(keys))
+	for i, k := range keys {
+		d, err := idle[i].Result()
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, keyIdle{k, d})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].idle > candidates[j].idle })
+
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	victims := make([]string, n)
+	for i := 0; i < n; i++ {
+		victims[i] = candidates[i].key
+	}
+	deleted, err := g.Client.Del(ctx, victims...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to evict keys %w", err)
+	}
+	return int(deleted), nil
+}
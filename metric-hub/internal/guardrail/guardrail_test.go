@@ -0,0 +1,99 @@
+package guardrail
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/redis/go-redis/v9"
+)
+
+type recordingNotifier struct {
+	sent []notify.Notification
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func newGuardrail(t *testing.T, caps []PrefixCap) (*Guardrail, *miniredis.Miniredis, *recordingNotifier) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	notifier := &recordingNotifier{}
+	g := NewGuardrail(client, notifier)
+	g.Caps = caps
+	return g, mr, notifier
+}
+
+func TestCapEvictsLeastRecentlyUsed(t *testing.T) {
+	g, mr, _ := newGuardrail(t, []PrefixCap{{Prefix: "forecast:orphan:", MaxKeys: 2}})
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mr.SetTime(start)
+	mr.Set("forecast:orphan:default:old", "{}")
+	mr.SetTime(start.Add(time.Hour))
+	mr.Set("forecast:orphan:default:cart", "{}")
+	mr.Set("forecast:orphan:default:web", "{}")
+	mr.Set("cost:latest", "{}")
+
+	report, err := g.enforce(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.KeyCounts["forecast:orphan:"] != 3 || report.Evicted["forecast:orphan:"] != 1 {
+		t.Errorf("expected one of 3 keys evicted, got %+v", report)
+	}
+	if mr.Exists("forecast:orphan:default:old") {
+		t.Error("expected the idlest key evicted")
+	}
+	if !mr.Exists("forecast:orphan:default:cart") || !mr.Exists("cost:latest") {
+		t.Error("expected recent and unguarded keys kept")
+	}
+}
+
+func TestMemoryPressureAlertsOnceAndHalvesCaps(t *testing.T) {
+	g, mr, notifier := newGuardrail(t, []PrefixCap{{Prefix: "forecast:orphan:", MaxKeys: 4}})
+	ctx := context.Background()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		mr.Set("forecast:orphan:default:"+name, "{}")
+	}
+
+	report, err := g.enforce(ctx, 700, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.sent) != 0 || report.Evicted["forecast:orphan:"] != 0 {
+		t.Fatalf("expected no alert or eviction below 80%%, got %+v %+v", notifier.sent, report)
+	}
+
+	report, err = g.enforce(ctx, 900, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.sent) != 1 || notifier.sent[0].Severity != notify.SeverityWarning {
+		t.Errorf("expected a warning when pressure starts, got %+v", notifier.sent)
+	}
+	if report.MemoryLimit != 1000 || report.Evicted["forecast:orphan:"] != 2 {
+		t.Errorf("expected the cap halved to 2, got %+v", report)
+	}
+
+	g.enforce(ctx, 950, 1000)
+	if len(notifier.sent) != 1 {
+		t.Errorf("expected no repeat alert while under pressure, got %d", len(notifier.sent))
+	}
+	g.enforce(ctx, 100, 1000)
+	g.enforce(ctx, 900, 1000)
+	if len(notifier.sent) != 2 {
+		t.Errorf("expected a new alert once pressure returns, got %d", len(notifier.sent))
+	}
+
+	// a configured limit wins over maxmemory
+	g.MemoryLimit = 10000
+	if report, _ := g.enforce(ctx, 900, 1000); report.MemoryLimit != 10000 {
+		t.Errorf("expected the configured limit, got %d", report.MemoryLimit)
+	}
+}
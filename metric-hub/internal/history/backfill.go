@@ -0,0 +1,86 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Entries written by a backfill
+type BackfillCount struct {
+	// samples inside the raw retention, rolled up by the compactor as usual
+	Raw int `json:"raw"`
+	// buckets rolled up from older samples
+	Rollups int `json:"rollups"`
+	// buckets the deployment already had, left as they were
+	Skipped int `json:"skipped"`
+}
+
+// Backfill adds historical samples of a deployment
+// samples older than the raw retention are rolled up here into the buckets the compactor never reaches,
+// buckets the deployment already has are kept, so recorded history always wins over a backfill
+func (s *Store) Backfill(ctx context.Context, deployment string, samples []Sample, now time.Time) (BackfillCount, error) {
+	var count BackfillCount
+	pipe := s.Client.TxPipeline()
+
+	rawFrom := now.Add(-Raw.Retention)
+	for _, sample := range samples {
+		if sample.Time.Before(rawFrom) || sample.Time.After(now) {
+			continue
+		}
+		jsonData, err := json.Marshal(sample)
+		if err != nil {
+			return count, fmt.Errorf("[Failed] to marshal sample: %w", err)
+		}
+		pipe.ZAdd(ctx, Raw.Key(deployment), redis.Z{Score: float64(sample.Time.UnixMilli()), Member: jsonData})
+		count.Raw++
+	}
+
+	for _, res := range Rollups {
+		start, err := s.compactStart(ctx, res, deployment, now)
+		if err != nil {
+			return count, err
+		}
+		var old []Sample
+		for _, sample := range samples {
+			if sample.Time.Before(start) {
+				old = append(old, sample)
+			}
+		}
+		oldest := now.Add(-res.Retention)
+		for _, r := range Aggregate(old, res.Step) {
+			// the compactor would trim it on its next pass
+			if r.Start.Before(oldest) {
+				continue
+			}
+			score := strconv.FormatInt(r.Start.Unix(), 10)
+			n, err := s.Client.ZCount(ctx, res.Key(deployment), score, score).Result()
+			if err != nil {
+				return count, fmt.Errorf("failed to read %s rollups %w", res.Name, err)
+			}
+			if n > 0 {
+				count.Skipped++
+				continue
+			}
+			jsonData, err := json.Marshal(r)
+			if err != nil {
+				return count, fmt.Errorf("[Failed] to marshal rollup: %w", err)
+			}
+			pipe.ZAdd(ctx, res.Key(deployment), redis.Z{Score: float64(r.Start.Unix()), Member: jsonData})
+			count.Rollups++
+		}
+	}
+
+	if count.Raw == 0 && count.Rollups == 0 {
+		return count, nil
+	}
+	pipe.SAdd(ctx, DeploymentsKey, deployment)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return count, fmt.Errorf("failed to backfill history %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,174 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+// only one replica compacts at a time
+const compactorLockKey = "history:compactor:lock"
+
+// Run rolls up raw samples every interval until ctx is cancelled
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.Compact(ctx, clock.Now(s.Clock)); err != nil {
+			fmt.Printf("[History] compaction failed %v\n", err)
+		}
+	}
+}
+
+// Compact rolls up every complete bucket since the last pass and trims expired data
+// buckets are only built from raw samples, so a pass must run within the raw retention
+func (s *Store) Compact(ctx context.Context, now time.Time) error {
+	locked, err := s.Client.SetNX(ctx, compactorLockKey, now.Unix(), 5*time.Minute).Result()
+	if err != nil {
+		return fmt.Errorf("[Failed] SETNX redis: %w", err)
+	}
+	if !locked {
+		return nil
+	}
+	defer s.Client.Del(ctx, compactorLockKey)
+
+	deployments, err := s.Deployments(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deployments {
+		for _, res := range Rollups {
+			if err := s.compactDeployment(ctx, res, d, now); err != nil {
+				return err
+			}
+		}
+		if err := s.trim(ctx, d, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// first bucket the next pass rolls up
+func (s *Store) compactStart(ctx context.Context, res Resolution, deployment string, now time.Time) (time.Time, error) {
+	// never reach further back than the raw samples go
+	start := now.Add(-Raw.Retention).Truncate(res.Step)
+	if last, err := s.Client.HGet(ctx, CompactedKey, res.Name+":"+deployment).Result(); err == nil {
+		if unix, err := strconv.ParseInt(last, 10, 64); err == nil {
+			if next := time.Unix(unix, 0).Add(res.Step); next.After(start) {
+				start = next
+			}
+		}
+	} else if err != redis.Nil {
+		return start, fmt.Errorf("failed to read compaction cursor %w", err)
+	}
+	return start, nil
+}
+
+func (s *Store) compactDeployment(ctx context.Context, res Resolution, deployment string, now time.Time) error {
+	field := res.Name + ":" + deployment
+	start, err := s.compactStart(ctx, res, deployment, now)
+	if err != nil {
+		return err
+	}
+
+	// only complete buckets are rolled up
+	end := now.Truncate(res.Step)
+	if !start.Before(end) {
+		return nil
+	}
+
+	samples, err := s.Samples(ctx, deployment, start, end)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.Client.TxPipeline()
+	for _, r := range Aggregate(samples, res.Step) {
+		jsonData, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("[Failed] to marshal rollup: %w", err)
+		}
+		score := strconv.FormatInt(r.Start.Unix(), 10)
+		// replace the bucket so a repeated pass doesn't duplicate it
+		pipe.ZRemRangeByScore(ctx, res.Key(deployment), score, score)
+		pipe.ZAdd(ctx, res.Key(deployment), redis.Z{Score: float64(r.Start.Unix()), Member: jsonData})
+	}
+	pipe.HSet(ctx, CompactedKey, field, end.Add(-res.Step).Unix())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save %s rollups %w", res.Name, err)
+	}
+	return nil
+}
+
+// drop data past the retention of each resolution
+func (s *Store) trim(ctx context.Context, deployment string, now time.Time) error {
+	pipe := s.Client.Pipeline()
+	pipe.ZRemRangeByScore(ctx, Raw.Key(deployment), "-inf", "("+strconv.FormatInt(now.Add(-Raw.Retention).UnixMilli(), 10))
+	for _, res := range Rollups {
+		pipe.ZRemRangeByScore(ctx, res.Key(deployment), "-inf", "("+strconv.FormatInt(now.Add(-res.Retention).Unix(), 10))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to trim history %w", err)
+	}
+	return nil
+}
+
+// Aggregate samples into buckets of the given step, oldest first
+func Aggregate(samples []Sample, step time.Duration) []Rollup {
+	buckets := map[int64][]Sample{}
+	for _, sample := range samples {
+		start := sample.Time.Truncate(step).Unix()
+		buckets[start] = append(buckets[start], sample)
+	}
+
+	rollups := make([]Rollup, 0, len(buckets))
+	for start, bucket := range buckets {
+		rollups = append(rollups, Rollup{
+			Start:      time.Unix(start, 0).UTC(),
+			Count:      len(bucket),
+			CPUUsage:   stats(bucket, func(s Sample) float64 { return s.CPUUsage }),
+			CPURequest: stats(bucket, func(s Sample) float64 { return s.CPURequest }),
+			MemUsage:   stats(bucket, func(s Sample) float64 { return s.MemUsage }),
+			MemRequest: stats(bucket, func(s Sample) float64 { return s.MemRequest }),
+		})
+	}
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Start.Before(rollups[j].Start) })
+	return rollups
+}
+
+func stats(samples []Sample, value func(Sample) float64) Stats {
+	if len(samples) == 0 {
+		return Stats{}
+	}
+	values := make([]float64, len(samples))
+	var sum float64
+	for i, s := range samples {
+		values[i] = value(s)
+		sum += values[i]
+	}
+	sort.Float64s(values)
+
+	// nearest-rank percentile
+	rank := int(math.Ceil(0.95*float64(len(values)))) - 1
+	return Stats{
+		Avg: sum / float64(len(values)),
+		P95: values[rank],
+		Max: values[len(values)-1],
+	}
+}
@@ -0,0 +1,304 @@
+// Package history keeps per-deployment usage samples at several resolutions
+// raw samples are rolled up into hourly and daily aggregates by the compactor
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// set of <namespace>/<name> with recorded samples
+	DeploymentsKey = "history:deployments"
+	// last bucket rolled up per resolution and deployment
+	CompactedKey = "history:compacted"
+)
+
+type Resolution struct {
+	Name      string
+	Step      time.Duration
+	Retention time.Duration
+}
+
+var (
+	Raw    = Resolution{Name: "raw", Retention: 48 * time.Hour}
+	Hourly = Resolution{Name: "1h", Step: time.Hour, Retention: 30 * 24 * time.Hour}
+	Daily  = Resolution{Name: "1d", Step: 24 * time.Hour, Retention: 365 * 24 * time.Hour}
+)
+
+// Rollup resolutions, finest first
+var Rollups = []Resolution{Hourly, Daily}
+
+// Key - history:<resolution>:<namespace>/<name>
+func (r Resolution) Key(deployment string) string {
+	return fmt.Sprintf("history:%s:%s", r.Name, deployment)
+}
+
+func Deployment(ns string, name string) string {
+	return ns + "/" + name
+}
+
+// One push from the cost engine for a deployment
+type Sample struct {
+	Time       time.Time `json:"time"`
+	CPUUsage   float64   `json:"cpu_usage"`
+	CPURequest float64   `json:"cpu_request"`
+	MemUsage   float64   `json:"memory_usage_mb"`
+	MemRequest float64   `json:"memory_request_mb"`
+}
+
+type Stats struct {
+	Avg float64 `json:"avg"`
+	P95 float64 `json:"p95"`
+	Max float64 `json:"max"`
+}
+
+// Aggregate of the samples in one bucket
+type Rollup struct {
+	Start      time.Time `json:"start"`
+	Count      int       `json:"count"`
+	CPUUsage   Stats     `json:"cpu_usage"`
+	CPURequest Stats     `json:"cpu_request"`
+	MemUsage   Stats     `json:"memory_usage_mb"`
+	MemRequest Stats     `json:"memory_request_mb"`
+}
+
+type Store struct {
+	Client *redis.Client
+	// read-only replica for queries, the compactor always reads Client
+	Replica *redis.Client
+	// time source, the system clock when nil
+	Clock clock.Clock
+}
+
+func NewStore(client *redis.Client) *Store {
+	return &Store{Client: client}
+}
+
+// Record samples keyed by <namespace>/<name>
+// Key - history:raw:<namespace>/<name>, scored by unix millis
+func (s *Store) Record(ctx context.Context, samples map[string]Sample) error {
+	pipe := s.Client.Pipeline()
+	for deployment, sample := range samples {
+		jsonData, err := json.Marshal(sample)
+		if err != nil {
+			return fmt.Errorf("[Failed] to marshal sample: %w", err)
+		}
+		pipe.ZAdd(ctx, Raw.Key(deployment), redis.Z{Score: float64(sample.Time.UnixMilli()), Member: jsonData})
+		pipe.SAdd(ctx, DeploymentsKey, deployment)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("[Failed] ZADD redis: %w", err)
+	}
+	return nil
+}
+
+// client for queries that may lag writes by the replication delay
+func (s *Store) reader() *redis.Client {
+	if s.Replica != nil {
+		return s.Replica
+	}
+	return s.Client
+}
+
+// Raw samples in [from, to)
+func (s *Store) Samples(ctx context.Context, deployment string, from time.Time, to time.Time) ([]Sample, error) {
+	return s.samples(ctx, s.Client, deployment, from, to)
+}
+
+func (s *Store) samples(ctx context.Context, client *redis.Client, deployment string, from time.Time, to time.Time) ([]Sample, error) {
+	members, err := client.ZRangeByScore(ctx, Raw.Key(deployment), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: "(" + strconv.FormatInt(to.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read samples %w", err)
+	}
+	return decodeSamples(members), nil
+}
+
+func decodeSamples(members []string) []Sample {
+	samples := make([]Sample, 0, len(members))
+	for _, m := range members {
+		var sample Sample
+		if err := json.Unmarshal([]byte(m), &sample); err != nil {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// Rollups at a resolution with a start in [from, to)
+func (s *Store) Rollups(ctx context.Context, res Resolution, deployment string, from time.Time, to time.Time) ([]Rollup, error) {
+	return s.rollups(ctx, s.Client, res, deployment, from, to)
+}
+
+func (s *Store) rollups(ctx context.Context, client *redis.Client, res Resolution, deployment string, from time.Time, to time.Time) ([]Rollup, error) {
+	members, err := client.ZRangeByScore(ctx, res.Key(deployment), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.Unix(), 10),
+		Max: "(" + strconv.FormatInt(to.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s rollups %w", res.Name, err)
+	}
+	return decodeRollups(members), nil
+}
+
+func decodeRollups(members []string) []Rollup {
+	rollups := make([]Rollup, 0, len(members))
+	for _, m := range members {
+		var r Rollup
+		if err := json.Unmarshal([]byte(m), &r); err != nil {
+			continue
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups
+}
+
+func (s *Store) Deployments(ctx context.Context) ([]string, error) {
+	deployments, err := s.Client.SMembers(ctx, DeploymentsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history deployments %w", err)
+	}
+	return deployments, nil
+}
+
+// Recorded <namespace>/<name> entries of one namespace
+func (s *Store) TrackedIn(ctx context.Context, ns string) (map[string]bool, error) {
+	deployments, err := s.Deployments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tracked := map[string]bool{}
+	for _, d := range deployments {
+		if strings.HasPrefix(d, ns+"/") {
+			tracked[d] = true
+		}
+	}
+	return tracked, nil
+}
+
+// Remove the samples and rollups of deployments in ns, every namespace when empty
+// with a zero before a deployment's history is dropped whole, otherwise samples
+// and rollups starting before it are removed; returns the number of entries
+func (s *Store) Purge(ctx context.Context, ns string, before time.Time, dryRun bool) (int64, error) {
+	deployments, err := s.Deployments(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	for _, d := range deployments {
+		if ns != "" && !strings.HasPrefix(d, ns+"/") {
+			continue
+		}
+		n, err := s.purgeDeployment(ctx, d, before, dryRun)
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+func (s *Store) purgeDeployment(ctx context.Context, deployment string, before time.Time, dryRun bool) (int64, error) {
+	maxScore := func(res Resolution) string {
+		if before.IsZero() {
+			return "+inf"
+		}
+		if res == Raw {
+			return "(" + strconv.FormatInt(before.UnixMilli(), 10)
+		}
+		return "(" + strconv.FormatInt(before.Unix(), 10)
+	}
+
+	resolutions := append([]Resolution{Raw}, Rollups...)
+	counts := make([]*redis.IntCmd, len(resolutions))
+	pipe := s.Client.Pipeline()
+	for i, res := range resolutions {
+		counts[i] = pipe.ZCount(ctx, res.Key(deployment), "-inf", maxScore(res))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count history %w", err)
+	}
+	var n int64
+	for _, c := range counts {
+		n += c.Val()
+	}
+	if dryRun {
+		return n, nil
+	}
+
+	pipe = s.Client.TxPipeline()
+	for _, res := range resolutions {
+		pipe.ZRemRangeByScore(ctx, res.Key(deployment), "-inf", maxScore(res))
+	}
+	if before.IsZero() {
+		pipe.SRem(ctx, DeploymentsKey, deployment)
+		for _, res := range Rollups {
+			pipe.HDel(ctx, CompactedKey, res.Name+":"+deployment)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to purge history %w", err)
+	}
+	return n, nil
+}
+
+// Every raw sample and rollup of a deployment, rollups keyed by resolution name
+func (s *Store) Export(ctx context.Context, deployment string) ([]Sample, map[string][]Rollup, error) {
+	all := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	members, err := s.Client.ZRangeByScore(ctx, Raw.Key(deployment), all).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read samples %w", err)
+	}
+	rollups := map[string][]Rollup{}
+	for _, res := range Rollups {
+		r, err := s.Client.ZRangeByScore(ctx, res.Key(deployment), all).Result()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s rollups %w", res.Name, err)
+		}
+		if len(r) > 0 {
+			rollups[res.Name] = decodeRollups(r)
+		}
+	}
+	return decodeSamples(members), rollups, nil
+}
+
+// Add exported samples and rollups to a deployment's history
+// a rollup replaces any bucket of the deployment with the same start
+func (s *Store) Import(ctx context.Context, deployment string, samples []Sample, rollups map[string][]Rollup) error {
+	pipe := s.Client.TxPipeline()
+	for _, sample := range samples {
+		jsonData, err := json.Marshal(sample)
+		if err != nil {
+			return fmt.Errorf("[Failed] to marshal sample: %w", err)
+		}
+		pipe.ZAdd(ctx, Raw.Key(deployment), redis.Z{Score: float64(sample.Time.UnixMilli()), Member: jsonData})
+	}
+	for _, res := range Rollups {
+		for _, r := range rollups[res.Name] {
+			jsonData, err := json.Marshal(r)
+			if err != nil {
+				return fmt.Errorf("[Failed] to marshal rollup: %w", err)
+			}
+			score := strconv.FormatInt(r.Start.Unix(), 10)
+			pipe.ZRemRangeByScore(ctx, res.Key(deployment), score, score)
+			pipe.ZAdd(ctx, res.Key(deployment), redis.Z{Score: float64(r.Start.Unix()), Member: jsonData})
+		}
+	}
+	pipe.SAdd(ctx, DeploymentsKey, deployment)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to import history %w", err)
+	}
+	return nil
+}
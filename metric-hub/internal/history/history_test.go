@@ -0,0 +1,73 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregateBucketsByStep(t *testing.T) {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	var samples []Sample
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, Sample{
+			Time:       base.Add(time.Duration(i) * time.Minute),
+			CPUUsage:   float64(i),
+			CPURequest: 2,
+		})
+	}
+	samples = append(samples, Sample{Time: base.Add(90 * time.Minute), CPUUsage: 100, CPURequest: 2})
+
+	rollups := Aggregate(samples, time.Hour)
+	if len(rollups) != 2 {
+		t.Fatalf("got %d rollups, want 2", len(rollups))
+	}
+
+	first := rollups[0]
+	if !first.Start.Equal(base) || first.Count != 20 {
+		t.Errorf("unexpected first bucket %+v", first)
+	}
+	if first.CPUUsage.Avg != 10.5 || first.CPUUsage.P95 != 19 || first.CPUUsage.Max != 20 {
+		t.Errorf("unexpected cpu usage stats %+v", first.CPUUsage)
+	}
+	if first.CPURequest.Avg != 2 || first.CPURequest.Max != 2 {
+		t.Errorf("unexpected cpu request stats %+v", first.CPURequest)
+	}
+	if rollups[1].Count != 1 || rollups[1].CPUUsage.P95 != 100 {
+		t.Errorf("unexpected second bucket %+v", rollups[1])
+	}
+}
+
+func TestResolutionForStep(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		step time.Duration
+		from time.Time
+		want Resolution
+	}{
+		{5 * time.Minute, now.Add(-6 * time.Hour), Raw},
+		{5 * time.Minute, now.Add(-72 * time.Hour), Hourly},
+		{time.Hour, now.Add(-6 * time.Hour), Hourly},
+		{6 * time.Hour, now.Add(-6 * time.Hour), Hourly},
+		{24 * time.Hour, now.Add(-30 * 24 * time.Hour), Daily},
+	}
+	for _, c := range cases {
+		if got := resolutionFor(Query{Step: c.step, From: c.from}, now); got != c.want {
+			t.Errorf("step %v from %v: got %s, want %s", c.step, c.from, got.Name, c.want.Name)
+		}
+	}
+}
+
+func TestCombineWeightsAverageByCount(t *testing.T) {
+	group := []Stats{{Avg: 1, P95: 2, Max: 3}, {Avg: 4, P95: 5, Max: 9}}
+	counts := []int{3, 1}
+
+	if got := combine(group, counts, AggAvg); got != 1.75 {
+		t.Errorf("avg: got %v, want 1.75", got)
+	}
+	if got := combine(group, counts, AggP95); got != 5 {
+		t.Errorf("p95: got %v, want 5", got)
+	}
+	if got := combine(group, counts, AggMax); got != 9 {
+		t.Errorf("max: got %v, want 9", got)
+	}
+}
@@ -0,0 +1,163 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+)
+
+// queries returning more points than this are rejected, as Prometheus does
+const MaxPoints = 11000
+
+// Metrics that can be queried
+var metrics = map[string]struct {
+	sample func(Sample) float64
+	rollup func(Rollup) Stats
+}{
+	"cpu_usage":      {func(s Sample) float64 { return s.CPUUsage }, func(r Rollup) Stats { return r.CPUUsage }},
+	"cpu_request":    {func(s Sample) float64 { return s.CPURequest }, func(r Rollup) Stats { return r.CPURequest }},
+	"memory_usage":   {func(s Sample) float64 { return s.MemUsage }, func(r Rollup) Stats { return r.MemUsage }},
+	"memory_request": {func(s Sample) float64 { return s.MemRequest }, func(r Rollup) Stats { return r.MemRequest }},
+}
+
+// Aggregations applied when downsampling to the query step
+const (
+	AggAvg = "avg"
+	AggP95 = "p95"
+	AggMax = "max"
+)
+
+type Query struct {
+	Deployment string
+	Metric     string
+	Step       time.Duration
+	From       time.Time
+	To         time.Time
+	Agg        string
+}
+
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+type Series struct {
+	Deployment string  `json:"deployment"`
+	Metric     string  `json:"metric"`
+	Step       string  `json:"step"`
+	Agg        string  `json:"agg"`
+	Resolution string  `json:"resolution"`
+	Points     []Point `json:"points"`
+}
+
+func (q Query) Validate() error {
+	if _, ok := metrics[q.Metric]; !ok {
+		return fmt.Errorf("unknown metric %q", q.Metric)
+	}
+	if q.Agg != AggAvg && q.Agg != AggP95 && q.Agg != AggMax {
+		return fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+	if q.Step <= 0 || !q.From.Before(q.To) {
+		return fmt.Errorf("step must be positive and from before to")
+	}
+	if q.To.Sub(q.From)/q.Step > MaxPoints {
+		return fmt.Errorf("query would return more than %d points, increase step", MaxPoints)
+	}
+	return nil
+}
+
+// Coarsest stored resolution no coarser than the step that still covers from
+func resolutionFor(q Query, now time.Time) Resolution {
+	for i := len(Rollups) - 1; i >= 0; i-- {
+		if Rollups[i].Step <= q.Step {
+			return Rollups[i]
+		}
+	}
+	if q.From.Before(now.Add(-Raw.Retention)) {
+		return Rollups[0]
+	}
+	return Raw
+}
+
+// Query a metric at the requested step
+// raw samples serve steps under an hour within the last 48h, rollups serve the rest
+// rollups only cover complete buckets, so the current hour or day is missing from them
+// p95 over several rollups is the highest bucket p95, an upper bound
+func (s *Store) Query(ctx context.Context, q Query) (*Series, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	res := resolutionFor(q, clock.Now(s.Clock))
+	m := metrics[q.Metric]
+
+	buckets := map[int64][]Stats{}
+	counts := map[int64][]int{}
+	if res == Raw {
+		samples, err := s.samples(ctx, s.reader(), q.Deployment, q.From, q.To)
+		if err != nil {
+			return nil, err
+		}
+		groups := map[int64][]Sample{}
+		for _, sample := range samples {
+			start := sample.Time.Truncate(q.Step).Unix()
+			groups[start] = append(groups[start], sample)
+		}
+		for start, group := range groups {
+			buckets[start] = []Stats{stats(group, m.sample)}
+			counts[start] = []int{len(group)}
+		}
+	} else {
+		rollups, err := s.rollups(ctx, s.reader(), res, q.Deployment, q.From, q.To)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rollups {
+			start := r.Start.Truncate(q.Step).Unix()
+			buckets[start] = append(buckets[start], m.rollup(r))
+			counts[start] = append(counts[start], r.Count)
+		}
+	}
+
+	series := &Series{
+		Deployment: q.Deployment,
+		Metric:     q.Metric,
+		Step:       q.Step.String(),
+		Agg:        q.Agg,
+		Resolution: res.Name,
+		Points:     []Point{},
+	}
+	for t := q.From.Truncate(q.Step); t.Before(q.To); t = t.Add(q.Step) {
+		group, ok := buckets[t.Unix()]
+		if !ok {
+			continue
+		}
+		series.Points = append(series.Points, Point{Time: t.UTC(), Value: combine(group, counts[t.Unix()], q.Agg)})
+	}
+	return series, nil
+}
+
+// merge bucket stats, averages weighted by sample count
+func combine(group []Stats, counts []int, agg string) float64 {
+	var sum, total, max float64
+	for i, st := range group {
+		switch agg {
+		case AggAvg:
+			sum += st.Avg * float64(counts[i])
+			total += float64(counts[i])
+		case AggP95:
+			max = math.Max(max, st.P95)
+		case AggMax:
+			max = math.Max(max, st.Max)
+		}
+	}
+	if agg == AggAvg {
+		if total == 0 {
+			return 0
+		}
+		return sum / total
+	}
+	return max
+}
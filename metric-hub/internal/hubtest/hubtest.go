@@ -0,0 +1,174 @@
+// Package hubtest runs a real Aggregator and RedisQueue against an in-memory miniredis
+// so tests can push payloads and assert on published jobs and stored keys without a redis server
+package hubtest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+)
+
+type Hub struct {
+	t          testing.TB
+	Redis      *miniredis.Miniredis
+	Aggregator *internal.Aggregator
+	// the aggregator's clock, starts at the wall clock and only moves with FastForward
+	Clock *clock.Fake
+}
+
+// Start a hub on a fresh miniredis, both are closed when the test ends
+func New(t testing.TB) *Hub {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	a := internal.NewAggregator(mr.Addr(), "", "")
+	c := clock.NewFake(time.Now().UTC())
+	a.Clock = c
+	a.History.Clock = c
+	a.Cache.Clock = c
+	t.Cleanup(func() {
+		a.Wait()
+		a.Client.Close()
+	})
+	return &Hub{t: t, Redis: mr, Aggregator: a, Clock: c}
+}
+
+// Wait for the evaluations started by earlier pushes
+func (h *Hub) Wait() {
+	h.Aggregator.Wait()
+}
+
+// Save a cost payload as a push would and wait for its evaluation
+func (h *Hub) PushCost(p *internal.CostPayload) {
+	h.t.Helper()
+	if err := h.Aggregator.SaveCostPayload(context.Background(), p); err != nil {
+		h.t.Fatalf("cost push failed: %v", err)
+	}
+	h.Wait()
+}
+
+// Merge a forecast as a push would and wait for its evaluation
+func (h *Hub) PushForecast(p *internal.ForecastPayload) {
+	h.t.Helper()
+	if err := h.Aggregator.FetchPayload(context.Background(), p); err != nil {
+		h.t.Fatalf("forecast push failed: %v", err)
+	}
+	h.Wait()
+}
+
+// Advance the hub clock and redis TTLs together, e.g. to expire cooldowns or locks
+func (h *Hub) FastForward(d time.Duration) {
+	h.Clock.Advance(d)
+	h.Redis.FastForward(d)
+}
+
+// Messages on the agent queue, oldest first
+// the queue is left as it is, so repeated calls see the same messages
+func (h *Hub) Messages() []queue.Envelope {
+	h.t.Helper()
+	raw, err := h.Redis.List(internal.AgentQueueKey)
+	if err == miniredis.ErrKeyNotFound {
+		return nil
+	} else if err != nil {
+		h.t.Fatalf("failed to read the agent queue: %v", err)
+	}
+
+	// LPUSH puts the newest message at the head
+	msgs := make([]queue.Envelope, len(raw))
+	for i, r := range raw {
+		msg := &msgs[len(raw)-1-i]
+		if err := json.Unmarshal([]byte(r), msg); err != nil || msg.Version != queue.EnvelopeVersion {
+			h.t.Fatalf("invalid message on the queue: %s", r)
+		}
+	}
+	return msgs
+}
+
+// Jobs on the agent queue, oldest first
+func (h *Hub) Jobs() []internal.AgentJob {
+	h.t.Helper()
+	msgs := h.Messages()
+	if msgs == nil {
+		return nil
+	}
+	jobs := make([]internal.AgentJob, len(msgs))
+	for i, msg := range msgs {
+		if err := json.Unmarshal(msg.Payload, &jobs[i]); err != nil {
+			h.t.Fatalf("invalid job on the queue: %v", err)
+		}
+	}
+	return jobs
+}
+
+// Drop every queued job
+func (h *Hub) ClearJobs() {
+	h.Redis.Del(internal.AgentQueueKey)
+}
+
+// Fail unless exactly n jobs are queued
+func (h *Hub) AssertJobCount(n int) []internal.AgentJob {
+	h.t.Helper()
+	jobs := h.Jobs()
+	if len(jobs) != n {
+		h.t.Fatalf("expected %d queued jobs, got %d: %+v", n, len(jobs), jobs)
+	}
+	return jobs
+}
+
+// The queued deployment job for ns/name, failing the test when there is none
+func (h *Hub) RequireJob(ns string, name string) internal.AgentJob {
+	h.t.Helper()
+	for _, job := range h.Jobs() {
+		if job.Namespace == ns && job.Deployment != nil && job.Deployment.Name == name {
+			return job
+		}
+	}
+	h.t.Fatalf("expected a queued job for %s/%s, got %+v", ns, name, h.Jobs())
+	return internal.AgentJob{}
+}
+
+// Fail if any deployment job is queued for ns/name
+func (h *Hub) AssertNoJob(ns string, name string) {
+	h.t.Helper()
+	for _, job := range h.Jobs() {
+		if job.Namespace == ns && job.Deployment != nil && job.Deployment.Name == name {
+			h.t.Fatalf("expected no job for %s/%s, got %+v", ns, name, job)
+		}
+	}
+}
+
+// Fail unless the key exists
+func (h *Hub) AssertKey(key string) {
+	h.t.Helper()
+	if !h.Redis.Exists(key) {
+		h.t.Fatalf("expected key %s to exist, keys are %v", key, h.Redis.Keys())
+	}
+}
+
+func (h *Hub) AssertNoKey(key string) {
+	h.t.Helper()
+	if h.Redis.Exists(key) {
+		h.t.Fatalf("expected key %s not to exist", key)
+	}
+}
+
+// Events of one type in the decision log
+func (h *Hub) Events(eventType string) []internal.Event {
+	h.t.Helper()
+	events, err := h.Aggregator.ReadEvents(h.t.Context(), time.Time{}, time.Time{})
+	if err != nil {
+		h.t.Fatalf("failed to read events: %v", err)
+	}
+	var matched []internal.Event
+	for _, ev := range events {
+		if ev.Type == eventType {
+			matched = append(matched, ev)
+		}
+	}
+	return matched
+}
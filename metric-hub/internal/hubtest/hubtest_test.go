@@ -0,0 +1,952 @@
+package hubtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/gate"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/kube"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+func costPayload(usageMB float64, ts time.Time) *internal.CostPayload {
+	return &internal.CostPayload{
+		Timestamp:   ts,
+		Namespace:   "default",
+		ClusterInfo: internal.ClusterInfo{VmCount: 3, Cost: 0.36},
+		Deployments: []internal.CostDeployment{{
+			Name:            "cartservice",
+			CurrentRequests: internal.Resources{CPUCores: 0.5, MemoryMB: 512},
+			CurrentUsage:    internal.Resources{CPUCores: 0.3, MemoryMB: usageMB},
+		}},
+	}
+}
+
+func TestWastePublishesJobAndStartsCooldown(t *testing.T) {
+	hub := New(t)
+	now := time.Now().UTC()
+
+	hub.PushCost(costPayload(64, now))
+	job := hub.RequireJob("default", "cartservice")
+	if job.Reason != "High Memory Waste" || job.Recommendation == nil {
+		t.Errorf("expected a memory waste job with a recommendation, got %+v", job)
+	}
+	hub.AssertKey("trigger:cooldown:cartservice")
+	if ttl := hub.Redis.TTL("trigger:cooldown:cartservice"); ttl != 30*time.Minute {
+		t.Errorf("expected the cooldown to expire with the default 30m cooldown, got %v", ttl)
+	}
+	if n := len(hub.Events(internal.EventJobPublished)); n != 1 {
+		t.Errorf("expected 1 job_published event, got %d", n)
+	}
+
+	// still wasteful, but inside the cooldown
+	hub.PushCost(costPayload(64, now.Add(time.Minute)))
+	hub.AssertJobCount(1)
+}
+
+func TestJobsAreEnvelopedAndRouted(t *testing.T) {
+	hub := New(t)
+	hub.Aggregator.ClusterID = "prod-eu"
+
+	hub.PushCost(costPayload(64, time.Now().UTC()))
+	msgs := hub.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	if m := msgs[0]; m.Type != "deployment" || m.Tenant != "default" || m.Cluster != "prod-eu" || m.RoutingKey != "prod-eu.default" {
+		t.Errorf("expected a deployment envelope routed to prod-eu.default, got %+v", m)
+	}
+
+	// namespace routing gives the namespace its own list
+	hub.Aggregator.Queue = &queue.RedisQueue{Client: hub.Aggregator.Client, Routing: queue.RouteNamespace}
+	hub.ClearJobs()
+	hub.FastForward(31 * time.Minute)
+	hub.PushCost(costPayload(64, hub.Clock.Now()))
+	hub.AssertJobCount(0)
+	if items, _ := hub.Redis.List("queue:agent:jobs:prod-eu:default"); len(items) != 1 {
+		t.Errorf("expected the job on the namespace list, got %v", items)
+	}
+}
+
+func TestQueueRoutesByNamespaceAndSeverity(t *testing.T) {
+	hub := New(t)
+	hub.Aggregator.QueueRoutes = []internal.QueueRoute{
+		{Queue: "queue:agent:payments", Namespaces: []string{"payments"}},
+		{Queue: "queue:agent:critical", MinSeverity: notify.SeverityCritical},
+	}
+	now := hub.Clock.Now()
+
+	hub.PushCost(costPayload(64, now))
+	payments := costPayload(64, now)
+	payments.Namespace = "payments"
+	payments.Deployments[0].Name = "ledger"
+	hub.PushCost(payments)
+	risk := costPayload(500, now)
+	risk.Deployments[0].Name = "checkout"
+	hub.PushCost(risk)
+
+	if jobs := hub.Jobs(); len(jobs) != 1 || jobs[0].Deployment.Name != "cartservice" {
+		t.Errorf("expected only the unrouted job on the shared queue, got %+v", jobs)
+	}
+	for queueName, want := range map[string]int{"queue:agent:payments": 1, "queue:agent:critical": 1} {
+		if items, _ := hub.Redis.List(queueName); len(items) != want {
+			t.Errorf("expected %d jobs on %s, got %d", want, queueName, len(items))
+		}
+	}
+}
+
+func TestRetriedJobIsPublishedOnce(t *testing.T) {
+	hub := New(t)
+	now := hub.Clock.Now()
+
+	hub.PushCost(costPayload(64, now))
+	first := hub.Messages()
+	if len(first) != 1 || first[0].ID == "" {
+		t.Fatalf("expected one job with an id, got %+v", first)
+	}
+
+	// a retry inside the window, e.g. after the cooldown write was lost
+	hub.Redis.Del("trigger:cooldown:cartservice")
+	hub.PushCost(costPayload(64, now.Add(time.Minute)))
+	hub.AssertJobCount(1)
+
+	// the next window is a new job
+	hub.Redis.Del("trigger:cooldown:cartservice")
+	hub.FastForward(30 * time.Minute)
+	hub.PushCost(costPayload(64, now.Add(30*time.Minute)))
+	if msgs := hub.Messages(); len(msgs) != 2 || msgs[1].ID == first[0].ID {
+		t.Errorf("expected a second job with a new id, got %+v", msgs)
+	}
+}
+
+func TestCooldownExpiresWithClock(t *testing.T) {
+	hub := New(t)
+	now := hub.Clock.Now()
+
+	hub.PushCost(costPayload(64, now))
+	hub.AssertJobCount(1)
+
+	hub.FastForward(29 * time.Minute)
+	hub.PushCost(costPayload(64, now.Add(29*time.Minute)))
+	hub.AssertJobCount(1)
+
+	// past the default 30 minute cooldown
+	hub.FastForward(2 * time.Minute)
+	hub.PushCost(costPayload(64, now.Add(31*time.Minute)))
+	hub.AssertJobCount(2)
+}
+
+func TestEvaluationOutlivesRequestContext(t *testing.T) {
+	hub := New(t)
+
+	// the handler's context is cancelled once the response is written
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := hub.Aggregator.SaveCostPayload(ctx, costPayload(64, hub.Clock.Now())); err != nil {
+		t.Fatalf("cost push failed: %v", err)
+	}
+	cancel()
+	hub.Wait()
+	hub.RequireJob("default", "cartservice")
+}
+
+func TestQueriesReadReplica(t *testing.T) {
+	hub := New(t)
+	replica := miniredis.RunT(t)
+	hub.Aggregator.Replica = redis.NewClient(&redis.Options{Addr: replica.Addr()})
+	defer hub.Aggregator.Replica.Close()
+	ctx := context.Background()
+
+	now := hub.Clock.Now()
+	hub.PushCost(costPayload(300, now))
+	// nothing replicated yet, so queries see no data
+	if _, err := hub.Aggregator.ClusterSummary(ctx, internal.DefaultClusterID); !errors.Is(err, internal.ErrNoCostData) {
+		t.Errorf("expected the summary to read the empty replica, got %v", err)
+	}
+	// forecast ingestion still merges with the primary's cost payload
+	hub.PushForecast(&internal.ForecastPayload{
+		Timestamp: now.Add(time.Minute),
+		Namespace: "default",
+		Deployments: []internal.ForecastDeployment{{
+			Name:           "cartservice",
+			PredictPeak24h: internal.Resources{CPUCores: 0.3, MemoryMB: 600},
+		}},
+	})
+	hub.RequireJob("default", "cartservice")
+
+	raw, _ := hub.Redis.Get(internal.LatestCostKey)
+	replica.Set(internal.LatestCostKey, raw)
+	if _, err := hub.Aggregator.ClusterSummary(ctx, internal.DefaultClusterID); err != nil {
+		t.Errorf("expected the summary from the replica, got %v", err)
+	}
+}
+
+func TestPolicyCacheExpiresAndInvalidates(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	if got := hub.Aggregator.ActivePolicy(ctx).CooldownSeconds; got != 1800 {
+		t.Fatalf("expected the default cooldown, got %d", got)
+	}
+
+	// written behind the hub's back, as another replica would
+	hub.Redis.Set(internal.ActivePolicyKey, `{"cooldown_seconds": 60}`)
+	if got := hub.Aggregator.ActivePolicy(ctx).CooldownSeconds; got != 1800 {
+		t.Errorf("expected the cached policy inside the ttl, got %d", got)
+	}
+	hub.FastForward(internal.DefaultCacheTTL)
+	if got := hub.Aggregator.ActivePolicy(ctx).CooldownSeconds; got != 60 {
+		t.Errorf("expected the stored policy once the ttl passed, got %d", got)
+	}
+
+	// local writes are seen straight away
+	policy := internal.DefaultPolicy()
+	policy.CooldownSeconds = 120
+	if err := hub.Aggregator.SavePolicy(ctx, &policy); err != nil {
+		t.Fatal(err)
+	}
+	if got := hub.Aggregator.ActivePolicy(ctx).CooldownSeconds; got != 120 {
+		t.Errorf("expected the saved policy, got %d", got)
+	}
+}
+
+func TestWarmupHoldsTriggers(t *testing.T) {
+	hub := New(t)
+	policy := internal.DefaultPolicy()
+	policy.WarmupSamples = 2
+	if err := hub.Aggregator.SavePolicy(context.Background(), &policy); err != nil {
+		t.Fatal(err)
+	}
+	now := hub.Clock.Now()
+
+	// the first two payloads after startup are only collected
+	for i := range 2 {
+		hub.PushCost(costPayload(64, now.Add(time.Duration(i)*time.Minute)))
+	}
+	hub.AssertJobCount(0)
+	hub.PushCost(costPayload(64, now.Add(2*time.Minute)))
+	hub.AssertJobCount(1)
+
+	// a deployment appearing later warms up on its own
+	p := costPayload(64, now.Add(3*time.Minute))
+	p.Deployments[0].Name = "checkout"
+	hub.PushCost(p)
+	hub.AssertJobCount(1)
+}
+
+func TestRolloutHoldsTriggers(t *testing.T) {
+	hub := New(t)
+	policy := internal.DefaultPolicy()
+	policy.CooldownSeconds = 0
+	if err := hub.Aggregator.SavePolicy(context.Background(), &policy); err != nil {
+		t.Fatal(err)
+	}
+	push := func(generation int64, inProgress bool) {
+		p := costPayload(64, hub.Clock.Now())
+		p.Deployments[0].Rollout = &internal.Rollout{Generation: generation, InProgress: inProgress}
+		hub.PushCost(p)
+		hub.FastForward(time.Minute)
+	}
+
+	// the generation the hub first sees isn't a rollout
+	push(1, false)
+	hub.AssertJobCount(1)
+
+	// a new generation holds triggers for the grace period
+	push(2, false)
+	hub.AssertJobCount(1)
+	hub.FastForward(10 * time.Minute)
+	push(2, false)
+	hub.AssertJobCount(1)
+	hub.FastForward(5 * time.Minute)
+	push(2, false)
+	hub.AssertJobCount(2)
+
+	// and for as long as the rollout runs
+	push(2, true)
+	hub.AssertJobCount(2)
+}
+
+func TestLargePayloadIsEvaluatedInShards(t *testing.T) {
+	hub := New(t)
+	hub.Aggregator.ShardSize = 3
+	p := costPayload(64, hub.Clock.Now())
+	for i := 1; i < 10; i++ {
+		d := p.Deployments[0]
+		d.Name = fmt.Sprintf("cartservice-%d", i)
+		p.Deployments = append(p.Deployments, d)
+	}
+
+	hub.PushCost(p)
+	hub.AssertJobCount(10)
+	runs, err := hub.Aggregator.EvaluationRuns(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Shards != 4 || runs[0].Done != 4 {
+		t.Errorf("expected one run with 4 finished shards, got %+v", runs)
+	}
+}
+
+func TestForecastScriptsSeeMergedRecord(t *testing.T) {
+	hub := New(t)
+	now := hub.Clock.Now()
+	err := hub.Aggregator.SaveScript(context.Background(), "growth", `
+def evaluate(d):
+    if d["predicted_peak_24h"]["memory_mb"] > d["current_usage"]["memory_mb"] * 1.05:
+        return "Scripted Growth"
+    return None
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.PushCost(costPayload(300, now))
+	hub.AssertJobCount(0)
+
+	hub.PushForecast(&internal.ForecastPayload{
+		Timestamp: now.Add(time.Minute),
+		Namespace: "default",
+		Deployments: []internal.ForecastDeployment{{
+			Name:           "cartservice",
+			PredictPeak24h: internal.Resources{CPUCores: 0.3, MemoryMB: 330},
+		}},
+	})
+	if job := hub.RequireJob("default", "cartservice"); job.Reason != "Scripted Growth" {
+		t.Errorf("expected the script to trigger on the forecast, got %q", job.Reason)
+	}
+}
+
+func TestHealthyDeploymentPublishesNothing(t *testing.T) {
+	hub := New(t)
+	hub.PushCost(costPayload(300, time.Now().UTC()))
+
+	hub.AssertJobCount(0)
+	hub.AssertNoKey("trigger:cooldown:cartservice")
+	hub.AssertKey(internal.LatestCostKey)
+}
+
+func TestForecastRiskPublishesJob(t *testing.T) {
+	hub := New(t)
+	now := time.Now().UTC()
+	hub.PushCost(costPayload(300, now))
+
+	hub.PushForecast(&internal.ForecastPayload{
+		Timestamp: now.Add(time.Minute),
+		Namespace: "default",
+		Deployments: []internal.ForecastDeployment{{
+			Name:           "cartservice",
+			PredictPeak24h: internal.Resources{CPUCores: 0.3, MemoryMB: 600},
+		}},
+	})
+	job := hub.RequireJob("default", "cartservice")
+	if job.Reason != "Predicted Capacity Risk (Memory)" {
+		t.Errorf("expected a memory capacity risk, got %q", job.Reason)
+	}
+}
+
+func TestOrphanForecastEvaluatedWhenDeploymentAppears(t *testing.T) {
+	hub := New(t)
+	now := hub.Clock.Now()
+	hub.PushCost(costPayload(300, now))
+
+	// checkout isn't in cost:latest yet, its forecast is kept for a day
+	hub.PushForecast(&internal.ForecastPayload{
+		Timestamp: now,
+		Namespace: "default",
+		Deployments: []internal.ForecastDeployment{{
+			Name:           "checkout",
+			PredictPeak24h: internal.Resources{CPUCores: 0.3, MemoryMB: 600},
+		}},
+	})
+	hub.AssertJobCount(0)
+	hub.AssertKey("forecast:orphan:default:checkout")
+	if ttl := hub.Redis.TTL("forecast:orphan:default:checkout"); ttl != internal.OrphanForecastTTL {
+		t.Errorf("expected the orphan to expire after %v, got %v", internal.OrphanForecastTTL, ttl)
+	}
+
+	hub.FastForward(time.Hour)
+	p := costPayload(300, hub.Clock.Now())
+	p.Deployments = append(p.Deployments, internal.CostDeployment{
+		Name:            "checkout",
+		CurrentRequests: internal.Resources{CPUCores: 0.5, MemoryMB: 512},
+		CurrentUsage:    internal.Resources{CPUCores: 0.3, MemoryMB: 300},
+	})
+	hub.PushCost(p)
+
+	job := hub.RequireJob("default", "checkout")
+	if job.Reason != "Predicted Capacity Risk (Memory)" {
+		t.Errorf("expected the stored forecast to raise a memory capacity risk, got %q", job.Reason)
+	}
+	hub.AssertNoKey("forecast:orphan:default:checkout")
+}
+
+func TestOrphanForecastExpires(t *testing.T) {
+	hub := New(t)
+	now := hub.Clock.Now()
+	hub.PushCost(costPayload(300, now))
+	hub.PushForecast(&internal.ForecastPayload{
+		Timestamp: now,
+		Namespace: "default",
+		Deployments: []internal.ForecastDeployment{{
+			Name:           "checkout",
+			PredictPeak24h: internal.Resources{CPUCores: 0.3, MemoryMB: 600},
+		}},
+	})
+
+	hub.FastForward(internal.OrphanForecastTTL)
+	hub.AssertNoKey("forecast:orphan:default:checkout")
+	p := costPayload(300, hub.Clock.Now())
+	p.Deployments = append(p.Deployments, internal.CostDeployment{
+		Name:            "checkout",
+		CurrentRequests: internal.Resources{CPUCores: 0.5, MemoryMB: 512},
+		CurrentUsage:    internal.Resources{CPUCores: 0.3, MemoryMB: 300},
+	})
+	hub.PushCost(p)
+	hub.AssertJobCount(0)
+}
+
+func TestIntervalEvaluatesMergedLatestState(t *testing.T) {
+	hub := New(t)
+	hub.Aggregator.EvaluationInterval = time.Minute
+	now := hub.Clock.Now()
+
+	// the forecast arrives first and waits for the cost payload instead of becoming an orphan
+	hub.PushForecast(&internal.ForecastPayload{
+		Timestamp: now,
+		Namespace: "default",
+		Deployments: []internal.ForecastDeployment{{
+			Name:           "cartservice",
+			PredictPeak24h: internal.Resources{CPUCores: 0.3, MemoryMB: 600},
+		}},
+	})
+	for i := range 3 {
+		hub.PushCost(costPayload(300, now.Add(time.Duration(i)*time.Second)))
+	}
+	hub.AssertJobCount(0)
+
+	if err := hub.Aggregator.EvaluateLatest(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	job := hub.RequireJob("default", "cartservice")
+	if job.Reason != "Predicted Capacity Risk (Memory)" {
+		t.Errorf("expected a memory capacity risk, got %q", job.Reason)
+	}
+
+	// nothing new since the last tick
+	if err := hub.Aggregator.EvaluateLatest(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	hub.AssertJobCount(1)
+}
+
+func TestInventoryShowsUnreportedDeployments(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	hub.PushCost(costPayload(300, hub.Clock.Now()))
+
+	inv := &kube.Inventory{
+		Namespaces: []string{"batch", "default"},
+		Workloads: []kube.Workload{
+			{Namespace: "batch", Name: "reindex", Replicas: 1, CPUCores: 2, MemoryMB: 4096},
+			{Namespace: "default", Name: "cartservice", Replicas: 2, CPUCores: 0.5, MemoryMB: 512},
+		},
+	}
+	if err := hub.Aggregator.SyncInventory(ctx, inv); err != nil {
+		t.Fatal(err)
+	}
+	report, err := hub.Aggregator.Inventory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Deployments) != 2 || report.Unreported != 1 {
+		t.Fatalf("expected two deployments with one unreported, got %+v", report)
+	}
+	if d := report.Deployments[0]; d.Name != "reindex" || d.Reported {
+		t.Errorf("expected reindex unreported, got %+v", d)
+	}
+	if d := report.Deployments[1]; d.Name != "cartservice" || !d.Reported {
+		t.Errorf("expected cartservice reported, got %+v", d)
+	}
+
+	// a namespace no producer covers still gets a row
+	reports, err := hub.Aggregator.CompareNamespaces(ctx, hub.Clock.Now().Add(-time.Hour), hub.Clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || reports[1].Namespace != "batch" || reports[1].Payloads != 0 {
+		t.Errorf("expected an empty batch row after default, got %+v", reports)
+	}
+
+	// deleted deployments are dropped on the next sync
+	inv.Workloads = inv.Workloads[1:]
+	if err := hub.Aggregator.SyncInventory(ctx, inv); err != nil {
+		t.Fatal(err)
+	}
+	if report, _ := hub.Aggregator.Inventory(ctx); len(report.Deployments) != 1 {
+		t.Errorf("expected reindex dropped, got %+v", report.Deployments)
+	}
+}
+
+type recordingNotifier struct {
+	sent []notify.Notification
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func TestOwnershipReachesJobsAndNotifications(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	notifier := &recordingNotifier{}
+	hub.Aggregator.Notifier = notifier
+	if err := hub.Aggregator.SaveOwner(ctx, "default", "", &internal.Ownership{Team: "platform", SlackChannel: "#platform"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.Aggregator.SaveOwner(ctx, "default", "cartservice", &internal.Ownership{OnCall: "cart-primary"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the payload label wins over the namespace's team, the mappings fill in the rest
+	p := costPayload(500, hub.Clock.Now())
+	p.Deployments[0].Labels = map[string]string{internal.LabelTeam: "checkout"}
+	hub.PushCost(p)
+
+	job := hub.RequireJob("default", "cartservice")
+	want := internal.Ownership{Team: "checkout", SlackChannel: "#platform", OnCall: "cart-primary"}
+	if job.Ownership == nil || *job.Ownership != want {
+		t.Errorf("expected %+v, got %+v", want, job.Ownership)
+	}
+	if len(notifier.sent) != 1 || notifier.sent[0].Labels["team"] != "checkout" || notifier.sent[0].Labels["slack_channel"] != "#platform" {
+		t.Errorf("expected the incident labelled with its owner, got %+v", notifier.sent)
+	}
+}
+
+func TestRoutingRulesDecideChannelsAndApproval(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	pager := &recordingNotifier{}
+	slack := &recordingNotifier{}
+	hub.Aggregator.Channels = map[string]notify.Notifier{"pagerduty": pager, "slack": slack}
+	if err := hub.Aggregator.SaveRoutingRule(ctx, &internal.RoutingRule{Name: "bad", Channels: []string{"teams"}}); !errors.Is(err, internal.ErrUnknownChannel) {
+		t.Errorf("expected ErrUnknownChannel, got %v", err)
+	}
+	// rules are evaluated in name order, the payments rule wins over the catch-all
+	rules := []internal.RoutingRule{
+		{Name: "10-payments", Labels: map[string]string{internal.LabelTeam: "payments"}, MinSeverity: notify.SeverityCritical, Channels: []string{"pagerduty"}, Approval: internal.ApprovalNotifyOnly},
+		{Name: "99-default", Channels: []string{"slack"}},
+	}
+	for _, r := range rules {
+		if err := hub.Aggregator.SaveRoutingRule(ctx, &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hub.Aggregator.SaveOwner(ctx, "default", "", &internal.Ownership{Team: "payments"}); err != nil {
+		t.Fatal(err)
+	}
+
+	hub.PushCost(costPayload(500, hub.Clock.Now()))
+
+	job := hub.RequireJob("default", "cartservice")
+	if job.Routing == nil || job.Routing.Rule != "10-payments" || job.Action != internal.ActionNotifyOnly {
+		t.Errorf("expected a notify-only job routed by 10-payments, got %+v %+v", job.Action, job.Routing)
+	}
+	if len(pager.sent) != 1 || pager.sent[0].Labels["rule"] != "10-payments" {
+		t.Errorf("expected one pagerduty notification, got %+v", pager.sent)
+	}
+	if len(slack.sent) != 0 {
+		t.Errorf("expected no slack notification, got %+v", slack.sent)
+	}
+}
+
+// denies jobs routed as notify-only, recording every job it is asked about
+type recordingGate struct {
+	checked []internal.AgentJob
+}
+
+func (g *recordingGate) Check(ctx context.Context, job interface{}) (*gate.Decision, error) {
+	j := job.(internal.AgentJob)
+	g.checked = append(g.checked, j)
+	if j.Action == internal.ActionNotifyOnly {
+		return &gate.Decision{Reasons: []string{"notify-only jobs are not published"}}, nil
+	}
+	return &gate.Decision{Allow: true}, nil
+}
+
+func TestGateSeesEnrichedJob(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	g := &recordingGate{}
+	hub.Aggregator.Gate = g
+	policy := internal.DefaultPolicy()
+	policy.Automation.Enabled = true
+	if err := hub.Aggregator.SavePolicy(ctx, &policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.Aggregator.SaveRoutingRule(ctx, &internal.RoutingRule{Name: "payments", Labels: map[string]string{internal.LabelTeam: "payments"}, Approval: internal.ApprovalNotifyOnly}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.Aggregator.SaveOwner(ctx, "default", "", &internal.Ownership{Team: "payments"}); err != nil {
+		t.Fatal(err)
+	}
+
+	hub.PushCost(costPayload(500, hub.Clock.Now()))
+
+	hub.AssertJobCount(0)
+	if len(g.checked) != 1 {
+		t.Fatalf("expected the gate asked once, got %d", len(g.checked))
+	}
+	job := g.checked[0]
+	if job.Ownership == nil || job.Ownership.Team != "payments" || job.Routing == nil || job.Routing.Rule != "payments" || job.Automation == nil {
+		t.Errorf("expected the gate to see the owner, routing and tier, got %+v %+v %+v", job.Ownership, job.Routing, job.Automation)
+	}
+}
+
+func TestAlertmanagerAlertsPublishJobs(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+
+	// healthy usage, so only the alert can publish
+	hub.PushCost(costPayload(400, hub.Clock.Now()))
+	hub.AssertJobCount(0)
+
+	webhook := &internal.AlertmanagerWebhook{Version: "4", Status: "firing", Alerts: []internal.Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "HighMemoryUsage", "namespace": "default", "pod": "cartservice-7d9f8b6c5-x2k4p"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "HighMemoryUsage", "namespace": "default", "deployment": "checkout"}},
+		{Status: "resolved", Labels: map[string]string{"alertname": "KubePodCrashLooping", "namespace": "default", "deployment": "cartservice"}},
+	}}
+	outcomes, err := hub.Aggregator.ReceiveAlerts(ctx, webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{internal.AlertPublished, internal.AlertUnknownDeployment, internal.AlertResolved}
+	for i, o := range outcomes {
+		if o.Outcome != want[i] {
+			t.Errorf("alert %d: expected %s, got %+v", i, want[i], o)
+		}
+	}
+	job := hub.RequireJob("default", "cartservice")
+	if job.Reason != "High Memory Risk" {
+		t.Errorf("expected the alert mapped to High Memory Risk, got %q", job.Reason)
+	}
+
+	// a repeated notification falls inside the cooldown the first one started
+	outcomes, err = hub.Aggregator.ReceiveAlerts(ctx, webhook)
+	if err != nil || outcomes[0].Outcome != internal.AlertCooldown {
+		t.Errorf("expected cooldown, got %+v %v", outcomes, err)
+	}
+	hub.AssertJobCount(1)
+}
+
+func TestClusterCostSpikePublishesClusterJob(t *testing.T) {
+	hub := New(t)
+	now := hub.Clock.Now()
+
+	// healthy usage so only the cluster check can publish
+	hub.PushCost(costPayload(400, now))
+	hub.AssertJobCount(0)
+
+	spike := costPayload(400, now.Add(time.Minute))
+	spike.ClusterInfo = internal.ClusterInfo{VmCount: 9, Cost: 1.08}
+	hub.PushCost(spike)
+	jobs := hub.AssertJobCount(2)
+	for _, job := range jobs {
+		if job.TargetType != internal.TargetCluster || job.Action != internal.ActionNotifyOnly {
+			t.Errorf("expected notify-only cluster jobs, got %+v", job)
+		}
+	}
+	hub.AssertKey("trigger:cooldown:cluster:cluster-cost-spike")
+
+	// scaling back down is another node change, but inside the cooldown
+	hub.PushCost(costPayload(400, now.Add(2*time.Minute)))
+	hub.AssertJobCount(2)
+}
+
+func TestClusterSummaryIdleCostTrend(t *testing.T) {
+	hub := New(t)
+	now := hub.Clock.Now()
+	withNodes := func(nodes int, ts time.Time) *internal.CostPayload {
+		p := costPayload(400, ts)
+		p.NodeGroups = []internal.NodeGroup{{
+			Name: "workers", InstanceType: "medium", NodeCount: nodes, HourlyCostPerNode: 0.1,
+			NodeCapacity: internal.Resources{CPUCores: 1, MemoryMB: 1024},
+			Requested:    internal.Resources{CPUCores: 1, MemoryMB: 1024},
+		}}
+		return p
+	}
+
+	hub.PushCost(withNodes(1, now))
+	summary, err := hub.Aggregator.ClusterSummary(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Idle == nil || summary.Idle.HourlyCost != 0 || summary.Idle.Change24h != nil {
+		t.Fatalf("expected no idle cost and no trend yet, got %+v", summary.Idle)
+	}
+
+	// two more nodes nobody requested
+	hub.FastForward(25 * time.Hour)
+	hub.PushCost(withNodes(3, now.Add(25*time.Hour)))
+	summary, err = hub.Aggregator.ClusterSummary(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := summary.Idle.Change24h; c == nil || *c < 0.199 || *c > 0.201 {
+		t.Errorf("expected idle cost up 0.2/h over 24h, got %v", c)
+	}
+	if summary.Idle.Change7d != nil {
+		t.Errorf("expected no weekly trend yet, got %v", *summary.Idle.Change7d)
+	}
+}
+
+func TestLowQualityDataSuppressesTriggersAndAlerts(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	notifier := &recordingNotifier{}
+	hub.Aggregator.Notifier = notifier
+	producerAlerts := func() []notify.Notification {
+		var alerts []notify.Notification
+		for _, n := range notifier.sent {
+			if n.Labels["producer"] == "cost-engine" {
+				alerts = append(alerts, n)
+			}
+		}
+		return alerts
+	}
+
+	// practically no usage of 2 cores and 4GB, a broken usage metric rather than waste
+	p := costPayload(2, hub.Clock.Now())
+	p.Deployments[0].CurrentRequests = internal.Resources{CPUCores: 2, MemoryMB: 4096}
+	p.Deployments[0].CurrentUsage.CPUCores = 0.0005
+	hub.PushCost(p)
+	hub.AssertNoJob("default", "cartservice")
+
+	reports, err := hub.Aggregator.QualityReports(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Score != 0 || !reports[0].LowQuality || reports[0].Issues[0].Check != internal.QualityIdleHighRequest {
+		t.Fatalf("expected one low quality report for the idle deployment, got %+v", reports)
+	}
+	if alerts := producerAlerts(); len(alerts) != 1 || alerts[0].Severity != notify.SeverityWarning {
+		t.Fatalf("expected a warning on the producer, got %+v", alerts)
+	}
+
+	hub.PushCost(costPayload(64, hub.Clock.Now().Add(time.Minute)))
+	hub.RequireJob("default", "cartservice")
+	if alerts := producerAlerts(); len(alerts) != 2 || alerts[1].Severity != notify.SeverityInfo {
+		t.Errorf("expected the producer to recover, got %+v", alerts)
+	}
+}
+
+func TestRecommendationHistoryTracksOutcomes(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	now := hub.Clock.Now()
+
+	hub.PushCost(costPayload(64, now))
+	hub.RequireJob("default", "cartservice")
+	hub.FastForward(31 * time.Minute)
+	hub.PushCost(costPayload(100, now.Add(31*time.Minute)))
+	hub.RequireJob("default", "cartservice")
+
+	records, err := hub.Aggregator.RecommendationHistory(ctx, "default", "cartservice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Status != internal.RecommendationPublished || records[0].Reason != "High Memory Waste" {
+		t.Fatalf("expected two published recommendations, got %+v", records)
+	}
+	if records[0].Current.MemoryMB != 512 || !records[0].RecommendedAt.After(records[1].RecommendedAt) {
+		t.Errorf("expected the newest first with its current requests, got %+v", records)
+	}
+
+	// without a job id the newest one still published is resolved
+	if _, err := hub.Aggregator.RecordOutcome(ctx, &internal.Outcome{Namespace: "default", Deployment: "cartservice", Outcome: internal.OutcomeApplied}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hub.Aggregator.RecordOutcome(ctx, &internal.Outcome{JobID: records[1].ID, Namespace: "default", Deployment: "cartservice", Outcome: "rolled_back", Detail: "OOMKilled"}); err != nil {
+		t.Fatal(err)
+	}
+	records, _ = hub.Aggregator.RecommendationHistory(ctx, "default", "cartservice")
+	if records[0].Status != internal.OutcomeApplied || records[0].ResolvedAt == nil {
+		t.Errorf("expected the newest applied, got %+v", records[0])
+	}
+	if records[1].Status != "rolled_back" || records[1].Detail != "OOMKilled" {
+		t.Errorf("expected the oldest rolled back, got %+v", records[1])
+	}
+}
+
+func TestAutomationTierFollowsTrackRecord(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	now := hub.Clock.Now()
+
+	policy := internal.DefaultPolicy()
+	policy.Automation.Enabled = true
+	if err := hub.Aggregator.SavePolicy(ctx, &policy); err != nil {
+		t.Fatal(err)
+	}
+
+	hub.PushCost(costPayload(64, now))
+	job := hub.RequireJob("default", "cartservice")
+	if job.Automation == nil || job.Automation.Tier != internal.ApprovalManual || job.Action != internal.ActionApply {
+		t.Fatalf("expected a manual tier for a 30%% step on instant usage, got %+v", job.Automation)
+	}
+
+	if _, err := hub.Aggregator.RecordOutcome(ctx, &internal.Outcome{Namespace: "default", Deployment: "cartservice", Outcome: internal.OutcomeRolledBack}); err != nil {
+		t.Fatal(err)
+	}
+	// past the rollback hold
+	hub.ClearJobs()
+	hub.FastForward(25 * time.Hour)
+	hub.PushCost(costPayload(64, now.Add(25*time.Hour)))
+	job = hub.RequireJob("default", "cartservice")
+	if job.Automation == nil || job.Automation.Tier != internal.ApprovalNotifyOnly || job.Action != internal.ActionNotifyOnly {
+		t.Errorf("expected a rolled back deployment to be notify only, got %+v action %s", job.Automation, job.Action)
+	}
+}
+
+func TestBudgetBreachIsNotifiedOncePerMonth(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	hub.Clock.Set(time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC))
+	now := hub.Clock.Now()
+	notifier := &recordingNotifier{}
+	hub.Aggregator.Notifier = notifier
+	budgetAlerts := func() []notify.Notification {
+		var alerts []notify.Notification
+		for _, n := range notifier.sent {
+			if n.Labels["budget"] == "cloud" {
+				alerts = append(alerts, n)
+			}
+		}
+		return alerts
+	}
+
+	// 0.36/h for the rest of March is about 190
+	if err := hub.Aggregator.SaveBudget(ctx, &internal.Budget{ID: "cloud", MonthlyLimit: 100}); err != nil {
+		t.Fatal(err)
+	}
+	hub.PushCost(costPayload(64, now))
+	hub.PushCost(costPayload(64, now.Add(time.Minute)))
+	if alerts := budgetAlerts(); len(alerts) != 1 || alerts[0].Severity != notify.SeverityWarning {
+		t.Fatalf("expected one warning for the projected breach, got %+v", alerts)
+	}
+	f, err := hub.Aggregator.BudgetForecast(ctx, "cloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Breached || f.BreachAt == nil || f.ProjectedFraction < 1 {
+		t.Errorf("expected a projected breach, got %+v", f)
+	}
+
+	if err := hub.Aggregator.SaveBudget(ctx, &internal.Budget{ID: "cloud", MonthlyLimit: 0.1}); err != nil {
+		t.Fatal(err)
+	}
+	hub.FastForward(time.Hour)
+	hub.PushCost(costPayload(64, now.Add(time.Hour)))
+	if alerts := budgetAlerts(); len(alerts) != 2 || alerts[1].Severity != notify.SeverityCritical {
+		t.Errorf("expected a critical alert once the limit is passed, got %+v", alerts)
+	}
+}
+
+func TestPartialPurgeIsStillAudited(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	hub.PushCost(costPayload(500, hub.Clock.Now()))
+	hub.AssertJobCount(1)
+	// a routed list that can't be read stops the purge after the history
+	hub.Redis.Set(internal.AgentQueueKey+":broken", "corrupt")
+
+	if _, err := hub.Aggregator.Purge(ctx, internal.PurgeFilter{Namespace: "default"}, false); err == nil {
+		t.Fatal("expected the purge to fail")
+	}
+	events, err := hub.Aggregator.ReadEvents(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := events[len(events)-1]
+	var res internal.PurgeResult
+	if last.Type != internal.EventDataPurged || json.Unmarshal(last.Data, &res) != nil || res.History != 1 || res.Error == "" {
+		t.Errorf("expected the removed history and the failure recorded, got %+v", last)
+	}
+
+	// nothing can be written to the decision log, so the purge can't be recorded
+	hub.Redis.Del(internal.AgentQueueKey + ":broken")
+	hub.Redis.Del(internal.EventLogKey)
+	hub.Redis.Set(internal.EventLogKey, "corrupt")
+	if _, err := hub.Aggregator.Purge(ctx, internal.PurgeFilter{Namespace: "default"}, false); err == nil || !strings.Contains(err.Error(), "failed to record purge") {
+		t.Errorf("expected the purge to fail without its audit record, got %v", err)
+	}
+}
+
+func TestPurgeBeforeMatchesJobsByPublishTime(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	published := hub.Clock.Now()
+	hub.PushCost(costPayload(500, published))
+	hub.AssertJobCount(1)
+	// a bare job queued by a hub from before envelopes has no time
+	hub.Redis.RPush(internal.AgentQueueKey, `{"name": "legacy", "namespace": "default", "target_type": "deployment"}`)
+
+	res, err := hub.Aggregator.Purge(ctx, internal.PurgeFilter{Before: published}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Jobs != 0 {
+		t.Errorf("expected no job published before %v, got %+v", published, res)
+	}
+	res, err = hub.Aggregator.Purge(ctx, internal.PurgeFilter{Before: published.Add(time.Second)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Jobs != 1 || res.QualityReports != 1 {
+		t.Errorf("expected the published job and the payload's quality report removed, got %+v", res)
+	}
+	if left, _ := hub.Redis.List(internal.AgentQueueKey); len(left) != 1 || !strings.Contains(left[0], "legacy") {
+		t.Errorf("expected only the legacy job left, got %v", left)
+	}
+	if hub.Redis.Exists(internal.QualityReportsKey) {
+		t.Error("expected the quality report gone")
+	}
+}
+
+func TestShadowPolicyCountsDivergence(t *testing.T) {
+	hub := New(t)
+	ctx := context.Background()
+	// the candidate only calls it waste when 95% of the memory request is unused
+	candidate := internal.DefaultPolicy()
+	candidate.MemoryWaste = 0.95
+	if err := hub.Aggregator.SaveCandidatePolicy(ctx, &candidate); err != nil {
+		t.Fatal(err)
+	}
+
+	now := hub.Clock.Now()
+	hub.PushCost(costPayload(64, now))
+	hub.PushCost(costPayload(300, now.Add(time.Second)))
+
+	report, err := hub.Aggregator.ShadowReport(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Evaluations != 2 || report.Agreements != 1 {
+		t.Errorf("expected 2 evaluations agreeing once, got %d and %d", report.Evaluations, report.Agreements)
+	}
+	if report.ActiveTriggers["High Memory Waste"] != 1 || len(report.CandidateTriggers) != 0 {
+		t.Errorf("expected only the active policy to trigger, got %v and %v", report.ActiveTriggers, report.CandidateTriggers)
+	}
+	if len(report.RecentDifferences) != 1 || report.RecentDifferences[0].Deployment != "cartservice" || report.RecentDifferences[0].Baseline != "High Memory Waste" || report.RecentDifferences[0].Candidate != "" {
+		t.Errorf("expected the waste trigger recorded as a difference, got %+v", report.RecentDifferences)
+	}
+	// the candidate never publishes, the active policy's job is the only one
+	hub.AssertJobCount(1)
+}
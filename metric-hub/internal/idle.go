@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Key - cluster:idle, idle cost samples scored by payload time in ms
+const IdleCostKey = "cluster:idle"
+
+// samples are kept long enough for the weekly trend
+const idleCostRetention = 8 * 24 * time.Hour
+
+// Node capacity no deployment requested, and what it costs
+// nodes are paid for whether or not anything is scheduled on them
+type IdleCost struct {
+	Unallocated Resources `json:"unallocated"`
+	HourlyCost  float64   `json:"hourly_cost"`
+	// share of node group cost that is idle
+	Fraction float64 `json:"fraction"`
+	// hourly cost now minus 24 hours and 7 days ago, left out until samples that old exist
+	Change24h *float64 `json:"change_24h,omitempty"`
+	Change7d  *float64 `json:"change_7d,omitempty"`
+}
+
+// hourly cost at a payload time
+type costSample struct {
+	Time       time.Time `json:"time"`
+	HourlyCost float64   `json:"hourly_cost"`
+}
+
+// Idle cost of the payload's node groups, nil when none are reported
+// cpu and memory are weighted equally, as for wasted cost
+func BuildIdleCost(p *CostPayload) *IdleCost {
+	if len(p.NodeGroups) == 0 {
+		return nil
+	}
+	var fallback float64
+	if p.ClusterInfo.VmCount > 0 {
+		fallback = p.ClusterInfo.Cost / p.ClusterInfo.VmCount
+	}
+
+	idle := &IdleCost{}
+	var total float64
+	for _, g := range p.NodeGroups {
+		capacity := Resources{
+			CPUCores: g.NodeCapacity.CPUCores * float64(g.NodeCount),
+			MemoryMB: g.NodeCapacity.MemoryMB * float64(g.NodeCount),
+		}
+		unallocated := Resources{
+			CPUCores: max(capacity.CPUCores-g.Requested.CPUCores, 0),
+			MemoryMB: max(capacity.MemoryMB-g.Requested.MemoryMB, 0),
+		}
+		idle.Unallocated.CPUCores += unallocated.CPUCores
+		idle.Unallocated.MemoryMB += unallocated.MemoryMB
+
+		costPerNode := fallback
+		if g.HourlyCostPerNode > 0 {
+			costPerNode = g.HourlyCostPerNode
+		}
+		cost := costPerNode * float64(g.NodeCount)
+		total += cost
+		idle.HourlyCost += cost * (ratio(unallocated.CPUCores, capacity.CPUCores) + ratio(unallocated.MemoryMB, capacity.MemoryMB)) / 2
+	}
+	idle.Fraction = ratio(idle.HourlyCost, total)
+	return idle
+}
+
+// best effort like history, a failed write never rejects the payload
+func (a *Aggregator) recordIdleCost(ctx context.Context, p *CostPayload) {
+	idle := BuildIdleCost(p)
+	if idle == nil {
+		return
+	}
+	jsonData, err := json.Marshal(costSample{Time: p.Timestamp, HourlyCost: idle.HourlyCost})
+	if err != nil {
+		return
+	}
+	score := float64(p.Timestamp.UnixMilli())
+	cutoff := strconv.FormatInt(p.Timestamp.Add(-idleCostRetention).UnixMilli(), 10)
+
+	pipe := a.Client.TxPipeline()
+	// one sample per payload time, a replayed payload replaces its own sample
+	pipe.ZRemRangeByScore(ctx, IdleCostKey, strconv.FormatFloat(score, 'f', -1, 64), strconv.FormatFloat(score, 'f', -1, 64))
+	pipe.ZAdd(ctx, IdleCostKey, redis.Z{Score: score, Member: jsonData})
+	pipe.ZRemRangeByScore(ctx, IdleCostKey, "-inf", "("+cutoff)
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Failed to record idle cost %v\n", err)
+	}
+}
+
+// idle hourly cost of the newest sample at or before t, nil when there is none
+func (a *Aggregator) idleCostAt(ctx context.Context, t time.Time) (*float64, error) {
+	raw, err := a.reader().ZRevRangeByScore(ctx, IdleCostKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(t.UnixMilli(), 10),
+		Count: 1,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idle cost %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var s costSample
+	if err := json.Unmarshal([]byte(raw[0]), &s); err != nil {
+		return nil, fmt.Errorf("invalid idle cost sample %w", err)
+	}
+	return &s.HourlyCost, nil
+}
+
+// fill in the trend of idle, measured back from the payload time
+func (a *Aggregator) idleTrend(ctx context.Context, idle *IdleCost, at time.Time) error {
+	for _, w := range []struct {
+		ago    time.Duration
+		change **float64
+	}{{24 * time.Hour, &idle.Change24h}, {7 * 24 * time.Hour, &idle.Change7d}} {
+		then, err := a.idleCostAt(ctx, at.Add(-w.ago))
+		if err != nil {
+			return err
+		}
+		if then != nil {
+			change := idle.HourlyCost - *then
+			*w.change = &change
+		}
+	}
+	return nil
+}
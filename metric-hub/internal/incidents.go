@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+)
+
+// Sources that open incidents, each resolves only its own
+const (
+	IncidentSourceCost     = "cost"
+	IncidentSourceForecast = "forecast"
+)
+
+// Key - incidents:open:<namespace>/<name>
+// Field - <source>:<reason>, Value - unix time opened
+func incidentsKey(ns string, name string) string {
+	return "incidents:open:" + deploymentLockKey(ns, name)
+}
+
+// capacity risks on current usage, every resource is checked so one can't mask another
+func costCriticalReasons(d CostDeployment, policy Policy, flags Flags) []string {
+	var reasons []string
+	peak := d.RiskUsage()
+	if d.CurrentRequests.MemoryMB > 0 && peak.MemoryMB/d.CurrentRequests.MemoryMB > policy.MemoryRisk && flags.Enabled(FamilyMemoryRisk) {
+		reasons = append(reasons, "High Memory Risk")
+	}
+	if d.CurrentRequests.CPUCores > 0 && peak.CPUCores/d.CurrentRequests.CPUCores > policy.CPURisk && flags.Enabled(FamilyCPURisk) {
+		reasons = append(reasons, "High CPU Risk")
+	}
+	return reasons
+}
+
+func forecastCriticalReasons(conditions []Condition) []string {
+	var reasons []string
+	for _, c := range conditions {
+		if c.Family == FamilyForecastRisk {
+			reasons = append(reasons, c.Reason)
+		}
+	}
+	return reasons
+}
+
+// Open incidents for critical reasons not yet open and resolve the source's others
+// incidents are independent of cooldowns, they track the condition itself
+func (a *Aggregator) syncIncidents(ctx context.Context, source string, ns string, d CostDeployment, critical []string) {
+	if a.Notifier == nil {
+		return
+	}
+	name := d.Name
+	key := incidentsKey(ns, name)
+	open, err := a.Client.HGetAll(ctx, key).Result()
+	if err != nil {
+		fmt.Printf("Failed to load incidents for %s %v\n", name, err)
+		return
+	}
+
+	wanted := map[string]string{}
+	for _, reason := range critical {
+		wanted[source+":"+reason] = reason
+	}
+
+	for field, reason := range wanted {
+		if _, ok := open[field]; ok {
+			continue
+		}
+		if err := a.Client.HSet(ctx, key, field, a.now().Unix()).Err(); err != nil {
+			fmt.Printf("Failed to open incident %v\n", err)
+			continue
+		}
+		a.notifyIncident(ctx, ns, d, field, reason, false)
+	}
+	for field := range open {
+		if _, ok := wanted[field]; ok || !strings.HasPrefix(field, source+":") {
+			continue
+		}
+		if err := a.Client.HDel(ctx, key, field).Err(); err != nil {
+			fmt.Printf("Failed to resolve incident %v\n", err)
+			continue
+		}
+		a.notifyIncident(ctx, ns, d, field, strings.TrimPrefix(field, source+":"), true)
+	}
+}
+
+func (a *Aggregator) notifyIncident(ctx context.Context, ns string, d CostDeployment, field string, reason string, resolve bool) {
+	name := d.Name
+	labels := map[string]string{"namespace": ns, "deployment": name, "reason": reason}
+	n := notify.Notification{
+		Severity:  notify.SeverityCritical,
+		Title:     fmt.Sprintf("%s on %s/%s", reason, ns, name),
+		Message:   fmt.Sprintf("%s/%s: %s", ns, name, reason),
+		Labels:    a.ownerOf(ctx, ns, name, d.Labels).labels(labels),
+		Timestamp: a.now().UTC(),
+		DedupKey:  ns + "/" + name + ":" + field,
+		Resolve:   resolve,
+	}
+	if resolve {
+		n.Severity = notify.SeverityInfo
+		n.Title = "Resolved: " + n.Title
+		n.Message = fmt.Sprintf("%s/%s: %s has cleared", ns, name, reason)
+	}
+	if err := a.Notifier.Notify(ctx, n); err != nil {
+		fmt.Printf("Failed to send incident notification %v\n", err)
+	}
+}
@@ -0,0 +1,21 @@
+package internal
+
+import "testing"
+
+func TestCostCriticalReasonsReportsEveryRisk(t *testing.T) {
+	d := CostDeployment{
+		Name:            "cartservice",
+		CurrentRequests: Resources{CPUCores: 1, MemoryMB: 100},
+		CurrentUsage:    Resources{CPUCores: 0.95, MemoryMB: 90},
+	}
+
+	reasons := costCriticalReasons(d, DefaultPolicy(), Flags{})
+	if len(reasons) != 2 || reasons[0] != "High Memory Risk" || reasons[1] != "High CPU Risk" {
+		t.Errorf("expected memory and cpu risk, got %v", reasons)
+	}
+
+	reasons = costCriticalReasons(d, DefaultPolicy(), Flags{FamilyMemoryRisk: false})
+	if len(reasons) != 1 || reasons[0] != "High CPU Risk" {
+		t.Errorf("expected the disabled family skipped, got %v", reasons)
+	}
+}
@@ -0,0 +1,320 @@
+// Package ingest runs input adapters, metric sources that produce cost payloads without an HTTP push
+// an adapter either polls on its own interval or holds a subscription open, every payload goes to one sink
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// Key - ingest:status
+// Field - <adapter name>
+const StatusKey = "ingest:status"
+
+// Adapter kinds
+const (
+	KindPoll      = "poll"
+	KindSubscribe = "subscribe"
+)
+
+// Adapter states
+const (
+	StatePending = "pending"
+	StateHealthy = "healthy"
+	StateFailing = "failing"
+)
+
+// longest wait before a failed subscription is opened again
+const maxSubscribeBackoff = time.Minute
+
+var (
+	ErrUnknownAdapter   = errors.New("unknown adapter")
+	ErrDuplicateAdapter = errors.New("adapter already registered")
+)
+
+// Every adapter is named, the name is the payloads' source and labels its metrics
+type Adapter interface {
+	Name() string
+}
+
+// Asked for the latest payload every interval, by one replica at a time
+// a nil payload without an error means there is nothing to report yet and isn't recorded
+type Poller interface {
+	Adapter
+	Poll(ctx context.Context) (*internal.CostPayload, error)
+}
+
+// Delivers payloads as the source produces them until ctx is cancelled or the subscription fails
+// subscriptions are held on every replica, deliveries of the same payload are deduplicated by the sink
+type Subscriber interface {
+	Adapter
+	Subscribe(ctx context.Context, deliver func(context.Context, *internal.CostPayload) error) error
+}
+
+// Where every adapter's payloads go, validation and saving are up to it
+// a payload the sink rejects counts as a failure of the adapter that produced it
+type Sink func(ctx context.Context, p *internal.CostPayload) error
+
+// Health of an adapter as the replicas running it last recorded it
+type Status struct {
+	Adapter string `json:"adapter"`
+	Kind    string `json:"kind"`
+	// polls only
+	Interval            string    `json:"interval,omitempty"`
+	State               string    `json:"state"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastErrorAt         time.Time `json:"last_error_at,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Payloads            int64     `json:"payloads"`
+}
+
+type registration struct {
+	adapter  Adapter
+	kind     string
+	interval time.Duration
+}
+
+type Registry struct {
+	Client *redis.Client
+	Sink   Sink
+	// value of the poll claims, any unique name per replica
+	ReplicaID string
+	// time source, the system clock when nil
+	Clock clock.Clock
+
+	mu       sync.Mutex
+	adapters map[string]registration
+}
+
+func NewRegistry(client *redis.Client, sink Sink, replicaID string) *Registry {
+	return &Registry{Client: client, Sink: sink, ReplicaID: replicaID, adapters: map[string]registration{}}
+}
+
+// Register an adapter, a Poller is polled every interval and a Subscriber ignores it
+func (r *Registry) Register(a Adapter, interval time.Duration) error {
+	reg := registration{adapter: a, interval: interval}
+	switch a.(type) {
+	case Poller:
+		if interval <= 0 {
+			return fmt.Errorf("adapter %s: poll interval must be positive", a.Name())
+		}
+		reg.kind = KindPoll
+	case Subscriber:
+		reg.kind = KindSubscribe
+	default:
+		return fmt.Errorf("adapter %s implements neither Poll nor Subscribe", a.Name())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.adapters[a.Name()]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateAdapter, a.Name())
+	}
+	r.adapters[a.Name()] = reg
+	return nil
+}
+
+// Registered adapter names, sorted
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.adapters))
+	for name := range r.adapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run every registered adapter until ctx is cancelled
+func (r *Registry) Run(ctx context.Context) {
+	r.mu.Lock()
+	regs := make([]registration, 0, len(r.adapters))
+	for _, reg := range r.adapters {
+		regs = append(regs, reg)
+	}
+	r.mu.Unlock()
+
+	for _, reg := range regs {
+		switch a := reg.adapter.(type) {
+		case Poller:
+			go r.runPoller(ctx, a, reg.interval)
+		case Subscriber:
+			go r.runSubscriber(ctx, a)
+		}
+	}
+}
+
+// one replica claims each poll, so replicas don't query the source and evaluate the same numbers twice
+// Key - pull:<name>, held by the replica polling the current interval
+func (r *Registry) runPoller(ctx context.Context, p Poller, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		claimed, err := r.Client.SetNX(ctx, "pull:"+p.Name(), r.ReplicaID, interval/2).Result()
+		if err != nil {
+			fmt.Printf("[Ingest] %s failed to claim poll %v\n", p.Name(), err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := r.Poll(ctx, p.Name()); err != nil {
+			fmt.Printf("[Ingest] %s %v\n", p.Name(), err)
+		}
+	}
+}
+
+// Poll the adapter now and hand the payload to the sink, outside its schedule and claim
+func (r *Registry) Poll(ctx context.Context, name string) error {
+	r.mu.Lock()
+	reg, ok := r.adapters[name]
+	r.mu.Unlock()
+	p, isPoller := reg.adapter.(Poller)
+	if !ok || !isPoller {
+		return fmt.Errorf("%w: %s", ErrUnknownAdapter, name)
+	}
+
+	start := time.Now()
+	payload, err := p.Poll(ctx)
+	if err == nil && payload == nil {
+		return nil
+	}
+	if err == nil {
+		if payload.Source == "" {
+			payload.Source = name
+		}
+		err = r.Sink(ctx, payload)
+	}
+	metrics.IngestDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	r.record(ctx, reg, err)
+	return err
+}
+
+// reopened after a failure, waiting twice as long each time up to a minute
+func (r *Registry) runSubscriber(ctx context.Context, s Subscriber) {
+	r.mu.Lock()
+	reg := r.adapters[s.Name()]
+	r.mu.Unlock()
+
+	deliver := func(ctx context.Context, p *internal.CostPayload) error {
+		if p.Source == "" {
+			p.Source = s.Name()
+		}
+		err := r.Sink(ctx, p)
+		r.record(ctx, reg, err)
+		return err
+	}
+
+	backoff := time.Second
+	for {
+		opened := time.Now()
+		err := s.Subscribe(ctx, deliver)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("subscription closed")
+		}
+		r.record(ctx, reg, err)
+		fmt.Printf("[Ingest] %s %v, reopening in %s\n", s.Name(), err, backoff)
+
+		// a subscription that held for a while starts over from the shortest wait
+		if time.Since(opened) > maxSubscribeBackoff {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxSubscribeBackoff)
+	}
+}
+
+// update the adapter's status and metrics after a payload or failure
+func (r *Registry) record(ctx context.Context, reg registration, err error) {
+	name := reg.adapter.Name()
+	now := clock.Now(r.Clock)
+	status, getErr := r.status(ctx, reg)
+	if getErr != nil {
+		fmt.Printf("[Ingest] %s failed to read status %v\n", name, getErr)
+	}
+
+	if err != nil {
+		metrics.IngestFailures.WithLabelValues(name).Inc()
+		status.State = StateFailing
+		status.LastError = err.Error()
+		status.LastErrorAt = now
+		status.ConsecutiveFailures++
+	} else {
+		metrics.IngestPayloads.WithLabelValues(name).Inc()
+		metrics.IngestLastSuccess.WithLabelValues(name).Set(float64(now.Unix()))
+		status.State = StateHealthy
+		status.LastSuccess = now
+		status.ConsecutiveFailures = 0
+		status.Payloads++
+	}
+	metrics.IngestConsecutiveFailures.WithLabelValues(name).Set(float64(status.ConsecutiveFailures))
+
+	jsonData, marshalErr := json.Marshal(status)
+	if marshalErr != nil {
+		return
+	}
+	if err := r.Client.HSet(ctx, StatusKey, name, jsonData).Err(); err != nil {
+		fmt.Printf("[Ingest] %s failed to save status %v\n", name, err)
+	}
+}
+
+// stored status, a pending one for an adapter that hasn't run yet
+func (r *Registry) status(ctx context.Context, reg registration) (Status, error) {
+	status := Status{Adapter: reg.adapter.Name(), Kind: reg.kind, State: StatePending}
+	if reg.kind == KindPoll {
+		status.Interval = reg.interval.String()
+	}
+	raw, err := r.Client.HGet(ctx, StatusKey, status.Adapter).Result()
+	if errors.Is(err, redis.Nil) {
+		return status, nil
+	} else if err != nil {
+		return status, err
+	}
+	var stored Status
+	if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+		return status, err
+	}
+	stored.Kind, stored.Interval = status.Kind, status.Interval
+	return stored, nil
+}
+
+// Status of every registered adapter, sorted by name
+func (r *Registry) Statuses(ctx context.Context) ([]Status, error) {
+	statuses := []Status{}
+	for _, name := range r.Names() {
+		r.mu.Lock()
+		reg := r.adapters[name]
+		r.mu.Unlock()
+		status, err := r.status(ctx, reg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get adapter status %w", err)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+	"github.com/redis/go-redis/v9"
+)
+
+type fakePoller struct {
+	err error
+}
+
+func (f *fakePoller) Name() string {
+	return "fake"
+}
+
+func (f *fakePoller) Poll(ctx context.Context) (*internal.CostPayload, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &internal.CostPayload{Namespace: "default"}, nil
+}
+
+type fakeSubscriber struct{}
+
+func (fakeSubscriber) Name() string {
+	return "stream"
+}
+
+func (fakeSubscriber) Subscribe(ctx context.Context, deliver func(context.Context, *internal.CostPayload) error) error {
+	if err := deliver(ctx, &internal.CostPayload{Namespace: "default"}); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func newRegistry(t *testing.T, sink Sink) *Registry {
+	mr := miniredis.RunT(t)
+	return NewRegistry(redis.NewClient(&redis.Options{Addr: mr.Addr()}), sink, "replica-1")
+}
+
+func TestPollRecordsHealth(t *testing.T) {
+	ctx := context.Background()
+	var saved []*internal.CostPayload
+	r := newRegistry(t, func(ctx context.Context, p *internal.CostPayload) error {
+		saved = append(saved, p)
+		return nil
+	})
+	poller := &fakePoller{}
+	if err := r.Register(poller, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(poller, time.Minute); !errors.Is(err, ErrDuplicateAdapter) {
+		t.Errorf("expected ErrDuplicateAdapter, got %v", err)
+	}
+
+	statuses, _ := r.Statuses(ctx)
+	if len(statuses) != 1 || statuses[0].State != StatePending || statuses[0].Interval != "1m0s" {
+		t.Fatalf("expected one pending poll adapter, got %+v", statuses)
+	}
+
+	if err := r.Poll(ctx, "fake"); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Source != "fake" {
+		t.Fatalf("expected one payload with source fake, got %+v", saved)
+	}
+
+	poller.err = errors.New("source unreachable")
+	r.Poll(ctx, "fake")
+	r.Poll(ctx, "fake")
+	statuses, _ = r.Statuses(ctx)
+	s := statuses[0]
+	if s.State != StateFailing || s.ConsecutiveFailures != 2 || s.Payloads != 1 || s.LastError != "source unreachable" || s.LastSuccess.IsZero() {
+		t.Errorf("expected 2 failures after 1 payload, got %+v", s)
+	}
+
+	if err := r.Poll(ctx, "missing"); !errors.Is(err, ErrUnknownAdapter) {
+		t.Errorf("expected ErrUnknownAdapter, got %v", err)
+	}
+}
+
+func TestSubscriberDeliversToSink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	delivered := make(chan *internal.CostPayload, 1)
+	r := newRegistry(t, func(ctx context.Context, p *internal.CostPayload) error {
+		delivered <- p
+		return nil
+	})
+	if err := r.Register(fakeSubscriber{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	r.Run(ctx)
+
+	select {
+	case p := <-delivered:
+		if p.Source != "stream" {
+			t.Errorf("expected source stream, got %q", p.Source)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a delivery")
+	}
+	// the status is written after the sink returns
+	var statuses []Status
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		statuses, _ = r.Statuses(context.Background())
+		if statuses[0].State == StateHealthy {
+			break
+		}
+	}
+	if statuses[0].Kind != KindSubscribe || statuses[0].State != StateHealthy {
+		t.Errorf("expected a healthy subscription, got %+v", statuses[0])
+	}
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Key - forecast:latest, the last forecast payload when evaluating on an interval
+	LatestForecastKey = "forecast:latest"
+	// Key - evaluation:tick, held by the replica evaluating the current interval
+	EvaluationTickKey = "evaluation:tick"
+	// Key - evaluation:done
+	// Field - cost | forecast
+	// Value - timestamp of the payload last evaluated
+	EvaluatedKey = "evaluation:done"
+)
+
+// Marshal the forecast and save it for the next evaluation
+// a forecast arriving before its cost payload waits for it instead of becoming an orphan
+func (a *Aggregator) saveForecast(ctx context.Context, p *ForecastPayload) error {
+	jsonData, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal payload: %w", err)
+	}
+	if err := a.Client.Set(ctx, LatestForecastKey, jsonData, 0).Err(); err != nil {
+		return fmt.Errorf("[Failed] SET redis: %w", err)
+	}
+	a.recordEvent(ctx, EventForecastPayload, p)
+	return nil
+}
+
+// RunEvaluations evaluates the latest payloads every EvaluationInterval until ctx is cancelled
+// one replica claims each tick, so a burst of pushes or replicas still means one evaluation
+func (a *Aggregator) RunEvaluations(ctx context.Context) {
+	ticker := time.NewTicker(a.EvaluationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		claimed, err := a.Client.SetNX(ctx, EvaluationTickKey, a.replicaID(), a.EvaluationInterval/2).Result()
+		if err != nil {
+			fmt.Printf("[Evaluation] failed to claim tick %v\n", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := a.EvaluateLatest(ctx); err != nil {
+			fmt.Printf("[Evaluation] %v\n", err)
+		}
+	}
+}
+
+// Evaluate cost:latest and forecast:latest if either changed since the last evaluation
+// the forecast is merged with the cost payload current at evaluation time, so arrival order doesn't matter
+func (a *Aggregator) EvaluateLatest(ctx context.Context) error {
+	cost, err := a.readCost(ctx, a.Client)
+	if errors.Is(err, ErrNoCostData) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	forecast, err := a.readForecast(ctx)
+	if err != nil {
+		return err
+	}
+	done, err := a.Client.HGetAll(ctx, EvaluatedKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get evaluation state %w", err)
+	}
+
+	ctx, cancel := a.evaluationContext(ctx)
+	defer cancel()
+
+	costStamp := cost.Timestamp.Format(time.RFC3339Nano)
+	if done["cost"] != costStamp {
+		a.evaluateCost(ctx, cost)
+	}
+	var forecastStamp string
+	if forecast != nil {
+		forecastStamp = forecast.Timestamp.Format(time.RFC3339Nano)
+		if done["forecast"] != forecastStamp {
+			a.CheckForecastThreshold(ctx, forecast, cost)
+		}
+	}
+
+	if err := a.Client.HSet(ctx, EvaluatedKey, "cost", costStamp, "forecast", forecastStamp).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+// nil when no forecast has been stored
+func (a *Aggregator) readForecast(ctx context.Context) (*ForecastPayload, error) {
+	raw, err := a.Client.Get(ctx, LatestForecastKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get redis forecast data %w", err)
+	}
+	var p ForecastPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal forecast data %w", err)
+	}
+	return &p, nil
+}
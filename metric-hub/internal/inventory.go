@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/history"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/kube"
+)
+
+const (
+	// Key - inventory:namespaces, namespaces found by discovery
+	InventoryNamespacesKey = "inventory:namespaces"
+	// Key - inventory:deployments
+	// Field - <namespace>/<name>
+	// Value - <discovered deployment>
+	InventoryDeploymentsKey = "inventory:deployments"
+)
+
+// A deployment registered by discovery, evaluated under the active policy once a producer reports it
+type DiscoveredDeployment struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Replicas  int32  `json:"replicas"`
+	// requests of one replica from the pod template
+	Requests     Resources `json:"requests"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+	// a producer has reported it within the history retention
+	Reported bool `json:"reported"`
+}
+
+// Discovered namespaces and deployments, including those no producer has reported on
+type InventoryReport struct {
+	Namespaces  []string               `json:"namespaces"`
+	Deployments []DiscoveredDeployment `json:"deployments"`
+	Unreported  int                    `json:"unreported"`
+}
+
+// Replace the inventory with what discovery found
+// deployments already registered keep their discovery time, deleted ones are dropped
+func (a *Aggregator) SyncInventory(ctx context.Context, inv *kube.Inventory) error {
+	existing, err := a.Client.HGetAll(ctx, InventoryDeploymentsKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read inventory %w", err)
+	}
+	now := a.now()
+
+	fields := make([]interface{}, 0, 2*len(inv.Workloads))
+	for _, w := range inv.Workloads {
+		key := deploymentLockKey(w.Namespace, w.Name)
+		d := DiscoveredDeployment{
+			Namespace:    w.Namespace,
+			Name:         w.Name,
+			Replicas:     w.Replicas,
+			Requests:     Resources{CPUCores: w.CPUCores, MemoryMB: w.MemoryMB},
+			DiscoveredAt: now,
+		}
+		var prev DiscoveredDeployment
+		if raw, ok := existing[key]; ok && json.Unmarshal([]byte(raw), &prev) == nil {
+			d.DiscoveredAt = prev.DiscoveredAt
+		}
+		jsonData, err := json.Marshal(d)
+		if err != nil {
+			return fmt.Errorf("[Failed] to marshal deployment: %w", err)
+		}
+		fields = append(fields, key, jsonData)
+	}
+	namespaces := make([]interface{}, len(inv.Namespaces))
+	for i, ns := range inv.Namespaces {
+		namespaces[i] = ns
+	}
+
+	pipe := a.Client.TxPipeline()
+	pipe.Del(ctx, InventoryDeploymentsKey, InventoryNamespacesKey)
+	if len(fields) > 0 {
+		pipe.HSet(ctx, InventoryDeploymentsKey, fields...)
+	}
+	if len(namespaces) > 0 {
+		pipe.SAdd(ctx, InventoryNamespacesKey, namespaces...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+// Discovered deployments sorted by namespace and name, marked with whether a producer reported them
+func (a *Aggregator) Inventory(ctx context.Context) (*InventoryReport, error) {
+	namespaces, err := a.Client.SMembers(ctx, InventoryNamespacesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory %w", err)
+	}
+	raw, err := a.Client.HGetAll(ctx, InventoryDeploymentsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory %w", err)
+	}
+	reported := map[string]bool{}
+	if a.History != nil {
+		tracked, err := a.History.Deployments(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range tracked {
+			reported[d] = true
+		}
+	}
+
+	report := &InventoryReport{Namespaces: namespaces, Deployments: make([]DiscoveredDeployment, 0, len(raw))}
+	for _, value := range raw {
+		var d DiscoveredDeployment
+		if err := json.Unmarshal([]byte(value), &d); err != nil {
+			continue
+		}
+		d.Reported = reported[history.Deployment(d.Namespace, d.Name)]
+		if !d.Reported {
+			report.Unreported++
+		}
+		report.Deployments = append(report.Deployments, d)
+	}
+	sort.Strings(report.Namespaces)
+	sort.Slice(report.Deployments, func(i, j int) bool {
+		if report.Deployments[i].Namespace != report.Deployments[j].Namespace {
+			return report.Deployments[i].Namespace < report.Deployments[j].Namespace
+		}
+		return report.Deployments[i].Name < report.Deployments[j].Name
+	})
+	return report, nil
+}
+
+// RunDiscovery syncs the inventory at once and then every interval until ctx is cancelled
+func (a *Aggregator) RunDiscovery(ctx context.Context, d *kube.Discoverer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		inv, err := d.Discover(ctx)
+		if err == nil {
+			err = a.SyncInventory(ctx, inv)
+		}
+		if err != nil {
+			fmt.Printf("[Discovery] %v\n", err)
+		} else {
+			fmt.Printf("[Discovery] found %d deployments in %d namespaces\n", len(inv.Workloads), len(inv.Namespaces))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
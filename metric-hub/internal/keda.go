@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// KEDA ScaledObject managing a deployment's replicas
+type KedaScaling struct {
+	ScaledObject    string        `json:"scaled_object" validate:"required"`
+	Triggers        []KedaTrigger `json:"triggers,omitempty" validate:"omitempty,dive"`
+	MinReplicaCount int           `json:"min_replica_count" validate:"gte=0"`
+	MaxReplicaCount int           `json:"max_replica_count" validate:"gte=1,gtefield=MinReplicaCount"`
+	// replicas running when the payload was taken
+	Replicas int `json:"replicas" validate:"gte=0"`
+	// requests of one replica, needed to price savings while scaled to zero
+	ReplicaRequests *Resources `json:"replica_requests,omitempty"`
+}
+
+// One scaler of a ScaledObject, e.g. kafka or prometheus
+type KedaTrigger struct {
+	Type string `json:"type" validate:"required"`
+	Name string `json:"name,omitempty"`
+}
+
+// true when KEDA may scale the deployment to zero replicas, false for a nil k
+func (k *KedaScaling) ScalesToZero() bool {
+	return k != nil && k.MinReplicaCount == 0
+}
+
+// requests of one replica, false when they can't be known
+func (k *KedaScaling) replicaRequests(c CostDeployment) (Resources, bool) {
+	if k.ReplicaRequests != nil {
+		return *k.ReplicaRequests, true
+	}
+	if k.Replicas == 0 {
+		return Resources{}, false
+	}
+	return Resources{
+		CPUCores: c.CurrentRequests.CPUCores / float64(k.Replicas),
+		MemoryMB: c.CurrentRequests.MemoryMB / float64(k.Replicas),
+	}, true
+}
+
+type EventDrivenEntry struct {
+	Name         string   `json:"name"`
+	ScaledObject string   `json:"scaled_object"`
+	Triggers     []string `json:"triggers"`
+	Replicas     int      `json:"replicas"`
+	MinReplicas  int      `json:"min_replicas"`
+	MaxReplicas  int      `json:"max_replicas"`
+	HourlyCost   float64  `json:"hourly_cost"`
+	// cost of the replicas KEDA isn't running compared with max_replicas
+	// left at 0 when the replica requests can't be known
+	HourlySavings float64 `json:"hourly_savings"`
+}
+
+// Savings from event-driven scaling, kept apart from savings of applied recommendations
+type EventDrivenReport struct {
+	Timestamp     time.Time          `json:"timestamp"`
+	HourlySavings float64            `json:"hourly_savings"`
+	Deployments   []EventDrivenEntry `json:"deployments"`
+}
+
+// Report on the KEDA-managed deployments of a payload, largest savings first
+func BuildEventDrivenReport(p *CostPayload) *EventDrivenReport {
+	report := &EventDrivenReport{Timestamp: p.Timestamp, Deployments: []EventDrivenEntry{}}
+	for _, d := range p.Deployments {
+		if d.Keda == nil {
+			continue
+		}
+		e := EventDrivenEntry{
+			Name:         d.Name,
+			ScaledObject: d.Keda.ScaledObject,
+			Triggers:     make([]string, 0, len(d.Keda.Triggers)),
+			Replicas:     d.Keda.Replicas,
+			MinReplicas:  d.Keda.MinReplicaCount,
+			MaxReplicas:  d.Keda.MaxReplicaCount,
+			HourlyCost:   DeploymentHourlyCost(p, d),
+		}
+		for _, t := range d.Keda.Triggers {
+			e.Triggers = append(e.Triggers, t.Type)
+		}
+		if r, ok := d.Keda.replicaRequests(d); ok && d.Keda.MaxReplicaCount > d.Keda.Replicas {
+			e.HourlySavings = float64(d.Keda.MaxReplicaCount-d.Keda.Replicas) * requestsHourlyCost(p, r)
+		}
+		report.HourlySavings += e.HourlySavings
+		report.Deployments = append(report.Deployments, e)
+	}
+	sort.SliceStable(report.Deployments, func(i, j int) bool {
+		return report.Deployments[i].HourlySavings > report.Deployments[j].HourlySavings
+	})
+	return report
+}
+
+func (a *Aggregator) EventDrivenSavings(ctx context.Context) (*EventDrivenReport, error) {
+	p, err := a.latestCost(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return BuildEventDrivenReport(p), nil
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScaleToZeroSkipsWasteTriggers(t *testing.T) {
+	d := CostDeployment{
+		Name:            "consumer",
+		CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1024},
+		CurrentUsage:    Resources{CPUCores: 0.05, MemoryMB: 100},
+		Keda:            &KedaScaling{ScaledObject: "consumer", MinReplicaCount: 0, MaxReplicaCount: 10, Replicas: 1},
+	}
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != "" {
+		t.Errorf("expected no waste trigger for a scale-to-zero workload, got %q", reason)
+	}
+
+	d.CurrentUsage.MemoryMB = 1000
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != "High Memory Risk" {
+		t.Errorf("expected risk triggers to still apply, got %q", reason)
+	}
+
+	d.CurrentUsage.MemoryMB = 100
+	d.Keda.MinReplicaCount = 1
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != "High Memory Waste" {
+		t.Errorf("expected waste triggers when KEDA keeps a replica, got %q", reason)
+	}
+}
+
+func TestEventDrivenReportPricesIdleReplicas(t *testing.T) {
+	p := &CostPayload{
+		ClusterInfo: ClusterInfo{VmCount: 2, Cost: 1},
+		Deployments: []CostDeployment{
+			{Name: "web", CurrentRequests: Resources{CPUCores: 2, MemoryMB: 2048}},
+			// two of four replicas running, each a quarter of all requests
+			{Name: "consumer", CurrentRequests: Resources{CPUCores: 2, MemoryMB: 2048},
+				Keda: &KedaScaling{ScaledObject: "consumer", Triggers: []KedaTrigger{{Type: "kafka"}}, MaxReplicaCount: 4, Replicas: 2}},
+			// scaled to zero, priced from its replica requests
+			{Name: "batch", Keda: &KedaScaling{ScaledObject: "batch", MaxReplicaCount: 2, ReplicaRequests: &Resources{CPUCores: 1, MemoryMB: 1024}}},
+			{Name: "unknown", Keda: &KedaScaling{ScaledObject: "unknown", MaxReplicaCount: 3}},
+		},
+	}
+
+	report := BuildEventDrivenReport(p)
+	if len(report.Deployments) != 3 {
+		t.Fatalf("expected the three KEDA deployments, got %+v", report.Deployments)
+	}
+	consumer, batch, unknown := report.Deployments[0], report.Deployments[1], report.Deployments[2]
+	if consumer.Name != "consumer" || consumer.HourlySavings != 0.5 || consumer.Triggers[0] != "kafka" {
+		t.Errorf("unexpected consumer entry %+v", consumer)
+	}
+	if batch.Name != "batch" || batch.HourlySavings != 0.5 || batch.HourlyCost != 0 {
+		t.Errorf("unexpected batch entry %+v", batch)
+	}
+	if unknown.HourlySavings != 0 || report.HourlySavings != 1 {
+		t.Errorf("expected unpriced savings left out, got %+v total %v", unknown, report.HourlySavings)
+	}
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// snapshot times are forgotten once they are this much older than the newest snapshot,
+// so deployments that stopped reporting don't stay in memory
+const SequenceRetention = 24 * time.Hour
+
+// KeyedMutex serialises work per key (deployment or namespace)
+// lock entries are removed once no goroutine holds or waits for them
+type KeyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+	// timestamp of the newest snapshot evaluated per key and stream
+	lastSeen map[string]time.Time
+	// newest snapshot of any key, and the newest when lastSeen was last pruned
+	newest time.Time
+	pruned time.Time
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func NewKeyedMutex() *KeyedMutex {
+	return &KeyedMutex{
+		locks:    make(map[string]*keyLock),
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+// Lock key, returning the unlock function
+func (k *KeyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// Sequence runs fn under the key's lock unless a newer snapshot from the
+// same stream (cost, forecast) was already evaluated
+// returns false when fn was skipped as stale
+func (k *KeyedMutex) Sequence(key string, stream string, snapshot time.Time, fn func()) bool {
+	unlock := k.Lock(key)
+	defer unlock()
+
+	seenKey := stream + "/" + key
+	k.mu.Lock()
+	last := k.lastSeen[seenKey]
+	stale := snapshot.Before(last)
+	if !stale {
+		k.lastSeen[seenKey] = snapshot
+		k.prune(snapshot)
+	}
+	k.mu.Unlock()
+
+	if stale {
+		return false
+	}
+	fn()
+	return true
+}
+
+// drop snapshot times older than the retention, at most once per retention window
+// callers hold k.mu
+func (k *KeyedMutex) prune(snapshot time.Time) {
+	if snapshot.After(k.newest) {
+		k.newest = snapshot
+	}
+	if k.newest.Sub(k.pruned) < SequenceRetention {
+		return
+	}
+	cutoff := k.newest.Add(-SequenceRetention)
+	for key, seen := range k.lastSeen {
+		if seen.Before(cutoff) {
+			delete(k.lastSeen, key)
+		}
+	}
+	k.pruned = k.newest
+}
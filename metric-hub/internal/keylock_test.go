@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutexSerialises(t *testing.T) {
+	k := NewKeyedMutex()
+	var wg sync.WaitGroup
+	active, maxActive := 0, 0
+	var mu sync.Mutex
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := k.Lock("default/cartservice")
+			defer unlock()
+
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxActive != 1 {
+		t.Errorf("got %d concurrent holders, want 1", maxActive)
+	}
+	if len(k.locks) != 0 {
+		t.Errorf("expected lock entries to be released, got %d", len(k.locks))
+	}
+}
+
+func TestKeyedMutexSequenceSkipsStale(t *testing.T) {
+	k := NewKeyedMutex()
+	now := time.Now()
+
+	if !k.Sequence("default/cartservice", "cost", now, func() {}) {
+		t.Fatal("first snapshot should run")
+	}
+	if k.Sequence("default/cartservice", "cost", now.Add(-time.Minute), func() {}) {
+		t.Error("older snapshot should be skipped")
+	}
+	if !k.Sequence("default/cartservice", "forecast", now.Add(-time.Minute), func() {}) {
+		t.Error("streams are sequenced independently")
+	}
+}
+
+func TestKeyedMutexForgetsOldSnapshots(t *testing.T) {
+	k := NewKeyedMutex()
+	now := time.Now()
+
+	k.Sequence("default/retired", "cost", now, func() {})
+	k.Sequence("default/cartservice", "cost", now.Add(time.Hour), func() {})
+	if len(k.lastSeen) != 2 {
+		t.Fatalf("expected both deployments tracked, got %d", len(k.lastSeen))
+	}
+
+	k.Sequence("default/cartservice", "cost", now.Add(SequenceRetention+time.Minute), func() {})
+	if _, ok := k.lastSeen["cost/default/retired"]; ok || len(k.lastSeen) != 1 {
+		t.Errorf("expected the deployment that stopped reporting forgotten, got %v", k.lastSeen)
+	}
+	if k.Sequence("default/cartservice", "cost", now.Add(time.Hour), func() {}) {
+		t.Error("older snapshot should still be skipped for a tracked deployment")
+	}
+}
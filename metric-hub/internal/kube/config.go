@@ -0,0 +1,145 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kinds of object a ConfigWatcher reads
+const (
+	KindConfigMap = "configmap"
+	KindSecret    = "secret"
+)
+
+// wait before re-establishing a dropped watch
+const rewatchDelay = 5 * time.Second
+
+// Watches one key of a ConfigMap or Secret through the API server
+// needs get and watch on the object, so changes apply without waiting for the kubelet to sync a mount
+type ConfigWatcher struct {
+	Client    kubernetes.Interface
+	Kind      string
+	Namespace string
+	Name      string
+	Key       string
+}
+
+func NewConfigWatcher(client kubernetes.Interface, kind string, namespace string, name string, key string) *ConfigWatcher {
+	return &ConfigWatcher{Client: client, Kind: kind, Namespace: namespace, Name: name, Key: key}
+}
+
+// Run calls apply with the current value and on every event for the object, until ctx is cancelled
+// unchanged values are applied again too, apply decides whether they differ from what is in force
+// a missing object or key is logged and skipped, the last applied value stays in force
+func (w *ConfigWatcher) Run(ctx context.Context, apply func(context.Context, []byte) error) {
+	// only a changed value is logged, the watch is re-established every few minutes
+	var logged string
+	handle := func(obj interface{}) {
+		data, ok := w.value(obj)
+		if !ok {
+			fmt.Printf("[Config] %s %s/%s has no key %q\n", w.Kind, w.Namespace, w.Name, w.Key)
+			return
+		}
+		if err := apply(ctx, []byte(data)); err != nil {
+			fmt.Printf("[Config] rejected %s %s/%s: %v\n", w.Kind, w.Namespace, w.Name, err)
+			return
+		}
+		if data != logged {
+			logged = data
+			fmt.Printf("[Config] applied %s %s/%s\n", w.Kind, w.Namespace, w.Name)
+		}
+	}
+
+	for {
+		version, err := w.load(ctx, handle)
+		if err == nil {
+			err = w.watch(ctx, version, handle)
+		}
+		if err != nil {
+			fmt.Printf("[Config] watching %s %s/%s failed %v\n", w.Kind, w.Namespace, w.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rewatchDelay):
+		}
+	}
+}
+
+// apply the current object, returning the resource version to watch from
+func (w *ConfigWatcher) load(ctx context.Context, handle func(interface{})) (string, error) {
+	var obj metav1.Object
+	var err error
+	switch w.Kind {
+	case KindSecret:
+		obj, err = w.Client.CoreV1().Secrets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+	default:
+		obj, err = w.Client.CoreV1().ConfigMaps(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+	}
+	if errors.IsNotFound(err) {
+		// watch for it being created
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	handle(obj)
+	return obj.GetResourceVersion(), nil
+}
+
+// returns when the watch closes, which the API server does every few minutes
+func (w *ConfigWatcher) watch(ctx context.Context, version string, handle func(interface{})) error {
+	opts := metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", w.Name).String(),
+		ResourceVersion: version,
+	}
+	var watcher watch.Interface
+	var err error
+	switch w.Kind {
+	case KindSecret:
+		watcher, err = w.Client.CoreV1().Secrets(w.Namespace).Watch(ctx, opts)
+	default:
+		watcher, err = w.Client.CoreV1().ConfigMaps(w.Namespace).Watch(ctx, opts)
+	}
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil
+			}
+			switch ev.Type {
+			case watch.Added, watch.Modified:
+				handle(ev.Object)
+			case watch.Error:
+				return fmt.Errorf("watch error %v", errors.FromObject(ev.Object))
+			}
+		}
+	}
+}
+
+func (w *ConfigWatcher) value(obj interface{}) (string, bool) {
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		v, ok := o.Data[w.Key]
+		return v, ok
+	case *corev1.Secret:
+		v, ok := o.Data[w.Key]
+		return string(v), ok
+	}
+	return "", false
+}
@@ -0,0 +1,82 @@
+package kube
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigWatcherAppliesChanges(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "metric-hub", Namespace: "ops"},
+		Data:       map[string]string{"policy.yaml": "cpu_waste: 0.4"},
+	}
+	client := fake.NewSimpleClientset(cm)
+	w := NewConfigWatcher(client, KindConfigMap, "ops", "metric-hub", "policy.yaml")
+
+	var mu sync.Mutex
+	var applied []string
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx, func(ctx context.Context, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		applied = append(applied, string(data))
+		return nil
+	})
+
+	waitFor := func(n int) []string {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			got := append([]string(nil), applied...)
+			mu.Unlock()
+			if len(got) >= n {
+				return got
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("expected %d applied values, got %v", n, applied)
+		return nil
+	}
+	waitFor(1)
+
+	updated := cm.DeepCopy()
+	updated.Data["policy.yaml"] = "cpu_waste: 0.3"
+	// the fake watch only sees events after it is established
+	time.Sleep(50 * time.Millisecond)
+	if _, err := client.CoreV1().ConfigMaps("ops").Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := waitFor(2)
+	if got[0] != "cpu_waste: 0.4" || got[1] != "cpu_waste: 0.3" {
+		t.Errorf("expected the initial then the updated value, got %v", got)
+	}
+
+	// the policy may have been changed through the API since, so an unchanged value is applied again
+	relabelled := updated.DeepCopy()
+	relabelled.Labels = map[string]string{"team": "platform"}
+	if _, err := client.CoreV1().ConfigMaps("ops").Update(ctx, relabelled, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := waitFor(3); got[2] != "cpu_waste: 0.3" {
+		t.Errorf("expected the unchanged value applied again, got %v", got)
+	}
+}
+
+func TestConfigWatcherReadsSecretKey(t *testing.T) {
+	w := &ConfigWatcher{Key: "policy.yaml"}
+	v, ok := w.value(&corev1.Secret{Data: map[string][]byte{"policy.yaml": []byte("cpu_risk: 0.9")}})
+	if !ok || v != "cpu_risk: 0.9" {
+		t.Errorf("expected the secret value, got %q %v", v, ok)
+	}
+	if _, ok := w.value(&corev1.ConfigMap{}); ok {
+		t.Errorf("expected a missing key to be reported")
+	}
+}
@@ -0,0 +1,84 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespaces left out of discovery unless configured otherwise
+var DefaultDiscoveryExclude = []string{"kube-system", "kube-public", "kube-node-lease"}
+
+// A deployment found through the API server
+type Workload struct {
+	Namespace string
+	Name      string
+	Replicas  int32
+	// requests of one replica, summed over the pod template's containers
+	CPUCores float64
+	MemoryMB float64
+}
+
+// Namespaces and their deployments, sorted by name
+// namespaces without deployments are listed too
+type Inventory struct {
+	Namespaces []string
+	Workloads  []Workload
+}
+
+// Lists namespaces and deployments through the API server
+// needs list on namespaces and deployments across the cluster
+type Discoverer struct {
+	Client kubernetes.Interface
+	// never listed, e.g. kube-system
+	Exclude []string
+}
+
+func NewDiscoverer(client kubernetes.Interface, exclude []string) *Discoverer {
+	return &Discoverer{Client: client, Exclude: exclude}
+}
+
+func (d *Discoverer) Discover(ctx context.Context) (*Inventory, error) {
+	namespaces, err := d.Client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	inv := &Inventory{}
+	for _, ns := range namespaces.Items {
+		if !slices.Contains(d.Exclude, ns.Name) {
+			inv.Namespaces = append(inv.Namespaces, ns.Name)
+		}
+	}
+
+	deployments, err := d.Client.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, dep := range deployments.Items {
+		if slices.Contains(d.Exclude, dep.Namespace) {
+			continue
+		}
+		w := Workload{Namespace: dep.Namespace, Name: dep.Name, Replicas: 1}
+		if dep.Spec.Replicas != nil {
+			w.Replicas = *dep.Spec.Replicas
+		}
+		for _, c := range dep.Spec.Template.Spec.Containers {
+			w.CPUCores += c.Resources.Requests.Cpu().AsApproximateFloat64()
+			w.MemoryMB += c.Resources.Requests.Memory().AsApproximateFloat64() / (1 << 20)
+		}
+		inv.Workloads = append(inv.Workloads, w)
+	}
+
+	sort.Strings(inv.Namespaces)
+	sort.Slice(inv.Workloads, func(i, j int) bool {
+		if inv.Workloads[i].Namespace != inv.Workloads[j].Namespace {
+			return inv.Workloads[i].Namespace < inv.Workloads[j].Namespace
+		}
+		return inv.Workloads[i].Name < inv.Workloads[j].Name
+	})
+	return inv, nil
+}
@@ -0,0 +1,89 @@
+// Package kube records the hub's decisions as Kubernetes Events on the deployments they target
+// so kubectl describe shows them next to the scheduler's and kubelet's events
+package kube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// shown in the From column of kubectl describe
+const Component = "cost-optimiser"
+
+type Event struct {
+	Namespace  string
+	Deployment string
+	// Normal or Warning
+	Type    string
+	Reason  string
+	Message string
+}
+
+type Recorder interface {
+	Record(ctx context.Context, e Event) error
+}
+
+// Creates core/v1 Events through the API server
+// needs get on deployments and create on events in the target namespaces
+type EventRecorder struct {
+	Client kubernetes.Interface
+}
+
+func NewEventRecorder(client kubernetes.Interface) *EventRecorder {
+	return &EventRecorder{Client: client}
+}
+
+// Client using the pod's service account, fails outside a cluster
+func InClusterClient() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load in-cluster config: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	return client, nil
+}
+
+// kubectl describe matches events to the object by uid, so the deployment is looked up first
+func (r *EventRecorder) Record(ctx context.Context, e Event) error {
+	d, err := r.Client.AppsV1().Deployments(e.Namespace).Get(ctx, e.Deployment, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s/%s: %w", e.Namespace, e.Deployment, err)
+	}
+
+	now := metav1.NewTime(time.Now())
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// same naming as client-go's recorder
+			Name:      fmt.Sprintf("%s.%x", d.Name, now.UnixNano()),
+			Namespace: d.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Deployment",
+			APIVersion:      "apps/v1",
+			Namespace:       d.Namespace,
+			Name:            d.Name,
+			UID:             d.UID,
+			ResourceVersion: d.ResourceVersion,
+		},
+		Type:           e.Type,
+		Reason:         e.Reason,
+		Message:        e.Message,
+		Source:         corev1.EventSource{Component: Component},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := r.Client.CoreV1().Events(d.Namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create event on %s/%s: %w", e.Namespace, e.Deployment, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecordAttachesEventToDeployment(t *testing.T) {
+	client := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "cart", Namespace: "shop", UID: "uid-1"},
+	})
+	r := NewEventRecorder(client)
+
+	err := r.Record(context.Background(), Event{
+		Namespace:  "shop",
+		Deployment: "cart",
+		Type:       corev1.EventTypeNormal,
+		Reason:     "HighMemoryWaste",
+		Message:    "CostOptimiser: High Memory Waste, recommend 256Mi",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	events, _ := client.CoreV1().Events("shop").List(context.Background(), metav1.ListOptions{})
+	if len(events.Items) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events.Items))
+	}
+	ev := events.Items[0]
+	if ev.InvolvedObject.UID != "uid-1" || ev.InvolvedObject.Kind != "Deployment" || ev.Source.Component != Component {
+		t.Errorf("expected event on deployment uid-1, got %+v", ev)
+	}
+}
+
+func TestRecordUnknownDeployment(t *testing.T) {
+	r := NewEventRecorder(fake.NewSimpleClientset())
+	if err := r.Record(context.Background(), Event{Namespace: "shop", Deployment: "cart"}); err == nil {
+		t.Errorf("expected an error for a missing deployment")
+	}
+}
+
+func TestDiscoverListsDeploymentsOutsideExcludedNamespaces(t *testing.T) {
+	replicas := int32(3)
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "empty"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "cart", Namespace: "shop"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+					{Name: "app", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("250m"),
+						corev1.ResourceMemory: resource.MustParse("256Mi"),
+					}}},
+					{Name: "sidecar", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("64Mi"),
+					}}},
+				}}},
+			},
+		},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: "kube-system"}},
+	)
+
+	inv, err := NewDiscoverer(client, DefaultDiscoveryExclude).Discover(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(inv.Namespaces) != 2 || inv.Namespaces[0] != "empty" || inv.Namespaces[1] != "shop" {
+		t.Errorf("expected empty and shop, got %v", inv.Namespaces)
+	}
+	if len(inv.Workloads) != 1 {
+		t.Fatalf("expected one workload, got %+v", inv.Workloads)
+	}
+	w := inv.Workloads[0]
+	if w.Name != "cart" || w.Replicas != 3 || w.CPUCores != 0.25 || w.MemoryMB != 320 {
+		t.Errorf("expected cart with 3 replicas of 0.25 cores and 320Mi, got %+v", w)
+	}
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/kube"
+)
+
+// API calls for one event shouldn't hold up publishing
+const DefaultKubeEventTimeout = 2 * time.Second
+
+// Event for a published deployment job
+// e.g. CostOptimiser: High Memory Waste, recommend 256Mi memory and 250m cpu
+func JobEvent(job AgentJob) kube.Event {
+	msg := "CostOptimiser: " + job.Reason
+	if rec := job.Recommendation; rec != nil {
+		msg += fmt.Sprintf(", recommend %dMi memory and %dm cpu",
+			int64(math.Ceil(rec.Requests.MemoryMB)), int64(math.Ceil(rec.Requests.CPUCores*1000)))
+	}
+	if job.Action == ActionNotifyOnly {
+		msg += ", not applied automatically"
+	}
+
+	return kube.Event{
+		Namespace:  job.Namespace,
+		Deployment: job.Deployment.Name,
+		Type:       "Normal",
+		Reason:     eventReason(job.Reason),
+		Message:    msg,
+	}
+}
+
+// event reasons are CamelCase, "High Memory Waste" becomes HighMemoryWaste
+func eventReason(reason string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(reason, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		runes := []rune(word)
+		b.WriteRune(unicode.ToUpper(runes[0]))
+		b.WriteString(string(runes[1:]))
+	}
+	if b.Len() == 0 {
+		return "CostOptimiser"
+	}
+	return b.String()
+}
+
+// failures are logged, events never block publishing
+func (a *Aggregator) recordKubeEvent(ctx context.Context, job AgentJob) {
+	if a.KubeEvents == nil || job.TargetType != TargetDeployment || job.Deployment == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, orDefault(a.KubeEventTimeout, DefaultKubeEventTimeout))
+	defer cancel()
+	if err := a.KubeEvents.Record(ctx, JobEvent(job)); err != nil {
+		fmt.Printf("Failed to record kubernetes event %v\n", err)
+	}
+}
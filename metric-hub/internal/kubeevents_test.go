@@ -0,0 +1,32 @@
+package internal
+
+import "testing"
+
+func TestJobEventMessage(t *testing.T) {
+	job := NewDeploymentJob("High Memory Waste", "shop", CostDeployment{Name: "cart"}, ClusterInfo{})
+	job.Recommendation = &Recommendation{Requests: Resources{CPUCores: 0.25, MemoryMB: 256}}
+
+	ev := JobEvent(job)
+	if ev.Reason != "HighMemoryWaste" {
+		t.Errorf("expected reason HighMemoryWaste, got %s", ev.Reason)
+	}
+	if want := "CostOptimiser: High Memory Waste, recommend 256Mi memory and 250m cpu"; ev.Message != want {
+		t.Errorf("expected message %q, got %q", want, ev.Message)
+	}
+	if ev.Namespace != "shop" || ev.Deployment != "cart" {
+		t.Errorf("expected shop/cart, got %s/%s", ev.Namespace, ev.Deployment)
+	}
+}
+
+func TestEventReason(t *testing.T) {
+	cases := map[string]string{
+		"Predicted Capacity Risk": "PredictedCapacityRisk",
+		"rule: noisy-batch":       "RuleNoisyBatch",
+		"":                        "CostOptimiser",
+	}
+	for reason, want := range cases {
+		if got := eventReason(reason); got != want {
+			t.Errorf("expected %q for %q, got %q", want, reason, got)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Package leader lets one hub replica publish jobs at a time
+//
+// The replica holding the lease gets a fencing token that grows with every
+// acquisition. Jobs are pushed by a script that checks the lease still holds
+// this replica's identity and token, so a replica that lost the lease without
+// noticing can't publish duplicates next to the new leader.
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Key - leader:lease, "<identity> <token>" of the replica allowed to publish
+	LeaseKey = "leader:lease"
+	// Key - leader:token, incremented on every acquisition
+	TokenKey = "leader:token"
+)
+
+var (
+	// this replica doesn't hold the lease, the job is left for the leader's next evaluation
+	ErrNotLeader = fmt.Errorf("not the leader, %w", queue.ErrDeclined)
+	// this replica believed it held the lease but another replica does
+	ErrFenced = errors.New("fenced off by another leader")
+)
+
+var acquireScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then return 0 end
+local token = redis.call('INCR', KEYS[2])
+redis.call('SET', KEYS[1], ARGV[1] .. ' ' .. token, 'PX', ARGV[2])
+return token`)
+
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) end
+return 0`)
+
+// pushes and returns "" while the lease is ours, otherwise returns its holder
+// "=" when the job id is already marked published, holders always contain a space
+var publishScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder == ARGV[1] then
+	if ARGV[3] ~= '' and not redis.call('SET', KEYS[3], '1', 'NX', 'PX', ARGV[4]) then return '=' end
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+	return ''
+end
+return holder or 'nobody'`)
+
+// Lease is also the agent queue when leader election is on
+type Lease struct {
+	Client *redis.Client
+	// unique per process, so two replicas with the same hostname are still told apart
+	Identity string
+	TTL      time.Duration
+	Notifier notify.Notifier
+	// time source, the system clock when nil
+	Clock clock.Clock
+	// split of the agent queue into lists, see queue.RedisQueue
+	Routing string
+	// how long a job id is remembered, queue.DefaultDedupTTL when zero
+	DedupTTL time.Duration
+
+	mu    sync.Mutex
+	token int64
+	until time.Time
+}
+
+func NewLease(client *redis.Client, identity string, ttl time.Duration, notifier notify.Notifier) *Lease {
+	return &Lease{Client: client, Identity: identity, TTL: ttl, Notifier: notifier}
+}
+
+// Lease state as seen by this replica
+type Status struct {
+	Identity string `json:"identity"`
+	Leader   bool   `json:"leader"`
+	Token    int64  `json:"token,omitempty"`
+	// replica holding the lease in redis, empty when nobody does
+	Holder string `json:"holder"`
+}
+
+func (l *Lease) value(token int64) string {
+	return l.Identity + " " + strconv.FormatInt(token, 10)
+}
+
+// token of the term this replica believes it is in, 0 when it isn't leader
+func (l *Lease) current() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.token == 0 || !clock.Now(l.Clock).Before(l.until) {
+		return 0
+	}
+	return l.token
+}
+
+func (l *Lease) set(token int64, until time.Time) {
+	l.mu.Lock()
+	l.token, l.until = token, until
+	l.mu.Unlock()
+	if token > 0 {
+		metrics.Leader.Set(1)
+	} else {
+		metrics.Leader.Set(0)
+	}
+}
+
+// Run renews or acquires the lease three times per TTL until ctx is cancelled
+// the lease is released on the way out so another replica takes over at once
+func (l *Lease) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := l.Tick(ctx); err != nil {
+			fmt.Printf("[Leader] %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			l.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Renew the lease when held, otherwise try to acquire it
+func (l *Lease) Tick(ctx context.Context) error {
+	l.mu.Lock()
+	token := l.token
+	l.mu.Unlock()
+	ttl := strconv.FormatInt(l.TTL.Milliseconds(), 10)
+
+	if token > 0 {
+		renewed, err := renewScript.Run(ctx, l.Client, []string{LeaseKey}, l.value(token), ttl).Int()
+		if err != nil {
+			return fmt.Errorf("failed to renew lease %w", err)
+		}
+		if renewed == 1 {
+			l.set(token, clock.Now(l.Clock).Add(l.TTL))
+			return nil
+		}
+		holder, _ := l.Client.Get(ctx, LeaseKey).Result()
+		l.set(0, time.Time{})
+		if holder != "" {
+			l.conflict(ctx, token, holder, "lost the lease")
+			return nil
+		}
+		fmt.Printf("[Leader] %s lease with token %d expired\n", l.Identity, token)
+	}
+
+	token, err := acquireScript.Run(ctx, l.Client, []string{LeaseKey, TokenKey}, l.Identity, ttl).Int64()
+	if err != nil {
+		return fmt.Errorf("failed to acquire lease %w", err)
+	}
+	if token > 0 {
+		l.set(token, clock.Now(l.Clock).Add(l.TTL))
+		fmt.Printf("[Leader] %s acquired the lease with token %d\n", l.Identity, token)
+	}
+	return nil
+}
+
+func (l *Lease) release() {
+	token := l.current()
+	if token == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	renewScript.Run(ctx, l.Client, []string{LeaseKey}, l.value(token), "1")
+	l.set(0, time.Time{})
+}
+
+func (l *Lease) Status(ctx context.Context) (*Status, error) {
+	holder, err := l.Client.Get(ctx, LeaseKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to get lease %w", err)
+	}
+	token := l.current()
+	return &Status{Identity: l.Identity, Leader: token > 0, Token: token, Holder: holder}, nil
+}
+
+// Push a job only while this replica holds the lease with its current token
+func (l *Lease) PublishJob(ctx context.Context, queueName string, msg *queue.Envelope) error {
+	token := l.current()
+	if token == 0 {
+		metrics.FencedPublishes.WithLabelValues("follower").Inc()
+		return ErrNotLeader
+	}
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	keys := []string{LeaseKey, queue.RedisKey(queueName, l.Routing, msg), queue.PublishedKey("redis", msg.ID)}
+	holder, err := publishScript.Run(ctx, l.Client, keys, l.value(token), jsonData, msg.ID, queue.DedupTTLArg(l.DedupTTL)).Text()
+	if err != nil {
+		return fmt.Errorf("failed to push to redis queue: %w", err)
+	}
+	switch holder {
+	case "":
+		return nil
+	case "=":
+		queue.RecordDuplicate("redis", msg)
+		return nil
+	}
+	metrics.FencedPublishes.WithLabelValues("fenced").Inc()
+	l.set(0, time.Time{})
+	l.conflict(ctx, token, holder, "tried to publish")
+	return fmt.Errorf("%w %s", ErrFenced, holder)
+}
+
+// Guard passes jobs on to next only while this replica believes it holds the lease
+// for queues other than the Redis agent queue, which can't be fenced by the publish script,
+// so a stale leader may still publish to them until its lease runs out
+func (l *Lease) Guard(next queue.QueueClient) queue.QueueClient {
+	return guarded{lease: l, next: next}
+}
+
+type guarded struct {
+	lease *Lease
+	next  queue.QueueClient
+}
+
+func (g guarded) PublishJob(ctx context.Context, queueName string, msg *queue.Envelope) error {
+	if g.lease.current() == 0 {
+		return ErrNotLeader
+	}
+	return g.next.PublishJob(ctx, queueName, msg)
+}
+
+// two replicas acted as leader at once, jobs may have been published twice
+func (l *Lease) conflict(ctx context.Context, token int64, holder string, what string) {
+	metrics.LeaderConflicts.Inc()
+	msg := fmt.Sprintf("%s %s with token %d, but the lease is held by %s. Two hub replicas acted as leader and agents may have received duplicate jobs; check the replicas share one Redis and their clocks agree.",
+		l.Identity, what, token, holder)
+	fmt.Printf("[Leader] %s\n", msg)
+	if l.Notifier == nil {
+		return
+	}
+	other, _, _ := strings.Cut(holder, " ")
+	err := l.Notifier.Notify(ctx, notify.Notification{
+		Severity:  notify.SeverityCritical,
+		Title:     "Split brain: two hub leaders",
+		Message:   msg,
+		Labels:    map[string]string{"replica": l.Identity, "holder": other},
+		Timestamp: clock.Now(l.Clock),
+	})
+	if err != nil {
+		fmt.Printf("[Leader] failed to send notification %v\n", err)
+	}
+}
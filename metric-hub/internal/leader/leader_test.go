@@ -0,0 +1,106 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+type recorder []notify.Notification
+
+func (r *recorder) Notify(ctx context.Context, n notify.Notification) error {
+	*r = append(*r, n)
+	return nil
+}
+
+func job(reason string) *queue.Envelope {
+	msg, _ := queue.NewEnvelope("deployment", "prod", "shop", map[string]string{"reason": reason})
+	return msg
+}
+
+func TestPublishFencesStaleLeader(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+	alerts := &recorder{}
+	a := NewLease(client, "hub-a", 15*time.Second, alerts)
+	b := NewLease(client, "hub-b", 15*time.Second, alerts)
+
+	if err := a.Tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.PublishJob(ctx, "jobs", job("b1")); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("expected the follower refused, got %v", err)
+	}
+	if err := a.PublishJob(ctx, "jobs", job("a1")); err != nil {
+		t.Errorf("expected the leader to publish, got %v", err)
+	}
+
+	// a stalls past its lease and b takes over before a notices
+	mr.Del(LeaseKey)
+	b.Tick(ctx)
+	if status, _ := b.Status(ctx); !status.Leader || status.Token != 2 || status.Holder != "hub-b 2" {
+		t.Errorf("expected b to lead with token 2, got %+v", status)
+	}
+	if err := a.PublishJob(ctx, "jobs", job("a2")); !errors.Is(err, ErrFenced) {
+		t.Errorf("expected the stale leader fenced, got %v", err)
+	}
+
+	if jobs, _ := mr.List("jobs"); len(jobs) != 1 || string(queue.Payload([]byte(jobs[0]))) != `{"reason":"a1"}` {
+		t.Errorf("expected only the first job queued, got %v", jobs)
+	}
+	if len(*alerts) != 1 || (*alerts)[0].Severity != notify.SeverityCritical || (*alerts)[0].Labels["holder"] != "hub-b" {
+		t.Errorf("expected one critical conflict alert, got %+v", *alerts)
+	}
+	if err := a.PublishJob(ctx, "jobs", job("a3")); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("expected a to step down after the conflict, got %v", err)
+	}
+}
+
+func TestTickRenewsHeldLease(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+	a := NewLease(client, "hub-a", 15*time.Second, nil)
+
+	a.Tick(ctx)
+	mr.FastForward(10 * time.Second)
+	a.Tick(ctx)
+	mr.FastForward(10 * time.Second)
+
+	if v, err := mr.Get(LeaseKey); err != nil || v != "hub-a 1" {
+		t.Errorf("expected the lease kept with token 1, got %q %v", v, err)
+	}
+}
+
+func TestPublishRoutesByNamespaceOnce(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+	a := NewLease(client, "hub-a", 15*time.Second, nil)
+	a.Routing = queue.RouteNamespace
+
+	a.Tick(ctx)
+	msg := job("a1")
+	msg.ID = "a1"
+	for range 2 {
+		if err := a.PublishJob(ctx, "jobs", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if items, _ := mr.List("jobs:prod:shop"); len(items) != 1 {
+		t.Errorf("expected the job once on the namespace list, got %v", items)
+	}
+}
@@ -0,0 +1,73 @@
+package internal
+
+import "math"
+
+// Limit checks, run only for deployments whose producer reports limits
+const (
+	// a limit without its request, Kubernetes sets the request to the limit so the workload reserves its worst case
+	ReasonLimitsWithoutRequests = "Limits Without Requests"
+	// memory is requested but not limited, the container can use the node's memory until it is evicted
+	ReasonNoMemoryLimit = "No Memory Limit"
+)
+
+// limits keep this ratio to their recommended requests when the current ratio is unknown
+const DefaultLimitRatio = 2.0
+
+// reason from the deployment's limits, or "" when they are coherent or not reported
+// a limits-only deployment is classified here rather than as No Requests Set
+func limitsReason(c CostDeployment, flags Flags) string {
+	lim := c.CurrentLimits
+	if lim == nil || !flags.Enabled(FamilyLimits) {
+		return ""
+	}
+	req := c.CurrentRequests
+	cpu, memory := flags.ResourceEnabled(ResourceCPU), flags.ResourceEnabled(ResourceMemory)
+	if (cpu && req.CPUCores == 0 && lim.CPUCores > 0) || (memory && req.MemoryMB == 0 && lim.MemoryMB > 0) {
+		return ReasonLimitsWithoutRequests
+	}
+	if memory && req.MemoryMB > 0 && lim.MemoryMB == 0 {
+		return ReasonNoMemoryLimit
+	}
+	return ""
+}
+
+// Limits to set alongside recommended requests, nil when the deployment's limits aren't reported
+// each limit keeps its current ratio to the request, a limit set without a request is kept as it is
+// a cpu limit is only set where one already is, as throttling costs more than sharing idle cores, and memory is always limited
+func RecommendLimits(c CostDeployment, requests Resources, policy Policy, constraints *NamespaceConstraints) *Resources {
+	lim := c.CurrentLimits
+	if lim == nil {
+		return nil
+	}
+	limits := Resources{
+		CPUCores: recommendLimit(requests.CPUCores, c.CurrentRequests.CPUCores, lim.CPUCores, false),
+		MemoryMB: recommendLimit(requests.MemoryMB, c.CurrentRequests.MemoryMB, lim.MemoryMB, true),
+	}
+	limits = policy.Rounding.Round(limits)
+	// the LimitRange max applies to limits, never below the request
+	if constraints != nil && constraints.LimitRange != nil {
+		max := constraints.LimitRange.Max
+		limits.CPUCores = limitWithin(limits.CPUCores, requests.CPUCores, max.CPUCores)
+		limits.MemoryMB = limitWithin(limits.MemoryMB, requests.MemoryMB, max.MemoryMB)
+	}
+	return &limits
+}
+
+func recommendLimit(request float64, currentRequest float64, currentLimit float64, required bool) float64 {
+	switch {
+	case currentLimit > 0 && currentRequest > 0:
+		return request * math.Max(currentLimit/currentRequest, 1)
+	case currentLimit > 0:
+		return math.Max(currentLimit, request)
+	case required:
+		return request * DefaultLimitRatio
+	}
+	return 0
+}
+
+func limitWithin(limit float64, request float64, max float64) float64 {
+	if limit == 0 {
+		return 0
+	}
+	return math.Max(clampBounds(limit, 0, max), request)
+}
@@ -0,0 +1,143 @@
+// Package metrics holds the Prometheus collectors exposed on /metrics
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	RedisUsedMemory = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "metric_hub_redis_used_memory_bytes",
+		Help: "Memory used by the hub's Redis instance",
+	})
+
+	RedisKeys = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_hub_redis_keys",
+		Help: "Number of Redis keys per guarded prefix",
+	}, []string{"prefix"})
+
+	RedisEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_hub_redis_evictions_total",
+		Help: "Keys evicted by the guardrail per prefix",
+	}, []string{"prefix"})
+)
+
+var (
+	ProducerLastSeen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_hub_producer_last_seen_timestamp_seconds",
+		Help: "Unix time of the last push or heartbeat per producer",
+	}, []string{"producer"})
+
+	ProducerHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_hub_producer_healthy",
+		Help: "1 when the producer has pushed within its expected interval",
+	}, []string{"producer"})
+)
+
+var (
+	TenantQuotaRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_hub_tenant_quota_rejections_total",
+		Help: "Pushes, jobs and history samples rejected per tenant and quota",
+	}, []string{"tenant", "quota"})
+
+	TenantQuotaUsage = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_hub_tenant_quota_usage",
+		Help: "Usage in the current window per tenant and quota",
+	}, []string{"tenant", "quota"})
+)
+
+var FaultsInjected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "metric_hub_faults_injected_total",
+	Help: "Failures injected by the chaos layer per target",
+}, []string{"target"})
+
+var CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "metric_hub_cache_requests_total",
+	Help: "In-process cache lookups per cache and result, hit or miss",
+}, []string{"cache", "result"})
+
+var ShardsEvaluated = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "metric_hub_evaluation_shards_total",
+	Help: "Evaluation shards finished, local for the receiving replica and remote for helpers",
+}, []string{"origin"})
+
+var WALReplayedKeys = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "metric_hub_wal_replayed_keys_total",
+	Help: "Keys written back to Redis from the write-ahead log",
+})
+
+var (
+	Leader = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "metric_hub_leader",
+		Help: "1 while this replica holds the leader lease",
+	})
+
+	FencedPublishes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_hub_fenced_publishes_total",
+		Help: "Jobs not published because this replica isn't the leader, follower, or lost the lease to another, fenced",
+	}, []string{"reason"})
+
+	LeaderConflicts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "metric_hub_leader_conflicts_total",
+		Help: "Times this replica found another replica holding the lease it believed it held",
+	})
+)
+
+var (
+	QueuePublishes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_hub_queue_publishes_total",
+		Help: "Jobs published per queue sink and result, ok, failed or declined",
+	}, []string{"sink", "result"})
+
+	QueuePublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "metric_hub_queue_publish_duration_seconds",
+		Help:    "Time taken to publish a job per queue sink",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"sink"})
+
+	QueueDuplicates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_hub_queue_duplicates_total",
+		Help: "Jobs not published again because the sink had already taken their id",
+	}, []string{"sink"})
+)
+
+var (
+	IngestPayloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_hub_ingest_payloads_total",
+		Help: "Payloads an input adapter produced that the hub accepted",
+	}, []string{"adapter"})
+
+	IngestFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_hub_ingest_failures_total",
+		Help: "Failed polls, rejected payloads and dropped subscriptions per input adapter",
+	}, []string{"adapter"})
+
+	IngestConsecutiveFailures = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_hub_ingest_consecutive_failures",
+		Help: "Failures since the input adapter's last accepted payload",
+	}, []string{"adapter"})
+
+	IngestLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_hub_ingest_last_success_timestamp_seconds",
+		Help: "Unix time of the input adapter's last accepted payload",
+	}, []string{"adapter"})
+
+	IngestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "metric_hub_ingest_poll_duration_seconds",
+		Help:    "Time to poll an input adapter and save its payload",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"adapter"})
+)
+
+var (
+	PayloadQuality = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_hub_payload_quality_score",
+		Help: "Fraction of deployments without data-quality issues in the producer's latest cost payload",
+	}, []string{"producer"})
+
+	QualityIssues = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_hub_quality_issues_total",
+		Help: "Data-quality issues found in cost payloads per producer and check",
+	}, []string{"producer", "check"})
+)
@@ -0,0 +1,112 @@
+// Package migrate versions the JSON documents the hub keeps in Redis
+// and upgrades old documents lazily when they are read
+//
+// The version lives in a top-level "_v" field, which older replicas ignore
+// when decoding. Additive changes only need a new step; layout changes that
+// an older replica can't read should also move to a versioned key via Key.
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+const VersionField = "_v"
+
+// Step upgrades a document from version N to N+1 in place
+type Step func(doc map[string]interface{}) error
+
+type Registry struct {
+	mu    sync.RWMutex
+	steps map[string][]Step
+}
+
+func NewRegistry() *Registry {
+	return &Registry{steps: make(map[string][]Step)}
+}
+
+// Register the step from the kind's current version to the next one
+// steps must be registered in order, starting from version 1
+func (r *Registry) Register(kind string, step Step) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps[kind] = append(r.steps[kind], step)
+}
+
+// Documents without a version field are version 1
+func (r *Registry) CurrentVersion(kind string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.steps[kind]) + 1
+}
+
+// Key returns the versioned key for layouts older replicas can't read
+// version 1 keeps the unversioned key so existing data stays in place
+func Key(base string, version int) string {
+	if version <= 1 {
+		return base
+	}
+	return fmt.Sprintf("%s:v%d", base, version)
+}
+
+// Encode marshals v and stamps it with the kind's current version
+func (r *Registry) Encode(kind string, v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", kind, err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("%s is not a json object: %w", kind, err)
+	}
+	doc[VersionField] = r.CurrentVersion(kind)
+	return json.Marshal(doc)
+}
+
+// Decode upgrades raw to the current version and unmarshals it into out
+// returns the upgraded document when a migration ran so callers can write it back
+func (r *Registry) Decode(kind string, raw []byte, out interface{}) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", kind, err)
+	}
+
+	version := 1
+	if v, ok := doc[VersionField].(float64); ok {
+		version = int(v)
+	}
+
+	r.mu.RLock()
+	steps := r.steps[kind]
+	r.mu.RUnlock()
+
+	current := len(steps) + 1
+	if version > current {
+		// written by a newer replica, fields we don't know are ignored
+		return nil, json.Unmarshal(raw, out)
+	}
+
+	var upgraded []byte
+	if version < current {
+		for i := version - 1; i < len(steps); i++ {
+			if err := steps[i](doc); err != nil {
+				return nil, fmt.Errorf("failed to migrate %s from v%d: %w", kind, i+1, err)
+			}
+		}
+		doc[VersionField] = current
+
+		var err error
+		upgraded, err = json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal migrated %s: %w", kind, err)
+		}
+		raw = upgraded
+	}
+
+	if err := json.Unmarshal(raw, out); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", kind, err)
+	}
+	return upgraded, nil
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type payloadV2 struct {
+	Namespace string `json:"namespace"`
+	Cluster   string `json:"cluster"`
+}
+
+func TestDecodeUpgradesOldDocuments(t *testing.T) {
+	r := NewRegistry()
+	r.Register("cost_payload", func(doc map[string]interface{}) error {
+		doc["cluster"] = "default"
+		return nil
+	})
+
+	var out payloadV2
+	upgraded, err := r.Decode("cost_payload", []byte(`{"namespace":"default"}`), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Cluster != "default" {
+		t.Errorf("migration step did not run, got %+v", out)
+	}
+	if upgraded == nil {
+		t.Fatal("expected upgraded document to write back")
+	}
+
+	var doc map[string]interface{}
+	json.Unmarshal(upgraded, &doc)
+	if doc[VersionField] != float64(2) {
+		t.Errorf("upgraded version %v, want 2", doc[VersionField])
+	}
+}
+
+func TestDecodeCurrentAndNewerVersions(t *testing.T) {
+	r := NewRegistry()
+
+	encoded, err := r.Encode("cost_payload", payloadV2{Namespace: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out payloadV2
+	if upgraded, err := r.Decode("cost_payload", encoded, &out); err != nil || upgraded != nil {
+		t.Errorf("current version should decode without migration, got %s, %v", upgraded, err)
+	}
+
+	// documents from a newer replica still decode
+	if _, err := r.Decode("cost_payload", []byte(`{"_v":5,"namespace":"default","extra":1}`), &out); err != nil {
+		t.Errorf("newer version should decode, got %v", err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	if Key("cost:latest", 1) != "cost:latest" {
+		t.Error("version 1 keeps the base key")
+	}
+	if Key("cost:latest", 3) != "cost:latest:v3" {
+		t.Error("later versions use a suffix")
+	}
+}
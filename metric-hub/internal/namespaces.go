@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// One row of the namespace comparison report
+type NamespaceReport struct {
+	Namespace string `json:"namespace"`
+	Payloads  int    `json:"payloads"`
+	// cost and waste over the window, each payload counting until the next one
+	Spend            float64 `json:"spend"`
+	Waste            float64 `json:"waste"`
+	AvgHourlyCost    float64 `json:"avg_hourly_cost"`
+	CPUEfficiency    float64 `json:"cpu_efficiency"`
+	MemoryEfficiency float64 `json:"memory_efficiency"`
+	Triggers         int     `json:"triggers"`
+	Denied           int     `json:"denied"`
+}
+
+// Column order used for CSV export
+var NamespaceReportHeader = []string{
+	"namespace", "payloads", "spend", "waste", "avg_hourly_cost",
+	"cpu_efficiency", "memory_efficiency", "triggers", "denied",
+}
+
+func (r NamespaceReport) Record() []string {
+	return []string{
+		r.Namespace,
+		fmt.Sprint(r.Payloads),
+		fmt.Sprintf("%.4f", r.Spend),
+		fmt.Sprintf("%.4f", r.Waste),
+		fmt.Sprintf("%.4f", r.AvgHourlyCost),
+		fmt.Sprintf("%.4f", r.CPUEfficiency),
+		fmt.Sprintf("%.4f", r.MemoryEfficiency),
+		fmt.Sprint(r.Triggers),
+		fmt.Sprint(r.Denied),
+	}
+}
+
+// Compare namespaces over the decision log between from and to, highest spend first
+// spend starts at the first payload in the window, the last payload counts until to
+func (a *Aggregator) CompareNamespaces(ctx context.Context, from time.Time, to time.Time) ([]NamespaceReport, error) {
+	events, err := a.ReadEvents(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	reports := BuildNamespaceReports(events, to)
+
+	// discovered namespaces nothing has been reported for yet get an empty row
+	discovered, err := a.Client.SMembers(ctx, InventoryNamespacesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory %w", err)
+	}
+	seen := make(map[string]bool, len(reports))
+	for _, r := range reports {
+		seen[r.Namespace] = true
+	}
+	for _, ns := range discovered {
+		if !seen[ns] {
+			reports = append(reports, NamespaceReport{Namespace: ns})
+		}
+	}
+	sortNamespaceReports(reports)
+	return reports, nil
+}
+
+func BuildNamespaceReports(events []Event, to time.Time) []NamespaceReport {
+	type observation struct {
+		at      time.Time
+		payload CostPayload
+	}
+	payloads := map[string][]observation{}
+	reports := map[string]*NamespaceReport{}
+	report := func(ns string) *NamespaceReport {
+		if reports[ns] == nil {
+			reports[ns] = &NamespaceReport{Namespace: ns}
+		}
+		return reports[ns]
+	}
+
+	for _, ev := range events {
+		switch ev.Type {
+		case EventCostPayload:
+			var p CostPayload
+			if err := json.Unmarshal(ev.Data, &p); err != nil {
+				continue
+			}
+			payloads[p.Namespace] = append(payloads[p.Namespace], observation{ev.Time, p})
+			report(p.Namespace).Payloads++
+		case EventJobPublished:
+			var job AgentJob
+			if err := json.Unmarshal(ev.Data, &job); err == nil && job.Namespace != "" {
+				report(job.Namespace).Triggers++
+			}
+		case EventJobDenied:
+			var d JobDenial
+			if err := json.Unmarshal(ev.Data, &d); err == nil && d.Job.Namespace != "" {
+				report(d.Job.Namespace).Denied++
+			}
+		}
+	}
+
+	for ns, obs := range payloads {
+		r := report(ns)
+		var hours, cpuEff, memEff float64
+		for i, o := range obs {
+			end := to
+			if i+1 < len(obs) {
+				end = obs[i+1].at
+			}
+			h := end.Sub(o.at).Hours()
+			if h <= 0 {
+				continue
+			}
+
+			var usage, requests Resources
+			for _, d := range o.payload.Deployments {
+				r.Spend += DeploymentHourlyCost(&o.payload, d) * h
+				r.Waste += WastedHourlyCost(&o.payload, d) * h
+				usage.CPUCores += d.CurrentUsage.CPUCores
+				usage.MemoryMB += d.CurrentUsage.MemoryMB
+				requests.CPUCores += d.CurrentRequests.CPUCores
+				requests.MemoryMB += d.CurrentRequests.MemoryMB
+			}
+			cpuEff += ratio(usage.CPUCores, requests.CPUCores) * h
+			memEff += ratio(usage.MemoryMB, requests.MemoryMB) * h
+			hours += h
+		}
+		if hours > 0 {
+			r.AvgHourlyCost = r.Spend / hours
+			r.CPUEfficiency = cpuEff / hours
+			r.MemoryEfficiency = memEff / hours
+		}
+	}
+
+	result := make([]NamespaceReport, 0, len(reports))
+	for _, r := range reports {
+		result = append(result, *r)
+	}
+	sortNamespaceReports(result)
+	return result
+}
+
+// highest spend first, then by name
+func sortNamespaceReports(reports []NamespaceReport) {
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Spend != reports[j].Spend {
+			return reports[i].Spend > reports[j].Spend
+		}
+		return reports[i].Namespace < reports[j].Namespace
+	})
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNamespaceReportsWeightCostByTime(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(at time.Time, eventType string, v interface{}) Event {
+		data, _ := json.Marshal(v)
+		return Event{Type: eventType, Time: at, Data: data}
+	}
+	payload := func(ns string, cost float64, usage float64) CostPayload {
+		return CostPayload{
+			Namespace:   ns,
+			ClusterInfo: ClusterInfo{Cost: cost},
+			Deployments: []CostDeployment{{
+				Name:            "app",
+				CurrentRequests: Resources{CPUCores: 1, MemoryMB: 100},
+				CurrentUsage:    Resources{CPUCores: usage, MemoryMB: 100 * usage},
+			}},
+		}
+	}
+
+	events := []Event{
+		event(base, EventCostPayload, payload("shop", 1, 1)),
+		event(base, EventCostPayload, payload("batch", 1, 0.5)),
+		event(base.Add(time.Hour), EventCostPayload, payload("shop", 2, 0.5)),
+		event(base.Add(time.Hour), EventJobPublished, NewDeploymentJob("High CPU Waste", "batch", CostDeployment{Name: "app"}, ClusterInfo{})),
+		event(base.Add(time.Hour), EventJobDenied, JobDenial{Job: NewDeploymentJob("High CPU Waste", "batch", CostDeployment{Name: "app"}, ClusterInfo{})}),
+	}
+
+	reports := BuildNamespaceReports(events, base.Add(3*time.Hour))
+	if len(reports) != 2 || reports[0].Namespace != "shop" {
+		t.Fatalf("expected shop first, got %+v", reports)
+	}
+
+	shop := reports[0]
+	if shop.Payloads != 2 || shop.Spend != 5 || shop.Waste != 2 {
+		t.Errorf("unexpected shop spend or waste %+v", shop)
+	}
+	if shop.CPUEfficiency != 2.0/3 {
+		t.Errorf("expected time weighted efficiency, got %v", shop.CPUEfficiency)
+	}
+
+	batch := reports[1]
+	if batch.Spend != 3 || batch.Triggers != 1 || batch.Denied != 1 {
+		t.Errorf("unexpected batch report %+v", batch)
+	}
+}
@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Instance type that a node group can be moved to
+type InstanceType struct {
+	Name       string    `json:"name"`
+	Capacity   Resources `json:"capacity"`
+	HourlyCost float64   `json:"hourly_cost"`
+}
+
+// Default catalogue used when no other instance types are configured
+var DefaultInstanceCatalogue = []InstanceType{
+	{Name: "small", Capacity: Resources{CPUCores: 2, MemoryMB: 4096}, HourlyCost: 0.02},
+	{Name: "medium", Capacity: Resources{CPUCores: 4, MemoryMB: 8192}, HourlyCost: 0.04},
+	{Name: "large", Capacity: Resources{CPUCores: 8, MemoryMB: 16384}, HourlyCost: 0.08},
+	{Name: "highmem-medium", Capacity: Resources{CPUCores: 4, MemoryMB: 16384}, HourlyCost: 0.05},
+}
+
+type NodeGroupRecommendation struct {
+	NodeGroup               string    `json:"name"`
+	CurrentInstanceType     string    `json:"current_instance_type"`
+	CurrentNodeCount        int       `json:"current_node_count"`
+	RecommendedInstanceType string    `json:"recommended_instance_type"`
+	RecommendedNodeCount    int       `json:"recommended_node_count"`
+	CurrentHourlyCost       float64   `json:"current_hourly_cost"`
+	RecommendedHourlyCost   float64   `json:"recommended_hourly_cost"`
+	Requested               Resources `json:"requested"`
+	Used                    Resources `json:"used"`
+}
+
+type NodeGroupRecommender struct {
+	Catalogue []InstanceType
+	// fraction of node capacity requests may fill
+	TargetUtilisation float64
+	// minimum relative saving before a change is worth recommending
+	MinSaving float64
+}
+
+func NewNodeGroupRecommender() *NodeGroupRecommender {
+	return &NodeGroupRecommender{
+		Catalogue:         DefaultInstanceCatalogue,
+		TargetUtilisation: 0.75,
+		MinSaving:         0.1,
+	}
+}
+
+// nodes of the given capacity needed to hold the requested resources
+func (r *NodeGroupRecommender) nodesNeeded(requested Resources, capacity Resources) int {
+	if capacity.CPUCores <= 0 || capacity.MemoryMB <= 0 {
+		return 0
+	}
+	cpuNodes := requested.CPUCores / (capacity.CPUCores * r.TargetUtilisation)
+	memNodes := requested.MemoryMB / (capacity.MemoryMB * r.TargetUtilisation)
+
+	n := int(math.Ceil(math.Max(cpuNodes, memNodes)))
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Recommend returns nil when the node group is already sized well
+// costPerNode is used when the node group does not report its own price
+func (r *NodeGroupRecommender) Recommend(g NodeGroup, costPerNode float64) *NodeGroupRecommendation {
+	if g.HourlyCostPerNode > 0 {
+		costPerNode = g.HourlyCostPerNode
+	}
+	currentCost := float64(g.NodeCount) * costPerNode
+
+	rec := &NodeGroupRecommendation{
+		NodeGroup:               g.Name,
+		CurrentInstanceType:     g.InstanceType,
+		CurrentNodeCount:        g.NodeCount,
+		RecommendedInstanceType: g.InstanceType,
+		RecommendedNodeCount:    r.nodesNeeded(g.Requested, g.NodeCapacity),
+		CurrentHourlyCost:       currentCost,
+		Requested:               g.Requested,
+		Used:                    g.Used,
+	}
+	rec.RecommendedHourlyCost = float64(rec.RecommendedNodeCount) * costPerNode
+
+	// look for a cheaper instance type that still fits the requests
+	for _, it := range r.Catalogue {
+		n := r.nodesNeeded(g.Requested, it.Capacity)
+		if n == 0 {
+			continue
+		}
+		cost := float64(n) * it.HourlyCost
+		if cost < rec.RecommendedHourlyCost {
+			rec.RecommendedInstanceType = it.Name
+			rec.RecommendedNodeCount = n
+			rec.RecommendedHourlyCost = cost
+		}
+	}
+
+	if currentCost <= 0 || (currentCost-rec.RecommendedHourlyCost)/currentCost < r.MinSaving {
+		return nil
+	}
+	return rec
+}
+
+// Evaluate every node group in the payload and publish node group jobs,
+// or provisioner hints when a node provisioner is configured
+func (a *Aggregator) CheckNodeGroups(ctx context.Context, p *CostPayload) {
+	if len(p.NodeGroups) == 0 || a.NodeGroups == nil {
+		return
+	}
+	if !a.flagsFor(ctx, p.Namespace).Enabled(FamilyNodeGroup) {
+		return
+	}
+	fmt.Printf("[Background] Starting node group check for %d node groups\n", len(p.NodeGroups))
+
+	// fall back to the average VM price reported by the cost engine
+	var costPerNode float64
+	if p.ClusterInfo.VmCount > 0 {
+		costPerNode = p.ClusterInfo.Cost / p.ClusterInfo.VmCount
+	}
+
+	policy := a.ActivePolicy(ctx)
+	cooldown := time.Duration(policy.CooldownSeconds) * time.Second
+
+	for _, g := range p.NodeGroups {
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Node group check cancelled")
+			return
+		default:
+		}
+
+		rec := a.NodeGroups.Recommend(g, costPerNode)
+		if rec == nil {
+			continue
+		}
+
+		key := fmt.Sprintf("trigger:cooldown:nodegroup:%s", g.Name)
+		unlock := a.Locks.Lock("nodegroup/" + g.Name)
+		if a.cooldownActive(ctx, key, cooldown) {
+			unlock()
+			fmt.Printf("Cooldown active for node group %s. Skipping.\n", g.Name)
+			continue
+		}
+
+		fmt.Printf("Pushing node group job for %s: %d x %s -> %d x %s\n", g.Name,
+			rec.CurrentNodeCount, rec.CurrentInstanceType, rec.RecommendedNodeCount, rec.RecommendedInstanceType)
+
+		job := NewNodeGroupJob("Node Group Oversized", *rec, p.ClusterInfo)
+		if a.Provisioner != "" {
+			job = NewProvisionerJob("Node Group Oversized", *a.NodeGroups.Hint(a.Provisioner, g, rec, costPerNode), p.ClusterInfo)
+		}
+		if err := a.publishJob(ctx, job); errors.Is(err, ErrJobDenied) {
+			fmt.Printf("Node group job for %s not published: %v\n", g.Name, err)
+		} else if err != nil {
+			unlock()
+			fmt.Printf("Failed to push node group job: %v\n", err)
+			continue
+		}
+		a.startCooldown(ctx, key, cooldown)
+		unlock()
+	}
+}
@@ -0,0 +1,78 @@
+package internal
+
+import "testing"
+
+func TestNodeGroupRecommendReducesNodes(t *testing.T) {
+	r := NewNodeGroupRecommender()
+	r.Catalogue = nil
+
+	g := NodeGroup{
+		Name:              "workers",
+		InstanceType:      "medium",
+		NodeCount:         6,
+		NodeCapacity:      Resources{CPUCores: 4, MemoryMB: 8192},
+		HourlyCostPerNode: 0.04,
+		Requested:         Resources{CPUCores: 5, MemoryMB: 10000},
+		Used:              Resources{CPUCores: 2, MemoryMB: 6000},
+	}
+
+	rec := r.Recommend(g, 0)
+	if rec == nil {
+		t.Fatal("expected a recommendation for an oversized node group")
+	}
+	if rec.RecommendedNodeCount != 2 {
+		t.Errorf("got %d nodes, want 2", rec.RecommendedNodeCount)
+	}
+}
+
+func TestNodeGroupRecommendWellSized(t *testing.T) {
+	r := NewNodeGroupRecommender()
+
+	g := NodeGroup{
+		Name:              "workers",
+		InstanceType:      "small",
+		NodeCount:         2,
+		NodeCapacity:      Resources{CPUCores: 2, MemoryMB: 4096},
+		HourlyCostPerNode: 0.02,
+		Requested:         Resources{CPUCores: 2.8, MemoryMB: 5000},
+		Used:              Resources{CPUCores: 2, MemoryMB: 4000},
+	}
+
+	if rec := r.Recommend(g, 0); rec != nil {
+		t.Errorf("expected no recommendation, got %+v", rec)
+	}
+}
+
+func TestProvisionerHintForKarpenter(t *testing.T) {
+	r := NewNodeGroupRecommender()
+	g := NodeGroup{
+		Name:              "workers",
+		InstanceType:      "large",
+		NodeCount:         4,
+		NodeCapacity:      Resources{CPUCores: 8, MemoryMB: 16384},
+		HourlyCostPerNode: 0.08,
+		Requested:         Resources{CPUCores: 5, MemoryMB: 10000},
+		Used:              Resources{CPUCores: 2, MemoryMB: 6000},
+	}
+	rec := r.Recommend(g, 0)
+	if rec == nil {
+		t.Fatal("expected a recommendation")
+	}
+
+	hint := r.Hint(ProvisionerKarpenter, g, rec, 0)
+	if hint.ConsolidatableNodes != 3 {
+		t.Errorf("expected 3 consolidatable nodes, got %d", hint.ConsolidatableNodes)
+	}
+	if hint.Karpenter == nil || hint.ClusterAutoscaler != nil {
+		t.Fatalf("expected only the karpenter section, got %+v", hint)
+	}
+	values := hint.Karpenter.Requirements[0].Values
+	if len(values) != len(hint.InstanceTypes) || values[0] != hint.InstanceTypes[0].InstanceType {
+		t.Errorf("requirement values %v don't follow instance types %+v", values, hint.InstanceTypes)
+	}
+	for i := 1; i < len(hint.InstanceTypes); i++ {
+		if hint.InstanceTypes[i].HourlyCost < hint.InstanceTypes[i-1].HourlyCost {
+			t.Errorf("instance types not cheapest first: %+v", hint.InstanceTypes)
+		}
+	}
+}
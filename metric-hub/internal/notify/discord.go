@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// discord rejects messages longer than this
+const discordMaxContent = 2000
+
+// Posts notifications to a Discord channel webhook
+type DiscordNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func NewDiscordNotifier(webhookURL string) *DiscordNotifier {
+	return &DiscordNotifier{
+		WebhookURL: webhookURL,
+		Client:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+var discordEmoji = map[Severity]string{
+	SeverityInfo:     ":information_source:",
+	SeverityWarning:  ":warning:",
+	SeverityCritical: ":rotating_light:",
+}
+
+func discordContent(n Notification) string {
+	text := fmt.Sprintf("%s **%s**\n%s", discordEmoji[n.Severity], n.Title, n.Message)
+	if runes := []rune(text); len(runes) > discordMaxContent {
+		text = string(runes[:discordMaxContent-1]) + "…"
+	}
+	return text
+}
+
+func (d *DiscordNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, d.Client, d.WebhookURL, "discord", map[string]string{"content": discordContent(n)})
+}
@@ -0,0 +1,18 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+)
+
+// Writes notifications to stdout, always enabled so alerts show in kubectl logs
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (l *LogNotifier) Notify(ctx context.Context, n Notification) error {
+	fmt.Printf("[Notify] [%s] %s: %s %v\n", n.Severity, n.Title, n.Message, n.Labels)
+	return nil
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// A single alert sent to operators
+type Notification struct {
+	Severity  Severity          `json:"severity"`
+	Title     string            `json:"title"`
+	Message   string            `json:"message"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	// notifications sharing a key are one incident, Resolve closes it
+	DedupKey string `json:"dedup_key,omitempty"`
+	Resolve  bool   `json:"resolve,omitempty"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Multi sends every notification to all notifiers
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
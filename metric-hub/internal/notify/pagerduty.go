@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Opens and resolves PagerDuty incidents through the Events API v2
+// only critical notifications with a dedup key open incidents, everything else is ignored
+type PagerDutyNotifier struct {
+	RoutingKey string
+	URL        string
+	Client     *http.Client
+}
+
+func NewPagerDutyNotifier(routingKey string) *PagerDutyNotifier {
+	return &PagerDutyNotifier{
+		RoutingKey: routingKey,
+		URL:        PagerDutyEventsURL,
+		Client:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+func pagerDutyEventFor(routingKey string, n Notification) *pagerDutyEvent {
+	if n.DedupKey == "" {
+		return nil
+	}
+	if n.Resolve {
+		return &pagerDutyEvent{RoutingKey: routingKey, EventAction: "resolve", DedupKey: n.DedupKey}
+	}
+	if n.Severity != SeverityCritical {
+		return nil
+	}
+
+	details := map[string]string{"message": n.Message}
+	for k, v := range n.Labels {
+		details[k] = v
+	}
+	ev := &pagerDutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "trigger",
+		DedupKey:    n.DedupKey,
+		Payload: &pagerDutyPayload{
+			Summary:       n.Title,
+			Source:        "metric-hub",
+			Severity:      "critical",
+			CustomDetails: details,
+		},
+	}
+	if !n.Timestamp.IsZero() {
+		ev.Payload.Timestamp = n.Timestamp.UTC().Format(time.RFC3339)
+	}
+	return ev
+}
+
+func (p *PagerDutyNotifier) Notify(ctx context.Context, n Notification) error {
+	ev := pagerDutyEventFor(p.RoutingKey, n)
+	if ev == nil {
+		return nil
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pagerduty event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build pagerduty request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to pagerduty: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("pagerduty events api returned %s", resp.Status)
+	}
+	return nil
+}
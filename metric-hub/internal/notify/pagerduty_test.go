@@ -0,0 +1,27 @@
+package notify
+
+import "testing"
+
+func TestPagerDutyEventsOnlyForIncidents(t *testing.T) {
+	if ev := pagerDutyEventFor("key", Notification{Severity: SeverityCritical, Title: "digest"}); ev != nil {
+		t.Errorf("expected no event without a dedup key, got %+v", ev)
+	}
+	if ev := pagerDutyEventFor("key", Notification{Severity: SeverityWarning, DedupKey: "a"}); ev != nil {
+		t.Errorf("expected no event for a warning, got %+v", ev)
+	}
+
+	ev := pagerDutyEventFor("key", Notification{
+		Severity: SeverityCritical,
+		Title:    "Capacity risk",
+		DedupKey: "cost:default/cartservice:High Memory Risk",
+		Labels:   map[string]string{"deployment": "cartservice"},
+	})
+	if ev == nil || ev.EventAction != "trigger" || ev.Payload.Severity != "critical" || ev.Payload.CustomDetails["deployment"] != "cartservice" {
+		t.Errorf("unexpected trigger event %+v", ev)
+	}
+
+	ev = pagerDutyEventFor("key", Notification{DedupKey: "cost:default/cartservice:High Memory Risk", Resolve: true})
+	if ev == nil || ev.EventAction != "resolve" || ev.Payload != nil {
+		t.Errorf("unexpected resolve event %+v", ev)
+	}
+}
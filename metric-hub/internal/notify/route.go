@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"sort"
+)
+
+// Selects notifications by minimum severity and labels
+// empty Labels match everything, Recipients is only used by email
+type Route struct {
+	Recipients  []string          `json:"recipients,omitempty"`
+	MinSeverity Severity          `json:"min_severity,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+var severityRank = map[Severity]int{
+	SeverityInfo:     0,
+	SeverityWarning:  1,
+	SeverityCritical: 2,
+}
+
+// true when s is min or more severe, an empty min is the lowest
+func (s Severity) AtLeast(min Severity) bool {
+	return severityRank[s] >= severityRank[min]
+}
+
+func (r Route) matches(n Notification) bool {
+	if !n.Severity.AtLeast(r.MinSeverity) {
+		return false
+	}
+	for k, v := range r.Labels {
+		if n.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Routed sends only the notifications its route matches
+type Routed struct {
+	Route    Route
+	Notifier Notifier
+}
+
+func (r Routed) Notify(ctx context.Context, n Notification) error {
+	if !r.Route.matches(n) {
+		return nil
+	}
+	return r.Notifier.Notify(ctx, n)
+}
+
+type label struct {
+	Key   string
+	Value string
+}
+
+// labels in key order, so every sink renders them the same way
+func sortedLabels(n Notification) []label {
+	labels := make([]label, 0, len(n.Labels))
+	for k, v := range n.Labels {
+		labels = append(labels, label{k, v})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Key < labels[j].Key })
+	return labels
+}
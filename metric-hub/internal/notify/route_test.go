@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type recorder struct {
+	sent []Notification
+}
+
+func (r *recorder) Notify(ctx context.Context, n Notification) error {
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func TestRoutedFiltersBySeverityAndLabels(t *testing.T) {
+	rec := &recorder{}
+	routed := Routed{Route: Route{MinSeverity: SeverityWarning, Labels: map[string]string{"namespace": "shop"}}, Notifier: rec}
+
+	routed.Notify(context.Background(), Notification{Severity: SeverityInfo, Labels: map[string]string{"namespace": "shop"}})
+	routed.Notify(context.Background(), Notification{Severity: SeverityCritical, Labels: map[string]string{"namespace": "batch"}})
+	routed.Notify(context.Background(), Notification{Severity: SeverityWarning, Labels: map[string]string{"namespace": "shop"}})
+
+	if len(rec.sent) != 1 || rec.sent[0].Severity != SeverityWarning {
+		t.Errorf("expected only the shop warning, got %+v", rec.sent)
+	}
+}
+
+func TestDiscordContentIsTruncated(t *testing.T) {
+	content := discordContent(Notification{Severity: SeverityInfo, Title: "Savings digest", Message: strings.Repeat("x", 3000)})
+	if n := len([]rune(content)); n != discordMaxContent {
+		t.Errorf("expected %d characters, got %d", discordMaxContent, n)
+	}
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Posts notifications to a Slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{
+		WebhookURL: webhookURL,
+		Client:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+var slackEmoji = map[Severity]string{
+	SeverityInfo:     ":information_source:",
+	SeverityWarning:  ":warning:",
+	SeverityCritical: ":rotating_light:",
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	text := fmt.Sprintf("%s *%s*\n%s", slackEmoji[n.Severity], n.Title, n.Message)
+	body := map[string]string{"text": text}
+	// the owning team's channel, webhooks bound to one channel ignore it
+	if channel := n.Labels["slack_channel"]; channel != "" {
+		body["channel"] = channel
+	}
+	return postJSON(ctx, s.Client, s.WebhookURL, "slack", body)
+}
@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Emails notifications as HTML through an SMTP relay
+type SMTPNotifier struct {
+	// host:port of the relay, STARTTLS is used when offered
+	Addr     string
+	Username string
+	Password string
+	From     string
+	// recipients of notifications no route matches
+	To     []string
+	Routes []Route
+	// connecting to the relay, the context deadline bounds the rest
+	Timeout time.Duration
+}
+
+func NewSMTPNotifier(addr string, from string, to []string) *SMTPNotifier {
+	return &SMTPNotifier{Addr: addr, From: from, To: to, Timeout: 10 * time.Second}
+}
+
+// every matching route's recipients, or the defaults when none match
+func (s *SMTPNotifier) recipients(n Notification) []string {
+	seen := map[string]bool{}
+	for _, r := range s.Routes {
+		if r.matches(n) {
+			for _, rcpt := range r.Recipients {
+				seen[rcpt] = true
+			}
+		}
+	}
+	if len(seen) == 0 {
+		for _, rcpt := range s.To {
+			seen[rcpt] = true
+		}
+	}
+	recipients := make([]string, 0, len(seen))
+	for rcpt := range seen {
+		recipients = append(recipients, rcpt)
+	}
+	sort.Strings(recipients)
+	return recipients
+}
+
+var severityColour = map[Severity]string{
+	SeverityInfo:     "#2f6fde",
+	SeverityWarning:  "#e8a317",
+	SeverityCritical: "#d93025",
+}
+
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif">
+<h2 style="color: {{.Colour}}">{{.Title}}</h2>
+{{range .Lines}}<p style="margin: 4px 0">{{.}}</p>
+{{end}}{{if .Labels}}<table style="margin-top: 12px; border-collapse: collapse">
+{{range .Labels}}<tr><td style="padding: 2px 8px; color: #666">{{.Key}}</td><td style="padding: 2px 8px">{{.Value}}</td></tr>
+{{end}}</table>
+{{end}}<p style="color: #999; font-size: small">{{.Severity}} · {{.Timestamp}}</p>
+</body></html>
+`))
+
+// Render a notification as HTML, digests keep one line per paragraph
+func RenderHTML(n Notification) (string, error) {
+	timestamp := n.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	var b bytes.Buffer
+	err := emailTemplate.Execute(&b, map[string]interface{}{
+		"Colour":    severityColour[n.Severity],
+		"Title":     n.Title,
+		"Lines":     strings.Split(n.Message, "\n"),
+		"Labels":    sortedLabels(n),
+		"Severity":  n.Severity,
+		"Timestamp": timestamp.UTC().Format(time.RFC1123),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render email: %w", err)
+	}
+	return b.String(), nil
+}
+
+func (s *SMTPNotifier) message(n Notification, to []string) ([]byte, error) {
+	html, err := RenderHTML(n)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", fmt.Sprintf("[%s] %s", n.Severity, n.Title)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	b.WriteString(html)
+	return b.Bytes(), nil
+}
+
+func (s *SMTPNotifier) Notify(ctx context.Context, n Notification) error {
+	to := s.recipients(n)
+	if len(to) == 0 {
+		return nil
+	}
+	msg, err := s.message(n, to)
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address %q: %w", s.Addr, err)
+	}
+	dialer := &net.Dialer{Timeout: s.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp relay: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start smtp session: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("smtp starttls failed: %w", err)
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return fmt.Errorf("smtp auth failed: %w", err)
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s failed: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return c.Quit()
+}
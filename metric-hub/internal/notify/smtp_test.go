@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSMTPRoutesBySeverityAndLabels(t *testing.T) {
+	s := NewSMTPNotifier("smtp.example.com:587", "hub@example.com", []string{"platform@example.com"})
+	s.Routes = []Route{
+		{Recipients: []string{"oncall@example.com"}, MinSeverity: SeverityCritical},
+		{Recipients: []string{"shop@example.com"}, Labels: map[string]string{"namespace": "shop"}},
+	}
+
+	critical := Notification{Severity: SeverityCritical, Labels: map[string]string{"namespace": "shop"}}
+	if got := strings.Join(s.recipients(critical), ","); got != "oncall@example.com,shop@example.com" {
+		t.Errorf("unexpected recipients %s", got)
+	}
+
+	info := Notification{Severity: SeverityInfo, Labels: map[string]string{"namespace": "batch"}}
+	if got := strings.Join(s.recipients(info), ","); got != "platform@example.com" {
+		t.Errorf("expected the default recipients, got %s", got)
+	}
+}
+
+func TestRenderHTMLEscapesAndSplitsLines(t *testing.T) {
+	html, err := RenderHTML(Notification{
+		Severity: SeverityInfo,
+		Title:    "Savings digest",
+		Message:  "Realised savings: 12.00\n1. <shop> 10.00",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, "<p style=\"margin: 4px 0\">1. &lt;shop&gt; 10.00</p>") {
+		t.Errorf("expected an escaped line per paragraph, got %s", html)
+	}
+}
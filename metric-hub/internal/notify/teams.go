@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Posts notifications to a Microsoft Teams workflow webhook as adaptive cards
+type TeamsNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func NewTeamsNotifier(webhookURL string) *TeamsNotifier {
+	return &TeamsNotifier{
+		WebhookURL: webhookURL,
+		Client:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// adaptive card colours for the title
+var teamsColour = map[Severity]string{
+	SeverityInfo:     "Accent",
+	SeverityWarning:  "Warning",
+	SeverityCritical: "Attention",
+}
+
+func teamsCard(n Notification) map[string]interface{} {
+	body := []interface{}{
+		map[string]interface{}{"type": "TextBlock", "text": n.Title, "weight": "Bolder", "size": "Medium", "color": teamsColour[n.Severity], "wrap": true},
+		map[string]interface{}{"type": "TextBlock", "text": n.Message, "wrap": true},
+	}
+	if labels := sortedLabels(n); len(labels) > 0 {
+		facts := make([]map[string]string, 0, len(labels))
+		for _, l := range labels {
+			facts = append(facts, map[string]string{"title": l.Key, "value": l.Value})
+		}
+		body = append(body, map[string]interface{}{"type": "FactSet", "facts": facts})
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{map[string]interface{}{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]interface{}{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+}
+
+func (t *TeamsNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, t.Client, t.WebhookURL, "teams", teamsCard(n))
+}
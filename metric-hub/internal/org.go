@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/savings"
+)
+
+// Key - org:teams
+// Field - <team>, Value - the team's place in the organisation
+const OrgTeamsKey = "org:teams"
+
+// team or department of deployments nothing assigns one to
+const OrgUnassigned = "unassigned"
+
+// Where a team sits in the organisation
+type OrgTeam struct {
+	Department string `json:"department" validate:"required"`
+}
+
+func (a *Aggregator) SaveOrgTeam(ctx context.Context, team string, t *OrgTeam) error {
+	jsonData, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal team: %w", err)
+	}
+	if err := a.Client.HSet(ctx, OrgTeamsKey, team, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) DeleteOrgTeam(ctx context.Context, team string) error {
+	return a.Client.HDel(ctx, OrgTeamsKey, team).Err()
+}
+
+// Teams keyed by name
+func (a *Aggregator) ListOrgTeams(ctx context.Context) (map[string]OrgTeam, error) {
+	raw, err := a.reader().HGetAll(ctx, OrgTeamsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teams %w", err)
+	}
+	teams := make(map[string]OrgTeam, len(raw))
+	for team, data := range raw {
+		var t OrgTeam
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			fmt.Printf("Skipping invalid team %s: %v\n", team, err)
+			continue
+		}
+		teams[team] = t
+	}
+	return teams, nil
+}
+
+// Resolves deployments to their team and department with the mappings as they are now
+type OrgChart struct {
+	// owners keyed by <namespace> or <namespace>/<name>
+	Owners map[string]Ownership
+	Teams  map[string]OrgTeam
+}
+
+// team and department of a deployment, OrgUnassigned when nothing names one
+// an owner's department wins over the team's mapping
+func (c OrgChart) Place(ns string, name string, labels map[string]string) (team string, department string) {
+	o := c.Owners[ns].merge(c.Owners[deploymentLockKey(ns, name)]).merge(ownershipFromLabels(labels))
+	team, department = o.Team, o.Department
+	if team == "" {
+		team = OrgUnassigned
+	}
+	if department == "" {
+		department = c.Teams[o.Team].Department
+	}
+	if department == "" {
+		department = OrgUnassigned
+	}
+	return team, department
+}
+
+// Totals of a department or one of its teams
+type OrgUnit struct {
+	Name string `json:"name"`
+	// cost and waste over the window, each payload counting until the next one
+	Spend float64 `json:"spend"`
+	Waste float64 `json:"waste"`
+	// spend over the hours of the window
+	AvgHourlyCost float64 `json:"avg_hourly_cost"`
+	Deployments   int     `json:"deployments"`
+	Triggers      int     `json:"triggers"`
+	Denied        int     `json:"denied"`
+	// realised to date by applied recommendations, and the current hourly run rate
+	Savings       float64 `json:"savings"`
+	HourlySavings float64 `json:"hourly_savings"`
+	// teams of a department, highest spend first
+	Teams []OrgUnit `json:"teams,omitempty"`
+}
+
+func (u *OrgUnit) add(o OrgUnit) {
+	u.Spend += o.Spend
+	u.Waste += o.Waste
+	u.Deployments += o.Deployments
+	u.Triggers += o.Triggers
+	u.Denied += o.Denied
+	u.Savings += o.Savings
+	u.HourlySavings += o.HourlySavings
+}
+
+type OrgReport struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Total       OrgUnit   `json:"total"`
+	Departments []OrgUnit `json:"departments"`
+}
+
+// Roll cost, waste, trigger counts and realised savings up teams and departments between from and to
+// deploymentSavings is keyed by <namespace>/<name>, deployments are placed with today's mappings
+func (a *Aggregator) OrgRollup(ctx context.Context, from time.Time, to time.Time, deploymentSavings map[string]savings.Entry) (*OrgReport, error) {
+	events, err := a.ReadEvents(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	owners, err := a.ListOwners(ctx)
+	if err != nil {
+		return nil, err
+	}
+	teams, err := a.ListOrgTeams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return BuildOrgReport(events, deploymentSavings, OrgChart{Owners: owners, Teams: teams}, from, to), nil
+}
+
+func BuildOrgReport(events []Event, deploymentSavings map[string]savings.Entry, chart OrgChart, from time.Time, to time.Time) *OrgReport {
+	type observation struct {
+		at      time.Time
+		payload CostPayload
+	}
+	payloads := map[string][]observation{}
+	// labels deployments were last reported with, savings of deployments no payload mentions are placed without
+	labels := map[string]map[string]string{}
+	units := map[string]*OrgUnit{}
+	unit := func(key string) *OrgUnit {
+		if units[key] == nil {
+			units[key] = &OrgUnit{Name: key}
+		}
+		return units[key]
+	}
+
+	for _, ev := range events {
+		switch ev.Type {
+		case EventCostPayload:
+			var p CostPayload
+			if err := json.Unmarshal(ev.Data, &p); err != nil {
+				continue
+			}
+			payloads[p.Namespace] = append(payloads[p.Namespace], observation{ev.Time, p})
+			for _, d := range p.Deployments {
+				key := deploymentLockKey(p.Namespace, d.Name)
+				labels[key] = d.Labels
+				unit(key)
+			}
+		case EventJobPublished:
+			var job AgentJob
+			if err := json.Unmarshal(ev.Data, &job); err == nil && job.Deployment != nil {
+				unit(deploymentLockKey(job.Namespace, job.Deployment.Name)).Triggers++
+			}
+		case EventJobDenied:
+			var d JobDenial
+			if err := json.Unmarshal(ev.Data, &d); err == nil && d.Job.Deployment != nil {
+				unit(deploymentLockKey(d.Job.Namespace, d.Job.Deployment.Name)).Denied++
+			}
+		}
+	}
+
+	for _, obs := range payloads {
+		for i, o := range obs {
+			end := to
+			if i+1 < len(obs) {
+				end = obs[i+1].at
+			}
+			h := end.Sub(o.at).Hours()
+			if h <= 0 {
+				continue
+			}
+			for _, d := range o.payload.Deployments {
+				u := unit(deploymentLockKey(o.payload.Namespace, d.Name))
+				u.Spend += DeploymentHourlyCost(&o.payload, d) * h
+				u.Waste += WastedHourlyCost(&o.payload, d) * h
+			}
+		}
+	}
+	for key, e := range deploymentSavings {
+		u := unit(key)
+		u.Savings += e.Realised
+		u.HourlySavings += e.HourlySavings
+	}
+
+	departments := map[string]*OrgUnit{}
+	teamUnits := map[string]map[string]*OrgUnit{}
+	for key, u := range units {
+		ns, name, _ := strings.Cut(key, "/")
+		team, department := chart.Place(ns, name, labels[key])
+		if departments[department] == nil {
+			departments[department] = &OrgUnit{Name: department}
+			teamUnits[department] = map[string]*OrgUnit{}
+		}
+		if teamUnits[department][team] == nil {
+			teamUnits[department][team] = &OrgUnit{Name: team}
+		}
+		u.Deployments = 1
+		teamUnits[department][team].add(*u)
+		departments[department].add(*u)
+	}
+
+	hours := to.Sub(from).Hours()
+	report := &OrgReport{From: from.UTC(), To: to.UTC(), Total: OrgUnit{Name: "total"}, Departments: []OrgUnit{}}
+	for name, d := range departments {
+		for _, t := range teamUnits[name] {
+			t.AvgHourlyCost = hourlyOver(t.Spend, hours)
+			d.Teams = append(d.Teams, *t)
+		}
+		sortOrgUnits(d.Teams)
+		d.AvgHourlyCost = hourlyOver(d.Spend, hours)
+		report.Total.add(*d)
+		report.Departments = append(report.Departments, *d)
+	}
+	report.Total.AvgHourlyCost = hourlyOver(report.Total.Spend, hours)
+	sortOrgUnits(report.Departments)
+	return report
+}
+
+func hourlyOver(spend float64, hours float64) float64 {
+	if hours <= 0 {
+		return 0
+	}
+	return spend / hours
+}
+
+// highest spend first, then by name
+func sortOrgUnits(units []OrgUnit) {
+	sort.Slice(units, func(i, j int) bool {
+		if units[i].Spend != units[j].Spend {
+			return units[i].Spend > units[j].Spend
+		}
+		return units[i].Name < units[j].Name
+	})
+}
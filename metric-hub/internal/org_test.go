@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/savings"
+)
+
+func TestOrgReportRollsUpTeamsAndDepartments(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(eventType string, v interface{}) Event {
+		data, _ := json.Marshal(v)
+		return Event{Type: eventType, Time: base, Data: data}
+	}
+	payload := func(ns string, name string, usage float64, labels map[string]string) CostPayload {
+		return CostPayload{
+			Namespace:   ns,
+			ClusterInfo: ClusterInfo{Cost: 1},
+			Deployments: []CostDeployment{{
+				Name:            name,
+				CurrentRequests: Resources{CPUCores: 1, MemoryMB: 100},
+				CurrentUsage:    Resources{CPUCores: usage, MemoryMB: 100 * usage},
+				Labels:          labels,
+			}},
+		}
+	}
+
+	events := []Event{
+		event(EventCostPayload, payload("shop", "cart", 1, map[string]string{LabelTeam: "payments"})),
+		event(EventCostPayload, payload("batch", "etl", 0.5, nil)),
+		event(EventCostPayload, payload("tmp", "app", 1, nil)),
+		event(EventJobPublished, NewDeploymentJob("High CPU Waste", "shop", CostDeployment{Name: "cart"}, ClusterInfo{})),
+	}
+	chart := OrgChart{
+		Owners: map[string]Ownership{"batch": {Team: "data"}, "tmp": {Department: "platform"}},
+		Teams:  map[string]OrgTeam{"payments": {Department: "commerce"}, "data": {Department: "commerce"}},
+	}
+	realised := map[string]savings.Entry{
+		"shop/cart":  {Realised: 10, HourlySavings: 0.5},
+		"legacy/old": {Realised: 5},
+	}
+
+	r := BuildOrgReport(events, realised, chart, base, base.Add(2*time.Hour))
+	if len(r.Departments) != 3 {
+		t.Fatalf("expected 3 departments, got %+v", r.Departments)
+	}
+
+	commerce := r.Departments[0]
+	if commerce.Name != "commerce" || commerce.Spend != 4 || commerce.AvgHourlyCost != 2 || commerce.Deployments != 2 {
+		t.Errorf("unexpected commerce rollup %+v", commerce)
+	}
+	if commerce.Triggers != 1 || commerce.Savings != 10 || commerce.HourlySavings != 0.5 {
+		t.Errorf("expected the cart's trigger and savings in commerce, got %+v", commerce)
+	}
+	if len(commerce.Teams) != 2 || commerce.Teams[0].Name != "data" || commerce.Teams[1].Name != "payments" || commerce.Teams[1].Savings != 10 {
+		t.Errorf("unexpected commerce teams %+v", commerce.Teams)
+	}
+
+	// an owner's department wins, its team stays unassigned
+	if platform := r.Departments[1]; platform.Name != "platform" || platform.Spend != 2 || platform.Teams[0].Name != OrgUnassigned {
+		t.Errorf("unexpected platform rollup %+v", platform)
+	}
+	if unassigned := r.Departments[2]; unassigned.Name != OrgUnassigned || unassigned.Savings != 5 || unassigned.Spend != 0 {
+		t.Errorf("expected savings of unreported deployments unassigned, got %+v", unassigned)
+	}
+	if r.Total.Spend != 6 || r.Total.Waste != 1 || r.Total.Savings != 15 || r.Total.Deployments != 4 {
+		t.Errorf("unexpected total %+v", r.Total)
+	}
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// forecasts are for the next 24h, older orphans are no longer meaningful
+const OrphanForecastTTL = 24 * time.Hour
+
+// Forecast for a deployment the cost engine has not reported yet
+type OrphanForecast struct {
+	Namespace  string             `json:"namespace"`
+	ReceivedAt time.Time          `json:"received_at"`
+	Deployment ForecastDeployment `json:"deployment"`
+}
+
+func orphanKey(ns string, name string) string {
+	return fmt.Sprintf("forecast:orphan:%s:%s", ns, name)
+}
+
+// Persist a forecast whose deployment is missing from cost:latest
+// Key - forecast:orphan:<namespace>:<deployment name>
+// Value - <orphan forecast>, expires after 24h
+func (a *Aggregator) saveOrphanForecast(ctx context.Context, ns string, f ForecastDeployment) {
+	jsonData, err := a.Migrations.Encode(OrphanForecastKind, OrphanForecast{
+		Namespace:  ns,
+		ReceivedAt: a.now(),
+		Deployment: f,
+	})
+	if err != nil {
+		fmt.Printf("Failed to marshal orphan forecast %v\n", err)
+		return
+	}
+
+	if err := a.Client.Set(ctx, orphanKey(ns, f.Name), jsonData, OrphanForecastTTL).Err(); err != nil {
+		fmt.Printf("Failed to save orphan forecast for %s: %v\n", f.Name, err)
+		return
+	}
+	fmt.Printf("Stored orphan forecast for %s until it appears in a cost payload\n", f.Name)
+}
+
+// Evaluate stored orphan forecasts for deployments that now appear in the cost payload
+func (a *Aggregator) CheckOrphanForecasts(ctx context.Context, p *CostPayload) {
+	if len(p.Deployments) == 0 {
+		return
+	}
+
+	keys := make([]string, len(p.Deployments))
+	for i, d := range p.Deployments {
+		keys[i] = orphanKey(p.Namespace, d.Name)
+	}
+
+	values, err := a.Client.MGet(ctx, keys...).Result()
+	if err != nil && err != redis.Nil {
+		fmt.Printf("Failed to load orphan forecasts %v\n", err)
+		return
+	}
+
+	policy := a.ActivePolicy(ctx)
+	sensitivity := a.loadSensitivity(ctx)
+	scripts := a.loadScripts(ctx)
+	for i, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		// orphans are deleted once read, no need to write back upgrades
+		var orphan OrphanForecast
+		if _, err := a.Migrations.Decode(OrphanForecastKind, []byte(raw), &orphan); err != nil {
+			fmt.Printf("Failed to unmarshal orphan forecast %v\n", err)
+			continue
+		}
+
+		fmt.Printf("Deployment %s first reported, evaluating stored forecast\n", p.Deployments[i].Name)
+		unlock := a.Locks.Lock(deploymentLockKey(p.Namespace, p.Deployments[i].Name))
+		a.evaluateForecastLogic(ctx, orphan.Deployment, p.Deployments[i], p.Namespace, p.ClusterInfo, sensitivity.Apply(p.Namespace, p.Deployments[i].Name, policy), scripts)
+		unlock()
+
+		// each orphan is evaluated once
+		a.Client.Del(ctx, keys[i])
+	}
+}
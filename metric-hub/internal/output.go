@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// How agents should deliver deployment changes
+const (
+	// patch the live manifest or the GitOps source
+	OutputPatch = "patch"
+	// write a Terraform variable override file, for workloads Terraform manages
+	OutputTfvars = "tfvars"
+)
+
+// Output format by namespace, so the optimiser doesn't fight IaC over the same fields
+type OutputPolicy struct {
+	// format for namespaces without their own, patch when empty
+	Default string `json:"default,omitempty" validate:"omitempty,oneof=patch tfvars"`
+	// namespace -> format
+	Namespaces map[string]string `json:"namespaces,omitempty" validate:"omitempty,dive,oneof=patch tfvars"`
+	// override file written for tfvars output, {namespace} and {name} are replaced
+	TfvarsFile string `json:"tfvars_file,omitempty"`
+}
+
+const defaultTfvarsFile = "terraform/{namespace}/metric-hub.auto.tfvars"
+
+func (o OutputPolicy) For(ns string) string {
+	if format, ok := o.Namespaces[ns]; ok {
+		return format
+	}
+	if o.Default != "" {
+		return o.Default
+	}
+	return OutputPatch
+}
+
+// Rendered change for agents that must not patch live objects
+type JobOutput struct {
+	Format string `json:"format"`
+	// file the content belongs in, relative to the IaC repository
+	File string `json:"file"`
+	// variable the content sets, so agents can replace just that block
+	Variable string `json:"variable"`
+	Content  string `json:"content"`
+}
+
+// Output for a deployment job under the policy, nil for patch output or jobs without a recommendation
+func (o OutputPolicy) Render(job AgentJob) *JobOutput {
+	if job.Recommendation == nil || o.For(job.Namespace) != OutputTfvars {
+		return nil
+	}
+	rec := job.Recommendation
+	file := o.TfvarsFile
+	if file == "" {
+		file = defaultTfvarsFile
+	}
+	file = strings.NewReplacer("{namespace}", rec.Namespace, "{name}", rec.Name).Replace(file)
+
+	variable := tfIdentifier(rec.Name) + "_resources"
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s/%s: %s, set by metric-hub\n", rec.Namespace, rec.Name, job.Reason)
+	fmt.Fprintf(&b, "%s = {\n", variable)
+	b.WriteString("  requests = {\n")
+	cpu, memory := quantities(rec.Requests)
+	fmt.Fprintf(&b, "    cpu    = %q\n", cpu)
+	fmt.Fprintf(&b, "    memory = %q\n", memory)
+	b.WriteString("  }\n")
+	if limits := rec.limitQuantities(); len(limits) > 0 {
+		b.WriteString("  limits = {\n")
+		for _, name := range []string{"cpu", "memory"} {
+			if v, ok := limits[name]; ok {
+				fmt.Fprintf(&b, "    %-6s = %q\n", name, v)
+			}
+		}
+		b.WriteString("  }\n")
+	}
+	b.WriteString("}\n")
+
+	return &JobOutput{Format: OutputTfvars, File: file, Variable: variable, Content: b.String()}
+}
+
+// Terraform identifiers can't contain dashes or dots
+func tfIdentifier(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputPolicyForNamespace(t *testing.T) {
+	o := OutputPolicy{Namespaces: map[string]string{"infra": OutputTfvars}}
+	if got := o.For("infra"); got != OutputTfvars {
+		t.Errorf("expected tfvars for infra, got %s", got)
+	}
+	if got := o.For("default"); got != OutputPatch {
+		t.Errorf("expected patch by default, got %s", got)
+	}
+	o.Default = OutputTfvars
+	o.Namespaces["apps"] = OutputPatch
+	if got := o.For("apps"); got != OutputPatch {
+		t.Errorf("expected the namespace to override the default, got %s", got)
+	}
+}
+
+func TestRenderTfvarsOverride(t *testing.T) {
+	job := AgentJob{
+		Reason:    "High Memory Waste",
+		Namespace: "infra",
+		Recommendation: &Recommendation{
+			Namespace: "infra",
+			Name:      "cart-service",
+			Requests:  Resources{CPUCores: 0.2504, MemoryMB: 255.2},
+		},
+	}
+	if out := (OutputPolicy{}).Render(job); out != nil {
+		t.Errorf("expected no output for patch namespaces, got %+v", out)
+	}
+
+	out := OutputPolicy{Default: OutputTfvars, TfvarsFile: "envs/{namespace}/{name}.auto.tfvars"}.Render(job)
+	if out == nil {
+		t.Fatal("expected tfvars output")
+	}
+	if out.File != "envs/infra/cart-service.auto.tfvars" || out.Variable != "cart_service_resources" {
+		t.Errorf("unexpected file or variable %s %s", out.File, out.Variable)
+	}
+	for _, want := range []string{"cart_service_resources = {", `cpu    = "251m"`, `memory = "256Mi"`} {
+		if !strings.Contains(out.Content, want) {
+			t.Errorf("expected %q in\n%s", want, out.Content)
+		}
+	}
+
+	job.Recommendation = nil
+	if out := (OutputPolicy{Default: OutputTfvars}).Render(job); out != nil {
+		t.Errorf("expected no output without a recommendation, got %+v", out)
+	}
+}
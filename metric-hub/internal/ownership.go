@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const OwnersKey = "owners"
+
+// Labels a cost payload may carry per deployment, usually copied from the deployment's labels or annotations
+const (
+	LabelTeam         = "team"
+	LabelSlackChannel = "slack-channel"
+	LabelOnCall       = "oncall"
+	LabelDepartment   = "department"
+)
+
+// Team responsible for a deployment, sent with its jobs and notifications
+type Ownership struct {
+	Team         string `json:"team,omitempty"`
+	SlackChannel string `json:"slack_channel,omitempty"`
+	// rotation or person paged for the deployment
+	OnCall string `json:"oncall,omitempty"`
+	// department the team reports to, overriding the org mapping of the team
+	Department string `json:"department,omitempty"`
+}
+
+// fields set in o replace those in base
+func (base Ownership) merge(o Ownership) Ownership {
+	if o.Team != "" {
+		base.Team = o.Team
+	}
+	if o.SlackChannel != "" {
+		base.SlackChannel = o.SlackChannel
+	}
+	if o.OnCall != "" {
+		base.OnCall = o.OnCall
+	}
+	if o.Department != "" {
+		base.Department = o.Department
+	}
+	return base
+}
+
+func ownershipFromLabels(labels map[string]string) Ownership {
+	return Ownership{Team: labels[LabelTeam], SlackChannel: labels[LabelSlackChannel], OnCall: labels[LabelOnCall], Department: labels[LabelDepartment]}
+}
+
+// Notification labels for the owner, routes can match team
+func (o *Ownership) labels(labels map[string]string) map[string]string {
+	if o == nil {
+		return labels
+	}
+	for k, v := range map[string]string{"team": o.Team, "slack_channel": o.SlackChannel, "oncall": o.OnCall, "department": o.Department} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// Replace the owner of a namespace, or of one deployment when name is set
+// Key - owners
+// Field - <namespace> or <namespace>/<name>
+func (a *Aggregator) SaveOwner(ctx context.Context, ns string, name string, o *Ownership) error {
+	jsonData, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal owner: %w", err)
+	}
+	if err := a.Client.HSet(ctx, OwnersKey, ownerField(ns, name), jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) DeleteOwner(ctx context.Context, ns string, name string) error {
+	return a.Client.HDel(ctx, OwnersKey, ownerField(ns, name)).Err()
+}
+
+// Owners keyed by <namespace> or <namespace>/<name>
+func (a *Aggregator) ListOwners(ctx context.Context) (map[string]Ownership, error) {
+	raw, err := a.Client.HGetAll(ctx, OwnersKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owners %w", err)
+	}
+
+	owners := make(map[string]Ownership, len(raw))
+	for field, data := range raw {
+		var o Ownership
+		if err := json.Unmarshal([]byte(data), &o); err != nil {
+			fmt.Printf("Skipping invalid owner for %s: %v\n", field, err)
+			continue
+		}
+		owners[field] = o
+	}
+	return owners, nil
+}
+
+func ownerField(ns string, name string) string {
+	if name == "" {
+		return ns
+	}
+	return deploymentLockKey(ns, name)
+}
+
+// Owner of a deployment, nil when nothing names one
+// payload labels win over the deployment's mapping, which wins over the namespace's, field by field
+func (a *Aggregator) ownerOf(ctx context.Context, ns string, name string, labels map[string]string) *Ownership {
+	var o Ownership
+	mapped, err := a.Client.HMGet(ctx, OwnersKey, ns, deploymentLockKey(ns, name)).Result()
+	if err != nil && err != redis.Nil {
+		fmt.Printf("Failed to load owners %v\n", err)
+	}
+	for _, v := range mapped {
+		var m Ownership
+		if s, ok := v.(string); ok && json.Unmarshal([]byte(s), &m) == nil {
+			o = o.merge(m)
+		}
+	}
+	o = o.merge(ownershipFromLabels(labels))
+	if o == (Ownership{}) {
+		return nil
+	}
+	return &o
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+)
+
+// RFC 6902 operation
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// cpu rounded up to the millicore, memory to the MiB, as the admission webhook writes them
+func quantities(r Resources) (cpu string, memory string) {
+	return fmt.Sprintf("%dm", int64(math.Ceil(r.CPUCores*1000))), fmt.Sprintf("%dMi", int64(math.Ceil(r.MemoryMB)))
+}
+
+// recommended limits as quantities, a resource left without a limit is omitted
+func (r *Recommendation) limitQuantities() map[string]string {
+	if r.Limits == nil {
+		return nil
+	}
+	cpu, memory := quantities(*r.Limits)
+	limits := map[string]string{}
+	if r.Limits.CPUCores > 0 {
+		limits["cpu"] = cpu
+	}
+	if r.Limits.MemoryMB > 0 {
+		limits["memory"] = memory
+	}
+	return limits
+}
+
+// JSON Patch setting the recommended requests, and limits when recommended, on the container at index
+// add rather than replace, so the patch applies whether or not the request is already set
+func (r *Recommendation) JSONPatch(index int) []PatchOp {
+	cpu, memory := quantities(r.Requests)
+	path := fmt.Sprintf("/spec/template/spec/containers/%d/resources", index)
+	ops := []PatchOp{
+		{Op: "add", Path: path + "/requests/cpu", Value: cpu},
+		{Op: "add", Path: path + "/requests/memory", Value: memory},
+	}
+	limits := r.limitQuantities()
+	for _, name := range []string{"cpu", "memory"} {
+		if v, ok := limits[name]; ok {
+			ops = append(ops, PatchOp{Op: "add", Path: path + "/limits/" + name, Value: v})
+		}
+	}
+	return ops
+}
+
+// Strategic merge patch setting the recommended requests on the named container
+// containers merge by name, other containers and resources are left alone
+func (r *Recommendation) StrategicMergePatch(container string) map[string]interface{} {
+	cpu, memory := quantities(r.Requests)
+	resources := map[string]interface{}{"requests": map[string]string{"cpu": cpu, "memory": memory}}
+	if limits := r.limitQuantities(); len(limits) > 0 {
+		resources["limits"] = limits
+	}
+	return map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []map[string]interface{}{{
+						"name":      container,
+						"resources": resources,
+					}},
+				},
+			},
+		},
+	}
+}
@@ -7,11 +7,69 @@ type Resources struct {
 	MemoryMB float64 `json:"memory_mb" validate:"required,gt=0"`
 }
 
+// Usage over the collection window, each statistic is optional
+type UsageStats struct {
+	Avg *Resources `json:"avg,omitempty"`
+	P95 *Resources `json:"p95,omitempty"`
+	Max *Resources `json:"max,omitempty"`
+}
+
 type CostDeployment struct {
-	Name            string     `json:"name" validate:"required"`
-	CurrentRequests Resources  `json:"current_requests" validate:"required"`
-	CurrentUsage    Resources  `json:"current_usage" validate:"required"`
-	PredictPeak24h  *Resources `json:"predicted_peak_24h,omitempty"`
+	Name string `json:"name" validate:"required"`
+	// left out, or 0, for a resource the deployment sets no request for, checked by validateRequests
+	CurrentRequests Resources `json:"current_requests" validate:"-"`
+	CurrentUsage    Resources `json:"current_usage" validate:"required"`
+	// nil when the producer doesn't report limits, 0 for a resource without a limit
+	CurrentLimits  *ResourceBounds `json:"current_limits,omitempty"`
+	PredictPeak24h *Resources      `json:"predicted_peak_24h,omitempty"`
+	// usage statistics over the collection window, waste is judged on p95 and risk on max when given
+	UsageStats *UsageStats `json:"usage_stats,omitempty"`
+	// optional traffic and latency inputs for efficiency metrics
+	RequestRate  float64 `json:"request_rate_rps,omitempty" validate:"gte=0"`
+	LatencyP95Ms float64 `json:"latency_p95_ms,omitempty" validate:"gte=0"`
+	LatencySLOMs float64 `json:"latency_slo_ms,omitempty" validate:"gte=0"`
+	// domain metrics (queue lag, gpu memory) validated against registered schemas
+	CustomMetrics map[string]float64 `json:"custom_metrics,omitempty"`
+	// PodDisruptionBudget covering the deployment's pods, if any
+	PDB *PodDisruptionBudget `json:"pdb,omitempty"`
+	// KEDA ScaledObject managing the deployment's replicas, if any
+	Keda *KedaScaling `json:"keda,omitempty"`
+	// Argo CD Application or Helm release the deployment is synced from, if any
+	Owner *GitOpsOwner `json:"owner,omitempty"`
+	// owner labels such as team, slack-channel and oncall, see Ownership
+	Labels map[string]string `json:"labels,omitempty"`
+	// generation and rollout state, triggers are held while it rolls out
+	Rollout *Rollout `json:"rollout,omitempty"`
+}
+
+// Status of the PodDisruptionBudget selecting a deployment
+// min_available and max_unavailable keep the spec form, a count or a percentage
+type PodDisruptionBudget struct {
+	Name               string `json:"name" validate:"required"`
+	MinAvailable       string `json:"min_available,omitempty"`
+	MaxUnavailable     string `json:"max_unavailable,omitempty"`
+	DisruptionsAllowed int    `json:"disruptions_allowed" validate:"gte=0"`
+}
+
+// Owner kinds
+const (
+	OwnerArgoCD = "argocd"
+	OwnerHelm   = "helm"
+)
+
+// Where a deployment's manifest comes from, changes made anywhere else are reverted by the next sync
+// repo_url, path and target_revision follow the Argo CD Application source
+type GitOpsOwner struct {
+	Kind string `json:"kind" validate:"required,oneof=argocd helm"`
+	// Application or release name
+	Name      string `json:"name" validate:"required"`
+	Namespace string `json:"namespace,omitempty"`
+	RepoURL   string `json:"repo_url,omitempty"`
+	// directory of the manifests in the repo
+	Path           string `json:"path,omitempty"`
+	TargetRevision string `json:"target_revision,omitempty"`
+	// helm values file, relative to path, that sets the deployment's resources
+	ValuesFile string `json:"values_file,omitempty"`
 }
 
 type ForecastDeployment struct {
@@ -24,22 +82,170 @@ type ClusterInfo struct {
 	Cost    float64 `json:"current_hourly_cost" validate:"required,gt=0"`
 }
 
+// Aggregate capacity of a group of identical nodes
+type NodeGroup struct {
+	Name              string    `json:"name" validate:"required"`
+	InstanceType      string    `json:"instance_type" validate:"required"`
+	NodeCount         int       `json:"node_count" validate:"required,gt=0"`
+	NodeCapacity      Resources `json:"node_capacity" validate:"required"`
+	HourlyCostPerNode float64   `json:"hourly_cost_per_node" validate:"gte=0"`
+	Requested         Resources `json:"requested" validate:"required"`
+	Used              Resources `json:"used" validate:"required"`
+}
+
+// Resource amounts where 0 leaves the value unset
+type ResourceBounds struct {
+	CPUCores float64 `json:"cpu_cores,omitempty" validate:"gte=0"`
+	MemoryMB float64 `json:"memory_mb,omitempty" validate:"gte=0"`
+}
+
+// Per-container min and max from the namespace LimitRange
+type LimitRange struct {
+	Min ResourceBounds `json:"min"`
+	Max ResourceBounds `json:"max"`
+}
+
+// requests.cpu and requests.memory from the namespace ResourceQuota
+type ResourceQuota struct {
+	Hard ResourceBounds `json:"hard"`
+	Used ResourceBounds `json:"used"`
+}
+
 type CostPayload struct {
-	Timestamp   time.Time        `json:"timestamp" validate:"required"`
-	Namespace   string           `json:"namespace" validate:"required,eq=default"`
-	ClusterInfo ClusterInfo      `json:"cluster_info" validate:"required"`
-	Deployments []CostDeployment `json:"deployments" validate:"required,min=1,dive"`
+	Source string `json:"source,omitempty"`
+	// starts a delta sequence, deltas continue from it
+	Sequence      int64            `json:"sequence,omitempty" validate:"gte=0"`
+	Timestamp     time.Time        `json:"timestamp" validate:"required"`
+	Namespace     string           `json:"namespace" validate:"required"`
+	ClusterInfo   ClusterInfo      `json:"cluster_info" validate:"required"`
+	Deployments   []CostDeployment `json:"deployments" validate:"required,min=1,dive"`
+	NodeGroups    []NodeGroup      `json:"node_groups,omitempty" validate:"omitempty,dive"`
+	LimitRange    *LimitRange      `json:"limit_range,omitempty"`
+	ResourceQuota *ResourceQuota   `json:"resource_quota,omitempty"`
 }
 
 type ForecastPayload struct {
+	Source      string               `json:"source,omitempty"`
 	Timestamp   time.Time            `json:"timestamp" validate:"required"`
-	Namespace   string               `json:"namespace" validate:"required,eq=default"`
+	Namespace   string               `json:"namespace" validate:"required"`
 	Deployments []ForecastDeployment `json:"deployments" validate:"required,min=1,dive"`
 }
 
+// What an agent job acts on
+type TargetType string
+
+const (
+	TargetDeployment TargetType = "deployment"
+	TargetNodeGroup  TargetType = "node-group"
+	TargetCluster    TargetType = "cluster"
+	// consolidation and instance-type hints for karpenter or the cluster autoscaler
+	TargetProvisioner TargetType = "node-provisioner"
+	// weekly scale-down windows for agents managing KEDA or other scheduled scalers
+	TargetSchedule TargetType = "schedule"
+)
+
+// What the agent may do with a job
+type JobAction string
+
+const (
+	// open a change for the recommendation
+	ActionApply JobAction = "apply"
+	// report only, applying would need a disruption the workload can't take
+	ActionNotifyOnly JobAction = "notify_only"
+)
+
+// Deployment is set for deployment targets, NodeGroup for node group targets,
+// Provisioner for node provisioner targets, Deployment and Schedule for schedule targets
+// cluster targets only carry ClusterInfo
 type AgentJob struct {
-	Reason      string         `json:"reason" validate:"required"`
-	Namespace   string         `json:"namespace" validate:"required,eq=default"`
-	Deployment  CostDeployment `json:"deployments"`
-	ClusterInfo ClusterInfo    `json:"cluster_info"`
+	TargetType  TargetType               `json:"target_type" validate:"required,oneof=deployment node-group cluster node-provisioner schedule"`
+	Action      JobAction                `json:"action"`
+	Reason      string                   `json:"reason" validate:"required"`
+	Namespace   string                   `json:"namespace,omitempty" validate:"required_if=TargetType deployment"`
+	Deployment  *CostDeployment          `json:"deployments,omitempty" validate:"required_if=TargetType deployment"`
+	NodeGroup   *NodeGroupRecommendation `json:"node_group,omitempty" validate:"required_if=TargetType node-group"`
+	Provisioner *ProvisionerHint         `json:"provisioner,omitempty" validate:"required_if=TargetType node-provisioner"`
+	Schedule    *ScheduleRecommendation  `json:"schedule,omitempty" validate:"required_if=TargetType schedule"`
+	ClusterInfo ClusterInfo              `json:"cluster_info"`
+	Conditions  []Condition              `json:"conditions,omitempty"`
+	// namespace LimitRange and ResourceQuota any change must respect
+	Constraints *NamespaceConstraints `json:"constraints,omitempty"`
+	// hub recommendation, a patch should not go past its recommended requests
+	Recommendation *Recommendation `json:"recommendation,omitempty"`
+	// staged apply from the policy, agents without canary support apply at once
+	ApplyPlan *ApplyPlan `json:"apply_plan,omitempty"`
+	// rendered IaC change for namespaces whose policy output isn't patch
+	Output *JobOutput `json:"output,omitempty"`
+	// team owning the deployment, from payload labels or the owners mapping
+	Ownership *Ownership `json:"ownership,omitempty"`
+	// channels and approval from the matching routing rule
+	Routing *Routing `json:"routing,omitempty"`
+	// automation tier of a deployment change, stricter of it and the routing's approval applies
+	Automation *AutomationDecision `json:"automation,omitempty"`
+}
+
+func NewDeploymentJob(reason string, ns string, c CostDeployment, info ClusterInfo) AgentJob {
+	return AgentJob{
+		TargetType:  TargetDeployment,
+		Action:      deploymentAction(c),
+		Reason:      reason,
+		Namespace:   ns,
+		Deployment:  &c,
+		ClusterInfo: info,
+	}
+}
+
+// a resize rolls the pods, which a PDB allowing no disruptions would block
+func deploymentAction(c CostDeployment) JobAction {
+	if c.PDB != nil && c.PDB.DisruptionsAllowed == 0 {
+		return ActionNotifyOnly
+	}
+	return ActionApply
+}
+
+func NewNodeGroupJob(reason string, rec NodeGroupRecommendation, info ClusterInfo) AgentJob {
+	return AgentJob{
+		TargetType:  TargetNodeGroup,
+		Action:      ActionApply,
+		Reason:      reason,
+		NodeGroup:   &rec,
+		ClusterInfo: info,
+	}
+}
+
+func NewProvisionerJob(reason string, hint ProvisionerHint, info ClusterInfo) AgentJob {
+	return AgentJob{
+		TargetType:  TargetProvisioner,
+		Action:      ActionApply,
+		Reason:      reason,
+		Provisioner: &hint,
+		ClusterInfo: info,
+	}
+}
+
+func NewClusterJob(reason string, info ClusterInfo) AgentJob {
+	return AgentJob{
+		TargetType:  TargetCluster,
+		Action:      ActionApply,
+		Reason:      reason,
+		ClusterInfo: info,
+	}
+}
+
+// Usage waste is judged on, the window's p95 so a rare burst doesn't hide idle capacity
+// current_usage when the payload has no p95
+func (c CostDeployment) WasteUsage() Resources {
+	if c.UsageStats != nil && c.UsageStats.P95 != nil {
+		return *c.UsageStats.P95
+	}
+	return c.CurrentUsage
+}
+
+// Usage risk is judged on, the window's max so bursts count in full
+// current_usage when the payload has no max
+func (c CostDeployment) RiskUsage() Resources {
+	if c.UsageStats != nil && c.UsageStats.Max != nil {
+		return *c.UsageStats.Max
+	}
+	return c.CurrentUsage
 }
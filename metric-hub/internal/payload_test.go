@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeploymentJobActionFollowsPDB(t *testing.T) {
+	c := CostDeployment{Name: "payments"}
+	if job := NewDeploymentJob("High CPU Waste", "default", c, ClusterInfo{}); job.Action != ActionApply {
+		t.Errorf("expected apply without a PDB, got %q", job.Action)
+	}
+
+	c.PDB = &PodDisruptionBudget{Name: "payments", MinAvailable: "100%", DisruptionsAllowed: 0}
+	if job := NewDeploymentJob("High CPU Waste", "default", c, ClusterInfo{}); job.Action != ActionNotifyOnly {
+		t.Errorf("expected notify_only when no disruptions are allowed, got %q", job.Action)
+	}
+
+	c.PDB.DisruptionsAllowed = 1
+	if job := NewDeploymentJob("High CPU Waste", "default", c, ClusterInfo{}); job.Action != ActionApply {
+		t.Errorf("expected apply when a disruption is allowed, got %q", job.Action)
+	}
+}
+
+func TestDeploymentJobCarriesOwner(t *testing.T) {
+	c := CostDeployment{
+		Name:            "payments",
+		CurrentRequests: Resources{CPUCores: 1, MemoryMB: 512},
+		CurrentUsage:    Resources{CPUCores: 0.2, MemoryMB: 100},
+		Owner:           &GitOpsOwner{Kind: OwnerArgoCD, Name: "boutique", RepoURL: "https://github.com/example/gitops", Path: "apps/payments"},
+	}
+	job := NewDeploymentJob("High CPU Waste", "default", c, ClusterInfo{VmCount: 1, Cost: 1})
+	if job.Deployment.Owner == nil || job.Deployment.Owner.Name != "boutique" {
+		t.Errorf("expected the owner in the job, got %+v", job.Deployment.Owner)
+	}
+
+	v := NewValidator()
+	p := &CostPayload{Timestamp: time.Now(), Namespace: "default", ClusterInfo: ClusterInfo{VmCount: 1, Cost: 1}, Deployments: []CostDeployment{c}}
+	if err := v.Validate(p); err != nil {
+		t.Errorf("expected a valid payload, got %v", err)
+	}
+	c.Owner.Kind = "flux"
+	p.Deployments[0] = c
+	if err := v.Validate(p); err == nil {
+		t.Errorf("expected an unknown owner kind to be rejected")
+	}
+}
+
+func TestWasteAndRiskUseWindowStatistics(t *testing.T) {
+	// current usage looks idle, the window shows it runs close to its memory request
+	d := CostDeployment{
+		Name:            "checkout",
+		CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000},
+		CurrentUsage:    Resources{CPUCores: 0.6, MemoryMB: 200},
+	}
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != "High Memory Waste" {
+		t.Errorf("expected memory waste from current usage alone, got %q", reason)
+	}
+
+	d.UsageStats = &UsageStats{
+		P95: &Resources{CPUCores: 0.7, MemoryMB: 600},
+		Max: &Resources{CPUCores: 0.8, MemoryMB: 950},
+	}
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != "High Memory Risk" {
+		t.Errorf("expected memory risk from the window max, got %q", reason)
+	}
+	if got := RecommendRequests(d).MemoryMB; got != 950*RecommendationHeadroom {
+		t.Errorf("expected the recommendation to cover the max, got %v", got)
+	}
+
+	d.UsageStats.Max = nil
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != "" {
+		t.Errorf("expected no trigger when p95 shows no waste, got %q", reason)
+	}
+}
+
+func TestDeploymentWithoutRequestsIsClassified(t *testing.T) {
+	d := CostDeployment{Name: "emailservice", CurrentUsage: Resources{CPUCores: 0.2, MemoryMB: 100}}
+	v := NewValidator()
+	p := &CostPayload{Timestamp: time.Now(), Namespace: "default", ClusterInfo: ClusterInfo{VmCount: 1, Cost: 1}, Deployments: []CostDeployment{d}}
+	if err := v.Validate(p); err != nil {
+		t.Fatalf("expected a deployment without requests to be valid, got %v", err)
+	}
+	p.Deployments[0].CurrentRequests.MemoryMB = -1
+	if err := v.Validate(p); err == nil {
+		t.Errorf("expected a negative request to be rejected")
+	}
+
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != ReasonNoRequests {
+		t.Errorf("expected %q, got %q", ReasonNoRequests, reason)
+	}
+	// initial requests are observed usage plus headroom, rounded, with nothing to step from
+	target, step := Recommend(d, DefaultPolicy(), nil)
+	if target != step || target.CPUCores != 0.3 || target.MemoryMB != 192 {
+		t.Errorf("expected 0.3 cores and 192MB at once, got target %+v step %+v", target, step)
+	}
+
+	// only the memory request is set
+	d.CurrentRequests.MemoryMB = 512
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != ReasonNoRequests {
+		t.Errorf("expected %q with the cpu request unset, got %q", ReasonNoRequests, reason)
+	}
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{FamilyNoRequests: false}); reason != "" {
+		t.Errorf("expected no reason with no_requests disabled, got %q", reason)
+	}
+}
+
+func TestLimitsAreEvaluatedWithRequests(t *testing.T) {
+	d := CostDeployment{
+		Name:          "emailservice",
+		CurrentUsage:  Resources{CPUCores: 0.2, MemoryMB: 100},
+		CurrentLimits: &ResourceBounds{CPUCores: 1, MemoryMB: 1024},
+	}
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != ReasonLimitsWithoutRequests {
+		t.Errorf("expected %q, got %q", ReasonLimitsWithoutRequests, reason)
+	}
+	// requests from usage, the limits already set are kept
+	rec := newRecommendation("default", d, DefaultPolicy(), nil)
+	if rec.Requests.CPUCores != 0.3 || rec.Requests.MemoryMB != 192 || rec.Limits == nil || *rec.Limits != (Resources{CPUCores: 1, MemoryMB: 1024}) {
+		t.Errorf("expected 0.3 cores and 192MB limited to 1 core and 1024MB, got %+v limits %+v", rec.Requests, rec.Limits)
+	}
+	patch := rec.JSONPatch(0)
+	if len(patch) != 4 || patch[3].Path != "/spec/template/spec/containers/0/resources/limits/memory" || patch[3].Value != "1024Mi" {
+		t.Errorf("expected the patch to set limits, got %+v", patch)
+	}
+
+	// memory requested but not limited, the cpu limit keeps its ratio and memory gets the default one
+	d.CurrentRequests = Resources{CPUCores: 0.5, MemoryMB: 256}
+	d.CurrentLimits = &ResourceBounds{CPUCores: 1}
+	d.CurrentUsage = Resources{CPUCores: 0.3, MemoryMB: 150}
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{}); reason != ReasonNoMemoryLimit {
+		t.Errorf("expected %q, got %q", ReasonNoMemoryLimit, reason)
+	}
+	if reason := costTriggerReason(context.Background(), d, DefaultPolicy(), Ruleset{}, Flags{FamilyLimits: false}); reason != "" {
+		t.Errorf("expected no reason with limits disabled, got %q", reason)
+	}
+	rec = newRecommendation("default", d, DefaultPolicy(), nil)
+	if rec.Limits == nil || rec.Limits.CPUCores != rec.Requests.CPUCores*2 || rec.Limits.MemoryMB != rec.Requests.MemoryMB*DefaultLimitRatio {
+		t.Errorf("expected limits twice the requests %+v, got %+v", rec.Requests, rec.Limits)
+	}
+
+	// no cpu limit is added where there is none
+	d.CurrentLimits = &ResourceBounds{MemoryMB: 512}
+	if rec = newRecommendation("default", d, DefaultPolicy(), nil); rec.Limits.CPUCores != 0 {
+		t.Errorf("expected cpu to stay unlimited, got %+v", rec.Limits)
+	}
+
+	v := NewValidator()
+	d.CurrentLimits = &ResourceBounds{MemoryMB: 128}
+	p := &CostPayload{Timestamp: time.Now(), Namespace: "default", ClusterInfo: ClusterInfo{VmCount: 1, Cost: 1}, Deployments: []CostDeployment{d}}
+	if err := v.Validate(p); err == nil {
+		t.Errorf("expected a limit below its request to be rejected")
+	}
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/redis/go-redis/v9"
+	"sigs.k8s.io/yaml"
+)
+
+const ActivePolicyKey = "policy:active"
+
+// Thresholds driving trigger evaluation
+// ratios are fractions of the current request
+type Policy struct {
+	MemoryWaste     float64 `json:"memory_waste" validate:"gt=0,lte=1"`
+	MemoryRisk      float64 `json:"memory_risk" validate:"gt=0"`
+	CPUWaste        float64 `json:"cpu_waste" validate:"gt=0,lte=1"`
+	CPURisk         float64 `json:"cpu_risk" validate:"gt=0"`
+	CooldownSeconds int64   `json:"cooldown_seconds" validate:"gte=0"`
+	// cost payloads only collected, never triggered on, after a deployment first appears or a replica starts
+	WarmupSamples int `json:"warmup_samples" validate:"gte=0"`
+	// cost triggers held this long after a rollout starts, and for as long as it runs
+	RolloutGraceSeconds int64 `json:"rollout_grace_seconds" validate:"gte=0"`
+
+	ForecastRisk      float64 `json:"forecast_risk" validate:"gt=0"`
+	ForecastDownscale float64 `json:"forecast_downscale" validate:"gt=0"`
+	ForecastWasteMin  float64 `json:"forecast_waste_min" validate:"gt=0,lte=1"`
+
+	// admission rejects requests more than this multiple of the recommendation, 0 disables
+	AdmissionMaxRatio float64 `json:"admission_max_ratio" validate:"gte=0"`
+
+	// steps recommended requests are rounded to
+	Rounding Rounding `json:"rounding"`
+	// largest change recommended in a single action
+	MaxChange ChangeLimit `json:"max_change"`
+	// reaction to rolled back or degraded changes
+	Rollback RollbackPolicy `json:"rollback"`
+	// staged apply plan sent with deployment jobs
+	Canary CanaryPolicy `json:"canary"`
+	// cluster wide cost and node count changes
+	Anomaly AnomalyPolicy `json:"anomaly"`
+	// weekly quiet windows suggested for scheduled scaling
+	Schedule SchedulePolicy `json:"schedule"`
+	// how agents deliver deployment changes, per namespace
+	Output OutputPolicy `json:"output"`
+	// tiers deciding which deployment changes are applied without review
+	Automation AutomationPolicy `json:"automation"`
+}
+
+// Thresholds the hub has always used
+func DefaultPolicy() Policy {
+	return Policy{
+		MemoryWaste:         0.5,
+		MemoryRisk:          0.85,
+		CPUWaste:            0.5,
+		CPURisk:             0.85,
+		CooldownSeconds:     1800,
+		RolloutGraceSeconds: 900,
+		ForecastRisk:        0.9,
+		ForecastDownscale:   0.6,
+		ForecastWasteMin:    0.4,
+		AdmissionMaxRatio:   5,
+		Rounding:            DefaultRounding(),
+		MaxChange:           DefaultChangeLimit(),
+		Rollback:            DefaultRollbackPolicy(),
+		Anomaly:             DefaultAnomalyPolicy(),
+		Schedule:            DefaultSchedulePolicy(),
+		Automation:          DefaultAutomationPolicy(),
+	}
+}
+
+// Active policy, falling back to the defaults when none is stored
+func (a *Aggregator) ActivePolicy(ctx context.Context) Policy {
+	if p, ok := a.Cache.Get(ActivePolicyKey); ok {
+		return p.(Policy)
+	}
+	raw, err := a.Client.Get(ctx, ActivePolicyKey).Result()
+	if err == redis.Nil {
+		a.Cache.Set(ActivePolicyKey, DefaultPolicy())
+		return DefaultPolicy()
+	} else if err != nil {
+		fmt.Printf("Failed to load policy, using defaults %v\n", err)
+		return DefaultPolicy()
+	}
+
+	policy := DefaultPolicy()
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		fmt.Printf("Invalid stored policy, using defaults %v\n", err)
+		return DefaultPolicy()
+	}
+	a.Cache.Set(ActivePolicyKey, policy)
+	return policy
+}
+
+// Replace the active policy
+// Key - policy:active
+func (a *Aggregator) SavePolicy(ctx context.Context, p *Policy) error {
+	jsonData, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal policy: %w", err)
+	}
+	if err := a.Client.Set(ctx, ActivePolicyKey, jsonData, 0).Err(); err != nil {
+		return fmt.Errorf("[Failed] SET redis: %w", err)
+	}
+	a.Cache.Delete(ActivePolicyKey)
+	a.recordEvent(ctx, EventPolicyChanged, p)
+	return nil
+}
+
+// Policy from a YAML or JSON document, fields left out keep their default values
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := DefaultPolicy()
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+	if err := NewValidator().Validate(&policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// Make a policy document from a ConfigMap or Secret the active policy
+func (a *Aggregator) ApplyPolicyDocument(ctx context.Context, data []byte) error {
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return err
+	}
+	return a.ApplyPolicy(ctx, policy)
+}
+
+// Save the policy unless it is already active
+// so every replica can apply the same configured policy without repeated policy_changed events
+func (a *Aggregator) ApplyPolicy(ctx context.Context, p *Policy) error {
+	if reflect.DeepEqual(a.ActivePolicy(ctx), *p) {
+		return nil
+	}
+	return a.SavePolicy(ctx, p)
+}
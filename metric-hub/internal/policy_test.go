@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestParsePolicyKeepsDefaults(t *testing.T) {
+	policy, err := ParsePolicy([]byte("cpu_waste: 0.3\nrounding:\n  memory_step_mb: 128\n"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if policy.CPUWaste != 0.3 || policy.Rounding.MemoryStepMB != 128 {
+		t.Errorf("expected the document's values, got %+v", policy)
+	}
+	if policy.MemoryWaste != DefaultPolicy().MemoryWaste || policy.Rounding.CPUStepMillicores != DefaultRounding().CPUStepMillicores {
+		t.Errorf("expected defaults for fields left out, got %+v", policy)
+	}
+
+	if _, err := ParsePolicy([]byte(`{"cpu_waste": 0.3}`)); err != nil {
+		t.Errorf("expected JSON to parse, got %v", err)
+	}
+}
+
+func TestParsePolicyRejectsInvalid(t *testing.T) {
+	for _, doc := range []string{"cpu_waste: 2", "cpu_wast: 0.3", "cpu_waste: [1]"} {
+		if _, err := ParsePolicy([]byte(doc)); err == nil {
+			t.Errorf("expected %q to be rejected", doc)
+		}
+	}
+}
+
+func TestApplyPolicyDocumentRevertsAPIChanges(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := NewAggregator(mr.Addr(), "", "")
+	defer a.Client.Close()
+	ctx := context.Background()
+	doc := []byte("cpu_waste: 0.3\n")
+
+	if err := a.ApplyPolicyDocument(ctx, doc); err != nil {
+		t.Fatal(err)
+	}
+	changed := a.ActivePolicy(ctx)
+	changed.CPUWaste = 0.7
+	if err := a.SavePolicy(ctx, &changed); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same document again, compared with the active policy rather than the last document
+	if err := a.ApplyPolicyDocument(ctx, doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.ActivePolicy(ctx).CPUWaste; got != 0.3 {
+		t.Errorf("expected the document's cpu_waste back in force, got %v", got)
+	}
+	events, _ := a.ReadEvents(ctx, time.Time{}, time.Time{})
+	if len(events) != 3 {
+		t.Errorf("expected 3 policy changes, got %d", len(events))
+	}
+
+	if err := a.ApplyPolicyDocument(ctx, doc); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := a.ReadEvents(ctx, time.Time{}, time.Time{}); len(events) != 3 {
+		t.Errorf("expected an active policy not saved again, got %d events", len(events))
+	}
+}
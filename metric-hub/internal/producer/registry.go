@@ -0,0 +1,160 @@
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+const RegistryKey = "producers:registry"
+
+// Kind of payload a producer pushes
+const (
+	KindCost     = "cost"
+	KindForecast = "forecast"
+)
+
+// Declared identity and coverage of a producer
+type Registration struct {
+	Name         string   `json:"name"`
+	Kind         string   `json:"kind" validate:"required,oneof=cost forecast"`
+	PushInterval string   `json:"push_interval" validate:"required"`
+	Namespaces   []string `json:"namespaces" validate:"required,min=1"`
+}
+
+// Namespaces covered by more than one producer of a kind, or by only one kind
+type Coverage struct {
+	Overlapping map[string][]string `json:"overlapping"`
+	MissingCost []string            `json:"missing_cost"`
+	// namespaces with cost data but no forecaster
+	MissingForecast []string `json:"missing_forecast"`
+}
+
+// Register or replace a producer
+// Key - producers:registry
+// Field - <producer name>
+func (t *Tracker) Register(ctx context.Context, reg *Registration) error {
+	interval, err := time.ParseDuration(reg.PushInterval)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid push_interval %q", reg.PushInterval)
+	}
+
+	jsonData, err := json.Marshal(reg)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal registration: %w", err)
+	}
+	if err := t.Client.HSet(ctx, RegistryKey, reg.Name, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (t *Tracker) Unregister(ctx context.Context, name string) error {
+	return t.Client.HDel(ctx, RegistryKey, name).Err()
+}
+
+func (t *Tracker) Registrations(ctx context.Context) (map[string]Registration, error) {
+	raw, err := t.Client.HGetAll(ctx, RegistryKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get producer registry %w", err)
+	}
+
+	regs := make(map[string]Registration, len(raw))
+	for name, data := range raw {
+		var reg Registration
+		if err := json.Unmarshal([]byte(data), &reg); err != nil {
+			fmt.Printf("Skipping invalid registration %s: %v\n", name, err)
+			continue
+		}
+		regs[name] = reg
+	}
+	return regs, nil
+}
+
+// Check a payload against its producer's registration
+// unregistered producers are accepted so existing deployments keep working,
+// as are all payloads when the registry can't be read
+func (t *Tracker) ValidatePayload(ctx context.Context, name string, kind string, namespace string) error {
+	regs, err := t.Registrations(ctx)
+	if err != nil {
+		fmt.Printf("[Producers] skipping registration check %v\n", err)
+		return nil
+	}
+
+	reg, ok := regs[name]
+	if !ok {
+		return nil
+	}
+	if reg.Kind != kind {
+		return fmt.Errorf("producer %s is registered for %s payloads, not %s", name, reg.Kind, kind)
+	}
+	if !slices.Contains(reg.Namespaces, namespace) {
+		return fmt.Errorf("producer %s is not registered for namespace %s", name, namespace)
+	}
+	return nil
+}
+
+// Expected intervals from registrations, falling back to the defaults
+func (t *Tracker) intervals(ctx context.Context) map[string]time.Duration {
+	out := make(map[string]time.Duration, len(t.Intervals))
+	for name, d := range t.Intervals {
+		out[name] = d
+	}
+
+	regs, err := t.Registrations(ctx)
+	if err != nil {
+		fmt.Printf("[Producers] using default intervals %v\n", err)
+		return out
+	}
+	for name, reg := range regs {
+		if d, err := time.ParseDuration(reg.PushInterval); err == nil {
+			out[name] = d
+		}
+	}
+	return out
+}
+
+// Detect overlapping and missing coverage across registered producers
+func (t *Tracker) Coverage(ctx context.Context) (*Coverage, error) {
+	regs, err := t.Registrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// namespace -> kind -> producers
+	byNamespace := map[string]map[string][]string{}
+	for _, reg := range regs {
+		for _, ns := range reg.Namespaces {
+			if byNamespace[ns] == nil {
+				byNamespace[ns] = map[string][]string{}
+			}
+			byNamespace[ns][reg.Kind] = append(byNamespace[ns][reg.Kind], reg.Name)
+		}
+	}
+
+	cov := &Coverage{
+		Overlapping:     map[string][]string{},
+		MissingCost:     []string{},
+		MissingForecast: []string{},
+	}
+	for ns, kinds := range byNamespace {
+		for kind, names := range kinds {
+			if len(names) > 1 {
+				sort.Strings(names)
+				cov.Overlapping[ns+"/"+kind] = names
+			}
+		}
+		if len(kinds[KindCost]) == 0 {
+			cov.MissingCost = append(cov.MissingCost, ns)
+		}
+		if len(kinds[KindForecast]) == 0 {
+			cov.MissingForecast = append(cov.MissingForecast, ns)
+		}
+	}
+	sort.Strings(cov.MissingCost)
+	sort.Strings(cov.MissingForecast)
+	return cov, nil
+}
@@ -0,0 +1,88 @@
+package producer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestTracker(t *testing.T) (*Tracker, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewTracker(client, nil), mr
+}
+
+func TestRegisterRejectsInvalidInterval(t *testing.T) {
+	tracker, mr := newTestTracker(t)
+	ctx := context.Background()
+
+	for _, interval := range []string{"soon", "0s", "-5m"} {
+		reg := &Registration{Name: "kubecost", Kind: KindCost, PushInterval: interval, Namespaces: []string{"shop"}}
+		if err := tracker.Register(ctx, reg); err == nil {
+			t.Errorf("expected push_interval %q rejected", interval)
+		}
+	}
+	if mr.Exists(RegistryKey) {
+		t.Error("expected nothing registered")
+	}
+}
+
+func TestValidatePayloadByKindAndNamespace(t *testing.T) {
+	tracker, _ := newTestTracker(t)
+	ctx := context.Background()
+	reg := &Registration{Name: "kubecost", Kind: KindCost, PushInterval: "5m", Namespaces: []string{"shop", "payments"}}
+	if err := tracker.Register(ctx, reg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tracker.ValidatePayload(ctx, "kubecost", KindCost, "payments"); err != nil {
+		t.Errorf("expected a registered namespace accepted, got %v", err)
+	}
+	if err := tracker.ValidatePayload(ctx, "kubecost", KindForecast, "shop"); err == nil {
+		t.Error("expected a forecast from a cost producer rejected")
+	}
+	if err := tracker.ValidatePayload(ctx, "kubecost", KindCost, "default"); err == nil {
+		t.Error("expected a namespace the producer didn't register rejected")
+	}
+	// unregistered producers keep working
+	if err := tracker.ValidatePayload(ctx, CostEngine, KindCost, "default"); err != nil {
+		t.Errorf("expected an unregistered producer accepted, got %v", err)
+	}
+
+	if err := tracker.Unregister(ctx, "kubecost"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.ValidatePayload(ctx, "kubecost", KindCost, "default"); err != nil {
+		t.Errorf("expected an unregistered producer accepted, got %v", err)
+	}
+}
+
+func TestCoverageReportsOverlapsAndGaps(t *testing.T) {
+	tracker, _ := newTestTracker(t)
+	ctx := context.Background()
+	regs := []Registration{
+		{Name: "kubecost", Kind: KindCost, PushInterval: "5m", Namespaces: []string{"shop", "payments"}},
+		{Name: "opencost", Kind: KindCost, PushInterval: "10m", Namespaces: []string{"shop"}},
+		{Name: "prophet", Kind: KindForecast, PushInterval: "4h", Namespaces: []string{"shop", "search"}},
+	}
+	for _, reg := range regs {
+		if err := tracker.Register(ctx, &reg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cov, err := tracker.Coverage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"shop/cost": {"kubecost", "opencost"}}; !reflect.DeepEqual(cov.Overlapping, want) {
+		t.Errorf("expected %v overlapping, got %v", want, cov.Overlapping)
+	}
+	if !reflect.DeepEqual(cov.MissingCost, []string{"search"}) || !reflect.DeepEqual(cov.MissingForecast, []string{"payments"}) {
+		t.Errorf("expected search missing cost and payments missing a forecast, got %v %v", cov.MissingCost, cov.MissingForecast)
+	}
+}
@@ -0,0 +1,191 @@
+// Package producer tracks liveness of the services pushing metrics to the hub
+package producer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	LastSeenKey = "producers:last_seen"
+
+	CostEngine = "cost-engine"
+	Forecaster = "forecaster"
+)
+
+// How often each known producer is expected to push
+// the forecaster recalculates every 4 hours
+var DefaultIntervals = map[string]time.Duration{
+	CostEngine: 10 * time.Minute,
+	Forecaster: 4 * time.Hour,
+}
+
+// a producer is silent once it misses this many intervals
+const MissedIntervals = 2
+
+type Heartbeat struct {
+	Producer string `json:"producer" validate:"required"`
+}
+
+type Status struct {
+	Producer         string    `json:"producer"`
+	LastSeen         time.Time `json:"last_seen"`
+	ExpectedInterval string    `json:"expected_interval"`
+	Healthy          bool      `json:"healthy"`
+}
+
+type Tracker struct {
+	Client    *redis.Client
+	Notifier  notify.Notifier
+	Intervals map[string]time.Duration
+	// time source, the system clock when nil
+	Clock clock.Clock
+
+	mu     sync.Mutex
+	silent map[string]bool
+}
+
+func NewTracker(client *redis.Client, notifier notify.Notifier) *Tracker {
+	return &Tracker{
+		Client:    client,
+		Notifier:  notifier,
+		Intervals: DefaultIntervals,
+		silent:    make(map[string]bool),
+	}
+}
+
+// Record a push or heartbeat from a producer, at the hub's time so a producer's skewed clock can't hide its silence
+// Key - producers:last_seen
+// Field - <producer>, Value - unix timestamp
+func (t *Tracker) Seen(ctx context.Context, producer string) error {
+	at := clock.Now(t.Clock)
+	if err := t.Client.HSet(ctx, LastSeenKey, producer, at.Unix()).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	metrics.ProducerLastSeen.WithLabelValues(producer).Set(float64(at.Unix()))
+	return nil
+}
+
+func interval(intervals map[string]time.Duration, producer string) time.Duration {
+	if d, ok := intervals[producer]; ok {
+		return d
+	}
+	// unknown producers are checked against the cost engine interval
+	return DefaultIntervals[CostEngine]
+}
+
+// Status of every producer that has reported or is expected to
+func (t *Tracker) Statuses(ctx context.Context) ([]Status, error) {
+	raw, err := t.Client.HGetAll(ctx, LastSeenKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get producer status %w", err)
+	}
+
+	intervals := t.intervals(ctx)
+	names := map[string]bool{}
+	for name := range intervals {
+		names[name] = true
+	}
+	for name := range raw {
+		names[name] = true
+	}
+
+	now := clock.Now(t.Clock)
+	statuses := make([]Status, 0, len(names))
+	for name := range names {
+		st := Status{
+			Producer:         name,
+			ExpectedInterval: interval(intervals, name).String(),
+		}
+		if v, ok := raw[name]; ok {
+			if unix, err := strconv.ParseInt(v, 10, 64); err == nil {
+				st.LastSeen = time.Unix(unix, 0).UTC()
+			}
+		}
+		st.Healthy = !st.LastSeen.IsZero() && now.Sub(st.LastSeen) <= interval(intervals, name)*MissedIntervals
+		statuses = append(statuses, st)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Producer < statuses[j].Producer })
+	return statuses, nil
+}
+
+// Run checks producer liveness every interval and notifies on silence
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := t.Check(ctx); err != nil {
+			fmt.Printf("[Producers] liveness check failed %v\n", err)
+		}
+	}
+}
+
+// Check notifies once when a producer goes silent and again when it recovers
+func (t *Tracker) Check(ctx context.Context) error {
+	statuses, err := t.Statuses(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, st := range statuses {
+		healthy := 0.0
+		if st.Healthy {
+			healthy = 1
+		}
+		metrics.ProducerHealthy.WithLabelValues(st.Producer).Set(healthy)
+
+		// producers that never reported are not alerted on, they may not be deployed
+		if st.LastSeen.IsZero() {
+			continue
+		}
+
+		wasSilent := t.silent[st.Producer]
+		switch {
+		case !st.Healthy && !wasSilent:
+			t.silent[st.Producer] = true
+			t.notify(ctx, notify.SeverityWarning, fmt.Sprintf("Producer %s is silent", st.Producer),
+				fmt.Sprintf("No push since %s (expected every %s)", st.LastSeen.Format(time.RFC3339), st.ExpectedInterval), st.Producer)
+		case st.Healthy && wasSilent:
+			t.silent[st.Producer] = false
+			t.notify(ctx, notify.SeverityInfo, fmt.Sprintf("Producer %s recovered", st.Producer),
+				fmt.Sprintf("Last push at %s", st.LastSeen.Format(time.RFC3339)), st.Producer)
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) notify(ctx context.Context, sev notify.Severity, title string, msg string, producer string) {
+	if t.Notifier == nil {
+		return
+	}
+	err := t.Notifier.Notify(ctx, notify.Notification{
+		Severity:  sev,
+		Title:     title,
+		Message:   msg,
+		Labels:    map[string]string{"producer": producer},
+		Timestamp: clock.Now(t.Clock),
+	})
+	if err != nil {
+		fmt.Printf("[Producers] failed to send notification %v\n", err)
+	}
+}
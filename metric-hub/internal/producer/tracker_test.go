@@ -0,0 +1,97 @@
+package producer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+)
+
+type recordingNotifier struct {
+	sent []notify.Notification
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func TestSeenRecordsHubTime(t *testing.T) {
+	tracker, mr := newTestTracker(t)
+	now := time.Date(2025, 12, 22, 14, 0, 0, 0, time.UTC)
+	tracker.Clock = clock.NewFake(now)
+
+	if err := tracker.Seen(context.Background(), CostEngine); err != nil {
+		t.Fatal(err)
+	}
+	if got := mr.HGet(LastSeenKey, CostEngine); got != strconv.FormatInt(now.Unix(), 10) {
+		t.Errorf("expected last seen at %d, got %s", now.Unix(), got)
+	}
+}
+
+func TestStatusesUseExpectedIntervals(t *testing.T) {
+	tracker, _ := newTestTracker(t)
+	fake := clock.NewFake(time.Date(2025, 12, 22, 14, 0, 0, 0, time.UTC))
+	tracker.Clock = fake
+	ctx := context.Background()
+	reg := &Registration{Name: "kubecost", Kind: KindCost, PushInterval: "1m", Namespaces: []string{"shop"}}
+	if err := tracker.Register(ctx, reg); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{CostEngine, Forecaster, "kubecost"} {
+		if err := tracker.Seen(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// past two of kubecost's intervals and the cost engine's, inside the forecaster's
+	fake.Advance(25 * time.Minute)
+	statuses, err := tracker.Statuses(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthy := map[string]bool{}
+	for _, st := range statuses {
+		healthy[st.Producer] = st.Healthy
+	}
+	if len(healthy) != 3 || healthy[CostEngine] || !healthy[Forecaster] || healthy["kubecost"] {
+		t.Errorf("expected only the forecaster healthy, got %+v", statuses)
+	}
+}
+
+func TestCheckAlertsOnceOnSilenceAndRecovery(t *testing.T) {
+	tracker, _ := newTestTracker(t)
+	fake := clock.NewFake(time.Date(2025, 12, 22, 14, 0, 0, 0, time.UTC))
+	tracker.Clock = fake
+	notifier := &recordingNotifier{}
+	tracker.Notifier = notifier
+	ctx := context.Background()
+
+	if err := tracker.Seen(ctx, CostEngine); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.sent) != 0 {
+		t.Fatalf("expected no alert while pushes arrive, got %+v", notifier.sent)
+	}
+
+	fake.Advance(MissedIntervals*DefaultIntervals[CostEngine] + time.Minute)
+	tracker.Check(ctx)
+	tracker.Check(ctx)
+	if len(notifier.sent) != 1 || notifier.sent[0].Severity != notify.SeverityWarning || notifier.sent[0].Labels["producer"] != CostEngine {
+		t.Fatalf("expected one silence warning for the cost engine, got %+v", notifier.sent)
+	}
+
+	if err := tracker.Seen(ctx, CostEngine); err != nil {
+		t.Fatal(err)
+	}
+	tracker.Check(ctx)
+	if len(notifier.sent) != 2 || notifier.sent[1].Severity != notify.SeverityInfo {
+		t.Errorf("expected a recovery notice, got %+v", notifier.sent)
+	}
+}
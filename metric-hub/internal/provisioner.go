@@ -0,0 +1,115 @@
+package internal
+
+import "sort"
+
+// Node provisioners the hub can format hints for
+const (
+	ProvisionerKarpenter         = "karpenter"
+	ProvisionerClusterAutoscaler = "cluster-autoscaler"
+)
+
+// label karpenter and the cluster autoscaler select instance types by
+const InstanceTypeLabel = "node.kubernetes.io/instance-type"
+
+// An instance type able to hold a node group's requests
+type InstanceOption struct {
+	InstanceType string  `json:"instance_type"`
+	NodeCount    int     `json:"node_count"`
+	HourlyCost   float64 `json:"hourly_cost"`
+}
+
+// Consolidation and instance-type suggestions for a node provisioner
+// only the section for the configured provisioner is set
+type ProvisionerHint struct {
+	NodeGroup string `json:"node_group"`
+	// nodes of the current type that can be drained onto the rest
+	ConsolidatableNodes int `json:"consolidatable_nodes"`
+	// instance types that fit the requests, cheapest first
+	InstanceTypes     []InstanceOption         `json:"instance_types"`
+	Karpenter         *KarpenterHint           `json:"karpenter,omitempty"`
+	ClusterAutoscaler *ClusterAutoscalerHint   `json:"cluster_autoscaler,omitempty"`
+	Recommendation    *NodeGroupRecommendation `json:"recommendation"`
+}
+
+// Fragment of a Karpenter NodePool spec
+type KarpenterHint struct {
+	Requirements []NodeSelectorRequirement `json:"requirements"`
+	Disruption   KarpenterDisruption       `json:"disruption"`
+}
+
+type NodeSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values"`
+}
+
+type KarpenterDisruption struct {
+	ConsolidationPolicy string `json:"consolidationPolicy"`
+	ConsolidateAfter    string `json:"consolidateAfter"`
+}
+
+// Settings for a cluster-autoscaler node group
+type ClusterAutoscalerHint struct {
+	NodeGroup                     string  `json:"node_group"`
+	InstanceType                  string  `json:"instance_type"`
+	RecommendedSize               int     `json:"recommended_size"`
+	ScaleDownUtilizationThreshold float64 `json:"scale_down_utilization_threshold"`
+}
+
+// Instance types in the catalogue that hold the node group's requests, cheapest first
+// the current type is included at the node group's own price
+func (r *NodeGroupRecommender) Options(g NodeGroup, costPerNode float64) []InstanceOption {
+	if g.HourlyCostPerNode > 0 {
+		costPerNode = g.HourlyCostPerNode
+	}
+
+	var options []InstanceOption
+	if n := r.nodesNeeded(g.Requested, g.NodeCapacity); n > 0 {
+		options = append(options, InstanceOption{InstanceType: g.InstanceType, NodeCount: n, HourlyCost: float64(n) * costPerNode})
+	}
+	for _, it := range r.Catalogue {
+		if it.Name == g.InstanceType {
+			continue
+		}
+		n := r.nodesNeeded(g.Requested, it.Capacity)
+		if n == 0 {
+			continue
+		}
+		options = append(options, InstanceOption{InstanceType: it.Name, NodeCount: n, HourlyCost: float64(n) * it.HourlyCost})
+	}
+
+	sort.SliceStable(options, func(i, j int) bool { return options[i].HourlyCost < options[j].HourlyCost })
+	return options
+}
+
+// Hint for the given provisioner from a node group and its recommendation
+func (r *NodeGroupRecommender) Hint(provisioner string, g NodeGroup, rec *NodeGroupRecommendation, costPerNode float64) *ProvisionerHint {
+	hint := &ProvisionerHint{
+		NodeGroup:      g.Name,
+		InstanceTypes:  r.Options(g, costPerNode),
+		Recommendation: rec,
+	}
+	if n := r.nodesNeeded(g.Requested, g.NodeCapacity); n > 0 && n < g.NodeCount {
+		hint.ConsolidatableNodes = g.NodeCount - n
+	}
+
+	switch provisioner {
+	case ProvisionerKarpenter:
+		values := make([]string, len(hint.InstanceTypes))
+		for i, o := range hint.InstanceTypes {
+			values[i] = o.InstanceType
+		}
+		hint.Karpenter = &KarpenterHint{
+			Requirements: []NodeSelectorRequirement{{Key: InstanceTypeLabel, Operator: "In", Values: values}},
+			Disruption:   KarpenterDisruption{ConsolidationPolicy: "WhenEmptyOrUnderutilized", ConsolidateAfter: "30s"},
+		}
+	case ProvisionerClusterAutoscaler:
+		hint.ClusterAutoscaler = &ClusterAutoscalerHint{
+			NodeGroup:                     g.Name,
+			InstanceType:                  rec.RecommendedInstanceType,
+			RecommendedSize:               rec.RecommendedNodeCount,
+			ScaleDownUtilizationThreshold: r.TargetUtilisation,
+		}
+	}
+	return hint
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+)
+
+// returned when the policy gate rejects a job
+var ErrJobDenied = errors.New("job denied by policy gate")
+
+// audit record for a rejected job
+type JobDenial struct {
+	Job     AgentJob `json:"job"`
+	Reasons []string `json:"reasons"`
+}
+
+// Publish a job to the agent queue once it passes the policy gate and the tenant's job quota
+// routing rules are evaluated before dispatch, their channels hear about the job once it is published
+// deployment changes are then tiered by the automation policy, notify-only tiers drop the apply
+// the gate and quota check the enriched job, denials are recorded in the decision log as job_denied events
+// published jobs are recorded as job_published, deployment jobs also become Kubernetes Events when enabled
+func (a *Aggregator) publishJob(ctx context.Context, job AgentJob) error {
+	if job.Deployment != nil && job.Ownership == nil {
+		job.Ownership = a.ownerOf(ctx, job.Namespace, job.Deployment.Name, job.Deployment.Labels)
+	}
+	if job.Routing == nil {
+		job.Routing = a.routeJob(ctx, job)
+	}
+	if job.Routing != nil && job.Routing.Approval == ApprovalNotifyOnly {
+		job.Action = ActionNotifyOnly
+	}
+	if job.Automation == nil {
+		job.Automation = a.automationTier(ctx, &job)
+	}
+	// the gate sees the job as it would be published, with its owner, routing and tier
+	if a.Gate != nil {
+		if reasons := a.gateReasons(ctx, job); len(reasons) > 0 {
+			a.recordEvent(ctx, EventJobDenied, JobDenial{Job: job, Reasons: reasons})
+			return fmt.Errorf("%w: %s", ErrJobDenied, strings.Join(reasons, "; "))
+		}
+	}
+	if a.Tenants != nil && job.Namespace != "" {
+		if err := a.Tenants.CheckJob(ctx, job.Namespace); err != nil {
+			a.recordEvent(ctx, EventJobDenied, JobDenial{Job: job, Reasons: []string{err.Error()}})
+			return fmt.Errorf("%w: %v", ErrJobDenied, err)
+		}
+	}
+	// agents subscribe by cluster or namespace, so the job goes out in an envelope carrying both
+	msg, err := queue.NewEnvelope(string(job.TargetType), a.clusterID(), job.Namespace, job)
+	if err != nil {
+		return err
+	}
+	msg.Created = a.now()
+	// the window is the cooldown, inside it the job would only be published again by a retry
+	if window := time.Duration(a.ActivePolicy(ctx).CooldownSeconds) * time.Second; window > 0 {
+		msg.ID = JobID(a.clusterID(), job, a.now().Truncate(window))
+	}
+	if err := a.Queue.PublishJob(ctx, a.jobQueue(job), msg); err != nil {
+		return err
+	}
+	a.recordEvent(ctx, EventJobPublished, job)
+	a.recordRecommendation(ctx, job, msg.ID)
+	a.recordKubeEvent(ctx, job)
+	a.notifyRouted(ctx, job)
+	return nil
+}
+
+// deny reasons, empty when the job is allowed
+// an unreachable gate denies unless GateFailOpen is set
+func (a *Aggregator) gateReasons(ctx context.Context, job AgentJob) []string {
+	d, err := a.Gate.Check(ctx, job)
+	if err != nil {
+		if a.GateFailOpen {
+			fmt.Printf("Policy gate unavailable, publishing anyway: %v\n", err)
+			return nil
+		}
+		return []string{fmt.Sprintf("policy gate unavailable: %v", err)}
+	}
+	if d.Allow {
+		return nil
+	}
+	return d.Reasons
+}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrNoDeploymentSeries = errors.New("no deployment in the namespace reports its usage")
+
+// Requests and usage of one deployment summed over its pods or containers
+type pulledTotals struct {
+	CPUUsed, CPURequested, MemoryUsed, MemoryRequested float64
+}
+
+// Cost payload of the namespace from per-deployment totals
+// backends have no cost metric, the cluster cost is nodes times costPerNode
+// deployments without cpu or memory usage are left out, those without requests are kept with them unset
+func pulledPayload(source string, namespace string, ts time.Time, nodes float64, costPerNode float64, deployments map[string]*pulledTotals) (*CostPayload, error) {
+	payload := &CostPayload{
+		Source:      source,
+		Timestamp:   ts.UTC(),
+		Namespace:   namespace,
+		ClusterInfo: ClusterInfo{VmCount: nodes, Cost: nodes * costPerNode},
+	}
+	for name, t := range deployments {
+		if t.CPUUsed <= 0 || t.MemoryUsed <= 0 {
+			continue
+		}
+		payload.Deployments = append(payload.Deployments, CostDeployment{
+			Name:            name,
+			CurrentRequests: Resources{CPUCores: t.CPURequested, MemoryMB: t.MemoryRequested},
+			CurrentUsage:    Resources{CPUCores: t.CPUUsed, MemoryMB: t.MemoryUsed},
+		})
+	}
+	if len(payload.Deployments) == 0 {
+		return nil, ErrNoDeploymentSeries
+	}
+	sort.Slice(payload.Deployments, func(i, j int) bool {
+		return payload.Deployments[i].Name < payload.Deployments[j].Name
+	})
+	return payload, nil
+}
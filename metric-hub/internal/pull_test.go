@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/azuremonitor"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/cloudwatch"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/datadog"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCloudWatchResultsBecomeCostPayload(t *testing.T) {
+	ts := time.Date(2025, 12, 22, 14, 4, 0, 0, time.UTC)
+	point := func(v float64) []cloudwatch.Point {
+		return []cloudwatch.Point{{Timestamp: ts.Add(-time.Minute), Value: 1}, {Timestamp: ts, Value: v}}
+	}
+	p := NewCloudWatchPuller(nil, "prod", "default", 0.04)
+	payload, err := p.Payload([]cloudwatch.Result{
+		{ID: "cpu_used", Label: "cartservice", Points: point(60)},
+		{ID: "cpu_requested", Label: "cartservice", Points: point(300)},
+		{ID: "memory_used", Label: "cartservice", Points: point(38 << 20)},
+		{ID: "memory_requested", Label: "cartservice", Points: point(750 << 20)},
+		// no memory usage reported, left out
+		{ID: "cpu_used", Label: "redis", Points: point(10)},
+		{ID: "nodes", Label: "prod", Points: point(6)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewValidator().Validate(payload); err != nil {
+		t.Fatalf("expected a valid payload, got %v", err)
+	}
+	if len(payload.Deployments) != 1 || payload.Source != CloudWatchSource || !payload.Timestamp.Equal(ts) {
+		t.Fatalf("expected cartservice from cloudwatch at %v, got %+v", ts, payload)
+	}
+	d := payload.Deployments[0]
+	if math.Abs(d.CurrentUsage.CPUCores-0.06) > 1e-9 || d.CurrentRequests.CPUCores != 0.3 || d.CurrentRequests.MemoryMB != 750 || d.CurrentUsage.MemoryMB != 38 {
+		t.Errorf("expected 0.06/0.3 cores and 38/750MB, got %+v", d)
+	}
+	if math.Abs(payload.ClusterInfo.Cost-0.24) > 1e-9 {
+		t.Errorf("expected 6 nodes costing 0.24, got %+v", payload.ClusterInfo)
+	}
+
+	if _, err := p.Payload([]cloudwatch.Result{{ID: "nodes", Points: point(6)}}); !errors.Is(err, ErrNoDeploymentSeries) {
+		t.Errorf("expected ErrNoDeploymentSeries, got %v", err)
+	}
+}
+
+func TestCloudWatchPollQueriesUpToClock(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	now := time.Date(2025, 12, 22, 14, 4, 0, 0, time.UTC)
+	var start, end int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ StartTime, EndTime int64 }
+		json.NewDecoder(r.Body).Decode(&body)
+		start, end = body.StartTime, body.EndTime
+		w.Write([]byte(`{"MetricDataResults": []}`))
+	}))
+	defer srv.Close()
+
+	c := cloudwatch.NewClient("eu-west-1", time.Second)
+	c.Endpoint = srv.URL
+	p := NewCloudWatchPuller(c, "prod", "default", 0.04)
+	p.Clock = clock.NewFake(now)
+	if _, err := p.Poll(context.Background()); !errors.Is(err, ErrNoDeploymentSeries) {
+		t.Errorf("expected ErrNoDeploymentSeries, got %v", err)
+	}
+	if end != now.Unix() || start != now.Add(-CloudWatchLookback).Unix() {
+		t.Errorf("expected the lookback ending at the clock, got %d to %d", start, end)
+	}
+}
+
+func TestAzureMonitorRowsBecomeCostPayload(t *testing.T) {
+	rows := &azuremonitor.Table{
+		Columns: []azuremonitor.Column{{Name: "Deployment"}, {Name: "CounterName"}, {Name: "Value"}, {Name: "TimeGenerated"}},
+		Rows: [][]interface{}{
+			{"cartservice", "cpuUsageNanoCores", 6e7, "2025-12-22T14:03:00Z"},
+			{"cartservice", "cpuRequestNanoCores", 3e8, "2025-12-22T14:04:00Z"},
+			{"cartservice", "memoryWorkingSetBytes", float64(38 << 20), "2025-12-22T14:03:00Z"},
+			{"cartservice", "memoryRequestBytes", float64(750 << 20), "2025-12-22T14:04:00Z"},
+			{"cartservice", "restartTimeEpoch", 1.0, "2025-12-22T14:05:00Z"},
+		},
+	}
+	nodes := &azuremonitor.Table{Columns: []azuremonitor.Column{{Name: "Nodes"}}, Rows: [][]interface{}{{6.0}}}
+
+	payload, err := NewAzureMonitorPuller(nil, "prod", "default", 0.04).Payload(rows, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewValidator().Validate(payload); err != nil {
+		t.Fatalf("expected a valid payload, got %v", err)
+	}
+	d := payload.Deployments[0]
+	if math.Abs(d.CurrentUsage.CPUCores-0.06) > 1e-9 || math.Abs(d.CurrentRequests.CPUCores-0.3) > 1e-9 || d.CurrentUsage.MemoryMB != 38 {
+		t.Errorf("expected 0.06/0.3 cores and 38MB used, got %+v", d)
+	}
+	if payload.ClusterInfo.VmCount != 6 || payload.Timestamp != time.Date(2025, 12, 22, 14, 4, 0, 0, time.UTC) {
+		t.Errorf("expected 6 nodes at 14:04, got %+v at %v", payload.ClusterInfo, payload.Timestamp)
+	}
+}
+
+func TestKQLStringEscapesQuotes(t *testing.T) {
+	if got := kqlString(`it's`); got != `'it\'s'` {
+		t.Errorf("expected 'it\\'s', got %s", got)
+	}
+}
+
+func TestDatadogPollQueriesUpToClock(t *testing.T) {
+	now := time.Date(2025, 12, 22, 14, 4, 0, 0, time.UTC)
+	values := map[string]float64{
+		"kubernetes.cpu.usage.total":  60000000,
+		"kubernetes.cpu.requests":     0.3,
+		"kubernetes.memory.usage":     38 << 20,
+		"kubernetes.memory.requests":  750 << 20,
+		"kubernetes_state.node.count": 6,
+	}
+	var queries int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		q := r.URL.Query()
+		if q.Get("from") != "1766412180" || q.Get("to") != "1766412240" {
+			t.Errorf("expected the window ending at the clock, got %s to %s", q.Get("from"), q.Get("to"))
+		}
+		metric, _, _ := strings.Cut(strings.TrimPrefix(q.Get("query"), "sum:"), "{")
+		tags := []string{"kube_namespace:default", "kube_deployment:cartservice"}
+		if metric == "kubernetes_state.node.count" {
+			tags = nil
+		}
+		json.NewEncoder(w).Encode(map[string]any{"status": "ok", "series": []any{map[string]any{
+			"metric": metric, "tag_set": tags, "pointlist": [][2]float64{{float64(now.UnixMilli()), values[metric]}},
+		}}})
+	}))
+	defer srv.Close()
+
+	c := datadog.NewClient("", "api", "app", time.Second)
+	c.Endpoint = srv.URL
+	mapping := DefaultDatadogMapping()
+	mapping.HourlyCostPerNode = 0.04
+	p := NewDatadogPuller(c, mapping, time.Minute)
+	p.Clock = clock.NewFake(now)
+	payload, err := p.Poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queries != len(values) {
+		t.Errorf("expected one query per mapped metric, got %d", queries)
+	}
+	if err := NewValidator().Validate(payload); err != nil {
+		t.Fatalf("expected a valid payload, got %v", err)
+	}
+	d := payload.Deployments[0]
+	if !payload.Timestamp.Equal(now) || payload.ClusterInfo.VmCount != 6 || math.Abs(d.CurrentUsage.CPUCores-0.06) > 1e-9 || d.CurrentRequests.MemoryMB != 750 {
+		t.Errorf("expected cartservice on 6 nodes at %v, got %+v", now, payload)
+	}
+}
+
+func TestDatadogIntakeForgetsStaleSeries(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	fake := clock.NewFake(time.Date(2025, 12, 22, 14, 4, 0, 0, time.UTC))
+	intake := NewDatadogIntake(client, DefaultDatadogMapping())
+	intake.Clock = fake
+	ctx := context.Background()
+
+	if p, err := intake.Poll(ctx); p != nil || err != nil {
+		t.Fatalf("expected nothing before any series, got %+v %v", p, err)
+	}
+
+	series := func(pod string, usage float64) datadog.Series {
+		return datadog.Series{Metric: "kubernetes.memory.usage", Points: []datadog.Point{{Timestamp: 1766412283, Value: usage}},
+			Tags: []string{"pod_name:" + pod, "kube_deployment:cartservice", "kube_namespace:default"}}
+	}
+	err := intake.Record(ctx, []datadog.Series{
+		series("cart-1", 10<<20),
+		{Metric: "system.load.1", Points: []datadog.Point{{Timestamp: 1766412283, Value: 0.4}}},
+		{Metric: "kubernetes.memory.usage", Points: []datadog.Point{{Timestamp: 1766412283, Value: 1}}, Tags: []string{"kube_namespace:kube-system", "kube_deployment:coredns"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields, _ := client.HKeys(ctx, DatadogIntakeKey).Result(); len(fields) != 1 {
+		t.Errorf("expected only the mapped series kept, got %v", fields)
+	}
+
+	fake.Advance(DatadogIntakeStaleness - time.Minute)
+	// a newer point of the same series replaces it
+	intake.Record(ctx, []datadog.Series{series("cart-1", 20<<20), series("cart-2", 30<<20)})
+	fake.Advance(2 * time.Minute)
+	cpu := series("cart-2", 1e8)
+	cpu.Metric = "kubernetes.cpu.usage.total"
+	intake.Record(ctx, []datadog.Series{series("cart-2", 40<<20), cpu})
+
+	p, err := intake.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := p.Deployments[0]; d.CurrentUsage.MemoryMB != 60 {
+		t.Errorf("expected 20MB and 40MB summed, got %+v", d.CurrentUsage)
+	}
+
+	fake.Advance(DatadogIntakeStaleness + time.Second)
+	if p, err := intake.Poll(ctx); p != nil || err != nil {
+		t.Errorf("expected stale series dropped, got %+v %v", p, err)
+	}
+	if n, _ := client.HLen(ctx, DatadogIntakeKey).Result(); n != 0 {
+		t.Errorf("expected stale series removed, %d left", n)
+	}
+}
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/queue"
+)
+
+var ErrEmptyPurgeFilter = errors.New("purge needs a namespace or a before time")
+
+// stream entries deleted per XDEL
+const purgeBatch = 1000
+
+// Stored data to remove, at least one field must be set
+type PurgeFilter struct {
+	Namespace string    `json:"namespace,omitempty"`
+	Before    time.Time `json:"before,omitzero"`
+}
+
+// Entries removed, or that would be removed on a dry run
+type PurgeResult struct {
+	Filter  PurgeFilter `json:"filter"`
+	DryRun  bool        `json:"dry_run"`
+	History int64       `json:"history"`
+	Jobs    int64       `json:"jobs"`
+	Events  int64       `json:"events"`
+	// recommendation history records
+	Recommendations int64 `json:"recommendations"`
+	// latest data-quality reports of producers
+	QualityReports int64 `json:"quality_reports"`
+	// why a purge stopped part way, the counts are what was removed before it
+	Error string `json:"error,omitempty"`
+}
+
+// jobs are matched by when they were published, those queued by older hubs carry no time and are never before
+func (f PurgeFilter) matchesJob(msg queuedJob) bool {
+	if f.Namespace != "" && msg.job.Namespace != f.Namespace {
+		return false
+	}
+	return f.Before.IsZero() || (!msg.created.IsZero() && msg.created.Before(f.Before))
+}
+
+type queuedJob struct {
+	job     AgentJob
+	created time.Time
+}
+
+// a queued message, an envelope or a bare job from before envelopes
+func parseQueuedJob(data []byte) (queuedJob, error) {
+	var msg queuedJob
+	var env queue.Envelope
+	if json.Unmarshal(data, &env) == nil && env.Version > 0 {
+		msg.created = env.Created
+	}
+	err := json.Unmarshal(queue.Payload(data), &msg.job)
+	return msg, err
+}
+
+// records of earlier purges are kept as the audit trail
+func (f PurgeFilter) matchesEvent(ev Event) bool {
+	if ev.Type == EventDataPurged {
+		return false
+	}
+	if f.Namespace != "" && EventNamespace(ev) != f.Namespace {
+		return false
+	}
+	return f.Before.IsZero() || ev.Time.Before(f.Before)
+}
+
+// Remove usage history, queued jobs, decision log entries, recommendation history and quality reports matching f
+// cost:latest is left, every evaluation reads it and the write-ahead logs of other replicas would restore it
+// the purge itself is recorded as a data_purged event, dry runs only count
+// a purge that fails part way is still recorded with what it removed, and fails if it can't be recorded
+func (a *Aggregator) Purge(ctx context.Context, f PurgeFilter, dryRun bool) (*PurgeResult, error) {
+	if f.Namespace == "" && f.Before.IsZero() {
+		return nil, ErrEmptyPurgeFilter
+	}
+	res := &PurgeResult{Filter: f, DryRun: dryRun}
+
+	err := a.purge(ctx, f, dryRun, res)
+	if dryRun {
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if auditErr := a.appendEvent(ctx, EventDataPurged, res); auditErr != nil {
+		return nil, errors.Join(err, fmt.Errorf("failed to record purge %w", auditErr))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// counts go into res as each kind of data is removed
+func (a *Aggregator) purge(ctx context.Context, f PurgeFilter, dryRun bool, res *PurgeResult) error {
+	// before the history, which forgets the deployments they belong to
+	imported, err := a.purgeImportedEvents(ctx, f, dryRun)
+	res.Events += imported
+	if err != nil {
+		return err
+	}
+	if a.History != nil {
+		if res.History, err = a.History.Purge(ctx, f.Namespace, f.Before, dryRun); err != nil {
+			return err
+		}
+	}
+	if res.Jobs, err = a.purgeJobs(ctx, f, dryRun); err != nil {
+		return err
+	}
+	events, err := a.purgeEvents(ctx, f, dryRun)
+	res.Events += events
+	if err != nil {
+		return err
+	}
+	if res.Recommendations, err = a.purgeRecommendations(ctx, f, dryRun); err != nil {
+		return err
+	}
+	if res.QualityReports, err = a.purgeQualityReports(ctx, f, dryRun); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Key - queue:agent:jobs and the route queues, with their per cluster and namespace lists when the queue is routed
+func (a *Aggregator) purgeJobs(ctx context.Context, f PurgeFilter, dryRun bool) (int64, error) {
+	var removed int64
+	seen := map[string]bool{}
+	for _, name := range a.jobQueues() {
+		iter := a.Client.Scan(ctx, 0, name+"*", 1000).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			// only the queue and its routed lists, and each once when one queue's name prefixes another's
+			if (key != name && !strings.HasPrefix(key, name+":")) || seen[key] {
+				continue
+			}
+			seen[key] = true
+			n, err := a.purgeJobList(ctx, key, f, dryRun)
+			removed += n
+			if err != nil {
+				return removed, err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return removed, fmt.Errorf("failed to scan agent queues %w", err)
+		}
+	}
+	return removed, nil
+}
+
+func (a *Aggregator) purgeJobList(ctx context.Context, key string, f PurgeFilter, dryRun bool) (int64, error) {
+	raw, err := a.Client.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read agent queue %w", err)
+	}
+
+	var removed int64
+	for _, item := range raw {
+		msg, err := parseQueuedJob([]byte(item))
+		if err != nil || !f.matchesJob(msg) {
+			continue
+		}
+		if dryRun {
+			removed++
+			continue
+		}
+		// the agent may have taken it in the meantime
+		n, err := a.Client.LRem(ctx, key, 1, item).Result()
+		if err != nil {
+			return removed, fmt.Errorf("[Failed] LREM redis: %w", err)
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+// Key - events:log
+// always read from the primary so nothing written just before is missed
+func (a *Aggregator) purgeEvents(ctx context.Context, f PurgeFilter, dryRun bool) (int64, error) {
+	end := "+"
+	if !f.Before.IsZero() {
+		end = "(" + strconv.FormatInt(f.Before.UnixMilli(), 10) + "-0"
+	}
+	msgs, err := a.Client.XRange(ctx, EventLogKey, "-", end).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read event log %w", err)
+	}
+
+	var ids []string
+	for _, m := range msgs {
+		if f.matchesEvent(EventFromMessage(m)) {
+			ids = append(ids, m.ID)
+		}
+	}
+	if dryRun {
+		return int64(len(ids)), nil
+	}
+
+	var removed int64
+	for start := 0; start < len(ids); start += purgeBatch {
+		n, err := a.Client.XDel(ctx, EventLogKey, ids[start:min(start+purgeBatch, len(ids))]...).Result()
+		if err != nil {
+			return removed, fmt.Errorf("[Failed] XDEL redis: %w", err)
+		}
+		removed += n
+	}
+	return removed, nil
+}
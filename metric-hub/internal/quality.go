@@ -0,0 +1,298 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/producer"
+	"github.com/redis/go-redis/v9"
+)
+
+// Key - quality:reports
+// Field - <producer>, Value - report of its latest cost payload
+const QualityReportsKey = "quality:reports"
+
+// Data-quality checks
+const (
+	// a figure is infinite or not a number
+	QualityNonFinite = "non_finite"
+	// usage above what the cluster's node groups can allocate
+	QualityOverAllocatable = "usage_over_allocatable"
+	// practically no usage against a large request, usually a broken usage metric. Usage must be
+	// positive to pass validation, so this catches a metric reporting a sliver rather than zero
+	QualityIdleHighRequest = "idle_with_high_request"
+	// requests set below the smallest Kubernetes can express, waste and risk ratios blow up
+	QualityRequestsNearZero = "requests_near_zero"
+)
+
+// 1m and 1Mi
+const (
+	minRequestCPUCores = 0.001
+	minRequestMemoryMB = 1
+)
+
+// Thresholds of the data-quality checks
+type QualityChecks struct {
+	// payloads scoring below this have every trigger suppressed and alert on their producer
+	MinScore float64 `json:"min_score" validate:"gte=0,lte=1"`
+	// usage below this fraction of requests is idle, checked only for requests of at least IdleMinCPUCores or IdleMinMemoryMB
+	IdleRatio       float64 `json:"idle_ratio" validate:"gte=0,lt=1"`
+	IdleMinCPUCores float64 `json:"idle_min_cpu_cores" validate:"gte=0"`
+	IdleMinMemoryMB float64 `json:"idle_min_memory_mb" validate:"gte=0"`
+}
+
+func DefaultQualityChecks() QualityChecks {
+	return QualityChecks{MinScore: 0.8, IdleRatio: 0.001, IdleMinCPUCores: 1, IdleMinMemoryMB: 1024}
+}
+
+type QualityIssue struct {
+	Deployment string `json:"deployment"`
+	Check      string `json:"check"`
+	Detail     string `json:"detail"`
+}
+
+// Score is the fraction of deployments without issues, 1 for a payload without deployments
+type QualityReport struct {
+	Producer string `json:"producer"`
+	// of the assessed payload, purges match reports on it
+	Namespace   string         `json:"namespace,omitempty"`
+	Timestamp   time.Time      `json:"timestamp"`
+	Deployments int            `json:"deployments"`
+	Score       float64        `json:"score"`
+	LowQuality  bool           `json:"low_quality"`
+	Issues      []QualityIssue `json:"issues"`
+
+	flagged map[string]bool
+}
+
+// Check every deployment of a cost payload
+func (c QualityChecks) Assess(p *CostPayload) *QualityReport {
+	r := &QualityReport{
+		Producer:    p.Source,
+		Namespace:   p.Namespace,
+		Timestamp:   p.Timestamp,
+		Deployments: len(p.Deployments),
+		Score:       1,
+		Issues:      []QualityIssue{},
+		flagged:     map[string]bool{},
+	}
+	if r.Producer == "" {
+		r.Producer = producer.CostEngine
+	}
+
+	allocatable, hasAllocatable := clusterAllocatable(p.NodeGroups)
+	// counted per entry, deployments sharing a name are scored separately
+	clean := 0
+	for _, d := range p.Deployments {
+		issues := c.deploymentIssues(d, allocatable, hasAllocatable)
+		if len(issues) == 0 {
+			clean++
+			continue
+		}
+		r.Issues = append(r.Issues, issues...)
+		r.flagged[d.Name] = true
+	}
+	if r.Deployments > 0 {
+		r.Score = float64(clean) / float64(r.Deployments)
+	}
+	r.LowQuality = r.Score < c.MinScore
+	return r
+}
+
+// true when triggers derived from the deployment's figures should not fire
+func (r *QualityReport) Suppresses(name string) bool {
+	return r.LowQuality || r.flagged[name]
+}
+
+func (c QualityChecks) deploymentIssues(d CostDeployment, allocatable Resources, hasAllocatable bool) []QualityIssue {
+	var issues []QualityIssue
+	flag := func(check string, format string, args ...any) {
+		issues = append(issues, QualityIssue{Deployment: d.Name, Check: check, Detail: fmt.Sprintf(format, args...)})
+	}
+	figures := []Resources{d.CurrentRequests, d.CurrentUsage}
+	if d.PredictPeak24h != nil {
+		figures = append(figures, *d.PredictPeak24h)
+	}
+	if u := d.UsageStats; u != nil {
+		for _, r := range []*Resources{u.Avg, u.P95, u.Max} {
+			if r != nil {
+				figures = append(figures, *r)
+			}
+		}
+	}
+	for _, r := range figures {
+		if !finite(r.CPUCores) || !finite(r.MemoryMB) {
+			// nothing else can be judged from a non-finite figure
+			flag(QualityNonFinite, "cpu %v cores, memory %v MB", r.CPUCores, r.MemoryMB)
+			return issues
+		}
+	}
+
+	req := d.CurrentRequests
+	// unset requests are classified as No Requests Set instead
+	nearZero := func(v float64, min float64) bool { return v > 0 && v < min }
+	if nearZero(req.CPUCores, minRequestCPUCores) || nearZero(req.MemoryMB, minRequestMemoryMB) {
+		flag(QualityRequestsNearZero, "requests %.4f cores and %.2f MB", req.CPUCores, req.MemoryMB)
+	}
+
+	peak := d.RiskUsage()
+	if hasAllocatable && (peak.CPUCores > allocatable.CPUCores || peak.MemoryMB > allocatable.MemoryMB) {
+		flag(QualityOverAllocatable, "usage %.2f cores and %.0f MB, cluster allocatable %.2f cores and %.0f MB",
+			peak.CPUCores, peak.MemoryMB, allocatable.CPUCores, allocatable.MemoryMB)
+	}
+
+	usage := d.CurrentUsage
+	idleCPU := req.CPUCores >= c.IdleMinCPUCores && usage.CPUCores < req.CPUCores*c.IdleRatio
+	idleMemory := req.MemoryMB >= c.IdleMinMemoryMB && usage.MemoryMB < req.MemoryMB*c.IdleRatio
+	if idleCPU || idleMemory {
+		flag(QualityIdleHighRequest, "usage %.4f cores and %.2f MB of %.2f cores and %.0f MB requested",
+			usage.CPUCores, usage.MemoryMB, req.CPUCores, req.MemoryMB)
+	}
+	return issues
+}
+
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// total capacity of the reported node groups, false when none are reported
+func clusterAllocatable(groups []NodeGroup) (Resources, bool) {
+	var total Resources
+	for _, g := range groups {
+		total.CPUCores += g.NodeCapacity.CPUCores * float64(g.NodeCount)
+		total.MemoryMB += g.NodeCapacity.MemoryMB * float64(g.NodeCount)
+	}
+	return total, len(groups) > 0
+}
+
+// score a saved cost payload, store the report and alert when its producer's data turns low quality or recovers
+func (a *Aggregator) recordQuality(ctx context.Context, p *CostPayload) {
+	report := a.Quality.Assess(p)
+	metrics.PayloadQuality.WithLabelValues(report.Producer).Set(report.Score)
+	for _, issue := range report.Issues {
+		metrics.QualityIssues.WithLabelValues(report.Producer, issue.Check).Inc()
+	}
+	if len(report.Issues) > 0 {
+		fmt.Printf("Payload from %s scored %.2f with %d data quality issues\n", report.Producer, report.Score, len(report.Issues))
+	}
+
+	previous, err := a.qualityReport(ctx, report.Producer)
+	if err != nil {
+		fmt.Printf("Failed to read quality report %v\n", err)
+	}
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	if err := a.Client.HSet(ctx, QualityReportsKey, report.Producer, jsonData).Err(); err != nil {
+		fmt.Printf("Failed to save quality report %v\n", err)
+	}
+
+	wasLow := previous != nil && previous.LowQuality
+	switch {
+	case report.LowQuality && !wasLow:
+		a.notifyQuality(ctx, notify.SeverityWarning, fmt.Sprintf("Producer %s is sending low quality data", report.Producer),
+			fmt.Sprintf("Payload at %s scored %.2f, triggers are suppressed until it recovers: %s",
+				report.Timestamp.Format(time.RFC3339), report.Score, qualitySummary(report.Issues)), report.Producer)
+	case !report.LowQuality && wasLow:
+		a.notifyQuality(ctx, notify.SeverityInfo, fmt.Sprintf("Producer %s data quality recovered", report.Producer),
+			fmt.Sprintf("Payload at %s scored %.2f", report.Timestamp.Format(time.RFC3339), report.Score), report.Producer)
+	}
+}
+
+// first few issues, one per line
+func qualitySummary(issues []QualityIssue) string {
+	const shown = 5
+	summary := ""
+	for i, issue := range issues {
+		if i == shown {
+			summary += fmt.Sprintf("\n... and %d more", len(issues)-shown)
+			break
+		}
+		summary += fmt.Sprintf("\n%s: %s (%s)", issue.Deployment, issue.Check, issue.Detail)
+	}
+	return summary
+}
+
+func (a *Aggregator) notifyQuality(ctx context.Context, sev notify.Severity, title string, msg string, producer string) {
+	if a.Notifier == nil {
+		return
+	}
+	err := a.Notifier.Notify(ctx, notify.Notification{
+		Severity:  sev,
+		Title:     title,
+		Message:   msg,
+		Labels:    map[string]string{"producer": producer},
+		Timestamp: a.now().UTC(),
+		DedupKey:  "quality:" + producer,
+	})
+	if err != nil {
+		fmt.Printf("Failed to send quality notification %v\n", err)
+	}
+}
+
+// stored report of the producer's latest payload, nil when there is none
+func (a *Aggregator) qualityReport(ctx context.Context, producer string) (*QualityReport, error) {
+	raw, err := a.Client.HGet(ctx, QualityReportsKey, producer).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("[Failed] HGET redis: %w", err)
+	}
+	var r QualityReport
+	if err := json.Unmarshal([]byte(raw), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Report of each producer's latest cost payload, sorted by producer
+func (a *Aggregator) QualityReports(ctx context.Context) ([]QualityReport, error) {
+	raw, err := a.reader().HGetAll(ctx, QualityReportsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quality reports %w", err)
+	}
+	reports := make([]QualityReport, 0, len(raw))
+	for _, v := range raw {
+		var r QualityReport
+		if err := json.Unmarshal([]byte(v), &r); err != nil {
+			continue
+		}
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Producer < reports[j].Producer })
+	return reports, nil
+}
+
+// reports of payloads in the namespace and before the time, matched by the payload's timestamp
+func (a *Aggregator) purgeQualityReports(ctx context.Context, f PurgeFilter, dryRun bool) (int64, error) {
+	raw, err := a.Client.HGetAll(ctx, QualityReportsKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get quality reports %w", err)
+	}
+	var producers []string
+	for producer, data := range raw {
+		var r QualityReport
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			continue
+		}
+		if (f.Namespace == "" || r.Namespace == f.Namespace) && (f.Before.IsZero() || r.Timestamp.Before(f.Before)) {
+			producers = append(producers, producer)
+		}
+	}
+	if dryRun || len(producers) == 0 {
+		return int64(len(producers)), nil
+	}
+	n, err := a.Client.HDel(ctx, QualityReportsKey, producers...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("[Failed] HDEL redis: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestQualityChecksFlagImpossibleValues(t *testing.T) {
+	healthy := CostDeployment{
+		Name:            "cartservice",
+		CurrentRequests: Resources{CPUCores: 0.5, MemoryMB: 512},
+		CurrentUsage:    Resources{CPUCores: 0.3, MemoryMB: 64},
+	}
+	overAllocatable := healthy
+	overAllocatable.Name = "checkout"
+	overAllocatable.UsageStats = &UsageStats{Max: &Resources{CPUCores: 20, MemoryMB: 64}}
+	tinyRequests := healthy
+	tinyRequests.Name = "emailservice"
+	tinyRequests.CurrentRequests.CPUCores = 0.0001
+	infinite := healthy
+	infinite.Name = "adservice"
+	infinite.CurrentUsage.MemoryMB = math.Inf(1)
+
+	p := &CostPayload{
+		Deployments: []CostDeployment{healthy, overAllocatable, tinyRequests, infinite},
+		NodeGroups:  []NodeGroup{{Name: "general", NodeCount: 2, NodeCapacity: Resources{CPUCores: 4, MemoryMB: 16384}}},
+	}
+	report := DefaultQualityChecks().Assess(p)
+	if report.Producer != "cost-engine" || report.Score != 0.25 || !report.LowQuality {
+		t.Fatalf("expected cost-engine scoring 0.25, got %+v", report)
+	}
+	checks := map[string]string{}
+	for _, issue := range report.Issues {
+		checks[issue.Deployment] = issue.Check
+	}
+	want := map[string]string{"checkout": QualityOverAllocatable, "emailservice": QualityRequestsNearZero, "adservice": QualityNonFinite}
+	for name, check := range want {
+		if checks[name] != check {
+			t.Errorf("expected %s flagged %s, got %q", name, check, checks[name])
+		}
+	}
+	if _, ok := checks["cartservice"]; ok {
+		t.Errorf("expected cartservice clean, got %+v", report.Issues)
+	}
+
+	// one bad deployment of five only suppresses its own triggers
+	p.Deployments = []CostDeployment{healthy, healthy, healthy, healthy, infinite}
+	report = DefaultQualityChecks().Assess(p)
+	if report.LowQuality || report.Suppresses("cartservice") || !report.Suppresses("adservice") {
+		t.Errorf("expected only adservice suppressed, got %+v", report)
+	}
+}
+
+func TestQualityChecksFlagIdleHighRequest(t *testing.T) {
+	idle := CostDeployment{
+		Name:            "cartservice",
+		CurrentRequests: Resources{CPUCores: 2, MemoryMB: 4096},
+		CurrentUsage:    Resources{CPUCores: 0.0005, MemoryMB: 2},
+	}
+	p := &CostPayload{
+		Namespace:   "default",
+		Timestamp:   time.Date(2025, 12, 22, 14, 0, 0, 0, time.UTC),
+		ClusterInfo: ClusterInfo{VmCount: 2, Cost: 0.2},
+		Deployments: []CostDeployment{idle},
+	}
+	if err := NewValidator().Validate(p); err != nil {
+		t.Fatalf("expected an idle deployment to pass validation, got %v", err)
+	}
+	report := DefaultQualityChecks().Assess(p)
+	if len(report.Issues) != 1 || report.Issues[0].Check != QualityIdleHighRequest {
+		t.Fatalf("expected cartservice flagged %s, got %+v", QualityIdleHighRequest, report.Issues)
+	}
+
+	// two entries sharing a name are both counted
+	healthy := idle
+	healthy.CurrentUsage = Resources{CPUCores: 1, MemoryMB: 2048}
+	p.Deployments = []CostDeployment{idle, idle, healthy, healthy}
+	if report = DefaultQualityChecks().Assess(p); report.Score != 0.5 {
+		t.Errorf("expected both idle entries counted for a score of 0.5, got %v", report.Score)
+	}
+}
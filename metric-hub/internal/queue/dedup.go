@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Dedup skips jobs already published to Next, for backends that can't check job ids themselves
+// the id is marked after Next accepts the job, so a failed publish is retried
+// and a crash between the two can still publish twice
+type Dedup struct {
+	Client *redis.Client
+	// name of the backend in its published keys
+	Sink string
+	Next QueueClient
+	// how long a job id is remembered, DefaultDedupTTL when zero
+	TTL time.Duration
+}
+
+func NewDedup(client *redis.Client, sink string, next QueueClient) *Dedup {
+	return &Dedup{Client: client, Sink: sink, Next: next}
+}
+
+// Implements PublishJob
+func (d *Dedup) PublishJob(ctx context.Context, queueName string, msg *Envelope) error {
+	if msg.ID == "" {
+		return d.Next.PublishJob(ctx, queueName, msg)
+	}
+	key := PublishedKey(d.Sink, msg.ID)
+	published, err := d.Client.Exists(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check job id %w", err)
+	}
+	if published == 1 {
+		RecordDuplicate(d.Sink, msg)
+		return nil
+	}
+	if err := d.Next.PublishJob(ctx, queueName, msg); err != nil {
+		return err
+	}
+	ttl := d.TTL
+	if ttl <= 0 {
+		ttl = DefaultDedupTTL
+	}
+	if err := d.Client.Set(ctx, key, 1, ttl).Err(); err != nil {
+		fmt.Printf("[Queue] failed to mark job %s published to %s %v\n", msg.ID, d.Sink, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+)
+
+// returned by clients that turn a job down on purpose, such as a follower replica
+// counted as declined rather than failed
+var ErrDeclined = errors.New("publish declined")
+
+// One backend of a fan-out
+type Sink struct {
+	Name   string
+	Client QueueClient
+	// a failure fails the publish, so the job is retried by the next evaluation
+	// other sinks' failures are only logged and counted
+	Required bool
+}
+
+// Fanout publishes every job to all its sinks at once
+type Fanout struct {
+	Sinks []Sink
+}
+
+func NewFanout(sinks ...Sink) *Fanout {
+	return &Fanout{Sinks: sinks}
+}
+
+// Implements PublishJob, returns the errors of the required sinks
+func (f *Fanout) PublishJob(ctx context.Context, queueName string, msg *Envelope) error {
+	errs := make([]error, len(f.Sinks))
+	var wg sync.WaitGroup
+	for i, s := range f.Sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = publish(ctx, s, queueName, msg)
+		}()
+	}
+	wg.Wait()
+
+	var failed []error
+	for i, s := range f.Sinks {
+		if errs[i] == nil {
+			continue
+		}
+		if s.Required {
+			failed = append(failed, errs[i])
+		} else if !errors.Is(errs[i], ErrDeclined) {
+			fmt.Printf("[Queue] %s failed to publish to %s: %v\n", s.Name, queueName, errs[i])
+		}
+	}
+	return errors.Join(failed...)
+}
+
+func publish(ctx context.Context, s Sink, queueName string, msg *Envelope) error {
+	start := time.Now()
+	err := s.Client.PublishJob(ctx, queueName, msg)
+	metrics.QueuePublishDuration.WithLabelValues(s.Name).Observe(time.Since(start).Seconds())
+	switch {
+	case err == nil:
+		metrics.QueuePublishes.WithLabelValues(s.Name, "ok").Inc()
+	case errors.Is(err, ErrDeclined):
+		metrics.QueuePublishes.WithLabelValues(s.Name, "declined").Inc()
+	default:
+		metrics.QueuePublishes.WithLabelValues(s.Name, "failed").Inc()
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type stubQueue struct {
+	err       error
+	published int
+}
+
+func (q *stubQueue) PublishJob(ctx context.Context, queueName string, msg *Envelope) error {
+	q.published++
+	return q.err
+}
+
+func TestFanoutFailsOnlyForRequiredSinks(t *testing.T) {
+	msg, _ := NewEnvelope("deployment", "prod", "shop", map[string]string{"reason": "High Memory Waste"})
+	redis := &stubQueue{}
+	lake := &stubQueue{err: errors.New("broker down")}
+	f := NewFanout(Sink{Name: "redis", Client: redis, Required: true}, Sink{Name: "kafka", Client: lake})
+
+	if err := f.PublishJob(context.Background(), "queue:agent:jobs", msg); err != nil {
+		t.Errorf("expected an optional sink failure to be ignored, got %v", err)
+	}
+	if redis.published != 1 || lake.published != 1 {
+		t.Errorf("expected both sinks to get the job, got %d and %d", redis.published, lake.published)
+	}
+
+	redis.err = ErrDeclined
+	if err := f.PublishJob(context.Background(), "queue:agent:jobs", msg); !errors.Is(err, ErrDeclined) {
+		t.Errorf("expected the required sink's error, got %v", err)
+	}
+}
+
+func TestKafkaQueueKeysByRoutingKey(t *testing.T) {
+	var path string
+	var body struct {
+		Records []struct {
+			Key   string   `json:"key"`
+			Value Envelope `json:"value"`
+		} `json:"records"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":7,"error":null}]}`))
+	}))
+	defer srv.Close()
+
+	msg, _ := NewEnvelope("deployment", "prod", "shop", map[string]string{"reason": "High Memory Waste"})
+	if err := NewKafkaQueue(srv.URL, "", 0).PublishJob(context.Background(), "queue:agent:jobs", msg); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/topics/queue.agent.jobs" {
+		t.Errorf("expected the topic named after the queue, got %s", path)
+	}
+	if len(body.Records) != 1 || body.Records[0].Key != "prod.shop" || body.Records[0].Value.Tenant != "shop" {
+		t.Errorf("expected one record keyed by prod.shop, got %+v", body.Records)
+	}
+}
+
+func TestDedupSkipsPublishedIDs(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+	next := &stubQueue{err: errors.New("broker down")}
+	d := NewDedup(client, "kafka", next)
+	msg, _ := NewEnvelope("deployment", "prod", "shop", map[string]string{"reason": "High Memory Waste"})
+	msg.ID = "abc"
+
+	// a failed publish isn't marked, so the retry goes through
+	if err := d.PublishJob(ctx, "jobs", msg); err == nil {
+		t.Errorf("expected the sink's failure")
+	}
+	next.err = nil
+	d.PublishJob(ctx, "jobs", msg)
+	d.PublishJob(ctx, "jobs", msg)
+	if next.published != 2 {
+		t.Errorf("expected the job published once after the failure, got %d calls", next.published)
+	}
+	if !mr.Exists(PublishedKey("kafka", "abc")) {
+		t.Errorf("expected the id marked published")
+	}
+}
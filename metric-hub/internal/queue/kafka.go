@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Produces to Kafka through the REST Proxy v2 API
+// records are keyed by the routing key, so a cluster's or namespace's jobs keep their order on one partition
+type KafkaQueue struct {
+	// REST Proxy, e.g. http://kafka-rest:8082
+	URL string
+	// every job goes to this topic, the queue name with dots for colons when empty
+	Topic  string
+	Client *http.Client
+}
+
+func NewKafkaQueue(url string, topic string, timeout time.Duration) *KafkaQueue {
+	return &KafkaQueue{URL: url, Topic: topic, Client: &http.Client{Timeout: timeout}}
+}
+
+type kafkaRecord struct {
+	Key   string    `json:"key"`
+	Value *Envelope `json:"value"`
+}
+
+// Implements PublishJob
+func (k *KafkaQueue) PublishJob(ctx context.Context, queueName string, msg *Envelope) error {
+	topic := k.Topic
+	if topic == "" {
+		// colons aren't allowed in topic names
+		topic = strings.ReplaceAll(queueName, ":", ".")
+	}
+	body, err := json.Marshal(map[string][]kafkaRecord{"records": {{Key: msg.RoutingKey, Value: msg}}})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(k.URL, "/")+"/topics/"+topic, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build kafka request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := k.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to produce to kafka: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("kafka rest proxy returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	// the proxy answers 200 with a per record error when the broker rejects it
+	var result struct {
+		Offsets []struct {
+			Error *string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode kafka response: %w", err)
+	}
+	for _, o := range result.Offsets {
+		if o.Error != nil && *o.Error != "" {
+			return fmt.Errorf("kafka rejected the job on %s: %s", topic, *o.Error)
+		}
+	}
+	return nil
+}
@@ -1,7 +1,94 @@
 package queue
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version of the envelope, agents skip messages with a version they don't know
+const EnvelopeVersion = 1
+
+// how long a queue remembers a published job id when it isn't told otherwise
+const DefaultDedupTTL = 24 * time.Hour
+
+// Key - queue:published:<sink>:<id>, set while the job id counts as published to sink
+func PublishedKey(sink string, id string) string {
+	return "queue:published:" + sink + ":" + id
+}
+
+// How a Redis queue splits messages into lists
+const (
+	// one list for every message
+	RouteNone = ""
+	// <queue>:<cluster>
+	RouteCluster = "cluster"
+	// <queue>:<cluster>:<namespace>, cluster-wide jobs go to <queue>:<cluster>
+	RouteNamespace = "namespace"
+)
+
+// Every message on the agent queue, the job itself is the payload
+type Envelope struct {
+	Version int `json:"version"`
+	// same for every publish of one job, queues skip ids they have already taken
+	// empty when the job can be published any number of times
+	ID string `json:"id,omitempty"`
+	// target type of the job, e.g. deployment or node-group
+	Type string `json:"type"`
+	// namespace the job is for, empty for cluster-wide jobs
+	Tenant  string `json:"tenant,omitempty"`
+	Cluster string `json:"cluster"`
+	// <cluster>.<namespace>, or <cluster> for cluster-wide jobs
+	// a partition key or subject for brokers that route on one
+	RoutingKey string `json:"routing_key"`
+	// when the hub published the job, zero in messages from older hubs
+	Created time.Time       `json:"created,omitzero"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func NewEnvelope(msgType string, cluster string, tenant string, payload interface{}) (*Envelope, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	key := cluster
+	if tenant != "" {
+		key += "." + tenant
+	}
+	return &Envelope{
+		Version:    EnvelopeVersion,
+		Type:       msgType,
+		Tenant:     tenant,
+		Cluster:    cluster,
+		RoutingKey: key,
+		Payload:    jsonData,
+	}, nil
+}
 
 type QueueClient interface {
-	PublishJob(ctx context.Context, queueName string, payload interface{}) error
+	PublishJob(ctx context.Context, queueName string, msg *Envelope) error
+}
+
+// List of a Redis queue a message is pushed to
+func RedisKey(queueName string, routing string, msg *Envelope) string {
+	switch routing {
+	case RouteCluster:
+		return queueName + ":" + msg.Cluster
+	case RouteNamespace:
+		if msg.Tenant == "" {
+			return queueName + ":" + msg.Cluster
+		}
+		return queueName + ":" + msg.Cluster + ":" + msg.Tenant
+	}
+	return queueName
+}
+
+// The job in a queued message, messages queued before envelopes are the job itself
+func Payload(data []byte) json.RawMessage {
+	var msg Envelope
+	if json.Unmarshal(data, &msg) == nil && msg.Version > 0 && msg.Payload != nil {
+		return msg.Payload
+	}
+	return data
 }
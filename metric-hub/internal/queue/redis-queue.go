@@ -4,12 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
 	"github.com/redis/go-redis/v9"
 )
 
+// pushes unless the job id is already marked published, returns 0 for a duplicate
+var publishScript = redis.NewScript(`
+if ARGV[2] ~= '' and not redis.call('SET', KEYS[2], '1', 'NX', 'PX', ARGV[3]) then return 0 end
+redis.call('LPUSH', KEYS[1], ARGV[1])
+return 1`)
+
 type RedisQueue struct {
 	Client *redis.Client
+	// RouteCluster or RouteNamespace gives each cluster or namespace its own list
+	Routing string
+	// how long a job id is remembered, DefaultDedupTTL when zero
+	DedupTTL time.Duration
 }
 
 func NewRedisQueue(client *redis.Client) *RedisQueue {
@@ -17,18 +30,37 @@ func NewRedisQueue(client *redis.Client) *RedisQueue {
 }
 
 // Implements PublishJob
-func (r *RedisQueue) PublishJob(ctx context.Context, queueName string, payload interface{}) error {
-	// payload is of type CostDeployment struct -> convert to Json string
-	jsonData, err := json.Marshal(payload)
+// the id check and the push run in one script, so a retried job is pushed exactly once
+func (r *RedisQueue) PublishJob(ctx context.Context, queueName string, msg *Envelope) error {
+	// envelope -> convert to Json string
+	jsonData, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
 	// Push to redis queue
-	err = r.Client.LPush(ctx, queueName, jsonData).Err()
+	keys := []string{RedisKey(queueName, r.Routing, msg), PublishedKey("redis", msg.ID)}
+	pushed, err := publishScript.Run(ctx, r.Client, keys, jsonData, msg.ID, DedupTTLArg(r.DedupTTL)).Int()
 	if err != nil {
 		return fmt.Errorf("failed to push to redis queue: %w", err)
 	}
+	if pushed == 0 {
+		RecordDuplicate("redis", msg)
+	}
 
 	return nil
 }
+
+// ttl in milliseconds for a publish script
+func DedupTTLArg(ttl time.Duration) string {
+	if ttl <= 0 {
+		ttl = DefaultDedupTTL
+	}
+	return strconv.FormatInt(ttl.Milliseconds(), 10)
+}
+
+// Count a job a sink had already taken, it counts as published
+func RecordDuplicate(sink string, msg *Envelope) {
+	metrics.QueueDuplicates.WithLabelValues(sink).Inc()
+	fmt.Printf("[Queue] job %s already published to %s\n", msg.ID, sink)
+}
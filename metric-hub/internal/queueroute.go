@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"slices"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+)
+
+// Sends matching jobs to their own queue, so a team's agent only sees its jobs
+// empty Namespaces match every namespace, including cluster-wide jobs
+type QueueRoute struct {
+	Queue       string          `json:"queue" validate:"required"`
+	Namespaces  []string        `json:"namespaces,omitempty"`
+	MinSeverity notify.Severity `json:"min_severity,omitempty" validate:"omitempty,oneof=info warning critical"`
+}
+
+func (r QueueRoute) matches(job AgentJob) bool {
+	if len(r.Namespaces) > 0 && !slices.Contains(r.Namespaces, job.Namespace) {
+		return false
+	}
+	return job.Severity().AtLeast(r.MinSeverity)
+}
+
+// Critical for capacity risks, which need acting on before the workload is throttled or killed
+// everything else is a warning
+func (job AgentJob) Severity() notify.Severity {
+	switch job.Reason {
+	case "High Memory Risk", "High CPU Risk":
+		return notify.SeverityCritical
+	}
+	for _, c := range job.Conditions {
+		if c.Family == FamilyForecastRisk {
+			return notify.SeverityCritical
+		}
+	}
+	return notify.SeverityWarning
+}
+
+// Queue of the first route matching the job, AgentQueueKey when none does
+func (a *Aggregator) jobQueue(job AgentJob) string {
+	for _, r := range a.QueueRoutes {
+		if r.matches(job) {
+			return r.Queue
+		}
+	}
+	return AgentQueueKey
+}
+
+// AgentQueueKey and every routed queue, each once
+func (a *Aggregator) jobQueues() []string {
+	queues := []string{AgentQueueKey}
+	for _, r := range a.QueueRoutes {
+		if !slices.Contains(queues, r.Queue) {
+			queues = append(queues, r.Queue)
+		}
+	}
+	return queues
+}
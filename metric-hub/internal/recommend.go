@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+// requests are recommended this far above the observed or predicted peak
+const RecommendationHeadroom = 1.3
+
+// recommendations never go below these
+var MinRecommendation = Resources{CPUCores: 0.01, MemoryMB: 32}
+
+// Requests the hub would set for a deployment
+type Recommendation struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Current   Resources `json:"current_requests"`
+	// next step towards the target, within the policy's change limit
+	Requests Resources `json:"recommended_requests"`
+	// where the requests end up once every step is applied
+	Target Resources `json:"target_requests"`
+	// limits to set with Requests, only when the deployment's limits are reported
+	CurrentLimits *ResourceBounds `json:"current_limits,omitempty"`
+	Limits        *Resources      `json:"recommended_limits,omitempty"`
+}
+
+// Peak usage plus headroom, using the predicted peak when it is higher
+// the window's max is the observed peak when the payload has one
+func RecommendRequests(c CostDeployment) Resources {
+	peak := c.RiskUsage()
+	if c.PredictPeak24h != nil {
+		peak.CPUCores = math.Max(peak.CPUCores, c.PredictPeak24h.CPUCores)
+		peak.MemoryMB = math.Max(peak.MemoryMB, c.PredictPeak24h.MemoryMB)
+	}
+	return Resources{
+		CPUCores: math.Max(peak.CPUCores*RecommendationHeadroom, MinRecommendation.CPUCores),
+		MemoryMB: math.Max(peak.MemoryMB*RecommendationHeadroom, MinRecommendation.MemoryMB),
+	}
+}
+
+// Target and next step for a deployment under a policy and namespace constraints
+// an intermediate step is rounded towards the current requests so it never exceeds the limit
+func Recommend(c CostDeployment, policy Policy, constraints *NamespaceConstraints) (target Resources, step Resources) {
+	target = constraints.Apply(policy.Rounding.Quantise(RecommendRequests(c), c.CurrentRequests), c.CurrentRequests)
+	step = policy.MaxChange.Step(target, c.CurrentRequests)
+	if step != target {
+		step = constraints.Apply(policy.Rounding.RoundStep(step, c.CurrentRequests), c.CurrentRequests)
+	}
+	return target, step
+}
+
+// Recommendation for a deployment in the latest cost payload under the active policy
+// the deployment is treated as a single container for the LimitRange
+// nil when the hub has no data for it
+func (a *Aggregator) Recommendation(ctx context.Context, ns string, name string) (*Recommendation, error) {
+	p, err := a.latestCost(ctx)
+	if errors.Is(err, ErrNoCostData) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if p.Namespace != ns {
+		return nil, nil
+	}
+	policy := a.ActivePolicy(ctx)
+	for _, d := range p.Deployments {
+		if d.Name == name {
+			return newRecommendation(ns, d, policy, constraintsOf(p)), nil
+		}
+	}
+	return nil, nil
+}
+
+func newRecommendation(ns string, c CostDeployment, policy Policy, constraints *NamespaceConstraints) *Recommendation {
+	target, step := Recommend(c, policy, constraints)
+	return &Recommendation{
+		Namespace: ns,
+		Name:      c.Name,
+		Current:   c.CurrentRequests,
+		Requests:  step,
+		Target:    target,
+
+		CurrentLimits: c.CurrentLimits,
+		Limits:        RecommendLimits(c, step, policy, constraints),
+	}
+}
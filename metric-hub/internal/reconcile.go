@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/billing"
+)
+
+var ErrNoBillingOverlap = errors.New("billing export doesn't overlap the hub's cost history")
+
+// a cost payload estimates the cluster's cost until the next one, for at most this long
+const estimateMaxAge = time.Hour
+
+// Reconcile an imported bill with the cluster cost reported in cost payloads and store the correction
+func (a *Aggregator) ReconcileBill(ctx context.Context, bill *billing.Bill) (*billing.Correction, error) {
+	hours := make([]time.Time, 0, len(bill.Hours))
+	for h := range bill.Hours {
+		hours = append(hours, h)
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+
+	events, err := a.ReadEvents(ctx, hours[0].Add(-estimateMaxAge), hours[len(hours)-1].Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	c, err := Reconcile(bill, events)
+	if err != nil {
+		return nil, err
+	}
+	c.ImportedAt = a.now().UTC()
+	if err := billing.SaveCorrection(ctx, a.Client, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Billed over estimated cost across the bill's hours that cost payloads fully cover
+// cluster cost is cluster-wide, so a payload for any namespace counts until the next one
+func Reconcile(bill *billing.Bill, events []Event) (*billing.Correction, error) {
+	type hour struct {
+		cost    float64
+		covered time.Duration
+	}
+	estimates := map[time.Time]*hour{}
+	var payloads []Event
+	for _, ev := range events {
+		if ev.Type == EventCostPayload {
+			payloads = append(payloads, ev)
+		}
+	}
+	for i, ev := range payloads {
+		var p CostPayload
+		if err := json.Unmarshal(ev.Data, &p); err != nil {
+			continue
+		}
+		end := ev.Time.Add(estimateMaxAge)
+		if i+1 < len(payloads) && payloads[i+1].Time.Before(end) {
+			end = payloads[i+1].Time
+		}
+		for start := ev.Time; start.Before(end); {
+			h := start.Truncate(time.Hour)
+			next := h.Add(time.Hour)
+			if end.Before(next) {
+				next = end
+			}
+			if estimates[h] == nil {
+				estimates[h] = &hour{}
+			}
+			estimates[h].cost += p.ClusterInfo.Cost * next.Sub(start).Hours()
+			estimates[h].covered += next.Sub(start)
+			start = next
+		}
+	}
+
+	c := &billing.Correction{Provider: bill.Provider}
+	for h, billed := range bill.Hours {
+		e := estimates[h]
+		if e == nil || e.covered < time.Hour {
+			continue
+		}
+		if c.Hours == 0 || h.Before(c.From) {
+			c.From = h
+		}
+		if h.Add(time.Hour).After(c.To) {
+			c.To = h.Add(time.Hour)
+		}
+		c.Hours++
+		c.Billed += billed
+		c.Estimated += e.cost
+	}
+	if c.Hours == 0 || c.Estimated <= 0 {
+		return nil, ErrNoBillingOverlap
+	}
+	c.Factor = c.Billed / c.Estimated
+	return c, nil
+}
+
+func (a *Aggregator) BillingCorrection(ctx context.Context) (*billing.Correction, error) {
+	return billing.LoadCorrection(ctx, a.reader())
+}
+
+func (a *Aggregator) DeleteBillingCorrection(ctx context.Context) error {
+	return billing.DeleteCorrection(ctx, a.Client)
+}
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/billing"
+)
+
+func TestReconcileComparesFullyCoveredHours(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var events []Event
+	// a payload every 15 minutes from 00:30, estimating 1 an hour
+	for m := 30; m < 180; m += 15 {
+		events = append(events, costEvent(t, start.Add(time.Duration(m)*time.Minute), CostPayload{Namespace: "shop", ClusterInfo: ClusterInfo{Cost: 1}}))
+	}
+	bill := &billing.Bill{Provider: billing.ProviderAWS, Hours: map[time.Time]float64{
+		// only half covered by payloads, left out
+		start:                    5,
+		start.Add(time.Hour):     1.2,
+		start.Add(2 * time.Hour): 1.2,
+	}}
+
+	c, err := Reconcile(bill, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Hours != 2 || !c.From.Equal(start.Add(time.Hour)) || !c.To.Equal(start.Add(3*time.Hour)) {
+		t.Errorf("expected hours 01:00 to 03:00, got %d from %v to %v", c.Hours, c.From, c.To)
+	}
+	if math.Abs(c.Factor-1.2) > 1e-9 || math.Abs(c.Estimated-2) > 1e-9 {
+		t.Errorf("expected a factor of 1.2 over an estimate of 2, got %f over %f", c.Factor, c.Estimated)
+	}
+
+	later := &billing.Bill{Hours: map[time.Time]float64{start.Add(48 * time.Hour): 1}}
+	if _, err := Reconcile(later, events); !errors.Is(err, ErrNoBillingOverlap) {
+		t.Errorf("expected no overlap, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// differences beyond this are counted but not listed
+const maxReplayDifferences = 500
+
+// Re-run the trigger logic over logged events with a candidate policy
+// Rules nil replays the rules recorded in the log
+type ReplayRequest struct {
+	Policy *Policy      `json:"policy" validate:"required"`
+	Rules  []CustomRule `json:"rules,omitempty"`
+	From   time.Time    `json:"from"`
+	To     time.Time    `json:"to"`
+}
+
+type ReplayDifference struct {
+	Time       time.Time `json:"time"`
+	Deployment string    `json:"deployment"`
+	Baseline   string    `json:"baseline"`
+	Candidate  string    `json:"candidate"`
+}
+
+type ReplayReport struct {
+	Events            int                `json:"events"`
+	BaselineTriggers  map[string]int     `json:"baseline_triggers"`
+	CandidateTriggers map[string]int     `json:"candidate_triggers"`
+	DifferenceCount   int                `json:"difference_count"`
+	Differences       []ReplayDifference `json:"differences"`
+}
+
+// one side of the comparison with its own simulated cooldowns
+type replaySide struct {
+	policy    Policy
+	rules     map[string]CustomRule
+	compiled  []compiledRule
+	lastFired map[string]time.Time
+	triggers  map[string]int
+}
+
+func newReplaySide(policy Policy, rules map[string]CustomRule) *replaySide {
+	s := &replaySide{
+		policy:    policy,
+		rules:     rules,
+		lastFired: map[string]time.Time{},
+		triggers:  map[string]int{},
+	}
+	s.compile()
+	return s
+}
+
+func (s *replaySide) compile() {
+	s.compiled = compileRules(s.rules)
+}
+
+// reason the deployment would have been pushed for at t, honouring cooldown
+func (s *replaySide) evaluateCost(t time.Time, d CostDeployment) string {
+	// scripts and flags are not versioned in the log and are left out of replays
+	reason := costTriggerReason(context.Background(), d, s.policy, Ruleset{Rules: s.compiled}, Flags{})
+	if reason == "" {
+		return ""
+	}
+	cooldown := time.Duration(s.policy.CooldownSeconds) * time.Second
+	if last, ok := s.lastFired[d.Name]; ok && t.Sub(last) < cooldown {
+		return ""
+	}
+	s.lastFired[d.Name] = t
+	s.triggers[reason]++
+	return reason
+}
+
+// forecast triggers bypass cooldown
+func (s *replaySide) evaluateForecast(f ForecastDeployment, c CostDeployment) string {
+	conditions := EvaluateForecast(f, c, s.policy)
+	if len(conditions) == 0 {
+		return ""
+	}
+	s.triggers[conditions[0].Reason]++
+	return conditions[0].Reason
+}
+
+func (a *Aggregator) Replay(ctx context.Context, req *ReplayRequest) (*ReplayReport, error) {
+	// read from the start so policy and rule changes before the window still apply
+	events, err := a.ReadEvents(ctx, time.Time{}, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	baseline := newReplaySide(DefaultPolicy(), map[string]CustomRule{})
+
+	candidateRules := map[string]CustomRule{}
+	for _, r := range req.Rules {
+		candidateRules[r.Name] = r
+	}
+	candidate := newReplaySide(*req.Policy, candidateRules)
+
+	report := &ReplayReport{Differences: []ReplayDifference{}}
+	var latest *CostPayload
+
+	for _, ev := range events {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		inWindow := req.From.IsZero() || !ev.Time.Before(req.From)
+
+		switch ev.Type {
+		case EventPolicyChanged:
+			policy := DefaultPolicy()
+			if err := json.Unmarshal(ev.Data, &policy); err == nil {
+				baseline.policy = policy
+			}
+
+		case EventRuleSaved, EventRuleDeleted:
+			var r CustomRule
+			if err := json.Unmarshal(ev.Data, &r); err != nil {
+				continue
+			}
+			apply := func(s *replaySide) {
+				if ev.Type == EventRuleSaved {
+					s.rules[r.Name] = r
+				} else {
+					delete(s.rules, r.Name)
+				}
+				s.compile()
+			}
+			apply(baseline)
+			if req.Rules == nil {
+				apply(candidate)
+			}
+
+		case EventCostPayload:
+			var p CostPayload
+			if err := json.Unmarshal(ev.Data, &p); err != nil {
+				fmt.Printf("Skipping unreadable cost event %s: %v\n", ev.ID, err)
+				continue
+			}
+			latest = &p
+			if !inWindow {
+				continue
+			}
+			report.Events++
+			for _, d := range p.Deployments {
+				report.compare(ev.Time, d.Name, baseline.evaluateCost(ev.Time, d), candidate.evaluateCost(ev.Time, d))
+			}
+
+		case EventForecastPayload:
+			if !inWindow || latest == nil {
+				continue
+			}
+			var p ForecastPayload
+			if err := json.Unmarshal(ev.Data, &p); err != nil {
+				fmt.Printf("Skipping unreadable forecast event %s: %v\n", ev.ID, err)
+				continue
+			}
+			report.Events++
+			for _, f := range p.Deployments {
+				for _, c := range latest.Deployments {
+					if c.Name == f.Name {
+						report.compare(ev.Time, c.Name, baseline.evaluateForecast(f, c), candidate.evaluateForecast(f, c))
+					}
+				}
+			}
+		}
+	}
+
+	report.BaselineTriggers = baseline.triggers
+	report.CandidateTriggers = candidate.triggers
+	return report, nil
+}
+
+func (r *ReplayReport) compare(t time.Time, name string, baseline string, candidate string) {
+	if baseline == candidate {
+		return
+	}
+	r.DifferenceCount++
+	if len(r.Differences) < maxReplayDifferences {
+		r.Differences = append(r.Differences, ReplayDifference{
+			Time:       t,
+			Deployment: name,
+			Baseline:   baseline,
+			Candidate:  candidate,
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/redis/go-redis/v9"
+)
+
+// deployments waiting for a human to review a rolled back change
+const ReviewsKey = "reviews:deployments"
+
+// Outcomes the agent reports for an applied job
+const (
+	OutcomeApplied    = "applied"
+	OutcomeRolledBack = "rolled_back"
+	OutcomeDegraded   = "degraded"
+)
+
+// How the hub reacts to a rolled back or degraded change
+type RollbackPolicy struct {
+	// no jobs for the deployment this long after the report
+	HoldSeconds int64 `json:"hold_seconds" validate:"gte=0"`
+	// added to the waste thresholds of the deployment for every report
+	WasteMargin float64 `json:"waste_margin" validate:"gte=0,lte=1"`
+}
+
+func DefaultRollbackPolicy() RollbackPolicy {
+	return RollbackPolicy{HoldSeconds: 86400, WasteMargin: 0.1}
+}
+
+type Outcome struct {
+	JobID      string `json:"job_id"`
+	Namespace  string `json:"namespace" validate:"required"`
+	Deployment string `json:"deployment" validate:"required"`
+	Outcome    string `json:"outcome" validate:"required,oneof=applied rolled_back degraded"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// A deployment flagged after a rollback, cleared once reviewed
+type Review struct {
+	Namespace   string    `json:"namespace"`
+	Deployment  string    `json:"deployment"`
+	Reports     int       `json:"reports"`
+	WasteMargin float64   `json:"waste_margin"`
+	LastOutcome string    `json:"last_outcome"`
+	Detail      string    `json:"detail,omitempty"`
+	JobID       string    `json:"job_id,omitempty"`
+	ReportedAt  time.Time `json:"reported_at"`
+	HoldUntil   time.Time `json:"hold_until"`
+}
+
+// Key - trigger:hold:<namespace>/<name>
+func holdKey(ns string, name string) string {
+	return fmt.Sprintf("trigger:hold:%s/%s", ns, name)
+}
+
+// React to a reported outcome, applied changes need nothing
+// a rollback or degradation holds the deployment, raises its waste thresholds and asks for review
+func (a *Aggregator) RecordOutcome(ctx context.Context, o *Outcome) (*Review, error) {
+	a.resolveRecommendation(ctx, o)
+	if o.Outcome == OutcomeApplied {
+		return nil, nil
+	}
+
+	field := deploymentLockKey(o.Namespace, o.Deployment)
+	review := Review{Namespace: o.Namespace, Deployment: o.Deployment}
+	raw, err := a.Client.HGet(ctx, ReviewsKey, field).Result()
+	if err == nil {
+		if err := json.Unmarshal([]byte(raw), &review); err != nil {
+			fmt.Printf("Replacing invalid review for %s: %v\n", field, err)
+		}
+	} else if err != redis.Nil {
+		return nil, fmt.Errorf("failed to get review %w", err)
+	}
+
+	rp := a.ActivePolicy(ctx).Rollback
+	now := a.now().UTC()
+	hold := time.Duration(rp.HoldSeconds) * time.Second
+	review.Reports++
+	review.WasteMargin = math.Min(review.WasteMargin+rp.WasteMargin, 1)
+	review.LastOutcome = o.Outcome
+	review.Detail = o.Detail
+	review.JobID = o.JobID
+	review.ReportedAt = now
+	review.HoldUntil = now.Add(hold)
+
+	jsonData, err := json.Marshal(review)
+	if err != nil {
+		return nil, fmt.Errorf("[Failed] to marshal review: %w", err)
+	}
+	pipe := a.Client.TxPipeline()
+	pipe.HSet(ctx, ReviewsKey, field, jsonData)
+	if hold > 0 {
+		pipe.Set(ctx, holdKey(o.Namespace, o.Deployment), now.Unix(), hold)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+
+	a.notifyReview(ctx, review)
+	return &review, nil
+}
+
+func (a *Aggregator) notifyReview(ctx context.Context, r Review) {
+	if a.Notifier == nil {
+		return
+	}
+	err := a.Notifier.Notify(ctx, notify.Notification{
+		Severity: notify.SeverityWarning,
+		Title:    "Change needs review",
+		Message: fmt.Sprintf("%s/%s reported %s (%d reports), jobs held until %s and waste thresholds raised by %.2f",
+			r.Namespace, r.Deployment, r.LastOutcome, r.Reports, r.HoldUntil.Format(time.RFC3339), r.WasteMargin),
+		Labels:    a.ownerOf(ctx, r.Namespace, r.Deployment, nil).labels(map[string]string{"namespace": r.Namespace, "deployment": r.Deployment, "job_id": r.JobID}),
+		Timestamp: r.ReportedAt,
+	})
+	if err != nil {
+		fmt.Printf("Failed to send review notification %v\n", err)
+	}
+}
+
+func (a *Aggregator) ListReviews(ctx context.Context) ([]Review, error) {
+	raw, err := a.Client.HGetAll(ctx, ReviewsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reviews %w", err)
+	}
+	reviews := make([]Review, 0, len(raw))
+	for field, data := range raw {
+		var r Review
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			fmt.Printf("Skipping invalid review for %s: %v\n", field, err)
+			continue
+		}
+		reviews = append(reviews, r)
+	}
+	sort.Slice(reviews, func(i, j int) bool { return reviews[i].ReportedAt.After(reviews[j].ReportedAt) })
+	return reviews, nil
+}
+
+// Mark a deployment reviewed, restoring its thresholds and lifting the hold
+func (a *Aggregator) ResolveReview(ctx context.Context, ns string, name string) error {
+	pipe := a.Client.TxPipeline()
+	pipe.HDel(ctx, ReviewsKey, deploymentLockKey(ns, name))
+	pipe.Del(ctx, holdKey(ns, name))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("[Failed] HDEL redis: %w", err)
+	}
+	return nil
+}
+
+// Waste threshold margins per <namespace>/<name>, empty when none can be loaded
+type Sensitivity map[string]float64
+
+func (a *Aggregator) loadSensitivity(ctx context.Context) Sensitivity {
+	reviews, err := a.ListReviews(ctx)
+	if err != nil {
+		fmt.Printf("Failed to load reviews, using policy thresholds %v\n", err)
+		return Sensitivity{}
+	}
+	s := make(Sensitivity, len(reviews))
+	for _, r := range reviews {
+		s[deploymentLockKey(r.Namespace, r.Deployment)] = r.WasteMargin
+	}
+	return s
+}
+
+// Policy for a deployment with its waste thresholds raised by its margin
+// only downscaling is made less sensitive, risk thresholds are unchanged
+func (s Sensitivity) Apply(ns string, name string, p Policy) Policy {
+	margin, ok := s[deploymentLockKey(ns, name)]
+	if !ok || margin <= 0 {
+		return p
+	}
+	p.MemoryWaste = math.Min(p.MemoryWaste+margin, 1)
+	p.CPUWaste = math.Min(p.CPUWaste+margin, 1)
+	p.ForecastWasteMin = math.Min(p.ForecastWasteMin+margin, 1)
+	return p
+}
+
+// errors are treated as not held, the cooldown still applies
+func (a *Aggregator) onHold(ctx context.Context, ns string, name string) bool {
+	n, err := a.Client.Exists(ctx, holdKey(ns, name)).Result()
+	if err != nil {
+		fmt.Printf("Redis error %v\n", err)
+		return false
+	}
+	return n > 0
+}
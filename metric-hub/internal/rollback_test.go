@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSensitivityRaisesWasteThresholdsOnly(t *testing.T) {
+	s := Sensitivity{"default/cartservice": 0.3}
+	base := DefaultPolicy()
+
+	p := s.Apply("default", "cartservice", base)
+	if p.MemoryWaste != 0.8 || p.CPUWaste != 0.8 || p.ForecastWasteMin != 0.7 {
+		t.Errorf("expected waste thresholds raised by 0.3, got %+v", p)
+	}
+	if p.MemoryRisk != base.MemoryRisk || p.CPURisk != base.CPURisk {
+		t.Errorf("expected risk thresholds unchanged, got %+v", p)
+	}
+
+	d := CostDeployment{
+		Name:            "cartservice",
+		CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000},
+		CurrentUsage:    Resources{CPUCores: 0.5, MemoryMB: 300},
+	}
+	if reason := costTriggerReason(context.Background(), d, p, Ruleset{}, Flags{}); reason != "" {
+		t.Errorf("expected 70%% memory waste not to trigger, got %q", reason)
+	}
+
+	if other := s.Apply("default", "frontend", base); other.MemoryWaste != base.MemoryWaste || other.CPUWaste != base.CPUWaste {
+		t.Errorf("expected other deployments unchanged, got %+v", other)
+	}
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// How far a deployment is through its latest rollout, from metadata.generation and its status
+type Rollout struct {
+	// a new value means the spec changed and pods are being replaced
+	Generation int64 `json:"generation" validate:"gte=1"`
+	// when the rollout began, the first payload carrying the generation when left out
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// status.observedGeneration behind generation or updatedReplicas below replicas
+	InProgress bool `json:"in_progress,omitempty"`
+}
+
+// a deployment's generation is remembered this long after its last payload
+const RolloutExpiry = 7 * 24 * time.Hour
+
+// Key - rollout:<namespace>/<name>, "<generation> <start unix millis>" of the last rollout seen
+// the start is 0 when the generation was already there the first time the hub saw the deployment
+func rolloutKey(ns string, name string) string {
+	return "rollout:" + deploymentLockKey(ns, name)
+}
+
+// True while the deployment is rolling out or less than grace has passed since it started
+// usage during churn mixes old and new pods, so it isn't what the deployment needs
+func (a *Aggregator) rollingOut(ctx context.Context, ns string, deployment CostDeployment, grace time.Duration) bool {
+	r := deployment.Rollout
+	if r == nil {
+		return false
+	}
+	if r.InProgress {
+		return true
+	}
+	now := a.now()
+	started := a.rolloutStart(ctx, ns, deployment.Name, r, now)
+	return !started.IsZero() && now.Before(started.Add(grace))
+}
+
+// start of the deployment's current rollout, zero when unknown
+// a generation seen for the first time is taken to start now, unless it is the first one seen at all
+func (a *Aggregator) rolloutStart(ctx context.Context, ns string, name string, r *Rollout, now time.Time) time.Time {
+	key := rolloutKey(ns, name)
+	raw, err := a.Client.Get(ctx, key).Result()
+	if err != nil && err != redis.Nil {
+		fmt.Printf("Redis error %v\n", err)
+	}
+	gen, start := parseRollout(raw)
+
+	var started time.Time
+	switch {
+	case r.StartedAt != nil:
+		started = *r.StartedAt
+	case gen == r.Generation:
+		if start > 0 {
+			started = time.UnixMilli(start)
+		}
+	case gen > 0:
+		started = now
+	}
+	if gen != r.Generation || r.StartedAt != nil {
+		var millis int64
+		if !started.IsZero() {
+			millis = started.UnixMilli()
+		}
+		raw = strconv.FormatInt(r.Generation, 10) + " " + strconv.FormatInt(millis, 10)
+	}
+	if err := a.Client.Set(ctx, key, raw, RolloutExpiry).Err(); err != nil {
+		fmt.Printf("[Failed] SET redis: %v\n", err)
+	}
+	return started
+}
+
+func parseRollout(raw string) (generation int64, start int64) {
+	g, s, _ := strings.Cut(raw, " ")
+	generation, _ = strconv.ParseInt(g, 10, 64)
+	start, _ = strconv.ParseInt(s, 10, 64)
+	return generation, start
+}
@@ -0,0 +1,119 @@
+package internal
+
+import "math"
+
+// Quantisation of recommended values so patches look hand written
+// steps of 0 leave that resource unrounded
+type Rounding struct {
+	CPUStepMillicores int64 `json:"cpu_step_millicores" validate:"gte=0"`
+	MemoryStepMB      int64 `json:"memory_step_mb" validate:"gte=0"`
+	// round memory up to a power of two instead of a multiple of the step
+	MemoryPowerOfTwo bool `json:"memory_power_of_two"`
+}
+
+func DefaultRounding() Rounding {
+	return Rounding{CPUStepMillicores: 50, MemoryStepMB: 64}
+}
+
+// Round up to the next step, never down, so the headroom is kept
+func (r Rounding) Round(v Resources) Resources {
+	return Resources{
+		CPUCores: r.roundCPU(v.CPUCores),
+		MemoryMB: r.roundMemory(v.MemoryMB),
+	}
+}
+
+// Round a recommendation, keeping the current value when the change is under one step
+func (r Rounding) Quantise(rec Resources, current Resources) Resources {
+	rounded := r.Round(rec)
+	if r.CPUStepMillicores > 0 && math.Abs(rounded.CPUCores-current.CPUCores) < float64(r.CPUStepMillicores)/1000 {
+		rounded.CPUCores = current.CPUCores
+	}
+	if r.MemoryPowerOfTwo {
+		if r.roundMemory(current.MemoryMB) == rounded.MemoryMB {
+			rounded.MemoryMB = current.MemoryMB
+		}
+	} else if r.MemoryStepMB > 0 && math.Abs(rounded.MemoryMB-current.MemoryMB) < float64(r.MemoryStepMB) {
+		rounded.MemoryMB = current.MemoryMB
+	}
+	return rounded
+}
+
+// Round an intermediate step towards current so it stays within the change limit
+// a step that would round back to current is left unrounded so it still makes progress
+func (r Rounding) RoundStep(step Resources, current Resources) Resources {
+	rounded := r.Round(step)
+	if step.CPUCores > current.CPUCores && rounded.CPUCores > step.CPUCores {
+		rounded.CPUCores -= float64(r.CPUStepMillicores) / 1000
+	}
+	if step.MemoryMB > current.MemoryMB && rounded.MemoryMB > step.MemoryMB {
+		if r.MemoryPowerOfTwo {
+			rounded.MemoryMB /= 2
+		} else {
+			rounded.MemoryMB -= float64(r.MemoryStepMB)
+		}
+	}
+	if rounded.CPUCores == current.CPUCores || (rounded.CPUCores-current.CPUCores)*(step.CPUCores-current.CPUCores) < 0 {
+		rounded.CPUCores = step.CPUCores
+	}
+	if rounded.MemoryMB == current.MemoryMB || (rounded.MemoryMB-current.MemoryMB)*(step.MemoryMB-current.MemoryMB) < 0 {
+		rounded.MemoryMB = step.MemoryMB
+	}
+	return rounded
+}
+
+func (r Rounding) roundCPU(cores float64) float64 {
+	if r.CPUStepMillicores <= 0 || cores <= 0 {
+		return cores
+	}
+	step := float64(r.CPUStepMillicores)
+	return math.Ceil(math.Round(cores*1000)/step) * step / 1000
+}
+
+func (r Rounding) roundMemory(mb float64) float64 {
+	if mb <= 0 {
+		return mb
+	}
+	if r.MemoryPowerOfTwo {
+		return math.Pow(2, math.Ceil(math.Log2(mb)))
+	}
+	if r.MemoryStepMB <= 0 {
+		return mb
+	}
+	step := float64(r.MemoryStepMB)
+	return math.Ceil(mb/step) * step
+}
+
+// Largest change to a request in one step, as a fraction of the current request
+// 0 leaves that direction unlimited, larger gaps close over several cooldown cycles
+type ChangeLimit struct {
+	Decrease float64 `json:"decrease" validate:"gte=0,lt=1"`
+	Increase float64 `json:"increase" validate:"gte=0"`
+}
+
+// reductions are limited to 30%, increases are not so under-provisioning is fixed at once
+func DefaultChangeLimit() ChangeLimit {
+	return ChangeLimit{Decrease: 0.3}
+}
+
+// Move from current towards rec by no more than the limit
+// requests that are unset have nothing to step from and are left alone
+func (l ChangeLimit) Step(rec Resources, current Resources) Resources {
+	return Resources{
+		CPUCores: l.step(rec.CPUCores, current.CPUCores),
+		MemoryMB: l.step(rec.MemoryMB, current.MemoryMB),
+	}
+}
+
+func (l ChangeLimit) step(rec float64, current float64) float64 {
+	if current <= 0 {
+		return rec
+	}
+	if rec < current && l.Decrease > 0 {
+		return math.Max(rec, current*(1-l.Decrease))
+	}
+	if rec > current && l.Increase > 0 {
+		return math.Min(rec, current*(1+l.Increase))
+	}
+	return rec
+}
@@ -0,0 +1,61 @@
+package internal
+
+import "testing"
+
+func TestRoundingRoundsUpToSteps(t *testing.T) {
+	r := DefaultRounding()
+	got := r.Round(Resources{CPUCores: 0.123, MemoryMB: 130})
+	if got.CPUCores != 0.15 || got.MemoryMB != 192 {
+		t.Errorf("expected 150m and 192Mi, got %+v", got)
+	}
+
+	r.MemoryPowerOfTwo = true
+	if got := r.Round(Resources{MemoryMB: 300}); got.MemoryMB != 512 {
+		t.Errorf("expected 512Mi, got %v", got.MemoryMB)
+	}
+}
+
+func TestQuantiseKeepsCurrentWithinOneStep(t *testing.T) {
+	r := DefaultRounding()
+	current := Resources{CPUCores: 0.52, MemoryMB: 500}
+
+	got := r.Quantise(Resources{CPUCores: 0.49, MemoryMB: 470}, current)
+	if got != current {
+		t.Errorf("expected current requests kept, got %+v", got)
+	}
+
+	got = r.Quantise(Resources{CPUCores: 0.2, MemoryMB: 200}, current)
+	if got.CPUCores != 0.2 || got.MemoryMB != 256 {
+		t.Errorf("expected 200m and 256Mi, got %+v", got)
+	}
+}
+
+func TestRecommendLimitsReductionPerStep(t *testing.T) {
+	c := CostDeployment{
+		Name:            "cartservice",
+		CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1024},
+		CurrentUsage:    Resources{CPUCores: 0.1, MemoryMB: 100},
+	}
+
+	target, step := Recommend(c, DefaultPolicy(), nil)
+	if target.CPUCores != 0.15 || target.MemoryMB != 192 {
+		t.Errorf("unexpected target %+v", target)
+	}
+	if step.CPUCores != 0.7 || step.MemoryMB != 768 {
+		t.Errorf("expected a 30%% step rounded towards current, got %+v", step)
+	}
+
+	policy := DefaultPolicy()
+	policy.MaxChange = ChangeLimit{}
+	if _, step := Recommend(c, policy, nil); step != target {
+		t.Errorf("expected the target with no change limit, got %+v", step)
+	}
+}
+
+func TestRoundStepNeverRoundsBackToCurrent(t *testing.T) {
+	r := DefaultRounding()
+	got := r.RoundStep(Resources{CPUCores: 0.07, MemoryMB: 89.6}, Resources{CPUCores: 0.1, MemoryMB: 128})
+	if got.CPUCores != 0.07 || got.MemoryMB != 89.6 {
+		t.Errorf("expected the unrounded step, got %+v", got)
+	}
+}
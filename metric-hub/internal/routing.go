@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+)
+
+const RoutingRulesKey = "routing:rules"
+
+// How a routed job may be applied
+const (
+	// the agent opens its change as usual
+	ApprovalAuto = "auto"
+	// the change needs a reviewer before it is merged
+	ApprovalManual = "manual"
+	// the job only reports, as when the PDB allows no disruptions
+	ApprovalNotifyOnly = "notify_only"
+)
+
+// returned when a routing rule names a channel the hub has no sink for
+var ErrUnknownChannel = errors.New("unknown notification channel")
+
+// Decides the channels and approval for the jobs it matches
+// empty match fields match everything, rules are evaluated in name order and the first match wins
+type RoutingRule struct {
+	Name       string   `json:"name" validate:"required"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	// matched against the deployment's payload labels and its owner's team
+	Labels      map[string]string `json:"labels,omitempty"`
+	MinSeverity notify.Severity   `json:"min_severity,omitempty" validate:"omitempty,oneof=info warning critical"`
+	Reasons     []string          `json:"reasons,omitempty"`
+	// notification sinks told about the job, e.g. slack or pagerduty
+	Channels []string `json:"channels,omitempty"`
+	Approval string   `json:"approval,omitempty" validate:"omitempty,oneof=auto manual notify_only"`
+}
+
+// Outcome of the routing rule matching a job
+type Routing struct {
+	Rule     string   `json:"rule"`
+	Channels []string `json:"channels,omitempty"`
+	Approval string   `json:"approval,omitempty"`
+}
+
+func (r RoutingRule) matches(job AgentJob, labels map[string]string) bool {
+	if len(r.Namespaces) > 0 && !slices.Contains(r.Namespaces, job.Namespace) {
+		return false
+	}
+	if len(r.Reasons) > 0 && !slices.Contains(r.Reasons, job.Reason) {
+		return false
+	}
+	if !job.Severity().AtLeast(r.MinSeverity) {
+		return false
+	}
+	for k, v := range r.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Register or replace a routing rule
+// Key - routing:rules
+// Field - <rule name>
+func (a *Aggregator) SaveRoutingRule(ctx context.Context, r *RoutingRule) error {
+	for _, channel := range r.Channels {
+		if _, ok := a.Channels[channel]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownChannel, channel)
+		}
+	}
+	jsonData, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal routing rule: %w", err)
+	}
+	if err := a.Client.HSet(ctx, RoutingRulesKey, r.Name, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) DeleteRoutingRule(ctx context.Context, name string) error {
+	return a.Client.HDel(ctx, RoutingRulesKey, name).Err()
+}
+
+// Routing rules in evaluation order
+func (a *Aggregator) ListRoutingRules(ctx context.Context) ([]RoutingRule, error) {
+	raw, err := a.Client.HGetAll(ctx, RoutingRulesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get routing rules %w", err)
+	}
+
+	rules := make([]RoutingRule, 0, len(raw))
+	for name, data := range raw {
+		var r RoutingRule
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			fmt.Printf("Skipping invalid routing rule %s: %v\n", name, err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules, nil
+}
+
+// Routing of the first rule matching the job, nil when none does
+func (a *Aggregator) routeJob(ctx context.Context, job AgentJob) *Routing {
+	rules, err := a.ListRoutingRules(ctx)
+	if err != nil {
+		fmt.Printf("Failed to load routing rules %v\n", err)
+		return nil
+	}
+
+	labels := map[string]string{}
+	if job.Deployment != nil {
+		for k, v := range job.Deployment.Labels {
+			labels[k] = v
+		}
+	}
+	if job.Ownership != nil && job.Ownership.Team != "" {
+		labels[LabelTeam] = job.Ownership.Team
+	}
+	for _, r := range rules {
+		if r.matches(job, labels) {
+			return &Routing{Rule: r.Name, Channels: r.Channels, Approval: r.Approval}
+		}
+	}
+	return nil
+}
+
+// Tell the routing's channels about a published job, sinks' own routes don't apply
+func (a *Aggregator) notifyRouted(ctx context.Context, job AgentJob) {
+	if job.Routing == nil || len(job.Routing.Channels) == 0 {
+		return
+	}
+	target := job.Namespace
+	if job.Deployment != nil {
+		target = job.Namespace + "/" + job.Deployment.Name
+	}
+	if target == "" {
+		target = string(job.TargetType)
+	}
+	labels := map[string]string{"reason": job.Reason, "rule": job.Routing.Rule}
+	if job.Routing.Approval != "" {
+		labels["approval"] = job.Routing.Approval
+	}
+	if job.Namespace != "" {
+		labels["namespace"] = job.Namespace
+	}
+	if job.Deployment != nil {
+		labels["deployment"] = job.Deployment.Name
+	}
+	n := notify.Notification{
+		Severity:  job.Severity(),
+		Title:     fmt.Sprintf("%s on %s", job.Reason, target),
+		Message:   fmt.Sprintf("%s: %s, job sent to the agent (%s)", target, job.Reason, job.Action),
+		Labels:    job.Ownership.labels(labels),
+		Timestamp: a.now().UTC(),
+		DedupKey:  target + ":job:" + job.Reason,
+	}
+	for _, channel := range job.Routing.Channels {
+		sink, ok := a.Channels[channel]
+		if !ok {
+			fmt.Printf("Routing rule %s names unknown channel %s\n", job.Routing.Rule, channel)
+			continue
+		}
+		if err := sink.Notify(ctx, n); err != nil {
+			fmt.Printf("Failed to send %s notification %v\n", channel, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/expr"
+)
+
+const CustomRulesKey = "rules:custom"
+
+// Expression-based trigger over built-in and custom metrics
+// e.g. {"expression": "queue_lag > 1000 && cpu_util < 0.2", "reason": "Idle Consumer"}
+type CustomRule struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression" validate:"required"`
+	Reason     string `json:"reason" validate:"required"`
+}
+
+// Variables a rule can reference for a deployment
+// custom metrics are exposed under their own names
+func RuleEnv(c CostDeployment) expr.Env {
+	env := expr.Env{
+		"cpu_request":    c.CurrentRequests.CPUCores,
+		"cpu_usage":      c.CurrentUsage.CPUCores,
+		"memory_request": c.CurrentRequests.MemoryMB,
+		"memory_usage":   c.CurrentUsage.MemoryMB,
+		"request_rate":   c.RequestRate,
+		"latency_p95_ms": c.LatencyP95Ms,
+		"latency_slo_ms": c.LatencySLOMs,
+	}
+	if c.CurrentRequests.CPUCores > 0 {
+		env["cpu_util"] = c.CurrentUsage.CPUCores / c.CurrentRequests.CPUCores
+		env["cpu_waste"] = 1 - env["cpu_util"]
+	}
+	if c.CurrentRequests.MemoryMB > 0 {
+		env["memory_util"] = c.CurrentUsage.MemoryMB / c.CurrentRequests.MemoryMB
+		env["memory_waste"] = 1 - env["memory_util"]
+	}
+	// fall back to current usage when the payload has no window statistics
+	env["cpu_usage_p95"], env["memory_usage_p95"] = c.WasteUsage().CPUCores, c.WasteUsage().MemoryMB
+	env["cpu_usage_max"], env["memory_usage_max"] = c.RiskUsage().CPUCores, c.RiskUsage().MemoryMB
+	for name, v := range c.CustomMetrics {
+		env[name] = v
+	}
+	return env
+}
+
+// Register or replace a rule
+// Key - rules:custom
+// Field - <rule name>
+func (a *Aggregator) SaveRule(ctx context.Context, r *CustomRule) error {
+	if _, err := expr.Compile(r.Expression); err != nil {
+		return fmt.Errorf("invalid expression: %w", err)
+	}
+	jsonData, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal rule: %w", err)
+	}
+	if err := a.Client.HSet(ctx, CustomRulesKey, r.Name, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	a.recordEvent(ctx, EventRuleSaved, r)
+	return nil
+}
+
+func (a *Aggregator) DeleteRule(ctx context.Context, name string) error {
+	if err := a.Client.HDel(ctx, CustomRulesKey, name).Err(); err != nil {
+		return err
+	}
+	a.recordEvent(ctx, EventRuleDeleted, CustomRule{Name: name})
+	return nil
+}
+
+func (a *Aggregator) ListRules(ctx context.Context) ([]CustomRule, error) {
+	raw, err := a.Client.HGetAll(ctx, CustomRulesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rules %w", err)
+	}
+
+	rules := make([]CustomRule, 0, len(raw))
+	for name, data := range raw {
+		var r CustomRule
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			fmt.Printf("Skipping invalid rule %s: %v\n", name, err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules, nil
+}
+
+type compiledRule struct {
+	CustomRule
+	expr expr.Expr
+}
+
+func (a *Aggregator) loadCompiledRules(ctx context.Context) []compiledRule {
+	rules, err := a.ListRules(ctx)
+	if err != nil {
+		fmt.Printf("Failed to load custom rules %v\n", err)
+		return nil
+	}
+
+	byName := make(map[string]CustomRule, len(rules))
+	for _, r := range rules {
+		byName[r.Name] = r
+	}
+	return compileRules(byName)
+}
+
+// compile rules in name order, skipping invalid expressions
+func compileRules(rules map[string]CustomRule) []compiledRule {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, name := range names {
+		r := rules[name]
+		e, err := expr.Compile(r.Expression)
+		if err != nil {
+			fmt.Printf("Skipping rule %s: %v\n", r.Name, err)
+			continue
+		}
+		compiled = append(compiled, compiledRule{CustomRule: r, expr: e})
+	}
+	return compiled
+}
+
+// first matching rule's reason, or "" when none match
+// rules referencing metrics the deployment doesn't report never match
+func matchCustomRules(rules []compiledRule, c CostDeployment) string {
+	if len(rules) == 0 {
+		return ""
+	}
+	env := RuleEnv(c)
+	for _, r := range rules {
+		ok, err := expr.EvalBool(r.expr, env)
+		if err != nil {
+			continue
+		}
+		if ok {
+			return r.Reason
+		}
+	}
+	return ""
+}
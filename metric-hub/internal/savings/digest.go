@@ -0,0 +1,85 @@
+package savings
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+)
+
+// only one replica sends each digest
+const digestLockKey = "savings:digest:lock"
+
+// entries listed per scope in the digest
+const digestEntries = 5
+
+// Run sends the savings digest every interval until ctx is cancelled
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// held for most of the interval so other replicas skip this period
+		locked, err := t.Client.SetNX(ctx, digestLockKey, clock.Now(t.Clock).Unix(), interval*9/10).Result()
+		if err != nil {
+			fmt.Printf("[Savings] digest lock failed %v\n", err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+		if err := t.SendDigest(ctx); err != nil {
+			fmt.Printf("[Savings] digest failed %v\n", err)
+		}
+	}
+}
+
+func (t *Tracker) SendDigest(ctx context.Context) error {
+	if t.Notifier == nil {
+		return nil
+	}
+	report, err := t.Report(ctx)
+	if err != nil {
+		return err
+	}
+	return t.Notifier.Notify(ctx, notify.Notification{
+		Severity:  notify.SeverityInfo,
+		Title:     "Savings digest",
+		Message:   Digest(report),
+		Timestamp: report.GeneratedAt,
+	})
+}
+
+// Digest renders the leaderboard as a short plain text message
+func Digest(r *Report) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Realised savings to date: %.2f", r.Realised)
+	for _, section := range []struct {
+		title   string
+		entries []Entry
+	}{{"Namespaces", r.Namespaces}, {"Teams", r.Teams}} {
+		if len(section.entries) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:", section.title)
+		for i, e := range section.entries {
+			if i == digestEntries {
+				break
+			}
+			fmt.Fprintf(&b, "\n%d. %s %.2f (%.4f/h)", i+1, e.Name, e.Realised, e.HourlySavings)
+			if e.Goal != nil {
+				fmt.Fprintf(&b, ", %.0f%% of %.2f goal", e.Progress*100, e.Goal.Target)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,325 @@
+// Package savings tracks savings realised by applied recommendations against goals
+package savings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/billing"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/notify"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	FeedbackKey = "savings:feedback"
+	GoalsKey    = "savings:goals"
+)
+
+// Goal scopes
+const (
+	ScopeNamespace = "namespace"
+	ScopeTeam      = "team"
+)
+
+// scope of per-deployment entries, goals can't be set for it
+const ScopeDeployment = "deployment"
+
+// Reported by the agent once a recommendation is applied
+// savings accrue at HourlySavings from AppliedAt onwards
+type Feedback struct {
+	JobID         string    `json:"job_id" validate:"required"`
+	Namespace     string    `json:"namespace" validate:"required"`
+	Deployment    string    `json:"deployment" validate:"required"`
+	Team          string    `json:"team,omitempty"`
+	HourlySavings float64   `json:"hourly_savings"`
+	AppliedAt     time.Time `json:"applied_at"`
+}
+
+// Savings target for a namespace or team, Deadline is optional
+type Goal struct {
+	Scope    string     `json:"scope" validate:"required,oneof=namespace team"`
+	Name     string     `json:"name" validate:"required"`
+	Target   float64    `json:"target" validate:"gt=0"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+func (g Goal) field() string {
+	return g.Scope + ":" + g.Name
+}
+
+// One row of the savings leaderboard
+type Entry struct {
+	Scope    string  `json:"scope"`
+	Name     string  `json:"name"`
+	Realised float64 `json:"realised"`
+	// current hourly run rate of applied recommendations
+	HourlySavings float64 `json:"hourly_savings"`
+	Changes       int     `json:"changes"`
+	Goal          *Goal   `json:"goal,omitempty"`
+	// realised as a fraction of the goal target
+	Progress float64 `json:"progress,omitempty"`
+}
+
+type Report struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Realised    float64   `json:"realised"`
+	Namespaces  []Entry   `json:"namespaces"`
+	Teams       []Entry   `json:"teams"`
+	// billed over estimated cost from the last imported bill, savings are already scaled by it
+	CorrectionFactor float64 `json:"correction_factor,omitempty"`
+}
+
+type Tracker struct {
+	Client   *redis.Client
+	Notifier notify.Notifier
+	// time source, the system clock when nil
+	Clock clock.Clock
+}
+
+func NewTracker(client *redis.Client, notifier notify.Notifier) *Tracker {
+	return &Tracker{Client: client, Notifier: notifier}
+}
+
+// Record feedback for an applied job, reporting a job again replaces it
+// Key - savings:feedback
+// Field - <job id>, Value - feedback JSON
+func (t *Tracker) Record(ctx context.Context, f *Feedback) error {
+	if f.AppliedAt.IsZero() {
+		f.AppliedAt = clock.Now(t.Clock).UTC()
+	}
+	jsonData, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal feedback: %w", err)
+	}
+	if err := t.Client.HSet(ctx, FeedbackKey, f.JobID, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+// Key - savings:goals
+// Field - <scope>:<name>, Value - goal JSON
+func (t *Tracker) SaveGoal(ctx context.Context, g *Goal) error {
+	jsonData, err := json.Marshal(g)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal goal: %w", err)
+	}
+	if err := t.Client.HSet(ctx, GoalsKey, g.field(), jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (t *Tracker) DeleteGoal(ctx context.Context, scope string, name string) error {
+	if err := t.Client.HDel(ctx, GoalsKey, scope+":"+name).Err(); err != nil {
+		return fmt.Errorf("[Failed] HDEL redis: %w", err)
+	}
+	return nil
+}
+
+func (t *Tracker) Goals(ctx context.Context) ([]Goal, error) {
+	raw, err := t.Client.HGetAll(ctx, GoalsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get savings goals %w", err)
+	}
+	goals := make([]Goal, 0, len(raw))
+	for _, v := range raw {
+		var g Goal
+		if err := json.Unmarshal([]byte(v), &g); err != nil {
+			continue
+		}
+		goals = append(goals, g)
+	}
+	return goals, nil
+}
+
+func (t *Tracker) feedback(ctx context.Context) ([]Feedback, error) {
+	raw, err := t.Client.HGetAll(ctx, FeedbackKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get savings feedback %w", err)
+	}
+	feedback := make([]Feedback, 0, len(raw))
+	for _, v := range raw {
+		var f Feedback
+		if err := json.Unmarshal([]byte(v), &f); err != nil {
+			continue
+		}
+		feedback = append(feedback, f)
+	}
+	return feedback, nil
+}
+
+// Leaderboard of realised savings per namespace and team
+func (t *Tracker) Report(ctx context.Context) (*Report, error) {
+	feedback, err := t.feedback(ctx)
+	if err != nil {
+		return nil, err
+	}
+	goals, err := t.Goals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	correction, err := billing.LoadCorrection(ctx, t.Client)
+	if err != nil {
+		return nil, err
+	}
+	report := BuildReport(feedback, goals, clock.Now(t.Clock))
+	if correction != nil {
+		report.Calibrate(correction.Factor)
+	}
+	return report, nil
+}
+
+// Savings realised per deployment, scaled to billed cost like the report
+func (t *Tracker) DeploymentSavings(ctx context.Context) (map[string]Entry, error) {
+	feedback, err := t.feedback(ctx)
+	if err != nil {
+		return nil, err
+	}
+	correction, err := billing.LoadCorrection(ctx, t.Client)
+	if err != nil {
+		return nil, err
+	}
+	entries := BuildDeploymentSavings(feedback, clock.Now(t.Clock))
+	if correction != nil {
+		for key, e := range entries {
+			e.Realised *= correction.Factor
+			e.HourlySavings *= correction.Factor
+			entries[key] = e
+		}
+	}
+	return entries, nil
+}
+
+// average hours in a month, for monthly run rates
+const HoursPerMonth = 730
+
+// Monthly run rate of every applied recommendation, each deployment counted once
+func (r *Report) MonthlyRunRate() float64 {
+	var hourly float64
+	for _, e := range r.Namespaces {
+		hourly += e.HourlySavings
+	}
+	return hourly * HoursPerMonth
+}
+
+// Scale savings estimated from the hub's cluster cost to billed cost
+func (r *Report) Calibrate(factor float64) {
+	r.CorrectionFactor = factor
+	r.Realised *= factor
+	for _, entries := range [][]Entry{r.Namespaces, r.Teams} {
+		for i := range entries {
+			e := &entries[i]
+			e.Realised *= factor
+			e.HourlySavings *= factor
+			if e.Goal != nil {
+				e.Progress = e.Realised / e.Goal.Target
+			}
+		}
+	}
+}
+
+// Savings realised by a change up to now
+// a later change to the same deployment takes over, so earlier feedback stops accruing then
+func BuildReport(feedback []Feedback, goals []Goal, now time.Time) *Report {
+	byScope := map[string]map[string]*Entry{ScopeNamespace: {}, ScopeTeam: {}}
+	entry := func(scope string, name string) *Entry {
+		if byScope[scope][name] == nil {
+			byScope[scope][name] = &Entry{Scope: scope, Name: name}
+		}
+		return byScope[scope][name]
+	}
+
+	report := &Report{GeneratedAt: now.UTC()}
+	accrue(feedback, now, func(f Feedback, realised float64, current bool) {
+		report.Realised += realised
+
+		scopes := map[string]string{ScopeNamespace: f.Namespace}
+		if f.Team != "" {
+			scopes[ScopeTeam] = f.Team
+		}
+		for scope, name := range scopes {
+			e := entry(scope, name)
+			e.Realised += realised
+			e.Changes++
+			if current {
+				e.HourlySavings += f.HourlySavings
+			}
+		}
+	})
+
+	for _, g := range goals {
+		e := entry(g.Scope, g.Name)
+		goal := g
+		e.Goal = &goal
+		e.Progress = e.Realised / g.Target
+	}
+
+	report.Namespaces = sorted(byScope[ScopeNamespace])
+	report.Teams = sorted(byScope[ScopeTeam])
+	return report
+}
+
+// Savings realised per deployment up to now, keyed by <namespace>/<name>
+func BuildDeploymentSavings(feedback []Feedback, now time.Time) map[string]Entry {
+	entries := map[string]Entry{}
+	accrue(feedback, now, func(f Feedback, realised float64, current bool) {
+		key := f.Namespace + "/" + f.Deployment
+		e := entries[key]
+		e.Scope, e.Name = ScopeDeployment, key
+		e.Realised += realised
+		e.Changes++
+		if current {
+			e.HourlySavings += f.HourlySavings
+		}
+		entries[key] = e
+	})
+	return entries
+}
+
+// call fn with what each feedback realised, oldest first, and whether it is its deployment's latest change
+func accrue(feedback []Feedback, now time.Time, fn func(f Feedback, realised float64, current bool)) {
+	sort.Slice(feedback, func(i, j int) bool { return feedback[i].AppliedAt.Before(feedback[j].AppliedAt) })
+
+	latest := map[string]int{}
+	for i, f := range feedback {
+		latest[f.Namespace+"/"+f.Deployment] = i
+	}
+
+	for i, f := range feedback {
+		end := now
+		current := latest[f.Namespace+"/"+f.Deployment] == i
+		if !current {
+			for _, next := range feedback[i+1:] {
+				if next.Namespace == f.Namespace && next.Deployment == f.Deployment {
+					end = next.AppliedAt
+					break
+				}
+			}
+		}
+		var realised float64
+		if end.After(f.AppliedAt) {
+			realised = f.HourlySavings * end.Sub(f.AppliedAt).Hours()
+		}
+		fn(f, realised, current)
+	}
+}
+
+// highest realised savings first
+func sorted(entries map[string]*Entry) []Entry {
+	result := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Realised != result[j].Realised {
+			return result[i].Realised > result[j].Realised
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,73 @@
+package savings
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportStopsAccruingWhenSuperseded(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	feedback := []Feedback{
+		{JobID: "2", Namespace: "shop", Deployment: "cart", Team: "payments", HourlySavings: 2, AppliedAt: base.Add(10 * time.Hour)},
+		{JobID: "1", Namespace: "shop", Deployment: "cart", Team: "payments", HourlySavings: 1, AppliedAt: base},
+		{JobID: "3", Namespace: "batch", Deployment: "etl", HourlySavings: 0.5, AppliedAt: base},
+	}
+	goals := []Goal{{Scope: ScopeNamespace, Name: "shop", Target: 100}}
+
+	r := BuildReport(feedback, goals, base.Add(20*time.Hour))
+
+	if r.Realised != 40 {
+		t.Errorf("expected 40 realised, got %v", r.Realised)
+	}
+	shop := r.Namespaces[0]
+	if shop.Name != "shop" || shop.Realised != 30 || shop.HourlySavings != 2 || shop.Changes != 2 {
+		t.Errorf("unexpected shop entry %+v", shop)
+	}
+	if shop.Goal == nil || shop.Progress != 0.3 {
+		t.Errorf("expected 30%% progress towards goal, got %+v", shop)
+	}
+	if len(r.Teams) != 1 || r.Teams[0].Realised != 30 {
+		t.Errorf("unexpected teams %+v", r.Teams)
+	}
+
+	digest := Digest(r)
+	if !strings.Contains(digest, "1. shop 30.00 (2.0000/h), 30% of 100.00 goal") {
+		t.Errorf("unexpected digest %q", digest)
+	}
+}
+
+func TestCalibrateScalesToBilledCost(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	feedback := []Feedback{{JobID: "1", Namespace: "shop", Deployment: "cart", HourlySavings: 1, AppliedAt: base}}
+	goals := []Goal{{Scope: ScopeNamespace, Name: "shop", Target: 100}}
+
+	r := BuildReport(feedback, goals, base.Add(10*time.Hour))
+	r.Calibrate(1.5)
+
+	shop := r.Namespaces[0]
+	if r.Realised != 15 || shop.Realised != 15 || shop.HourlySavings != 1.5 || shop.Progress != 0.15 {
+		t.Errorf("expected savings scaled by 1.5, got %v %+v", r.Realised, shop)
+	}
+	if r.CorrectionFactor != 1.5 {
+		t.Errorf("expected the factor in the report, got %v", r.CorrectionFactor)
+	}
+}
+
+func TestDeploymentSavingsFollowLatestChange(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	feedback := []Feedback{
+		{JobID: "2", Namespace: "shop", Deployment: "cart", HourlySavings: 2, AppliedAt: base.Add(10 * time.Hour)},
+		{JobID: "1", Namespace: "shop", Deployment: "cart", HourlySavings: 1, AppliedAt: base},
+		{JobID: "3", Namespace: "batch", Deployment: "etl", HourlySavings: 0.5, AppliedAt: base},
+	}
+
+	entries := BuildDeploymentSavings(feedback, base.Add(20*time.Hour))
+	cart := entries["shop/cart"]
+	if cart.Scope != ScopeDeployment || cart.Realised != 30 || cart.HourlySavings != 2 || cart.Changes != 2 {
+		t.Errorf("unexpected cart entry %+v", cart)
+	}
+	if etl := entries["batch/etl"]; etl.Realised != 10 {
+		t.Errorf("unexpected etl entry %+v", etl)
+	}
+}
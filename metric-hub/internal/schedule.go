@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/history"
+)
+
+const ReasonScheduleCandidate = "Schedule Candidate"
+
+const (
+	hoursPerWeek = 7 * 24
+	// hourly rollups looked at, two weeks so one odd week doesn't decide the pattern
+	scheduleLookback = 14 * 24 * time.Hour
+	// hours of the week that must have usage before a pattern is trusted
+	scheduleCoverage = 0.9
+	// schedules change slowly, a deployment is suggested once a week at most
+	scheduleCooldown = 7 * 24 * time.Hour
+)
+
+// When a deployment's quiet hours are worth a scheduled scale-down
+type SchedulePolicy struct {
+	// an hour is quiet when average cpu usage is at most this fraction of the busiest hour, 0 disables
+	QuietRatio float64 `json:"quiet_ratio" validate:"gte=0,lt=1"`
+	// shortest quiet window worth scaling down for
+	MinHours int `json:"min_hours" validate:"gte=1"`
+}
+
+func DefaultSchedulePolicy() SchedulePolicy {
+	return SchedulePolicy{QuietRatio: 0.2, MinHours: 6}
+}
+
+// Quiet window repeated on the days in its cron expressions, all times UTC
+type ScheduleWindow struct {
+	// minute hour day-of-month month day-of-week, e.g. 0 22 * * 1-5
+	ScaleDown string `json:"scale_down"`
+	ScaleUp   string `json:"scale_up"`
+	Hours     int    `json:"hours"`
+}
+
+type ScheduleRecommendation struct {
+	Windows []ScheduleWindow `json:"windows"`
+	// average cpu usage across quiet hours, and of the busiest hour of the week
+	QuietCPU float64 `json:"quiet_cpu_cores"`
+	PeakCPU  float64 `json:"peak_cpu_cores"`
+	// share of the week inside a window
+	QuietShare float64 `json:"quiet_share"`
+}
+
+func NewScheduleJob(ns string, c CostDeployment, rec ScheduleRecommendation, info ClusterInfo) AgentJob {
+	return AgentJob{
+		TargetType:  TargetSchedule,
+		Action:      ActionApply,
+		Reason:      ReasonScheduleCandidate,
+		Namespace:   ns,
+		Deployment:  &c,
+		Schedule:    &rec,
+		ClusterInfo: info,
+	}
+}
+
+// Weekly quiet windows in hourly rollups, nil when there is no usable pattern
+// usage is averaged per hour of the week, hours without rollups are never quiet
+func DetectSchedule(rollups []history.Rollup, policy SchedulePolicy) *ScheduleRecommendation {
+	if policy.QuietRatio <= 0 {
+		return nil
+	}
+	var sums [hoursPerWeek]float64
+	var counts [hoursPerWeek]int
+	for _, r := range rollups {
+		start := r.Start.UTC()
+		h := int(start.Weekday())*24 + start.Hour()
+		sums[h] += r.CPUUsage.Avg
+		counts[h]++
+	}
+
+	var means [hoursPerWeek]float64
+	covered, peak, busiest := 0, 0.0, 0
+	for h := range means {
+		if counts[h] == 0 {
+			continue
+		}
+		covered++
+		means[h] = sums[h] / float64(counts[h])
+		if means[h] > peak {
+			peak, busiest = means[h], h
+		}
+	}
+	if float64(covered) < scheduleCoverage*hoursPerWeek || peak <= 0 {
+		return nil
+	}
+	quiet := func(h int) bool {
+		h %= hoursPerWeek
+		return counts[h] > 0 && means[h] <= policy.QuietRatio*peak
+	}
+
+	// the busiest hour is never quiet, so walking the week from it splits no window in two
+	type run struct{ start, hours int }
+	var runs []run
+	for i := 1; i <= hoursPerWeek; i++ {
+		h := busiest + i
+		if !quiet(h) {
+			continue
+		}
+		if n := len(runs); n > 0 && runs[n-1].start+runs[n-1].hours == h {
+			runs[n-1].hours++
+		} else {
+			runs = append(runs, run{start: h, hours: 1})
+		}
+	}
+
+	rec := &ScheduleRecommendation{PeakCPU: peak}
+	// runs at the same hour and of the same length share a window across days
+	type shape struct{ hour, hours int }
+	days := map[shape][]int{}
+	var shapes []shape
+	var quietHours int
+	for _, r := range runs {
+		if r.hours < max(policy.MinHours, 1) {
+			continue
+		}
+		s := shape{hour: r.start % 24, hours: r.hours}
+		if _, ok := days[s]; !ok {
+			shapes = append(shapes, s)
+		}
+		days[s] = append(days[s], (r.start/24)%7)
+		for h := r.start; h < r.start+r.hours; h++ {
+			rec.QuietCPU += means[h%hoursPerWeek]
+		}
+		quietHours += r.hours
+	}
+	if quietHours == 0 {
+		return nil
+	}
+	rec.QuietCPU /= float64(quietHours)
+	rec.QuietShare = float64(quietHours) / hoursPerWeek
+
+	for _, s := range shapes {
+		down := days[s]
+		up := make([]int, len(down))
+		for i, d := range down {
+			up[i] = (d + (s.hour+s.hours)/24) % 7
+		}
+		rec.Windows = append(rec.Windows, ScheduleWindow{
+			ScaleDown: fmt.Sprintf("0 %d * * %s", s.hour, cronDays(down)),
+			ScaleUp:   fmt.Sprintf("0 %d * * %s", (s.hour+s.hours)%24, cronDays(up)),
+			Hours:     s.hours,
+		})
+	}
+	return rec
+}
+
+// cron day-of-week field, consecutive days collapse into ranges e.g. 1-5
+func cronDays(days []int) string {
+	sorted := append([]int(nil), days...)
+	sort.Ints(sorted)
+	if len(sorted) == 7 {
+		return "*"
+	}
+	var parts []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, strconv.Itoa(sorted[i])+"-"+strconv.Itoa(sorted[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(sorted[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// RunScheduleCheck looks for schedule candidates every interval until ctx is cancelled
+func (a *Aggregator) RunScheduleCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := a.CheckSchedules(ctx); err != nil {
+			fmt.Printf("[Schedules] %v\n", err)
+		}
+	}
+}
+
+// Publish a schedule job for every deployment of the latest payload with weekly quiet windows
+func (a *Aggregator) CheckSchedules(ctx context.Context) error {
+	policy := a.ActivePolicy(ctx).Schedule
+	if policy.QuietRatio <= 0 {
+		return nil
+	}
+	p, err := a.latestCost(ctx)
+	if errors.Is(err, ErrNoCostData) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !a.flagsFor(ctx, p.Namespace).Enabled(FamilySchedule) {
+		return nil
+	}
+
+	now := a.now()
+	for _, d := range p.Deployments {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// KEDA already owns the replica count
+		if d.Keda != nil {
+			continue
+		}
+		rollups, err := a.History.Rollups(ctx, history.Hourly, history.Deployment(p.Namespace, d.Name), now.Add(-scheduleLookback), now)
+		if err != nil {
+			return err
+		}
+		rec := DetectSchedule(rollups, policy)
+		if rec == nil {
+			continue
+		}
+
+		key := fmt.Sprintf("trigger:cooldown:schedule:%s", deploymentLockKey(p.Namespace, d.Name))
+		unlock := a.Locks.Lock("schedule/" + deploymentLockKey(p.Namespace, d.Name))
+		if a.cooldownActive(ctx, key, scheduleCooldown) {
+			unlock()
+			continue
+		}
+
+		fmt.Printf("Pushing schedule job for %s: %d windows, quiet %.0f%% of the week\n", d.Name, len(rec.Windows), rec.QuietShare*100)
+		if err := a.publishJob(ctx, NewScheduleJob(p.Namespace, d, *rec, p.ClusterInfo)); errors.Is(err, ErrJobDenied) {
+			fmt.Printf("Schedule job for %s not published: %v\n", d.Name, err)
+		} else if err != nil {
+			unlock()
+			return fmt.Errorf("failed to push schedule job %w", err)
+		}
+		a.startCooldown(ctx, key, scheduleCooldown)
+		unlock()
+	}
+	return nil
+}
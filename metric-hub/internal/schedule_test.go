@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/history"
+)
+
+// two weeks of hourly rollups, busy 08:00-20:00 on weekdays
+func officeHours() []history.Rollup {
+	start := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC) // a Monday
+	var rollups []history.Rollup
+	for h := 0; h < 14*24; h++ {
+		ts := start.Add(time.Duration(h) * time.Hour)
+		usage := 0.05
+		if ts.Weekday() != time.Saturday && ts.Weekday() != time.Sunday && ts.Hour() >= 8 && ts.Hour() < 20 {
+			usage = 1
+		}
+		rollups = append(rollups, history.Rollup{Start: ts, Count: 12, CPUUsage: history.Stats{Avg: usage}})
+	}
+	return rollups
+}
+
+func TestDetectScheduleFindsNightsAndWeekends(t *testing.T) {
+	rec := DetectSchedule(officeHours(), DefaultSchedulePolicy())
+	if rec == nil {
+		t.Fatal("expected a schedule for office hours usage")
+	}
+	if len(rec.Windows) != 2 {
+		t.Fatalf("expected a weeknight and a weekend window, got %+v", rec.Windows)
+	}
+	nights, weekend := rec.Windows[0], rec.Windows[1]
+	if nights.ScaleDown != "0 20 * * 1-4" || nights.ScaleUp != "0 8 * * 2-5" || nights.Hours != 12 {
+		t.Errorf("unexpected weeknight window %+v", nights)
+	}
+	if weekend.ScaleDown != "0 20 * * 5" || weekend.ScaleUp != "0 8 * * 1" || weekend.Hours != 60 {
+		t.Errorf("unexpected weekend window %+v", weekend)
+	}
+	if rec.PeakCPU != 1 || math.Abs(rec.QuietCPU-0.05) > 1e-9 || rec.QuietShare != 108.0/168 {
+		t.Errorf("unexpected usage summary %+v", rec)
+	}
+}
+
+func TestDetectScheduleNeedsAPattern(t *testing.T) {
+	flat := officeHours()
+	for i := range flat {
+		flat[i].CPUUsage.Avg = 0.5
+	}
+	if rec := DetectSchedule(flat, DefaultSchedulePolicy()); rec != nil {
+		t.Errorf("expected no schedule for flat usage, got %+v", rec)
+	}
+	if rec := DetectSchedule(officeHours()[:72], DefaultSchedulePolicy()); rec != nil {
+		t.Errorf("expected no schedule from three days of history, got %+v", rec)
+	}
+	if cronDays([]int{0, 1, 2, 3, 4, 5, 6}) != "*" || cronDays([]int{6, 0, 2}) != "0,2,6" {
+		t.Errorf("unexpected cron day fields")
+	}
+}
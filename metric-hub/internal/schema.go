@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const CustomMetricSchemasKey = "schema:custom_metrics"
+
+var (
+	// a schema using keywords or types this validator doesn't support
+	ErrInvalidSchema = errors.New("invalid schema")
+	// a payload's custom metrics violate a registered schema
+	ErrInvalidCustomMetrics = errors.New("invalid custom metrics")
+)
+
+// Subset of JSON Schema needed to describe a custom_metrics object
+// supports type, properties, required, additionalProperties and numeric bounds
+type JSONSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum,omitempty"`
+}
+
+// check the schema only uses keywords this validator understands
+func (s *JSONSchema) Check() error {
+	switch s.Type {
+	case "", "object":
+	default:
+		return fmt.Errorf("%w: custom metrics schema must have type object, got %q", ErrInvalidSchema, s.Type)
+	}
+	for name, prop := range s.Properties {
+		if prop == nil {
+			return fmt.Errorf("%w: property %q has no schema", ErrInvalidSchema, name)
+		}
+		switch prop.Type {
+		case "", "number", "integer":
+		default:
+			return fmt.Errorf("%w: property %q: custom metrics are numeric, type %q not supported", ErrInvalidSchema, name, prop.Type)
+		}
+	}
+	return nil
+}
+
+// Validate a custom_metrics map against the schema
+func (s *JSONSchema) Validate(metrics map[string]float64) error {
+	for _, name := range s.Required {
+		if _, ok := metrics[name]; !ok {
+			return fmt.Errorf("missing required custom metric %q", name)
+		}
+	}
+
+	for name, v := range metrics {
+		prop, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				return fmt.Errorf("custom metric %q is not allowed", name)
+			}
+			continue
+		}
+		// schemas stored before nil properties were rejected accept any number
+		if prop == nil {
+			continue
+		}
+		if err := prop.validateNumber(v); err != nil {
+			return fmt.Errorf("custom metric %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *JSONSchema) validateNumber(v float64) error {
+	if s.Type == "integer" && v != float64(int64(v)) {
+		return fmt.Errorf("%v is not an integer", v)
+	}
+	if s.Minimum != nil && v < *s.Minimum {
+		return fmt.Errorf("%v is below minimum %v", v, *s.Minimum)
+	}
+	if s.Maximum != nil && v > *s.Maximum {
+		return fmt.Errorf("%v is above maximum %v", v, *s.Maximum)
+	}
+	if s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum {
+		return fmt.Errorf("%v must be greater than %v", v, *s.ExclusiveMinimum)
+	}
+	if s.ExclusiveMaximum != nil && v >= *s.ExclusiveMaximum {
+		return fmt.Errorf("%v must be less than %v", v, *s.ExclusiveMaximum)
+	}
+	return nil
+}
+
+// Register or replace a named schema
+// Key - schema:custom_metrics
+// Field - <schema name>
+func (a *Aggregator) SaveSchema(ctx context.Context, name string, s *JSONSchema) error {
+	if err := s.Check(); err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal schema: %w", err)
+	}
+	if err := a.Client.HSet(ctx, CustomMetricSchemasKey, name, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) DeleteSchema(ctx context.Context, name string) error {
+	return a.Client.HDel(ctx, CustomMetricSchemasKey, name).Err()
+}
+
+func (a *Aggregator) ListSchemas(ctx context.Context) (map[string]*JSONSchema, error) {
+	raw, err := a.Client.HGetAll(ctx, CustomMetricSchemasKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schemas %w", err)
+	}
+
+	schemas := make(map[string]*JSONSchema, len(raw))
+	for name, data := range raw {
+		var s JSONSchema
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			fmt.Printf("Skipping invalid schema %s: %v\n", name, err)
+			continue
+		}
+		schemas[name] = &s
+	}
+	return schemas, nil
+}
+
+// Validate every deployment's custom metrics against all registered schemas
+// violations wrap ErrInvalidCustomMetrics, other errors come from redis
+func (a *Aggregator) ValidateCustomMetrics(ctx context.Context, p *CostPayload) error {
+	schemas, err := a.ListSchemas(ctx)
+	if err != nil {
+		return err
+	}
+	if len(schemas) == 0 {
+		return nil
+	}
+
+	// stable order so the same payload always reports the same error
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, d := range p.Deployments {
+		for _, name := range names {
+			if err := schemas[name].Validate(d.CustomMetrics); err != nil {
+				return fmt.Errorf("%w: deployment %s, schema %s: %v", ErrInvalidCustomMetrics, d.Name, name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSchemaCheckRejectsNilProperties(t *testing.T) {
+	var s JSONSchema
+	if err := json.Unmarshal([]byte(`{"properties": {"queue_lag": null}}`), &s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Check(); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("expected ErrInvalidSchema for a null property, got %v", err)
+	}
+	// a stored schema from before the check must not panic
+	if err := s.Validate(map[string]float64{"queue_lag": 5}); err != nil {
+		t.Errorf("expected a null property to accept any number, got %v", err)
+	}
+}
+
+func TestSchemaValidatesBounds(t *testing.T) {
+	var s JSONSchema
+	schema := `{"type": "object", "required": ["queue_lag"], "additionalProperties": false,
+		"properties": {"queue_lag": {"type": "integer", "minimum": 0, "maximum": 1000}}}`
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]map[string]float64{
+		"missing":    {},
+		"fraction":   {"queue_lag": 1.5},
+		"above":      {"queue_lag": 2000},
+		"additional": {"queue_lag": 1, "p99": 2},
+	}
+	for name, metrics := range cases {
+		if err := s.Validate(metrics); err == nil {
+			t.Errorf("%s: expected a violation", name)
+		}
+	}
+	if err := s.Validate(map[string]float64{"queue_lag": 10}); err != nil {
+		t.Errorf("expected valid metrics accepted, got %v", err)
+	}
+}
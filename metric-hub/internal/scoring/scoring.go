@@ -0,0 +1,85 @@
+// Package scoring asks an external service (e.g. an ML model) whether a deployment should trigger
+package scoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Sent for every deployment evaluation
+type Request struct {
+	Namespace string `json:"namespace"`
+	// "cost" or "forecast"
+	Stream string `json:"stream"`
+	// merged deployment record, including the forecast when there is one
+	Deployment interface{} `json:"deployment"`
+}
+
+// Returned by the scoring service
+// when trigger is omitted the deployment triggers if score reaches the scorer's threshold
+type Decision struct {
+	Trigger *bool   `json:"trigger,omitempty"`
+	Score   float64 `json:"score"`
+	Reason  string  `json:"reason,omitempty"`
+}
+
+type Scorer interface {
+	Score(ctx context.Context, req Request) (*Decision, error)
+}
+
+// Posts the request as JSON to a scoring endpoint
+type HTTPScorer struct {
+	URL       string
+	Client    *http.Client
+	Timeout   time.Duration
+	Threshold float64
+}
+
+func NewHTTPScorer(url string, timeout time.Duration, threshold float64) *HTTPScorer {
+	return &HTTPScorer{
+		URL:       url,
+		Client:    &http.Client{},
+		Timeout:   timeout,
+		Threshold: threshold,
+	}
+}
+
+func (s *HTTPScorer) Score(ctx context.Context, req Request) (*Decision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal scoring request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build scoring request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call scoring service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("scoring service returned %s", resp.Status)
+	}
+
+	var d Decision
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("failed to decode scoring response: %w", err)
+	}
+	if d.Trigger == nil {
+		trigger := d.Score >= s.Threshold
+		d.Trigger = &trigger
+	}
+	return &d, nil
+}
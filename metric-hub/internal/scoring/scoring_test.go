@@ -0,0 +1,43 @@
+package scoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScoreThreshold(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream != "cost" {
+			t.Errorf("expected stream cost, got %q", req.Stream)
+		}
+		w.Write([]byte(`{"score": 0.9, "reason": "Model Flagged"}`))
+	}))
+	defer srv.Close()
+
+	d, err := NewHTTPScorer(srv.URL, time.Second, 0.8).Score(context.Background(), Request{Stream: "cost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !*d.Trigger || d.Reason != "Model Flagged" {
+		t.Errorf("expected trigger with reason, got %+v", d)
+	}
+}
+
+func TestScoreTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"trigger": true}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewHTTPScorer(srv.URL, 20*time.Millisecond, 0.5).Score(context.Background(), Request{})
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+}
@@ -0,0 +1,135 @@
+// Package script runs operator-supplied Starlark trigger functions
+//
+// A script defines evaluate(deployment), receiving the merged cost and
+// forecast record as a dict, and returns a trigger reason string or None.
+// Scripts cannot load modules and run under step and wall-clock limits.
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+const (
+	EntryPoint = "evaluate"
+	// starlark execution steps allowed per call
+	MaxSteps = 1_000_000
+	// wall-clock limit per call
+	Timeout = 100 * time.Millisecond
+)
+
+type Script struct {
+	Name   string
+	Source string
+	fn     starlark.Callable
+}
+
+var fileOptions = &syntax.FileOptions{
+	// no while loops or recursion, evaluation must terminate
+	While:     false,
+	Recursion: false,
+	Set:       true,
+}
+
+// Compile checks the source and returns a script ready to evaluate
+func Compile(name string, src string) (*Script, error) {
+	thread := &starlark.Thread{
+		Name: "compile:" + name,
+		Load: func(*starlark.Thread, string) (starlark.StringDict, error) {
+			return nil, fmt.Errorf("load is not allowed in trigger scripts")
+		},
+	}
+	thread.SetMaxExecutionSteps(MaxSteps)
+
+	globals, err := starlark.ExecFileOptions(fileOptions, thread, name+".star", src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile script %s: %w", name, err)
+	}
+
+	fn, ok := globals[EntryPoint].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script %s must define %s(deployment)", name, EntryPoint)
+	}
+
+	// freeze so calls can't mutate shared globals
+	globals.Freeze()
+	return &Script{Name: name, Source: src, fn: fn}, nil
+}
+
+// Evaluate calls evaluate(record) and returns the trigger reason, "" for no trigger
+func (s *Script) Evaluate(ctx context.Context, record interface{}) (string, error) {
+	arg, err := toStarlark(record)
+	if err != nil {
+		return "", err
+	}
+
+	thread := &starlark.Thread{Name: s.Name}
+	thread.SetMaxExecutionSteps(MaxSteps)
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { thread.Cancel("time limit exceeded") })
+	defer stop()
+
+	result, err := starlark.Call(thread, s.fn, starlark.Tuple{arg}, nil)
+	if err != nil {
+		return "", fmt.Errorf("script %s failed: %w", s.Name, err)
+	}
+
+	switch v := result.(type) {
+	case starlark.NoneType:
+		return "", nil
+	case starlark.Bool:
+		if v {
+			return "Script Trigger (" + s.Name + ")", nil
+		}
+		return "", nil
+	case starlark.String:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("script %s returned %s, want string or None", s.Name, result.Type())
+}
+
+// convert any json-shaped go value to starlark via its json form
+func toStarlark(v interface{}) (starlark.Value, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal script input: %w", err)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal script input: %w", err)
+	}
+	return convert(generic), nil
+}
+
+func convert(v interface{}) starlark.Value {
+	switch t := v.(type) {
+	case nil:
+		return starlark.None
+	case bool:
+		return starlark.Bool(t)
+	case float64:
+		return starlark.Float(t)
+	case string:
+		return starlark.String(t)
+	case []interface{}:
+		elems := make([]starlark.Value, len(t))
+		for i, e := range t {
+			elems[i] = convert(e)
+		}
+		return starlark.NewList(elems)
+	case map[string]interface{}:
+		d := starlark.NewDict(len(t))
+		for k, e := range t {
+			d.SetKey(starlark.String(k), convert(e))
+		}
+		return d
+	}
+	return starlark.None
+}
@@ -0,0 +1,58 @@
+package script
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	s, err := Compile("lag", `
+def evaluate(d):
+    lag = d.get("custom_metrics", {}).get("queue_lag", 0)
+    if lag > 1000 and d["current_usage"]["cpu_cores"] < 0.2:
+        return "Idle Consumer"
+    return None
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := map[string]interface{}{
+		"name":           "worker",
+		"current_usage":  map[string]float64{"cpu_cores": 0.1},
+		"custom_metrics": map[string]float64{"queue_lag": 5000},
+	}
+	reason, err := s.Evaluate(context.Background(), record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != "Idle Consumer" {
+		t.Errorf("got %q, want Idle Consumer", reason)
+	}
+}
+
+func TestCompileRejectsLoadAndMissingEntryPoint(t *testing.T) {
+	if _, err := Compile("load", `load("x.star", "y")`); err == nil {
+		t.Error("expected load to be rejected")
+	}
+	if _, err := Compile("empty", `x = 1`); err == nil || !strings.Contains(err.Error(), EntryPoint) {
+		t.Errorf("expected missing entry point error, got %v", err)
+	}
+}
+
+func TestEvaluateStepLimit(t *testing.T) {
+	s, err := Compile("spin", `
+def evaluate(d):
+    n = 0
+    for i in range(100000000):
+        n += i
+    return None
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Evaluate(context.Background(), map[string]interface{}{}); err == nil {
+		t.Error("expected runaway script to be stopped")
+	}
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/script"
+)
+
+const CustomScriptsKey = "scripts:custom"
+
+// Custom rules and scripts evaluated after the built-in thresholds
+type Ruleset struct {
+	Rules   []compiledRule
+	Scripts []*script.Script
+}
+
+// first matching reason from rules, then scripts, skipping disabled families
+func (r Ruleset) match(ctx context.Context, c CostDeployment, flags Flags) string {
+	if flags.Enabled(FamilyCustomRules) {
+		if reason := matchCustomRules(r.Rules, c); reason != "" {
+			return reason
+		}
+	}
+	if !flags.Enabled(FamilyScripts) {
+		return ""
+	}
+	return matchScripts(ctx, r.Scripts, c)
+}
+
+func (a *Aggregator) loadRuleset(ctx context.Context) Ruleset {
+	return Ruleset{
+		Rules:   a.loadCompiledRules(ctx),
+		Scripts: a.loadScripts(ctx),
+	}
+}
+
+// Register or replace a script, rejected if it doesn't compile
+// Key - scripts:custom
+// Field - <script name>
+func (a *Aggregator) SaveScript(ctx context.Context, name string, src string) error {
+	if _, err := script.Compile(name, src); err != nil {
+		return err
+	}
+	if err := a.Client.HSet(ctx, CustomScriptsKey, name, src).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) DeleteScript(ctx context.Context, name string) error {
+	return a.Client.HDel(ctx, CustomScriptsKey, name).Err()
+}
+
+// Script sources by name
+func (a *Aggregator) ListScripts(ctx context.Context) (map[string]string, error) {
+	scripts, err := a.Client.HGetAll(ctx, CustomScriptsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scripts %w", err)
+	}
+	return scripts, nil
+}
+
+func (a *Aggregator) loadScripts(ctx context.Context) []*script.Script {
+	sources, err := a.ListScripts(ctx)
+	if err != nil {
+		fmt.Printf("Failed to load scripts %v\n", err)
+		return nil
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	scripts := make([]*script.Script, 0, len(names))
+	for _, name := range names {
+		s, err := script.Compile(name, sources[name])
+		if err != nil {
+			fmt.Printf("Skipping script %s: %v\n", name, err)
+			continue
+		}
+		scripts = append(scripts, s)
+	}
+	return scripts
+}
+
+// first script returning a reason for the merged deployment record
+// failing scripts are logged and treated as no trigger
+func matchScripts(ctx context.Context, scripts []*script.Script, c CostDeployment) string {
+	for _, s := range scripts {
+		reason, err := s.Evaluate(ctx, c)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			continue
+		}
+		if reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	CandidatePolicyKey = "policy:candidate"
+	ShadowCountsKey    = "policy:shadow:counts"
+	ShadowDiffsKey     = "policy:shadow:diffs"
+	// recent differences kept for the report
+	shadowDiffLimit = 200
+)
+
+// How the candidate policy would have behaved against live payloads
+type ShadowReport struct {
+	Candidate         *Policy            `json:"candidate"`
+	Evaluations       int                `json:"evaluations"`
+	Agreements        int                `json:"agreements"`
+	ActiveTriggers    map[string]int     `json:"active_triggers"`
+	CandidateTriggers map[string]int     `json:"candidate_triggers"`
+	RecentDifferences []ReplayDifference `json:"recent_differences"`
+}
+
+// Candidate policy in shadow mode, nil when none is loaded
+func (a *Aggregator) CandidatePolicy(ctx context.Context) *Policy {
+	if cached, ok := a.Cache.Get(CandidatePolicyKey); ok {
+		// a copy, callers may change the policy they get
+		if p := cached.(*Policy); p != nil {
+			policy := *p
+			return &policy
+		}
+		return nil
+	}
+	raw, err := a.Client.Get(ctx, CandidatePolicyKey).Result()
+	if err == redis.Nil {
+		a.Cache.Set(CandidatePolicyKey, (*Policy)(nil))
+		return nil
+	} else if err != nil {
+		fmt.Printf("Failed to load candidate policy %v\n", err)
+		return nil
+	}
+
+	policy := DefaultPolicy()
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		fmt.Printf("Invalid candidate policy %v\n", err)
+		return nil
+	}
+	cached := policy
+	a.Cache.Set(CandidatePolicyKey, &cached)
+	return &policy
+}
+
+// Load a candidate policy and reset the comparison report
+// Key - policy:candidate
+func (a *Aggregator) SaveCandidatePolicy(ctx context.Context, p *Policy) error {
+	jsonData, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal policy: %w", err)
+	}
+
+	pipe := a.Client.TxPipeline()
+	pipe.Set(ctx, CandidatePolicyKey, jsonData, 0)
+	pipe.Del(ctx, ShadowCountsKey, ShadowDiffsKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("[Failed] SET redis: %w", err)
+	}
+	a.Cache.Delete(CandidatePolicyKey)
+	return nil
+}
+
+func (a *Aggregator) DeleteCandidatePolicy(ctx context.Context) error {
+	defer a.Cache.Delete(CandidatePolicyKey)
+	return a.Client.Del(ctx, CandidatePolicyKey, ShadowCountsKey, ShadowDiffsKey).Err()
+}
+
+// Record one shadow comparison
+// Key - policy:shadow:counts (hash of counters)
+// Key - policy:shadow:diffs (list of recent differences)
+func (a *Aggregator) recordShadow(ctx context.Context, deployment string, active string, candidate string) {
+	pipe := a.Client.Pipeline()
+	pipe.HIncrBy(ctx, ShadowCountsKey, "evaluations", 1)
+	if active != "" {
+		pipe.HIncrBy(ctx, ShadowCountsKey, "active:"+active, 1)
+	}
+	if candidate != "" {
+		pipe.HIncrBy(ctx, ShadowCountsKey, "candidate:"+candidate, 1)
+	}
+
+	if active == candidate {
+		pipe.HIncrBy(ctx, ShadowCountsKey, "agreements", 1)
+	} else {
+		diff, _ := json.Marshal(ReplayDifference{
+			Time:       a.now().UTC(),
+			Deployment: deployment,
+			Baseline:   active,
+			Candidate:  candidate,
+		})
+		pipe.LPush(ctx, ShadowDiffsKey, diff)
+		pipe.LTrim(ctx, ShadowDiffsKey, 0, shadowDiffLimit-1)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Failed to record shadow comparison %v\n", err)
+	}
+}
+
+// Compare active and candidate decisions for a cost deployment
+// decisions are compared before cooldown, the candidate never publishes
+func (a *Aggregator) shadowCost(ctx context.Context, candidate *Policy, d CostDeployment, active Policy, rules Ruleset, flags Flags) {
+	if candidate == nil {
+		return
+	}
+	a.recordShadow(ctx, d.Name, costTriggerReason(ctx, d, active, rules, flags), costTriggerReason(ctx, d, *candidate, rules, flags))
+}
+
+func (a *Aggregator) shadowForecast(ctx context.Context, candidate *Policy, f ForecastDeployment, c CostDeployment, active Policy) {
+	if candidate == nil {
+		return
+	}
+	topReason := func(p Policy) string {
+		if conditions := EvaluateForecast(f, c, p); len(conditions) > 0 {
+			return conditions[0].Reason
+		}
+		return ""
+	}
+	a.recordShadow(ctx, c.Name, topReason(active), topReason(*candidate))
+}
+
+func (a *Aggregator) ShadowReport(ctx context.Context) (*ShadowReport, error) {
+	candidate := a.CandidatePolicy(ctx)
+	if candidate == nil {
+		return nil, fmt.Errorf("no candidate policy loaded")
+	}
+
+	counts, err := a.Client.HGetAll(ctx, ShadowCountsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shadow counts %w", err)
+	}
+	diffs, err := a.Client.LRange(ctx, ShadowDiffsKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shadow differences %w", err)
+	}
+
+	report := &ShadowReport{
+		Candidate:         candidate,
+		ActiveTriggers:    map[string]int{},
+		CandidateTriggers: map[string]int{},
+		RecentDifferences: make([]ReplayDifference, 0, len(diffs)),
+	}
+	for field, v := range counts {
+		n, _ := strconv.Atoi(v)
+		switch {
+		case field == "evaluations":
+			report.Evaluations = n
+		case field == "agreements":
+			report.Agreements = n
+		case strings.HasPrefix(field, "active:"):
+			report.ActiveTriggers[strings.TrimPrefix(field, "active:")] = n
+		case strings.HasPrefix(field, "candidate:"):
+			report.CandidateTriggers[strings.TrimPrefix(field, "candidate:")] = n
+		}
+	}
+	for _, raw := range diffs {
+		var d ReplayDifference
+		if err := json.Unmarshal([]byte(raw), &d); err == nil {
+			report.RecentDifferences = append(report.RecentDifferences, d)
+		}
+	}
+	return report, nil
+}
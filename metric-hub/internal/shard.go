@@ -0,0 +1,347 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// payloads with more deployments than this are split, workers evaluate the shards in parallel
+const (
+	DefaultShardSize    = 250
+	DefaultShardWorkers = 4
+)
+
+const (
+	// run ids by start time
+	EvaluationRunsKey = "eval:runs"
+	// progress and pending shards are dropped after this, unclaimed shards with them
+	evaluationRunTTL = time.Hour
+)
+
+// Key - eval:run:<id>, hash of progress fields
+func evaluationRunKey(id string) string {
+	return "eval:run:" + id
+}
+
+// Key - eval:run:<id>:pending, list of shard indexes nobody has claimed
+func pendingShardsKey(id string) string {
+	return evaluationRunKey(id) + ":pending"
+}
+
+// Key - eval:run:<id>:payload, read by replicas helping with the run
+func runPayloadKey(id string) string {
+	return evaluationRunKey(id) + ":payload"
+}
+
+// Progress of one sharded evaluation
+type EvaluationRun struct {
+	ID          string    `json:"id"`
+	Namespace   string    `json:"namespace"`
+	Deployments int       `json:"deployments"`
+	Shards      int       `json:"shards"`
+	Done        int       `json:"done"`
+	StartedAt   time.Time `json:"started_at"`
+	// pending, running on <replica> or done on <replica> in <duration>, by shard index
+	ShardStates []string `json:"shard_states"`
+}
+
+// Split deployments into consecutive shards of at most size, one shard when size is 0
+func shardDeployments(deployments []CostDeployment, size int) [][]CostDeployment {
+	if size <= 0 || len(deployments) <= size {
+		return [][]CostDeployment{deployments}
+	}
+	shards := make([][]CostDeployment, 0, (len(deployments)+size-1)/size)
+	for start := 0; start < len(deployments); start += size {
+		shards = append(shards, deployments[start:min(start+size, len(deployments))])
+	}
+	return shards
+}
+
+func (a *Aggregator) replicaID() string {
+	if a.ReplicaID == "" {
+		return "local"
+	}
+	return a.ReplicaID
+}
+
+// Evaluate shards with ShardWorkers goroutines, returns once every shard
+// this replica claimed is done; with ShardClaims other replicas may still be working
+func (a *Aggregator) evaluateShards(ctx context.Context, p *CostPayload, shards [][]CostDeployment) {
+	id := fmt.Sprintf("%s-%d", p.Namespace, p.Timestamp.UnixNano())
+	// without a recorded run there are no pending shards to claim, so every shard is evaluated here
+	claims := a.ShardClaims
+	if err := a.startRun(ctx, id, p, len(shards)); err != nil {
+		fmt.Printf("Failed to record evaluation progress %v\n", err)
+		if claims {
+			// a partly applied run may have queued shards, helpers must not evaluate them twice
+			a.Client.Del(ctx, pendingShardsKey(id))
+			claims = false
+		}
+	}
+
+	eval := a.newCostEvaluation(ctx, p)
+	next := a.localShards(len(shards))
+	if claims {
+		next = func() (int, bool) { return a.claimShard(ctx, id) }
+	}
+
+	workers := max(a.ShardWorkers, 1)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i, ok := next()
+				if !ok {
+					return
+				}
+				if ctx.Err() != nil || !a.evaluateShard(ctx, eval, id, i, shards, "local") {
+					if claims {
+						a.releaseShard(ctx, id, i)
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("[Background] Evaluated %d shards of %s\n", len(shards), id)
+}
+
+// hands out every index once, for runs no other replica can see
+func (a *Aggregator) localShards(n int) func() (int, bool) {
+	var mu sync.Mutex
+	i := 0
+	return func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if i >= n {
+			return 0, false
+		}
+		i++
+		return i - 1, true
+	}
+}
+
+func (a *Aggregator) startRun(ctx context.Context, id string, p *CostPayload, shards int) error {
+	key := evaluationRunKey(id)
+	fields := map[string]interface{}{
+		"namespace":   p.Namespace,
+		"deployments": len(p.Deployments),
+		"shards":      shards,
+		"shard_size":  a.ShardSize,
+		"started":     a.now().UnixMilli(),
+	}
+	for i := 0; i < shards; i++ {
+		fields["shard:"+strconv.Itoa(i)] = "pending"
+	}
+
+	pipe := a.Client.TxPipeline()
+	pipe.HSet(ctx, key, fields)
+	pipe.Expire(ctx, key, evaluationRunTTL)
+	pipe.ZAdd(ctx, EvaluationRunsKey, redis.Z{Score: float64(a.now().UnixMilli()), Member: id})
+	pipe.ZRemRangeByScore(ctx, EvaluationRunsKey, "-inf", "("+strconv.FormatInt(a.now().Add(-evaluationRunTTL).UnixMilli(), 10))
+	if a.ShardClaims {
+		jsonData, err := json.Marshal(p)
+		if err != nil {
+			return fmt.Errorf("[Failed] to marshal payload: %w", err)
+		}
+		pipe.Set(ctx, runPayloadKey(id), jsonData, evaluationRunTTL)
+		indexes := make([]interface{}, shards)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		pipe.RPush(ctx, pendingShardsKey(id), indexes...)
+		pipe.Expire(ctx, pendingShardsKey(id), evaluationRunTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+// LPOP makes every shard go to exactly one replica
+func (a *Aggregator) claimShard(ctx context.Context, id string) (int, bool) {
+	raw, err := a.Client.LPop(ctx, pendingShardsKey(id)).Result()
+	if err != nil {
+		if err != redis.Nil {
+			fmt.Printf("Failed to claim shard of %s %v\n", id, err)
+		}
+		return 0, false
+	}
+	i, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, false
+	}
+	return i, true
+}
+
+// put a claimed shard back for another replica, even once ctx is cancelled
+// the list is recreated when the claim emptied it, so it needs its TTL again
+func (a *Aggregator) releaseShard(ctx context.Context, id string, i int) {
+	ctx = context.WithoutCancel(ctx)
+	pipe := a.Client.TxPipeline()
+	pipe.RPush(ctx, pendingShardsKey(id), i)
+	pipe.Expire(ctx, pendingShardsKey(id), evaluationRunTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Failed to release shard %d of %s %v\n", i, id, err)
+	}
+}
+
+// Evaluate shard i, origin is local for the replica that received the payload, remote for helpers
+// false when ctx was cancelled first, the caller releases a claimed shard
+// whoever finishes the last shard drops the stored payload
+func (a *Aggregator) evaluateShard(ctx context.Context, eval *costEvaluation, id string, i int, shards [][]CostDeployment, origin string) bool {
+	key := evaluationRunKey(id)
+	field := "shard:" + strconv.Itoa(i)
+	start := a.now()
+	a.Client.HSet(ctx, key, field, "running on "+a.replicaID())
+
+	if !eval.run(ctx, shards[i]) {
+		a.Client.HSet(context.WithoutCancel(ctx), key, field, "cancelled on "+a.replicaID())
+		return false
+	}
+
+	took := a.now().Sub(start).Round(time.Millisecond)
+	pipe := a.Client.Pipeline()
+	pipe.HSet(ctx, key, field, fmt.Sprintf("done on %s in %s", a.replicaID(), took))
+	done := pipe.HIncrBy(ctx, key, "done", 1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Failed to record shard progress %v\n", err)
+	} else if done.Val() >= int64(len(shards)) {
+		a.Client.Del(ctx, runPayloadKey(id), pendingShardsKey(id))
+	}
+	metrics.ShardsEvaluated.WithLabelValues(origin).Inc()
+	return true
+}
+
+// RunShardWorker helps other replicas with sharded runs every interval until ctx is cancelled
+// only useful when ShardClaims is set on every replica
+func (a *Aggregator) RunShardWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := a.HelpShards(ctx); err != nil {
+			fmt.Printf("[Shards] %v\n", err)
+		}
+	}
+}
+
+// Claim and evaluate pending shards of every recent run
+func (a *Aggregator) HelpShards(ctx context.Context) error {
+	since := strconv.FormatInt(a.now().Add(-evaluationRunTTL).UnixMilli(), 10)
+	ids, err := a.Client.ZRangeByScore(ctx, EvaluationRunsKey, &redis.ZRangeBy{Min: since, Max: "+inf"}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list evaluation runs %w", err)
+	}
+
+	for _, id := range ids {
+		i, ok := a.claimShard(ctx, id)
+		if !ok {
+			continue
+		}
+		raw, err := a.Client.Get(ctx, runPayloadKey(id)).Result()
+		if err != nil {
+			// put the shard back for a replica that can read the payload
+			a.releaseShard(ctx, id, i)
+			return fmt.Errorf("failed to read payload of %s %w", id, err)
+		}
+		var p CostPayload
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			a.releaseShard(ctx, id, i)
+			return fmt.Errorf("invalid payload of %s %w", id, err)
+		}
+		// split as the receiving replica did, its shard size may differ from ours
+		size, err := a.Client.HGet(ctx, evaluationRunKey(id), "shard_size").Int()
+		if err != nil {
+			size = a.ShardSize
+		}
+
+		shards := shardDeployments(p.Deployments, size)
+		evalCtx, cancel := context.WithTimeout(ctx, orDefault(a.EvaluationTimeout, DefaultEvaluationTimeout))
+		eval := a.newCostEvaluation(evalCtx, &p)
+		for ok {
+			if i < len(shards) && !a.evaluateShard(evalCtx, eval, id, i, shards, "remote") {
+				a.releaseShard(ctx, id, i)
+				break
+			}
+			i, ok = a.claimShard(evalCtx, id)
+		}
+		cancel()
+	}
+	return nil
+}
+
+// Recent sharded evaluations, newest first
+func (a *Aggregator) EvaluationRuns(ctx context.Context) ([]EvaluationRun, error) {
+	ids, err := a.reader().ZRevRange(ctx, EvaluationRunsKey, 0, 49).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list evaluation runs %w", err)
+	}
+
+	runs := make([]EvaluationRun, 0, len(ids))
+	for _, id := range ids {
+		fields, err := a.reader().HGetAll(ctx, evaluationRunKey(id)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read evaluation run %w", err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		runs = append(runs, parseRun(id, fields))
+	}
+	return runs, nil
+}
+
+func parseRun(id string, fields map[string]string) EvaluationRun {
+	run := EvaluationRun{ID: id, Namespace: fields["namespace"]}
+	run.Deployments, _ = strconv.Atoi(fields["deployments"])
+	run.Shards, _ = strconv.Atoi(fields["shards"])
+	run.Done, _ = strconv.Atoi(fields["done"])
+	if ms, err := strconv.ParseInt(fields["started"], 10, 64); err == nil {
+		run.StartedAt = time.UnixMilli(ms).UTC()
+	}
+
+	run.ShardStates = make([]string, run.Shards)
+	for field, state := range fields {
+		idx, ok := strings.CutPrefix(field, "shard:")
+		if !ok {
+			continue
+		}
+		if i, err := strconv.Atoi(idx); err == nil && i >= 0 && i < run.Shards {
+			run.ShardStates[i] = state
+		}
+	}
+	return run
+}
+
+// returned when a run id is unknown or has expired
+var ErrUnknownRun = errors.New("unknown evaluation run")
+
+func (a *Aggregator) EvaluationRun(ctx context.Context, id string) (*EvaluationRun, error) {
+	fields, err := a.reader().HGetAll(ctx, evaluationRunKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evaluation run %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRun, id)
+	}
+	run := parseRun(id, fields)
+	return &run, nil
+}
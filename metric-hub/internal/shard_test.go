@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+)
+
+func wastefulDeployments(n int) []CostDeployment {
+	deployments := make([]CostDeployment, n)
+	for i := range deployments {
+		deployments[i] = CostDeployment{
+			Name:            fmt.Sprintf("svc-%d", i),
+			CurrentRequests: Resources{CPUCores: 0.5, MemoryMB: 512},
+			CurrentUsage:    Resources{CPUCores: 0.3, MemoryMB: 64},
+		}
+	}
+	return deployments
+}
+
+func TestShardDeploymentsSplitsConsecutively(t *testing.T) {
+	deployments := wastefulDeployments(7)
+
+	shards := shardDeployments(deployments, 3)
+	if len(shards) != 3 || len(shards[0]) != 3 || len(shards[2]) != 1 || shards[2][0].Name != "svc-6" {
+		t.Errorf("expected shards of 3, 3 and 1, got %v", shards)
+	}
+	if got := shardDeployments(deployments, 0); len(got) != 1 || len(got[0]) != 7 {
+		t.Errorf("expected a single shard when sharding is off, got %d", len(got))
+	}
+}
+
+func TestParseRunOrdersShardStates(t *testing.T) {
+	run := parseRun("default-1", map[string]string{
+		"namespace": "default",
+		"shards":    "2",
+		"done":      "1",
+		"shard:1":   "done on hub-0 in 12ms",
+		"shard:0":   "running on hub-1",
+		"shard:9":   "ignored",
+	})
+	if run.Shards != 2 || run.Done != 1 || run.ShardStates[0] != "running on hub-1" || run.ShardStates[1] != "done on hub-0 in 12ms" {
+		t.Errorf("unexpected run %+v", run)
+	}
+}
+
+func TestHelpShardsEvaluatesClaimedShards(t *testing.T) {
+	mr := miniredis.RunT(t)
+	receiver := NewAggregator(mr.Addr(), "", "")
+	helper := NewAggregator(mr.Addr(), "", "")
+	defer receiver.Client.Close()
+	defer helper.Client.Close()
+	receiver.ShardSize, receiver.ShardClaims, receiver.ReplicaID = 2, true, "hub-0"
+	helper.ReplicaID = "hub-1"
+	helper.Clock = clock.NewFake(time.Now())
+	ctx := context.Background()
+
+	p := &CostPayload{
+		Timestamp:   time.Now().UTC(),
+		Namespace:   "default",
+		ClusterInfo: ClusterInfo{VmCount: 3, Cost: 0.36},
+		Deployments: wastefulDeployments(5),
+	}
+	// the receiver records the run, but its workers never start
+	id := fmt.Sprintf("%s-%d", p.Namespace, p.Timestamp.UnixNano())
+	if err := receiver.startRun(ctx, id, p, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := helper.HelpShards(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ := mr.List(AgentQueueKey); len(jobs) != 5 {
+		t.Errorf("expected 5 jobs from the helper, got %d", len(jobs))
+	}
+
+	run, err := receiver.EvaluationRun(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// timed on the helper's clock, which never moves
+	if run.Done != 3 || run.ShardStates[2] != "done on hub-1 in 0s" {
+		t.Errorf("expected every shard done by the helper, got %+v", run)
+	}
+	if mr.Exists(runPayloadKey(id)) || mr.Exists(pendingShardsKey(id)) {
+		t.Errorf("expected the payload and pending list dropped once the run finished")
+	}
+}
+
+func TestShardsFallBackToLocalWithoutARun(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := NewAggregator(mr.Addr(), "", "")
+	defer a.Client.Close()
+	a.ShardSize, a.ShardClaims = 2, true
+
+	p := &CostPayload{
+		Timestamp:   time.Now().UTC(),
+		Namespace:   "default",
+		ClusterInfo: ClusterInfo{VmCount: 3, Cost: 0.36},
+		Deployments: wastefulDeployments(5),
+	}
+	// a run key of the wrong type makes recording the run fail
+	id := fmt.Sprintf("%s-%d", p.Namespace, p.Timestamp.UnixNano())
+	mr.Set(evaluationRunKey(id), "corrupt")
+
+	a.evaluateShards(context.Background(), p, shardDeployments(p.Deployments, a.ShardSize))
+	if jobs, _ := mr.List(AgentQueueKey); len(jobs) != 5 {
+		t.Errorf("expected every shard evaluated locally, got %d jobs", len(jobs))
+	}
+	if mr.Exists(pendingShardsKey(id)) {
+		t.Error("expected no shards left for helpers")
+	}
+}
+
+func TestReleasedShardIsClaimedAgain(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := NewAggregator(mr.Addr(), "", "")
+	defer a.Client.Close()
+	mr.RPush(pendingShardsKey("default-1"), "0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	i, ok := a.claimShard(ctx, "default-1")
+	if !ok || mr.Exists(pendingShardsKey("default-1")) {
+		t.Fatalf("expected the only shard claimed, got %d %v", i, ok)
+	}
+	cancel()
+
+	a.releaseShard(ctx, "default-1", i)
+	if ttl := mr.TTL(pendingShardsKey("default-1")); ttl != evaluationRunTTL {
+		t.Errorf("expected the recreated list to expire with the run, got %v", ttl)
+	}
+	if i, ok := a.claimShard(context.Background(), "default-1"); !ok || i != 0 {
+		t.Errorf("expected shard 0 claimable again, got %d %v", i, ok)
+	}
+}
+
+func TestHelpShardsReleasesShardsItCannotFinish(t *testing.T) {
+	mr := miniredis.RunT(t)
+	receiver := NewAggregator(mr.Addr(), "", "")
+	helper := NewAggregator(mr.Addr(), "", "")
+	defer receiver.Client.Close()
+	defer helper.Client.Close()
+	receiver.ShardSize, receiver.ShardClaims = 2, true
+	// every evaluation on the helper times out at once
+	helper.ReplicaID, helper.EvaluationTimeout = "hub-1", time.Nanosecond
+	ctx := context.Background()
+
+	p := &CostPayload{
+		Timestamp:   time.Now().UTC(),
+		Namespace:   "default",
+		ClusterInfo: ClusterInfo{VmCount: 3, Cost: 0.36},
+		Deployments: wastefulDeployments(5),
+	}
+	id := fmt.Sprintf("%s-%d", p.Namespace, p.Timestamp.UnixNano())
+	if err := receiver.startRun(ctx, id, p, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := helper.HelpShards(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := mr.List(pendingShardsKey(id)); len(pending) != 3 {
+		t.Errorf("expected the cancelled shard back with the other two, got %v", pending)
+	}
+	run, err := receiver.EvaluationRun(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Done != 0 || run.ShardStates[0] != "cancelled on hub-1" {
+		t.Errorf("expected shard 0 cancelled on the helper, got %+v", run)
+	}
+
+	mr.Set(runPayloadKey(id), "{corrupt")
+	if err := helper.HelpShards(ctx); err == nil {
+		t.Error("expected an unreadable payload reported")
+	}
+	if pending, _ := mr.List(pendingShardsKey(id)); len(pending) != 3 {
+		t.Errorf("expected the claimed shard released, got %v", pending)
+	}
+}
@@ -0,0 +1,320 @@
+// Package snapshot exports and restores all hub state held in Redis
+//
+// The archive is gzipped JSON with each key's type, TTL and value, rather
+// than DUMP payloads, so it restores across Redis versions.
+package snapshot
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const FormatVersion = 1
+
+// Key patterns owned by the hub
+// dedup claims and tenant quota counters are transient and deliberately left out
+var Patterns = []string{
+	"cost:latest*",
+	"trigger:cooldown:*",
+	"trigger:hold:*",
+	"cluster:*",
+	"reviews:*",
+	"incidents:*",
+	"tenants:quotas",
+	"forecast:orphan:*",
+	"schema:*",
+	"rules:*",
+	"scripts:*",
+	"flags:*",
+	"defaults:*",
+	"history:*",
+	"savings:*",
+	"billing:*",
+	"producers:*",
+	"queue:agent:*",
+	"policy:*",
+	"events:*",
+}
+
+// returned when an archive can't be restored as it is, nothing is written
+var ErrInvalidArchive = errors.New("invalid archive")
+
+type Archive struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Keys      []Key     `json:"keys"`
+}
+
+// A single Redis key, value shape depends on type
+type Key struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// remaining time to live in milliseconds, 0 means no expiry
+	TTL    int64             `json:"ttl_ms,omitempty"`
+	String string            `json:"string,omitempty"`
+	Hash   map[string]string `json:"hash,omitempty"`
+	List   []string          `json:"list,omitempty"`
+	Set    []string          `json:"set,omitempty"`
+	ZSet   []redis.Z         `json:"zset,omitempty"`
+	Stream []redis.XMessage  `json:"stream,omitempty"`
+}
+
+// Summary of a restore
+type Result struct {
+	Restored int `json:"restored"`
+	Deleted  int `json:"deleted"`
+}
+
+func scan(ctx context.Context, client *redis.Client) ([]string, error) {
+	seen := map[string]bool{}
+	var keys []string
+	for _, pattern := range Patterns {
+		iter := client.Scan(ctx, 0, pattern, 1000).Iterator()
+		for iter.Next(ctx) {
+			if !seen[iter.Val()] {
+				seen[iter.Val()] = true
+				keys = append(keys, iter.Val())
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return nil, fmt.Errorf("failed to scan %s %w", pattern, err)
+		}
+	}
+	return keys, nil
+}
+
+// hub keys match one of Patterns, each is a prefix ending in * or an exact name
+func owned(name string) bool {
+	for _, pattern := range Patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(name, prefix) || name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Export writes every hub key to w as a gzipped archive
+// every key is read before the first write, so a failed read leaves w untouched
+func Export(ctx context.Context, client *redis.Client, w io.Writer) error {
+	names, err := scan(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	archive := Archive{
+		Version:   FormatVersion,
+		CreatedAt: time.Now().UTC(),
+		Keys:      make([]Key, 0, len(names)),
+	}
+
+	for _, name := range names {
+		k, err := readKey(ctx, client, name)
+		if err == redis.Nil {
+			// expired between scan and read
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s %w", name, err)
+		}
+		archive.Keys = append(archive.Keys, *k)
+	}
+
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(archive); err != nil {
+		return fmt.Errorf("failed to encode archive %w", err)
+	}
+	return gz.Close()
+}
+
+func readKey(ctx context.Context, client *redis.Client, name string) (*Key, error) {
+	typ, err := client.Type(ctx, name).Result()
+	if err != nil {
+		return nil, err
+	}
+	k := &Key{Name: name, Type: typ}
+
+	switch typ {
+	case "string":
+		k.String, err = client.Get(ctx, name).Result()
+	case "hash":
+		k.Hash, err = client.HGetAll(ctx, name).Result()
+	case "list":
+		k.List, err = client.LRange(ctx, name, 0, -1).Result()
+	case "set":
+		k.Set, err = client.SMembers(ctx, name).Result()
+	case "zset":
+		k.ZSet, err = client.ZRangeWithScores(ctx, name, 0, -1).Result()
+	case "stream":
+		k.Stream, err = client.XRange(ctx, name, "-", "+").Result()
+	case "none":
+		return nil, redis.Nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", typ)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := client.PTTL(ctx, name).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		k.TTL = ttl.Milliseconds()
+	}
+	return k, nil
+}
+
+// Import restores an archive read from r
+// the archive is validated before anything is written, then restored in one MULTI so a
+// failure leaves redis as it was. With flush, existing hub keys are deleted in the same
+// transaction so the result matches the archive exactly
+// archives that can't be restored return ErrInvalidArchive, anything else is a redis error
+func Import(ctx context.Context, client *redis.Client, r io.Reader, flush bool) (*Result, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not gzipped %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	var archive Archive
+	if err := json.NewDecoder(gz).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if archive.Version != FormatVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, archive.Version)
+	}
+	for _, k := range archive.Keys {
+		if err := validateKey(k); err != nil {
+			return nil, fmt.Errorf("%w: %s %v", ErrInvalidArchive, k.Name, err)
+		}
+	}
+
+	var existing []string
+	if flush {
+		if existing, err = scan(ctx, client); err != nil {
+			return nil, err
+		}
+	}
+
+	pipe := client.TxPipeline()
+	var deleted *redis.IntCmd
+	if len(existing) > 0 {
+		deleted = pipe.Del(ctx, existing...)
+	}
+	for _, k := range archive.Keys {
+		writeKey(ctx, pipe, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to restore archive %w", err)
+	}
+
+	res := &Result{Restored: len(archive.Keys)}
+	if deleted != nil {
+		res.Deleted = int(deleted.Val())
+	}
+	return res, nil
+}
+
+// reject what would fail inside the transaction, redis doesn't roll back the commands before it
+func validateKey(k Key) error {
+	if !owned(k.Name) {
+		return errors.New("is not a hub key")
+	}
+	switch k.Type {
+	case "string", "hash", "list", "set", "zset":
+	case "stream":
+		// XADD only accepts ids above the last one
+		for i := 1; i < len(k.Stream); i++ {
+			if !streamIDAfter(k.Stream[i].ID, k.Stream[i-1].ID) {
+				return fmt.Errorf("stream id %s is not after %s", k.Stream[i].ID, k.Stream[i-1].ID)
+			}
+		}
+		for _, m := range k.Stream {
+			if _, _, ok := parseStreamID(m.ID); !ok || len(m.Values) == 0 {
+				return fmt.Errorf("invalid stream entry %s", m.ID)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported key type %s", k.Type)
+	}
+	if k.TTL < 0 {
+		return fmt.Errorf("negative ttl %d", k.TTL)
+	}
+	return nil
+}
+
+func parseStreamID(id string) (ms uint64, seq uint64, ok bool) {
+	a, b, found := strings.Cut(id, "-")
+	ms, err := strconv.ParseUint(a, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if found {
+		if seq, err = strconv.ParseUint(b, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return ms, seq, true
+}
+
+func streamIDAfter(id string, prev string) bool {
+	ms, seq, ok := parseStreamID(id)
+	prevMS, prevSeq, prevOK := parseStreamID(prev)
+	if !ok || !prevOK {
+		return false
+	}
+	return ms > prevMS || ms == prevMS && seq > prevSeq
+}
+
+// queue the key's restore on pipe, replacing any current value
+func writeKey(ctx context.Context, pipe redis.Pipeliner, k Key) {
+	pipe.Del(ctx, k.Name)
+
+	switch k.Type {
+	case "string":
+		pipe.Set(ctx, k.Name, k.String, 0)
+	case "hash":
+		if len(k.Hash) > 0 {
+			pipe.HSet(ctx, k.Name, k.Hash)
+		}
+	case "list":
+		if len(k.List) > 0 {
+			values := make([]interface{}, len(k.List))
+			for i, v := range k.List {
+				values[i] = v
+			}
+			pipe.RPush(ctx, k.Name, values...)
+		}
+	case "set":
+		if len(k.Set) > 0 {
+			values := make([]interface{}, len(k.Set))
+			for i, v := range k.Set {
+				values[i] = v
+			}
+			pipe.SAdd(ctx, k.Name, values...)
+		}
+	case "zset":
+		if len(k.ZSet) > 0 {
+			pipe.ZAdd(ctx, k.Name, k.ZSet...)
+		}
+	case "stream":
+		// keep original IDs so event times survive the restore
+		for _, m := range k.Stream {
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: k.Name, ID: m.ID, Values: m.Values})
+		}
+	}
+
+	if k.TTL > 0 {
+		pipe.PExpire(ctx, k.Name, time.Duration(k.TTL)*time.Millisecond)
+	}
+}
@@ -0,0 +1,115 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client, mr
+}
+
+func archiveOf(t *testing.T, keys ...Key) *bytes.Buffer {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(Archive{Version: FormatVersion, Keys: keys}); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return &buf
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src, srcRedis := newClient(t)
+	srcRedis.Set("cost:latest", `{"namespace":"default"}`)
+	srcRedis.Set("trigger:cooldown:cart", "100")
+	srcRedis.SetTTL("trigger:cooldown:cart", 30*time.Minute)
+	srcRedis.HSet("rules:default", "waste", "{}")
+	srcRedis.XAdd("events:log", "1-0", []string{"type", "cost_payload"})
+	srcRedis.XAdd("events:log", "2-0", []string{"type", "job_published"})
+	srcRedis.Set("dedup:abc", "1")
+
+	var buf bytes.Buffer
+	if err := Export(ctx, src, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, dstRedis := newClient(t)
+	dstRedis.Set("forecast:orphan:default:old", "{}")
+	dstRedis.Set("unrelated", "kept")
+	res, err := Import(ctx, dst, &buf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Restored != 4 || res.Deleted != 1 {
+		t.Errorf("expected 4 keys restored and 1 flushed, got %+v", res)
+	}
+	if v, _ := dstRedis.Get("cost:latest"); v != `{"namespace":"default"}` {
+		t.Errorf("expected cost:latest restored, got %q", v)
+	}
+	if ttl := dstRedis.TTL("trigger:cooldown:cart"); ttl != 30*time.Minute {
+		t.Errorf("expected the cooldown TTL kept, got %v", ttl)
+	}
+	if entries, _ := dstRedis.Stream("events:log"); len(entries) != 2 || entries[1].ID != "2-0" {
+		t.Errorf("expected the stream restored with its ids, got %+v", entries)
+	}
+	if dstRedis.Exists("forecast:orphan:default:old") || dstRedis.Exists("dedup:abc") {
+		t.Error("expected flushed and transient keys absent")
+	}
+	if !dstRedis.Exists("unrelated") {
+		t.Error("expected keys outside the hub patterns kept")
+	}
+}
+
+func TestInvalidArchiveLeavesRedisUntouched(t *testing.T) {
+	ctx := context.Background()
+	cases := map[string]*bytes.Buffer{
+		"not gzipped":  bytes.NewBufferString("{}"),
+		"unknown type": archiveOf(t, Key{Name: "cost:latest", Type: "string", String: "{}"}, Key{Name: "rules:x", Type: "json"}),
+		"foreign key":  archiveOf(t, Key{Name: "session:1", Type: "string", String: "x"}),
+		"stream order": archiveOf(t, Key{Name: "events:log", Type: "stream", Stream: []redis.XMessage{
+			{ID: "2-0", Values: map[string]interface{}{"type": "a"}},
+			{ID: "1-0", Values: map[string]interface{}{"type": "b"}},
+		}}),
+	}
+	for name, archive := range cases {
+		t.Run(name, func(t *testing.T) {
+			client, mr := newClient(t)
+			mr.Set("cost:latest", "current")
+			mr.Set("trigger:cooldown:cart", "100")
+
+			_, err := Import(ctx, client, archive, true)
+			if !errors.Is(err, ErrInvalidArchive) {
+				t.Fatalf("expected ErrInvalidArchive, got %v", err)
+			}
+			if v, _ := mr.Get("cost:latest"); v != "current" || !mr.Exists("trigger:cooldown:cart") {
+				t.Error("expected nothing flushed or overwritten")
+			}
+		})
+	}
+}
+
+func TestImportRedisFailureIsNotInvalid(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	defer client.Close()
+	archive := archiveOf(t, Key{Name: "cost:latest", Type: "string", String: "{}"})
+	mr.Close()
+
+	_, err := Import(context.Background(), client, archive, false)
+	if err == nil || errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("expected a redis error, got %v", err)
+	}
+}
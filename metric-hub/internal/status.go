@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Aggregate numbers safe to show without authentication
+// nothing in it names a namespace, deployment or team
+type PublicStatus struct {
+	Cluster string `json:"cluster"`
+	// time of the cost payload the numbers come from
+	UpdatedAt time.Time `json:"updated_at"`
+	// usage over requests across the cluster from 0 to 100, cpu and memory weighted equally
+	EfficiencyScore float64 `json:"efficiency_score"`
+	// run rate of applied recommendations over a month
+	MonthlySavings float64 `json:"monthly_savings"`
+	ActiveTriggers int     `json:"active_triggers"`
+	JobsLast24h    int     `json:"jobs_last_24h"`
+	DeniedLast24h  int     `json:"denied_last_24h"`
+}
+
+// Cluster efficiency from 0 to 100, overcommitted resources count as fully used
+func EfficiencyScore(utilisation Resources) float64 {
+	score := (math.Min(utilisation.CPUCores, 1) + math.Min(utilisation.MemoryMB, 1)) / 2 * 100
+	return math.Round(score*10) / 10
+}
+
+// Public status of the cluster this hub serves, MonthlySavings is left to the savings tracker
+func (a *Aggregator) PublicStatus(ctx context.Context) (*PublicStatus, error) {
+	summary, err := a.ClusterSummary(ctx, a.clusterID())
+	if err != nil {
+		return nil, err
+	}
+	events, err := a.ReadEvents(ctx, a.now().Add(-24*time.Hour), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PublicStatus{
+		Cluster:         summary.Cluster,
+		UpdatedAt:       summary.Timestamp,
+		EfficiencyScore: EfficiencyScore(summary.Utilisation),
+		ActiveTriggers:  summary.ActiveTriggers,
+	}
+	for _, ev := range events {
+		switch ev.Type {
+		case EventJobPublished:
+			status.JobsLast24h++
+		case EventJobDenied:
+			status.DeniedLast24h++
+		}
+	}
+	return status, nil
+}
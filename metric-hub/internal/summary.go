@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// the hub reports on a single cluster unless configured otherwise
+const DefaultClusterID = "default"
+
+// deployments listed as top offenders
+const topOffenders = 5
+
+// returned when the summary is asked for a cluster this hub doesn't serve
+var ErrUnknownCluster = errors.New("unknown cluster")
+
+type ClusterSummary struct {
+	Cluster     string         `json:"cluster"`
+	Labels      *ClusterLabels `json:"labels,omitempty"`
+	Namespace   string         `json:"namespace"`
+	Timestamp   time.Time      `json:"timestamp"`
+	ClusterInfo ClusterInfo    `json:"cluster_info"`
+	Deployments int            `json:"deployments"`
+	Requests    Resources      `json:"requests"`
+	Usage       Resources      `json:"usage"`
+	// usage as a fraction of requests
+	Utilisation Resources `json:"utilisation"`
+	// hourly cost of requested but unused resources
+	WastedHourlyCost float64 `json:"wasted_hourly_cost"`
+	// node capacity not yet requested, only when node groups are reported
+	NodeHeadroom *Resources `json:"node_headroom,omitempty"`
+	// unallocated node capacity and its cost, only when node groups are reported
+	Idle *IdleCost `json:"idle,omitempty"`
+	// namespace quota left, only when a quota is reported
+	QuotaHeadroom  *Resources      `json:"quota_headroom,omitempty"`
+	ActiveTriggers int             `json:"active_triggers"`
+	TopOffenders   []OffenderEntry `json:"top_offenders"`
+}
+
+type OffenderEntry struct {
+	Name             string    `json:"name"`
+	HourlyCost       float64   `json:"hourly_cost"`
+	WastedHourlyCost float64   `json:"wasted_hourly_cost"`
+	Utilisation      Resources `json:"utilisation"`
+}
+
+func ratio(used float64, requested float64) float64 {
+	if requested <= 0 {
+		return 0
+	}
+	return used / requested
+}
+
+// Cost of the unused share of a deployment's requests, cpu and memory weighted equally
+func WastedHourlyCost(p *CostPayload, c CostDeployment) float64 {
+	cpuWaste := 1 - ratio(c.CurrentUsage.CPUCores, c.CurrentRequests.CPUCores)
+	memWaste := 1 - ratio(c.CurrentUsage.MemoryMB, c.CurrentRequests.MemoryMB)
+	if cpuWaste < 0 {
+		cpuWaste = 0
+	}
+	if memWaste < 0 {
+		memWaste = 0
+	}
+	return DeploymentHourlyCost(p, c) * (cpuWaste + memWaste) / 2
+}
+
+// Summarise a cost payload, activeTriggers is counted separately
+func BuildClusterSummary(cluster string, p *CostPayload, activeTriggers int) *ClusterSummary {
+	s := &ClusterSummary{
+		Cluster:        cluster,
+		Namespace:      p.Namespace,
+		Timestamp:      p.Timestamp,
+		ClusterInfo:    p.ClusterInfo,
+		Deployments:    len(p.Deployments),
+		ActiveTriggers: activeTriggers,
+		TopOffenders:   []OffenderEntry{},
+	}
+
+	for _, d := range p.Deployments {
+		s.Requests.CPUCores += d.CurrentRequests.CPUCores
+		s.Requests.MemoryMB += d.CurrentRequests.MemoryMB
+		s.Usage.CPUCores += d.CurrentUsage.CPUCores
+		s.Usage.MemoryMB += d.CurrentUsage.MemoryMB
+
+		wasted := WastedHourlyCost(p, d)
+		s.WastedHourlyCost += wasted
+		s.TopOffenders = append(s.TopOffenders, OffenderEntry{
+			Name:             d.Name,
+			HourlyCost:       DeploymentHourlyCost(p, d),
+			WastedHourlyCost: wasted,
+			Utilisation: Resources{
+				CPUCores: ratio(d.CurrentUsage.CPUCores, d.CurrentRequests.CPUCores),
+				MemoryMB: ratio(d.CurrentUsage.MemoryMB, d.CurrentRequests.MemoryMB),
+			},
+		})
+	}
+	s.Utilisation = Resources{
+		CPUCores: ratio(s.Usage.CPUCores, s.Requests.CPUCores),
+		MemoryMB: ratio(s.Usage.MemoryMB, s.Requests.MemoryMB),
+	}
+
+	sort.SliceStable(s.TopOffenders, func(i, j int) bool {
+		return s.TopOffenders[i].WastedHourlyCost > s.TopOffenders[j].WastedHourlyCost
+	})
+	if len(s.TopOffenders) > topOffenders {
+		s.TopOffenders = s.TopOffenders[:topOffenders]
+	}
+
+	if len(p.NodeGroups) > 0 {
+		var headroom Resources
+		for _, g := range p.NodeGroups {
+			headroom.CPUCores += g.NodeCapacity.CPUCores*float64(g.NodeCount) - g.Requested.CPUCores
+			headroom.MemoryMB += g.NodeCapacity.MemoryMB*float64(g.NodeCount) - g.Requested.MemoryMB
+		}
+		s.NodeHeadroom = &headroom
+		s.Idle = BuildIdleCost(p)
+	}
+	if p.ResourceQuota != nil {
+		headroom := p.ResourceQuota.Headroom()
+		s.QuotaHeadroom = &headroom
+	}
+	return s
+}
+
+// Summary of the latest cost payload for the cluster this hub serves
+func (a *Aggregator) ClusterSummary(ctx context.Context, cluster string) (*ClusterSummary, error) {
+	if cluster != a.clusterID() {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCluster, cluster)
+	}
+
+	p, err := a.latestCost(ctx)
+	if err != nil {
+		return nil, err
+	}
+	active, err := a.activeTriggers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := BuildClusterSummary(cluster, p, active)
+	if a.ClusterLabels != (ClusterLabels{}) {
+		labels := a.ClusterLabels
+		s.Labels = &labels
+	}
+	if s.Idle != nil {
+		if err := a.idleTrend(ctx, s.Idle, p.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (a *Aggregator) clusterID() string {
+	if a.ClusterID == "" {
+		return DefaultClusterID
+	}
+	return a.ClusterID
+}
+
+// cooldown keys still inside the active policy's cooldown
+func (a *Aggregator) activeTriggers(ctx context.Context) (int, error) {
+	var keys []string
+	iter := a.reader().Scan(ctx, 0, "trigger:cooldown:*", 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return 0, fmt.Errorf("failed to scan cooldowns %w", err)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	values, err := a.reader().MGet(ctx, keys...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cooldowns %w", err)
+	}
+
+	now := a.now().Unix()
+	cooldown := a.ActivePolicy(ctx).CooldownSeconds
+	active := 0
+	for _, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if ts, err := strconv.ParseInt(raw, 10, 64); err == nil && now-ts < cooldown {
+			active++
+		}
+	}
+	return active, nil
+}
@@ -0,0 +1,58 @@
+package internal
+
+import "testing"
+
+func TestClusterSummaryRanksOffendersByWastedCost(t *testing.T) {
+	p := &CostPayload{
+		Namespace:   "default",
+		ClusterInfo: ClusterInfo{VmCount: 2, Cost: 1.0},
+		Deployments: []CostDeployment{
+			{Name: "busy", CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000}, CurrentUsage: Resources{CPUCores: 1, MemoryMB: 1000}},
+			{Name: "idle", CurrentRequests: Resources{CPUCores: 1, MemoryMB: 1000}, CurrentUsage: Resources{CPUCores: 0, MemoryMB: 0}},
+		},
+		NodeGroups: []NodeGroup{
+			{Name: "workers", NodeCount: 2, NodeCapacity: Resources{CPUCores: 4, MemoryMB: 4000}, Requested: Resources{CPUCores: 2, MemoryMB: 2000}},
+		},
+	}
+
+	s := BuildClusterSummary("default", p, 3)
+	if s.Requests.CPUCores != 2 || s.Usage.CPUCores != 1 || s.Utilisation.CPUCores != 0.5 {
+		t.Errorf("unexpected totals %+v %+v %+v", s.Requests, s.Usage, s.Utilisation)
+	}
+	if s.WastedHourlyCost != 0.5 {
+		t.Errorf("expected half the cost wasted, got %v", s.WastedHourlyCost)
+	}
+	if s.TopOffenders[0].Name != "idle" {
+		t.Errorf("expected idle first, got %+v", s.TopOffenders)
+	}
+	if s.NodeHeadroom == nil || s.NodeHeadroom.CPUCores != 6 {
+		t.Errorf("expected 6 cores of node headroom, got %+v", s.NodeHeadroom)
+	}
+	if s.QuotaHeadroom != nil || s.ActiveTriggers != 3 {
+		t.Errorf("unexpected quota headroom or trigger count %+v", s)
+	}
+}
+
+func TestIdleCostAttributesUnallocatedCapacity(t *testing.T) {
+	p := &CostPayload{
+		ClusterInfo: ClusterInfo{VmCount: 3, Cost: 1.5},
+		NodeGroups: []NodeGroup{
+			// 0.5 per node from cluster info, three quarters unrequested
+			{Name: "workers", NodeCount: 2, NodeCapacity: Resources{CPUCores: 4, MemoryMB: 4000}, Requested: Resources{CPUCores: 2, MemoryMB: 2000}},
+			// overcommitted, nothing idle
+			{Name: "batch", NodeCount: 1, HourlyCostPerNode: 1, NodeCapacity: Resources{CPUCores: 2, MemoryMB: 2000}, Requested: Resources{CPUCores: 3, MemoryMB: 2500}},
+		},
+	}
+
+	idle := BuildIdleCost(p)
+	if idle == nil || idle.Unallocated.CPUCores != 6 || idle.Unallocated.MemoryMB != 6000 {
+		t.Fatalf("expected 6 cores and 6000 MB unallocated, got %+v", idle)
+	}
+	if idle.HourlyCost != 0.75 || idle.Fraction != 0.375 {
+		t.Errorf("expected 0.75/h idle, 0.375 of node cost, got %v %v", idle.HourlyCost, idle.Fraction)
+	}
+
+	if BuildIdleCost(&CostPayload{ClusterInfo: p.ClusterInfo}) != nil {
+		t.Errorf("expected no idle cost without node groups")
+	}
+}
@@ -0,0 +1,212 @@
+// Package tenant enforces per-tenant quotas when several teams share the hub
+// a tenant is the namespace a payload or job is for
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	QuotasKey = "tenants:quotas"
+	// quota applied to tenants without their own
+	AllTenants = "*"
+)
+
+// Quota names used in errors and metrics
+const (
+	QuotaPayloadSize = "payload_size"
+	QuotaPushRate    = "push_rate"
+	QuotaHistory     = "history"
+	QuotaJobs        = "jobs"
+)
+
+// Limits for one tenant, 0 leaves that limit off
+type Quota struct {
+	MaxPayloadBytes       int64 `json:"max_payload_bytes" validate:"gte=0"`
+	MaxPushesPerMinute    int64 `json:"max_pushes_per_minute" validate:"gte=0"`
+	MaxHistoryDeployments int64 `json:"max_history_deployments" validate:"gte=0"`
+	MaxJobsPerHour        int64 `json:"max_jobs_per_hour" validate:"gte=0"`
+}
+
+// returned when a tenant is over a quota
+type QuotaError struct {
+	Tenant string
+	Quota  string
+	Limit  int64
+	// when the window resets, zero for limits that aren't windowed
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("tenant %s over %s quota (%d)", e.Tenant, e.Quota, e.Limit)
+}
+
+type Limiter struct {
+	Client *redis.Client
+	// time source, the system clock when nil
+	Clock clock.Clock
+}
+
+func NewLimiter(client *redis.Client) *Limiter {
+	return &Limiter{Client: client}
+}
+
+// Key - tenants:quotas
+// Field - <tenant> or *, Value - quota JSON
+func (l *Limiter) SaveQuota(ctx context.Context, tenant string, q *Quota) error {
+	jsonData, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Errorf("[Failed] to marshal quota: %w", err)
+	}
+	if err := l.Client.HSet(ctx, QuotasKey, tenant, jsonData).Err(); err != nil {
+		return fmt.Errorf("[Failed] HSET redis: %w", err)
+	}
+	return nil
+}
+
+func (l *Limiter) DeleteQuota(ctx context.Context, tenant string) error {
+	if err := l.Client.HDel(ctx, QuotasKey, tenant).Err(); err != nil {
+		return fmt.Errorf("[Failed] HDEL redis: %w", err)
+	}
+	return nil
+}
+
+func (l *Limiter) ListQuotas(ctx context.Context) (map[string]Quota, error) {
+	raw, err := l.Client.HGetAll(ctx, QuotasKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant quotas %w", err)
+	}
+	quotas := make(map[string]Quota, len(raw))
+	for tenant, data := range raw {
+		var q Quota
+		if err := json.Unmarshal([]byte(data), &q); err != nil {
+			fmt.Printf("Skipping invalid quota for %s: %v\n", tenant, err)
+			continue
+		}
+		quotas[tenant] = q
+	}
+	return quotas, nil
+}
+
+// Quota for a tenant, falling back to * and then to no limits
+// a redis failure means no limits, quotas never block ingestion on their own failure
+func (l *Limiter) QuotaFor(ctx context.Context, tenant string) Quota {
+	values, err := l.Client.HMGet(ctx, QuotasKey, tenant, AllTenants).Result()
+	if err != nil {
+		fmt.Printf("Failed to load tenant quota %v\n", err)
+		return Quota{}
+	}
+	for _, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var q Quota
+		if err := json.Unmarshal([]byte(raw), &q); err == nil {
+			return q
+		}
+	}
+	return Quota{}
+}
+
+// Check a push of size bytes, counting it against the tenant's push rate
+func (l *Limiter) CheckPush(ctx context.Context, tenant string, size int64) error {
+	q := l.QuotaFor(ctx, tenant)
+	if q.MaxPayloadBytes > 0 && size > q.MaxPayloadBytes {
+		return reject(&QuotaError{Tenant: tenant, Quota: QuotaPayloadSize, Limit: q.MaxPayloadBytes})
+	}
+	if q.MaxPushesPerMinute > 0 {
+		return l.take(ctx, tenant, QuotaPushRate, q.MaxPushesPerMinute, time.Minute)
+	}
+	return nil
+}
+
+// Give back a push CheckPush counted, e.g. a retry only found to be a duplicate once applied
+func (l *Limiter) RefundPush(ctx context.Context, tenant string) {
+	if l.QuotaFor(ctx, tenant).MaxPushesPerMinute <= 0 {
+		return
+	}
+	key := windowKey(QuotaPushRate, tenant, clock.Now(l.Clock).Truncate(time.Minute))
+	// a window that rolled over since the check has nothing to give back
+	if n, err := l.Client.Get(ctx, key).Int64(); err != nil || n <= 0 {
+		return
+	}
+	if err := l.Client.Decr(ctx, key).Err(); err != nil {
+		fmt.Printf("Failed to refund %s for %s %v\n", QuotaPushRate, tenant, err)
+	}
+}
+
+// Check a job about to be published, counting it against the tenant's hourly jobs
+func (l *Limiter) CheckJob(ctx context.Context, tenant string) error {
+	q := l.QuotaFor(ctx, tenant)
+	if q.MaxJobsPerHour > 0 {
+		return l.take(ctx, tenant, QuotaJobs, q.MaxJobsPerHour, time.Hour)
+	}
+	return nil
+}
+
+// Deployments from names that fit the tenant's history quota
+// deployments already tracked always fit, new ones only while there is room
+func (l *Limiter) HistoryAllowed(ctx context.Context, tenant string, tracked map[string]bool, names []string) []string {
+	return historyAllowed(l.QuotaFor(ctx, tenant), tenant, tracked, names)
+}
+
+func historyAllowed(q Quota, tenant string, tracked map[string]bool, names []string) []string {
+	if q.MaxHistoryDeployments <= 0 {
+		return names
+	}
+	count := int64(len(tracked))
+	allowed := make([]string, 0, len(names))
+	for _, name := range names {
+		if tracked[name] {
+			allowed = append(allowed, name)
+		} else if count < q.MaxHistoryDeployments {
+			allowed = append(allowed, name)
+			count++
+		} else {
+			reject(&QuotaError{Tenant: tenant, Quota: QuotaHistory, Limit: q.MaxHistoryDeployments})
+		}
+	}
+	metrics.TenantQuotaUsage.WithLabelValues(tenant, QuotaHistory).Set(float64(count))
+	return allowed
+}
+
+// fixed window counter
+// Key - tenants:<quota>:<tenant>:<window start>
+func (l *Limiter) take(ctx context.Context, tenant string, quota string, limit int64, window time.Duration) error {
+	now := clock.Now(l.Clock)
+	start := now.Truncate(window)
+	key := windowKey(quota, tenant, start)
+
+	pipe := l.Client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 2*window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Failed to count %s for %s %v\n", quota, tenant, err)
+		return nil
+	}
+
+	count := incr.Val()
+	metrics.TenantQuotaUsage.WithLabelValues(tenant, quota).Set(float64(count))
+	if count > limit {
+		return reject(&QuotaError{Tenant: tenant, Quota: quota, Limit: limit, RetryAfter: start.Add(window).Sub(now)})
+	}
+	return nil
+}
+
+func windowKey(quota string, tenant string, start time.Time) string {
+	return fmt.Sprintf("tenants:%s:%s:%s", quota, tenant, strconv.FormatInt(start.Unix(), 10))
+}
+
+func reject(e *QuotaError) error {
+	metrics.TenantQuotaRejections.WithLabelValues(e.Tenant, e.Quota).Inc()
+	return e
+}
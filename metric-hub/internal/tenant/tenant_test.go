@@ -0,0 +1,57 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestHistoryAllowedKeepsTrackedDeployments(t *testing.T) {
+	q := Quota{MaxHistoryDeployments: 2}
+	tracked := map[string]bool{"shop/cart": true}
+
+	got := historyAllowed(q, "shop", tracked, []string{"shop/cart", "shop/checkout", "shop/frontend"})
+	if len(got) != 2 || got[0] != "shop/cart" || got[1] != "shop/checkout" {
+		t.Errorf("expected cart and checkout, got %v", got)
+	}
+
+	full := map[string]bool{"shop/a": true, "shop/b": true}
+	got = historyAllowed(q, "shop", full, []string{"shop/a", "shop/c"})
+	if len(got) != 1 || got[0] != "shop/a" {
+		t.Errorf("expected only the tracked deployment, got %v", got)
+	}
+
+	if got := historyAllowed(Quota{}, "shop", full, []string{"shop/c"}); len(got) != 1 {
+		t.Errorf("expected no limit without a quota, got %v", got)
+	}
+}
+
+func TestTakeResetsOnNextWindow(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	c := clock.NewFake(time.Date(2025, 1, 1, 10, 0, 10, 0, time.UTC))
+	l := &Limiter{Client: client, Clock: c}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := l.take(ctx, "shop", QuotaPushRate, 2, time.Minute); err != nil {
+			t.Fatalf("expected push %d to be allowed, got %v", i+1, err)
+		}
+	}
+	err := l.take(ctx, "shop", QuotaPushRate, 2, time.Minute)
+	var qe *QuotaError
+	if !errors.As(err, &qe) || qe.RetryAfter != 50*time.Second {
+		t.Fatalf("expected a quota error retrying after 50s, got %v", err)
+	}
+
+	c.Advance(50 * time.Second)
+	if err := l.take(ctx, "shop", QuotaPushRate, 2, time.Minute); err != nil {
+		t.Errorf("expected the next window to allow pushes, got %v", err)
+	}
+}
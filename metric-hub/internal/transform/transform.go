@@ -0,0 +1,175 @@
+// Package transform rewrites incoming payloads into the shape the hub expects
+// steps come from config and run in order on every payload before it is validated and saved
+package transform
+
+import (
+	"errors"
+	"path"
+	"slices"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+// Step types
+const (
+	RenameNamespace = "rename_namespace"
+	DropDeployments = "drop_deployments"
+	ConvertUnits    = "convert_units"
+	InjectLabels    = "inject_labels"
+)
+
+// a cost payload needs at least one deployment
+var ErrAllDropped = errors.New("every deployment was dropped")
+
+type Step struct {
+	Type string `json:"type" validate:"required,oneof=rename_namespace drop_deployments convert_units inject_labels"`
+	// payloads from these producers only, every producer when empty
+	Sources []string `json:"sources,omitempty"`
+	// rename_namespace
+	From string `json:"from,omitempty" validate:"required_if=Type rename_namespace"`
+	To   string `json:"to,omitempty" validate:"required_if=Type rename_namespace"`
+	// deployments dropped, or given labels, as path.Match patterns
+	// inject_labels applies to every deployment when empty
+	Deployments []string `json:"deployments,omitempty" validate:"required_if=Type drop_deployments"`
+	// convert_units, every cpu or memory figure is multiplied by its scale, 0 leaves it alone
+	CPUScale    float64 `json:"cpu_scale,omitempty" validate:"gte=0"`
+	MemoryScale float64 `json:"memory_scale,omitempty" validate:"gte=0"`
+	// inject_labels, labels the deployment already has are kept unless Overwrite is set
+	Labels    map[string]string `json:"labels,omitempty" validate:"required_if=Type inject_labels"`
+	Overwrite bool              `json:"overwrite,omitempty"`
+}
+
+// Steps run in order, each sees the output of the one before
+type Pipeline []Step
+
+// Rewrite a cost payload pushed by source
+func (p Pipeline) Cost(source string, payload *internal.CostPayload) error {
+	for _, s := range p {
+		if !s.appliesTo(source) {
+			continue
+		}
+		payload.Namespace = s.namespace(payload.Namespace)
+		payload.Deployments = filter(s, payload.Deployments, func(d internal.CostDeployment) string { return d.Name })
+		for i := range payload.Deployments {
+			s.costDeployment(&payload.Deployments[i])
+		}
+	}
+	if len(payload.Deployments) == 0 {
+		return ErrAllDropped
+	}
+	return nil
+}
+
+// Rewrite a forecast, labels don't apply to it
+func (p Pipeline) Forecast(source string, payload *internal.ForecastPayload) error {
+	for _, s := range p {
+		if !s.appliesTo(source) {
+			continue
+		}
+		payload.Namespace = s.namespace(payload.Namespace)
+		payload.Deployments = filter(s, payload.Deployments, func(d internal.ForecastDeployment) string { return d.Name })
+		for i := range payload.Deployments {
+			s.scale(&payload.Deployments[i].PredictPeak24h)
+		}
+	}
+	if len(payload.Deployments) == 0 {
+		return ErrAllDropped
+	}
+	return nil
+}
+
+// Rewrite a delta, a dropped deployment is also never removed
+func (p Pipeline) Delta(source string, delta *internal.CostDelta) error {
+	changes := len(delta.Deployments) + len(delta.Removed)
+	for _, s := range p {
+		if !s.appliesTo(source) {
+			continue
+		}
+		delta.Namespace = s.namespace(delta.Namespace)
+		delta.Deployments = filter(s, delta.Deployments, func(d internal.CostDeployment) string { return d.Name })
+		delta.Removed = filter(s, delta.Removed, func(name string) string { return name })
+		for i := range delta.Deployments {
+			s.costDeployment(&delta.Deployments[i])
+		}
+	}
+	// a delta that only carries cluster figures has nothing to drop
+	if changes > 0 && len(delta.Deployments)+len(delta.Removed) == 0 {
+		return ErrAllDropped
+	}
+	return nil
+}
+
+func (s Step) appliesTo(source string) bool {
+	return len(s.Sources) == 0 || slices.Contains(s.Sources, source)
+}
+
+func (s Step) namespace(ns string) string {
+	if s.Type == RenameNamespace && ns == s.From {
+		return s.To
+	}
+	return ns
+}
+
+func (s Step) matches(name string) bool {
+	for _, pattern := range s.Deployments {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// items whose name matches a drop_deployments pattern are removed
+func filter[T any](s Step, items []T, name func(T) string) []T {
+	if s.Type != DropDeployments {
+		return items
+	}
+	return slices.DeleteFunc(items, func(item T) bool { return s.matches(name(item)) })
+}
+
+func (s Step) costDeployment(d *internal.CostDeployment) {
+	switch s.Type {
+	case ConvertUnits:
+		s.scale(&d.CurrentRequests)
+		s.scale(&d.CurrentUsage)
+		if l := d.CurrentLimits; l != nil {
+			limits := internal.Resources{CPUCores: l.CPUCores, MemoryMB: l.MemoryMB}
+			s.scale(&limits)
+			*l = internal.ResourceBounds{CPUCores: limits.CPUCores, MemoryMB: limits.MemoryMB}
+		}
+		if d.PredictPeak24h != nil {
+			s.scale(d.PredictPeak24h)
+		}
+		if u := d.UsageStats; u != nil {
+			for _, r := range []*internal.Resources{u.Avg, u.P95, u.Max} {
+				if r != nil {
+					s.scale(r)
+				}
+			}
+		}
+	case InjectLabels:
+		if len(s.Deployments) > 0 && !s.matches(d.Name) {
+			return
+		}
+		if d.Labels == nil {
+			d.Labels = map[string]string{}
+		}
+		for k, v := range s.Labels {
+			if _, ok := d.Labels[k]; !ok || s.Overwrite {
+				d.Labels[k] = v
+			}
+		}
+	}
+}
+
+func (s Step) scale(r *internal.Resources) {
+	if s.Type != ConvertUnits {
+		return
+	}
+	if s.CPUScale > 0 {
+		r.CPUCores *= s.CPUScale
+	}
+	if s.MemoryScale > 0 {
+		r.MemoryMB *= s.MemoryScale
+	}
+}
@@ -0,0 +1,107 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal"
+)
+
+func costPayload() *internal.CostPayload {
+	return &internal.CostPayload{
+		Namespace: "online-boutique",
+		Deployments: []internal.CostDeployment{
+			{Name: "cartservice", CurrentRequests: internal.Resources{CPUCores: 300, MemoryMB: 750}, CurrentUsage: internal.Resources{CPUCores: 60, MemoryMB: 38}},
+			{Name: "loadgenerator", CurrentRequests: internal.Resources{CPUCores: 300, MemoryMB: 750}, CurrentUsage: internal.Resources{CPUCores: 60, MemoryMB: 38}},
+			{Name: "redis-cart", CurrentRequests: internal.Resources{CPUCores: 70, MemoryMB: 200}, CurrentUsage: internal.Resources{CPUCores: 5, MemoryMB: 20}, Labels: map[string]string{"team": "data"}},
+		},
+	}
+}
+
+func TestPipelineRewritesCostPayload(t *testing.T) {
+	p := Pipeline{
+		{Type: RenameNamespace, From: "online-boutique", To: "default"},
+		{Type: DropDeployments, Deployments: []string{"load*"}},
+		// millicores
+		{Type: ConvertUnits, CPUScale: 0.001},
+		{Type: InjectLabels, Labels: map[string]string{"team": "shop"}},
+	}
+	payload := costPayload()
+	if err := p.Cost("cost-engine", payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Namespace != "default" {
+		t.Errorf("expected namespace default, got %s", payload.Namespace)
+	}
+	if len(payload.Deployments) != 2 || payload.Deployments[0].Name != "cartservice" || payload.Deployments[1].Name != "redis-cart" {
+		t.Fatalf("expected loadgenerator dropped, got %+v", payload.Deployments)
+	}
+	d := payload.Deployments[0]
+	if d.CurrentRequests.CPUCores != 0.3 || d.CurrentUsage.CPUCores != 0.06 || d.CurrentRequests.MemoryMB != 750 {
+		t.Errorf("expected cpu converted to cores and memory untouched, got %+v", d)
+	}
+	if d.Labels["team"] != "shop" {
+		t.Errorf("expected team label injected, got %v", d.Labels)
+	}
+	// existing labels are kept without overwrite
+	if payload.Deployments[1].Labels["team"] != "data" {
+		t.Errorf("expected redis-cart to keep team data, got %v", payload.Deployments[1].Labels)
+	}
+}
+
+func TestPipelineStepsScopedToSources(t *testing.T) {
+	p := Pipeline{{Type: ConvertUnits, Sources: []string{"datadog"}, MemoryScale: 2}}
+	payload := costPayload()
+	if err := p.Cost("cost-engine", payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Deployments[0].CurrentRequests.MemoryMB != 750 {
+		t.Errorf("expected the datadog step to skip cost-engine, got %v", payload.Deployments[0].CurrentRequests.MemoryMB)
+	}
+	if err := p.Cost("datadog", payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Deployments[0].CurrentRequests.MemoryMB != 1500 {
+		t.Errorf("expected memory doubled for datadog, got %v", payload.Deployments[0].CurrentRequests.MemoryMB)
+	}
+}
+
+func TestPipelineDroppingEverything(t *testing.T) {
+	p := Pipeline{{Type: DropDeployments, Deployments: []string{"*"}}}
+	if err := p.Cost("cost-engine", costPayload()); !errors.Is(err, ErrAllDropped) {
+		t.Errorf("expected ErrAllDropped, got %v", err)
+	}
+
+	delta := &internal.CostDelta{Namespace: "default", Deployments: costPayload().Deployments, Removed: []string{"frontend"}}
+	if err := p.Delta("cost-engine", delta); !errors.Is(err, ErrAllDropped) {
+		t.Errorf("expected ErrAllDropped, got %v", err)
+	}
+	if len(delta.Deployments) != 0 || len(delta.Removed) != 0 {
+		t.Errorf("expected a dropped deployment to be neither changed nor removed, got %+v", delta)
+	}
+
+	// nothing to drop from a delta of cluster figures only
+	if err := p.Delta("cost-engine", &internal.CostDelta{Namespace: "default", ClusterInfo: &internal.ClusterInfo{VmCount: 3}}); err != nil {
+		t.Errorf("expected a cluster only delta accepted, got %v", err)
+	}
+}
+
+func TestPipelineSteps(t *testing.T) {
+	v := internal.NewValidator()
+	for _, tc := range []struct {
+		step  Step
+		valid bool
+	}{
+		{Step{Type: RenameNamespace, From: "prod", To: "default"}, true},
+		{Step{Type: RenameNamespace, From: "prod"}, false},
+		{Step{Type: DropDeployments}, false},
+		{Step{Type: ConvertUnits, CPUScale: -1}, false},
+		{Step{Type: InjectLabels, Labels: map[string]string{"team": "shop"}}, true},
+		{Step{Type: "sort"}, false},
+	} {
+		if err := v.Validate(&tc.step); (err == nil) != tc.valid {
+			t.Errorf("expected %+v valid=%v, got %v", tc.step, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Either representation of a resource amount, numbers in the hub's units or Kubernetes quantity strings
+// e.g. {"cpu_cores": 0.5, "memory_mb": 512} or {"cpu": "500m", "memory": "512Mi"}
+type resourceQuantities struct {
+	CPUCores *float64 `json:"cpu_cores"`
+	MemoryMB *float64 `json:"memory_mb"`
+	CPU      string   `json:"cpu"`
+	Memory   string   `json:"memory"`
+}
+
+// cores and MB (2^20 bytes, as the hub counts memory everywhere), a figure given both ways is rejected
+func (q resourceQuantities) normalise() (cpu float64, memory float64, err error) {
+	if q.CPUCores != nil {
+		cpu = *q.CPUCores
+	}
+	if q.MemoryMB != nil {
+		memory = *q.MemoryMB
+	}
+	if q.CPU != "" {
+		if q.CPUCores != nil {
+			return 0, 0, errors.New("cpu_cores and cpu are both set")
+		}
+		if cpu, err = CPUCores(q.CPU); err != nil {
+			return 0, 0, err
+		}
+	}
+	if q.Memory != "" {
+		if q.MemoryMB != nil {
+			return 0, 0, errors.New("memory_mb and memory are both set")
+		}
+		if memory, err = MemoryMB(q.Memory); err != nil {
+			return 0, 0, err
+		}
+	}
+	return cpu, memory, nil
+}
+
+// Cores in a Kubernetes CPU quantity, e.g. 500m is 0.5
+func CPUCores(quantity string) (float64, error) {
+	q, err := resource.ParseQuantity(quantity)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cpu quantity %q: %w", quantity, err)
+	}
+	return q.AsApproximateFloat64(), nil
+}
+
+// MB in a Kubernetes memory quantity, e.g. 2Gi is 2048 and 512M is about 488
+func MemoryMB(quantity string) (float64, error) {
+	q, err := resource.ParseQuantity(quantity)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory quantity %q: %w", quantity, err)
+	}
+	return q.AsApproximateFloat64() / (1 << 20), nil
+}
+
+// Accepts quantity strings as well as numbers, always written back as numbers
+func (r *Resources) UnmarshalJSON(data []byte) error {
+	var q resourceQuantities
+	if err := json.Unmarshal(data, &q); err != nil {
+		return err
+	}
+	cpu, memory, err := q.normalise()
+	if err != nil {
+		return err
+	}
+	*r = Resources{CPUCores: cpu, MemoryMB: memory}
+	return nil
+}
+
+func (b *ResourceBounds) UnmarshalJSON(data []byte) error {
+	var q resourceQuantities
+	if err := json.Unmarshal(data, &q); err != nil {
+		return err
+	}
+	cpu, memory, err := q.normalise()
+	if err != nil {
+		return err
+	}
+	*b = ResourceBounds{CPUCores: cpu, MemoryMB: memory}
+	return nil
+}
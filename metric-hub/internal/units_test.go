@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestResourcesAcceptQuantityStrings(t *testing.T) {
+	var d CostDeployment
+	err := json.Unmarshal([]byte(`{
+		"name": "cartservice",
+		"current_requests": {"cpu": "500m", "memory": "2Gi"},
+		"current_usage": {"cpu_cores": 0.06, "memory": "512M"}
+	}`), &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.CurrentRequests.CPUCores != 0.5 || d.CurrentRequests.MemoryMB != 2048 {
+		t.Errorf("expected 0.5 cores and 2048MB, got %+v", d.CurrentRequests)
+	}
+	// decimal megabytes are not the hub's MB
+	if d.CurrentUsage.CPUCores != 0.06 || math.Abs(d.CurrentUsage.MemoryMB-488.28125) > 1e-9 {
+		t.Errorf("expected 0.06 cores and 488.28MB, got %+v", d.CurrentUsage)
+	}
+
+	out, _ := json.Marshal(d.CurrentRequests)
+	if string(out) != `{"cpu_cores":0.5,"memory_mb":2048}` {
+		t.Errorf("expected numbers written back, got %s", out)
+	}
+}
+
+func TestResourcesRejectBadQuantities(t *testing.T) {
+	for _, raw := range []string{
+		`{"cpu": "half", "memory_mb": 512}`,
+		`{"cpu_cores": 0.5, "cpu": "500m"}`,
+		`{"memory_mb": 512, "memory": "512Mi"}`,
+	} {
+		var r Resources
+		if err := json.Unmarshal([]byte(raw), &r); err == nil {
+			t.Errorf("expected %s to be rejected, got %+v", raw, r)
+		}
+	}
+
+	var b ResourceBounds
+	if err := json.Unmarshal([]byte(`{"cpu": "2"}`), &b); err != nil || b.CPUCores != 2 || b.MemoryMB != 0 {
+		t.Errorf("expected a 2 core bound with memory unset, got %+v %v", b, err)
+	}
+}
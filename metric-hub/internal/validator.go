@@ -12,11 +12,34 @@ type Validator struct {
 
 // instantiate validator
 func NewValidator() ValidatorInterface {
+	v := validator.New()
+	v.RegisterStructValidation(validateRequests, CostDeployment{})
 	return &Validator{
-		validate: validator.New(),
+		validate: v,
 	}
 }
 
 func (v *Validator) Validate(payload interface{}) error {
 	return v.validate.Struct(payload)
 }
+
+// requests are optional, a deployment without them is classified rather than rejected
+// a limit set below its request is rejected, the API server would never admit it
+func validateRequests(sl validator.StructLevel) {
+	d := sl.Current().Interface().(CostDeployment)
+	r := d.CurrentRequests
+	if r.CPUCores < 0 {
+		sl.ReportError(r.CPUCores, "CurrentRequests.CPUCores", "cpu_cores", "gte", "0")
+	}
+	if r.MemoryMB < 0 {
+		sl.ReportError(r.MemoryMB, "CurrentRequests.MemoryMB", "memory_mb", "gte", "0")
+	}
+	if l := d.CurrentLimits; l != nil {
+		if l.CPUCores > 0 && l.CPUCores < r.CPUCores {
+			sl.ReportError(l.CPUCores, "CurrentLimits.CPUCores", "cpu_cores", "gtefield", "CurrentRequests.CPUCores")
+		}
+		if l.MemoryMB > 0 && l.MemoryMB < r.MemoryMB {
+			sl.ReportError(l.MemoryMB, "CurrentLimits.MemoryMB", "memory_mb", "gtefield", "CurrentRequests.MemoryMB")
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package wal keeps a local append-only log of the Redis writes the hub can't rebuild,
+// so the latest payload and cooldowns survive a Redis flush or a failover to an empty replica
+package wal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// One SET, the log holds a JSON line per entry
+type Entry struct {
+	Time  time.Time `json:"time"`
+	Key   string    `json:"key"`
+	Value string    `json:"value"`
+	// when the key expires in Redis, zero for a key without a TTL
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// whether the key has expired by now
+func (e Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !e.ExpiresAt.After(now)
+}
+
+type Log struct {
+	Path string
+	// rewritten down to the last value of each key past this size
+	MaxBytes int64
+	// time source, the system clock when nil
+	Clock clock.Clock
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	latest map[string]Entry
+}
+
+// Open the log at path, creating it when missing
+// a line cut short by a crash is dropped
+func Open(path string, maxBytes int64) (*Log, error) {
+	l := &Log{Path: path, MaxBytes: maxBytes, latest: map[string]Entry{}}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if err := l.compact(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) load() error {
+	f, err := os.Open(l.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open write-ahead log %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// cost payloads can run to megabytes
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Key == "" {
+			continue
+		}
+		l.latest[e.Key] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read write-ahead log %w", err)
+	}
+	return nil
+}
+
+// Record a write Redis has accepted with its TTL, zero for none, synced to disk before returning
+func (l *Log) Append(key string, value string, ttl time.Duration) error {
+	e := Entry{Time: clock.Now(l.Clock), Key: key, Value: value}
+	if ttl > 0 {
+		e.ExpiresAt = e.Time.Add(ttl)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal log entry %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return os.ErrClosed
+	}
+	n, err := l.file.Write(append(line, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to append to write-ahead log %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log %w", err)
+	}
+	l.latest[key] = e
+	if l.MaxBytes > 0 && l.size > l.MaxBytes {
+		return l.compact()
+	}
+	return nil
+}
+
+// Rewrite the log with only the last value of each key, expired keys are dropped
+// the new file replaces the old one in a rename, so a crash leaves one of them whole
+func (l *Log) compact() error {
+	now := clock.Now(l.Clock)
+	for key, e := range l.latest {
+		if e.expired(now) {
+			delete(l.latest, key)
+		}
+	}
+
+	tmp := l.Path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create write-ahead log %w", err)
+	}
+	w := bufio.NewWriter(f)
+	var size int64
+	for _, e := range l.entries() {
+		line, err := json.Marshal(e)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to marshal log entry %w", err)
+		}
+		n, _ := w.Write(append(line, '\n'))
+		size += int64(n)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write write-ahead log %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync write-ahead log %w", err)
+	}
+	f.Close()
+	if err := os.Rename(tmp, l.Path); err != nil {
+		return fmt.Errorf("failed to replace write-ahead log %w", err)
+	}
+
+	if l.file != nil {
+		l.file.Close()
+	}
+	if l.file, err = os.OpenFile(l.Path, os.O_APPEND|os.O_WRONLY, 0o600); err != nil {
+		return fmt.Errorf("failed to open write-ahead log %w", err)
+	}
+	l.size = size
+	return nil
+}
+
+// last value of each key, oldest first
+func (l *Log) entries() []Entry {
+	entries := make([]Entry, 0, len(l.latest))
+	for _, e := range l.latest {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries
+}
+
+// Last value of each key, oldest first
+func (l *Log) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.entries()
+}
+
+// Write back every logged key Redis no longer has, returns the number restored
+// keys still in Redis are newer or the same, so they are never overwritten
+// keys with a TTL get what is left of it, those already expired are skipped
+func (l *Log) Replay(ctx context.Context, client *redis.Client) (int, error) {
+	now := clock.Now(l.Clock)
+	pipe := client.Pipeline()
+	var cmds []*redis.BoolCmd
+	for _, e := range l.Entries() {
+		if e.expired(now) {
+			continue
+		}
+		var ttl time.Duration
+		if !e.ExpiresAt.IsZero() {
+			ttl = e.ExpiresAt.Sub(now)
+		}
+		cmds = append(cmds, pipe.SetNX(ctx, e.Key, e.Value, ttl))
+	}
+	if len(cmds) == 0 {
+		return 0, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("[Failed] SETNX redis: %w", err)
+	}
+
+	restored := 0
+	for _, cmd := range cmds {
+		if cmd.Val() {
+			restored++
+		}
+	}
+	metrics.WALReplayedKeys.Add(float64(restored))
+	return restored, nil
+}
+
+// Run replays the log whenever Redis has lost sentinel, at once and then every interval until ctx is cancelled
+// the sentinel is a key Redis only loses in a flush or failover, such as cost:latest
+func (l *Log) Run(ctx context.Context, client *redis.Client, sentinel string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := l.replayIfLost(ctx, client, sentinel); err != nil {
+			fmt.Printf("[WAL] replay failed %v\n", err)
+		} else if n > 0 {
+			fmt.Printf("[WAL] %s was lost, restored %d keys\n", sentinel, n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *Log) replayIfLost(ctx context.Context, client *redis.Client, sentinel string) (int, error) {
+	l.mu.Lock()
+	_, logged := l.latest[sentinel]
+	l.mu.Unlock()
+	if !logged {
+		return 0, nil
+	}
+	exists, err := client.Exists(ctx, sentinel).Result()
+	if err != nil || exists == 1 {
+		return 0, err
+	}
+	return l.Replay(ctx, client)
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,144 @@
+package wal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ianwong123/kubernetes-cost-optimiser/metric-hub/internal/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestOpenKeepsLastValueAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hub.wal")
+	l, err := Open(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append("cost:latest", `{"sequence":1}`, 0)
+	l.Append("trigger:cooldown:cart", "100", time.Hour)
+	l.Append("cost:latest", `{"sequence":2}`, 0)
+	l.Close()
+
+	// a crash mid-write leaves half a line
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString(`{"time":"2025-01-01T00:00:00Z","key":"cost:lat`)
+	f.Close()
+
+	l, err = Open(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	entries := l.Entries()
+	if len(entries) != 2 || entries[1].Key != "cost:latest" || entries[1].Value != `{"sequence":2}` {
+		t.Errorf("expected the cooldown and the last payload, got %+v", entries)
+	}
+}
+
+func TestAppendCompactsPastMaxBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hub.wal")
+	l, err := Open(path, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := 0; i < 20; i++ {
+		if err := l.Append("cost:latest", `{"deployments":["cart","web","checkout"]}`, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 512 {
+		t.Errorf("expected the log compacted under 512 bytes, got %d", info.Size())
+	}
+}
+
+func TestReplayOnlyRestoresLostKeys(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	l, err := Open(filepath.Join(t.TempDir(), "hub.wal"), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Append("cost:latest", `{"sequence":1}`, 0)
+	l.Append("trigger:cooldown:cart", "100", time.Hour)
+	mr.Set("cost:latest", `{"sequence":2}`)
+
+	if n, err := l.replayIfLost(ctx, client, "cost:latest"); err != nil || n != 0 {
+		t.Errorf("expected no replay while cost:latest exists, got %d %v", n, err)
+	}
+
+	mr.FlushAll()
+	mr.Set("trigger:cooldown:cart", "200")
+	n, err := l.replayIfLost(ctx, client, "cost:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected only cost:latest restored, got %d", n)
+	}
+	if v, _ := mr.Get("trigger:cooldown:cart"); v != "200" {
+		t.Errorf("expected the newer cooldown kept, got %s", v)
+	}
+	if v, _ := mr.Get("cost:latest"); v != `{"sequence":1}` {
+		t.Errorf("expected the logged payload, got %s", v)
+	}
+}
+
+func TestReplayKeepsRemainingTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "hub.wal")
+	l, err := Open(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(time.Date(2025, 12, 22, 14, 0, 0, 0, time.UTC))
+	l.Clock = fake
+	l.Append("cost:latest", `{"sequence":1}`, 0)
+	l.Append("trigger:cooldown:cart", "100", time.Hour)
+	l.Append("trigger:cooldown:web", "100", 10*time.Minute)
+
+	fake.Advance(20 * time.Minute)
+	n, err := l.Replay(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || mr.Exists("trigger:cooldown:web") {
+		t.Errorf("expected the expired cooldown skipped, restored %d", n)
+	}
+	if ttl := mr.TTL("trigger:cooldown:cart"); ttl != 40*time.Minute {
+		t.Errorf("expected the cooldown's remaining 40m, got %s", ttl)
+	}
+	if ttl := mr.TTL("cost:latest"); ttl != 0 {
+		t.Errorf("expected cost:latest without a TTL, got %s", ttl)
+	}
+
+	// compaction drops the expired cooldown from the file
+	if err := l.compact(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if entries := l.Entries(); len(entries) != 2 {
+		t.Errorf("expected the payload and the live cooldown, got %+v", entries)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "trigger:cooldown:web") {
+		t.Errorf("expected the expired cooldown gone from the log, got %s", data)
+	}
+}
@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// a deployment missing from payloads this long warms up again when it comes back
+const WarmupExpiry = 7 * 24 * time.Hour
+
+// Key - warmup:<namespace>/<name>, cost payloads the deployment has appeared in
+func warmupKey(ns string, name string) string {
+	return "warmup:" + deploymentLockKey(ns, name)
+}
+
+// Count the payload towards the deployment's warm-up, true once more than samples payloads were seen
+// errors count as warming so a broken cache never floods the queue
+func (a *Aggregator) warmedUp(ctx context.Context, ns string, name string, samples int) bool {
+	if samples <= 0 {
+		return true
+	}
+	key := warmupKey(ns, name)
+	pipe := a.Client.Pipeline()
+	seen := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, WarmupExpiry)
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Redis error %v\n", err)
+		return false
+	}
+	return seen.Val() > int64(samples)
+}